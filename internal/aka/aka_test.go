@@ -0,0 +1,166 @@
+package aka_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/aka"
+)
+
+// Test set 1 of 3GPP TS 35.208.
+const (
+	testK    = "465b5ce8b199b49faa5f0a2ee238a6bc"
+	testRAND = "23553cbe9637a89d218ae64dae47bf35"
+	testSQN  = "ff9bb4d0b607"
+	testAMF  = "b9b9"
+	testOP   = "cdc202d5123e20f62b6d676ac72cb318"
+	testOPc  = "cd63cb71954a9f4e48a5994e37a02baf"
+)
+
+var _ = Describe("MILENAGE", func() {
+	It("should compute the conformance test set", func() {
+		opc, err := aka.ComputeOPc(unhex(testK), unhex(testOP))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hex.EncodeToString(opc)).To(Equal(testOPc))
+
+		m, err := aka.NewMilenage(unhex(testK), opc)
+		Expect(err).NotTo(HaveOccurred())
+
+		macA, macS := m.F1(unhex(testRAND), unhex(testSQN), unhex(testAMF))
+		Expect(hex.EncodeToString(macA)).To(Equal("4a9ffac354dfafb3"))
+		Expect(hex.EncodeToString(macS)).To(Equal("01cfaf9ec4e871e9"))
+
+		res, ck, ik, ak := m.F2345(unhex(testRAND))
+		Expect(hex.EncodeToString(res)).To(Equal("a54211d5e3ba50bf"))
+		Expect(hex.EncodeToString(ck)).To(Equal("b40ba9a3c58b2a05bbf0d987b21bf8cb"))
+		Expect(hex.EncodeToString(ik)).To(Equal("f769bcd751044604127672711c6d3441"))
+		Expect(hex.EncodeToString(ak)).To(Equal("aa689c648370"))
+		Expect(hex.EncodeToString(m.F5Star(unhex(testRAND)))).To(Equal("451e8beca43b"))
+	})
+})
+
+var _ = Describe("5G-AKA", func() {
+	const snn = "5G:mnc001.mcc999.3gppnetwork.org"
+	var m *aka.Milenage
+
+	BeforeEach(func() {
+		var err error
+		m, err = aka.NewMilenage(unhex(testK), unhex(testOPc))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should derive the serving network name", func() {
+		Expect(aka.ServingNetworkName("999", "01")).To(Equal(snn))
+		Expect(aka.ServingNetworkName("310", "170")).To(Equal("5G:mnc170.mcc310.3gppnetwork.org"))
+	})
+
+	It("should accept the response of the UE to a challenge", func() {
+		v := m.GenerateVector(unhex(testRAND), 0x20, snn)
+		Expect(v.AUTN).To(HaveLen(aka.AUTNLen))
+		Expect(v.KAUSF).To(HaveLen(32))
+		Expect(v.HXRESStar).To(Equal(aka.HResStar(v.RAND, v.XRESStar)))
+
+		resStar, sqn, err := m.Authenticate(v.RAND, v.AUTN, snn, 0x1f)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqn).To(Equal(uint64(0x20)))
+		Expect(resStar).To(Equal(v.XRESStar))
+
+		// the response is bound to the serving network
+		resStar, _, err = m.Authenticate(v.RAND, v.AUTN, "5G:mnc002.mcc999.3gppnetwork.org", 0x1f)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resStar).NotTo(Equal(v.XRESStar))
+	})
+
+	It("should reject a forged challenge", func() {
+		v := m.GenerateVector(unhex(testRAND), 0x20, snn)
+		v.AUTN[len(v.AUTN)-1] ^= 1
+		_, _, err := m.Authenticate(v.RAND, v.AUTN, snn, 0x1f)
+		Expect(err).To(MatchError(aka.ErrMACFailure))
+	})
+
+	It("should resynchronize a sequence number out of range", func() {
+		v := m.GenerateVector(unhex(testRAND), 0x20, snn)
+		_, _, err := m.Authenticate(v.RAND, v.AUTN, snn, 0x40)
+		Expect(err).To(MatchError(aka.ErrSyncFailure))
+
+		sqnMS, err := m.Resync(v.RAND, m.AUTS(v.RAND, 0x40))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqnMS).To(Equal(uint64(0x40)))
+
+		auts := m.AUTS(v.RAND, 0x40)
+		auts[len(auts)-1] ^= 1
+		_, err = m.Resync(v.RAND, auts)
+		Expect(err).To(MatchError(aka.ErrMACFailure))
+	})
+})
+
+var _ = Describe("Key store", func() {
+	It("should generate the challenges of the subscribers with increasing SQNs", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "keys.yaml")
+		Expect(os.WriteFile(path, []byte(`
+- supi: imsi-999010000000123
+  k: `+testK+`
+  opc: `+testOPc+`
+  sqn: "000000000020"
+- supi: imsi-999010000000124
+  k: `+testK+`
+  op: `+testOP+`
+`), 0o600)).To(Succeed())
+
+		s, err := aka.LoadKeyStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Has("imsi-999010000000123")).To(BeTrue())
+		Expect(s.Has("imsi-999010000000125")).To(BeFalse())
+
+		m, err := aka.NewMilenage(unhex(testK), unhex(testOPc))
+		Expect(err).NotTo(HaveOccurred())
+		snn := aka.ServingNetworkName("999", "01")
+
+		v, err := s.Challenge("imsi-999010000000123", snn)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.SQN).To(Equal(uint64(0x21)))
+		_, sqn, err := m.Authenticate(v.RAND, v.AUTN, snn, 0x20)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqn).To(Equal(uint64(0x21)))
+
+		// the OPc is derived from the OP
+		v, err = s.Challenge("imsi-999010000000124", snn)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = m.Authenticate(v.RAND, v.AUTN, snn, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		// a resync lets the next challenge pass the check of the UE
+		v, err = s.Challenge("imsi-999010000000123", snn)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Resync("imsi-999010000000123", v.RAND, m.AUTS(v.RAND, 0x1000))).To(Succeed())
+		v, err = s.Challenge("imsi-999010000000123", snn)
+		Expect(err).NotTo(HaveOccurred())
+		_, sqn, err = m.Authenticate(v.RAND, v.AUTN, snn, 0x1000)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqn).To(Equal(uint64(0x1001)))
+
+		_, err = s.Challenge("imsi-999010000000125", snn)
+		Expect(errors.Is(err, aka.ErrUnknownSubscriber)).To(BeTrue())
+	})
+
+	It("should reject an invalid subscriber", func() {
+		_, err := aka.NewKeyStore([]aka.Subscriber{{SUPI: "imsi-999010000000123", K: testK}})
+		Expect(err).To(HaveOccurred())
+		_, err = aka.NewKeyStore([]aka.Subscriber{{SUPI: "imsi-999010000000123", K: "00", OPc: testOPc}})
+		Expect(err).To(HaveOccurred())
+		_, err = aka.NewKeyStore([]aka.Subscriber{{SUPI: "imsi-999010000000123", K: testK, OPc: testOPc, SQN: "1"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func unhex(s string) []byte {
+	GinkgoHelper()
+	b, err := hex.DecodeString(s)
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}
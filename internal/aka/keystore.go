@@ -0,0 +1,167 @@
+package aka
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ErrUnknownSubscriber is returned for a SUPI with no authentication subscription.
+var ErrUnknownSubscriber = errors.New("unknown subscriber")
+
+// Subscriber is the authentication subscription of a UE, as listed in a key store file:
+//
+//   - supi: imsi-999010000000123
+//     k: 465b5ce8b199b49faa5f0a2ee238a6bc
+//     opc: cd63cb71954a9f4e48a5994e37a02baf
+//     sqn: "000000000020"
+//
+// The keys are given in hex. The OPc may be replaced with the operator variant OP, and the
+// sequence number is the last one used by the home network (default: 0).
+type Subscriber struct {
+	SUPI string `json:"supi"`
+	K    string `json:"k"`
+	OPc  string `json:"opc,omitempty"`
+	OP   string `json:"op,omitempty"`
+	SQN  string `json:"sqn,omitempty"`
+}
+
+type subscription struct {
+	milenage *Milenage
+	sqn      uint64
+}
+
+// KeyStore holds the subscriber keys and the sequence numbers of the home network, and generates
+// the authentication vectors of the subscribers.
+type KeyStore struct {
+	mu   sync.Mutex
+	subs map[string]*subscription
+}
+
+// NewKeyStore returns a key store of the given subscribers.
+func NewKeyStore(subs []Subscriber) (*KeyStore, error) {
+	s := &KeyStore{subs: map[string]*subscription{}}
+	for _, sub := range subs {
+		if sub.SUPI == "" {
+			return nil, errors.New("subscriber with no SUPI")
+		}
+		if _, ok := s.subs[sub.SUPI]; ok {
+			return nil, fmt.Errorf("duplicate subscriber %q", sub.SUPI)
+		}
+		m, sqn, err := sub.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid subscriber %q: %w", sub.SUPI, err)
+		}
+		s.subs[sub.SUPI] = &subscription{milenage: m, sqn: sqn}
+	}
+	return s, nil
+}
+
+// LoadKeyStore returns a key store of the subscribers listed in a YAML or JSON file.
+func LoadKeyStore(path string) (*KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the key store: %w", err)
+	}
+	var subs []Subscriber
+	if err := yaml.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("failed to parse the key store %s: %w", path, err)
+	}
+	return NewKeyStore(subs)
+}
+
+func (sub Subscriber) parse() (*Milenage, uint64, error) {
+	k, err := hex.DecodeString(sub.K)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid K: %w", err)
+	}
+	var opc []byte
+	switch {
+	case sub.OPc != "":
+		if opc, err = hex.DecodeString(sub.OPc); err != nil {
+			return nil, 0, fmt.Errorf("invalid OPc: %w", err)
+		}
+	case sub.OP != "":
+		op, err := hex.DecodeString(sub.OP)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid OP: %w", err)
+		}
+		if opc, err = ComputeOPc(k, op); err != nil {
+			return nil, 0, err
+		}
+	default:
+		return nil, 0, errors.New("either OPc or OP must be set")
+	}
+	m, err := NewMilenage(k, opc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var sqn uint64
+	if sub.SQN != "" {
+		if sqn, err = ParseSQN(sub.SQN); err != nil {
+			return nil, 0, err
+		}
+	}
+	return m, sqn, nil
+}
+
+// Has returns true if a SUPI has an authentication subscription.
+func (s *KeyStore) Has(supi string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.subs[supi]
+	return ok
+}
+
+// Challenge generates a fresh authentication vector of a subscriber for the serving network,
+// with a random RAND and the next sequence number.
+func (s *KeyStore) Challenge(supi, snn string) (Vector, error) {
+	r := make([]byte, RandLen)
+	if _, err := rand.Read(r); err != nil {
+		return Vector{}, fmt.Errorf("failed to draw RAND: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[supi]
+	if !ok {
+		return Vector{}, fmt.Errorf("%w %q", ErrUnknownSubscriber, supi)
+	}
+	sub.sqn = (sub.sqn + 1) & MaxSQN
+	return sub.milenage.GenerateVector(r, sub.sqn, snn), nil
+}
+
+// Resync checks the resynchronization token of a subscriber for the RAND of a challenge and
+// resets the sequence number of the home network to the one of the UE, so that the next
+// challenge is accepted.
+func (s *KeyStore) Resync(supi string, rand, auts []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[supi]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownSubscriber, supi)
+	}
+	sqnMS, err := sub.milenage.Resync(rand, auts)
+	if err != nil {
+		return err
+	}
+	sub.sqn = sqnMS
+	return nil
+}
+
+// SQN returns the last sequence number used for a subscriber.
+func (s *KeyStore) SQN(supi string) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[supi]
+	if !ok {
+		return 0, false
+	}
+	return sub.sqn, true
+}
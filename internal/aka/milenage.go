@@ -0,0 +1,128 @@
+// Package aka implements the 5G-AKA authentication of 3GPP TS 33.501: the MILENAGE algorithm set
+// of 3GPP TS 35.206 computing the authentication functions f1-f5 and f1*/f5* of a subscriber, the
+// derivation of the 5G authentication vectors of the home network and of the response of the UE,
+// and the subscriber key store the authentication vectors are generated from.
+package aka
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+// The lengths of the parameters of the authentication functions, in bytes.
+const (
+	KeyLen  = 16
+	RandLen = 16
+	SQNLen  = 6
+	AMFLen  = 2
+	MACLen  = 8
+	RESLen  = 8
+	AKLen   = 6
+	AUTNLen = SQNLen + AMFLen + MACLen
+	AUTSLen = SQNLen + MACLen
+)
+
+// Milenage computes the MILENAGE authentication functions of a subscriber.
+type Milenage struct {
+	block cipher.Block
+	opc   []byte
+}
+
+// NewMilenage returns the MILENAGE functions of a subscriber key K and the derived operator
+// variant OPc.
+func NewMilenage(k, opc []byte) (*Milenage, error) {
+	if len(k) != KeyLen || len(opc) != KeyLen {
+		return nil, fmt.Errorf("K and OPc must be %d bytes", KeyLen)
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return &Milenage{block: block, opc: append([]byte{}, opc...)}, nil
+}
+
+// ComputeOPc derives OPc from a subscriber key K and the operator variant OP.
+func ComputeOPc(k, op []byte) ([]byte, error) {
+	if len(k) != KeyLen || len(op) != KeyLen {
+		return nil, fmt.Errorf("K and OP must be %d bytes", KeyLen)
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	opc := make([]byte, KeyLen)
+	block.Encrypt(opc, op)
+	xor(opc, opc, op)
+	return opc, nil
+}
+
+// F1 computes the network authentication code MAC-A (f1) and the resynchronization
+// authentication code MAC-S (f1*).
+func (m *Milenage) F1(rand, sqn, amf []byte) (macA, macS []byte) {
+	temp := m.temp(rand)
+
+	in1 := make([]byte, 16)
+	copy(in1[0:], sqn[:SQNLen])
+	copy(in1[6:], amf[:AMFLen])
+	copy(in1[8:], sqn[:SQNLen])
+	copy(in1[14:], amf[:AMFLen])
+
+	// OUT1 = E_K(TEMP xor rot(IN1 xor OPc, r1) xor c1) xor OPc, with r1 = 64 and c1 = 0
+	xor(in1, in1, m.opc)
+	out := rotate(in1, 8)
+	xor(out, out, temp)
+	m.block.Encrypt(out, out)
+	xor(out, out, m.opc)
+
+	return out[:8], out[8:]
+}
+
+// F2345 computes the response RES (f2), the cipher key CK (f3), the integrity key IK (f4) and the
+// anonymity key AK (f5).
+func (m *Milenage) F2345(rand []byte) (res, ck, ik, ak []byte) {
+	temp := m.temp(rand)
+
+	out2 := m.out(temp, 0, 1)
+	return out2[8:], m.out(temp, 4, 2), m.out(temp, 8, 4), out2[:AKLen]
+}
+
+// F5Star computes the anonymity key AK* of the resynchronization (f5*).
+func (m *Milenage) F5Star(rand []byte) []byte {
+	return m.out(m.temp(rand), 12, 8)[:AKLen]
+}
+
+// temp computes TEMP = E_K(RAND xor OPc).
+func (m *Milenage) temp(rand []byte) []byte {
+	temp := make([]byte, 16)
+	xor(temp, rand[:RandLen], m.opc)
+	m.block.Encrypt(temp, temp)
+	return temp
+}
+
+// out computes OUTi = E_K(rot(TEMP xor OPc, ri) xor ci) xor OPc, with ri given in bytes and ci
+// all zeroes but the last byte.
+func (m *Milenage) out(temp []byte, r int, c byte) []byte {
+	in := make([]byte, 16)
+	xor(in, temp, m.opc)
+	out := rotate(in, r)
+	out[15] ^= c
+	m.block.Encrypt(out, out)
+	xor(out, out, m.opc)
+	return out
+}
+
+// rotate rotates a 16-byte block left by r bytes.
+func rotate(b []byte, r int) []byte {
+	out := make([]byte, 16)
+	for i := range out {
+		out[i] = b[(i+r)%16]
+	}
+	return out
+}
+
+func xor(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
@@ -0,0 +1,172 @@
+package aka
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The function codes of the key derivations of 3GPP TS 33.501 Annex A.
+const (
+	fcKAUSF   = 0x6A
+	fcRESStar = 0x6B
+)
+
+// MaxSQNDelta is the largest step the UE accepts the sequence number of a challenge to advance
+// by, the limit Δ of 3GPP TS 33.102 Annex C.2.
+const MaxSQNDelta = 1 << 28
+
+// MaxSQN is the largest 48-bit sequence number.
+const MaxSQN = 1<<48 - 1
+
+// AMF5G is the authentication management field of the 5G authentication vectors: the AMF
+// separation bit is set.
+var AMF5G = []byte{0x80, 0x00}
+
+var (
+	// ErrMACFailure is returned for a challenge or a resynchronization token that fails the
+	// authentication code check.
+	ErrMACFailure = errors.New("MAC failure")
+	// ErrSyncFailure is returned by the UE for a challenge with a sequence number out of range,
+	// to be answered with a resynchronization token.
+	ErrSyncFailure = errors.New("synchronization failure")
+)
+
+// Vector is a 5G home environment authentication vector.
+type Vector struct {
+	RAND, AUTN, XRESStar, KAUSF []byte
+	// HXRESStar is the hash of the expected response the serving network checks the response
+	// of the UE against.
+	HXRESStar []byte
+	SQN       uint64
+}
+
+// ServingNetworkName returns the serving network name of a PLMN the keys are bound to, e.g.,
+// 5G:mnc001.mcc999.3gppnetwork.org.
+func ServingNetworkName(mcc, mnc string) string {
+	return fmt.Sprintf("5G:mnc%03s.mcc%s.3gppnetwork.org", mnc, mcc)
+}
+
+// GenerateVector generates the authentication vector of a challenge with the given RAND and SQN
+// for the serving network.
+func (m *Milenage) GenerateVector(rand []byte, sqn uint64, snn string) Vector {
+	sqnb := encodeSQN(sqn)
+	macA, _ := m.F1(rand, sqnb, AMF5G)
+	res, ck, ik, ak := m.F2345(rand)
+
+	concealed := make([]byte, SQNLen)
+	xor(concealed, sqnb, ak)
+	autn := append(append(append([]byte{}, concealed...), AMF5G...), macA...)
+
+	xresStar := ResStar(ck, ik, snn, rand, res)
+	return Vector{
+		RAND:      append([]byte{}, rand...),
+		AUTN:      autn,
+		XRESStar:  xresStar,
+		HXRESStar: HResStar(rand, xresStar),
+		KAUSF:     kdf(append(append([]byte{}, ck...), ik...), fcKAUSF, []byte(snn), concealed),
+		SQN:       sqn,
+	}
+}
+
+// Authenticate is the USIM side of a challenge: it checks the AUTN of the challenge and that its
+// sequence number is in range of the highest sequence number accepted so far, and returns the
+// response RES* and the sequence number of the challenge. ErrSyncFailure is returned if the
+// sequence number is out of range.
+func (m *Milenage) Authenticate(rand, autn []byte, snn string, sqnMS uint64) ([]byte, uint64, error) {
+	if len(rand) != RandLen || len(autn) != AUTNLen {
+		return nil, 0, fmt.Errorf("RAND must be %d bytes and AUTN %d bytes", RandLen, AUTNLen)
+	}
+	res, ck, ik, ak := m.F2345(rand)
+	sqnb := make([]byte, SQNLen)
+	xor(sqnb, autn[:SQNLen], ak)
+	macA, _ := m.F1(rand, sqnb, autn[SQNLen:SQNLen+AMFLen])
+	if !hmac.Equal(macA, autn[SQNLen+AMFLen:]) {
+		return nil, 0, ErrMACFailure
+	}
+
+	sqn := decodeSQN(sqnb)
+	if sqn <= sqnMS || sqn-sqnMS > MaxSQNDelta {
+		return nil, sqn, ErrSyncFailure
+	}
+	return ResStar(ck, ik, snn, rand, res), sqn, nil
+}
+
+// AUTS returns the resynchronization token of the UE for a challenge, carrying the highest
+// sequence number accepted by the UE concealed with AK*.
+func (m *Milenage) AUTS(rand []byte, sqnMS uint64) []byte {
+	sqnb := encodeSQN(sqnMS)
+	_, macS := m.F1(rand, sqnb, make([]byte, AMFLen))
+	auts := make([]byte, SQNLen)
+	xor(auts, sqnb, m.F5Star(rand))
+	return append(auts, macS...)
+}
+
+// Resync checks the resynchronization token of the UE for a challenge and returns the highest
+// sequence number accepted by the UE.
+func (m *Milenage) Resync(rand, auts []byte) (uint64, error) {
+	if len(auts) != AUTSLen {
+		return 0, fmt.Errorf("AUTS must be %d bytes", AUTSLen)
+	}
+	sqnb := make([]byte, SQNLen)
+	xor(sqnb, auts[:SQNLen], m.F5Star(rand))
+	// the AMF of the resynchronization is all zeroes
+	_, macS := m.F1(rand, sqnb, make([]byte, AMFLen))
+	if !hmac.Equal(macS, auts[SQNLen:]) {
+		return 0, ErrMACFailure
+	}
+	return decodeSQN(sqnb), nil
+}
+
+// ResStar derives the response RES* (XRES* in the home network) from the RES of a challenge.
+func ResStar(ck, ik []byte, snn string, rand, res []byte) []byte {
+	out := kdf(append(append([]byte{}, ck...), ik...), fcRESStar, []byte(snn), rand, res)
+	return out[len(out)-16:]
+}
+
+// HResStar returns the hash HRES* (HXRES*) of a response RES* (XRES*).
+func HResStar(rand, resStar []byte) []byte {
+	h := sha256.Sum256(append(append([]byte{}, rand...), resStar...))
+	return h[16:]
+}
+
+// kdf is the key derivation function of 3GPP TS 33.220 Annex B.2: HMAC-SHA-256 of the function
+// code followed by each parameter and its 2-byte length.
+func kdf(key []byte, fc byte, params ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte{fc})
+	var l [2]byte
+	for _, p := range params {
+		mac.Write(p)
+		binary.BigEndian.PutUint16(l[:], uint16(len(p)))
+		mac.Write(l[:])
+	}
+	return mac.Sum(nil)
+}
+
+func encodeSQN(sqn uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], sqn&MaxSQN)
+	return b[8-SQNLen:]
+}
+
+func decodeSQN(b []byte) uint64 {
+	var sqn [8]byte
+	copy(sqn[8-SQNLen:], b)
+	return binary.BigEndian.Uint64(sqn[:])
+}
+
+// ParseSQN parses a sequence number given as 12 hex digits, e.g., 0000000000a1.
+func ParseSQN(s string) (uint64, error) {
+	var sqn uint64
+	if len(s) != 2*SQNLen || strings.Trim(strings.ToLower(s), "0123456789abcdef") != "" {
+		return 0, fmt.Errorf("invalid SQN %q: expected %d hex digits", s, 2*SQNLen)
+	}
+	if _, err := fmt.Sscanf(s, "%x", &sqn); err != nil {
+		return 0, fmt.Errorf("invalid SQN %q: %w", s, err)
+	}
+	return sqn, nil
+}
@@ -0,0 +1,43 @@
+// Package correlation implements the correlation IDs that tie together the log lines of the
+// operators processing the same UE request. The ID is generated when a Registration or a Session
+// is admitted and is carried in an annotation of the view objects derived from it, e.g., the
+// RegState, the AUSF:MobileIdentity and the UDM:Config of a registration.
+package correlation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Annotation is the annotation of the view objects carrying the correlation ID.
+	Annotation = "dctrl5g.io/correlation-id"
+	// LogKey is the key of the correlation ID in the log lines.
+	LogKey = "correlation-id"
+)
+
+// NewID returns a random correlation ID.
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate correlation ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ID returns the correlation ID of an object, or the empty string if it has none.
+func ID(obj metav1.Object) string {
+	return obj.GetAnnotations()[Annotation]
+}
+
+// Logger returns the logger with the correlation ID of an object attached, if any.
+func Logger(log logr.Logger, obj metav1.Object) logr.Logger {
+	if id := ID(obj); id != "" {
+		return log.WithValues(LogKey, id)
+	}
+	return log
+}
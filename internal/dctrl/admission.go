@@ -0,0 +1,139 @@
+package dctrl
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AdmissionPolicy implements site-specific admission rules for the UE requests, e.g., to block
+// certain PLMNs. The checks run on the create, update and patch paths of the API server: a
+// non-nil error rejects the request with a Forbidden status before it reaches the operators.
+type AdmissionPolicy interface {
+	// AdmitRegistration checks the spec of a new or a modified AMF:Registration.
+	AdmitRegistration(spec map[string]any) error
+	// AdmitSession checks the spec of a new or a modified AMF:Session.
+	AdmitSession(spec map[string]any) error
+}
+
+// admissionClient is the client of the API server that runs the admission policy on the writes.
+type admissionClient struct {
+	client.Client
+	policy AdmissionPolicy
+}
+
+func (c *admissionClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		if err := c.admit(u); err != nil {
+			return err
+		}
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *admissionClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		if err := c.admit(u); err != nil {
+			return err
+		}
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// Patch checks the object as it would be after the patch. If the object cannot be patched the
+// check is skipped and the patch fails on its own.
+func (c *admissionClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok && admitted(u.GroupVersionKind()) {
+		if patched, err := c.patched(ctx, u, patch); err == nil {
+			if err := c.admit(patched); err != nil {
+				return err
+			}
+		}
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// admitted returns whether the admission policy checks the objects of a kind.
+func admitted(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == "amf.view.dcontroller.io" && (gvk.Kind == "Registration" || gvk.Kind == "Session")
+}
+
+// admit runs the admission policy on an object.
+func (c *admissionClient) admit(u *unstructured.Unstructured) error {
+	gvk := u.GroupVersionKind()
+	if !admitted(gvk) {
+		return nil
+	}
+
+	spec, _, _ := unstructured.NestedMap(u.UnstructuredContent(), "spec")
+	var err error
+	switch gvk.Kind {
+	case "Registration":
+		err = c.policy.AdmitRegistration(spec)
+	case "Session":
+		err = c.policy.AdmitSession(spec)
+	}
+	if err != nil {
+		return apierrors.NewForbidden(groupResource(c, gvk), u.GetName(), err)
+	}
+	return nil
+}
+
+// groupResource returns the resource of a kind as served by the API server.
+func groupResource(c client.Client, gvk schema.GroupVersionKind) schema.GroupResource {
+	if mapper := c.RESTMapper(); mapper != nil {
+		if m, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			return m.Resource.GroupResource()
+		}
+	}
+	return schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}
+}
+
+// patched returns the stored object with a patch applied.
+func (c *admissionClient) patched(ctx context.Context, obj *unstructured.Unstructured, patch client.Patch) (*unstructured.Unstructured, error) {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(current.Object)
+	if err != nil {
+		return nil, err
+	}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	switch patch.Type() {
+	case types.JSONPatchType:
+		p, err := jsonpatch.DecodePatch(data)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = p.Apply(doc)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// the strategic merge and the apply patches of the unstructured objects merge like a
+		// JSON merge patch
+		doc, err = jsonpatch.MergePatch(doc, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &unstructured.Unstructured{}
+	if err := json.Unmarshal(doc, &ret.Object); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,163 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// blockSuciPrefix rejects the registrations with a SUCI of the given prefix.
+type blockSuciPrefix string
+
+func (p blockSuciPrefix) AdmitRegistration(spec map[string]any) error {
+	suci, _, _ := unstructured.NestedString(spec, "mobileIdentity", "value")
+	if strings.HasPrefix(suci, string(p)) {
+		return fmt.Errorf("SUCI %q is blocked", suci)
+	}
+	return nil
+}
+
+func (p blockSuciPrefix) AdmitSession(map[string]any) error { return nil }
+
+var _ = Describe("Admission policy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should block the registrations rejected by the policy", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:         opSpecs,
+			APIServerPort:   dctrl.EphemeralAPIServerPort,
+			AdmissionPolicy: blockSuciPrefix("suci-0-999-01-02-bad"),
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		dc, err := dynamic.NewForConfig(&rest.Config{Host: fmt.Sprintf("http://localhost:%d", port)})
+		Expect(err).NotTo(HaveOccurred())
+		regs := dc.Resource(schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}).Namespace("user-1")
+
+		newReg := func(name, suci string) *unstructured.Unstructured {
+			yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %s
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name, suci)
+			reg := &unstructured.Unstructured{}
+			Expect(yaml.Unmarshal([]byte(yamlData), &reg.Object)).To(Succeed())
+			return reg
+		}
+
+		// an admitted registration goes through once the API server is up
+		Eventually(func() error {
+			_, err := regs.Create(ctx, newReg("user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"),
+				metav1.CreateOptions{})
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		// a blocked registration is rejected and never stored
+		_, err = regs.Create(ctx, newReg("user-2", "suci-0-999-01-02-bad0000000000000"),
+			metav1.CreateOptions{})
+		Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+
+		_, err = regs.Get(ctx, "user-2", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should block the updates and the patches rejected by the policy", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:         opSpecs,
+			APIServerPort:   dctrl.EphemeralAPIServerPort,
+			AdmissionPolicy: blockSuciPrefix("suci-0-999-01-02-bad"),
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		dc, err := dynamic.NewForConfig(&rest.Config{Host: fmt.Sprintf("http://localhost:%d", port)})
+		Expect(err).NotTo(HaveOccurred())
+		regs := dc.Resource(schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}).Namespace("user-1")
+
+		reg := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`), &reg.Object)).To(Succeed())
+		Eventually(func() error {
+			_, err := regs.Create(ctx, reg, metav1.CreateOptions{})
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		// an update swapping in a blocked SUCI is rejected
+		stored, err := regs.Get(ctx, "user-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unstructured.SetNestedField(stored.Object, "suci-0-999-01-02-bad0000000000000",
+			"spec", "mobileIdentity", "value")).To(Succeed())
+		_, err = regs.Update(ctx, stored, metav1.UpdateOptions{})
+		Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+
+		// so is a patch
+		patch := []byte(`{"spec":{"mobileIdentity":{"value":"suci-0-999-01-02-bad0000000000000"}}}`)
+		_, err = regs.Patch(ctx, "user-1", types.MergePatchType, patch, metav1.PatchOptions{})
+		Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+
+		stored, err = regs.Get(ctx, "user-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		suci, _, _ := unstructured.NestedString(stored.Object, "spec", "mobileIdentity", "value")
+		Expect(suci).To(Equal("suci-0-999-01-02-4f2a7b9c8d13e7a5c0"))
+	})
+})
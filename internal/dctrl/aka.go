@@ -0,0 +1,362 @@
+package dctrl
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/aka"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	ueclient "github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+// authResultTableName and authResultTableNamespace identify the AUSF:AuthResultTable.
+const (
+	authResultTableName      = "auth-results"
+	authResultTableNamespace = "default"
+)
+
+// akaController runs the 5G-AKA authentication of the UEs in the AUSF. For each mobile identity
+// resolved to the SUPI of a subscriber of the key store, an authentication vector is generated
+// and the challenge is exposed as an ausf/AuthChallenge named after the mobile identity, i.e.,
+// after the registration:
+//
+//	spec:
+//	  rand: 23553cbe9637a89d218ae64dae47bf35
+//	  autn: 2cc4b8a3ae3b8000f5ad5b0a3b1b5a93
+//	  hxresStar: 0c4d1d3b07b2f5a2f8b1b0d8e3a4c6f1
+//	  servingNetworkName: 5G:mnc001.mcc999.3gppnetwork.org
+//
+// The challenge is completed with an ausf/AuthResponse of the same name carrying the response
+// of the UE in spec.resStar, or the resynchronization token of the UE in spec.auts if the
+// sequence number of the challenge is out of range, which resets the sequence number of the
+// subscriber and reissues the challenge. The RES* is verified against the XRES* of the vector,
+// and the verdict is set in the Authenticated condition of the challenge and of the response and
+// in the AUSF:AuthResultTable, from where the AMF sets the Authenticated condition of the
+// registration.
+type akaController struct {
+	client     client.Client
+	store      *aka.KeyStore
+	mu         sync.Mutex
+	challenges map[client.ObjectKey]*akaChallenge
+	log        logr.Logger
+}
+
+// akaChallenge is the state of the authentication of a UE.
+type akaChallenge struct {
+	supi, snn string
+	vector    aka.Vector
+	// response is the last response processed, verdict is set once the UE is authenticated or
+	// rejected
+	response string
+	verdict  bool
+}
+
+// addAKAController adds the 5G-AKA controllers to the AUSF operator.
+func addAKAController(op *trackedOperator, c client.Client, store *aka.KeyStore, logger logr.Logger) error {
+	r := &akaController{
+		client:     c,
+		store:      store,
+		challenges: map[client.ObjectKey]*akaChallenge{},
+		log:        logger.WithName("aka"),
+	}
+	if err := addWatchController(op, "ausf", "aka-enabler", "AuthResultTable",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileTable)); err != nil {
+		return err
+	}
+	if err := addWatchController(op, "ausf", "aka-challenger", "MobileIdentity",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileIdentity)); err != nil {
+		return err
+	}
+	return addWatchController(op, "ausf", "aka-verifier", "AuthResponse",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileResponse))
+}
+
+// reconcileTable enables the 5G-AKA in the AMF, which then waits for the verdict of the AUSF.
+func (r *akaController) reconcileTable(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+	if enabled, _, _ := unstructured.NestedBool(req.Object.UnstructuredContent(), "spec", "enabled"); enabled {
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{}, r.updateTable(ctx, func(table object.Object) (bool, error) {
+		return true, unstructured.SetNestedField(table.UnstructuredContent(), true, "spec", "enabled")
+	})
+}
+
+// reconcileIdentity challenges the UE of a resolved mobile identity.
+func (r *akaController) reconcileIdentity(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		r.mu.Lock()
+		delete(r.challenges, key)
+		r.mu.Unlock()
+
+		ch := object.NewViewObject("ausf", "AuthChallenge")
+		object.SetName(ch, key.Namespace, key.Name)
+		if err := r.client.Delete(ctx, ch); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to delete the authentication challenge: %w", err)
+		}
+		return reconcile.Result{}, r.setResult(ctx, key, nil)
+	}
+
+	supi, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "status", "supi")
+	if supi == "" || !isReady(req.Object) {
+		// the registration fails with SupiNotFound
+		return reconcile.Result{}, nil
+	}
+
+	r.mu.Lock()
+	ch, ok := r.challenges[key]
+	r.mu.Unlock()
+	if ok && ch.supi == supi {
+		return reconcile.Result{}, nil
+	}
+
+	if !r.store.Has(supi) {
+		r.log.V(1).Info("no authentication subscription", "mobile-identity", key.String(), "supi", supi)
+		return reconcile.Result{}, r.reject(ctx, key, &akaChallenge{supi: supi}, metrics.ReasonSubscriberNotFound,
+			"No authentication subscription for the SUPI")
+	}
+
+	suci, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "suci")
+	u, err := ueclient.ParseSUCI(suci)
+	if err != nil {
+		return reconcile.Result{}, r.reject(ctx, key, &akaChallenge{supi: supi}, metrics.ReasonServingNetworkUnknown,
+			"Cannot derive the serving network name from the SUCI")
+	}
+
+	ch = &akaChallenge{supi: supi, snn: aka.ServingNetworkName(u.MCC, u.MNC)}
+	return reconcile.Result{}, r.challenge(ctx, key, ch, metrics.ReasonChallengeSent, "Waiting for the response of the UE")
+}
+
+// challenge generates a fresh authentication vector and exposes it in the challenge of the UE.
+func (r *akaController) challenge(ctx context.Context, key client.ObjectKey, ch *akaChallenge, reason, message string) error {
+	v, err := r.store.Challenge(ch.supi, ch.snn)
+	if err != nil {
+		return err
+	}
+	ch.vector = v
+
+	r.mu.Lock()
+	r.challenges[key] = ch
+	r.mu.Unlock()
+
+	spec := map[string]any{
+		"rand":               hex.EncodeToString(v.RAND),
+		"autn":               hex.EncodeToString(v.AUTN),
+		"hxresStar":          hex.EncodeToString(v.HXRESStar),
+		"servingNetworkName": ch.snn,
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("ausf", "AuthChallenge")
+		object.SetName(obj, key.Namespace, key.Name)
+		create := false
+		if err := r.client.Get(ctx, key, obj); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			create = true
+		}
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+			return err
+		}
+		if err := setAuthenticated(obj, "Unknown", reason, message); err != nil {
+			return err
+		}
+		if create {
+			return r.client.Create(ctx, obj)
+		}
+		return r.client.Update(ctx, obj)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write the authentication challenge %s: %w", key, err)
+	}
+	r.log.V(1).Info("challenge sent", "mobile-identity", key.String(), "sqn", v.SQN)
+	return nil
+}
+
+// reconcileResponse verifies the response of the UE to its challenge.
+func (r *akaController) reconcileResponse(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+	key := client.ObjectKeyFromObject(req.Object)
+	resStar, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "resStar")
+	auts, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "auts")
+	if resStar == "" && auts == "" {
+		return reconcile.Result{}, nil
+	}
+
+	r.mu.Lock()
+	ch, ok := r.challenges[key]
+	done := false
+	if ok {
+		// the status updates of the response are not processed again
+		response := resStar + "/" + auts
+		done = ch.verdict || ch.response == response
+		ch.response = response
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		return reconcile.Result{}, r.setResponseStatus(ctx, key, "False", metrics.ReasonNoChallenge,
+			"No authentication challenge for the UE")
+	}
+	if done {
+		return reconcile.Result{}, nil
+	}
+
+	if auts != "" {
+		b, err := hex.DecodeString(auts)
+		if err == nil {
+			err = r.store.Resync(ch.supi, ch.vector.RAND, b)
+		}
+		if err != nil {
+			r.log.Info("resynchronization failed", "response", key.String(), "error", err.Error())
+			return reconcile.Result{}, r.reject(ctx, key, ch, metrics.ReasonSynchronizationFailure,
+				"Invalid resynchronization token")
+		}
+		// a new challenge with a sequence number in range
+		if err := r.challenge(ctx, key, ch, metrics.ReasonResynchronized,
+			"Sequence number resynchronized, waiting for the response of the UE"); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, r.setResponseStatus(ctx, key, "Unknown", metrics.ReasonResynchronized,
+			"Sequence number resynchronized, answer the new challenge")
+	}
+
+	b, err := hex.DecodeString(resStar)
+	if err != nil || !hmac.Equal(b, ch.vector.XRESStar) {
+		r.log.Info("authentication failed", "response", key.String(), "supi", ch.supi)
+		return reconcile.Result{}, r.reject(ctx, key, ch, metrics.ReasonAuthenticationFailure, "RES* mismatch")
+	}
+
+	r.mu.Lock()
+	ch.verdict = true
+	r.mu.Unlock()
+	r.log.V(1).Info("UE authenticated", "response", key.String(), "supi", ch.supi)
+	return reconcile.Result{}, r.conclude(ctx, key, "True", metrics.ReasonAuthenticationSuccess, "UE successfully authenticated")
+}
+
+// reject fails the authentication of a UE.
+func (r *akaController) reject(ctx context.Context, key client.ObjectKey, ch *akaChallenge, reason, message string) error {
+	r.mu.Lock()
+	ch.verdict = true
+	r.challenges[key] = ch
+	r.mu.Unlock()
+	return r.conclude(ctx, key, "False", reason, message)
+}
+
+// conclude records the verdict of the authentication of a UE.
+func (r *akaController) conclude(ctx context.Context, key client.ObjectKey, status, reason, message string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("ausf", "AuthChallenge")
+		if err := r.client.Get(ctx, key, obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if err := setAuthenticated(obj, status, reason, message); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, obj)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the authentication challenge %s: %w", key, err)
+	}
+	if err := r.setResponseStatus(ctx, key, status, reason, message); err != nil {
+		return err
+	}
+	return r.setResult(ctx, key, map[string]any{
+		"registration": key.String(),
+		"status":       status,
+		"reason":       reason,
+		"message":      message,
+	})
+}
+
+// setResponseStatus sets the Authenticated condition of the response of a UE, if any.
+func (r *akaController) setResponseStatus(ctx context.Context, key client.ObjectKey, status, reason, message string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("ausf", "AuthResponse")
+		if err := r.client.Get(ctx, key, obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if err := setAuthenticated(obj, status, reason, message); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, obj)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the authentication response %s: %w", key, err)
+	}
+	return nil
+}
+
+// setResult sets the verdict of the authentication of a registration in the result table, or
+// removes it if nil.
+func (r *akaController) setResult(ctx context.Context, key client.ObjectKey, result map[string]any) error {
+	return r.updateTable(ctx, func(table object.Object) (bool, error) {
+		results, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "results")
+		i := slices.IndexFunc(results, func(e any) bool {
+			m, ok := e.(map[string]any)
+			return ok && m["registration"] == key.String()
+		})
+		switch {
+		case result != nil && i < 0:
+			results = append(results, result)
+		case result != nil:
+			results[i] = result
+		case i >= 0:
+			results = slices.Delete(results, i, i+1)
+		default:
+			return false, nil
+		}
+		return true, unstructured.SetNestedSlice(table.UnstructuredContent(), results, "spec", "results")
+	})
+}
+
+// updateTable applies a change to the result table.
+func (r *akaController) updateTable(ctx context.Context, update func(table object.Object) (bool, error)) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("ausf", "AuthResultTable")
+		object.SetName(table, authResultTableNamespace, authResultTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		changed, err := update(table)
+		if err != nil || !changed {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		// the table may not be initialized yet: retry
+		return fmt.Errorf("failed to update the authentication result table: %w", err)
+	}
+	return nil
+}
+
+// setAuthenticated sets the Authenticated condition of a challenge or a response.
+func setAuthenticated(obj object.Object, status, reason, message string) error {
+	return unstructured.SetNestedSlice(obj.UnstructuredContent(), []any{map[string]any{
+		"type":    "Authenticated",
+		"status":  status,
+		"reason":  reason,
+		"message": message,
+	}}, "status", "conditions")
+}
@@ -0,0 +1,195 @@
+package dctrl_test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/aka"
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// The keys of the subscriber imsi-999010000000123 (test set 1 of 3GPP TS 35.208).
+const (
+	subscriberK   = "465b5ce8b199b49faa5f0a2ee238a6bc"
+	subscriberOPc = "cd63cb71954a9f4e48a5994e37a02baf"
+)
+
+var _ = Describe("5G-AKA", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+		usim   *aka.Milenage
+	)
+
+	BeforeEach(func() {
+		keyStore := filepath.Join(GinkgoT().TempDir(), "keys.yaml")
+		Expect(os.WriteFile(keyStore, []byte(fmt.Sprintf(`
+- supi: imsi-999010000000123
+  k: %s
+  opc: %s
+  sqn: "000000000020"`, subscriberK, subscriberOPc)), 0o600)).To(Succeed())
+
+		k, err := hex.DecodeString(subscriberK)
+		Expect(err).NotTo(HaveOccurred())
+		opc, err := hex.DecodeString(subscriberOPc)
+		Expect(err).NotTo(HaveOccurred())
+		usim, err = aka.NewMilenage(k, opc)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                opSpecs,
+			SubscriberKeyStoreFile: keyStore,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// authenticated returns a poller for the status and the reason of the Authenticated condition
+	// of the registration
+	authenticated := func() []string {
+		reg := object.NewViewObject("amf", "Registration")
+		object.SetName(reg, "user-1", "user-1")
+		if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+			return nil
+		}
+		conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+		for _, c := range conds {
+			if cond, ok := c.(map[string]any); ok && cond["type"] == "Authenticated" {
+				return []string{fmt.Sprint(cond["status"]), fmt.Sprint(cond["reason"])}
+			}
+		}
+		return nil
+	}
+
+	// challenge waits for a challenge with a RAND other than the given one and returns its
+	// RAND, AUTN and serving network name
+	challenge := func(prev string) (string, string, string) {
+		GinkgoHelper()
+		var rand, autn, snn string
+		Eventually(func() bool {
+			ch := object.NewViewObject("ausf", "AuthChallenge")
+			object.SetName(ch, "user-1", "user-1")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(ch), ch); err != nil {
+				return false
+			}
+			rand, _, _ = unstructured.NestedString(ch.UnstructuredContent(), "spec", "rand")
+			autn, _, _ = unstructured.NestedString(ch.UnstructuredContent(), "spec", "autn")
+			snn, _, _ = unstructured.NestedString(ch.UnstructuredContent(), "spec", "servingNetworkName")
+			return rand != "" && rand != prev
+		}, timeout, interval).Should(BeTrue())
+		return rand, autn, snn
+	}
+
+	// respond answers the challenge with the given response fields
+	respond := func(spec map[string]any) {
+		GinkgoHelper()
+		Expect(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			resp := object.NewViewObject("ausf", "AuthResponse")
+			object.SetName(resp, "user-1", "user-1")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(resp), resp); err != nil {
+				resp = object.NewViewObject("ausf", "AuthResponse")
+				object.SetName(resp, "user-1", "user-1")
+				if err := unstructured.SetNestedMap(resp.UnstructuredContent(), spec, "spec"); err != nil {
+					return err
+				}
+				return c.Create(ctx, resp)
+			}
+			if err := unstructured.SetNestedMap(resp.UnstructuredContent(), spec, "spec"); err != nil {
+				return err
+			}
+			return c.Update(ctx, resp)
+		})).To(Succeed())
+	}
+
+	// answer computes the response of the USIM to a challenge
+	answer := func(rand, autn, snn string, sqnMS uint64) (string, error) {
+		GinkgoHelper()
+		r, err := hex.DecodeString(rand)
+		Expect(err).NotTo(HaveOccurred())
+		a, err := hex.DecodeString(autn)
+		Expect(err).NotTo(HaveOccurred())
+		resStar, _, err := usim.Authenticate(r, a, snn, sqnMS)
+		return hex.EncodeToString(resStar), err
+	}
+
+	It("should authenticate a UE answering the challenge", func() {
+		rand, autn, snn := challenge("")
+		Expect(snn).To(Equal("5G:mnc001.mcc999.3gppnetwork.org"))
+		Eventually(authenticated, timeout, interval).Should(Equal([]string{"Unknown", "AuthenticationPending"}))
+
+		resStar, err := answer(rand, autn, snn, 0x20)
+		Expect(err).NotTo(HaveOccurred())
+		respond(map[string]any{"resStar": resStar})
+
+		Eventually(authenticated, timeout, interval).Should(Equal([]string{"True", "AuthenticationSuccess"}))
+	})
+
+	It("should reject a wrong RES*", func() {
+		// a response bound to another serving network
+		rand, autn, _ := challenge("")
+		resStar, err := answer(rand, autn, "5G:mnc002.mcc999.3gppnetwork.org", 0x20)
+		Expect(err).NotTo(HaveOccurred())
+		respond(map[string]any{"resStar": resStar})
+
+		Eventually(authenticated, timeout, interval).Should(Equal([]string{"False", "AuthenticationFailure"}))
+	})
+
+	It("should resynchronize a sequence number out of range", func() {
+		// the USIM has already seen a higher sequence number
+		const sqnMS = 0x1000
+		rand, autn, snn := challenge("")
+		_, err := answer(rand, autn, snn, sqnMS)
+		Expect(err).To(MatchError(aka.ErrSyncFailure))
+
+		r, err := hex.DecodeString(rand)
+		Expect(err).NotTo(HaveOccurred())
+		respond(map[string]any{"auts": hex.EncodeToString(usim.AUTS(r, sqnMS))})
+
+		// a new challenge with a sequence number in range
+		rand, autn, snn = challenge(rand)
+		resStar, err := answer(rand, autn, snn, sqnMS)
+		Expect(err).NotTo(HaveOccurred())
+		respond(map[string]any{"resStar": resStar})
+
+		Eventually(authenticated, timeout, interval).Should(Equal([]string{"True", "AuthenticationSuccess"}))
+	})
+})
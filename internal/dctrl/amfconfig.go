@@ -0,0 +1,88 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// DefaultMaxRequestedNSSAI is the default maximum number of S-NSSAIs in the requested NSSAI of a
+// registration, as capped by 3GPP.
+const DefaultMaxRequestedNSSAI = 8
+
+// configTableProjector writes the settings of the AMF config table given in the options over the
+// defaults the AMF initializes the table with. The table is created by the AMF itself, so the
+// settings are written on each change of the table, i.e., once the table is initialized, and
+// again after a reload of the AMF or an update of the table overwriting them.
+type configTableProjector struct {
+	client            client.Client
+	maxRequestedNSSAI int64
+	log               logr.Logger
+}
+
+// addConfigTableProjector adds the config table projector to the AMF operator.
+func addConfigTableProjector(op *trackedOperator, c client.Client, maxRequestedNSSAI int, logger logr.Logger) error {
+	if maxRequestedNSSAI <= 0 {
+		maxRequestedNSSAI = DefaultMaxRequestedNSSAI
+	}
+	r := &configTableProjector{
+		client:            c,
+		maxRequestedNSSAI: int64(maxRequestedNSSAI),
+		log:               logger.WithName("config-table-projector"),
+	}
+	return addWatchController(op, "amf", "config-table-projector", "ConfigTable", r)
+}
+
+func (r *configTableProjector) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted || req.Object.GetName() != configTableName {
+		return reconcile.Result{}, nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "ConfigTable")
+		object.SetName(table, "", configTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		current, _, _ := unstructured.NestedFieldNoCopy(table.UnstructuredContent(), "spec", "maxRequestedNSSAI")
+		if n, ok := toInt64(current); ok && n == r.maxRequestedNSSAI {
+			return nil
+		}
+		if err := unstructured.SetNestedField(table.UnstructuredContent(), r.maxRequestedNSSAI,
+			"spec", "maxRequestedNSSAI"); err != nil {
+			return err
+		}
+		r.log.V(1).Info("setting the maximum requested NSSAI", "max", r.maxRequestedNSSAI)
+		return r.client.Update(ctx, table)
+	})
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to update the config table: %w", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// toInt64 returns a number decoded from JSON or YAML as an int64.
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), float64(int64(n)) == n
+	}
+	return 0, false
+}
@@ -0,0 +1,107 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Maximum requested NSSAI", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:           opSpecs,
+			MaxRequestedNSSAI: 3,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+
+		// wait until the limit is set in the config table
+		Eventually(func() any {
+			table := object.NewViewObject("amf", "ConfigTable")
+			object.SetName(table, "", "amf-config")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+				return nil
+			}
+			n, _, _ := unstructured.NestedFieldNoCopy(table.UnstructuredContent(), "spec", "maxRequestedNSSAI")
+			return n
+		}, timeout, interval).Should(BeNumerically("==", 3))
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name string, slices int) {
+		nssai := []string{}
+		for i := 0; i < slices; i++ {
+			nssai = append(nssai, fmt.Sprintf("    - sliceType: eMBB\n      sliceDifferentiator: \"%06d\"", i+1))
+		}
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  ueStatus:
+    n1Mode: true
+  requestedNSSAI:
+%[2]s`, name, strings.Join(nssai, "\n"))
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	// validated returns a poller for the status and the reason of the Validated condition of a
+	// registration
+	validated := func(name string) func() []string {
+		return func() []string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return nil
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, c := range conds {
+				if cond, ok := c.(map[string]any); ok && cond["type"] == "Validated" {
+					return []string{fmt.Sprint(cond["status"]), fmt.Sprint(cond["reason"])}
+				}
+			}
+			return nil
+		}
+	}
+
+	It("should accept a requested NSSAI at the limit and reject one above it", func() {
+		register("user-1", 3)
+		register("user-2", 4)
+
+		Eventually(validated("user-1"), timeout, interval).Should(Equal([]string{"True", "Validated"}))
+		Eventually(validated("user-2"), timeout, interval).Should(Equal([]string{"False", "TooManyNSSAI"}))
+	})
+})
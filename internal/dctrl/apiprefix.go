@@ -0,0 +1,103 @@
+package dctrl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+)
+
+// apiPrefixProxy serves the API server under the API path prefix. The embedded API server mounts
+// its handlers at the root and does not let the handler chain be wrapped, so it is bound to a
+// loopback port and the proxy takes its address: the requests under the prefix are forwarded to
+// the API server with the prefix stripped, any other path is answered with 404. Watches are
+// streamed through as is.
+type apiPrefixProxy struct {
+	prefix   string
+	listener net.Listener
+	backend  *url.URL
+	// certFile and keyFile, if set, make the proxy serve TLS, like the API server it fronts
+	certFile, keyFile string
+	// minClientKeyBits, if positive, rejects the clients presenting a TLS certificate with a weak
+	// key: the client certificates end at the proxy, so the API server cannot check them
+	minClientKeyBits int
+	log              logr.Logger
+}
+
+// newAPIPrefixProxy creates the proxy serving the API server bound to backendPort on the loopback
+// interface under the prefix, on the listener taken from the API server.
+func newAPIPrefixProxy(prefix string, l net.Listener, backendPort int, httpMode bool, logger logr.Logger) *apiPrefixProxy {
+	scheme := "https"
+	if httpMode {
+		scheme = "http"
+	}
+	return &apiPrefixProxy{
+		prefix:   prefix,
+		listener: l,
+		backend:  &url.URL{Scheme: scheme, Host: net.JoinHostPort("localhost", strconv.Itoa(backendPort))},
+		log:      logger.WithName("api-prefix-proxy"),
+	}
+}
+
+func (p *apiPrefixProxy) handler() http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(p.backend)
+	// flush immediately so that the watch events are not held back
+	proxy.FlushInterval = -1
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// the API server is our own, on the loopback interface, with a possibly self-signed certificate
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	proxy.Transport = transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		p.log.V(1).Info("failed to reach the API server", "path", r.URL.Path, "error", err.Error())
+		http.Error(w, "API server unavailable", http.StatusBadGateway)
+	}
+
+	var h http.Handler = proxy
+	if p.minClientKeyBits > 0 {
+		next := h
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				if err := jwks.CheckClientKey(r.TLS.PeerCertificates[0], p.minClientKeyBits); err != nil {
+					http.Error(w, "invalid client certificate: "+err.Error(), http.StatusUnauthorized)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(p.prefix+"/", http.StripPrefix(p.prefix, h))
+	return mux
+}
+
+// Start serves the API server under the prefix until the context is cancelled.
+func (p *apiPrefixProxy) Start(ctx context.Context) {
+	srv := &http.Server{Handler: p.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close() //nolint:errcheck
+	}()
+
+	p.log.V(1).Info("serving the API server under the path prefix", "address", p.listener.Addr().String(),
+		"prefix", p.prefix, "backend", p.backend.String())
+	var err error
+	if p.certFile != "" {
+		srv.TLSConfig = &tls.Config{ClientAuth: tls.RequestClientCert, MinVersion: tls.VersionTLS12}
+		err = srv.ServeTLS(p.listener, p.certFile, p.keyFile)
+	} else {
+		err = srv.Serve(p.listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		p.log.Error(err, "API prefix proxy error")
+	}
+}
@@ -0,0 +1,81 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Authentication in HTTP mode", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should reject unauthenticated requests if HTTPAuth is set", func() {
+		keyFile, certFile, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:       opSpecs,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+			HTTPAuth:      true,
+			KeyFile:       keyFile,
+			CertFile:      certFile,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		gvr := schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}
+		host := fmt.Sprintf("http://localhost:%d", port)
+
+		// no token
+		dc, err := dynamic.NewForConfig(&rest.Config{Host: host})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() bool {
+			_, err := dc.Resource(gvr).Namespace("user-1").List(ctx, metav1.ListOptions{})
+			return apierrors.IsUnauthorized(err)
+		}, timeout, interval).Should(BeTrue())
+
+		// a token signed with the API server key
+		privateKey, err := auth.LoadPrivateKey(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		token, err := jwks.NewTokenGenerator(privateKey, "").GenerateToken("admin", []string{"*"},
+			[]rbacv1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+			time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		dc, err = dynamic.NewForConfig(&rest.Config{Host: host, BearerToken: token})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dc.Resource(gvr).Namespace("user-1").List(ctx, metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,115 @@
+package dctrl_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("UPF charging records", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// record returns a poller for the state and the number of the closed and the open intervals of
+	// the charging record of a session
+	record := func(name string) func() []any {
+		return func() []any {
+			obj := object.NewViewObject("upf", "ChargingRecord")
+			object.SetName(obj, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return nil
+			}
+			state, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "spec", "state")
+			intervals, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "spec", "intervals")
+			closed, open := 0, 0
+			for _, i := range intervals {
+				if _, ok := i.(map[string]any)["stop"]; ok {
+					closed++
+				} else {
+					open++
+				}
+			}
+			return []any{state, closed, open}
+		}
+	}
+
+	setIdle := func(name string, idle bool) {
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, name, name)
+		Eventually(func() error {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+			if err := unstructured.SetNestedField(obj.UnstructuredContent(), idle, "spec", "idle"); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	It("should pause and resume the record of an idled session", func() {
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(1))).To(Succeed())
+		Eventually(record("user-1"), timeout, interval).Should(Equal([]any{"Active", 0, 1}))
+
+		obj := object.NewViewObject("upf", "ChargingRecord")
+		object.SetName(obj, "user-1", "user-1")
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		guti, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "spec", "guti")
+		Expect(guti).To(Equal("guti-1"))
+
+		// active -> idle -> active
+		setIdle("user-1", true)
+		Eventually(record("user-1"), timeout, interval).Should(Equal([]any{"Paused", 1, 0}))
+		setIdle("user-1", false)
+		Eventually(record("user-1"), timeout, interval).Should(Equal([]any{"Active", 1, 1}))
+
+		// a single record with two intervals, also in the table
+		list := cache.NewViewObjectList("upf", "ChargingRecord")
+		Expect(c.List(ctx, list, client.InNamespace("user-1"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Eventually(func() []any {
+			table := object.NewViewObject("upf", "ChargingTable")
+			object.SetName(table, "", "charging-records")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+				return nil
+			}
+			records, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "records")
+			ret := []any{}
+			for _, r := range records {
+				// the initial test session is charged too
+				if e := r.(map[string]any); e["namespace"] == "user-1" {
+					ret = append(ret, []any{e["name"], e["state"], e["intervals"]})
+				}
+			}
+			return ret
+		}, timeout, interval).Should(Equal([]any{[]any{"user-1", "Active", int64(2)}}))
+
+		// the record is stopped with the session
+		Expect(c.Delete(ctx, newSessionContext(1))).To(Succeed())
+		Eventually(record("user-1"), timeout, interval).Should(Equal([]any{"Stopped", 2, 0}))
+	})
+})
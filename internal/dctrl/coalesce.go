@@ -0,0 +1,187 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/pipeline"
+)
+
+// defaultTableCoalesceWindow is the default batching window of the aggregate table writes.
+const defaultTableCoalesceWindow = 20 * time.Millisecond
+
+// tableCoalescer batches the writes of the aggregate tables. The tables are built by the "@gather"
+// pipelines of the declarative operators, which emit the whole table on each change of a source
+// object. The first table of a window is passed on to the controller to write it as usual; the
+// tables emitted during the rest of the window replace each other and only the last one is
+// written, at the end of the window. So a burst of changes results in at most two writes per
+// window, and the last table emitted is always written.
+type tableCoalescer struct {
+	client  client.Client
+	window  time.Duration
+	mu      sync.Mutex
+	pending map[int]object.Delta // the tables to write, by index into aggregateTables
+	last    map[int]time.Time    // the time of the last write, by index into aggregateTables
+	kick    chan struct{}
+	writes  atomic.Uint64
+	// onFlush, if set, is called after each window with a write, e.g., to write the state through
+	// to the state store.
+	onFlush func(ctx context.Context)
+	log     logr.Logger
+}
+
+func newTableCoalescer(c client.Client, window time.Duration, logger logr.Logger) *tableCoalescer {
+	if window <= 0 {
+		window = defaultTableCoalesceWindow
+	}
+	return &tableCoalescer{
+		client:  c,
+		window:  window,
+		pending: map[int]object.Delta{},
+		last:    map[int]time.Time{},
+		kick:    make(chan struct{}, 1),
+		log:     logger.WithName("table-coalescer"),
+	}
+}
+
+// Writes returns the number of aggregate table writes so far.
+func (c *tableCoalescer) Writes() uint64 { return c.writes.Load() }
+
+// Start runs the flush loop until the context is cancelled.
+func (c *tableCoalescer) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.kick:
+		}
+
+		// let the changes accumulate for a window
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.window):
+		}
+
+		c.flush(ctx)
+	}
+}
+
+func (c *tableCoalescer) notify() {
+	select {
+	case c.kick <- struct{}{}:
+	default:
+	}
+}
+
+// coalesce takes the tables emitted by the pipeline of the i-th aggregate table and returns the
+// ones the controller is to write: the last table if no table was written in the window, none
+// otherwise.
+func (c *tableCoalescer) coalesce(i int, deltas []object.Delta) []object.Delta {
+	d := deltas[len(deltas)-1]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.notify()
+
+	if _, ok := c.pending[i]; !ok && time.Since(c.last[i]) >= c.window {
+		c.last[i] = time.Now()
+		c.writes.Add(1)
+		return []object.Delta{d}
+	}
+	c.pending[i] = d
+	return nil
+}
+
+// flush writes the pending tables. The lock is held during the writes so that a table passed on
+// to a controller cannot be overwritten by an older pending one.
+func (c *tableCoalescer) flush(ctx context.Context) {
+	c.mu.Lock()
+	for i, d := range c.pending {
+		t := aggregateTables[i]
+		if err := c.write(ctx, t, d); err != nil {
+			c.log.Error(err, "failed to write aggregate table", "operator", t.operator, "kind", t.kind)
+			// retry in the next round
+			c.notify()
+			continue
+		}
+		delete(c.pending, i)
+		c.last[i] = time.Now()
+		c.writes.Add(1)
+	}
+	c.mu.Unlock()
+
+	if c.onFlush != nil {
+		c.onFlush(ctx)
+	}
+}
+
+// write writes a table emitted by the pipeline of an aggregate table. On a resourceVersion
+// conflict the table is re-read and the write is redone.
+func (c *tableCoalescer) write(ctx context.Context, t aggregateTable, d object.Delta) error {
+	if d.Type == object.Deleted {
+		table := object.NewViewObject(t.operator, t.kind)
+		object.SetName(table, "", t.name)
+		if err := c.client.Delete(ctx, table); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s/%s: %w", t.operator, t.kind, err)
+		}
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject(t.operator, t.kind)
+		object.SetName(table, "", t.name)
+		exists := true
+		if err := c.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get %s/%s: %w", t.operator, t.kind, err)
+			}
+			exists = false
+		}
+		table.UnstructuredContent()["spec"] = d.Object.UnstructuredContent()["spec"]
+		if exists {
+			if err := c.client.Update(ctx, table); err != nil {
+				return fmt.Errorf("failed to update %s/%s: %w", t.operator, t.kind, err)
+			}
+		} else if err := c.client.Create(ctx, table); err != nil {
+			return fmt.Errorf("failed to create %s/%s: %w", t.operator, t.kind, err)
+		}
+		return nil
+	})
+}
+
+// wrap returns the pipeline of the controller of an operator with the table writes coalesced if
+// the controller maintains an aggregate table, the pipeline as is otherwise.
+func (c *tableCoalescer) wrap(opName, controller string, p pipeline.Evaluator) pipeline.Evaluator {
+	for i, t := range aggregateTables {
+		if t.operator == opName && t.controller == controller {
+			return &coalescingPipeline{Evaluator: p, coalescer: c, table: i}
+		}
+	}
+	return p
+}
+
+// coalescingPipeline passes the tables emitted by the pipeline of an aggregate table to the
+// coalescer.
+type coalescingPipeline struct {
+	pipeline.Evaluator
+	coalescer *tableCoalescer
+	table     int
+}
+
+func (p *coalescingPipeline) Evaluate(delta object.Delta) ([]object.Delta, error) {
+	deltas, err := p.Evaluator.Evaluate(delta)
+	if err != nil || len(deltas) == 0 {
+		return deltas, err
+	}
+	return p.coalescer.coalesce(p.table, deltas), nil
+}
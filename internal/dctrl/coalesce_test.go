@@ -0,0 +1,166 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Aggregate table coalescer", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should not lose updates under concurrent changes", func() {
+		c := d.GetCache().GetClient()
+		const n = 20
+
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(i))).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+		Eventually(sessionNames(ctx, c), timeout, interval).Should(HaveLen(n + 1))
+
+		// delete the even sessions concurrently
+		for i := 0; i < n; i += 2 {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(c.Delete(ctx, newSessionContext(i))).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+
+		want := []string{"test-session"}
+		for i := 1; i < n; i += 2 {
+			want = append(want, fmt.Sprintf("user-%d", i))
+		}
+		Eventually(sessionNames(ctx, c), timeout, interval).Should(ConsistOf(want))
+		Expect(d.TableWrites()).To(BeNumerically("<", 2*n))
+	})
+})
+
+// BenchmarkTableCoalescer creates b.N session contexts in a burst and checks that the
+// active-session table is written fewer times than the number of sessions.
+func BenchmarkTableCoalescer(b *testing.B) {
+	// the testsuite helpers assert with Gomega
+	RegisterFailHandler(func(message string, _ ...int) { b.Error(message) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := d.GetCache().GetClient()
+
+	// wait until the table holds the test session
+	waitForSessions(ctx, b, c, 1)
+	base := d.TableWrites()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		obj := newSessionContext(i)
+		if err := testsuite.CreateWithRetry(ctx, c, obj); err != nil {
+			b.Fatal(err)
+		}
+	}
+	waitForSessions(ctx, b, c, b.N+1)
+	b.StopTimer()
+
+	writes := d.TableWrites() - base
+	b.ReportMetric(float64(writes)/float64(b.N), "writes/session")
+	if b.N > 1 && writes >= uint64(b.N) {
+		b.Fatalf("expected fewer than %d table writes, got %d", b.N, writes)
+	}
+}
+
+func waitForSessions(ctx context.Context, b *testing.B, c client.Client, n int) {
+	b.Helper()
+	Eventually(sessionNames(ctx, c), timeout+time.Duration(n)*interval, interval).Should(HaveLen(n))
+}
+
+// sessionNames returns a poller for the names in the active-session table.
+func sessionNames(ctx context.Context, c client.Client) func() []string {
+	return func() []string {
+		table := object.NewViewObject("smf", "ActiveSessionTable")
+		object.SetName(table, "", "active-sessions")
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return nil
+		}
+		specs, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		names := []string{}
+		for _, s := range specs {
+			if e, ok := s.(map[string]any); ok {
+				names = append(names, fmt.Sprint(e["name"]))
+			}
+		}
+		return names
+	}
+}
+
+func newSessionContext(i int) object.Object {
+	yamlData := fmt.Sprintf(`
+apiVersion: smf.view.dcontroller.io/v1alpha1
+kind: SessionContext
+metadata:
+  name: user-%[1]d
+  namespace: user-%[1]d
+spec:
+  guti: guti-%[1]d
+  nssai: eMBB
+  sessionId: 1
+  pduSessionType: IPv4
+  sscMode: SSC1
+  networkConfiguration:
+    requests:
+      - type: IPConfiguration
+        addressFamily: IPv4
+  qos:
+    flows:
+      - name: best-effort-flow
+        fiveQI: BestEffort
+    rules: [1]
+status:
+  conditions:
+    validated:
+      status: "True"`, i)
+	obj := object.New()
+	Expect(yaml.Unmarshal([]byte(yamlData), &obj)).To(Succeed())
+	return obj
+}
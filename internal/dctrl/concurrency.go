@@ -0,0 +1,89 @@
+package dctrl
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// concurrencyLimiter is the client of the API server that caps the number of the mutating
+// requests in flight. A request over the limit is shed with 503 Service Unavailable and a
+// Retry-After header instead of being queued, so that a burst of creates cannot pile up behind
+// the admission checks and the cache, whatever the concurrency of the controllers. Reads pass
+// through.
+type concurrencyLimiter struct {
+	client.Client
+	slots chan struct{}
+	shed  atomic.Uint64
+}
+
+func newConcurrencyLimiter(c client.Client, limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{Client: c, slots: make(chan struct{}, limit)}
+}
+
+// acquire takes a slot, or returns an error if all the slots are taken.
+func (l *concurrencyLimiter) acquire() error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	l.shed.Add(1)
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusServiceUnavailable,
+		Reason:  metav1.StatusReasonServiceUnavailable,
+		Message: "too many concurrent requests, retry later",
+		Details: &metav1.StatusDetails{RetryAfterSeconds: 1},
+	}}
+}
+
+func (l *concurrencyLimiter) release() { <-l.slots }
+
+// Shed returns the number of the requests rejected so far.
+func (l *concurrencyLimiter) Shed() uint64 { return l.shed.Load() }
+
+func (l *concurrencyLimiter) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := l.acquire(); err != nil {
+		return err
+	}
+	defer l.release()
+	return l.Client.Create(ctx, obj, opts...)
+}
+
+func (l *concurrencyLimiter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := l.acquire(); err != nil {
+		return err
+	}
+	defer l.release()
+	return l.Client.Update(ctx, obj, opts...)
+}
+
+func (l *concurrencyLimiter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := l.acquire(); err != nil {
+		return err
+	}
+	defer l.release()
+	return l.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (l *concurrencyLimiter) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := l.acquire(); err != nil {
+		return err
+	}
+	defer l.release()
+	return l.Client.Delete(ctx, obj, opts...)
+}
+
+func (l *concurrencyLimiter) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := l.acquire(); err != nil {
+		return err
+	}
+	defer l.release()
+	return l.Client.DeleteAllOf(ctx, obj, opts...)
+}
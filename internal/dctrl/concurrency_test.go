@@ -0,0 +1,118 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// slowAdmission holds each registration in the admission check for a while, so that the
+// concurrent creates overlap.
+type slowAdmission time.Duration
+
+func (p slowAdmission) AdmitRegistration(map[string]any) error {
+	time.Sleep(time.Duration(p))
+	return nil
+}
+
+func (p slowAdmission) AdmitSession(map[string]any) error { return nil }
+
+var _ = Describe("Concurrency limit", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		port   int
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                opSpecs,
+			APIServerPort:          dctrl.EphemeralAPIServerPort,
+			MaxConcurrentMutations: 2,
+			AdmissionPolicy:        slowAdmission(300 * time.Millisecond),
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port = d.APIServerPort()
+		Eventually(d.Ready, timeout, interval).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// create posts a registration and returns the status code
+	create := func(name string) int {
+		body := fmt.Sprintf(`{
+  "apiVersion": "amf.view.dcontroller.io/v1alpha1",
+  "kind": "Registration",
+  "metadata": {"name": %[1]q, "namespace": %[1]q},
+  "spec": {
+    "registrationType": "initial",
+    "mobileIdentity": {"type": "SUCI", "value": "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"},
+    "ueSecurityCapability": {"encryptionAlgorithms": ["5G-EA0", "5G-EA2"], "integrityAlgorithms": ["5G-IA0", "5G-IA2"]},
+    "requestedNSSAI": [{"sliceType": "eMBB"}]
+  }
+}`, name)
+		url := fmt.Sprintf("http://localhost:%d/apis/amf.view.dcontroller.io/v1alpha1/namespaces/%s/registration",
+			port, name)
+		res, err := http.Post(url, "application/json", strings.NewReader(body)) //nolint:noctx
+		if err != nil {
+			return 0
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode == http.StatusServiceUnavailable {
+			Expect(res.Header.Get("Retry-After")).To(Equal("1"))
+		}
+		return res.StatusCode
+	}
+
+	It("should shed the excess of a flood of creates", func() {
+		const n = 10
+		codes := make(chan int, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				codes <- create(fmt.Sprintf("flood-%d", i))
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		created, shed := 0, 0
+		for code := range codes {
+			switch code {
+			case http.StatusCreated:
+				created++
+			case http.StatusServiceUnavailable:
+				shed++
+			default:
+				Fail(fmt.Sprintf("unexpected status code %d", code))
+			}
+		}
+		Expect(created).To(BeNumerically(">=", 1))
+		Expect(shed).To(BeNumerically(">=", 1))
+		Expect(d.ShedRequests()).To(Equal(uint64(shed)))
+	})
+
+	It("should let steady traffic through", func() {
+		for i := 0; i < 5; i++ {
+			Expect(create(fmt.Sprintf("steady-%d", i))).To(Equal(http.StatusCreated))
+		}
+		Expect(d.ShedRequests()).To(BeZero())
+	})
+})
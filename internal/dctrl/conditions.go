@@ -0,0 +1,94 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/correlation"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// observedKinds are the user-facing resources whose condition transitions are counted.
+var observedKinds = map[string][]string{
+	"amf": {"Registration", "Session", "ContextRelease"},
+}
+
+// conditionObserver counts the condition transitions of the user-facing resources in the
+// dctrl5g_condition_transitions_total metric and logs the old and the new state of each
+// condition that flips.
+type conditionObserver struct {
+	operator, kind string
+	mu             sync.Mutex
+	last           map[client.ObjectKey]map[string][2]string // condition type -> status, reason
+	log            logr.Logger
+}
+
+func newConditionObserver(opName, kind string, logger logr.Logger) *conditionObserver {
+	return &conditionObserver{
+		operator: opName,
+		kind:     kind,
+		last:     map[client.ObjectKey]map[string][2]string{},
+		log:      logger.WithName("condition-observer"),
+	}
+}
+
+// addConditionObservers adds the condition observers to the operator.
+func addConditionObservers(opName string, op *trackedOperator, logger logr.Logger) error {
+	for _, kind := range observedKinds[opName] {
+		r := newConditionObserver(opName, kind, logger)
+		name := fmt.Sprintf("%s-condition-observer", kind)
+		if err := addWatchController(op, opName, name, kind, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *conditionObserver) Reconcile(_ context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.EventType == object.Deleted {
+		delete(r.last, key)
+		return reconcile.Result{}, nil
+	}
+
+	current := map[string][2]string{}
+	conds, _, _ := unstructured.NestedSlice(req.Object.UnstructuredContent(), "status", "conditions")
+	for _, c := range conds {
+		cond, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		t, _ := cond["type"].(string)
+		status, _ := cond["status"].(string)
+		reason, _ := cond["reason"].(string)
+		if t == "" {
+			continue
+		}
+		current[t] = [2]string{status, reason}
+		prev, ok := r.last[key][t]
+		if ok && prev != current[t] {
+			correlation.Logger(r.log, req.Object).V(1).Info("condition changed", "operator", r.operator, "kind", r.kind,
+				"object", key.String(), "type", t, "oldStatus", prev[0], "oldReason", prev[1],
+				"newStatus", status, "newReason", reason)
+		}
+		if !ok || prev != current[t] {
+			metrics.RecordTransition(r.operator, t, status, reason)
+		}
+	}
+	r.last[key] = current
+
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,58 @@
+package dctrl_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr/funcr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+)
+
+var _ = Describe("Condition change logs", func() {
+	It("should log the old and the new state of a flipped condition", func() {
+		lines := []string{}
+		logger := funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+		}, funcr.Options{Verbosity: 1})
+		r := dctrl.NewConditionObserver("amf", "Session", logger)
+
+		sess := object.NewViewObject("amf", "Session")
+		object.SetName(sess, "user-1", "user-1")
+		setReady := func(status, reason string) {
+			Expect(unstructured.SetNestedSlice(sess.UnstructuredContent(), []any{
+				map[string]any{"type": "Ready", "status": status, "reason": reason},
+			}, "status", "conditions")).To(Succeed())
+			_, err := r.Reconcile(context.Background(), reconciler.Request{
+				Object:    object.DeepCopy(sess),
+				EventType: object.Updated,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		setReady("False", "SessionFailed")
+		Expect(lines).To(BeEmpty())
+
+		// unchanged
+		setReady("False", "SessionFailed")
+		Expect(lines).To(BeEmpty())
+
+		setReady("True", "SessionSuccessful")
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(And(
+			ContainSubstring(`"msg"="condition changed"`),
+			ContainSubstring(`"object"="user-1/user-1"`),
+			ContainSubstring(`"type"="Ready"`),
+			ContainSubstring(`"oldStatus"="False"`),
+			ContainSubstring(`"oldReason"="SessionFailed"`),
+			ContainSubstring(`"newStatus"="True"`),
+			ContainSubstring(`"newReason"="SessionSuccessful"`),
+		))
+	})
+})
@@ -0,0 +1,388 @@
+package dctrl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+)
+
+// Config is the serializable form of the options, as read by LoadConfig and printed by the
+// "config dump" command. The durations are in the time.Duration syntax, e.g., 1m30s, and the UDM
+// config selector in the label selector syntax, e.g., shard=0.
+type Config struct {
+	OpSpecs                     []OpSpec `json:"opSpecs"`
+	MaxOperators                int      `json:"maxOperators,omitempty"`
+	StrictSchemaCheck           bool     `json:"strictSchemaCheck,omitempty"`
+	ValidateOpSpecs             bool     `json:"validateOpSpecs,omitempty"`
+	APIServerAddr               string   `json:"apiServerAddr"`
+	APIServerPort               int      `json:"apiServerPort"`
+	APIPathPrefix               string   `json:"apiPathPrefix,omitempty"`
+	DisableAuth                 bool     `json:"disableAuth"`
+	HTTPMode                    bool     `json:"httpMode"`
+	HTTPAuth                    bool     `json:"httpAuth"`
+	Insecure                    bool     `json:"insecure"`
+	CertFile                    string   `json:"certFile"`
+	KeyFile                     string   `json:"keyFile"`
+	ObservedGeneration          bool     `json:"observedGeneration"`
+	TokenSelfTestInterval       string   `json:"tokenSelfTestInterval"`
+	TokenAuditRetention         string   `json:"tokenAuditRetention"`
+	UETokenTTL                  string   `json:"ueTokenTTL"`
+	MaxUETokenTTL               string   `json:"maxUETokenTTL"`
+	UETokenPoolSize             int      `json:"ueTokenPoolSize,omitempty"`
+	UDMConfigSelector           string   `json:"udmConfigSelector,omitempty"`
+	TableResyncInterval         string   `json:"tableResyncInterval"`
+	TableCoalesceWindow         string   `json:"tableCoalesceWindow"`
+	ConfigGCInterval            string   `json:"configGCInterval"`
+	MetricsLogInterval          string   `json:"metricsLogInterval"`
+	RegistrationTimeout         string   `json:"registrationTimeout"`
+	RegistrationExpiry          string   `json:"registrationExpiry"`
+	RegistrationDedupWindow     string   `json:"registrationDedupWindow"`
+	SessionRegistrationWait     string   `json:"sessionRegistrationWait"`
+	RegistrationEventBufferSize int      `json:"registrationEventBufferSize,omitempty"`
+	MaxRequestedNSSAI           int      `json:"maxRequestedNSSAI,omitempty"`
+	CounterView                 bool     `json:"counterView,omitempty"`
+	LogCorrelation              bool     `json:"logCorrelation,omitempty"`
+	SessionIPPool               string   `json:"sessionIPPool,omitempty"`
+	SessionIPv6Pool             string   `json:"sessionIPv6Pool,omitempty"`
+	UPFTunnelAddresses          []string `json:"upfTunnelAddresses,omitempty"`
+	SessionInactivityTimer      string   `json:"sessionInactivityTimer"`
+	UsageAccountingInterval     string   `json:"usageAccountingInterval"`
+	StateFile                   string   `json:"stateFile,omitempty"`
+	MaxConcurrentMutations      int      `json:"maxConcurrentMutations,omitempty"`
+	StateSnapshotInterval       string   `json:"stateSnapshotInterval"`
+	GutiCollisionPolicy         string   `json:"gutiCollisionPolicy,omitempty"`
+	DuplicateSupiPolicy         string   `json:"duplicateSupiPolicy,omitempty"`
+	SubscribedAmbrPolicy        string   `json:"subscribedAmbrPolicy,omitempty"`
+	FatalErrorPolicy            string   `json:"fatalErrorPolicy,omitempty"`
+	FailureMode                 string   `json:"failureMode,omitempty"`
+	ConfigRecreatePolicy        string   `json:"configRecreatePolicy,omitempty"`
+	UnknownFieldPolicy          string   `json:"unknownFieldPolicy,omitempty"`
+	DependencyTimeout           string   `json:"dependencyTimeout"`
+	ReadinessGates              []string `json:"readinessGates,omitempty"`
+	UPFConfigFormat             string   `json:"upfConfigFormat"`
+	ServiceAddr                 string   `json:"serviceAddr"`
+	ServicePathPrefix           string   `json:"servicePathPrefix,omitempty"`
+	ManagerMetrics              bool     `json:"managerMetrics"`
+	HealthProbeAddr             string   `json:"healthProbeAddr"`
+	JWKSCertFiles               []string `json:"jwksCertFiles,omitempty"`
+	MinClientKeyBits            int      `json:"minClientKeyBits,omitempty"`
+	RevocationListFile          string   `json:"revocationListFile,omitempty"`
+	HomeNetworkKeyFile          string   `json:"homeNetworkKeyFile,omitempty"`
+	SubscriberKeyStoreFile      string   `json:"subscriberKeyStoreFile,omitempty"`
+	SubscriberProvisioning      bool     `json:"subscriberProvisioning,omitempty"`
+}
+
+// requiredConfigKeys lists the keys that must be present in a config file, per mapping type.
+var requiredConfigKeys = map[reflect.Type][]string{
+	reflect.TypeOf(Config{}): {"opSpecs"},
+	reflect.TypeOf(OpSpec{}): {"name", "file"},
+}
+
+// NewConfig returns the serializable form of the options. The options with no serializable form,
+// e.g., the logger, are omitted.
+func NewConfig(opts Options) Config {
+	selector := ""
+	if opts.UDMConfigSelector != nil {
+		selector = metav1.FormatLabelSelector(opts.UDMConfigSelector)
+	}
+	return Config{
+		OpSpecs:                     opts.OpSpecs,
+		MaxOperators:                opts.MaxOperators,
+		StrictSchemaCheck:           opts.StrictSchemaCheck,
+		ValidateOpSpecs:             opts.ValidateOpSpecs,
+		APIServerAddr:               opts.APIServerAddr,
+		APIServerPort:               opts.APIServerPort,
+		APIPathPrefix:               opts.APIPathPrefix,
+		DisableAuth:                 opts.DisableAuth,
+		HTTPMode:                    opts.HTTPMode,
+		HTTPAuth:                    opts.HTTPAuth,
+		Insecure:                    opts.Insecure,
+		CertFile:                    opts.CertFile,
+		KeyFile:                     opts.KeyFile,
+		ObservedGeneration:          opts.ObservedGeneration,
+		TokenSelfTestInterval:       opts.TokenSelfTestInterval.String(),
+		TokenAuditRetention:         opts.TokenAuditRetention.String(),
+		UETokenTTL:                  opts.UETokenTTL.String(),
+		MaxUETokenTTL:               opts.MaxUETokenTTL.String(),
+		UETokenPoolSize:             opts.UETokenPoolSize,
+		UDMConfigSelector:           selector,
+		TableResyncInterval:         opts.TableResyncInterval.String(),
+		TableCoalesceWindow:         opts.TableCoalesceWindow.String(),
+		ConfigGCInterval:            opts.ConfigGCInterval.String(),
+		MetricsLogInterval:          opts.MetricsLogInterval.String(),
+		RegistrationTimeout:         opts.RegistrationTimeout.String(),
+		RegistrationExpiry:          opts.RegistrationExpiry.String(),
+		RegistrationDedupWindow:     opts.RegistrationDedupWindow.String(),
+		SessionRegistrationWait:     opts.SessionRegistrationWait.String(),
+		RegistrationEventBufferSize: opts.RegistrationEventBufferSize,
+		MaxRequestedNSSAI:           opts.MaxRequestedNSSAI,
+		CounterView:                 opts.CounterView,
+		LogCorrelation:              opts.LogCorrelation,
+		SessionIPPool:               opts.SessionIPPool,
+		SessionIPv6Pool:             opts.SessionIPv6Pool,
+		UPFTunnelAddresses:          opts.UPFTunnelAddresses,
+		SessionInactivityTimer:      opts.SessionInactivityTimer.String(),
+		UsageAccountingInterval:     opts.UsageAccountingInterval.String(),
+		StateFile:                   opts.StateFile,
+		MaxConcurrentMutations:      opts.MaxConcurrentMutations,
+		StateSnapshotInterval:       opts.StateSnapshotInterval.String(),
+		GutiCollisionPolicy:         string(opts.GutiCollisionPolicy),
+		DuplicateSupiPolicy:         string(opts.DuplicateSupiPolicy),
+		SubscribedAmbrPolicy:        string(opts.SubscribedAmbrPolicy),
+		FatalErrorPolicy:            string(opts.FatalErrorPolicy),
+		FailureMode:                 string(opts.FailureMode),
+		ConfigRecreatePolicy:        string(opts.ConfigRecreatePolicy),
+		UnknownFieldPolicy:          string(opts.UnknownFieldPolicy),
+		DependencyTimeout:           opts.DependencyTimeout.String(),
+		ReadinessGates:              opts.ReadinessGates,
+		UPFConfigFormat:             opts.UPFConfigFormat,
+		ServiceAddr:                 opts.ServiceAddr,
+		ServicePathPrefix:           opts.ServicePathPrefix,
+		ManagerMetrics:              opts.ManagerMetrics,
+		HealthProbeAddr:             opts.HealthProbeAddr,
+		JWKSCertFiles:               opts.JWKSCertFiles,
+		MinClientKeyBits:            opts.MinClientKeyBits,
+		RevocationListFile:          opts.RevocationListFile,
+		HomeNetworkKeyFile:          opts.HomeNetworkKeyFile,
+		SubscriberKeyStoreFile:      opts.SubscriberKeyStoreFile,
+		SubscriberProvisioning:      opts.SubscriberProvisioning,
+	}
+}
+
+// configKeyError is an invalid value of a top-level config key.
+type configKeyError struct {
+	key string
+	err error
+}
+
+func (e *configKeyError) Error() string { return fmt.Sprintf("invalid %s: %v", e.key, e.err) }
+
+// Options converts the config to options. An empty duration is the zero duration.
+func (c Config) Options() (Options, error) {
+	opts := Options{
+		OpSpecs:                     c.OpSpecs,
+		MaxOperators:                c.MaxOperators,
+		StrictSchemaCheck:           c.StrictSchemaCheck,
+		ValidateOpSpecs:             c.ValidateOpSpecs,
+		APIServerAddr:               c.APIServerAddr,
+		APIServerPort:               c.APIServerPort,
+		APIPathPrefix:               c.APIPathPrefix,
+		DisableAuth:                 c.DisableAuth,
+		HTTPMode:                    c.HTTPMode,
+		HTTPAuth:                    c.HTTPAuth,
+		Insecure:                    c.Insecure,
+		CertFile:                    c.CertFile,
+		KeyFile:                     c.KeyFile,
+		ObservedGeneration:          c.ObservedGeneration,
+		UETokenPoolSize:             c.UETokenPoolSize,
+		RegistrationEventBufferSize: c.RegistrationEventBufferSize,
+		MaxRequestedNSSAI:           c.MaxRequestedNSSAI,
+		CounterView:                 c.CounterView,
+		LogCorrelation:              c.LogCorrelation,
+		SessionIPPool:               c.SessionIPPool,
+		SessionIPv6Pool:             c.SessionIPv6Pool,
+		UPFTunnelAddresses:          c.UPFTunnelAddresses,
+		StateFile:                   c.StateFile,
+		MaxConcurrentMutations:      c.MaxConcurrentMutations,
+		GutiCollisionPolicy:         GutiCollisionPolicy(c.GutiCollisionPolicy),
+		DuplicateSupiPolicy:         DuplicateSupiPolicy(c.DuplicateSupiPolicy),
+		SubscribedAmbrPolicy:        udm.AmbrPolicy(c.SubscribedAmbrPolicy),
+		FatalErrorPolicy:            FatalErrorPolicy(c.FatalErrorPolicy),
+		FailureMode:                 FailureMode(c.FailureMode),
+		ConfigRecreatePolicy:        ConfigRecreatePolicy(c.ConfigRecreatePolicy),
+		UnknownFieldPolicy:          UnknownFieldPolicy(c.UnknownFieldPolicy),
+		ReadinessGates:              c.ReadinessGates,
+		UPFConfigFormat:             c.UPFConfigFormat,
+		ServiceAddr:                 c.ServiceAddr,
+		ServicePathPrefix:           c.ServicePathPrefix,
+		ManagerMetrics:              c.ManagerMetrics,
+		HealthProbeAddr:             c.HealthProbeAddr,
+		JWKSCertFiles:               c.JWKSCertFiles,
+		MinClientKeyBits:            c.MinClientKeyBits,
+		RevocationListFile:          c.RevocationListFile,
+		HomeNetworkKeyFile:          c.HomeNetworkKeyFile,
+		SubscriberKeyStoreFile:      c.SubscriberKeyStoreFile,
+		SubscriberProvisioning:      c.SubscriberProvisioning,
+	}
+
+	durations := []struct {
+		key   string
+		value string
+		dst   *time.Duration
+	}{
+		{"tokenSelfTestInterval", c.TokenSelfTestInterval, &opts.TokenSelfTestInterval},
+		{"tokenAuditRetention", c.TokenAuditRetention, &opts.TokenAuditRetention},
+		{"ueTokenTTL", c.UETokenTTL, &opts.UETokenTTL},
+		{"maxUETokenTTL", c.MaxUETokenTTL, &opts.MaxUETokenTTL},
+		{"tableResyncInterval", c.TableResyncInterval, &opts.TableResyncInterval},
+		{"tableCoalesceWindow", c.TableCoalesceWindow, &opts.TableCoalesceWindow},
+		{"configGCInterval", c.ConfigGCInterval, &opts.ConfigGCInterval},
+		{"metricsLogInterval", c.MetricsLogInterval, &opts.MetricsLogInterval},
+		{"registrationTimeout", c.RegistrationTimeout, &opts.RegistrationTimeout},
+		{"registrationExpiry", c.RegistrationExpiry, &opts.RegistrationExpiry},
+		{"registrationDedupWindow", c.RegistrationDedupWindow, &opts.RegistrationDedupWindow},
+		{"sessionRegistrationWait", c.SessionRegistrationWait, &opts.SessionRegistrationWait},
+		{"sessionInactivityTimer", c.SessionInactivityTimer, &opts.SessionInactivityTimer},
+		{"usageAccountingInterval", c.UsageAccountingInterval, &opts.UsageAccountingInterval},
+		{"stateSnapshotInterval", c.StateSnapshotInterval, &opts.StateSnapshotInterval},
+		{"dependencyTimeout", c.DependencyTimeout, &opts.DependencyTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return Options{}, &configKeyError{key: d.key, err: err}
+		}
+		*d.dst = v
+	}
+
+	if c.UDMConfigSelector != "" {
+		s, err := metav1.ParseToLabelSelector(c.UDMConfigSelector)
+		if err != nil {
+			return Options{}, &configKeyError{key: "udmConfigSelector", err: err}
+		}
+		opts.UDMConfigSelector = s
+	}
+
+	return opts, nil
+}
+
+// LoadConfig reads the options from a YAML config file, in the form printed by the "config dump"
+// command. The file must list the operators in opSpecs, each with a name and a file; the other
+// keys are optional and default as the options do. Unknown keys are rejected, and the errors point
+// at the line of the offending key or value, e.g., "dctrl5g.yaml:4: unknown key \"prot\"".
+func LoadConfig(path string) (Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return Options{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return Options{}, fmt.Errorf("%s: empty config", path)
+	}
+	doc := root.Content[0]
+
+	var c Config
+	if err := decodeConfigNode(doc, reflect.ValueOf(&c).Elem()); err != nil {
+		var lerr *configLineError
+		if errors.As(err, &lerr) {
+			return Options{}, fmt.Errorf("%s:%d: %s", path, lerr.line, lerr.msg)
+		}
+		return Options{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	opts, err := c.Options()
+	if err != nil {
+		var kerr *configKeyError
+		if errors.As(err, &kerr) {
+			for i := 0; i+1 < len(doc.Content); i += 2 {
+				if doc.Content[i].Value == kerr.key {
+					return Options{}, fmt.Errorf("%s:%d: %w", path, doc.Content[i+1].Line, err)
+				}
+			}
+		}
+		return Options{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return opts, nil
+}
+
+// configLineError is an error at a line of the config file.
+type configLineError struct {
+	line int
+	msg  string
+}
+
+func (e *configLineError) Error() string { return fmt.Sprintf("line %d: %s", e.line, e.msg) }
+
+func lineErrorf(node *yaml.Node, format string, args ...any) error {
+	return &configLineError{line: node.Line, msg: fmt.Sprintf(format, args...)}
+}
+
+// decodeConfigNode decodes a YAML mapping into a struct by the JSON names of the fields, rejecting
+// the unknown, the duplicate and the missing required keys.
+func decodeConfigNode(node *yaml.Node, v reflect.Value) error {
+	if node.Kind != yaml.MappingNode {
+		return lineErrorf(node, "expected a mapping")
+	}
+
+	t := v.Type()
+	fields := map[string]reflect.Value{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = v.Field(i)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, ok := fields[key.Value]
+		if !ok {
+			return lineErrorf(key, "unknown key %q", key.Value)
+		}
+		if seen[key.Value] {
+			return lineErrorf(key, "duplicate key %q", key.Value)
+		}
+		seen[key.Value] = true
+		if err := decodeConfigValue(value, field, key.Value); err != nil {
+			return err
+		}
+		empty := field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0)
+		if empty && isRequiredConfigKey(t, key.Value) {
+			return lineErrorf(value, "%s must not be empty", key.Value)
+		}
+	}
+
+	for _, k := range requiredConfigKeys[t] {
+		if !seen[k] {
+			return lineErrorf(node, "missing required key %q", k)
+		}
+	}
+	return nil
+}
+
+func decodeConfigValue(node *yaml.Node, v reflect.Value, key string) error {
+	switch {
+	case v.Kind() == reflect.Struct:
+		return decodeConfigNode(node, v)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		if node.Kind != yaml.SequenceNode {
+			return lineErrorf(node, "invalid %s: expected a list", key)
+		}
+		s := reflect.MakeSlice(v.Type(), len(node.Content), len(node.Content))
+		for i, n := range node.Content {
+			if err := decodeConfigNode(n, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+
+	if err := node.Decode(v.Addr().Interface()); err != nil {
+		return lineErrorf(node, "invalid %s: expected %s", key, v.Type())
+	}
+	return nil
+}
+
+func isRequiredConfigKey(t reflect.Type, key string) bool {
+	for _, k := range requiredConfigKeys[t] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
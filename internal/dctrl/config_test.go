@@ -0,0 +1,87 @@
+package dctrl_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+)
+
+var _ = Describe("Config file", func() {
+	writeConfig := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "dctrl5g.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("should load the options from a valid file", func() {
+		opts, err := dctrl.LoadConfig(writeConfig(`opSpecs:
+  - name: amf
+    file: ../operators/amf.yaml
+    dependsOn: [smf]
+  - name: smf
+    file: ../operators/smf.yaml
+apiServerAddr: 0.0.0.0
+apiServerPort: 9443
+httpMode: true
+registrationTimeout: 1m30s
+upfTunnelAddresses: [10.100.200.1, 10.100.200.2]
+udmConfigSelector: shard in (0, 1)
+subscribedAmbrPolicy: reject
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.OpSpecs).To(Equal([]dctrl.OpSpec{
+			{Name: "amf", File: "../operators/amf.yaml", DependsOn: []string{"smf"}},
+			{Name: "smf", File: "../operators/smf.yaml"},
+		}))
+		Expect(opts.APIServerAddr).To(Equal("0.0.0.0"))
+		Expect(opts.APIServerPort).To(Equal(9443))
+		Expect(opts.HTTPMode).To(BeTrue())
+		Expect(opts.RegistrationTimeout).To(Equal(90 * time.Second))
+		Expect(opts.UPFTunnelAddresses).To(Equal([]string{"10.100.200.1", "10.100.200.2"}))
+		Expect(opts.UDMConfigSelector.MatchExpressions).To(HaveLen(1))
+		Expect(opts.SubscribedAmbrPolicy).To(Equal(udm.AmbrReject))
+		// the missing keys are the zero options
+		Expect(opts.TokenSelfTestInterval).To(BeZero())
+		Expect(opts.ManagerMetrics).To(BeFalse())
+	})
+
+	It("should round-trip the serializable form of the options", func() {
+		opts := dctrl.Options{
+			OpSpecs:             []dctrl.OpSpec{{Name: "pcf", File: "../operators/pcf.yaml"}},
+			APIServerPort:       9443,
+			DependencyTimeout:   time.Minute,
+			ReadinessGates:      []string{"cacheSynced"},
+			GutiCollisionPolicy: dctrl.GutiCollisionRehash,
+		}
+		data, err := yaml.Marshal(dctrl.NewConfig(opts))
+		Expect(err).NotTo(HaveOccurred())
+		loaded, err := dctrl.LoadConfig(writeConfig(string(data)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(opts))
+	})
+
+	It("should point at the offending line of a malformed file", func() {
+		for content, msg := range map[string]string{
+			"opSpecs:\n  - name: amf\n    file: amf.yaml\nprot: 8443\n":           `:4: unknown key "prot"`,
+			"opSpecs:\n  - name: amf\n    flie: amf.yaml\n":                       `:3: unknown key "flie"`,
+			"opSpecs:\n  - name: amf\n":                                           `:2: missing required key "file"`,
+			"apiServerPort: 8443\n":                                               `:1: missing required key "opSpecs"`,
+			"opSpecs: []\n":                                                       `:1: opSpecs must not be empty`,
+			"opSpecs:\n  - name: amf\n    file: amf.yaml\napiServerPort: https\n": `:4: invalid apiServerPort: expected int`,
+			"opSpecs:\n  - name: amf\n    file: amf.yaml\nueTokenTTL: 1 hour\n":   `:4: invalid ueTokenTTL`,
+			"opSpecs:\n\t- name: amf\n":                                           `line 2`,
+		} {
+			path := writeConfig(content)
+			_, err := dctrl.LoadConfig(path)
+			Expect(err).To(MatchError(And(ContainSubstring(path), ContainSubstring(msg))), content)
+		}
+	})
+})
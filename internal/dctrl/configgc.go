@@ -0,0 +1,118 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/operators/upf"
+)
+
+// configCollector periodically garbage-collects the upf/Config objects with no owning session in
+// the smf/ActiveSessionTable, e.g., a config left behind by a session context deleted while the
+// SMF was down. The owner of a config is the session named in its spec.session, as set on the
+// configs moved by a handover, or else the session of the same name, in the same namespace. A
+// config is collected only if it is found orphaned on two consecutive scans, so that the configs
+// of the sessions not yet in the coalesced table are kept.
+type configCollector struct {
+	client    client.Client
+	interval  time.Duration
+	orphans   map[client.ObjectKey]bool // the orphans found on the last scan
+	collected atomic.Uint64
+	log       logr.Logger
+}
+
+func newConfigCollector(c client.Client, interval time.Duration, logger logr.Logger) *configCollector {
+	return &configCollector{
+		client:   c,
+		interval: interval,
+		orphans:  map[client.ObjectKey]bool{},
+		log:      logger.WithName("config-gc"),
+	}
+}
+
+// Start runs the collection loop until the context is cancelled.
+func (g *configCollector) Start(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.collect(ctx); err != nil {
+				g.log.Error(err, "failed to collect the orphaned UPF configs")
+			}
+		}
+	}
+}
+
+// CollectedConfigs returns the number of orphaned configs collected so far.
+func (g *configCollector) CollectedConfigs() uint64 { return g.collected.Load() }
+
+func (g *configCollector) collect(ctx context.Context) error {
+	table := object.NewViewObject("smf", "ActiveSessionTable")
+	object.SetName(table, "", "active-sessions")
+	if err := g.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		if apierrors.IsNotFound(err) {
+			// no sessions to tell the orphans by yet
+			return nil
+		}
+		return fmt.Errorf("failed to get smf/ActiveSessionTable: %w", err)
+	}
+
+	sessions := map[client.ObjectKey]bool{}
+	entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+	for _, e := range entries {
+		if m, ok := e.(map[string]any); ok {
+			sessions[client.ObjectKey{Namespace: fmt.Sprint(m["namespace"]), Name: fmt.Sprint(m["name"])}] = true
+		}
+	}
+
+	list := cache.NewViewObjectList(upf.OperatorName, "Config")
+	if err := g.client.List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list upf/Config: %w", err)
+	}
+
+	orphans := map[client.ObjectKey]bool{}
+	for i := range list.Items {
+		cfg := &list.Items[i]
+		key := client.ObjectKeyFromObject(cfg)
+		owner := key
+		if s, ok, _ := unstructured.NestedString(cfg.UnstructuredContent(), "spec", "session"); ok && s != "" {
+			owner.Name = s
+		}
+		if sessions[owner] {
+			continue
+		}
+		if !g.orphans[key] {
+			orphans[key] = true
+			continue
+		}
+
+		if err := g.client.Delete(ctx, cfg); client.IgnoreNotFound(err) != nil {
+			// retried on the next scan
+			orphans[key] = true
+			g.log.Error(err, "failed to delete orphaned config", "config", key.String())
+			continue
+		}
+		g.log.Info("collected orphaned config", "config", key.String(), "session", owner.String(),
+			"upf", configUPF(cfg))
+		g.collected.Add(1)
+		metrics.OrphanedConfigsCollected.Inc()
+	}
+	g.orphans = orphans
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package dctrl_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("UPF config garbage collection", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:          opSpecs,
+			ConfigGCInterval: 100 * time.Millisecond,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should collect a config with no owning session", func() {
+		// the config of the test session
+		live := object.NewViewObject("upf", "Config")
+		object.SetName(live, "test-session", "test-session")
+		Eventually(func() error {
+			return c.Get(ctx, client.ObjectKeyFromObject(live), live)
+		}, timeout, interval).Should(Succeed())
+
+		collected := testutil.ToFloat64(metrics.OrphanedConfigsCollected)
+
+		yamlData := `
+apiVersion: upf.view.dcontroller.io/v1alpha1
+kind: Config
+metadata:
+  name: orphan
+  namespace: orphan
+spec:
+  networkConfiguration:
+    ipConfiguration:
+      ipAddress: 10.45.0.99`
+		orphan := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &orphan)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, orphan)).To(Succeed())
+
+		Eventually(func() bool {
+			obj := object.NewViewObject("upf", "Config")
+			object.SetName(obj, "orphan", "orphan")
+			return c.Get(ctx, client.ObjectKeyFromObject(obj), obj) != nil
+		}, timeout, interval).Should(BeTrue())
+
+		Expect(d.CollectedConfigs()).To(BeNumerically(">=", 1))
+		Expect(testutil.ToFloat64(metrics.OrphanedConfigsCollected)).To(BeNumerically(">", collected))
+
+		// the config of the live session is kept
+		Consistently(func() error {
+			return c.Get(ctx, client.ObjectKeyFromObject(live), live)
+		}, 500*time.Millisecond, interval).Should(Succeed())
+	})
+})
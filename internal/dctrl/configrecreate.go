@@ -0,0 +1,117 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+)
+
+// ConfigRecreatePolicy is the way a UDM config deleted while the registration of the UE is active
+// is handled.
+type ConfigRecreatePolicy string
+
+const (
+	// ConfigRecreateIgnore leaves the config deleted (default).
+	ConfigRecreateIgnore ConfigRecreatePolicy = "ignore"
+	// ConfigRecreateRecreate recreates the config, which makes the UDM issue a new token.
+	ConfigRecreateRecreate ConfigRecreatePolicy = "recreate"
+)
+
+// configRecreator recreates the UDM configs deleted out-of-band while the registration of the UE
+// is active, i.e., Ready, so that the UE does not silently lose its credentials. The configs of
+// the registrations being deleted are left alone.
+type configRecreator struct {
+	client client.Client
+	log    logr.Logger
+}
+
+func checkConfigRecreatePolicy(p ConfigRecreatePolicy) error {
+	switch p {
+	case "", ConfigRecreateIgnore, ConfigRecreateRecreate:
+		return nil
+	default:
+		return fmt.Errorf("unknown config recreate policy %q", p)
+	}
+}
+
+// addConfigRecreator adds the config recreator to the UDM operator, unless the policy leaves the
+// deleted configs alone.
+func addConfigRecreator(op *trackedOperator, c client.Client, policy ConfigRecreatePolicy, logger logr.Logger) error {
+	if policy != ConfigRecreateRecreate {
+		return nil
+	}
+	r := &configRecreator{client: c, log: logger.WithName("config-recreator")}
+	return addWatchController(op, udm.OperatorName, "config-recreator", "Config", r)
+}
+
+func (r *configRecreator) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType != object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	guti, namespace := req.Object.GetName(), req.Object.GetNamespace()
+	reg, err := r.activeRegistration(ctx, namespace, guti)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if reg == nil {
+		return reconcile.Result{}, nil
+	}
+
+	config := object.NewViewObject(udm.OperatorName, "Config")
+	object.SetName(config, namespace, guti)
+	config.SetAnnotations(req.Object.GetAnnotations())
+	if err := r.client.Create(ctx, config); err != nil && !apierrors.IsAlreadyExists(err) {
+		return reconcile.Result{}, fmt.Errorf("failed to recreate config %s/%s: %w", namespace, guti, err)
+	}
+
+	r.log.Info("recreated deleted config of an active registration", "config",
+		client.ObjectKeyFromObject(config).String(), "registration", client.ObjectKeyFromObject(reg).String())
+
+	return reconcile.Result{}, nil
+}
+
+// activeRegistration returns the Ready registration of a GUTI that is not being deleted, or nil
+// if there is none.
+func (r *configRecreator) activeRegistration(ctx context.Context, namespace, guti string) (object.Object, error) {
+	list := cache.NewViewObjectList("amf", "Registration")
+	if err := r.client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list registrations: %w", err)
+	}
+
+	for i := range list.Items {
+		reg := &list.Items[i]
+		if reg.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if g, _, _ := unstructured.NestedString(reg.UnstructuredContent(), "status", "guti"); g != guti {
+			continue
+		}
+		if isReady(reg) {
+			return reg, nil
+		}
+	}
+	return nil, nil
+}
+
+// isReady returns true if the registration is Ready.
+func isReady(reg object.Object) bool {
+	conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+	for _, c := range conds {
+		if cond, ok := c.(map[string]any); ok && cond["type"] == "Ready" {
+			return cond["status"] == "True"
+		}
+	}
+	return false
+}
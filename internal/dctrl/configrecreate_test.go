@@ -0,0 +1,102 @@
+package dctrl_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("UDM config recreation", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:              opSpecs,
+			ConfigRecreatePolicy: dctrl.ConfigRecreateRecreate,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should recreate the config of an active registration deleted out-of-band", func() {
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+
+		var guti string
+		Eventually(func() bool {
+			obj := object.NewViewObject("amf", "Registration")
+			object.SetName(obj, "user-1", "user-1")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return false
+			}
+			guti, _, _ = unstructured.NestedString(obj.UnstructuredContent(), "status", "guti")
+			conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			for _, c := range conds {
+				if cond, ok := c.(map[string]any); ok && cond["type"] == "Ready" {
+					return cond["status"] == "True"
+				}
+			}
+			return false
+		}, timeout, interval).Should(BeTrue())
+		Expect(guti).NotTo(BeEmpty())
+
+		token := func() string {
+			config := object.NewViewObject("udm", "Config")
+			object.SetName(config, "user-1", guti)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(config), config); err != nil {
+				return ""
+			}
+			users, _, _ := unstructured.NestedSlice(config.UnstructuredContent(), "status", "config", "users")
+			if len(users) == 0 {
+				return ""
+			}
+			t, _, _ := unstructured.NestedString(users[0].(map[string]any), "user", "token")
+			return t
+		}
+		Eventually(token, timeout, interval).ShouldNot(BeEmpty())
+
+		// delete the config out-of-band
+		config := object.NewViewObject("udm", "Config")
+		object.SetName(config, "user-1", guti)
+		Expect(c.Delete(ctx, config)).To(Succeed())
+
+		// the config is recreated and the UDM issues a token again
+		Eventually(token, timeout, interval).ShouldNot(BeEmpty())
+	})
+})
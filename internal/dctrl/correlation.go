@@ -0,0 +1,113 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/correlation"
+)
+
+// correlatedKinds are the views of the declarative operators carrying the annotations of the UE
+// request they are derived from, i.e., the correlation ID and the span context.
+var correlatedKinds = map[string][]string{
+	"amf":  {"Registration", "RegState", "Session"},
+	"ausf": {"MobileIdentity"},
+	"smf":  {"SessionContext"},
+	"upf":  {"Config"},
+}
+
+// correlationClient is the client of the API server that stamps the new Registrations and
+// Sessions with a correlation ID, unless the client has provided one.
+type correlationClient struct {
+	client.Client
+}
+
+func (c *correlationClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		gvk := u.GroupVersionKind()
+		if gvk.Group == "amf.view.dcontroller.io" && (gvk.Kind == "Registration" || gvk.Kind == "Session") &&
+			correlation.ID(u) == "" {
+			id, err := correlation.NewID()
+			if err != nil {
+				return err
+			}
+			annotations := u.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[correlation.Annotation] = id
+			u.SetAnnotations(annotations)
+		}
+	}
+
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// correlationOptions configures the log correlation of the UE requests.
+type correlationOptions struct {
+	// Enabled stamps the UE requests with a correlation ID and logs the views derived from them
+	Enabled bool
+	Logger  logr.Logger
+}
+
+// withCorrelation wraps the client of the API server with the client stamping the correlation
+// IDs. Returns the client as is if the log correlation is disabled.
+func withCorrelation(c client.Client, o correlationOptions) client.Client {
+	if !o.Enabled {
+		return c
+	}
+	return &correlationClient{Client: c}
+}
+
+// correlationHooks returns the hook adding the correlation loggers to each operator, none if the
+// log correlation is disabled.
+func correlationHooks(o correlationOptions) []operatorHook {
+	if !o.Enabled {
+		return nil
+	}
+	return []operatorHook{{
+		what: "create the correlation loggers",
+		add: func(op *trackedOperator, opName string) error {
+			return addCorrelationLoggers(opName, op, o.Logger)
+		},
+	}}
+}
+
+// correlationLogger logs the changes of the views of a declarative operator with the correlation
+// ID of the UE request they are derived from, so that a request can be traced across the
+// operator hops. The views without a correlation ID are not logged.
+type correlationLogger struct {
+	operator, kind string
+	log            logr.Logger
+}
+
+// addCorrelationLoggers adds the correlation loggers to the operator.
+func addCorrelationLoggers(opName string, op *trackedOperator, logger logr.Logger) error {
+	for _, kind := range correlatedKinds[opName] {
+		r := &correlationLogger{operator: opName, kind: kind, log: logger.WithName("correlation-logger")}
+		name := fmt.Sprintf("%s-correlation-logger", kind)
+		if err := addWatchController(op, opName, name, kind, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *correlationLogger) Reconcile(_ context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if correlation.ID(req.Object) == "" {
+		return reconcile.Result{}, nil
+	}
+
+	correlation.Logger(r.log, req.Object).V(1).Info("object changed", "operator", r.operator,
+		"kind", r.kind, "object", client.ObjectKeyFromObject(req.Object).String(),
+		"event", req.EventType, "generation", req.Object.GetGeneration())
+
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,127 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr/funcr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/correlation"
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Log correlation", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should log the correlation ID of a registration in the UDM", func() {
+		var mu sync.Mutex
+		lines := []string{}
+		logger := funcr.New(func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, prefix+" "+args)
+		}, funcr.Options{Verbosity: 1})
+
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:        opSpecs,
+			APIServerPort:  dctrl.EphemeralAPIServerPort,
+			HTTPMode:       true,
+			DisableAuth:    true,
+			KeyFile:        keyFile,
+			LogCorrelation: true,
+			Logger:         logger,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+		go func() {
+			defer GinkgoRecover()
+			Expect(d.Start(ctx)).To(Succeed())
+		}()
+
+		dc, err := dynamic.NewForConfig(&rest.Config{Host: fmt.Sprintf("http://localhost:%d", port)})
+		Expect(err).NotTo(HaveOccurred())
+		regs := dc.Resource(schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}).Namespace("user-1")
+
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg.Object)).To(Succeed())
+		Eventually(func() error {
+			_, err := regs.Create(ctx, reg.DeepCopy(), metav1.CreateOptions{})
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		// the registration is stamped on admission
+		created, err := regs.Get(ctx, "user-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		id := correlation.ID(created)
+		Expect(id).NotTo(BeEmpty())
+
+		logged := func(substr ...string) func() bool {
+			return func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, line := range lines {
+					found := strings.Contains(line, fmt.Sprintf(`"correlation-id"=%q`, id))
+					for _, s := range substr {
+						found = found && strings.Contains(line, s)
+					}
+					if found {
+						return true
+					}
+				}
+				return false
+			}
+		}
+
+		// the UDM logs the config of the registration with the same ID
+		Eventually(logged("udm-ctrl", "Add/update Config request object"), timeout, interval).Should(BeTrue())
+
+		// so does the logging middleware of the declarative operators on each hop
+		Eventually(logged(`"operator"="ausf"`, `"kind"="MobileIdentity"`), timeout, interval).Should(BeTrue())
+		Eventually(logged(`"operator"="amf"`, `"kind"="RegState"`), timeout, interval).Should(BeTrue())
+	})
+})
@@ -0,0 +1,214 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// Counts are the sizes of the aggregate tables.
+type Counts struct {
+	// Registrations is the number of the entries of the ActiveRegistrationTable.
+	Registrations int64 `json:"registrations"`
+	// Sessions is the number of the entries of the ActiveSessionTable.
+	Sessions int64 `json:"sessions"`
+	// IdleSessions is the number of the idle sessions in the ActiveSessionTable.
+	IdleSessions int64 `json:"idleSessions"`
+}
+
+// counterView maintains the sizes of the aggregate tables in the amf/Counters view, so that the
+// metrics and the count endpoints read a single small object instead of scanning the tables:
+//
+//	spec:
+//	  registrations: 2
+//	  sessions: 3
+//	  idleSessions: 1
+//
+// The counts are updated incrementally on each change of the per-UE objects the tables are built
+// from, using the same entry functions as the tables.
+type counterView struct {
+	client client.Client
+	mu     sync.Mutex
+	active map[[2]string]map[client.ObjectKey]bool // source -> object -> idle
+	counts Counts
+	dirty  bool // the counts have not been written yet
+	log    logr.Logger
+}
+
+// counterViewOptions configures the counter view.
+type counterViewOptions struct {
+	Client client.Client
+	// Enabled creates the counter view
+	Enabled bool
+	Logger  logr.Logger
+}
+
+// newCounterViewHooks creates the counter view and returns it with the hook adding the counters of
+// the aggregate tables of each operator. Returns nil if the view is not enabled.
+func newCounterViewHooks(o counterViewOptions) (*counterView, []operatorHook) {
+	if !o.Enabled {
+		return nil, nil
+	}
+	v := newCounterView(o.Client, o.Logger)
+	return v, []operatorHook{{
+		what: "create the counter view",
+		add:  func(op *trackedOperator, opName string) error { return v.addControllers(opName, op) },
+	}}
+}
+
+func newCounterView(c client.Client, logger logr.Logger) *counterView {
+	return &counterView{
+		client: c,
+		active: map[[2]string]map[client.ObjectKey]bool{},
+		log:    logger.WithName("counter-view"),
+	}
+}
+
+// addControllers adds a native controller to the operator that updates the counts on each change
+// of the source objects of the aggregate tables maintained by the operator.
+func (v *counterView) addControllers(opName string, op *trackedOperator) error {
+	for i, t := range aggregateTables {
+		if t.source[0] != opName {
+			continue
+		}
+		name := fmt.Sprintf("%s-counter", t.name)
+		if err := addWatchController(op, opName, name, t.source[1],
+			&counterNotifier{view: v, table: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the current counts.
+func (v *counterView) Get() Counts {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.counts
+}
+
+// GetCounts returns the sizes of the aggregate tables as maintained by the counter view. Returns
+// false if the counter view is disabled.
+func (d *Dctrl) GetCounts() (Counts, bool) {
+	if d.counters == nil {
+		return Counts{}, false
+	}
+	return d.counters.Get(), true
+}
+
+// update accounts for a change of a source object of the i-th aggregate table and writes the
+// view if the counts change.
+func (v *counterView) update(ctx context.Context, i int, req reconciler.Request) error {
+	t := aggregateTables[i]
+	key := client.ObjectKeyFromObject(req.Object)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	objs, ok := v.active[t.source]
+	if !ok {
+		objs = map[client.ObjectKey]bool{}
+		v.active[t.source] = objs
+	}
+	prevIdle, wasActive := objs[key]
+
+	var idle, isActive bool
+	if req.EventType != object.Deleted {
+		var e map[string]any
+		e, isActive = t.entry(req.Object)
+		idle, _ = e["idle"].(bool)
+	}
+	if isActive == wasActive && idle == prevIdle {
+		if v.dirty {
+			return v.write(ctx)
+		}
+		return nil
+	}
+
+	delta := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	var total, idles *int64
+	switch t.kind {
+	case "ActiveRegistrationTable":
+		total = &v.counts.Registrations
+	case "ActiveSessionTable":
+		total, idles = &v.counts.Sessions, &v.counts.IdleSessions
+	default:
+		return nil
+	}
+	*total += delta(isActive) - delta(wasActive)
+	if idles != nil {
+		*idles += delta(isActive && idle) - delta(wasActive && prevIdle)
+	}
+	if isActive {
+		objs[key] = idle
+	} else {
+		delete(objs, key)
+	}
+
+	v.dirty = true
+	v.log.V(2).Info("counts changed", "registrations", v.counts.Registrations,
+		"sessions", v.counts.Sessions, "idleSessions", v.counts.IdleSessions)
+	metrics.SetCounts(v.counts.Registrations, v.counts.Sessions, v.counts.IdleSessions)
+	return v.write(ctx)
+}
+
+// write creates or updates the amf/Counters view object, re-reading it on a resourceVersion
+// conflict. Called with the lock held; a failed write is retried on the next change or the requeue
+// of the reconcile.
+func (v *counterView) write(ctx context.Context) error {
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("amf", "Counters")
+		object.SetName(obj, "", "counters")
+		exists := true
+		if err := v.client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get amf/Counters: %w", err)
+			}
+			exists = false
+		}
+
+		obj.UnstructuredContent()["spec"] = map[string]any{
+			"registrations": v.counts.Registrations,
+			"sessions":      v.counts.Sessions,
+			"idleSessions":  v.counts.IdleSessions,
+		}
+		if exists {
+			if err := v.client.Update(ctx, obj); err != nil {
+				return fmt.Errorf("failed to update amf/Counters: %w", err)
+			}
+		} else if err := v.client.Create(ctx, obj); err != nil {
+			return fmt.Errorf("failed to create amf/Counters: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	v.dirty = false
+	return nil
+}
+
+// counterNotifier updates the counts on each change of a source object of an aggregate table.
+type counterNotifier struct {
+	view  *counterView
+	table int
+}
+
+func (r *counterNotifier) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	return reconcile.Result{}, r.view.update(ctx, r.table, req)
+}
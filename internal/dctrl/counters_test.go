@@ -0,0 +1,151 @@
+package dctrl_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Counter view", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// tableCounts returns a poller for the counts computed by scanning the aggregate tables
+	tableCounts := func() func() dctrl.Counts {
+		return func() dctrl.Counts {
+			counts := dctrl.Counts{}
+			for _, t := range []struct{ op, kind, name string }{
+				{"amf", "ActiveRegistrationTable", "active-registrations"},
+				{"smf", "ActiveSessionTable", "active-sessions"},
+			} {
+				table := object.NewViewObject(t.op, t.kind)
+				object.SetName(table, "", t.name)
+				if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+					continue
+				}
+				specs, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+				if t.op == "amf" {
+					counts.Registrations = int64(len(specs))
+					continue
+				}
+				counts.Sessions = int64(len(specs))
+				for _, s := range specs {
+					if e, ok := s.(map[string]any); ok && e["idle"] == true {
+						counts.IdleSessions++
+					}
+				}
+			}
+			return counts
+		}
+	}
+
+	// viewCounts returns a poller for the counts in the amf/Counters view
+	viewCounts := func() func() dctrl.Counts {
+		return func() dctrl.Counts {
+			obj := object.NewViewObject("amf", "Counters")
+			object.SetName(obj, "", "counters")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return dctrl.Counts{}
+			}
+			counts := dctrl.Counts{}
+			counts.Registrations, _, _ = unstructured.NestedInt64(obj.UnstructuredContent(), "spec", "registrations")
+			counts.Sessions, _, _ = unstructured.NestedInt64(obj.UnstructuredContent(), "spec", "sessions")
+			counts.IdleSessions, _, _ = unstructured.NestedInt64(obj.UnstructuredContent(), "spec", "idleSessions")
+			return counts
+		}
+	}
+
+	// expectCounts checks the view, the in-memory counts and the table sizes against the want
+	expectCounts := func(want dctrl.Counts) {
+		GinkgoHelper()
+		Eventually(tableCounts(), timeout, interval).Should(Equal(want))
+		Eventually(viewCounts(), timeout, interval).Should(Equal(want))
+		counts, ok := d.GetCounts()
+		Expect(ok).To(BeTrue())
+		Expect(counts).To(Equal(want))
+	}
+
+	It("should match the sizes of the aggregate tables through create/delete cycles", func() {
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			CounterView: true,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+
+		// the test session
+		expectCounts(dctrl.Counts{Sessions: 1})
+
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+
+		for i := 0; i < 4; i++ {
+			obj := newSessionContext(i)
+			if i%2 == 1 {
+				Expect(unstructured.SetNestedField(obj.UnstructuredContent(), true, "spec", "idle")).
+					To(Succeed())
+			}
+			Expect(testsuite.CreateWithRetry(ctx, c, obj)).To(Succeed())
+		}
+		expectCounts(dctrl.Counts{Registrations: 1, Sessions: 5, IdleSessions: 2})
+
+		// delete an active and an idle session
+		Expect(c.Delete(ctx, newSessionContext(0))).To(Succeed())
+		Expect(c.Delete(ctx, newSessionContext(1))).To(Succeed())
+		expectCounts(dctrl.Counts{Registrations: 1, Sessions: 3, IdleSessions: 1})
+
+		// re-create a session
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(0))).To(Succeed())
+		expectCounts(dctrl.Counts{Registrations: 1, Sessions: 4, IdleSessions: 1})
+
+		Expect(c.Delete(ctx, reg)).To(Succeed())
+		expectCounts(dctrl.Counts{Sessions: 4, IdleSessions: 1})
+	})
+
+	It("should be disabled by default", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := d.GetCounts()
+		Expect(ok).To(BeFalse())
+	})
+})
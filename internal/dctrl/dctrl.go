@@ -2,44 +2,329 @@ package dctrl
 
 import (
 	"context"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 
 	"github.com/l7mp/dcontroller/pkg/apiserver"
 	"github.com/l7mp/dcontroller/pkg/auth"
 	"github.com/l7mp/dcontroller/pkg/cache"
-	"github.com/l7mp/dcontroller/pkg/controller"
 	"github.com/l7mp/dcontroller/pkg/operator"
 
+	"github.com/hsnlab/dctrl5g/internal/aka"
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/operators/chf"
 	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+	"github.com/hsnlab/dctrl5g/internal/operators/upf"
+	"github.com/hsnlab/dctrl5g/internal/sidf"
 )
 
 // OpSpec holds the defs for the declarative opeators. Native operators have to be loaded manually.
 type OpSpec struct {
-	Name, File string
+	Name string `json:"name"`
+	File string `json:"file"`
+	// DependsOn lists the operators that must be started before and stopped after this one.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Requires lists the operators this one cannot work without. Unlike the operators in
+	// DependsOn, which only order the startup, these must be loaded too.
+	Requires []string `json:"requires,omitempty"`
 }
 
+// defaultMaxOperators is the default maximum number of declarative operators.
+const defaultMaxOperators = 32
+
+// EphemeralAPIServerPort, given as the APIServerPort, makes the API server bind a port chosen by
+// the OS, which is then returned by Dctrl.APIServerPort.
+const EphemeralAPIServerPort = -1
+
+// DefaultServiceAddr is the default address of the service server serving the metrics.
+const DefaultServiceAddr = ":8080"
+
 type Options struct {
-	OpSpecs                         []OpSpec
-	APIServerAddr                   string
-	APIServerPort                   int
+	OpSpecs       []OpSpec
+	APIServerAddr string
+	// APIServerPort is the port of the API server (default: 18443), or EphemeralAPIServerPort
+	// for a port chosen by the OS.
+	APIServerPort int
+	// APIPathPrefix, if set, is the path prefix the API server is served under, e.g., /dctrl5g
+	// when served behind a gateway: the views are then served at /dctrl5g/apis/... and not at
+	// /apis/... (default: the root).
+	APIPathPrefix                   string
 	DisableAuth, HTTPMode, Insecure bool
 	CertFile, KeyFile               string
-	Logger                          logr.Logger
+	// StrictSchemaCheck fails the startup if the fields the operators read from the views of
+	// other operators are not written there, instead of logging a warning.
+	StrictSchemaCheck bool
+	// ValidateOpSpecs validates the operator spec files against the schema of the operator specs
+	// at startup and fails with the location of the invalid fields, e.g., a controller with no
+	// target.
+	ValidateOpSpecs bool
+	// MaxOperators caps the number of declarative operators loaded, to guard against
+	// accidental over-provisioning (default: 32).
+	MaxOperators int
+	// HTTPAuth enables JWT authentication in HTTP mode, e.g., when TLS is terminated at a proxy.
+	// The tokens are validated against the public key in CertFile.
+	HTTPAuth bool
+	// ObservedGeneration makes native controllers add observedGeneration to the conditions.
+	ObservedGeneration bool
+	// TokenSelfTestInterval is the interval of the UDM token signing self-test (default: 1m).
+	TokenSelfTestInterval time.Duration
+	// TokenAuditRetention is the time the UDM keeps the token audit records of deleted UEs for
+	// (default: 24h).
+	TokenAuditRetention time.Duration
+	// UETokenTTL is the lifetime of the tokens the UDM issues to the UEs (default: 168h).
+	UETokenTTL time.Duration
+	// MaxUETokenTTL caps the lifetime of any token the UDM issues to the UEs, whatever TTL is
+	// requested (default: 720h).
+	MaxUETokenTTL time.Duration
+	// UETokenPoolSize, if positive, makes the UDM pre-generate the tokens of up to the given
+	// number of UEs whose registration is in progress (default: disabled).
+	UETokenPoolSize int
+	// UDMConfigSelector, if set, restricts the UDM to the Configs matching the label selector, so
+	// that the UEs can be sharded across replicas without leader election.
+	UDMConfigSelector *metav1.LabelSelector
+	// TableResyncInterval, if positive, enables a periodic rebuild of the aggregate tables
+	// (ActiveRegistrationTable, ActiveSessionTable) from the per-UE objects.
+	TableResyncInterval time.Duration
+	// ConfigGCInterval, if positive, enables a periodic garbage collection of the upf/Config
+	// objects with no owning session in the ActiveSessionTable.
+	ConfigGCInterval time.Duration
+	// MetricsLogInterval, if positive, enables a periodic log of a summary of the key metrics
+	// (active registrations and sessions, error counts), for the deployments with no metrics
+	// scraper.
+	MetricsLogInterval time.Duration
+	// TableCoalesceWindow is the window over which the changes to the per-UE objects are batched
+	// into a single aggregate table write (default: 20ms).
+	TableCoalesceWindow time.Duration
+	// RegistrationTimeout, if positive, marks the registrations that have not reached Ready
+	// within the deadline with Ready=False/RegistrationTimeout.
+	RegistrationTimeout time.Duration
+	// RegistrationExpiry, if positive, deletes the registrations not refreshed by an
+	// amf/Heartbeat of the UE within the given time.
+	RegistrationExpiry time.Duration
+	// RegistrationDedupWindow, if positive, coalesces the creates of the registrations with the
+	// SUCI of a registration created in the same namespace within the window, or still in flight,
+	// into the first one, so that the retries of a client run a single registration flow. The
+	// duplicate create returns the result of the first one.
+	RegistrationDedupWindow time.Duration
+	// SessionRegistrationWait, if positive, lets a session whose registration is still in
+	// progress wait up to the given time for the registration to complete, with
+	// Validated=Unknown/RegistrationPending, instead of failing outright with Unregistered.
+	SessionRegistrationWait time.Duration
+	// SessionIPPool is the IPv4 CIDR the addresses of the sessions are allocated from (default:
+	// 10.45.0.0/16). The first host address is reserved for the default gateway.
+	SessionIPPool string
+	// SessionIPv6Pool is the IPv6 CIDR the IPv6 addresses of the IPv6 and the IPv4v6 sessions are
+	// allocated from (default: 2001:db8:45::/64). The first host address is reserved for the
+	// default gateway.
+	SessionIPv6Pool string
+	// UPFTunnelAddresses are the N3 addresses of the UPF the GTP-U tunnels of the sessions
+	// terminate at (default: 10.100.200.1). Each tunnel is placed at the address serving the
+	// fewest sessions.
+	UPFTunnelAddresses []string
+	// CounterView enables the amf/Counters view holding the number of the active registrations,
+	// the active sessions and the idle sessions, maintained incrementally.
+	CounterView bool
+	// SessionInactivityTimer, if positive, enables the UE inactivity timer of the sessions: the
+	// time of the last activity and the expiry of the timer are reported in the session status.
+	SessionInactivityTimer time.Duration
+	// UsageAccountingInterval, if positive, enables the usage accounting of the sessions in the
+	// chf/UsageRecord view, with the duration of the active sessions refreshed at the given
+	// interval.
+	UsageAccountingInterval time.Duration
+	// StateStore persists the AMF:RegState objects and the aggregate tables across restarts: the
+	// last snapshot is restored on startup and a new one is saved once the operators have stopped
+	// (default: in-memory, i.e., not persisted across restarts of the process).
+	StateStore StateStore
+	// StateFile, if set and StateStore is not, persists the registration state in the given JSON
+	// file.
+	StateFile string
+	// StateSnapshotInterval, if positive, saves a snapshot of the registration state at the
+	// given interval in addition to the one taken on shutdown.
+	StateSnapshotInterval time.Duration
+	// StateWriteThrough saves a snapshot of the registration state after each write of the
+	// aggregate tables, i.e., on each coalesced change of the registrations and the sessions.
+	// Meant for the stores that write the changed records only, like internal/store/bolt.
+	StateWriteThrough bool
+	// RegistrationEventBufferSize is the number of the registration state change events retained
+	// in the amf/RegistrationEvent view (default: 256).
+	RegistrationEventBufferSize int
+	// MaxRequestedNSSAI is the maximum number of S-NSSAIs in the requested NSSAI of a
+	// registration, set in the AMF:ConfigTable (default: 8).
+	MaxRequestedNSSAI int
+	// Dependencies lists the external services to wait for before reporting ready, until
+	// DependencyTimeout elapses (default: 30s).
+	Dependencies      []Dependency
+	DependencyTimeout time.Duration
+	// ReadinessGates selects the gates readiness is composed of (default: all of cacheSynced,
+	// operatorsStarted, operatorsSynced, dependenciesReady and leaderAcquired).
+	ReadinessGates []string
+	// MaxConcurrentMutations, if positive, caps the number of the mutating requests (create,
+	// update, patch and delete) the API server processes at a time; the requests over the limit
+	// are rejected with 503 Service Unavailable and a Retry-After header.
+	MaxConcurrentMutations int
+	// ErrorClassifier, if set, overrides the classification of the errors reported by the
+	// operators as transient or fatal (default: DefaultErrorClassifier).
+	ErrorClassifier ErrorClassifier
+	// FailureMode selects how an operator failing to load at startup, e.g., because of a
+	// malformed spec file, is handled: FailFast (default) fails New, BestEffort skips the
+	// operator and the operators requiring it, see Dctrl.FailedOperators.
+	FailureMode FailureMode
+	// FatalErrorPolicy selects how a fatal error of an operator is handled: shutdown (default),
+	// i.e., stop the control plane gracefully, or continue.
+	FatalErrorPolicy FatalErrorPolicy
+	// AdmissionPolicy, if set, is consulted before the API server creates a Registration or a
+	// Session.
+	AdmissionPolicy AdmissionPolicy
+	// UnknownFieldPolicy selects how the unknown spec fields of the Registrations and the
+	// Sessions are handled on create: DropUnknown, Warn (default) or Reject.
+	UnknownFieldPolicy UnknownFieldPolicy
+	// GutiCollisionPolicy selects how a GUTI allocated to UEs with distinct SUPIs is resolved:
+	// fail (default) or rehash.
+	GutiCollisionPolicy GutiCollisionPolicy
+	// GutiAllocator, if set, overrides the default allocator minting the GUTIs of the UEs with
+	// no GUTI provisioned, which draws a random AMF pointer and 5G-TMSI under DefaultGutiPrefix.
+	GutiAllocator GutiAllocator
+	// PLMNs, if set, lists the PLMNs served by the AMF: a registration is routed to the config of
+	// the PLMN of its SUCI, and the registrations of the other PLMNs fail with
+	// Validated=False/PlmnNotServed. A single PLMN is assumed if unset.
+	PLMNs []PLMNConfig
+	// HomeNetworkKeyFile, if set, is a PEM file of the home network private keys the AUSF
+	// de-conceals the SUCIs protected with ECIES Profile A (X25519) or Profile B (P-256) with,
+	// each key with its home network public key identifier in the Key-Id header. Only the SUCIs
+	// of the static SUCI to SUPI table are resolved if unset.
+	HomeNetworkKeyFile string
+	// SubscriberKeyStoreFile, if set, enables the 5G-AKA authentication of the UEs: a YAML file
+	// listing the SUPI, the key K, the OPc (or the OP) and the last sequence number of each
+	// subscriber, from which the AUSF generates the challenges of the UEs. The AMF then
+	// authenticates a UE only once it answered the challenge.
+	SubscriberKeyStoreFile string
+	// SubscriberProvisioning restricts the registrations to the subscribers provisioned in the
+	// UDM as udm/Subscribers: the AUSF resolves the mobile identities of the provisioned SUPIs
+	// only, and the AMF fails the registrations of the other UEs with SupiNotFound.
+	SubscriberProvisioning bool
+	// SubscriberStore holds the subscriber records of the UDM (default: in-memory).
+	SubscriberStore udm.SubscriberStore
+	// SubscribedAmbrPolicy selects how the SMF handles a session whose aggregate flow bit rate
+	// exceeds the UE-AMBR of the user, the stricter of the UE-AMBR of the PCF and the one
+	// subscribed in the UDM subscription profile of the user: cap (default) or reject.
+	SubscribedAmbrPolicy udm.AmbrPolicy
+	// DuplicateSupiPolicy selects how a registration of an already registered SUPI is handled:
+	// allow (default), reject or deregister.
+	DuplicateSupiPolicy DuplicateSupiPolicy
+	// ConfigRecreatePolicy selects how a UDM Config deleted while the registration of the UE is
+	// active is handled: ignore (default) or recreate.
+	ConfigRecreatePolicy ConfigRecreatePolicy
+	// UPFConfigFormat selects the shape the UPF configs are exported in: native (default),
+	// free5gc or open5gs. UPFConfigTransform, if set, overrides it with a custom transform.
+	UPFConfigFormat    string
+	UPFConfigTransform upf.Transform
+	// ServiceAddr, if set, is the address of the auxiliary HTTP server serving the diagnostic,
+	// the metrics and the JWKS endpoints. The command line defaults to DefaultServiceAddr.
+	ServiceAddr string
+	// DebugAddr is the former name of ServiceAddr, used as the address of the service server if
+	// ServiceAddr is empty.
+	//
+	// Deprecated: use ServiceAddr.
+	DebugAddr string
+	// ServicePathPrefix, if set, is the path prefix the endpoints of the auxiliary HTTP server
+	// are mounted under, e.g., /dctrl5g when served behind a gateway (default: the root).
+	ServicePathPrefix string
+	// ManagerMetrics exposes the metrics of the controller-runtime managers of the operators (the
+	// workqueue, the reconcile and the API client metrics), and the Go runtime and the process
+	// metrics, on the /metrics endpoint next to the dctrl5g metrics. Otherwise only the dctrl5g
+	// metrics are served.
+	ManagerMetrics bool
+	// HealthProbeAddr, if set, is the address of the HTTP server serving the health (/healthz)
+	// and the readiness (/readyz) probes for an orchestrator.
+	HealthProbeAddr string
+	// JWKSCertFiles lists certificates whose public keys are published in the JWKS in addition
+	// to the UDM signing key, e.g., the previous signing key during a key rotation.
+	JWKSCertFiles []string
+	// MinClientKeyBits is the minimum size of the RSA key of the TLS certificate a client presents
+	// to the API server; the requests of the clients with weaker keys are rejected (default: 2048).
+	MinClientKeyBits int
+	// RevocationListFile, if set, persists the revoked UE tokens in the given file, so that the
+	// tokens remain revoked across restarts.
+	RevocationListFile string
+	// LogCorrelation stamps the new Registrations and Sessions with a correlation ID that is
+	// carried to the views derived from them and attached to the log lines of the operators
+	// processing them.
+	LogCorrelation bool
+	// TracerProvider, if set, traces the UE requests: a span is started when a Registration or a
+	// Session is admitted, and the reconciles of the views derived from it and of the UDM configs
+	// are recorded as its child spans. No spans are recorded if unset.
+	TracerProvider trace.TracerProvider
+	Logger         logr.Logger
 }
 
 type Dctrl struct {
-	sharedCache *cache.ViewCache
-	ops         map[string]*operator.Operator
-	apiServer   *apiserver.APIServer
-	errorChan   chan error
-	log, logger logr.Logger
+	sharedCache      *cache.ViewCache
+	ops              map[string]*operator.Operator
+	order            []string
+	apiServer        *apiserver.APIServer
+	apiProxy         *apiPrefixProxy
+	udm              *udm.UDM
+	chf              *chf.CHF
+	resyncer         *tableResyncer
+	configGC         *configCollector
+	metricsLog       *metricsLogger
+	coalescer        *tableCoalescer
+	counters         *counterView
+	flows            *flowIndex
+	policies         *policyRuleEngine
+	regTimer         *registrationTimer
+	regReaper        *registrationReaper
+	limiter          *concurrencyLimiter
+	state            *stateSnapshotter
+	deps             []Dependency
+	depTimeout       time.Duration
+	depsReady        atomic.Bool
+	gates            []string
+	cacheSynced      atomic.Bool
+	operatorsStarted atomic.Bool
+	leaders          atomic.Int32
+	serviceAddr      string
+	servicePrefix    string
+	managerMetrics   bool
+	healthProbeAddr  string
+	apiServerPort    int
+	apiServerBound   atomic.Bool
+	verificationKeys map[string]*rsa.PublicKey
+	revoked          *jwks.RevocationList
+	authn            *jwks.Authenticator
+	authz            authorizer.Authorizer
+	errStream        *errorDemux
+	fatalErrorPolicy FatalErrorPolicy
+	fatalErr         *FatalOperatorError
+	failedOps        map[string]error
+	startupGate      *startupGate
+	startCache       func(ctx context.Context) error
+	bus              *eventBus
+	specs            map[string]OpSpec
+	buildOperator    func(OpSpec) (*operator.Operator, error)
+	works            *operatorWorks
+	opMu             sync.Mutex // serializes the reloads and the shutdown of the operators
+	mu               sync.Mutex
+	run              *runState
+	log, logger      logr.Logger
 }
 
 func New(opts Options) (*Dctrl, error) {
@@ -49,6 +334,22 @@ func New(opts Options) (*Dctrl, error) {
 	}
 	log := logger.WithName("dctrl")
 
+	if opts.DebugAddr != "" {
+		log.Info("WARNING: the DebugAddr option is deprecated, use ServiceAddr")
+		if opts.ServiceAddr == "" {
+			opts.ServiceAddr = opts.DebugAddr
+		}
+	}
+
+	maxOps := opts.MaxOperators
+	if maxOps <= 0 {
+		maxOps = defaultMaxOperators
+	}
+	if len(opts.OpSpecs) > maxOps {
+		return nil, fmt.Errorf("%w: %d operator specs exceed the maximum of %d "+
+			"(see the MaxOperators option)", ErrTooManyOperators, len(opts.OpSpecs), maxOps)
+	}
+
 	addr := opts.APIServerAddr
 	if addr == "" {
 		addr = "localhost"
@@ -57,132 +358,857 @@ func New(opts Options) (*Dctrl, error) {
 	if port == 0 {
 		port = 18443
 	}
+	// the listeners are released on the error paths and handed over to the API server and the
+	// API prefix proxy below otherwise
+	var apiListener, apiProxyListener net.Listener
+	defer func() {
+		for _, l := range []net.Listener{apiListener, apiProxyListener} {
+			if l != nil {
+				l.Close() //nolint:errcheck
+			}
+		}
+	}()
+	if port == EphemeralAPIServerPort {
+		l, err := listenEphemeral(addr)
+		if err != nil {
+			return nil, &APIServerInitError{Err: err}
+		}
+		apiListener = l
+		port = l.Addr().(*net.TCPAddr).Port
+		log.V(1).Info("chose an ephemeral API server port", "port", port)
+	} else if port < 0 {
+		return nil, &APIServerInitError{Err: fmt.Errorf("invalid API server port %d", port)}
+	}
+	if err := checkGutiCollisionPolicy(opts.GutiCollisionPolicy); err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateSupiPolicy(opts.DuplicateSupiPolicy); err != nil {
+		return nil, err
+	}
+	if err := checkConfigRecreatePolicy(opts.ConfigRecreatePolicy); err != nil {
+		return nil, err
+	}
+	if err := checkFatalErrorPolicy(opts.FatalErrorPolicy); err != nil {
+		return nil, err
+	}
+	if err := checkFailureMode(opts.FailureMode); err != nil {
+		return nil, err
+	}
+	plmns, err := checkPLMNs(opts.PLMNs)
+	if err != nil {
+		return nil, err
+	}
+	var deconcealer *sidf.SIDF
+	if opts.HomeNetworkKeyFile != "" {
+		if deconcealer, err = sidf.LoadKeys(opts.HomeNetworkKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	var keyStore *aka.KeyStore
+	if opts.SubscriberKeyStoreFile != "" {
+		if keyStore, err = aka.LoadKeyStore(opts.SubscriberKeyStoreFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkRequirements(opts.OpSpecs); err != nil {
+		return nil, err
+	}
+	if err := checkUnknownFieldPolicy(opts.UnknownFieldPolicy); err != nil {
+		return nil, err
+	}
+	sessionIPPool, err := parseSessionIPPool(opts.SessionIPPool)
+	if err != nil {
+		return nil, err
+	}
+	sessionIPv6Pool, err := parseSessionIPv6Pool(opts.SessionIPv6Pool)
+	if err != nil {
+		return nil, err
+	}
+	upfTunnelAddresses, err := parseUPFTunnelAddresses(opts.UPFTunnelAddresses)
+	if err != nil {
+		return nil, err
+	}
+	servicePrefix, err := parsePathPrefix("service", opts.ServicePathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	apiPrefix, err := parsePathPrefix("API", opts.APIPathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ManagerMetrics {
+		if err := metrics.RegisterRuntimeCollectors(); err != nil {
+			return nil, fmt.Errorf("failed to register the runtime metrics: %w", err)
+		}
+	}
+	// the operators skipped in the BestEffort failure mode
+	failedOps := map[string]error{}
+	if opts.ValidateOpSpecs {
+		if opts.FailureMode == BestEffort {
+			for _, s := range opts.OpSpecs {
+				if err := validateOpSpecs([]OpSpec{s}); err != nil {
+					log.Error(err, "skipping operator", "operator", s.Name)
+					failedOps[s.Name] = err
+				}
+			}
+		} else if err := validateOpSpecs(opts.OpSpecs); err != nil {
+			return nil, err
+		}
+	}
+	if issues := checkSchemas(opts.OpSpecs); len(issues) > 0 {
+		if opts.StrictSchemaCheck {
+			return nil, fmt.Errorf("operator schema mismatch: %s", strings.Join(issues, "; "))
+		}
+		for _, issue := range issues {
+			log.Info("WARNING: operator schema mismatch: " + issue)
+		}
+	}
+	if err := checkListenAddrs(
+		listenAddr{"API server", net.JoinHostPort(addr, strconv.Itoa(port))},
+		listenAddr{"service", opts.ServiceAddr},
+		listenAddr{"health probe", opts.HealthProbeAddr},
+	); err != nil {
+		return nil, err
+	}
+
+	// The embedded API server mounts its handlers at the root: to serve it under the API path
+	// prefix, a proxy takes the address of the API server and the API server is bound to a
+	// loopback port.
+	apiAddr, apiPort := addr, port
+	if apiPrefix != "" {
+		apiProxyListener, apiListener = apiListener, nil
+		if apiProxyListener == nil {
+			l, err := listen("API server", net.JoinHostPort(addr, strconv.Itoa(port)))
+			if err != nil {
+				return nil, &APIServerInitError{Err: err}
+			}
+			apiProxyListener = l
+		}
+		l, err := listenEphemeral("localhost")
+		if err != nil {
+			return nil, &APIServerInitError{Err: err}
+		}
+		apiListener = l
+		apiAddr, apiPort = "localhost", l.Addr().(*net.TCPAddr).Port
+	}
 
 	// Step 1: Create a shared view cache.
 	sharedCache := cache.NewViewCache(cache.CacheOptions{Logger: logger})
 
 	// Step 2: Create the API server
-	apiServerConfig, err := apiserver.NewDefaultConfig(addr, port, sharedCache.GetClient(),
+	apiServerConfig, err := apiserver.NewDefaultConfig(apiAddr, apiPort, sharedCache.GetClient(),
 		opts.HTTPMode, opts.Insecure, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create the config for the embedded API server: %w", err)
-	}
-
-	// Step 2: Configure authentication and authorization unless explicitly disabled or running in HTTP-only mode.
-	if opts.HTTPMode || opts.DisableAuth {
-		log.Info("WARNING: Running API server without authentication - unrestricted access enabled")
-	} else {
-		// Load TLS key/cert.
-		if err := checkCert(log, opts.CertFile, opts.KeyFile); err != nil {
-			return nil, fmt.Errorf("failed to load TLS key/cert: %w", err)
+		return nil, &APIServerInitError{
+			Err: fmt.Errorf("failed to create the config for the embedded API server: %w", err),
 		}
-		// Load public key.
-		publicKey, err := auth.LoadPublicKey(opts.CertFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load public key: %w (hint: generate keys with "+
-				"'dctl generate-keys' or use --disable-authentication)", err)
+	}
+	apiServerConfig.DelegatingClient = &unknownFieldsClient{
+		Client: apiServerConfig.DelegatingClient,
+		policy: opts.UnknownFieldPolicy,
+		log:    log,
+	}
+	if opts.AdmissionPolicy != nil {
+		apiServerConfig.DelegatingClient = &admissionClient{
+			Client: apiServerConfig.DelegatingClient,
+			policy: opts.AdmissionPolicy,
 		}
+	}
+	correlationOpts := correlationOptions{Enabled: opts.LogCorrelation, Logger: logger}
+	apiServerConfig.DelegatingClient = withCorrelation(apiServerConfig.DelegatingClient, correlationOpts)
+	tracingOpts := tracingOptions{TracerProvider: opts.TracerProvider}
+	apiServerConfig.DelegatingClient = withTracing(apiServerConfig.DelegatingClient, tracingOpts)
+	apiServerConfig.DelegatingClient = withRegistrationDedup(apiServerConfig.DelegatingClient,
+		registrationDedupOptions{Window: opts.RegistrationDedupWindow, Logger: logger})
+	var limiter *concurrencyLimiter
+	if opts.MaxConcurrentMutations > 0 {
+		limiter = newConcurrencyLimiter(apiServerConfig.DelegatingClient, opts.MaxConcurrentMutations)
+		apiServerConfig.DelegatingClient = limiter
+	}
+	// Reject the mutating requests until the control plane is ready.
+	gate := newStartupGate(apiServerConfig.DelegatingClient, opts.Dependencies, opts.DependencyTimeout)
+	apiServerConfig.DelegatingClient = gate
 
-		apiServerConfig.Authenticator = auth.NewJWTAuthenticator(publicKey)
-		apiServerConfig.Authorizer = auth.NewCompositeAuthorizer()
-		apiServerConfig.CertFile = opts.CertFile
-		apiServerConfig.KeyFile = opts.KeyFile
-
-		log.V(2).Info("generated authentication token for internal controllers")
+	// Step 2: Configure authentication and authorization unless explicitly disabled or running in
+	// HTTP-only mode without HTTPAuth.
+	apiAuth, err := configureAuth(&apiServerConfig, authOptions{
+		DisableAuth:        opts.DisableAuth,
+		HTTPMode:           opts.HTTPMode,
+		HTTPAuth:           opts.HTTPAuth,
+		CertFile:           opts.CertFile,
+		KeyFile:            opts.KeyFile,
+		JWKSCertFiles:      opts.JWKSCertFiles,
+		RevocationListFile: opts.RevocationListFile,
+		MinClientKeyBits:   opts.MinClientKeyBits,
+	}, log)
+	if err != nil {
+		return nil, err
 	}
+	verificationKeys, authn := apiAuth.verificationKeys, apiAuth.authn
 
+	// hand the reserved ephemeral port over to the API server, which binds it when created
+	if apiListener != nil {
+		apiListener.Close() //nolint:errcheck
+		apiListener = nil
+	}
 	apiServer, err := apiserver.NewAPIServer(apiServerConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create the embedded API server: %w", err)
+		return nil, &APIServerInitError{Err: fmt.Errorf("failed to create the embedded API server: %w", err)}
 	}
 
-	// 3. Create the operators
-	errorChan := make(chan error, 64)
-	ops := map[string]*operator.Operator{}
+	// 3. Create the operators, extended with the native controllers of the control plane. The
+	// same builder is used to reload an operator.
+	opNames := []string{}
 	for _, opSpec := range opts.OpSpecs {
-		op, err := operator.NewFromFile(opSpec.Name, nil, opSpec.File, operator.Options{
-			Cache:        sharedCache,
-			APIServer:    apiServer,
-			ErrorChannel: errorChan,
-			Logger:       logger,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("unable to create operator %q: %w", opSpec.Name, err)
+		opNames = append(opNames, opSpec.Name)
+	}
+	opNames = append(opNames, udm.OperatorName)
+	if opts.UsageAccountingInterval > 0 {
+		opNames = append(opNames, chf.OperatorName)
+	}
+	errStream := newErrorDemux(opNames, log)
+	if opts.ErrorClassifier != nil {
+		errStream.classify = opts.ErrorClassifier
+	}
+	coalescer := newTableCoalescer(sharedCache.GetClient(), opts.TableCoalesceWindow, logger)
+	flows := newFlowIndex()
+	policies := newPolicyRuleEngine(sharedCache.GetClient(), logger)
+	counters, counterHooks := newCounterViewHooks(counterViewOptions{
+		Client:  sharedCache.GetClient(),
+		Enabled: opts.CounterView,
+		Logger:  logger,
+	})
+	regReaper, reaperHooks := newRegistrationReaperHooks(registrationReaperOptions{
+		Client: sharedCache.GetClient(),
+		Expiry: opts.RegistrationExpiry,
+		Logger: logger,
+	})
+	// The hooks are added in order: the hooks registering the native kinds of an operator come
+	// after the other hooks of the operator.
+	hooks := slices.Concat(
+		observerHooks(logger),
+		correlationHooks(correlationOpts),
+		tracingHooks(tracingOpts),
+		counterHooks,
+		flows.hooks(),
+		policies.hooks(apiServer),
+		smfHooks(smfHookOptions{
+			Client:           sharedCache.GetClient(),
+			RegistrationWait: opts.SessionRegistrationWait,
+			InactivityTimer:  opts.SessionInactivityTimer,
+			Logger:           logger,
+		}),
+		ipAllocatorHooks(ipAllocatorOptions{
+			Client:   sharedCache.GetClient(),
+			Pool:     sessionIPPool,
+			IPv6Pool: sessionIPv6Pool,
+			Logger:   logger,
+		}),
+		teidAllocatorHooks(teidAllocatorOptions{
+			Client:    sharedCache.GetClient(),
+			Addresses: upfTunnelAddresses,
+			Logger:    logger,
+		}),
+		gutiAllocatorHooks(gutiAllocatorOptions{
+			Client:    sharedCache.GetClient(),
+			Allocator: opts.GutiAllocator,
+			PLMNs:     plmns,
+			Logger:    logger,
+		}),
+		reaperHooks,
+		amfHooks(amfHookOptions{
+			Client:              sharedCache.GetClient(),
+			APIServer:           apiServer,
+			GutiCollisionPolicy: opts.GutiCollisionPolicy,
+			DuplicateSupiPolicy: opts.DuplicateSupiPolicy,
+			PLMNs:               plmns,
+			MaxRequestedNSSAI:   opts.MaxRequestedNSSAI,
+			EventBufferSize:     opts.RegistrationEventBufferSize,
+			Logger:              logger,
+		}),
+		ausfHooks(ausfHookOptions{
+			Client:      sharedCache.GetClient(),
+			APIServer:   apiServer,
+			Deconcealer: deconcealer,
+			KeyStore:    keyStore,
+			Logger:      logger,
+		}),
+		upfHooks(upfHookOptions{
+			Cache:     sharedCache,
+			APIServer: apiServer,
+			Format:    opts.UPFConfigFormat,
+			Transform: opts.UPFConfigTransform,
+			Logger:    logger,
+		}),
+	)
+	works := newOperatorWorks()
+	buildOperator := newOperatorBuilder(operatorBuilderOptions{
+		Cache:        sharedCache,
+		APIServer:    apiServer,
+		ErrorChannel: errStream.in,
+		Coalescer:    coalescer,
+		Hooks:        hooks,
+		Works:        works,
+		Logger:       logger,
+	})
+
+	ops, specs, err := buildOperators(opts.OpSpecs, opts.FailureMode, buildOperator, failedOps, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// the loaded operators in the declaration order, not depending on the skipped ones
+	names, deps := []string{}, map[string][]string{}
+	for _, opSpec := range opts.OpSpecs {
+		if _, ok := ops[opSpec.Name]; !ok {
+			continue
 		}
-		ops[opSpec.Name] = op
+		names = append(names, opSpec.Name)
+		deps[opSpec.Name] = slices.DeleteFunc(slices.Clone(opSpec.DependsOn), func(d string) bool {
+			_, failed := failedOps[d]
+			return failed
+		})
 	}
 
 	// 4. Load the UDM operator. The constructor returns an actual operator (calls
 	// AddNativeController internally).
+	udmWork := metrics.NewWork()
 	udmOp, err := udm.New(apiServer, udm.Options{
-		Cache:    sharedCache,
-		HTTPMode: opts.HTTPMode,
-		Insecure: opts.Insecure,
-		KeyFile:  opts.KeyFile,
-		Logger:   logger,
+		Cache:                 sharedCache,
+		HTTPMode:              opts.HTTPMode,
+		Insecure:              opts.Insecure,
+		KeyFile:               opts.KeyFile,
+		ObservedGeneration:    opts.ObservedGeneration,
+		TokenSelfTestInterval: opts.TokenSelfTestInterval,
+		TokenAuditRetention:   opts.TokenAuditRetention,
+		TokenTTL:              opts.UETokenTTL,
+		MaxTokenTTL:           opts.MaxUETokenTTL,
+		TokenPoolSize:         opts.UETokenPoolSize,
+		ConfigSelector:        opts.UDMConfigSelector,
+		SubscriberStore:       opts.SubscriberStore,
+		EnforceSubscribers:    opts.SubscriberProvisioning,
+		AmbrPolicy:            opts.SubscribedAmbrPolicy,
+		TracerProvider:        opts.TracerProvider,
+		ErrorChannel:          errStream.in,
+		ErrorReporter:         errStream.report(udm.OperatorName),
+		Work:                  udmWork,
+		Logger:                logger,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to create operator UDM: %w", err)
+		return nil, &OperatorLoadError{Name: udm.OperatorName, Err: err}
 	}
 	ops["udm"] = udmOp.Operator
+	works.add(udmOp.Operator, udmWork)
+
+	// Recreate the configs deleted while the registration of the UE is active.
+	if err := addConfigRecreator(&trackedOperator{Operator: udmOp.Operator, work: udmWork}, sharedCache.GetClient(), opts.ConfigRecreatePolicy,
+		logger); err != nil {
+		return nil, fmt.Errorf("unable to create the config recreator: %w", err)
+	}
+	names = append(names, "udm")
+
+	// Account the usage of the sessions for charging.
+	var chfOp *chf.CHF
+	if opts.UsageAccountingInterval > 0 {
+		chfWork := metrics.NewWork()
+		chfOp, err = chf.New(apiServer, chf.Options{
+			Cache:           sharedCache,
+			RefreshInterval: opts.UsageAccountingInterval,
+			ErrorChannel:    errStream.in,
+			ErrorReporter:   errStream.report(chf.OperatorName),
+			Work:            chfWork,
+			Logger:          logger,
+		})
+		if err != nil {
+			return nil, &OperatorLoadError{Name: chf.OperatorName, Err: err}
+		}
+		ops[chf.OperatorName] = chfOp.Operator
+		works.add(chfOp.Operator, chfWork)
+		names = append(names, chf.OperatorName)
+	}
+
+	order, err := startupOrder(names, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. Load the keys for verifying the tokens issued by the UDM, unless already loaded for the
+	// authenticator.
+	if verificationKeys == nil {
+		verificationKeys, err = loadVerificationKeys(opts.KeyFile, opts.JWKSCertFiles)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gates := defaultReadinessGates
+	if len(opts.ReadinessGates) > 0 {
+		if err := checkReadinessGates(opts.ReadinessGates); err != nil {
+			return nil, err
+		}
+		gates = opts.ReadinessGates
+	}
+
+	// 6. Create the aggregate table resyncer.
+	var resyncer *tableResyncer
+	if opts.TableResyncInterval > 0 {
+		resyncer = newTableResyncer(sharedCache.GetClient(), opts.TableResyncInterval,
+			&coalescer.writes, logger)
+	}
+
+	// 7. Create the UPF config garbage collector.
+	var configGC *configCollector
+	if opts.ConfigGCInterval > 0 {
+		configGC = newConfigCollector(sharedCache.GetClient(), opts.ConfigGCInterval, logger)
+	}
+
+	// 8. Create the registration timer.
+	var regTimer *registrationTimer
+	if opts.RegistrationTimeout > 0 {
+		regTimer = newRegistrationTimer(sharedCache.GetClient(), opts.RegistrationTimeout, logger)
+	}
+
+	// 9. Create the registration state snapshotter.
+	stateStore := opts.StateStore
+	if stateStore == nil {
+		stateStore = NewMemoryStateStore()
+		if opts.StateFile != "" {
+			stateStore = NewFileStateStore(opts.StateFile)
+		}
+	}
+	state := newStateSnapshotter(sharedCache.GetClient(), stateStore, opts.StateSnapshotInterval, logger)
+	if opts.StateWriteThrough {
+		coalescer.onFlush = func(ctx context.Context) {
+			if err := state.snapshot(ctx); err != nil {
+				state.log.Error(err, "failed to write through the registration state")
+			}
+		}
+	}
+
+	// 10. Create the metrics logger.
+	var metricsLog *metricsLogger
+	if opts.MetricsLogInterval > 0 {
+		metricsLog = newMetricsLogger(sharedCache.GetClient(), counters, opts.MetricsLogInterval, logger)
+	}
 
-	return &Dctrl{
-		sharedCache: sharedCache,
-		ops:         ops,
-		apiServer:   apiServer,
-		errorChan:   errorChan,
-		log:         log,
-		logger:      logger,
-	}, nil
+	// 11. Create the proxy serving the API server under the API path prefix.
+	var apiProxy *apiPrefixProxy
+	if apiProxyListener != nil {
+		apiProxy = newAPIPrefixProxy(apiPrefix, apiProxyListener, apiPort, opts.HTTPMode, logger)
+		if !opts.HTTPMode {
+			apiProxy.certFile, apiProxy.keyFile = opts.CertFile, opts.KeyFile
+		}
+		if authn != nil {
+			apiProxy.minClientKeyBits = apiAuth.minClientKeyBits
+		}
+		apiProxyListener = nil
+	}
+
+	d := &Dctrl{
+		sharedCache:      sharedCache,
+		startCache:       sharedCache.Start,
+		ops:              ops,
+		specs:            specs,
+		buildOperator:    buildOperator,
+		works:            works,
+		order:            order,
+		apiServer:        apiServer,
+		apiServerPort:    port,
+		apiProxy:         apiProxy,
+		udm:              udmOp,
+		chf:              chfOp,
+		resyncer:         resyncer,
+		configGC:         configGC,
+		metricsLog:       metricsLog,
+		coalescer:        coalescer,
+		counters:         counters,
+		flows:            flows,
+		policies:         policies,
+		regTimer:         regTimer,
+		regReaper:        regReaper,
+		limiter:          limiter,
+		state:            state,
+		deps:             opts.Dependencies,
+		depTimeout:       opts.DependencyTimeout,
+		serviceAddr:      opts.ServiceAddr,
+		servicePrefix:    servicePrefix,
+		managerMetrics:   opts.ManagerMetrics,
+		healthProbeAddr:  opts.HealthProbeAddr,
+		verificationKeys: verificationKeys,
+		revoked:          apiAuth.revoked,
+		authn:            authn,
+		authz:            apiAuth.authz,
+		errStream:        errStream,
+		fatalErrorPolicy: opts.FatalErrorPolicy,
+		failedOps:        failedOps,
+		startupGate:      gate,
+		bus:              newEventBus(log),
+		gates:            gates,
+		log:              log,
+		logger:           logger,
+	}
+	gate.ready = d.Ready
+	errStream.onFatal = d.onFatalError
+
+	return d, nil
+}
+
+// authOptions configures the authentication and the authorization of the API server.
+type authOptions struct {
+	DisableAuth        bool
+	HTTPMode           bool
+	HTTPAuth           bool
+	CertFile           string
+	KeyFile            string
+	JWKSCertFiles      []string
+	RevocationListFile string
+	MinClientKeyBits   int
+}
+
+// apiServerAuth is the authentication and the authorization of the API server. The authenticator
+// and the authorizer are nil if the authentication is disabled.
+type apiServerAuth struct {
+	verificationKeys map[string]*rsa.PublicKey
+	authn            *jwks.Authenticator
+	authz            authorizer.Authorizer
+	revoked          *jwks.RevocationList
+	minClientKeyBits int
+}
+
+// configureAuth configures the authentication and the authorization of the API server, unless
+// explicitly disabled or running in HTTP-only mode without HTTPAuth. The subscriber endpoints of
+// the service server are guarded the same way.
+func configureAuth(config *apiserver.Config, o authOptions, log logr.Logger) (*apiServerAuth, error) {
+	a := &apiServerAuth{revoked: jwks.NewRevocationList()}
+	if o.RevocationListFile != "" {
+		l, err := jwks.NewPersistentRevocationList(o.RevocationListFile)
+		if err != nil {
+			return nil, &APIServerInitError{Err: err}
+		}
+		a.revoked = l
+	}
+	if o.DisableAuth || (o.HTTPMode && !o.HTTPAuth) {
+		log.Info("WARNING: Running API server without authentication - unrestricted access enabled")
+		return a, nil
+	}
+
+	// Load TLS key/cert.
+	if !o.HTTPMode {
+		if err := checkCert(log, o.CertFile, o.KeyFile); err != nil {
+			return nil, &APIServerInitError{Err: fmt.Errorf("failed to load TLS key/cert: %w", err)}
+		}
+	}
+	// Load public key.
+	publicKey, err := auth.LoadPublicKey(o.CertFile)
+	if err != nil {
+		return nil, &APIServerInitError{Err: fmt.Errorf("failed to load public key: %w (hint: "+
+			"generate keys with 'dctrl5g generate-keys' or use --disable-authentication)", err)}
+	}
+
+	// Accept the tokens signed by any of the published keys to allow for key rotation.
+	a.verificationKeys, err = loadVerificationKeys(o.KeyFile, o.JWKSCertFiles)
+	if err != nil {
+		return nil, &APIServerInitError{Err: err}
+	}
+	a.verificationKeys[jwks.KeyID(publicKey)] = publicKey
+
+	authenticator := jwks.NewAuthenticator(a.verificationKeys)
+	authenticator.SetRevocationList(a.revoked)
+	a.minClientKeyBits = o.MinClientKeyBits
+	if a.minClientKeyBits == 0 {
+		a.minClientKeyBits = jwks.DefaultMinClientKeyBits
+	}
+	authenticator.SetMinClientKeyBits(a.minClientKeyBits)
+	config.Authenticator = authenticator
+	config.Authorizer = auth.NewCompositeAuthorizer()
+	a.authn, a.authz = authenticator, config.Authorizer
+	if !o.HTTPMode {
+		config.CertFile = o.CertFile
+		config.KeyFile = o.KeyFile
+	}
+
+	log.V(2).Info("generated authentication token for internal controllers")
+	return a, nil
 }
 
 func (d *Dctrl) GetCache() *cache.ViewCache { return d.sharedCache }
 func (d *Dctrl) GetLogger() logr.Logger     { return d.logger }
 
 func (d *Dctrl) Start(ctx context.Context) error {
-	defer close(d.errorChan)
+	// Cancelled when the shared cache exits so that nothing keeps running against a dead cache.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The API server can be stopped separately so that Stop can drain the operators.
+	apiCtx, apiCancel := context.WithCancel(ctx)
+	run := &runState{
+		ctx:           ctx,
+		cancel:        cancel,
+		stopAPIServer: apiCancel,
+		done:          make(chan struct{}),
+		running:       map[string]*runningOperator{},
+	}
+	d.mu.Lock()
+	if d.run != nil {
+		d.mu.Unlock()
+		return errors.New("dctrl already started")
+	}
+	d.run = run
+	d.mu.Unlock()
+	d.startupGate.start()
+	defer close(run.done)
+	// the operators may report errors until they returned
+	defer d.errStream.close()
+
+	// Bind the auxiliary servers first so that a port collision fails the startup.
+	var serviceListener, healthProbeListener net.Listener
+	if d.serviceAddr != "" {
+		l, err := listen("service", d.serviceAddr)
+		if err != nil {
+			return err
+		}
+		serviceListener = l
+	}
+	if d.healthProbeAddr != "" {
+		l, err := listen("health probe", d.healthProbeAddr)
+		if err != nil {
+			if serviceListener != nil {
+				serviceListener.Close() //nolint:errcheck
+			}
+			return err
+		}
+		healthProbeListener = l
+	}
+	d.mu.Lock()
+	if serviceListener != nil {
+		run.serviceAddr = serviceListener.Addr().String()
+	}
+	if healthProbeListener != nil {
+		run.healthProbeAddr = healthProbeListener.Addr().String()
+	}
+	d.mu.Unlock()
+
+	go d.waitForDependencies(ctx)
+
+	if serviceListener != nil {
+		go d.startServiceServer(ctx, serviceListener)
+	}
 
 	go func() {
 		d.log.V(1).Info("starting API server")
-		if err := d.apiServer.Start(ctx); err != nil {
+		if err := d.apiServer.Start(apiCtx); err != nil {
 			d.log.Error(err, "embedded API server error")
 		}
 	}()
+	go d.waitForAPIServer(apiCtx)
+	if d.apiProxy != nil {
+		go d.apiProxy.Start(apiCtx)
+	}
+
+	if healthProbeListener != nil {
+		go d.startHealthProbeServer(ctx, healthProbeListener)
+	}
+
+	go d.errStream.run()
 
+	// The shared cache outlives the operators so that these can shut down cleanly.
+	cacheCtx, cacheCancel := context.WithCancel(context.WithoutCancel(ctx))
+	opErr := make(chan error, 1)
 	go func() {
-		for {
-			select {
-			case err := <-d.errorChan:
-				var operr controller.Error
-				if errors.As(err, &operr) {
-					d.log.Error(err, "controller error", "operator", operr.Operator,
-						"controller", operr.Controller)
-				} else {
-					d.log.Error(err, "error")
-				}
+		defer cacheCancel()
+		opErr <- d.runOperators(ctx)
+	}()
+
+	go d.coalescer.Start(ctx)
 
-			case <-ctx.Done():
-				return
+	if d.resyncer != nil {
+		d.log.V(1).Info("starting the aggregate table resyncer", "interval", d.resyncer.interval)
+		go d.resyncer.Start(ctx)
+	}
+
+	if d.configGC != nil {
+		d.log.V(1).Info("starting the UPF config garbage collector", "interval", d.configGC.interval)
+		go d.configGC.Start(ctx)
+	}
+
+	if d.metricsLog != nil {
+		d.log.V(1).Info("starting the metrics logger", "interval", d.metricsLog.interval)
+		go d.metricsLog.Start(ctx)
+	}
+
+	if d.regTimer != nil {
+		d.log.V(1).Info("starting the registration timer", "timeout", d.regTimer.timeout)
+		go d.regTimer.Start(ctx)
+	}
+
+	if d.regReaper != nil {
+		d.log.V(1).Info("starting the registration reaper", "expiry", d.regReaper.expiry)
+		go d.regReaper.Start(ctx)
+	}
+
+	go d.policies.Start(ctx)
+
+	if d.state.interval > 0 {
+		d.log.V(1).Info("starting the state snapshots", "interval", d.state.interval)
+		go d.state.Start(ctx)
+	}
+
+	go func() {
+		if d.sharedCache.WaitForCacheSync(ctx) {
+			// the state is restored before reporting ready
+			if err := d.state.restore(ctx); err != nil {
+				d.log.Error(err, "failed to restore the registration state")
 			}
+			d.cacheSynced.Store(true)
+			d.emit(CacheSynced, "", nil)
 		}
 	}()
 
-	for n, o := range d.ops {
-		d.log.V(1).Info("starting the operator", "name", n)
-		go func() {
-			if err := o.Start(ctx); err != nil {
-				d.log.Error(err, "operator error", "name", n)
-			}
-		}()
+	d.log.V(1).Info("starting the shared storage")
+	err := d.startCache(cacheCtx)
+	if ctx.Err() == nil {
+		d.log.Error(err, "shared storage exited unexpectedly, stopping the operators")
+		if err == nil {
+			err = errors.New("shared storage exited unexpectedly")
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("shared storage error: %w", err)
 	}
 
-	d.log.V(1).Info("starting the shared storage")
-	return d.sharedCache.Start(ctx)
+	cancel()
+	return errors.Join(err, <-opErr, d.fatalError())
+}
+
+// runOperators starts the operators in dependency order, waiting for each to come up before
+// starting the next one, and, once the context is cancelled, stops them in the reverse order.
+// Returns the errors of the operators.
+func (d *Dctrl) runOperators(ctx context.Context) error {
+	started := 0
+	for _, n := range d.order {
+		if ctx.Err() != nil {
+			break
+		}
+		o := d.GetOperator(n)
+
+		r := d.startOperator(ctx, n, o)
+		d.registerOperator(n, r)
+		started++
+
+		select {
+		case <-o.GetManager().Elected():
+			d.leaders.Add(1)
+			d.emit(LeaderAcquired, n, nil)
+		case <-r.done:
+		case <-ctx.Done():
+		}
+	}
+	d.operatorsStarted.Store(started == len(d.order) && ctx.Err() == nil)
+
+	<-ctx.Done()
+	d.operatorsStarted.Store(false)
+
+	// wait for a reload in progress and prevent new ones
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+	d.mu.Lock()
+	d.run.stopping = true
+	d.mu.Unlock()
+
+	errs := []error{}
+	for i := started - 1; i >= 0; i-- {
+		n := d.order[i]
+		d.mu.Lock()
+		r := d.run.running[n]
+		d.mu.Unlock()
 
+		if err := d.stopOperator(n, r); err != nil {
+			errs = append(errs, err)
+		}
+		d.works.forget(d.GetOperator(n))
+	}
+
+	// the shared cache is still running
+	if err := d.state.snapshot(context.WithoutCancel(ctx)); err != nil {
+		d.log.Error(err, "failed to snapshot the registration state")
+	}
+
+	return errors.Join(errs...)
+}
+
+// startOperator starts an operator in the background. The caller registers it as running.
+func (d *Dctrl) startOperator(ctx context.Context, n string, o *operator.Operator) *runningOperator {
+	d.log.V(1).Info("starting the operator", "name", n)
+	opCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	r := &runningOperator{cancel: cancel, done: make(chan struct{})}
+	d.emit(OperatorStarted, n, nil)
+	producerDone := d.errStream.addProducer()
+	go func() {
+		defer close(r.done)
+		defer producerDone()
+		if err := o.Start(opCtx); err != nil {
+			d.log.Error(err, "operator error", "name", n)
+			d.emit(OperatorFailed, n, err)
+			r.err = fmt.Errorf("operator %q: %w", n, err)
+		}
+	}()
+	go func() {
+		if o.GetManager().GetCache().WaitForCacheSync(opCtx) {
+			r.synced.Store(true)
+		}
+	}()
+	return r
+}
+
+// stopOperator stops a running operator and returns its error.
+func (d *Dctrl) stopOperator(n string, r *runningOperator) error {
+	d.log.V(1).Info("stopping the operator", "name", n)
+	r.cancel()
+	<-r.done
+	d.emit(OperatorStopped, n, nil)
+	return r.err
+}
+
+// GetOperator returns an operator by name, nil if not found.
+func (d *Dctrl) GetOperator(name string) *operator.Operator {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ops[name]
+}
+
+// TableWrites returns the number of aggregate table writes so far, including the writes of the
+// resyncer.
+func (d *Dctrl) TableWrites() uint64 { return d.coalescer.Writes() }
+
+// ShedRequests returns the number of the mutating requests rejected by the concurrency limit of
+// the API server.
+func (d *Dctrl) ShedRequests() uint64 {
+	if d.limiter == nil {
+		return 0
+	}
+	return d.limiter.Shed()
+}
+
+// CorrectedTableEntries returns the number of aggregate table entries corrected by the resyncer.
+func (d *Dctrl) CorrectedTableEntries() uint64 {
+	if d.resyncer == nil {
+		return 0
+	}
+	return d.resyncer.CorrectedEntries()
+}
+
+// CollectedConfigs returns the number of orphaned UPF configs collected by the config garbage
+// collector.
+func (d *Dctrl) CollectedConfigs() uint64 {
+	if d.configGC == nil {
+		return 0
+	}
+	return d.configGC.CollectedConfigs()
 }
 
-func (d *Dctrl) GetErrorChannel() chan error                { return d.errorChan }
-func (d *Dctrl) GetOperator(name string) *operator.Operator { return d.ops[name] }
+// TokenPoolStats returns the number of the UE tokens issued from the warm pool of the UDM and the
+// number of the tokens signed on demand.
+func (d *Dctrl) TokenPoolStats() (hits, misses uint64) { return d.udm.TokenPoolStats() }
 
 func checkCert(log logr.Logger, certFile, keyFile string) error {
 	// 1. Load the raw bytes from the certificate and key files.
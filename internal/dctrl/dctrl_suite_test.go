@@ -0,0 +1,30 @@
+package dctrl_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+)
+
+var (
+	loglevel = 0
+	timeout  = time.Second * 5
+	interval = time.Millisecond * 50
+	opSpecs  = []dctrl.OpSpec{
+		{Name: "amf", File: "../operators/amf.yaml"},
+		{Name: "ausf", File: "../operators/ausf.yaml"},
+		{Name: "smf", File: "../operators/smf.yaml"},
+		{Name: "pcf", File: "../operators/pcf.yaml"},
+		{Name: "upf", File: "../operators/upf.yaml"},
+		// UDM is manual
+	}
+)
+
+func TestDctrl(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dctrl")
+}
@@ -0,0 +1,108 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDependencyTimeout = 30 * time.Second
+	dependencyProbeInterval  = 500 * time.Millisecond
+	dependencyProbeTimeout   = time.Second
+)
+
+// Dependency is an external service (e.g., a subscriber store or a UPF) that must be reachable
+// before dctrl5g reports ready.
+type Dependency struct {
+	// Name identifies the dependency in the logs.
+	Name string
+	// Address is either a "host:port" TCP address or an "http://" or "https://" URL. TCP
+	// targets are healthy once a connection can be established, HTTP targets once a GET
+	// returns a non-error status code.
+	Address string
+}
+
+func (dep Dependency) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dependencyProbeTimeout)
+	defer cancel()
+
+	if strings.HasPrefix(dep.Address, "http://") || strings.HasPrefix(dep.Address, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, dep.Address, nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("unhealthy status %s", res.Status)
+		}
+		return nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", dep.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// waitForDependencies polls the dependencies until all of them respond or the timeout elapses,
+// and then opens the dependency readiness gate.
+func (d *Dctrl) waitForDependencies(ctx context.Context) {
+	defer d.depsReady.Store(true)
+
+	if len(d.deps) == 0 {
+		return
+	}
+
+	timeout := d.depTimeout
+	if timeout <= 0 {
+		timeout = defaultDependencyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(dependencyProbeInterval)
+	defer ticker.Stop()
+
+	pending := append([]Dependency{}, d.deps...)
+	for {
+		remaining := []Dependency{}
+		for _, dep := range pending {
+			if err := dep.probe(ctx); err != nil {
+				d.log.V(2).Info("dependency not ready", "name", dep.Name, "address", dep.Address,
+					"error", err.Error())
+				remaining = append(remaining, dep)
+				continue
+			}
+			d.log.V(1).Info("dependency ready", "name", dep.Name, "address", dep.Address)
+		}
+		pending = remaining
+		if len(pending) == 0 {
+			d.log.Info("all dependencies ready")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			names := make([]string, len(pending))
+			for i, dep := range pending {
+				names[i] = dep.Name
+			}
+			d.log.Error(ctx.Err(), "timed out waiting for dependencies", "pending", names)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DependenciesReady returns true once the startup dependency check has finished.
+func (d *Dctrl) DependenciesReady() bool { return d.depsReady.Load() }
@@ -0,0 +1,66 @@
+package dctrl_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// fakeDependency is an HTTP dependency that is down, i.e., answers 503, until it is brought up.
+type fakeDependency struct {
+	*httptest.Server
+	up atomic.Bool
+}
+
+// newFakeDependency starts a fake dependency that is initially down. The server is closed at the
+// end of the spec.
+func newFakeDependency() *fakeDependency {
+	dep := &fakeDependency{}
+	dep.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !dep.up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	DeferCleanup(dep.Close)
+	return dep
+}
+
+var _ = Describe("Startup dependencies", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should wait for a dependency that becomes available after a delay", func() {
+		dep := newFakeDependency()
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:           opSpecs,
+			Dependencies:      []dctrl.Dependency{{Name: "subscriber-store", Address: dep.URL}},
+			DependencyTimeout: 10 * time.Second,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		Consistently(d.DependenciesReady, time.Second, interval).Should(BeFalse())
+
+		dep.up.Store(true)
+
+		Eventually(d.DependenciesReady, timeout, interval).Should(BeTrue())
+	})
+})
@@ -0,0 +1,181 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// DuplicateSupiPolicy is the way a registration of an already registered SUPI is handled.
+type DuplicateSupiPolicy string
+
+const (
+	// DuplicateSupiAllow lets more registrations hold the same SUPI (default).
+	DuplicateSupiAllow DuplicateSupiPolicy = "allow"
+	// DuplicateSupiReject fails the newer registration with Validated=False/SupiAlreadyRegistered.
+	DuplicateSupiReject DuplicateSupiPolicy = "reject"
+	// DuplicateSupiDeregister implicitly deregisters the older registration.
+	DuplicateSupiDeregister DuplicateSupiPolicy = "deregister"
+)
+
+// duplicateSupiTableName is the name of the AMF:DuplicateSupiTable.
+const duplicateSupiTableName = "duplicate-supis"
+
+// duplicateSupiEnforcer enforces the uniqueness of the SUPIs in the active registration table:
+// the SUPI of each authenticated registration is checked against the SUPIs of the active
+// registrations, and if another registration holds the same SUPI, the newer registration is
+// listed in the rejected list of the AMF duplicate SUPI table, so that the AMF fails it with
+// Validated=False/SupiAlreadyRegistered, or the older registration is deleted, according to the
+// policy.
+type duplicateSupiEnforcer struct {
+	client client.Client
+	policy DuplicateSupiPolicy
+	log    logr.Logger
+}
+
+func checkDuplicateSupiPolicy(p DuplicateSupiPolicy) error {
+	switch p {
+	case "", DuplicateSupiAllow, DuplicateSupiReject, DuplicateSupiDeregister:
+		return nil
+	default:
+		return fmt.Errorf("unknown duplicate SUPI policy %q", p)
+	}
+}
+
+// addDuplicateSupiEnforcer adds the duplicate SUPI enforcer to the AMF operator, unless the policy
+// allows duplicate SUPIs.
+func addDuplicateSupiEnforcer(op *trackedOperator, c client.Client, policy DuplicateSupiPolicy, logger logr.Logger) error {
+	if policy == "" || policy == DuplicateSupiAllow {
+		return nil
+	}
+	r := &duplicateSupiEnforcer{
+		client: c,
+		policy: policy,
+		log:    logger.WithName("duplicate-supi-enforcer"),
+	}
+	return addWatchController(op, "amf", "duplicate-supi-enforcer", "RegState", r)
+}
+
+func (r *duplicateSupiEnforcer) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	// a deleted registration is no longer rejected
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, r.setRejected(ctx, key.String(), false)
+	}
+
+	reg := object.NewViewObject("amf", "RegState")
+	if err := r.client.Get(ctx, key, reg); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	status, _, _ := unstructured.NestedString(reg.UnstructuredContent(),
+		"status", "conditions", "authenticated", "status")
+	if status != "True" {
+		return reconcile.Result{}, nil
+	}
+
+	supi, err := registrationSupi(ctx, r.client, key)
+	if err != nil || supi == "" {
+		return reconcile.Result{}, err
+	}
+
+	table := object.NewViewObject("amf", "ActiveRegistrationTable")
+	object.SetName(table, "", "active-registrations")
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+	for _, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			continue
+		}
+		ns, _ := entry["namespace"].(string)
+		name, _ := entry["name"].(string)
+		other := client.ObjectKey{Namespace: ns, Name: name}
+		if other == key {
+			continue
+		}
+
+		otherSupi, err := registrationSupi(ctx, r.client, other)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if otherSupi != supi {
+			continue
+		}
+
+		// the older registration is handled when the newer one is reconciled
+		newer, err := newerRegistration(ctx, r.client, key, other)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if newer != key {
+			continue
+		}
+
+		r.log.Info("SUPI already registered", "supi", supi, "registration", key.String(),
+			"registered", other.String(), "policy", r.policy)
+		if r.policy == DuplicateSupiDeregister {
+			return reconcile.Result{}, r.deregister(ctx, other)
+		}
+		return reconcile.Result{}, r.setRejected(ctx, key.String(), true)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// deregister deletes a registration.
+func (r *duplicateSupiEnforcer) deregister(ctx context.Context, key client.ObjectKey) error {
+	reg := object.NewViewObject("amf", "Registration")
+	object.SetName(reg, key.Namespace, key.Name)
+	if err := r.client.Delete(ctx, reg); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to deregister %s: %w", key, err)
+	}
+	r.log.V(1).Info("implicitly deregistered", "registration", key.String())
+	return nil
+}
+
+// setRejected adds a registration to or removes it from the rejected list of the duplicate SUPI
+// table.
+func (r *duplicateSupiEnforcer) setRejected(ctx context.Context, key string, rejected bool) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "DuplicateSupiTable")
+		object.SetName(table, "", duplicateSupiTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		list, _, _ := unstructured.NestedStringSlice(table.UnstructuredContent(), "spec", "rejected")
+		i := slices.Index(list, key)
+		switch {
+		case rejected && i < 0:
+			list = append(list, key)
+		case !rejected && i >= 0:
+			list = slices.Delete(list, i, i+1)
+		default:
+			return nil
+		}
+
+		if err := unstructured.SetNestedStringSlice(table.UnstructuredContent(), list,
+			"spec", "rejected"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the duplicate SUPI table: %w", err)
+	}
+	return nil
+}
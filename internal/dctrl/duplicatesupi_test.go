@@ -0,0 +1,152 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Duplicate SUPIs", func() {
+	// both registrations resolve to the SUPI imsi-999010000000123
+	const suci = "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	start := func(policy dctrl.DuplicateSupiPolicy) {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:             opSpecs,
+			DuplicateSupiPolicy: policy,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %[2]s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name, suci)
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	// condition returns the status and the reason of a condition of a registration
+	condition := func(name, condType string) func() [2]string {
+		return func() [2]string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return [2]string{}
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, cd := range conds {
+				if cond, ok := cd.(map[string]any); ok && cond["type"] == condType {
+					status, _ := cond["status"].(string)
+					reason, _ := cond["reason"].(string)
+					return [2]string{status, reason}
+				}
+			}
+			return [2]string{}
+		}
+	}
+
+	ready := [2]string{"True", "RegistrationSuccessful"}
+
+	It("should reject the newer registration with the reject policy", func() {
+		start(dctrl.DuplicateSupiReject)
+
+		register("user-1")
+		Eventually(condition("user-1", "Ready"), timeout, interval).Should(Equal(ready))
+
+		register("user-2")
+		Eventually(condition("user-2", "Validated"), timeout, interval).
+			Should(Equal([2]string{"False", "SupiAlreadyRegistered"}))
+		Eventually(condition("user-2", "Ready"), timeout, interval).
+			Should(Equal([2]string{"False", "RegistrationFailed"}))
+
+		// the older UE stays registered
+		Consistently(condition("user-1", "Ready"), "500ms", interval).Should(Equal(ready))
+
+		// the rejection is cleared when the registration is deleted
+		reg := object.NewViewObject("amf", "Registration")
+		object.SetName(reg, "user-2", "user-2")
+		Expect(c.Delete(ctx, reg)).To(Succeed())
+		Eventually(func() []string {
+			table := object.NewViewObject("amf", "DuplicateSupiTable")
+			object.SetName(table, "", "duplicate-supis")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+				return nil
+			}
+			list, _, _ := unstructured.NestedStringSlice(table.UnstructuredContent(), "spec", "rejected")
+			return list
+		}, timeout, interval).Should(BeEmpty())
+	})
+
+	It("should implicitly deregister the older registration with the deregister policy", func() {
+		start(dctrl.DuplicateSupiDeregister)
+
+		register("user-1")
+		Eventually(condition("user-1", "Ready"), timeout, interval).Should(Equal(ready))
+
+		register("user-2")
+		Eventually(condition("user-2", "Ready"), timeout, interval).Should(Equal(ready))
+		Eventually(func() bool {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, "user-1", "user-1")
+			return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(reg), reg))
+		}, timeout, interval).Should(BeTrue())
+	})
+
+	It("should allow duplicate SUPIs by default", func() {
+		start("")
+
+		register("user-1")
+		register("user-2")
+		Eventually(condition("user-1", "Ready"), timeout, interval).Should(Equal(ready))
+		Eventually(condition("user-2", "Ready"), timeout, interval).Should(Equal(ready))
+	})
+
+	It("should reject an unknown policy", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:             opSpecs,
+			HTTPMode:            true,
+			DuplicateSupiPolicy: "ignore",
+		})
+		Expect(err).To(MatchError(ContainSubstring("unknown duplicate SUPI policy")))
+		cancel = func() {}
+	})
+})
@@ -0,0 +1,40 @@
+package dctrl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTooManyOperators is returned by New if the number of the operator specs exceeds the
+// MaxOperators option.
+var ErrTooManyOperators = errors.New("too many operators")
+
+// OperatorLoadError is returned by New if an operator cannot be loaded, e.g., because of a bad
+// operator spec file.
+type OperatorLoadError struct {
+	// Name is the name of the operator.
+	Name string
+	// File is the spec file of the operator, empty for the native operators.
+	File string
+	Err  error
+}
+
+func (e *OperatorLoadError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("unable to create operator %s: %v", strings.ToUpper(e.Name), e.Err)
+	}
+	return fmt.Sprintf("unable to create operator %q: %v", e.Name, e.Err)
+}
+
+func (e *OperatorLoadError) Unwrap() error { return e.Err }
+
+// APIServerInitError is returned by New if the embedded API server cannot be set up, e.g., because
+// of a missing or an invalid TLS key/cert.
+type APIServerInitError struct {
+	Err error
+}
+
+func (e *APIServerInitError) Error() string { return e.Err.Error() }
+
+func (e *APIServerInitError) Unwrap() error { return e.Err }
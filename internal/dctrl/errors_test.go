@@ -0,0 +1,61 @@
+package dctrl_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Init errors", func() {
+	It("should return an OperatorLoadError for a bad operator file", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		file := filepath.Join(GinkgoT().TempDir(), "bad.yaml")
+		Expect(os.WriteFile(file, []byte("controllers: [\n"), 0o600)).To(Succeed())
+
+		_, err = dctrl.New(dctrl.Options{
+			OpSpecs:     []dctrl.OpSpec{{Name: "bad", File: file}},
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			Logger:      logr.Discard(),
+		})
+		var opErr *dctrl.OperatorLoadError
+		Expect(errors.As(err, &opErr)).To(BeTrue())
+		Expect(opErr.Name).To(Equal("bad"))
+		Expect(opErr.File).To(Equal(file))
+		Expect(err.Error()).To(HavePrefix(`unable to create operator "bad": `))
+
+		var apiErr *dctrl.APIServerInitError
+		Expect(errors.As(err, &apiErr)).To(BeFalse())
+	})
+
+	It("should return an APIServerInitError for a missing certificate", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = dctrl.New(dctrl.Options{
+			OpSpecs:  opSpecs,
+			HTTPMode: true,
+			HTTPAuth: true,
+			KeyFile:  keyFile,
+			CertFile: filepath.Join(GinkgoT().TempDir(), "missing.crt"),
+			Logger:   logr.Discard(),
+		})
+		var apiErr *dctrl.APIServerInitError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(err.Error()).To(HavePrefix("failed to load public key: "))
+
+		var opErr *dctrl.OperatorLoadError
+		Expect(errors.As(err, &opErr)).To(BeFalse())
+	})
+})
@@ -0,0 +1,171 @@
+package dctrl
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+
+	"github.com/l7mp/dcontroller/pkg/controller"
+)
+
+const (
+	// errorChannelSize is the buffer of the error channel the operators write to and of the
+	// aggregate error stream.
+	errorChannelSize = 64
+	// operatorErrorChannelSize is the buffer of the per-operator error streams.
+	operatorErrorChannelSize = 16
+)
+
+// NativeControllerError is a reconcile error of a native controller, wrapped with the name of the
+// operator and the controller like the controller.Error of the declarative controllers.
+type NativeControllerError struct {
+	Operator, Controller string
+	Err                  error
+}
+
+func (e *NativeControllerError) Error() string {
+	return fmt.Sprintf("operator %s: controller %s: %v", e.Operator, e.Controller, e.Err)
+}
+
+func (e *NativeControllerError) Unwrap() error { return e.Err }
+
+// operatorErrors is the error stream of an operator.
+type operatorErrors struct {
+	ch      chan error
+	dropped atomic.Uint64
+}
+
+// errorDemux fans out the errors the operators write to the shared error channel to the aggregate
+// stream and to the stream of the operator reporting the error. A slow consumer never blocks the
+// operators: an error that does not fit into the buffer of a stream is dropped, counted and
+// logged. Each
+// error is classified as transient or fatal, and the fatal errors are passed to onFatal. The input
+// channel is closed only once all the operators writing to it returned.
+type errorDemux struct {
+	in, all   chan error
+	dropped   atomic.Uint64 // dropped from the aggregate stream
+	ops       map[string]*operatorErrors
+	producers sync.WaitGroup
+	classify  ErrorClassifier
+	onFatal   func(error)
+	log       logr.Logger
+}
+
+func newErrorDemux(names []string, log logr.Logger) *errorDemux {
+	e := &errorDemux{
+		in:       make(chan error, errorChannelSize),
+		all:      make(chan error, errorChannelSize),
+		ops:      map[string]*operatorErrors{},
+		classify: DefaultErrorClassifier,
+		log:      log,
+	}
+	for _, n := range names {
+		e.ops[n] = &operatorErrors{ch: make(chan error, operatorErrorChannelSize)}
+	}
+	return e
+}
+
+// run demultiplexes the errors until the input channel is closed, then closes the streams.
+func (e *errorDemux) run() {
+	defer func() {
+		close(e.all)
+		for _, s := range e.ops {
+			close(s.ch)
+		}
+	}()
+
+	for err := range e.in {
+		class := e.classify(err)
+		var operr controller.Error
+		var nativeErr *NativeControllerError
+		switch {
+		case errors.As(err, &operr):
+			e.log.Error(err, "controller error", "operator", operr.Operator,
+				"controller", operr.Controller, "class", class)
+			e.send(operr.Operator, err)
+		case errors.As(err, &nativeErr):
+			e.log.Error(err, "controller error", "operator", nativeErr.Operator,
+				"controller", nativeErr.Controller, "class", class)
+			e.send(nativeErr.Operator, err)
+		default:
+			e.log.Error(err, "error", "class", class)
+		}
+		if class == ErrorFatal && e.onFatal != nil {
+			e.onFatal(err)
+		}
+
+		select {
+		case e.all <- err:
+		default:
+			e.dropped.Add(1)
+			e.log.V(1).Info("aggregate error stream full, error dropped")
+		}
+	}
+}
+
+// send passes an error to the stream of an operator, if any.
+func (e *errorDemux) send(operator string, err error) {
+	s, ok := e.ops[operator]
+	if !ok {
+		return
+	}
+	select {
+	case s.ch <- err:
+	default:
+		s.dropped.Add(1)
+		e.log.V(1).Info("error stream full, error dropped", "operator", operator)
+	}
+}
+
+// report passes a reconcile error of a native controller of an operator to the demux.
+func (e *errorDemux) report(operator string) func(string, error) {
+	return func(controller string, err error) {
+		e.in <- &NativeControllerError{Operator: operator, Controller: controller, Err: err}
+	}
+}
+
+// addProducer registers an operator writing to the input channel. The returned function must be
+// called once the operator returned.
+func (e *errorDemux) addProducer() func() {
+	e.producers.Add(1)
+	return e.producers.Done
+}
+
+// close closes the input channel after all the producers returned, which stops run.
+func (e *errorDemux) close() {
+	e.producers.Wait()
+	close(e.in)
+}
+
+// GetErrorChannel returns the aggregate error stream of the operators. The stream is closed when
+// the control plane stops.
+func (d *Dctrl) GetErrorChannel() chan error { return d.errStream.all }
+
+// OperatorErrors returns the error stream of an operator, nil for an unknown operator. The streams
+// of the native operators carry the reconcile errors of their controllers as a
+// NativeControllerError. The stream is closed when the control plane stops.
+func (d *Dctrl) OperatorErrors(name string) <-chan error {
+	s, ok := d.errStream.ops[name]
+	if !ok {
+		return nil
+	}
+	return s.ch
+}
+
+// DroppedErrorCount returns the number of errors of an operator dropped because the consumer of
+// its error stream did not keep up. The errors dropped from the aggregate stream are counted by
+// DroppedAggregateErrorCount.
+func (d *Dctrl) DroppedErrorCount(name string) uint64 {
+	s, ok := d.errStream.ops[name]
+	if !ok {
+		return 0
+	}
+	return s.dropped.Load()
+}
+
+// DroppedAggregateErrorCount returns the number of errors dropped from the aggregate error stream
+// because its consumer did not keep up.
+func (d *Dctrl) DroppedAggregateErrorCount() uint64 { return d.errStream.dropped.Load() }
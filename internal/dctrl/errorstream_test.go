@@ -0,0 +1,219 @@
+package dctrl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/controller"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Operator error streams", func() {
+	var d *dctrl.Dctrl
+
+	BeforeEach(func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		// the logger must not render the errors: the message of a controller error cannot be
+		// set outside of the controller package
+		d, err = dctrl.New(dctrl.Options{
+			OpSpecs:     opSpecs,
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			Logger:      logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		dctrl.StartErrorStream(d)
+	})
+
+	// operator returns the operator reporting an error
+	operator := func(err error) string {
+		operr, ok := err.(controller.Error)
+		if !ok {
+			return ""
+		}
+		return operr.Operator
+	}
+
+	It("should demultiplex the errors by operator", func() {
+		dctrl.ReportError(d, controller.Error{Operator: "amf", Controller: "test"})
+		dctrl.ReportError(d, controller.Error{Operator: "smf", Controller: "test"})
+
+		Eventually(d.OperatorErrors("amf"), timeout, interval).
+			Should(Receive(WithTransform(operator, Equal("amf"))))
+		Eventually(d.OperatorErrors("smf"), timeout, interval).
+			Should(Receive(WithTransform(operator, Equal("smf"))))
+		Consistently(d.OperatorErrors("ausf"), "200ms", interval).ShouldNot(Receive())
+
+		// the aggregate stream gets all errors
+		Eventually(d.GetErrorChannel(), timeout, interval).Should(Receive())
+		Eventually(d.GetErrorChannel(), timeout, interval).Should(Receive())
+
+		Expect(d.OperatorErrors("unknown")).To(BeNil())
+	})
+
+	It("should deliver the errors of an operator while another one floods its stream", func() {
+		// nobody reads the stream of the AMF: the reports must not block
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				dctrl.ReportError(d, controller.Error{Operator: "amf", Controller: "flood"})
+			}
+			dctrl.ReportError(d, controller.Error{Operator: "smf", Controller: "test"})
+		}()
+		Eventually(done, timeout, interval).Should(BeClosed())
+
+		Eventually(d.OperatorErrors("smf"), timeout, interval).
+			Should(Receive(WithTransform(operator, Equal("smf"))))
+		Eventually(func() uint64 { return d.DroppedErrorCount("amf") }, timeout, interval).
+			Should(BeNumerically(">", 0))
+		Expect(d.DroppedErrorCount("smf")).To(BeZero())
+
+		// nobody reads the aggregate stream either
+		Eventually(d.DroppedAggregateErrorCount, timeout, interval).Should(BeNumerically(">", 0))
+	})
+
+	It("should demultiplex the errors of the native operators", func() {
+		dctrl.ReportError(d, &dctrl.NativeControllerError{Operator: "udm", Controller: "udm-controller",
+			Err: errors.New("config not generated")})
+
+		var err error
+		Eventually(d.OperatorErrors("udm"), timeout, interval).Should(Receive(&err))
+		var nativeErr *dctrl.NativeControllerError
+		Expect(errors.As(err, &nativeErr)).To(BeTrue())
+		Expect(nativeErr.Controller).To(Equal("udm-controller"))
+		Expect(err).To(MatchError(ContainSubstring("config not generated")))
+		Eventually(d.GetErrorChannel(), timeout, interval).Should(Receive())
+
+		// the CHF is not running
+		Expect(d.OperatorErrors("chf")).To(BeNil())
+	})
+})
+
+// Run with -race: the errors reported while the control plane shuts down must not be sent on a
+// closed channel.
+var _ = Describe("Error channel shutdown", func() {
+	It("should close the error channel only after the operators returned", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:       opSpecs,
+			HTTPMode:      true,
+			DisableAuth:   true,
+			KeyFile:       keyFile,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+			Logger:        logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		errCh := make(chan error, 1)
+		go func() { errCh <- d.Start(ctx) }()
+
+		// keep the operators reconciling
+		c := d.GetCache().GetClient()
+		for i := range 10 {
+			reg := object.New()
+			Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-%[1]d
+  namespace: user-%[1]d
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, i)), &reg)).To(Succeed())
+			Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+		}
+
+		// an operator reporting errors past the cancellation of the control plane
+		done := dctrl.AddErrorProducer(d)
+		stopped := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer done()
+			defer close(stopped)
+			for i := 0; ; i++ {
+				dctrl.ReportError(d, controller.Error{Operator: "amf", Controller: "shutdown"})
+				if ctx.Err() != nil && i > 1000 {
+					return
+				}
+			}
+		}()
+
+		cancel()
+		Eventually(errCh, timeout, interval).Should(Receive())
+		Expect(stopped).To(BeClosed())
+		Eventually(d.GetErrorChannel(), timeout, interval).Should(BeClosed())
+	})
+})
+
+var _ = Describe("Fatal operator errors", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		errCh  chan error
+	)
+
+	BeforeEach(func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		d, err = dctrl.New(dctrl.Options{
+			OpSpecs:       opSpecs,
+			HTTPMode:      true,
+			DisableAuth:   true,
+			KeyFile:       keyFile,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+			Logger:        logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel = context.WithCancel(context.Background())
+		errCh = make(chan error, 1)
+		go func() { errCh <- d.Start(ctx) }()
+		Eventually(d.Ready, timeout, interval).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should keep running on a transient error", func() {
+		dctrl.ReportError(d, controller.Error{Operator: "amf", Controller: "test"})
+		Consistently(errCh, "500ms", interval).ShouldNot(Receive())
+		Expect(d.Ready()).To(BeTrue())
+	})
+
+	It("should shut down gracefully on a fatal error", func() {
+		dctrl.ReportError(d, fmt.Errorf("cache corrupted: %w", dctrl.ErrFatal))
+
+		var err error
+		Eventually(errCh, 2*timeout, interval).Should(Receive(&err))
+		var fatal *dctrl.FatalOperatorError
+		Expect(errors.As(err, &fatal)).To(BeTrue())
+		Expect(fatal.Err).To(MatchError(dctrl.ErrFatal))
+		Eventually(d.GetErrorChannel(), timeout, interval).Should(BeClosed())
+	})
+})
@@ -0,0 +1,244 @@
+package dctrl
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// eventBufferSize is the number of lifecycle events buffered before new events are dropped, and
+// the default queue size of the subscribers.
+const eventBufferSize = 64
+
+// defaultBlockTimeout is the default time an event waits for a full BlockWithTimeout queue.
+const defaultBlockTimeout = 100 * time.Millisecond
+
+// EventType is the type of a lifecycle event.
+type EventType string
+
+const (
+	// OperatorStarted is emitted when an operator is started.
+	OperatorStarted EventType = "OperatorStarted"
+	// OperatorFailed is emitted when an operator exits with an error.
+	OperatorFailed EventType = "OperatorFailed"
+	// OperatorStopped is emitted when an operator has shut down.
+	OperatorStopped EventType = "OperatorStopped"
+	// CacheSynced is emitted once the shared view cache has synced.
+	CacheSynced EventType = "CacheSynced"
+	// LeaderAcquired is emitted when the manager of an operator has been elected leader.
+	LeaderAcquired EventType = "LeaderAcquired"
+)
+
+// Event is a high-level lifecycle event.
+type Event struct {
+	Type EventType
+	// Operator is the name of the operator the event relates to, empty for CacheSynced.
+	Operator string
+	// Err is the error for OperatorFailed events.
+	Err  error
+	Time time.Time
+}
+
+// QueuePolicy decides what happens to an event when the queue of a subscriber is full.
+type QueuePolicy string
+
+const (
+	// DropOldest drops the oldest queued event to make room for the new one.
+	DropOldest QueuePolicy = "DropOldest"
+	// BlockWithTimeout waits for room in the queue and drops the new event on timeout. A slow
+	// subscriber delays the delivery to the other subscribers.
+	BlockWithTimeout QueuePolicy = "BlockWithTimeout"
+)
+
+// SubscriberOptions configure the queue of an event subscriber.
+type SubscriberOptions struct {
+	// Name identifies the subscriber in the dctrl5g_event_bus_dropped_total metric.
+	Name string
+	// QueueSize is the capacity of the queue (default: 64).
+	QueueSize int
+	// Policy is the policy applied when the queue is full (default: DropOldest).
+	Policy QueuePolicy
+	// BlockTimeout is the wait time of the BlockWithTimeout policy (default: 100ms).
+	BlockTimeout time.Duration
+}
+
+// eventBus fans out the lifecycle events to the subscribers, each with a bounded queue. Events
+// are buffered while there are no subscribers, as long as the buffer does not fill up.
+type eventBus struct {
+	in      chan Event
+	dropped atomic.Uint64
+	mu      sync.Mutex
+	subs    map[*subscriber]bool
+	stop    chan struct{} // stops the running dispatcher
+	done    chan struct{} // closed when the last dispatcher has exited
+	log     logr.Logger
+}
+
+func newEventBus(logger logr.Logger) *eventBus {
+	done := make(chan struct{})
+	close(done)
+	return &eventBus{
+		in:   make(chan Event, eventBufferSize),
+		subs: map[*subscriber]bool{},
+		done: done,
+		log:  logger,
+	}
+}
+
+// emit queues an event without blocking, dropping it if the buffer is full.
+func (b *eventBus) emit(e Event) {
+	select {
+	case b.in <- e:
+	default:
+		b.dropped.Add(1)
+		b.log.V(2).Info("dropping lifecycle event", "type", e.Type, "operator", e.Operator)
+	}
+}
+
+// subscribe registers a subscriber until the context is cancelled. The dispatcher runs as long
+// as there is at least one subscriber.
+func (b *eventBus) subscribe(ctx context.Context, opts SubscriberOptions) <-chan Event {
+	s := newSubscriber(opts)
+
+	b.mu.Lock()
+	b.subs[s] = true
+	if len(b.subs) == 1 {
+		prev := b.done
+		b.stop, b.done = make(chan struct{}), make(chan struct{})
+		go b.dispatch(prev, b.stop, b.done)
+	}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subs, s)
+		if len(b.subs) == 0 {
+			close(b.stop)
+		}
+		b.mu.Unlock()
+		s.close()
+	}()
+
+	return s.ch
+}
+
+// subscribers returns the number of active subscribers.
+func (b *eventBus) subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+func (b *eventBus) dispatch(prev, stop, done chan struct{}) {
+	defer close(done)
+	// keep the event order across restarts
+	<-prev
+
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-b.in:
+			b.mu.Lock()
+			subs := make([]*subscriber, 0, len(b.subs))
+			for s := range b.subs {
+				subs = append(subs, s)
+			}
+			b.mu.Unlock()
+
+			for _, s := range subs {
+				s.deliver(e)
+			}
+		}
+	}
+}
+
+// subscriber is a bounded event queue.
+type subscriber struct {
+	opts   SubscriberOptions
+	ch     chan Event
+	mu     sync.Mutex
+	closed bool
+}
+
+func newSubscriber(opts SubscriberOptions) *subscriber {
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = eventBufferSize
+	}
+	if opts.Policy == "" {
+		opts.Policy = DropOldest
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = defaultBlockTimeout
+	}
+	return &subscriber{opts: opts, ch: make(chan Event, opts.QueueSize)}
+}
+
+func (s *subscriber) deliver(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	switch s.opts.Policy {
+	case BlockWithTimeout:
+		timer := time.NewTimer(s.opts.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case s.ch <- e:
+		case <-timer.C:
+			metrics.DroppedEvents.WithLabelValues(s.opts.Name).Inc()
+		}
+	default:
+		for {
+			select {
+			case s.ch <- e:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				metrics.DroppedEvents.WithLabelValues(s.opts.Name).Inc()
+			default:
+			}
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.ch)
+}
+
+// emit queues a lifecycle event.
+func (d *Dctrl) emit(t EventType, operator string, err error) {
+	d.bus.emit(Event{Type: t, Operator: operator, Err: err, Time: time.Now()})
+}
+
+// Subscribe returns a stream of lifecycle events with a bounded queue, closed when the context
+// is cancelled. Events are buffered from the creation of the Dctrl, so the first subscriber
+// receives the events emitted before it subscribed as long as the buffer does not fill up.
+func (d *Dctrl) Subscribe(ctx context.Context, opts SubscriberOptions) <-chan Event {
+	return d.bus.subscribe(ctx, opts)
+}
+
+// Events returns a stream of lifecycle events with the default queue settings.
+func (d *Dctrl) Events(ctx context.Context) <-chan Event {
+	return d.Subscribe(ctx, SubscriberOptions{})
+}
+
+// DroppedEvents returns the number of lifecycle events dropped due to a full buffer before
+// reaching the subscribers.
+func (d *Dctrl) DroppedEvents() uint64 { return d.bus.dropped.Load() }
@@ -0,0 +1,162 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Lifecycle events", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should emit an OperatorStarted event for each operator", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		events := d.Events(ctx)
+		started := map[string]bool{}
+		want := len(opSpecs) + 1 // UDM is loaded manually
+		Eventually(func() int {
+			for {
+				select {
+				case e := <-events:
+					if e.Type == dctrl.OperatorStarted {
+						started[e.Operator] = true
+					}
+				default:
+					return len(started)
+				}
+			}
+		}, timeout, interval).Should(Equal(want))
+
+		for _, spec := range opSpecs {
+			Expect(started).To(HaveKey(spec.Name))
+		}
+		Expect(started).To(HaveKey("udm"))
+		Expect(d.DroppedEvents()).To(BeZero())
+	})
+})
+
+var _ = Describe("Event bus backpressure", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+
+		// an idle Dctrl: no lifecycle events are emitted until it is started
+		dir := GinkgoT().TempDir()
+		keyFile, certFile := filepath.Join(dir, "apiserver.key"), filepath.Join(dir, "apiserver.crt")
+		cert, key, err := auth.GenerateSelfSignedCertWithSANs([]string{"localhost"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.WriteCertAndKey(keyFile, certFile, key, cert)).To(Succeed())
+
+		d, err = dctrl.New(dctrl.Options{
+			OpSpecs:     opSpecs,
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			Logger:      logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	dropped := func(name string) func() float64 {
+		return func() float64 { return testutil.ToFloat64(metrics.DroppedEvents.WithLabelValues(name)) }
+	}
+
+	emit := func(from, to int) {
+		for i := from; i < to; i++ {
+			dctrl.Emit(d, dctrl.OperatorStarted, fmt.Sprintf("op-%d", i))
+		}
+	}
+
+	It("should drop the oldest events for a slow subscriber", func() {
+		base := dropped("slow-drop")()
+		events := d.Subscribe(ctx, dctrl.SubscriberOptions{
+			Name:      "slow-drop",
+			QueueSize: 2,
+			Policy:    dctrl.DropOldest,
+		})
+
+		emit(0, 10)
+		Eventually(dropped("slow-drop"), timeout, interval).Should(BeNumerically("==", base+8))
+
+		// the newest events are kept
+		Expect((<-events).Operator).To(Equal("op-8"))
+		Expect((<-events).Operator).To(Equal("op-9"))
+		Consistently(events, 3*interval, interval).ShouldNot(Receive())
+	})
+
+	It("should block for a slow subscriber and drop on timeout", func() {
+		base := dropped("slow-block")()
+		events := d.Subscribe(ctx, dctrl.SubscriberOptions{
+			Name:         "slow-block",
+			QueueSize:    1,
+			Policy:       dctrl.BlockWithTimeout,
+			BlockTimeout: 200 * time.Millisecond,
+		})
+
+		// op-0 is queued, op-1 and op-2 time out
+		emit(0, 3)
+		Eventually(dropped("slow-block"), timeout, interval).Should(BeNumerically("==", base+2))
+		Expect((<-events).Operator).To(Equal("op-0"))
+
+		// a blocked event is delivered once the subscriber catches up
+		emit(3, 5)
+		Eventually(events, timeout).Should(Receive(HaveField("Operator", "op-3")))
+		Eventually(events, timeout).Should(Receive(HaveField("Operator", "op-4")))
+		Expect(dropped("slow-block")()).To(BeNumerically("==", base+2))
+	})
+
+	It("should release the subscribers when their context is cancelled", func() {
+		subCtx, subCancel := context.WithCancel(ctx)
+		events := d.Subscribe(subCtx, dctrl.SubscriberOptions{Name: "released", QueueSize: 1})
+		emit(0, 3)
+		Expect(dctrl.Subscribers(d)).To(Equal(1))
+
+		subCancel()
+		Eventually(func() int { return dctrl.Subscribers(d) }, timeout, interval).Should(BeZero())
+		Eventually(func() bool {
+			// drain the queued events
+			_, ok := <-events
+			return !ok
+		}, timeout, interval).Should(BeTrue())
+
+		// the events emitted without subscribers are buffered for the next one
+		emit(3, 4)
+		events = d.Subscribe(ctx, dctrl.SubscriberOptions{Name: "next"})
+		Eventually(events, timeout).Should(Receive(HaveField("Operator", "op-3")))
+	})
+})
@@ -0,0 +1,200 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// registrationReaper garbage-collects the registrations of the UEs that have gone silent. A UE
+// refreshes its registration by creating or updating an amf/Heartbeat with the name and the
+// namespace of the registration; a registration not refreshed within the expiry since the last
+// heartbeat, or since the registration was first seen, is deleted, which deletes the linked AUSF
+// MobileIdentity and UDM Config too. The time of the last heartbeat is stamped on the RegState,
+// from where the AMF copies it into the status of the registration:
+//
+//	status:
+//	  expiry:
+//	    timeout: 1h0m0s
+//	    lastSeenTime: "2025-01-01T00:00:00.000000000Z"
+type registrationReaper struct {
+	client   client.Client
+	expiry   time.Duration
+	mu       sync.Mutex
+	lastSeen map[client.ObjectKey]time.Time
+	log      logr.Logger
+}
+
+// registrationReaperOptions configures the registration reaper.
+type registrationReaperOptions struct {
+	Client client.Client
+	// Expiry is the time without a heartbeat after which a registration expires, no reaper is
+	// created if not positive
+	Expiry time.Duration
+	Logger logr.Logger
+}
+
+// newRegistrationReaperHooks creates the registration reaper and returns it with the hook adding
+// its heartbeat handler to the AMF. Returns nil if the registrations do not expire.
+func newRegistrationReaperHooks(o registrationReaperOptions) (*registrationReaper, []operatorHook) {
+	if o.Expiry <= 0 {
+		return nil, nil
+	}
+	r := newRegistrationReaper(o.Client, o.Expiry, o.Logger)
+	return r, []operatorHook{{
+		view: amfView,
+		what: "create the heartbeat handler",
+		add:  func(op *trackedOperator, _ string) error { return r.addController(op) },
+	}}
+}
+
+func newRegistrationReaper(c client.Client, expiry time.Duration, logger logr.Logger) *registrationReaper {
+	return &registrationReaper{
+		client:   c,
+		expiry:   expiry,
+		lastSeen: map[client.ObjectKey]time.Time{},
+		log:      logger.WithName("registration-reaper"),
+	}
+}
+
+// addController adds the heartbeat handler to the AMF operator.
+func (r *registrationReaper) addController(op *trackedOperator) error {
+	return addWatchController(op, "amf", "heartbeat-handler", "Heartbeat", r)
+}
+
+// Reconcile refreshes the registration of a heartbeat.
+func (r *registrationReaper) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	key := client.ObjectKeyFromObject(req.Object)
+	now := time.Now().UTC()
+	r.mu.Lock()
+	r.lastSeen[key] = now
+	r.mu.Unlock()
+	r.log.V(2).Info("heartbeat", "registration", key.String())
+
+	return reconcile.Result{}, r.stamp(ctx, key, now)
+}
+
+// Start runs the expiry checks until the context is cancelled.
+func (r *registrationReaper) Start(ctx context.Context) {
+	ticker := time.NewTicker(max(r.expiry/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.check(ctx); err != nil {
+				r.log.Error(err, "failed to check registration expiry")
+			}
+		}
+	}
+}
+
+func (r *registrationReaper) check(ctx context.Context) error {
+	list := cache.NewViewObjectList("amf", "Registration")
+	if err := r.client.List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list registrations: %w", err)
+	}
+	states := cache.NewViewObjectList("amf", "RegState")
+	if err := r.client.List(ctx, states); err != nil {
+		return fmt.Errorf("failed to list registration states: %w", err)
+	}
+	stamped := map[client.ObjectKey]string{}
+	for i := range states.Items {
+		s, _, _ := unstructured.NestedString(states.Items[i].UnstructuredContent(),
+			"status", "expiry", "lastSeenTime")
+		stamped[client.ObjectKeyFromObject(&states.Items[i])] = s
+	}
+
+	now := time.Now().UTC()
+	r.mu.Lock()
+	seen := map[client.ObjectKey]time.Time{}
+	for i := range list.Items {
+		key := client.ObjectKeyFromObject(&list.Items[i])
+		last, ok := r.lastSeen[key]
+		if !ok {
+			last = now
+		}
+		seen[key] = last
+	}
+	r.lastSeen = seen
+	r.mu.Unlock()
+
+	for key, last := range seen {
+		if now.Sub(last) >= r.expiry {
+			r.log.Info("registration expired", "registration", key.String(), "expiry", r.expiry,
+				"last-seen", last)
+			if err := r.reap(ctx, key); err != nil {
+				r.log.Error(err, "failed to delete registration", "registration", key.String())
+			}
+			continue
+		}
+
+		// restore the stamp dropped by the AMF
+		if s, ok := stamped[key]; ok && s != last.Format(time.RFC3339Nano) {
+			if err := r.stamp(ctx, key, last); err != nil {
+				r.log.Error(err, "failed to update registration", "registration", key.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// stamp writes the time of the last heartbeat into the status of a RegState.
+func (r *registrationReaper) stamp(ctx context.Context, key client.ObjectKey, lastSeen time.Time) error {
+	expiry := map[string]any{
+		"timeout":      r.expiry.String(),
+		"lastSeenTime": lastSeen.Format(time.RFC3339Nano),
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		reg := object.NewViewObject("amf", "RegState")
+		if err := r.client.Get(ctx, key, reg); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedMap(reg.UnstructuredContent(), expiry, "status", "expiry"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, reg)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update registration %s: %w", key, err)
+	}
+	return nil
+}
+
+// reap deletes an expired registration and its heartbeat.
+func (r *registrationReaper) reap(ctx context.Context, key client.ObjectKey) error {
+	for _, kind := range []string{"Registration", "Heartbeat"} {
+		obj := object.NewViewObject("amf", kind)
+		object.SetName(obj, key.Namespace, key.Name)
+		if err := r.client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.lastSeen, key)
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,127 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Registration expiry", func() {
+	const expiry = time.Second
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:            opSpecs,
+			RegistrationExpiry: expiry,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name)
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	exists := func(op, kind, namespace, name string) func() bool {
+		return func() bool {
+			obj := object.NewViewObject(op, kind)
+			object.SetName(obj, namespace, name)
+			return !apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(obj), obj))
+		}
+	}
+
+	// heartbeat refreshes the registration of a UE until the context is cancelled
+	heartbeat := func(ctx context.Context, name string) {
+		defer GinkgoRecover()
+		hb := object.NewViewObject("amf", "Heartbeat")
+		object.SetName(hb, name, name)
+		Expect(testsuite.CreateWithRetry(ctx, c, hb)).To(Succeed())
+		for seq := int64(1); ; seq++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(expiry / 5):
+			}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(hb), hb); err != nil {
+				continue
+			}
+			_ = unstructured.SetNestedField(hb.UnstructuredContent(), seq, "spec", "sequence")
+			_ = c.Update(ctx, hb)
+		}
+	}
+
+	It("should reap a silent registration and keep a refreshed one", func() {
+		register("user-1")
+		register("user-2")
+		Eventually(exists("ausf", "MobileIdentity", "user-1", "user-1"), timeout, interval).Should(BeTrue())
+		Eventually(exists("ausf", "MobileIdentity", "user-2", "user-2"), timeout, interval).Should(BeTrue())
+
+		hbCtx, hbCancel := context.WithCancel(ctx)
+		defer hbCancel()
+		go heartbeat(hbCtx, "user-2")
+
+		// the silent registration and its linked resources are deleted
+		Eventually(exists("amf", "Registration", "user-1", "user-1"), 3*expiry, interval).Should(BeFalse())
+		Eventually(exists("amf", "RegState", "user-1", "user-1"), timeout, interval).Should(BeFalse())
+		Eventually(exists("ausf", "MobileIdentity", "user-1", "user-1"), timeout, interval).Should(BeFalse())
+
+		// the refreshed registration survives and reports its last heartbeat
+		Consistently(exists("amf", "Registration", "user-2", "user-2"), 2*expiry, interval).Should(BeTrue())
+		Eventually(func() string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, "user-2", "user-2")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return ""
+			}
+			t, _, _ := unstructured.NestedString(reg.UnstructuredContent(), "status", "expiry", "lastSeenTime")
+			return t
+		}, timeout, interval).ShouldNot(BeEmpty())
+
+		// the registration is reaped once the heartbeats stop
+		hbCancel()
+		Eventually(exists("amf", "Registration", "user-2", "user-2"), 3*expiry, interval).Should(BeFalse())
+		Eventually(exists("ausf", "MobileIdentity", "user-2", "user-2"), timeout, interval).Should(BeFalse())
+	})
+})
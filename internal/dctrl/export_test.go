@@ -0,0 +1,65 @@
+package dctrl
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// SetCacheStarter overrides the function that starts the shared cache.
+func SetCacheStarter(d *Dctrl, start func(ctx context.Context) error) { d.startCache = start }
+
+// Emit injects a lifecycle event.
+func Emit(d *Dctrl, t EventType, operator string) { d.emit(t, operator, nil) }
+
+// Subscribers returns the number of active event subscribers.
+func Subscribers(d *Dctrl) int { return d.bus.subscribers() }
+
+// NewConditionObserver creates a condition observer for a kind of an operator.
+func NewConditionObserver(opName, kind string, logger logr.Logger) reconcile.TypedReconciler[reconciler.Request] {
+	return newConditionObserver(opName, kind, logger)
+}
+
+// HealthProbeHandler returns the handler of the health probe server.
+func HealthProbeHandler(d *Dctrl) http.Handler { return d.healthProbeHandler() }
+
+// StartErrorStream starts demultiplexing the errors without starting the control plane.
+func StartErrorStream(d *Dctrl) { go d.errStream.run() }
+
+// ReportError injects an error as if reported by an operator.
+func ReportError(d *Dctrl, err error) { d.errStream.in <- err }
+
+// AddErrorProducer registers a producer writing to the error channel of the operators as if it
+// were a running operator, and returns the function to call once it returned.
+func AddErrorProducer(d *Dctrl) func() { return d.errStream.addProducer() }
+
+// SetPolicyClock sets the clock the policy rules take the hour of the day from, and re-evaluates
+// the rules.
+func SetPolicyClock(ctx context.Context, d *Dctrl, now func() time.Time) error {
+	d.policies.mu.Lock()
+	d.policies.now = now
+	d.policies.mu.Unlock()
+	return d.policies.evaluate(ctx)
+}
+
+// GutiAllocated returns whether the default GUTI allocator holds a GUTI allocated.
+func GutiAllocated(a GutiAllocator, guti string) bool {
+	r, ok := a.(*randomGutiAllocator)
+	if !ok {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.allocated[guti]
+}
+
+// NewRegistrationDeduper creates the client coalescing the identical concurrent registrations.
+func NewRegistrationDeduper(c client.Client, window time.Duration) client.Client {
+	return newRegistrationDeduper(c, window, logr.Discard())
+}
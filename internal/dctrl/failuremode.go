@@ -0,0 +1,122 @@
+package dctrl
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/go-logr/logr"
+
+	"github.com/l7mp/dcontroller/pkg/operator"
+)
+
+// FailureMode is the way an operator that fails to load at startup, e.g., because of a malformed
+// spec file, is handled.
+type FailureMode string
+
+const (
+	// FailFast fails New with an OperatorLoadError (default).
+	FailFast FailureMode = "FailFast"
+	// BestEffort logs the failure and skips the operator, together with the operators requiring
+	// it, and starts the rest of the control plane. The skipped operators are reported by
+	// Dctrl.FailedOperators.
+	BestEffort FailureMode = "BestEffort"
+)
+
+func checkFailureMode(m FailureMode) error {
+	switch m {
+	case "", FailFast, BestEffort:
+		return nil
+	default:
+		return fmt.Errorf("unknown failure mode %q", m)
+	}
+}
+
+// requirementOrder returns the specs so that each follows the operators it requires, otherwise
+// in the declaration order, so that an operator is built after the operators it cannot work
+// without have been found loadable.
+func requirementOrder(specs []OpSpec) ([]OpSpec, error) {
+	names, reqs := []string{}, map[string][]string{}
+	byName := map[string]OpSpec{}
+	for _, s := range specs {
+		names = append(names, s.Name)
+		byName[s.Name] = s
+	}
+	for _, s := range specs {
+		// the native operators are always loaded
+		reqs[s.Name] = slices.DeleteFunc(slices.Clone(s.Requires), func(r string) bool {
+			_, ok := byName[r]
+			return !ok
+		})
+	}
+	order, err := startupOrder(names, reqs)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]OpSpec, 0, len(order))
+	for _, n := range order {
+		ret = append(ret, byName[n])
+	}
+	return ret, nil
+}
+
+// failedRequirement returns an error if an operator requires a failed operator.
+func failedRequirement(spec OpSpec, failed map[string]error) error {
+	for _, r := range spec.Requires {
+		if _, ok := failed[r]; ok {
+			return &OperatorLoadError{Name: spec.Name, File: spec.File,
+				Err: fmt.Errorf("required operator %q failed to load", r)}
+		}
+	}
+	return nil
+}
+
+// buildOperators builds the declarative operators and returns them, with their specs, by name. In
+// the BestEffort failure mode the operators that fail to load, or require one that failed, are
+// skipped and added to failed.
+func buildOperators(opSpecs []OpSpec, mode FailureMode, build func(OpSpec) (*operator.Operator, error), failed map[string]error, log logr.Logger) (map[string]*operator.Operator, map[string]OpSpec, error) {
+	ops := map[string]*operator.Operator{}
+	specs := map[string]OpSpec{}
+	buildSpecs := opSpecs
+	if mode == BestEffort {
+		// build the required operators first, so that the operators requiring a failed one
+		// are skipped before being built
+		var err error
+		if buildSpecs, err = requirementOrder(opSpecs); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, opSpec := range buildSpecs {
+		if mode == BestEffort {
+			if _, ok := failed[opSpec.Name]; ok {
+				continue
+			}
+			if err := failedRequirement(opSpec, failed); err != nil {
+				log.Error(err, "skipping operator", "operator", opSpec.Name)
+				failed[opSpec.Name] = err
+				continue
+			}
+		}
+
+		op, err := build(opSpec)
+		if err != nil {
+			var loadErr *OperatorLoadError
+			if mode != BestEffort || !errors.As(err, &loadErr) {
+				return nil, nil, err
+			}
+			log.Error(err, "skipping operator", "operator", opSpec.Name)
+			failed[opSpec.Name] = err
+			continue
+		}
+		ops[opSpec.Name] = op
+		specs[opSpec.Name] = opSpec
+	}
+	return ops, specs, nil
+}
+
+// FailedOperators returns the operators skipped at startup in the BestEffort failure mode, with
+// the reason of the failure. Empty in the FailFast mode.
+func (d *Dctrl) FailedOperators() map[string]error {
+	return maps.Clone(d.failedOps)
+}
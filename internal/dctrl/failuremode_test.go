@@ -0,0 +1,120 @@
+package dctrl_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Failure mode", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		specs  []dctrl.OpSpec
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+
+		// the PCF spec is malformed, and the SMF requires the PCF
+		bad := filepath.Join(GinkgoT().TempDir(), "pcf.yaml")
+		Expect(os.WriteFile(bad, []byte("controllers: [\n"), 0o600)).To(Succeed())
+		specs = []dctrl.OpSpec{
+			{Name: "amf", File: "../operators/amf.yaml", DependsOn: []string{"ausf", "smf"},
+				Requires: []string{"ausf"}},
+			{Name: "ausf", File: "../operators/ausf.yaml"},
+			{Name: "smf", File: "../operators/smf.yaml", DependsOn: []string{"pcf", "upf"},
+				Requires: []string{"pcf", "upf"}},
+			{Name: "pcf", File: bad},
+			{Name: "upf", File: "../operators/upf.yaml"},
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should fail the startup on a bad operator spec by default", func() {
+		_, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: specs}, loglevel)
+		var opErr *dctrl.OperatorLoadError
+		Expect(errors.As(err, &opErr)).To(BeTrue())
+		Expect(opErr.Name).To(Equal("pcf"))
+	})
+
+	It("should skip the bad operator and start the others in the BestEffort mode", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     specs,
+			FailureMode: dctrl.BestEffort,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the PCF and the SMF requiring it are skipped
+		failed := d.FailedOperators()
+		Expect(failed).To(HaveLen(2))
+		var opErr *dctrl.OperatorLoadError
+		Expect(errors.As(failed["pcf"], &opErr)).To(BeTrue())
+		Expect(opErr.File).To(HaveSuffix("pcf.yaml"))
+		Expect(failed["smf"]).To(MatchError(ContainSubstring(`required operator "pcf" failed to load`)))
+		for _, name := range []string{"pcf", "smf"} {
+			Expect(d.GetOperator(name)).To(BeNil())
+		}
+		for _, name := range []string{"amf", "ausf", "upf", "udm"} {
+			Expect(d.GetOperator(name)).NotTo(BeNil())
+		}
+
+		// the registrations still complete
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`), &reg)).To(Succeed())
+		c := d.GetCache().GetClient()
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+		Eventually(func() string {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return ""
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, cd := range conds {
+				if cond, ok := cd.(map[string]any); ok && cond["type"] == "Ready" {
+					status, _ := cond["status"].(string)
+					return status
+				}
+			}
+			return ""
+		}, timeout, interval).Should(Equal("True"))
+	})
+
+	It("should reject an unknown failure mode", func() {
+		_, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			FailureMode: "Ignore",
+		}, loglevel)
+		Expect(err).To(MatchError(ContainSubstring(`unknown failure mode "Ignore"`)))
+	})
+})
@@ -0,0 +1,104 @@
+package dctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFatal marks the errors of the operators that the control plane cannot recover from, e.g., a
+// corrupted cache. Wrap it to report a fatal error: fmt.Errorf("...: %w", dctrl.ErrFatal).
+var ErrFatal = errors.New("fatal error")
+
+// ErrorClass is the class of an error reported by an operator.
+type ErrorClass string
+
+const (
+	// ErrorTransient is an error that is logged only, the control plane keeps running.
+	ErrorTransient ErrorClass = "transient"
+	// ErrorFatal is an error that is handled according to the FatalErrorPolicy.
+	ErrorFatal ErrorClass = "fatal"
+)
+
+// ErrorClassifier classifies the errors reported by the operators. The errors of the declarative
+// controllers are of type controller.Error, carrying the name of the operator and the controller.
+type ErrorClassifier func(err error) ErrorClass
+
+// DefaultErrorClassifier classifies the errors wrapping ErrFatal as fatal, and all the other
+// errors as transient.
+func DefaultErrorClassifier(err error) ErrorClass {
+	if errors.Is(err, ErrFatal) {
+		return ErrorFatal
+	}
+	return ErrorTransient
+}
+
+// FatalErrorPolicy is the way a fatal error of an operator is handled.
+type FatalErrorPolicy string
+
+const (
+	// FatalErrorShutdown gracefully stops the control plane, and Start returns a
+	// FatalOperatorError (default).
+	FatalErrorShutdown FatalErrorPolicy = "shutdown"
+	// FatalErrorContinue logs the fatal errors like the transient ones.
+	FatalErrorContinue FatalErrorPolicy = "continue"
+)
+
+// fatalShutdownTimeout bounds the drain of the work queues on a shutdown triggered by a fatal
+// error, since the failing controller may keep requeueing.
+const fatalShutdownTimeout = 30 * time.Second
+
+// FatalOperatorError is returned by Start if the control plane was stopped on a fatal error of an
+// operator.
+type FatalOperatorError struct {
+	Err error
+}
+
+func (e *FatalOperatorError) Error() string { return fmt.Sprintf("fatal operator error: %v", e.Err) }
+
+func (e *FatalOperatorError) Unwrap() error { return e.Err }
+
+func checkFatalErrorPolicy(p FatalErrorPolicy) error {
+	switch p {
+	case "", FatalErrorShutdown, FatalErrorContinue:
+		return nil
+	default:
+		return fmt.Errorf("unknown fatal error policy %q", p)
+	}
+}
+
+// onFatalError handles a fatal error of an operator: unless the policy says to continue, the
+// first fatal error triggers a graceful shutdown. Must not block the error stream.
+func (d *Dctrl) onFatalError(err error) {
+	if d.fatalErrorPolicy == FatalErrorContinue {
+		return
+	}
+
+	d.mu.Lock()
+	if d.fatalErr != nil {
+		d.mu.Unlock()
+		return
+	}
+	d.fatalErr = &FatalOperatorError{Err: err}
+	d.mu.Unlock()
+
+	d.log.Info("fatal operator error, shutting down")
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fatalShutdownTimeout)
+		defer cancel()
+		if err := d.Stop(ctx); err != nil {
+			d.log.Error(err, "shutdown on fatal error")
+		}
+	}()
+}
+
+// fatalError returns the fatal error the control plane was stopped on, if any.
+func (d *Dctrl) fatalError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fatalErr == nil {
+		return nil
+	}
+	return d.fatalErr
+}
@@ -0,0 +1,166 @@
+package dctrl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// QoSFlow is a named QoS flow of a session.
+type QoSFlow struct {
+	Name   string `json:"name"`
+	FiveQI string `json:"fiveQI"`
+}
+
+// SessionFlows are the QoS flows of a session.
+type SessionFlows struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Flows     []QoSFlow `json:"flows"`
+}
+
+// flowIndex indexes the AMF:Sessions by the names and the 5QIs of their QoS flows, so that the
+// sessions carrying a given flow can be listed without scanning all the sessions, and maintains
+// the number of the sessions per 5QI.
+type flowIndex struct {
+	mu       sync.Mutex
+	sessions map[client.ObjectKey][]QoSFlow
+	byFlow   map[string]map[client.ObjectKey]bool
+	byFiveQI map[string]map[client.ObjectKey]bool
+}
+
+// hooks returns the hook adding the index to the AMF, which owns the sessions.
+func (x *flowIndex) hooks() []operatorHook {
+	return []operatorHook{{
+		view: amfView,
+		what: "create the session flow index",
+		add: func(op *trackedOperator, opName string) error {
+			return addWatchController(op, opName, "session-flow-index", "Session", x)
+		},
+	}}
+}
+
+func newFlowIndex() *flowIndex {
+	return &flowIndex{
+		sessions: map[client.ObjectKey][]QoSFlow{},
+		byFlow:   map[string]map[client.ObjectKey]bool{},
+		byFiveQI: map[string]map[client.ObjectKey]bool{},
+	}
+}
+
+func (x *flowIndex) Reconcile(_ context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+	var flows []QoSFlow
+	if req.EventType != object.Deleted {
+		specs, _, _ := unstructured.NestedSlice(req.Object.UnstructuredContent(), "spec", "qos", "flows")
+		for _, s := range specs {
+			f, ok := s.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _ := f["name"].(string)
+			flow := QoSFlow{Name: name}
+			if q, ok := f["fiveQI"]; ok && q != nil {
+				flow.FiveQI = fmt.Sprint(q)
+			}
+			flows = append(flows, flow)
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, f := range x.sessions[key] {
+		unindex(x.byFlow, f.Name, key)
+		unindex(x.byFiveQI, f.FiveQI, key)
+	}
+	delete(x.sessions, key)
+	if len(flows) > 0 {
+		x.sessions[key] = flows
+		for _, f := range flows {
+			index(x.byFlow, f.Name, key)
+			index(x.byFiveQI, f.FiveQI, key)
+		}
+	}
+
+	counts := make(map[string]int, len(x.byFiveQI))
+	for q, keys := range x.byFiveQI {
+		counts[q] = len(keys)
+	}
+	metrics.SetSessionsByFiveQI(counts)
+
+	return reconcile.Result{}, nil
+}
+
+// list returns the sessions with a flow of the given name and a flow of the given 5QI, ordered by
+// namespace/name. An empty name or 5QI matches any.
+func (x *flowIndex) list(flow, fiveQI string) []SessionFlows {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	ret := []SessionFlows{}
+	for key, flows := range x.sessions {
+		if flow != "" && !x.byFlow[flow][key] {
+			continue
+		}
+		if fiveQI != "" && !x.byFiveQI[fiveQI][key] {
+			continue
+		}
+		ret = append(ret, SessionFlows{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Flows:     append([]QoSFlow(nil), flows...),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func index(idx map[string]map[client.ObjectKey]bool, v string, key client.ObjectKey) {
+	if v == "" {
+		return
+	}
+	if idx[v] == nil {
+		idx[v] = map[client.ObjectKey]bool{}
+	}
+	idx[v][key] = true
+}
+
+func unindex(idx map[string]map[client.ObjectKey]bool, v string, key client.ObjectKey) {
+	delete(idx[v], key)
+	if len(idx[v]) == 0 {
+		delete(idx, v)
+	}
+}
+
+// ListSessions returns the sessions with a QoS flow of the given name and a QoS flow of the
+// given 5QI, e.g., the sessions carrying a voice-flow. An empty flow name or 5QI matches any.
+func (d *Dctrl) ListSessions(flow, fiveQI string) []SessionFlows {
+	return d.flows.list(flow, fiveQI)
+}
+
+// sessionsHandler serves the sessions as JSON, filtered by the flow and the fiveQI query
+// parameters, if given.
+func (d *Dctrl) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.ListSessions(q.Get("flow"), q.Get("fiveQI"))); err != nil {
+		d.log.Error(err, "failed to write sessions response")
+	}
+}
@@ -0,0 +1,123 @@
+package dctrl_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Session flow index", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		c      client.Client
+		addr   string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr = d.ServiceAddr()
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// createSession creates a session with the given flows, each given as name:fiveQI
+	createSession := func(name string, flows ...[2]string) {
+		flowSpec := ""
+		for _, f := range flows {
+			flowSpec += fmt.Sprintf(`
+      - name: %s
+        fiveQI: %s`, f[0], f[1])
+		}
+		sess := object.New()
+		Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Session
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  guti: guti-%[1]s
+  qos:
+    flows:%[2]s`, name, flowSpec)), &sess)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, sess)).To(Succeed())
+	}
+
+	// names returns a poller for the names of the sessions with the given flow name and 5QI
+	names := func(flow, fiveQI string) func() []string {
+		return func() []string {
+			ret := []string{}
+			for _, s := range d.ListSessions(flow, fiveQI) {
+				ret = append(ret, s.Name)
+			}
+			return ret
+		}
+	}
+
+	voice := [2]string{"voice-flow", "ConversationalVoice"}
+	bestEffort := [2]string{"best-effort-flow", "BestEffort"}
+
+	It("should list the sessions by flow name and 5QI", func() {
+		createSession("user-1", voice, bestEffort)
+		createSession("user-2", bestEffort)
+		createSession("user-3", voice)
+
+		Eventually(names("voice-flow", ""), timeout, interval).Should(Equal([]string{"user-1", "user-3"}))
+		Eventually(names("best-effort-flow", ""), timeout, interval).Should(Equal([]string{"user-1", "user-2"}))
+		Eventually(names("", "ConversationalVoice"), timeout, interval).Should(Equal([]string{"user-1", "user-3"}))
+		Eventually(names("voice-flow", "BestEffort"), timeout, interval).Should(Equal([]string{"user-1"}))
+		Expect(names("video-flow", "")()).To(BeEmpty())
+
+		Expect(testutil.ToFloat64(metrics.SessionsByFiveQI.WithLabelValues("ConversationalVoice"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.SessionsByFiveQI.WithLabelValues("BestEffort"))).To(Equal(2.0))
+
+		// the REST endpoint
+		var sessions []dctrl.SessionFlows
+		Eventually(func() error {
+			res, err := http.Get("http://" + addr + "/sessions?flow=voice-flow")
+			if err != nil {
+				return err
+			}
+			defer res.Body.Close() //nolint:errcheck
+			return json.NewDecoder(res.Body).Decode(&sessions)
+		}, timeout, interval).Should(Succeed())
+		Expect(sessions).To(HaveLen(2))
+		Expect(sessions[0].Name).To(Equal("user-1"))
+		Expect(sessions[0].Flows).To(ConsistOf(
+			dctrl.QoSFlow{Name: "voice-flow", FiveQI: "ConversationalVoice"},
+			dctrl.QoSFlow{Name: "best-effort-flow", FiveQI: "BestEffort"}))
+
+		// the index follows the deletes
+		sess := object.NewViewObject("amf", "Session")
+		object.SetName(sess, "user-3", "user-3")
+		Expect(c.Delete(ctx, sess)).To(Succeed())
+		Eventually(names("voice-flow", ""), timeout, interval).Should(Equal([]string{"user-1"}))
+		Expect(testutil.ToFloat64(metrics.SessionsByFiveQI.WithLabelValues("ConversationalVoice"))).To(Equal(1.0))
+	})
+})
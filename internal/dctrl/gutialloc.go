@@ -0,0 +1,259 @@
+package dctrl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// GutiAllocator mints the GUTIs of the UEs whose SUPI has no GUTI provisioned in the AMF SUPI to
+// GUTI table. An allocator must not hand out a GUTI it holds allocated.
+type GutiAllocator interface {
+	// Allocate returns a new GUTI for a SUPI.
+	Allocate(supi string) (string, error)
+	// Release frees a GUTI after the last registration of the UE is deleted.
+	Release(guti string)
+}
+
+// DefaultGutiPrefix is the PLMN, AMF region and AMF set prefix of the GUTIs minted by the default
+// GUTI allocator.
+const DefaultGutiPrefix = "guti-310-170-3F-152"
+
+// maxGutiAllocate bounds the attempts to draw a free GUTI.
+const maxGutiAllocate = 16
+
+// randomGutiAllocator mints GUTIs with a cryptographically random AMF pointer and 5G-TMSI under a
+// fixed PLMN/AMF region/AMF set prefix, so that the GUTIs cannot be derived from the SUPI.
+type randomGutiAllocator struct {
+	prefix    string
+	mu        sync.Mutex
+	allocated map[string]bool
+}
+
+// NewGutiAllocator returns the default GUTI allocator, minting GUTIs under the given prefix, e.g.,
+// DefaultGutiPrefix.
+func NewGutiAllocator(prefix string) GutiAllocator {
+	return &randomGutiAllocator{prefix: prefix, allocated: map[string]bool{}}
+}
+
+func (a *randomGutiAllocator) Allocate(_ string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var b [5]byte
+	for attempt := 0; attempt < maxGutiAllocate; attempt++ {
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", fmt.Errorf("failed to draw GUTI: %w", err)
+		}
+		// 6-bit AMF pointer, 32-bit 5G-TMSI
+		guti := fmt.Sprintf("%s-%02X-%08X", a.prefix, b[0]&0x3f, binary.BigEndian.Uint32(b[1:]))
+		if !a.allocated[guti] {
+			a.allocated[guti] = true
+			return guti, nil
+		}
+	}
+	return "", fmt.Errorf("no free GUTI after %d attempts", maxGutiAllocate)
+}
+
+func (a *randomGutiAllocator) Release(guti string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.allocated, guti)
+}
+
+// gutiAllocatorController adds the GUTIs minted by the allocator to the SUPI to GUTI table for
+// the authenticated UEs that have no GUTI provisioned, which lets the AMF complete their
+// registration, and releases the GUTI with the last registration of the UE. The minted entries
+// are marked with allocated: true; the provisioned entries are never released.
+type gutiAllocatorController struct {
+	client    client.Client
+	allocator GutiAllocator
+	mu        sync.Mutex
+	supis     map[client.ObjectKey]string // the SUPI of each registration
+	log       logr.Logger
+}
+
+// gutiAllocatorOptions configures the GUTI allocator.
+type gutiAllocatorOptions struct {
+	Client client.Client
+	// Allocator mints the GUTIs; if nil, the GUTIs are minted with the prefix of the PLMN of the
+	// UE if PLMNs are given, with the default prefix otherwise
+	Allocator GutiAllocator
+	PLMNs     []PLMNConfig
+	Logger    logr.Logger
+}
+
+// gutiAllocatorHooks creates the GUTI allocator and returns the hook adding it to the AMF.
+func gutiAllocatorHooks(o gutiAllocatorOptions) []operatorHook {
+	allocator := o.Allocator
+	if allocator == nil && len(o.PLMNs) > 0 {
+		allocator = newPLMNGutiAllocator(o.PLMNs)
+	}
+	r := newGutiAllocatorController(o.Client, allocator, o.Logger)
+	return []operatorHook{{
+		view: amfView,
+		what: "create the GUTI allocator",
+		add:  func(op *trackedOperator, _ string) error { return r.addController(op) },
+	}}
+}
+
+func newGutiAllocatorController(c client.Client, allocator GutiAllocator, logger logr.Logger) *gutiAllocatorController {
+	if allocator == nil {
+		allocator = NewGutiAllocator(DefaultGutiPrefix)
+	}
+	return &gutiAllocatorController{
+		client:    c,
+		allocator: allocator,
+		supis:     map[client.ObjectKey]string{},
+		log:       logger.WithName("guti-allocator"),
+	}
+}
+
+// addController adds the GUTI allocator to the AMF operator.
+func (r *gutiAllocatorController) addController(op *trackedOperator) error {
+	return addWatchController(op, "amf", "guti-allocator", "RegState", r)
+}
+
+func (r *gutiAllocatorController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, r.release(ctx, key)
+	}
+
+	supi, err := registrationSupi(ctx, r.client, key)
+	if err != nil || supi == "" {
+		return reconcile.Result{}, err
+	}
+	r.mu.Lock()
+	r.supis[key] = supi
+	r.mu.Unlock()
+
+	return reconcile.Result{}, r.allocate(ctx, supi)
+}
+
+// allocate adds a GUTI to the SUPI to GUTI table for a SUPI, unless it has one.
+func (r *gutiAllocatorController) allocate(ctx context.Context, supi string) error {
+	var minted string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "SupiToGutiTable")
+		object.SetName(table, "", "supi-to-guti")
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		used := map[string]bool{}
+		for _, e := range entries {
+			entry, ok := e.(map[string]any)
+			if !ok {
+				continue
+			}
+			if entry["supi"] == supi {
+				return nil
+			}
+			if g, ok := entry["guti"].(string); ok {
+				used[g] = true
+			}
+		}
+
+		// draw a GUTI not provisioned for another UE
+		if minted == "" {
+			for attempt := 0; ; attempt++ {
+				guti, err := r.allocator.Allocate(supi)
+				if err != nil {
+					return err
+				}
+				if !used[guti] {
+					minted = guti
+					break
+				}
+				r.allocator.Release(guti)
+				if attempt >= maxGutiAllocate {
+					return fmt.Errorf("no free GUTI after %d attempts", maxGutiAllocate)
+				}
+			}
+		}
+
+		entries = append(entries, map[string]any{"supi": supi, "guti": minted, "allocated": true})
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), entries, "spec"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		if minted != "" {
+			r.allocator.Release(minted)
+		}
+		return fmt.Errorf("failed to allocate GUTI for SUPI %q: %w", supi, err)
+	}
+	if minted != "" {
+		r.log.V(1).Info("GUTI allocated", "supi", supi, "guti", minted)
+	}
+	return nil
+}
+
+// release removes the minted GUTI of the SUPI of a deleted registration from the SUPI to GUTI
+// table and releases it, unless another registration holds the SUPI.
+func (r *gutiAllocatorController) release(ctx context.Context, key client.ObjectKey) error {
+	r.mu.Lock()
+	supi, ok := r.supis[key]
+	delete(r.supis, key)
+	for _, s := range r.supis {
+		if s == supi {
+			ok = false
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var released string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		released = ""
+		table := object.NewViewObject("amf", "SupiToGutiTable")
+		object.SetName(table, "", "supi-to-guti")
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		kept := make([]any, 0, len(entries))
+		for _, e := range entries {
+			entry, ok := e.(map[string]any)
+			if ok && entry["supi"] == supi && entry["allocated"] == true {
+				released, _ = entry["guti"].(string)
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if released == "" {
+			return nil
+		}
+
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), kept, "spec"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release the GUTI of SUPI %q: %w", supi, err)
+	}
+	if released != "" {
+		r.allocator.Release(released)
+		r.log.V(1).Info("GUTI released", "supi", supi, "guti", released)
+	}
+	return nil
+}
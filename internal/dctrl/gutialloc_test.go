@@ -0,0 +1,225 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+	ueclient "github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+// fixedGutiAllocator hands out a fixed GUTI and records the releases.
+type fixedGutiAllocator struct {
+	guti     string
+	mu       sync.Mutex
+	released []string
+}
+
+func (a *fixedGutiAllocator) Allocate(_ string) (string, error) { return a.guti, nil }
+
+func (a *fixedGutiAllocator) Release(guti string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.released = append(a.released, guti)
+}
+
+func (a *fixedGutiAllocator) getReleased() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.released...)
+}
+
+var _ = Describe("GUTI allocator", func() {
+	Context("The default allocator", func() {
+		It("should allocate unique random GUTIs under the prefix", func() {
+			a := dctrl.NewGutiAllocator(dctrl.DefaultGutiPrefix)
+			seen := map[string]bool{}
+			for i := 0; i < 10000; i++ {
+				guti, err := a.Allocate(fmt.Sprintf("imsi-99901%010d", i))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(seen).NotTo(HaveKey(guti))
+				seen[guti] = true
+
+				Expect(guti).To(HavePrefix(dctrl.DefaultGutiPrefix + "-"))
+				g, err := ueclient.ParseGUTI(guti)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(g.PLMN()).To(Equal("310-170"))
+				Expect(g.AMFPointer).To(HaveLen(2))
+				Expect(g.TMSI).To(HaveLen(8))
+			}
+		})
+
+		It("should not derive the GUTI from the SUPI", func() {
+			a := dctrl.NewGutiAllocator(dctrl.DefaultGutiPrefix)
+			g1, err := a.Allocate("imsi-999010000000123")
+			Expect(err).NotTo(HaveOccurred())
+			a.Release(g1)
+			g2, err := a.Allocate("imsi-999010000000123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(g2).NotTo(Equal(g1))
+		})
+
+		It("should release the GUTIs", func() {
+			a := dctrl.NewGutiAllocator(dctrl.DefaultGutiPrefix)
+			gutis := []string{}
+			for i := 0; i < 100; i++ {
+				guti, err := a.Allocate(fmt.Sprintf("imsi-99901%010d", i))
+				Expect(err).NotTo(HaveOccurred())
+				gutis = append(gutis, guti)
+			}
+			for i, guti := range gutis {
+				if i%2 == 0 {
+					a.Release(guti)
+				}
+			}
+			for i, guti := range gutis {
+				Expect(dctrl.GutiAllocated(a, guti)).To(Equal(i%2 == 1), guti)
+			}
+
+			// releasing an unknown GUTI is a no-op
+			a.Release("guti-310-170-3F-152-00-00000000")
+			Expect(dctrl.GutiAllocated(a, gutis[1])).To(BeTrue())
+		})
+	})
+
+	Context("The AMF", func() {
+		const (
+			suci = "suci-0-999-01-02-4f2a7b9c8d13e7a5ff"
+			supi = "imsi-999010000000999"
+			guti = "guti-001-01-01-001-01-00000001"
+		)
+
+		var (
+			ctx       context.Context
+			cancel    context.CancelFunc
+			c         client.Client
+			allocator *fixedGutiAllocator
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			allocator = &fixedGutiAllocator{guti: guti}
+			d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+				OpSpecs:       opSpecs,
+				GutiAllocator: allocator,
+			}, loglevel)
+			Expect(err).NotTo(HaveOccurred())
+			c = d.GetCache().GetClient()
+
+			// provision a UE in the AUSF with no GUTI in the AMF
+			Eventually(func() error {
+				return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					table := object.NewViewObject("ausf", "SuciToSupiTable")
+					object.SetName(table, "default", "suci-to-supi")
+					if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+						return err
+					}
+					entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+					entries = append(entries, map[string]any{"suci": suci, "supi": supi})
+					if err := unstructured.SetNestedSlice(table.UnstructuredContent(), entries, "spec"); err != nil {
+						return err
+					}
+					return c.Update(ctx, table)
+				})
+			}, timeout, interval).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		// tableGuti returns a poller for the GUTI of the SUPI in the SUPI to GUTI table
+		tableGuti := func() func() string {
+			return func() string {
+				table := object.NewViewObject("amf", "SupiToGutiTable")
+				object.SetName(table, "", "supi-to-guti")
+				if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+					return ""
+				}
+				entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+				for _, e := range entries {
+					if entry, ok := e.(map[string]any); ok && entry["supi"] == supi {
+						g, _ := entry["guti"].(string)
+						return g
+					}
+				}
+				return ""
+			}
+		}
+
+		It("should register a UE with an allocated GUTI and release it on deregistration", func() {
+			yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, suci)
+			reg := object.New()
+			Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+			Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "user-1", "user-1")
+			Eventually(func() string {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+					return ""
+				}
+				conds, _, _ := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				for _, cd := range conds {
+					if cond, ok := cd.(map[string]any); ok && cond["type"] == "Ready" {
+						s, _ := cond["status"].(string)
+						return s
+					}
+				}
+				return ""
+			}, timeout, interval).Should(Equal("True"))
+			g, _, _ := unstructured.NestedString(retrieved.UnstructuredContent(), "status", "guti")
+			Expect(g).To(Equal(guti))
+			Expect(tableGuti()()).To(Equal(guti))
+
+			// the provisioned GUTIs are kept
+			Expect(allocator.getReleased()).To(BeEmpty())
+
+			Expect(c.Delete(ctx, reg)).To(Succeed())
+			Eventually(func() bool {
+				return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved))
+			}, timeout, interval).Should(BeTrue())
+			Eventually(tableGuti(), timeout, interval).Should(BeEmpty())
+			Eventually(allocator.getReleased, timeout, interval).Should(Equal([]string{guti}))
+
+			// the provisioned entries are not touched
+			table := object.NewViewObject("amf", "SupiToGutiTable")
+			object.SetName(table, "", "supi-to-guti")
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(table), table)).To(Succeed())
+			entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+			Expect(entries).To(HaveLen(3))
+			for _, e := range entries {
+				Expect(strings.HasPrefix(e.(map[string]any)["guti"].(string), "guti-001")).To(BeFalse())
+			}
+		})
+	})
+})
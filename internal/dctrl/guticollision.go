@@ -0,0 +1,246 @@
+package dctrl
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// GutiCollisionPolicy is the way a GUTI allocated to more than one UE is resolved.
+type GutiCollisionPolicy string
+
+const (
+	// GutiCollisionFail fails the registration of the newer UE with GutiCollision (default).
+	GutiCollisionFail GutiCollisionPolicy = "fail"
+	// GutiCollisionRehash allocates a new GUTI to the newer UE.
+	GutiCollisionRehash GutiCollisionPolicy = "rehash"
+)
+
+// maxGutiRehash bounds the attempts to find a free GUTI.
+const maxGutiRehash = 8
+
+// gutiCollisionDetector detects the GUTIs allocated to distinct SUPIs: the GUTI of each
+// authenticated registration is checked against the active registration table, and if it is held
+// by the registration of another subscriber, the entry of the newer subscriber in the SUPI to
+// GUTI table (the GUTI allocator of the AMF) is resolved according to the policy.
+type gutiCollisionDetector struct {
+	client client.Client
+	policy GutiCollisionPolicy
+	log    logr.Logger
+}
+
+func checkGutiCollisionPolicy(p GutiCollisionPolicy) error {
+	switch p {
+	case "", GutiCollisionFail, GutiCollisionRehash:
+		return nil
+	default:
+		return fmt.Errorf("unknown GUTI collision policy %q", p)
+	}
+}
+
+// addGutiCollisionDetector adds the GUTI collision detector to the AMF operator.
+func addGutiCollisionDetector(op *trackedOperator, c client.Client, policy GutiCollisionPolicy, logger logr.Logger) error {
+	if policy == "" {
+		policy = GutiCollisionFail
+	}
+	r := &gutiCollisionDetector{
+		client: c,
+		policy: policy,
+		log:    logger.WithName("guti-collision-detector"),
+	}
+	return addWatchController(op, "amf", "guti-collision-detector", "RegState", r)
+}
+
+func (r *gutiCollisionDetector) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	key := client.ObjectKeyFromObject(req.Object)
+	reg := object.NewViewObject("amf", "RegState")
+	if err := r.client.Get(ctx, key, reg); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	status, _, _ := unstructured.NestedString(reg.UnstructuredContent(),
+		"status", "conditions", "authenticated", "status")
+	guti, _, _ := unstructured.NestedString(reg.UnstructuredContent(), "status", "guti")
+	if status != "True" || guti == "" {
+		return reconcile.Result{}, nil
+	}
+
+	table := object.NewViewObject("amf", "ActiveRegistrationTable")
+	object.SetName(table, "", "active-registrations")
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	supi, err := registrationSupi(ctx, r.client, key)
+	if err != nil || supi == "" {
+		return reconcile.Result{}, err
+	}
+
+	entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+	for _, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok || entry["guti"] != guti {
+			continue
+		}
+		ns, _ := entry["namespace"].(string)
+		name, _ := entry["name"].(string)
+		other := client.ObjectKey{Namespace: ns, Name: name}
+		if other == key {
+			continue
+		}
+
+		// the same subscriber may hold more registrations
+		otherSupi, err := registrationSupi(ctx, r.client, other)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if otherSupi == "" || otherSupi == supi {
+			continue
+		}
+
+		// resolve the collision on the newer registration only
+		newer, err := newerRegistration(ctx, r.client, key, other)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if newer != key {
+			newer, supi = other, otherSupi
+		}
+
+		r.log.Info("GUTI collision", "guti", guti, "registration", newer, "supi", supi,
+			"policy", r.policy)
+		if err := r.resolve(ctx, supi, guti); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// registrationSupi returns the SUPI resolved for a registration, empty if none.
+func registrationSupi(ctx context.Context, c client.Client, key client.ObjectKey) (string, error) {
+	id := object.NewViewObject("ausf", "MobileIdentity")
+	if err := c.Get(ctx, key, id); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	supi, _, _ := unstructured.NestedString(id.UnstructuredContent(), "status", "supi")
+	return supi, nil
+}
+
+// newerRegistration returns the key of the newer one of two registrations, by creation time and
+// then by key.
+func newerRegistration(ctx context.Context, c client.Client, a, b client.ObjectKey) (client.ObjectKey, error) {
+	created := func(key client.ObjectKey) (time.Time, error) {
+		reg := object.NewViewObject("amf", "RegState")
+		if err := c.Get(ctx, key, reg); err != nil {
+			if apierrors.IsNotFound(err) {
+				return time.Time{}, nil
+			}
+			return time.Time{}, err
+		}
+		return reg.GetCreationTimestamp().Time, nil
+	}
+
+	ta, err := created(a)
+	if err != nil {
+		return client.ObjectKey{}, err
+	}
+	tb, err := created(b)
+	if err != nil {
+		return client.ObjectKey{}, err
+	}
+
+	switch {
+	case ta.After(tb):
+		return a, nil
+	case tb.After(ta):
+		return b, nil
+	case a.String() > b.String():
+		return a, nil
+	default:
+		return b, nil
+	}
+}
+
+// resolve rewrites the entry of a SUPI in the SUPI to GUTI table: the entry is marked as colliding
+// so that the AMF fails the registration, or a new GUTI is allocated.
+func (r *gutiCollisionDetector) resolve(ctx context.Context, supi, guti string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "SupiToGutiTable")
+		object.SetName(table, "", "supi-to-guti")
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		used := map[string]bool{}
+		for _, e := range entries {
+			if entry, ok := e.(map[string]any); ok {
+				if g, ok := entry["guti"].(string); ok {
+					used[g] = true
+				}
+			}
+		}
+
+		changed := false
+		for _, e := range entries {
+			entry, ok := e.(map[string]any)
+			if !ok || entry["supi"] != supi || entry["guti"] != guti {
+				continue
+			}
+
+			switch r.policy {
+			case GutiCollisionRehash:
+				newGuti, err := rehashGuti(guti, supi, used)
+				if err != nil {
+					return err
+				}
+				entry["guti"] = newGuti
+				r.log.Info("reallocated GUTI", "supi", supi, "guti", newGuti)
+			default:
+				entry["collision"] = true
+			}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), entries, "spec"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resolve the collision of GUTI %q: %w", guti, err)
+	}
+	return nil
+}
+
+// rehashGuti derives a new GUTI for a SUPI that is not in use.
+func rehashGuti(guti, supi string, used map[string]bool) (string, error) {
+	for attempt := 0; attempt < maxGutiRehash; attempt++ {
+		h := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", guti, supi, attempt)))
+		g := fmt.Sprintf("%s-%x", guti, h[:4])
+		if !used[g] {
+			return g, nil
+		}
+	}
+	return "", fmt.Errorf("no free GUTI after %d attempts", maxGutiRehash)
+}
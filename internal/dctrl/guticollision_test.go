@@ -0,0 +1,169 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+const collidingGuti = "guti-310-170-3F-152-2A-B7C8D9E0"
+
+var _ = Describe("GUTI collisions", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	start := func(policy dctrl.GutiCollisionPolicy) {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:             opSpecs,
+			GutiCollisionPolicy: policy,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+
+		// stub the GUTI allocator to hand out the GUTI of imsi-999010000000123 to
+		// imsi-999010000000124 too
+		Eventually(func() error {
+			return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				table := object.NewViewObject("amf", "SupiToGutiTable")
+				object.SetName(table, "", "supi-to-guti")
+				if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+					return err
+				}
+				entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+				for _, e := range entries {
+					if entry, ok := e.(map[string]any); ok && entry["supi"] == "imsi-999010000000124" {
+						entry["guti"] = collidingGuti
+					}
+				}
+				if err := unstructured.SetNestedSlice(table.UnstructuredContent(), entries, "spec"); err != nil {
+					return err
+				}
+				return c.Update(ctx, table)
+			})
+		}, timeout, interval).Should(Succeed())
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name, suci string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %[2]s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name, suci)
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	getRegistration := func(name string) (object.Object, error) {
+		reg := object.NewViewObject("amf", "Registration")
+		object.SetName(reg, name, name)
+		err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg)
+		return reg, err
+	}
+
+	// condition returns the status and the reason of a condition of a registration
+	condition := func(name, condType string) func() [2]string {
+		return func() [2]string {
+			reg, err := getRegistration(name)
+			if err != nil {
+				return [2]string{}
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, cd := range conds {
+				if cond, ok := cd.(map[string]any); ok && cond["type"] == condType {
+					status, _ := cond["status"].(string)
+					reason, _ := cond["reason"].(string)
+					return [2]string{status, reason}
+				}
+			}
+			return [2]string{}
+		}
+	}
+
+	guti := func(name string) func() string {
+		return func() string {
+			reg, err := getRegistration(name)
+			if err != nil {
+				return ""
+			}
+			g, _, _ := unstructured.NestedString(reg.UnstructuredContent(), "status", "guti")
+			return g
+		}
+	}
+
+	It("should fail the newer registration by default", func() {
+		start("")
+
+		register("user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0")
+		Eventually(condition("user-1", "Ready"), timeout, interval).
+			Should(Equal([2]string{"True", "RegistrationSuccessful"}))
+		Expect(guti("user-1")()).To(Equal(collidingGuti))
+
+		register("user-2", "suci-0-999-01-02-4f2a7b9c8d13e7a5c1")
+		Eventually(condition("user-2", "Authenticated"), timeout, interval).
+			Should(Equal([2]string{"False", "GutiCollision"}))
+		Eventually(condition("user-2", "Ready"), timeout, interval).
+			Should(Equal([2]string{"False", "RegistrationFailed"}))
+
+		// the older UE keeps its GUTI
+		Consistently(condition("user-1", "Ready"), "500ms", interval).
+			Should(Equal([2]string{"True", "RegistrationSuccessful"}))
+		Expect(guti("user-1")()).To(Equal(collidingGuti))
+	})
+
+	It("should reallocate the GUTI of the newer registration with the rehash policy", func() {
+		start(dctrl.GutiCollisionRehash)
+
+		register("user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0")
+		Eventually(condition("user-1", "Ready"), timeout, interval).
+			Should(Equal([2]string{"True", "RegistrationSuccessful"}))
+
+		register("user-2", "suci-0-999-01-02-4f2a7b9c8d13e7a5c1")
+		Eventually(guti("user-2"), timeout, interval).
+			Should(And(HavePrefix(collidingGuti+"-"), Not(Equal(collidingGuti))))
+		Eventually(condition("user-2", "Ready"), timeout, interval).
+			Should(Equal([2]string{"True", "RegistrationSuccessful"}))
+		Expect(guti("user-1")()).To(Equal(collidingGuti))
+	})
+
+	It("should reject an unknown policy", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:             opSpecs,
+			HTTPMode:            true,
+			GutiCollisionPolicy: "ignore",
+		})
+		Expect(err).To(MatchError(ContainSubstring("unknown GUTI collision policy")))
+		cancel = func() {}
+	})
+})
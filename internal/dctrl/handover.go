@@ -0,0 +1,359 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/upf"
+)
+
+const (
+	// defaultUPF is the UPF serving the configs written by the SMF.
+	defaultUPF = "default"
+	// handoverPollInterval is the interval of checking the active config table for the target
+	// config during a handover.
+	handoverPollInterval = 50 * time.Millisecond
+	// handoverRetryInterval is the interval of retrying a handover of a session without a data
+	// path.
+	handoverRetryInterval = time.Second
+)
+
+// handoverController moves the data path of a session between UPFs on an N2 handover, requested
+// with a upf/Handover object:
+//
+//	spec:
+//	  guti: guti-310-170-3F-152-2A-B7C8D9E0
+//	  sessionId: 1
+//	  targetUpf: upf-1
+//
+// The handover is make-before-break (as for SSC mode 3): the config of the session is copied to
+// the target UPF (a upf/Config named <session>-<targetUpf>, with the session and the UPF in the
+// spec), and the source config is released only once the target config shows up in the active
+// config table, so the session never disappears from the table.
+//
+// The SMF keeps writing the config of the session under the name of the session. Once a session
+// has been handed over, these writes are mirrored to the config on the target UPF, and the
+// handed-over configs are released with the data path of the session (i.e., when the session is
+// released or goes idle).
+type handoverController struct {
+	client client.Client
+	log    logr.Logger
+}
+
+// addHandoverControllers adds the handover and the config mirror controllers to the UPF operator.
+func addHandoverControllers(op *trackedOperator, c client.Client, logger logr.Logger) error {
+	r := &handoverController{client: c, log: logger.WithName("handover")}
+	if err := addWatchController(op, upf.OperatorName, "handover-controller", "Handover",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileHandover)); err != nil {
+		return err
+	}
+	return addWatchController(op, upf.OperatorName, "handover-config-mirror", "Config",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileConfig))
+}
+
+// addHandoverReleaser adds the controller releasing the handed-over configs to the SMF operator,
+// which owns the session contexts.
+func addHandoverReleaser(op *trackedOperator, c client.Client, logger logr.Logger) error {
+	r := &handoverController{client: c, log: logger.WithName("handover")}
+	return addWatchController(op, "smf", "handover-releaser", "SessionContext",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileSession))
+}
+
+func (r *handoverController) reconcileHandover(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	key := client.ObjectKeyFromObject(req.Object)
+	h := object.NewViewObject(upf.OperatorName, "Handover")
+	if err := r.client.Get(ctx, key, h); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	guti, _, _ := unstructured.NestedString(h.UnstructuredContent(), "spec", "guti")
+	sessionID, _, _ := unstructured.NestedFieldNoCopy(h.UnstructuredContent(), "spec", "sessionId")
+	target, _, _ := unstructured.NestedString(h.UnstructuredContent(), "spec", "targetUpf")
+	if guti == "" || sessionID == nil || target == "" {
+		return reconcile.Result{}, r.setStatus(ctx, key, "False", "InvalidHandover",
+			"guti, sessionId and targetUpf must be set", "", "")
+	}
+	if status, _, _ := unstructured.NestedString(h.UnstructuredContent(), "status", "upf"); status == target {
+		return reconcile.Result{}, nil
+	}
+
+	session, err := r.findSession(ctx, guti, sessionID)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if session == nil {
+		return reconcile.Result{}, r.setStatus(ctx, key, "False", "SessionNotFound",
+			fmt.Sprintf("No session with GUTI %q and id %v", guti, sessionID), "", "")
+	}
+
+	configs, err := r.sessionConfigs(ctx, *session)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(configs) == 0 {
+		if err := r.setStatus(ctx, key, "False", "NoDataPath", "The session has no UPF config",
+			"", ""); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: handoverRetryInterval}, nil
+	}
+
+	// make: copy the config to the target UPF
+	targetName := session.Name + "-" + target
+	var source []object.Object
+	found := false
+	for _, cfg := range configs {
+		if configUPF(cfg) == target {
+			found = true
+			continue
+		}
+		source = append(source, cfg)
+	}
+	if !found {
+		cfg := object.NewViewObject(upf.OperatorName, "Config")
+		object.SetName(cfg, session.Namespace, targetName)
+		spec, _, _ := unstructured.NestedMap(source[0].UnstructuredContent(), "spec")
+		spec["session"] = session.Name
+		spec["upf"] = target
+		if err := unstructured.SetNestedMap(cfg.UnstructuredContent(), spec, "spec"); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.client.Create(ctx, cfg); err != nil && !apierrors.IsAlreadyExists(err) {
+			return reconcile.Result{}, fmt.Errorf("failed to create the config on the target UPF: %w", err)
+		}
+		r.log.V(1).Info("created the config on the target UPF", "session", session, "upf", target)
+	}
+
+	active, err := r.isActive(ctx, session.Namespace, targetName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !active {
+		return reconcile.Result{RequeueAfter: handoverPollInterval}, nil
+	}
+
+	// break: release the source configs
+	for _, cfg := range source {
+		if err := r.client.Delete(ctx, cfg); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to release the config on the source UPF: %w", err)
+		}
+	}
+
+	r.log.Info("handover complete", "session", session, "upf", target)
+	return reconcile.Result{}, r.setStatus(ctx, key, "True", "HandoverComplete",
+		"Session moved to the target UPF", target, targetName)
+}
+
+// reconcileConfig mirrors the config the SMF writes for a handed-over session to the config on
+// the target UPF.
+func (r *handoverController) reconcileConfig(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	key := client.ObjectKeyFromObject(req.Object)
+	cfg := object.NewViewObject(upf.OperatorName, "Config")
+	if err := r.client.Get(ctx, key, cfg); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if _, ok, _ := unstructured.NestedString(cfg.UnstructuredContent(), "spec", "session"); ok {
+		return reconcile.Result{}, nil
+	}
+
+	moved, err := r.handedOverConfigs(ctx, key)
+	if err != nil || len(moved) == 0 {
+		return reconcile.Result{}, err
+	}
+
+	// a handover in progress: keep the source config until the target config is active
+	for _, m := range moved {
+		active, err := r.isActive(ctx, m.GetNamespace(), m.GetName())
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !active {
+			return reconcile.Result{RequeueAfter: handoverPollInterval}, nil
+		}
+	}
+
+	spec, _, _ := unstructured.NestedMap(cfg.UnstructuredContent(), "spec")
+	for _, m := range moved {
+		mkey := client.ObjectKeyFromObject(m)
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			obj := object.NewViewObject(upf.OperatorName, "Config")
+			if err := r.client.Get(ctx, mkey, obj); err != nil {
+				return err
+			}
+			newSpec := map[string]any{}
+			for k, v := range spec {
+				newSpec[k] = v
+			}
+			newSpec["session"] = key.Name
+			newSpec["upf"] = configUPF(obj)
+			if err := unstructured.SetNestedMap(obj.UnstructuredContent(), newSpec, "spec"); err != nil {
+				return err
+			}
+			return r.client.Update(ctx, obj)
+		})
+		if client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to update the handed-over config %s: %w", mkey, err)
+		}
+	}
+
+	if err := r.client.Delete(ctx, cfg); client.IgnoreNotFound(err) != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to release the config on the source UPF: %w", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// reconcileSession releases the handed-over configs of a session with the data path of the
+// session.
+func (r *handoverController) reconcileSession(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+	if req.EventType != object.Deleted {
+		obj := object.NewViewObject("smf", "SessionContext")
+		err := r.client.Get(ctx, key, obj)
+		if client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, err
+		}
+		status, _, _ := unstructured.NestedString(obj.UnstructuredContent(),
+			"status", "conditions", "upf", "status")
+		if err == nil && status == "True" {
+			return reconcile.Result{}, nil
+		}
+	}
+
+	moved, err := r.handedOverConfigs(ctx, key)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	for _, m := range moved {
+		if err := r.client.Delete(ctx, m); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to release the handed-over config: %w", err)
+		}
+		r.log.V(1).Info("released the handed-over config", "session", key, "upf", configUPF(m))
+	}
+	return reconcile.Result{}, nil
+}
+
+// findSession returns the key of the session context with the given GUTI and session id.
+func (r *handoverController) findSession(ctx context.Context, guti string, sessionID any) (*client.ObjectKey, error) {
+	list := cache.NewViewObjectList("smf", "SessionContext")
+	if err := r.client.List(ctx, list); err != nil {
+		return nil, err
+	}
+	for _, obj := range list.Items {
+		g, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "spec", "guti")
+		id, _, _ := unstructured.NestedFieldNoCopy(obj.UnstructuredContent(), "spec", "sessionId")
+		if g == guti && fmt.Sprint(id) == fmt.Sprint(sessionID) {
+			key := client.ObjectKeyFromObject(&obj)
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+// sessionConfigs returns the configs serving a session.
+func (r *handoverController) sessionConfigs(ctx context.Context, session client.ObjectKey) ([]object.Object, error) {
+	list := cache.NewViewObjectList(upf.OperatorName, "Config")
+	if err := r.client.List(ctx, list, client.InNamespace(session.Namespace)); err != nil {
+		return nil, err
+	}
+	ret := []object.Object{}
+	for i := range list.Items {
+		cfg := &list.Items[i]
+		s, ok, _ := unstructured.NestedString(cfg.UnstructuredContent(), "spec", "session")
+		if (ok && s == session.Name) || (!ok && cfg.GetName() == session.Name) {
+			ret = append(ret, cfg)
+		}
+	}
+	return ret, nil
+}
+
+// handedOverConfigs returns the configs a session has been moved to by a handover.
+func (r *handoverController) handedOverConfigs(ctx context.Context, session client.ObjectKey) ([]object.Object, error) {
+	configs, err := r.sessionConfigs(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	ret := []object.Object{}
+	for _, cfg := range configs {
+		if _, ok, _ := unstructured.NestedString(cfg.UnstructuredContent(), "spec", "session"); ok {
+			ret = append(ret, cfg)
+		}
+	}
+	return ret, nil
+}
+
+// isActive returns true if a config is in the active config table.
+func (r *handoverController) isActive(ctx context.Context, namespace, name string) (bool, error) {
+	table := object.NewViewObject(upf.OperatorName, "ActiveConfigTable")
+	object.SetName(table, "", "active-configs")
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+	for _, e := range entries {
+		if entry, ok := e.(map[string]any); ok && entry["namespace"] == namespace && entry["name"] == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setStatus sets the status of a handover.
+func (r *handoverController) setStatus(ctx context.Context, key client.ObjectKey, status, reason, message, upfID, config string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		h := object.NewViewObject(upf.OperatorName, "Handover")
+		if err := r.client.Get(ctx, key, h); err != nil {
+			return err
+		}
+		st := map[string]any{
+			"conditions": []any{map[string]any{
+				"type":    "Ready",
+				"status":  status,
+				"reason":  reason,
+				"message": message,
+			}},
+		}
+		if upfID != "" {
+			st["upf"] = upfID
+			st["config"] = config
+		}
+		if err := unstructured.SetNestedMap(h.UnstructuredContent(), st, "status"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, h)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update handover %s: %w", key, err)
+	}
+	return nil
+}
+
+// configUPF returns the UPF serving a config.
+func configUPF(cfg object.Object) string {
+	if u, ok, _ := unstructured.NestedString(cfg.UnstructuredContent(), "spec", "upf"); ok {
+		return u
+	}
+	return defaultUPF
+}
@@ -0,0 +1,194 @@
+package dctrl_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("UPF handover", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	create := func(yamlData string) {
+		obj := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &obj)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, obj)).To(Succeed())
+	}
+
+	// upfs returns the UPFs serving a session in the active config table
+	upfs := func(session string) []string {
+		table := object.NewViewObject("upf", "ActiveConfigTable")
+		object.SetName(table, "", "active-configs")
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return nil
+		}
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		ret := []string{}
+		for _, e := range entries {
+			entry, ok := e.(map[string]any)
+			if ok && entry["namespace"] == session && entry["session"] == session {
+				u, _ := entry["upf"].(string)
+				ret = append(ret, u)
+			}
+		}
+		return ret
+	}
+
+	It("should move a session to the target UPF without a gap in the active config table", func() {
+		create(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`)
+		create(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Session
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  nssai: eMBB
+  guti: guti-310-170-3F-152-2A-B7C8D9E0
+  sessionId: 1
+  pduSessionType: IPv4
+  sscMode: SSC3
+  networkConfiguration:
+    requests:
+      - type: IPConfiguration
+        addressFamily: IPv4
+  qos:
+    flows:
+      - name: best-effort-flow
+        fiveQI: BestEffort
+    rules:
+      - name: default-rule
+        precedence: 255
+        default: true
+        qosFlow: best-effort-flow
+        filters:
+          - name: match-all
+            direction: Bidirectional
+            match:
+              type: MatchAll`)
+
+		Eventually(func() []string { return upfs("user-1") }, timeout, interval).
+			Should(Equal([]string{"default"}))
+
+		// watch the active config table for a gap during the handover
+		var gap atomic.Bool
+		pollCtx, pollCancel := context.WithCancel(ctx)
+		defer pollCancel()
+		go func() {
+			for {
+				select {
+				case <-pollCtx.Done():
+					return
+				case <-time.After(5 * time.Millisecond):
+					if len(upfs("user-1")) == 0 {
+						gap.Store(true)
+					}
+				}
+			}
+		}()
+
+		create(`
+apiVersion: upf.view.dcontroller.io/v1alpha1
+kind: Handover
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  guti: guti-310-170-3F-152-2A-B7C8D9E0
+  sessionId: 1
+  targetUpf: upf-1`)
+
+		Eventually(func() []string { return upfs("user-1") }, timeout, interval).
+			Should(Equal([]string{"upf-1"}))
+
+		h := object.NewViewObject("upf", "Handover")
+		object.SetName(h, "user-1", "user-1")
+		Eventually(func() string {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(h), h); err != nil {
+				return ""
+			}
+			conds, _, _ := unstructured.NestedSlice(h.UnstructuredContent(), "status", "conditions")
+			if len(conds) == 0 {
+				return ""
+			}
+			status, _ := conds[0].(map[string]any)["status"].(string)
+			return status
+		}, timeout, interval).Should(Equal("True"))
+		Expect(h.UnstructuredContent()["status"]).To(HaveKeyWithValue("upf", "upf-1"))
+
+		// the session stays on the target UPF
+		Consistently(func() []string { return upfs("user-1") }, 500*time.Millisecond, interval).
+			Should(Equal([]string{"upf-1"}))
+		pollCancel()
+		Expect(gap.Load()).To(BeFalse(), "the session left the active config table during the handover")
+	})
+
+	It("should report a handover of an unknown session", func() {
+		create(`
+apiVersion: upf.view.dcontroller.io/v1alpha1
+kind: Handover
+metadata:
+  name: user-2
+  namespace: user-2
+spec:
+  guti: guti-310-170-3F-152-2A-B7C8D9E1
+  sessionId: 1
+  targetUpf: upf-1`)
+
+		h := object.NewViewObject("upf", "Handover")
+		object.SetName(h, "user-2", "user-2")
+		Eventually(func() string {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(h), h); err != nil {
+				return ""
+			}
+			conds, _, _ := unstructured.NestedSlice(h.UnstructuredContent(), "status", "conditions")
+			if len(conds) == 0 {
+				return ""
+			}
+			reason, _ := conds[0].(map[string]any)["reason"].(string)
+			return reason
+		}, timeout, interval).Should(Equal("SessionNotFound"))
+	})
+})
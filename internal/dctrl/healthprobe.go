@@ -0,0 +1,77 @@
+package dctrl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// waitForAPIServer marks the API server bound once it accepts connections, until the context
+// stopping the API server is cancelled.
+func (d *Dctrl) waitForAPIServer(ctx context.Context) {
+	addr := d.apiServer.GetServerAddress()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close() //nolint:errcheck
+			d.log.V(1).Info("API server bound", "address", addr)
+			d.apiServerBound.Store(true)
+			<-ctx.Done()
+			d.apiServerBound.Store(false)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// operatorsSynced returns whether all operators are running and their manager caches have synced.
+// Does not block: the caches are waited for when the operators are started.
+func (d *Dctrl) operatorsSynced() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.run == nil {
+		return false
+	}
+	for _, n := range d.order {
+		r, ok := d.run.running[n]
+		if !ok || !r.synced.Load() {
+			return false
+		}
+	}
+	return true
+}
+
+// healthProbeHandler serves the orchestrator probes with the same handlers as the service server:
+//   - /healthz: 200 once the embedded API server accepts connections, unless the last token
+//     signing self-test failed.
+//   - /readyz: 200 once all readiness gates are open.
+func (d *Dctrl) healthProbeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", d.healthzHandler)
+	mux.HandleFunc("GET /readyz", d.readyzHandler)
+	return mux
+}
+
+// startHealthProbeServer serves the health and readiness probes until the context is cancelled.
+func (d *Dctrl) startHealthProbeServer(ctx context.Context, l net.Listener) {
+	srv := &http.Server{Handler: d.healthProbeHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close() //nolint:errcheck
+	}()
+
+	d.log.V(1).Info("starting health probe server", "address", l.Addr().String())
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		d.log.Error(err, "health probe server error")
+	}
+}
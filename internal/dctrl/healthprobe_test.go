@@ -0,0 +1,105 @@
+package dctrl_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Health probes", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should report ready only once the operators have synced", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:         opSpecs,
+			APIServerPort:   dctrl.EphemeralAPIServerPort,
+			HTTPMode:        true,
+			DisableAuth:     true,
+			KeyFile:         keyFile,
+			HealthProbeAddr: "localhost:0",
+			ServiceAddr:     "localhost:0",
+			Logger:          logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// before Start neither probe passes, and the probes do not wait for the operators
+		probe := func(path string) int {
+			rec := httptest.NewRecorder()
+			dctrl.HealthProbeHandler(d).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			return rec.Code
+		}
+		start := time.Now()
+		Expect(probe("/healthz")).To(Equal(http.StatusServiceUnavailable))
+		Expect(probe("/readyz")).To(Equal(http.StatusServiceUnavailable))
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(d.Start(ctx)).To(Succeed())
+		}()
+		Eventually(d.HealthProbeAddr, timeout, interval).ShouldNot(BeEmpty())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr, serviceAddr := d.HealthProbeAddr(), d.ServiceAddr()
+
+		get := func(addr, path string) (int, string, error) {
+			res, err := http.Get(fmt.Sprintf("http://%s%s", addr, path))
+			if err != nil {
+				return 0, "", err
+			}
+			defer res.Body.Close() //nolint:errcheck
+			body, err := io.ReadAll(res.Body)
+			return res.StatusCode, string(body), err
+		}
+		status := func(path string) func() (int, error) {
+			return func() (int, error) {
+				code, _, err := get(addr, path)
+				return code, err
+			}
+		}
+		Eventually(status("/healthz"), timeout, interval).Should(Equal(http.StatusOK))
+		Eventually(status("/readyz"), timeout, interval).Should(Equal(http.StatusOK))
+
+		// the service server serves the same probes
+		_, body, err := get(addr, "/readyz?verbose")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(ContainSubstring("[+]operatorsSynced ok"))
+		Eventually(func() (string, error) {
+			_, body, err := get(serviceAddr, "/readyz?verbose")
+			return body, err
+		}, timeout, interval).Should(Equal(body))
+		for _, a := range []string{addr, serviceAddr} {
+			code, body, err := get(a, "/healthz")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal(http.StatusOK))
+			h := dctrl.Health{}
+			Expect(json.Unmarshal([]byte(body), &h)).To(Succeed())
+			Expect(h.APIServerBound).To(BeTrue())
+		}
+	})
+})
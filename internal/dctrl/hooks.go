@@ -0,0 +1,342 @@
+package dctrl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "github.com/l7mp/dcontroller/pkg/api/view/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/apiserver"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/operator"
+
+	"github.com/hsnlab/dctrl5g/internal/aka"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/operators/upf"
+	"github.com/hsnlab/dctrl5g/internal/sidf"
+)
+
+// The views the network functions are recognized by: the hooks of a network function are added to
+// the declarative operator serving its view, whatever the name of the operator.
+const (
+	amfView  = "Registration"
+	smfView  = "SessionContext"
+	pcfView  = "PolicyTable"
+	ausfView = "MobileIdentity"
+	upfView  = "Config"
+)
+
+// operatorHook adds native controllers to a declarative operator when it is built.
+type operatorHook struct {
+	// view selects the operators the hook is added to: those serving the view, or all of them
+	// if empty
+	view string
+	// what is what the hook does, for the errors
+	what string
+	add  func(op *trackedOperator, opName string) error
+}
+
+// servedViews returns the views a declarative operator serves: the kinds of the API group of the
+// operator read or written by the controllers of its spec.
+func servedViews(opName string, spec *opv1a1.OperatorSpec) map[string]bool {
+	group := viewv1a1.Group(opName)
+	views := map[string]bool{}
+	add := func(r opv1a1.Resource) {
+		if r.Group == nil || *r.Group == group {
+			views[r.Kind] = true
+		}
+	}
+	for _, c := range spec.Controllers {
+		for _, s := range c.Sources {
+			add(s.Resource)
+		}
+		add(c.Target.Resource)
+	}
+	return views
+}
+
+// addHooks adds the hooks of the views an operator serves, in order.
+func addHooks(op *trackedOperator, opName string, spec *opv1a1.OperatorSpec, hooks []operatorHook) error {
+	views := servedViews(opName, spec)
+	for _, h := range hooks {
+		if h.view != "" && !views[h.view] {
+			continue
+		}
+		if err := h.add(op, opName); err != nil {
+			return fmt.Errorf("unable to %s for operator %q: %w", h.what, opName, err)
+		}
+	}
+	return nil
+}
+
+// operatorBuilderOptions configures the builder of the declarative operators.
+type operatorBuilderOptions struct {
+	Cache        *cache.ViewCache
+	APIServer    *apiserver.APIServer
+	ErrorChannel chan error
+	Coalescer    *tableCoalescer
+	Hooks        []operatorHook
+	Works        *operatorWorks
+	Logger       logr.Logger
+}
+
+// newOperatorBuilder returns the function that creates a declarative operator from its spec,
+// extended with the native controllers of the control plane. The same builder is used to reload
+// an operator.
+func newOperatorBuilder(o operatorBuilderOptions) func(OpSpec) (*operator.Operator, error) {
+	log := o.Logger.WithName("dctrl")
+	return func(opSpec OpSpec) (*operator.Operator, error) {
+		// The spec is parsed once, for creating the controllers and for instrumenting them.
+		spec, err := readOperatorSpec(opSpec)
+		if err != nil {
+			return nil, &OperatorLoadError{Name: opSpec.Name, File: opSpec.File, Err: err}
+		}
+		op, err := operator.New(opSpec.Name, nil, operator.Options{
+			Cache:        o.Cache,
+			APIServer:    o.APIServer,
+			ErrorChannel: o.ErrorChannel,
+			Logger:       o.Logger,
+		})
+		if err != nil {
+			return nil, &OperatorLoadError{Name: opSpec.Name, File: opSpec.File, Err: err}
+		}
+		for _, c := range spec.Controllers {
+			if err := op.AddController(c); err != nil {
+				// the error is reported on the error channel and in the status of the operator
+				log.V(1).Info("failed to create controller", "operator", opSpec.Name,
+					"controller", c.Name, "error", err.Error())
+			}
+		}
+		if err := op.RegisterGVKs(); err != nil {
+			// not fatal, like for the operators created from a file by dcontroller
+			log.Error(err, "failed to register the API of the operator", "operator", opSpec.Name)
+		}
+		tracked := &trackedOperator{Operator: op, work: metrics.NewWork()}
+
+		// Count and time the reconciles of the declarative controllers and batch the writes of
+		// the aggregate tables.
+		if err := instrumentControllers(opSpec, spec, tracked, o.Coalescer, o.Logger); err != nil {
+			return nil, fmt.Errorf("unable to instrument the controllers of operator %q: %w",
+				opSpec.Name, err)
+		}
+
+		if err := addHooks(tracked, opSpec.Name, spec, o.Hooks); err != nil {
+			return nil, err
+		}
+
+		o.Works.add(op, tracked.work)
+		return op, nil
+	}
+}
+
+// observerHooks returns the hooks counting the condition transitions of the views of all
+// operators.
+func observerHooks(logger logr.Logger) []operatorHook {
+	return []operatorHook{{
+		what: "create the condition observers",
+		add: func(op *trackedOperator, opName string) error {
+			return addConditionObservers(opName, op, logger)
+		},
+	}}
+}
+
+// amfHookOptions configures the native controllers of the AMF.
+type amfHookOptions struct {
+	Client              client.Client
+	APIServer           *apiserver.APIServer
+	GutiCollisionPolicy GutiCollisionPolicy
+	DuplicateSupiPolicy DuplicateSupiPolicy
+	PLMNs               []PLMNConfig
+	MaxRequestedNSSAI   int
+	EventBufferSize     int
+	Logger              logr.Logger
+}
+
+// amfHooks returns the hooks of the native controllers of the AMF. The last hook registers the
+// native kinds of the AMF, so the other hooks adding native controllers to the AMF, e.g., the
+// allocators, must come before these.
+func amfHooks(o amfHookOptions) []operatorHook {
+	return []operatorHook{{
+		// Detect the GUTIs allocated to more than one UE.
+		view: amfView,
+		what: "create the GUTI collision detector",
+		add: func(op *trackedOperator, _ string) error {
+			return addGutiCollisionDetector(op, o.Client, o.GutiCollisionPolicy, o.Logger)
+		},
+	}, {
+		// Enforce the uniqueness of the SUPIs of the registrations.
+		view: amfView,
+		what: "create the duplicate SUPI enforcer",
+		add: func(op *trackedOperator, _ string) error {
+			return addDuplicateSupiEnforcer(op, o.Client, o.DuplicateSupiPolicy, o.Logger)
+		},
+	}, {
+		// Check the tracking areas the pipelines cannot parse.
+		view: amfView,
+		what: "create the tracking area validator",
+		add: func(op *trackedOperator, _ string) error {
+			return addTrackingAreaValidator(op, o.Client, o.Logger)
+		},
+	}, {
+		// Route the registrations to the config of the PLMN of their SUCI.
+		view: amfView,
+		what: "create the PLMN router",
+		add: func(op *trackedOperator, _ string) error {
+			return addPLMNRouter(op, o.Client, o.PLMNs, o.Logger)
+		},
+	}, {
+		// Set the limits given in the options in the AMF config table.
+		view: amfView,
+		what: "create the config table projector",
+		add: func(op *trackedOperator, _ string) error {
+			return addConfigTableProjector(op, o.Client, o.MaxRequestedNSSAI, o.Logger)
+		},
+	}, {
+		// Negotiate the security algorithms the pipelines cannot rank.
+		view: amfView,
+		what: "create the security negotiator",
+		add: func(op *trackedOperator, _ string) error {
+			return addSecurityNegotiator(op, o.Client, o.Logger)
+		},
+	}, {
+		// Record the registration state changes in the RegistrationEvent view.
+		view: amfView,
+		what: "create the registration event recorder",
+		add: func(op *trackedOperator, _ string) error {
+			return addRegistrationEventRecorder(op, o.Client, o.EventBufferSize, o.Logger)
+		},
+	}, {
+		view: amfView,
+		what: "register the native API of the AMF",
+		add: func(op *trackedOperator, opName string) error {
+			return registerNativeKinds(o.APIServer, op.Operator, opName)
+		},
+	}}
+}
+
+// smfHookOptions configures the native controllers of the SMF.
+type smfHookOptions struct {
+	Client client.Client
+	// RegistrationWait, if positive, lets the sessions wait for the registrations in progress
+	RegistrationWait time.Duration
+	// InactivityTimer, if positive, tracks the activity of the sessions
+	InactivityTimer time.Duration
+	Logger          logr.Logger
+}
+
+// smfHooks returns the hooks of the native controllers of the SMF.
+func smfHooks(o smfHookOptions) []operatorHook {
+	hooks := []operatorHook{}
+	if o.RegistrationWait > 0 {
+		hooks = append(hooks, operatorHook{
+			view: smfView,
+			what: "create the session waiter",
+			add: func(op *trackedOperator, _ string) error {
+				return addSessionWaiter(op, o.Client, o.RegistrationWait, o.Logger)
+			},
+		})
+	}
+	if o.InactivityTimer > 0 {
+		hooks = append(hooks, operatorHook{
+			view: smfView,
+			what: "create the inactivity tracker",
+			add: func(op *trackedOperator, _ string) error {
+				return addInactivityTracker(op, o.Client, o.InactivityTimer, o.Logger)
+			},
+		})
+	}
+	// Release the configs a session has been handed over to with the data path.
+	return append(hooks, operatorHook{
+		view: smfView,
+		what: "create the handover releaser",
+		add: func(op *trackedOperator, _ string) error {
+			return addHandoverReleaser(op, o.Client, o.Logger)
+		},
+	})
+}
+
+// ausfHookOptions configures the native controllers of the AUSF.
+type ausfHookOptions struct {
+	Client    client.Client
+	APIServer *apiserver.APIServer
+	// Deconcealer, if set, de-conceals the SUCIs the AUSF pipelines cannot decrypt
+	Deconcealer *sidf.SIDF
+	// KeyStore, if set, enables 5G-AKA
+	KeyStore *aka.KeyStore
+	Logger   logr.Logger
+}
+
+// ausfHooks returns the hooks of the native controllers of the AUSF.
+func ausfHooks(o ausfHookOptions) []operatorHook {
+	hooks := []operatorHook{}
+	if o.Deconcealer != nil {
+		hooks = append(hooks, operatorHook{
+			view: ausfView,
+			what: "create the SUCI de-concealer",
+			add: func(op *trackedOperator, _ string) error {
+				return addSuciDeconcealer(op, o.Client, o.Deconcealer, o.Logger)
+			},
+		})
+	}
+	if o.KeyStore != nil {
+		// Challenge the UEs with 5G-AKA and serve the AuthChallenge and AuthResponse resources.
+		hooks = append(hooks, operatorHook{
+			view: ausfView,
+			what: "create the 5G-AKA controller",
+			add: func(op *trackedOperator, opName string) error {
+				if err := addAKAController(op, o.Client, o.KeyStore, o.Logger); err != nil {
+					return err
+				}
+				return registerNativeKinds(o.APIServer, op.Operator, opName)
+			},
+		})
+	}
+	return hooks
+}
+
+// upfHookOptions configures the native controllers of the UPF.
+type upfHookOptions struct {
+	Cache     *cache.ViewCache
+	APIServer *apiserver.APIServer
+	Format    string
+	Transform upf.Transform
+	Logger    logr.Logger
+}
+
+// upfHooks returns the hooks of the native controllers of the UPF.
+func upfHooks(o upfHookOptions) []operatorHook {
+	return []operatorHook{{
+		// Export the configs in the format given in the options.
+		view: upfView,
+		what: "create the UPF config exporter",
+		add: func(op *trackedOperator, _ string) error {
+			return upf.AddExporter(op.Operator, upf.Options{
+				Cache:     o.Cache,
+				Format:    o.Format,
+				Transform: o.Transform,
+				Work:      op.work,
+				Logger:    o.Logger,
+			})
+		},
+	}, {
+		// Record the data path lifetime of the sessions in the upf/ChargingRecords.
+		view: upfView,
+		what: "create the UPF charging controller",
+		add: func(op *trackedOperator, _ string) error {
+			return upf.AddCharging(op.Operator, upf.Options{Cache: o.Cache, Work: op.work, Logger: o.Logger})
+		},
+	}, {
+		// Serve the Handover resource handled by the native handover controller.
+		view: upfView,
+		what: "create the handover controller",
+		add: func(op *trackedOperator, opName string) error {
+			if err := addHandoverControllers(op, o.Cache.GetClient(), o.Logger); err != nil {
+				return err
+			}
+			return registerNativeKinds(o.APIServer, op.Operator, opName)
+		},
+	}}
+}
@@ -0,0 +1,115 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Concurrent idle and resume", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// setIdle idles or resumes a session in a single read-modify-write and marks the write with the
+	// label of the writer, like a client without a retry loop; a write racing with another client
+	// or a controller may fail with a resourceVersion conflict
+	setIdle := func(name, writer string, idle bool) error {
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, name, name)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			return err
+		}
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[writer] = fmt.Sprint(idle)
+		obj.SetLabels(labels)
+		if err := unstructured.SetNestedField(obj.UnstructuredContent(), idle, "spec", "idle"); err != nil {
+			return err
+		}
+		return c.Update(ctx, obj)
+	}
+
+	It("should keep the controllers consistent with a session idled and resumed concurrently", func() {
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(1))).To(Succeed())
+
+		// each writer idles and then resumes the session, racing with the other writers and with
+		// the status writes of the native controllers
+		const writers = 8
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		written := 0
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				writer := fmt.Sprintf("writer-%d", i)
+				for _, idle := range []bool{true, false} {
+					err := setIdle("user-1", writer, idle)
+					if err != nil {
+						Expect(apierrors.IsConflict(err)).To(BeTrue(), "unexpected error: %v", err)
+						continue
+					}
+					mu.Lock()
+					written++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+		Expect(written).To(BeNumerically(">", 0))
+
+		// the controllers converge to the last state written: an active session holds its address
+		// and tunnel and is configured at the UPF, an idle one holds no tunnel
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, "user-1", "user-1")
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		idle, _, _ := unstructured.NestedBool(obj.UnstructuredContent(), "spec", "idle")
+		want := []any{true, true, "UPFConfigured"}
+		if idle {
+			want = []any{false}
+		}
+		Eventually(func() []any {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return nil
+			}
+			_, tunnel, _ := unstructured.NestedMap(obj.UnstructuredContent(), "status", "tunnel")
+			if idle {
+				return []any{tunnel}
+			}
+			_, addr, _ := unstructured.NestedString(obj.UnstructuredContent(),
+				"status", "networkConfiguration", "ipConfiguration", "ipAddress")
+			reason, _, _ := unstructured.NestedString(obj.UnstructuredContent(),
+				"status", "conditions", "upf", "reason")
+			return []any{tunnel, addr, reason}
+		}, timeout, interval).Should(Equal(want))
+	})
+})
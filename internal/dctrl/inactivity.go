@@ -0,0 +1,133 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// sessionActivity is the activity of a session as last seen by the inactivity tracker.
+type sessionActivity struct {
+	generation   int64
+	lastActivity time.Time
+}
+
+// inactivityTracker maintains the UE inactivity timer of the sessions in the status of the
+// session contexts, from where the AMF copies it into the status of the sessions:
+//
+//	status:
+//	  inactivity:
+//	    timer: 5m0s
+//	    lastActivity: "2025-01-01T00:00:00.000000000Z"
+//	    expiresAt: "2025-01-01T00:05:00.000000000Z"
+//
+// Each change of the spec of an active session, e.g., its creation or a resume from idle,
+// counts as activity and restarts the timer. The timer is not restarted while the session is
+// idle. A session whose timer has expired is a candidate for an idle-timeout.
+type inactivityTracker struct {
+	client   client.Client
+	timer    time.Duration
+	mu       sync.Mutex
+	activity map[client.ObjectKey]sessionActivity
+	log      logr.Logger
+}
+
+// addInactivityTracker adds the inactivity tracker to the SMF operator, which owns the session
+// contexts.
+func addInactivityTracker(op *trackedOperator, c client.Client, timer time.Duration, logger logr.Logger) error {
+	r := &inactivityTracker{
+		client:   c,
+		timer:    timer,
+		activity: map[client.ObjectKey]sessionActivity{},
+		log:      logger.WithName("inactivity-tracker"),
+	}
+	return addWatchController(op, "smf", "inactivity-tracker", "SessionContext", r)
+}
+
+func (r *inactivityTracker) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		r.forget(key)
+		return reconcile.Result{}, nil
+	}
+
+	obj := object.NewViewObject("smf", "SessionContext")
+	if err := r.client.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(key)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	idle, _, _ := unstructured.NestedBool(obj.UnstructuredContent(), "spec", "idle")
+
+	r.mu.Lock()
+	a, seen := r.activity[key]
+	if !seen || (a.generation != obj.GetGeneration() && !idle) {
+		a.lastActivity = time.Now().UTC()
+		r.log.V(2).Info("session activity", "session", key.String(), "generation", obj.GetGeneration())
+	}
+	a.generation = obj.GetGeneration()
+	r.activity[key] = a
+	r.mu.Unlock()
+
+	return reconcile.Result{}, r.setInactivity(ctx, key, r.inactivity(a.lastActivity))
+}
+
+func (r *inactivityTracker) forget(key client.ObjectKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.activity, key)
+}
+
+// inactivity returns the inactivity status of a session last active at the given time.
+func (r *inactivityTracker) inactivity(lastActivity time.Time) map[string]any {
+	return map[string]any{
+		"timer":        r.timer.String(),
+		"lastActivity": lastActivity.Format(time.RFC3339Nano),
+		"expiresAt":    lastActivity.Add(r.timer).Format(time.RFC3339Nano),
+	}
+}
+
+// setInactivity writes the inactivity status of a session context, unless it is up to date.
+// The SMF pipeline keeps the inactivity status, but the AMF drops it when it revalidates the
+// session, in which case it is restored here.
+func (r *inactivityTracker) setInactivity(ctx context.Context, key client.ObjectKey, inactivity map[string]any) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("smf", "SessionContext")
+		if err := r.client.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		current, _, _ := unstructured.NestedStringMap(obj.UnstructuredContent(), "status", "inactivity")
+		if current["lastActivity"] == inactivity["lastActivity"] && current["timer"] == inactivity["timer"] {
+			return nil
+		}
+
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), inactivity,
+			"status", "inactivity"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, obj)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update session context %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package dctrl_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Session inactivity timer", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                opSpecs,
+			SessionInactivityTimer: 5 * time.Minute,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// lastActivity returns a poller for the last activity in the status of user-0
+	lastActivity := func() func() time.Time {
+		return func() time.Time {
+			obj := object.NewViewObject("smf", "SessionContext")
+			object.SetName(obj, "user-0", "user-0")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return time.Time{}
+			}
+			s, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "status", "inactivity", "lastActivity")
+			t, _ := time.Parse(time.RFC3339Nano, s)
+			return t
+		}
+	}
+
+	It("should report the inactivity timer and restart it on activity", func() {
+		start := time.Now()
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(0))).To(Succeed())
+		Eventually(lastActivity(), timeout, interval).ShouldNot(BeZero())
+		first := lastActivity()()
+		Expect(first).To(BeTemporally(">=", start.Add(-time.Second)))
+
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, "user-0", "user-0")
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		inactivity, ok, err := unstructured.NestedStringMap(obj.UnstructuredContent(), "status", "inactivity")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(inactivity).To(HaveKeyWithValue("timer", "5m0s"))
+		Expect(inactivity).To(HaveKeyWithValue("expiresAt", first.Add(5*time.Minute).Format(time.RFC3339Nano)))
+
+		// a spec change is activity
+		Eventually(func() error {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+			if err := unstructured.SetNestedField(obj.UnstructuredContent(), "SSC2", "spec", "sscMode"); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj)
+		}, timeout, interval).Should(Succeed())
+
+		Eventually(lastActivity(), timeout, interval).Should(BeTemporally(">", first))
+	})
+})
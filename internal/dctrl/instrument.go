@@ -0,0 +1,62 @@
+package dctrl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/pipeline"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// readOperatorSpec reads and parses the spec file of a declarative operator.
+func readOperatorSpec(opSpec OpSpec) (*opv1a1.OperatorSpec, error) {
+	data, err := os.ReadFile(opSpec.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var spec opv1a1.OperatorSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse operator spec: %w", err)
+	}
+	return &spec, nil
+}
+
+// instrumentControllers replaces the pipelines of the declarative controllers of an operator with
+// instrumented ones, so that each object reconcile of a declarative controller is counted and
+// timed like the reconciles of the native controllers, and the evaluations in progress are
+// tracked for the drains. The writes of the aggregate tables are batched by the coalescer. The
+// pipelines are rebuilt from the spec the operator was created from; must be called before the
+// operator is started.
+func instrumentControllers(opSpec OpSpec, spec *opv1a1.OperatorSpec, op *trackedOperator, coalescer *tableCoalescer, logger logr.Logger) error {
+	configs := map[string]opv1a1.Controller{}
+	for _, c := range spec.Controllers {
+		configs[c.Name] = c
+	}
+
+	for _, c := range op.ListControllers() {
+		if c == nil {
+			continue
+		}
+		config, ok := configs[c.GetName()]
+		// the target comes first, then the sources
+		gvks := c.GetGVKs()
+		if !ok || len(gvks) < 2 {
+			continue
+		}
+		p, err := pipeline.New(opSpec.Name, gvks[0], gvks[1:], config.Pipeline,
+			logger.WithName("pipeline").WithValues("controller", c.GetName(), "target", gvks[0].String()))
+		if err != nil {
+			return fmt.Errorf("failed to create pipeline for controller %s: %w", c.GetName(), err)
+		}
+		c.SetPipeline(&trackedPipeline{
+			Evaluator: metrics.InstrumentPipeline(opSpec.Name, coalescer.wrap(opSpec.Name, c.GetName(), p)),
+			work:      op.work,
+		})
+	}
+	return nil
+}
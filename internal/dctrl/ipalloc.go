@@ -0,0 +1,456 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// DefaultSessionIPPool is the default pool the IPv4 addresses of the sessions are allocated from.
+const DefaultSessionIPPool = "10.45.0.0/16"
+
+// DefaultSessionIPv6Pool is the default pool the IPv6 addresses of the sessions are allocated
+// from.
+const DefaultSessionIPv6Pool = "2001:db8:45::/64"
+
+// parseSessionIPPool parses the session IP pool. The pool must be an IPv4 CIDR with room for at
+// least one session address besides the network address, the default gateway and the broadcast
+// address.
+func parseSessionIPPool(pool string) (netip.Prefix, error) {
+	if pool == "" {
+		pool = DefaultSessionIPPool
+	}
+	p, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid session IP pool %q: %w", pool, err)
+	}
+	if !p.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid session IP pool %q: not an IPv4 CIDR", pool)
+	}
+	if p.Bits() > 29 {
+		return netip.Prefix{}, fmt.Errorf("invalid session IP pool %q: prefix longer than /29", pool)
+	}
+	return p.Masked(), nil
+}
+
+// parseSessionIPv6Pool parses the session IPv6 pool. The pool must be an IPv6 CIDR with room for
+// at least one session address besides the subnet-router anycast address, the default gateway
+// and the last address of the pool.
+func parseSessionIPv6Pool(pool string) (netip.Prefix, error) {
+	if pool == "" {
+		pool = DefaultSessionIPv6Pool
+	}
+	p, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid session IPv6 pool %q: %w", pool, err)
+	}
+	if !p.Addr().Is6() || p.Addr().Is4In6() {
+		return netip.Prefix{}, fmt.Errorf("invalid session IPv6 pool %q: not an IPv6 CIDR", pool)
+	}
+	if p.Bits() > 125 {
+		return netip.Prefix{}, fmt.Errorf("invalid session IPv6 pool %q: prefix longer than /125", pool)
+	}
+	return p.Masked(), nil
+}
+
+// ipAllocator allocates the IPv4 and the IPv6 addresses of the sessions from the session IP
+// pools, so that no two active sessions share an address. The SMF pipeline draws a random address
+// of each family of the PDU session type for a session, which the allocator replaces with the
+// next free address of the pool of the family; the pipeline keeps the address once set. The
+// addresses are released when the session context is deleted or idled, and an idled session gets
+// its previous addresses back on resume if those are still free. The allocations are published in
+// the smf/IPAllocationTable view:
+//
+//	spec:
+//	  pool: 10.45.0.0/16
+//	  ipv6Pool: 2001:db8:45::/64
+//	  allocations:
+//	    - name: user-1
+//	      namespace: user-1
+//	      ipAddress: 10.45.0.2
+//	      ipv6Address: 2001:db8:45::2
+//
+// The first host address of each pool is reserved for the default gateway. A session whose
+// status carries an address allocated to another session, e.g., a colliding random address, is
+// logged as a conflict and rewritten.
+type ipAllocator struct {
+	client   client.Client
+	families []*addressFamily // IPv4 first
+	mu       sync.Mutex
+	dirty    bool // the allocations have not been written yet
+	log      logr.Logger
+}
+
+// addressFamily holds the allocations of the addresses of an address family.
+type addressFamily struct {
+	field string // the field of the address in the IP configuration of the session status
+	pool  netip.Prefix
+	first netip.Addr // the first allocatable address
+	owner map[netip.Addr]client.ObjectKey
+	addrs map[client.ObjectKey]netip.Addr
+	idled map[client.ObjectKey]netip.Addr // the last address of the idle sessions
+	next  netip.Addr                      // where the search for a free address starts
+}
+
+func newAddressFamily(field string, pool netip.Prefix) *addressFamily {
+	// skip the network address and the default gateway
+	first := pool.Addr().Next().Next()
+	return &addressFamily{
+		field: field,
+		pool:  pool,
+		first: first,
+		owner: map[netip.Addr]client.ObjectKey{},
+		addrs: map[client.ObjectKey]netip.Addr{},
+		idled: map[client.ObjectKey]netip.Addr{},
+		next:  first,
+	}
+}
+
+// ipAllocatorOptions configures the allocator of the session addresses.
+type ipAllocatorOptions struct {
+	Client   client.Client
+	Pool     netip.Prefix
+	IPv6Pool netip.Prefix
+	Logger   logr.Logger
+}
+
+// ipAllocatorHooks creates the allocator of the session addresses and returns the hook adding it
+// to the SMF.
+func ipAllocatorHooks(o ipAllocatorOptions) []operatorHook {
+	a := newIPAllocator(o.Client, o.Pool, o.IPv6Pool, o.Logger)
+	return []operatorHook{{
+		view: smfView,
+		what: "create the IP allocator",
+		add:  func(op *trackedOperator, _ string) error { return a.addController(op) },
+	}}
+}
+
+func newIPAllocator(c client.Client, pool, ipv6Pool netip.Prefix, logger logr.Logger) *ipAllocator {
+	return &ipAllocator{
+		client: c,
+		families: []*addressFamily{
+			newAddressFamily("ipAddress", pool),
+			newAddressFamily("ipv6Address", ipv6Pool),
+		},
+		log: logger.WithName("ip-allocator"),
+	}
+}
+
+// addController adds the allocator to the SMF operator, which owns the session contexts and the
+// address pool table.
+func (a *ipAllocator) addController(op *trackedOperator) error {
+	if err := addWatchController(op, "smf", "ip-allocator", "SessionContext", a); err != nil {
+		return err
+	}
+	return addWatchController(op, "smf", "ip-pool-writer", "AddressPoolTable", &addressPoolWriter{a})
+}
+
+func (a *ipAllocator) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, a.release(ctx, key, a.families, false)
+	}
+
+	obj := object.NewViewObject("smf", "SessionContext")
+	if err := a.client.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, a.release(ctx, key, a.families, false)
+		}
+		return reconcile.Result{}, err
+	}
+
+	// only the active sessions with an IP configuration of a family hold an address of the family
+	idle, _, _ := unstructured.NestedBool(obj.UnstructuredContent(), "spec", "idle")
+	rewrite := map[string]netip.Addr{}
+	for _, f := range a.families {
+		current, hasAddr, _ := unstructured.NestedString(obj.UnstructuredContent(),
+			"status", "networkConfiguration", "ipConfiguration", f.field)
+		if !hasAddr || idle {
+			if err := a.release(ctx, key, []*addressFamily{f}, idle); err != nil {
+				return reconcile.Result{}, err
+			}
+			continue
+		}
+
+		addr, owner, err := a.allocate(ctx, f, key, current)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if addr.String() == current {
+			continue
+		}
+		if owner != (client.ObjectKey{}) {
+			a.log.Info("address conflict", "session", key.String(), "address", current,
+				"owner", owner.String(), "new-address", addr.String())
+		}
+		rewrite[f.field] = addr
+	}
+	if len(rewrite) == 0 {
+		return reconcile.Result{}, nil
+	}
+
+	return reconcile.Result{}, a.setAddresses(ctx, key, rewrite)
+}
+
+// allocate returns the address of a session of an address family, allocating one if the session
+// has none, and the session holding the current address of the session, if any.
+func (a *ipAllocator) allocate(ctx context.Context, f *addressFamily, key client.ObjectKey, current string) (netip.Addr, client.ObjectKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var owner client.ObjectKey
+	if c, err := netip.ParseAddr(current); err == nil {
+		owner = f.owner[c]
+	}
+	if owner == key {
+		owner = client.ObjectKey{}
+	}
+
+	if addr, ok := f.addrs[key]; ok {
+		return addr, owner, a.flush(ctx)
+	}
+
+	addr, ok := f.idled[key]
+	if _, taken := f.owner[addr]; !ok || taken {
+		var err error
+		if addr, err = f.nextFree(); err != nil {
+			return netip.Addr{}, owner, err
+		}
+	}
+	delete(f.idled, key)
+
+	f.owner[addr] = key
+	f.addrs[key] = addr
+	a.dirty = true
+	a.log.V(1).Info("address allocated", "session", key.String(), "address", addr.String())
+
+	return addr, owner, a.flush(ctx)
+}
+
+// release frees the addresses of a session of the given address families. The addresses of an
+// idled session are remembered so that the session can get them back on resume.
+func (a *ipAllocator) release(ctx context.Context, key client.ObjectKey, families []*addressFamily, idle bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, f := range families {
+		if !idle {
+			delete(f.idled, key)
+		}
+		addr, ok := f.addrs[key]
+		if !ok {
+			continue
+		}
+		if idle {
+			f.idled[key] = addr
+		}
+		delete(f.addrs, key)
+		delete(f.owner, addr)
+		a.dirty = true
+		a.log.V(1).Info("address released", "session", key.String(), "address", addr.String())
+	}
+
+	return a.flush(ctx)
+}
+
+// allocatable returns whether an address can be allocated to a session. Called with the lock held.
+func (f *addressFamily) allocatable(addr netip.Addr) bool {
+	return f.pool.Contains(addr) && addr.Compare(f.first) >= 0 && f.pool.Contains(addr.Next())
+}
+
+// nextFree returns the next free address of the pool, wrapping around at the end of the pool.
+// Called with the lock held.
+func (f *addressFamily) nextFree() (netip.Addr, error) {
+	start := f.next
+	if !f.allocatable(start) {
+		start = f.first
+	}
+	addr := start
+	for {
+		if _, ok := f.owner[addr]; !ok {
+			f.next = addr.Next()
+			return addr, nil
+		}
+		addr = addr.Next()
+		if !f.allocatable(addr) {
+			addr = f.first
+		}
+		if addr == start {
+			return netip.Addr{}, fmt.Errorf("session IP pool %s exhausted", f.pool)
+		}
+	}
+}
+
+// flush writes the smf/IPAllocationTable view if the allocations changed since the last write,
+// re-reading the table on a resourceVersion conflict. Called with the lock held; a failed write is
+// retried on the next reconcile.
+func (a *ipAllocator) flush(ctx context.Context) error {
+	if !a.dirty {
+		return nil
+	}
+
+	entries := map[client.ObjectKey]map[string]any{}
+	for _, f := range a.families {
+		for k, addr := range f.addrs {
+			e, ok := entries[k]
+			if !ok {
+				e = map[string]any{"name": k.Name, "namespace": k.Namespace}
+				entries[k] = e
+			}
+			e[f.field] = addr.String()
+		}
+	}
+	keys := make([]client.ObjectKey, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	allocations := make([]any, 0, len(keys))
+	for _, k := range keys {
+		allocations = append(allocations, entries[k])
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("smf", "IPAllocationTable")
+		object.SetName(table, "", "ip-allocations")
+		exists := true
+		if err := a.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get smf/IPAllocationTable: %w", err)
+			}
+			exists = false
+		}
+		table.UnstructuredContent()["spec"] = map[string]any{
+			"pool":        a.families[0].pool.String(),
+			"ipv6Pool":    a.families[1].pool.String(),
+			"allocations": allocations,
+		}
+		if exists {
+			if err := a.client.Update(ctx, table); err != nil {
+				return fmt.Errorf("failed to update smf/IPAllocationTable: %w", err)
+			}
+		} else if err := a.client.Create(ctx, table); err != nil {
+			return fmt.Errorf("failed to create smf/IPAllocationTable: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+// setAddresses rewrites the addresses of a session context, keyed by the field of the address,
+// unless the session has released an address in the meantime.
+func (a *ipAllocator) setAddresses(ctx context.Context, key client.ObjectKey, addrs map[string]netip.Addr) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("smf", "SessionContext")
+		if err := a.client.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		changed := false
+		for field, addr := range addrs {
+			current, ok, _ := unstructured.NestedString(obj.UnstructuredContent(),
+				"status", "networkConfiguration", "ipConfiguration", field)
+			if !ok || current == addr.String() {
+				continue
+			}
+			if err := unstructured.SetNestedField(obj.UnstructuredContent(), addr.String(),
+				"status", "networkConfiguration", "ipConfiguration", field); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+		return a.client.Update(ctx, obj)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update session context %s: %w", key, err)
+	}
+	return nil
+}
+
+// addressPoolWriter keeps the IPv4 and the IPv6 sections of the smf/AddressPoolTable view
+// consistent with the session IP pools, so that the prefixes and the default gateways the SMF
+// pipeline hands out with the addresses match the pools the addresses are allocated from.
+type addressPoolWriter struct {
+	*ipAllocator
+}
+
+func (w *addressPoolWriter) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	want := w.addressPool()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("smf", "AddressPoolTable")
+		if err := w.client.Get(ctx, client.ObjectKeyFromObject(req.Object), table); err != nil {
+			return err
+		}
+		changed := false
+		for family, pool := range want {
+			current, _, _ := unstructured.NestedMap(table.UnstructuredContent(), "spec", family)
+			if reflect.DeepEqual(current, pool) {
+				continue
+			}
+			if err := unstructured.SetNestedMap(table.UnstructuredContent(), pool, "spec", family); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+		return w.client.Update(ctx, table)
+	})
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to update smf/AddressPoolTable: %w", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// addressPool returns the IPv4 and the IPv6 sections of the address pool table for the session
+// IP pools: the prefixes the pipeline draws the random addresses with, which the allocator then
+// replaces, the subnet mask of the IPv4 pool and the prefix length of the IPv6 pool, and the
+// default gateways, the first host address of each pool.
+func (a *ipAllocator) addressPool() map[string]map[string]any {
+	v4, v6 := a.families[0].pool, a.families[1].pool
+	b := v4.Addr().As4()
+	return map[string]map[string]any{
+		"ipv4": {
+			"prefix":         fmt.Sprintf("%d.%d.%d.", b[0], b[1], b[2]),
+			"subnetMask":     net.IP(net.CIDRMask(v4.Bits(), 32)).String(),
+			"defaultGateway": v4.Addr().Next().String(),
+		},
+		"ipv6": {
+			"prefix":         v6.Addr().String(),
+			"prefixLength":   int64(v6.Bits()),
+			"defaultGateway": v6.Addr().Next().String(),
+		},
+	}
+}
@@ -0,0 +1,241 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Session IP allocator", func() {
+	// a /28 holds 13 session addresses besides the network address, the gateway and the
+	// broadcast address
+	const pool = "10.60.0.0/28"
+	const poolSize = 13
+	const ipv6Pool = "2001:db8:60::/120"
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:         opSpecs,
+			SessionIPPool:   pool,
+			SessionIPv6Pool: ipv6Pool,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// sessionAddresses returns a poller for the addresses of a family in the status of the
+	// session contexts, keyed by the name of the session context
+	sessionAddresses := func(field string) func() map[string]string {
+		return func() map[string]string {
+			list := cache.NewViewObjectList("smf", "SessionContext")
+			if err := c.List(ctx, list); err != nil {
+				return nil
+			}
+			ret := map[string]string{}
+			for _, s := range list.Items {
+				addr, ok, _ := unstructured.NestedString(s.UnstructuredContent(),
+					"status", "networkConfiguration", "ipConfiguration", field)
+				if ok {
+					ret[s.GetName()] = addr
+				}
+			}
+			return ret
+		}
+	}
+
+	// allocations returns a poller for the allocations of a family in the IPAllocationTable, keyed
+	// by the name of the session context
+	allocations := func(field string) func() map[string]string {
+		return func() map[string]string {
+			table := object.NewViewObject("smf", "IPAllocationTable")
+			object.SetName(table, "", "ip-allocations")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+				return nil
+			}
+			entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "allocations")
+			ret := map[string]string{}
+			for _, e := range entries {
+				if m, ok := e.(map[string]any); ok && m[field] != nil {
+					ret[fmt.Sprint(m["name"])] = fmt.Sprint(m[field])
+				}
+			}
+			return ret
+		}
+	}
+
+	// expectUniqueAddressesOf waits until the n sessions hold the addresses of a family allocated
+	// to them and checks that the addresses are unique and in the pool of the family
+	expectUniqueAddressesOf := func(field, pool, gateway string, n int) map[string]string {
+		GinkgoHelper()
+		var addrs map[string]string
+		Eventually(func() bool {
+			addrs = allocations(field)()
+			return len(addrs) == n && reflect.DeepEqual(addrs, sessionAddresses(field)())
+		}, timeout, interval).Should(BeTrue())
+
+		prefix := netip.MustParsePrefix(pool)
+		seen := map[string]bool{}
+		for name, a := range addrs {
+			Expect(seen).NotTo(HaveKey(a), "address %s allocated twice", a)
+			seen[a] = true
+			addr, err := netip.ParseAddr(a)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prefix.Contains(addr)).To(BeTrue(), "address %s of %s out of the pool", a, name)
+			Expect(addr).NotTo(Equal(netip.MustParseAddr(gateway)), "gateway allocated")
+		}
+		return addrs
+	}
+
+	// expectUniqueAddresses checks the IPv4 addresses of the n sessions
+	expectUniqueAddresses := func(n int) map[string]string {
+		GinkgoHelper()
+		return expectUniqueAddressesOf("ipAddress", pool, "10.60.0.1", n)
+	}
+
+	It("should allocate unique addresses from the pool and reuse the freed ones", func() {
+		// fill the pool, the test session holds an address too
+		const n = poolSize - 1
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(i))).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+		before := expectUniqueAddresses(n + 1)
+
+		// delete some sessions
+		freed := map[string]bool{}
+		for i := 0; i < 3; i++ {
+			Expect(c.Delete(ctx, newSessionContext(i))).To(Succeed())
+			freed[before[fmt.Sprintf("user-%d", i)]] = true
+		}
+		expectUniqueAddresses(n - 2)
+
+		// the new sessions get the freed addresses of the full pool
+		for i := n; i < n+3; i++ {
+			Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(i))).To(Succeed())
+		}
+		after := expectUniqueAddresses(n + 1)
+		for i := n; i < n+3; i++ {
+			Expect(freed).To(HaveKey(after[fmt.Sprintf("user-%d", i)]))
+		}
+	})
+
+	It("should release the address of an idled session", func() {
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(0))).To(Succeed())
+		addrs := expectUniqueAddresses(2)
+
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, "user-0", "user-0")
+		Eventually(func() error {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+			if err := unstructured.SetNestedField(obj.UnstructuredContent(), true, "spec", "idle"); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj)
+		}, timeout, interval).Should(Succeed())
+
+		Eventually(allocations("ipAddress"), timeout, interval).ShouldNot(HaveKey("user-0"))
+		Expect(allocations("ipAddress")()).To(HaveKeyWithValue("test-session", addrs["test-session"]))
+	})
+
+	It("should hand out the subnet mask and the default gateway of the pool", func() {
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(0))).To(Succeed())
+		expectUniqueAddresses(2)
+
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, "user-0", "user-0")
+		Eventually(func() map[string]string {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return nil
+			}
+			conf, _, _ := unstructured.NestedMap(obj.UnstructuredContent(),
+				"status", "networkConfiguration", "ipConfiguration")
+			return map[string]string{
+				"subnetMask":     fmt.Sprint(conf["subnetMask"]),
+				"defaultGateway": fmt.Sprint(conf["defaultGateway"]),
+			}
+		}, timeout, interval).Should(Equal(map[string]string{
+			"subnetMask":     "255.255.255.240",
+			"defaultGateway": "10.60.0.1",
+		}))
+	})
+
+	It("should allocate unique IPv6 addresses to the dual-stack sessions", func() {
+		const n = 4
+		for i := 0; i < n; i++ {
+			obj := newSessionContext(i)
+			Expect(unstructured.SetNestedField(obj.UnstructuredContent(), "IPv4v6",
+				"spec", "pduSessionType")).To(Succeed())
+			Expect(testsuite.CreateWithRetry(ctx, c, obj)).To(Succeed())
+		}
+		// the test session is an IPv4 session
+		expectUniqueAddresses(n + 1)
+		before := expectUniqueAddressesOf("ipv6Address", ipv6Pool, "2001:db8:60::1", n)
+
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, "user-0", "user-0")
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		conf, _, _ := unstructured.NestedMap(obj.UnstructuredContent(),
+			"status", "networkConfiguration", "ipConfiguration")
+		Expect(conf).To(HaveKeyWithValue("ipv6Prefix", ipv6Pool))
+		Expect(conf).To(HaveKeyWithValue("ipv6DefaultGateway", "2001:db8:60::1"))
+
+		// an IPv6 session holds an IPv6 address only, the address of a deleted session is freed
+		Expect(c.Delete(ctx, newSessionContext(0))).To(Succeed())
+		obj = newSessionContext(n)
+		Expect(unstructured.SetNestedField(obj.UnstructuredContent(), "IPv6",
+			"spec", "pduSessionType")).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, obj)).To(Succeed())
+		after := expectUniqueAddressesOf("ipv6Address", ipv6Pool, "2001:db8:60::1", n)
+		Expect(after).NotTo(HaveKey("user-0"))
+		Expect(after).To(HaveKey(fmt.Sprintf("user-%d", n)))
+		Expect(after["user-1"]).To(Equal(before["user-1"]))
+		Expect(allocations("ipAddress")()).NotTo(HaveKey(fmt.Sprintf("user-%d", n)))
+	})
+
+	It("should reject an invalid pool", func() {
+		_, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:       opSpecs,
+			SessionIPPool: "2001:db8::/64",
+		}, loglevel)
+		Expect(err).To(HaveOccurred())
+
+		_, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:         opSpecs,
+			SessionIPv6Pool: "10.60.0.0/24",
+		}, loglevel)
+		Expect(err).To(HaveOccurred())
+	})
+})
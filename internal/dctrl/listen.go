@@ -0,0 +1,96 @@
+package dctrl
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenAddr is an address the control plane binds a server to.
+type listenAddr struct {
+	name, addr string
+}
+
+// checkListenAddrs rejects the configurations in which two servers would bind the same port, e.g.,
+// the service server serving the metrics and the health probe server. Ephemeral ports (":0") never
+// collide.
+func checkListenAddrs(addrs ...listenAddr) error {
+	for i, a := range addrs {
+		if a.addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(a.addr)
+		if err != nil {
+			return fmt.Errorf("invalid %s address %q: %w", a.name, a.addr, err)
+		}
+		if port == "0" {
+			continue
+		}
+
+		for _, b := range addrs[i+1:] {
+			if b.addr == "" {
+				continue
+			}
+			h, p, err := net.SplitHostPort(b.addr)
+			if err != nil {
+				return fmt.Errorf("invalid %s address %q: %w", b.name, b.addr, err)
+			}
+			if p == port && (h == host || isWildcardHost(h) || isWildcardHost(host)) {
+				return fmt.Errorf("%s address %q collides with %s address %q",
+					b.name, b.addr, a.name, a.addr)
+			}
+		}
+	}
+	return nil
+}
+
+func isWildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+// listen binds a server before it is started so that an address already in use is reported as a
+// startup error instead of being logged from the serving goroutine.
+func listen(name, addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind the %s server to %q (address in use by another "+
+			"process or dctrl instance?): %w", name, addr, err)
+	}
+	return l, nil
+}
+
+// listenEphemeral binds a port on the host chosen by the OS for the API server. The listener holds
+// the port until the API server is created, so no other process can take it in the meantime; the
+// embedded API server binds its address by itself, hence the listener is closed right before.
+func listenEphemeral(host string) (net.Listener, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind an ephemeral port for the API server on %q: %w", host, err)
+	}
+	return l, nil
+}
+
+// APIServerPort returns the port of the API server, e.g., to find the port chosen for
+// EphemeralAPIServerPort.
+func (d *Dctrl) APIServerPort() int { return d.apiServerPort }
+
+// ServiceAddr returns the address the service server serving the metrics is bound to, e.g., to
+// find the ephemeral port chosen for ":0". Empty if the server is not running.
+func (d *Dctrl) ServiceAddr() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.run == nil {
+		return ""
+	}
+	return d.run.serviceAddr
+}
+
+// HealthProbeAddr returns the address the health probe server is bound to. Empty if the server is
+// not running.
+func (d *Dctrl) HealthProbeAddr() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.run == nil {
+		return ""
+	}
+	return d.run.healthProbeAddr
+}
@@ -0,0 +1,122 @@
+package dctrl_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Metrics bind address", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should reject colliding service and health probe addresses", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:         opSpecs,
+			HTTPMode:        true,
+			DisableAuth:     true,
+			ServiceAddr:     "localhost:18081",
+			HealthProbeAddr: ":18081",
+			Logger:          logr.Discard(),
+		})
+		Expect(err).To(MatchError(ContainSubstring("collides")))
+	})
+
+	It("should serve the metrics of two instances on ephemeral ports", func() {
+		d1, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		d2, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, d := range []*dctrl.Dctrl{d1, d2} {
+			Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+			Eventually(func() (int, error) {
+				res, err := http.Get("http://" + d.ServiceAddr() + "/metrics")
+				if err != nil {
+					return 0, err
+				}
+				defer res.Body.Close() //nolint:errcheck
+				return res.StatusCode, nil
+			}, timeout, interval).Should(Equal(http.StatusOK))
+		}
+		Expect(d1.ServiceAddr()).NotTo(Equal(d2.ServiceAddr()))
+	})
+
+	It("should fail the startup with a clear error if the metrics port is in use", func() {
+		l, err := net.Listen("tcp", "localhost:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close() //nolint:errcheck
+
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:     opSpecs,
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			ServiceAddr: l.Addr().String(),
+			Logger:      logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- d.Start(ctx) }()
+		Eventually(errCh, timeout, interval).Should(Receive(MatchError(
+			ContainSubstring("failed to bind the service server"))))
+	})
+
+	It("should bind the API server to an ephemeral port", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:       opSpecs,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		port := d.APIServerPort()
+		Expect(port).To(BeNumerically(">", 0))
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}, timeout, interval).Should(Succeed())
+	})
+
+	It("should reject a negative API server port", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:       opSpecs,
+			APIServerPort: -2,
+			HTTPMode:      true,
+			DisableAuth:   true,
+			Logger:        logr.Discard(),
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid API server port")))
+	})
+})
@@ -0,0 +1,323 @@
+package dctrl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Condition transition metrics", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should count the condition transitions by reason", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		counter := func(condType, reason string) func() float64 {
+			return func() float64 {
+				return testutil.ToFloat64(metrics.ConditionTransitions.WithLabelValues("amf",
+					condType, "False", reason))
+			}
+		}
+		encryption := counter("Validated", "EncyptionNotSupported")()
+		supi := counter("Authenticated", "SupiNotFound")()
+
+		create := func(name, suci, algorithm string) {
+			yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %[2]s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "%[3]s"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name, suci, algorithm)
+			reg := object.New()
+			Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+			Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+		}
+
+		// an unsupported cypher and an unknown user
+		create("user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0", "dummy")
+		create("user-2", "dummy", "5G-EA2")
+
+		Eventually(counter("Validated", "EncyptionNotSupported"), timeout, interval).
+			Should(BeNumerically("==", encryption+1))
+		Eventually(counter("Authenticated", "SupiNotFound"), timeout, interval).
+			Should(BeNumerically("==", supi+1))
+	})
+
+	It("should know every reason set by the operators", func() {
+		// the reasons set or matched in the operator specs
+		reasonRe := regexp.MustCompile(`^[A-Z][A-Za-z]+$`)
+		emitted := map[string]string{}
+		var walk func(file string, n any)
+		walk = func(file string, n any) {
+			switch n := n.(type) {
+			case map[string]any:
+				for k, v := range n {
+					if s, ok := v.(string); ok && k == "reason" && reasonRe.MatchString(s) {
+						emitted[s] = file
+					}
+					if args, ok := v.([]any); ok && k == "@eq" && len(args) == 2 {
+						for i, a := range args {
+							path, _ := args[1-i].(string)
+							if s, ok := a.(string); ok && strings.HasSuffix(path, ".reason") && reasonRe.MatchString(s) {
+								emitted[s] = file
+							}
+						}
+					}
+					walk(file, v)
+				}
+			case []any:
+				for _, v := range n {
+					walk(file, v)
+				}
+			}
+		}
+		files, err := filepath.Glob("../operators/*.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).NotTo(BeEmpty())
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			var spec any
+			Expect(yaml.Unmarshal(data, &spec)).To(Succeed(), file)
+			walk(file, spec)
+		}
+
+		// the reason constants of the native controllers
+		f, err := parser.ParseFile(token.NewFileSet(), "../metrics/reasons.go", nil, 0)
+		Expect(err).NotTo(HaveOccurred())
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				for _, v := range spec.(*ast.ValueSpec).Values {
+					if lit, ok := v.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						emitted[strings.Trim(lit.Value, `"`)] = "reasons.go"
+					}
+				}
+			}
+		}
+
+		Expect(emitted).To(HaveKey("AuthenticationPending"))
+		for reason, file := range emitted {
+			Expect(metrics.KnownReason(reason)).To(BeTrue(), "reason %s of %s is not known", reason, file)
+		}
+	})
+})
+
+var _ = Describe("Reconcile metrics", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should serve the reconcile counts of the operators", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		// scrape returns the value of a sample of the metrics endpoint, 0 if not found
+		scrape := func(sample string) func() float64 {
+			re := regexp.MustCompile("(?m)^" + regexp.QuoteMeta(sample) + ` (\S+)$`)
+			return func() float64 {
+				res, err := http.Get("http://" + d.ServiceAddr() + "/metrics")
+				if err != nil {
+					return -1
+				}
+				defer res.Body.Close() //nolint:errcheck
+				body, err := io.ReadAll(res.Body)
+				if err != nil {
+					return -1
+				}
+				m := re.FindSubmatch(body)
+				if m == nil {
+					return 0
+				}
+				v, err := strconv.ParseFloat(string(m[1]), 64)
+				if err != nil {
+					return -1
+				}
+				return v
+			}
+		}
+		total := scrape(`dctrl5g_reconcile_total{kind="Registration",operator="amf",result="success"}`)
+		durations := scrape(`dctrl5g_reconcile_duration_seconds_count{kind="Registration",operator="amf"}`)
+		Eventually(total, timeout, interval).Should(BeNumerically(">=", 0))
+		before, beforeDurations := total(), durations()
+
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+
+		Eventually(total, timeout, interval).Should(BeNumerically(">", before))
+		Eventually(durations, timeout, interval).Should(BeNumerically(">", beforeDurations))
+	})
+
+	It("should count each pipeline evaluation of a declarative controller once", func() {
+		count := func(result string) float64 {
+			return testutil.ToFloat64(metrics.ReconcileTotal.WithLabelValues("test", "TestKind", result))
+		}
+		success, failure := count(metrics.ResultSuccess), count(metrics.ResultError)
+
+		obj := object.NewViewObject("test", "TestKind")
+		object.SetName(obj, "default", "test")
+		p := metrics.InstrumentPipeline("test", &testPipeline{})
+		_, err := p.Evaluate(object.Delta{Type: object.Added, Object: obj})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = p.Evaluate(object.Delta{Type: object.Deleted, Object: obj})
+		Expect(err).To(HaveOccurred())
+
+		Expect(count(metrics.ResultSuccess)).To(BeNumerically("==", success+1))
+		Expect(count(metrics.ResultError)).To(BeNumerically("==", failure+1))
+	})
+})
+
+// testPipeline passes the additions through and fails on anything else.
+type testPipeline struct{}
+
+func (p *testPipeline) Evaluate(delta object.Delta) ([]object.Delta, error) {
+	if delta.Type != object.Added {
+		return nil, errors.New("unexpected delta")
+	}
+	return []object.Delta{delta}, nil
+}
+
+func (p *testPipeline) String() string { return "test-pipeline" }
+
+var _ = Describe("Manager metrics", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// families returns a poller for the names of the metric families served by the metrics
+	// endpoint
+	families := func(d *dctrl.Dctrl) func() []string {
+		re := regexp.MustCompile(`(?m)^# TYPE (\S+) `)
+		return func() []string {
+			res, err := http.Get("http://" + d.ServiceAddr() + "/metrics")
+			if err != nil {
+				return nil
+			}
+			defer res.Body.Close() //nolint:errcheck
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				return nil
+			}
+			ret := []string{}
+			for _, m := range re.FindAllSubmatch(body, -1) {
+				ret = append(ret, string(m[1]))
+			}
+			return ret
+		}
+	}
+
+	It("should serve the controller-runtime metrics if enabled", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:        opSpecs,
+			ServiceAddr:    "localhost:0",
+			ManagerMetrics: true,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the init pipelines trigger the reconciles of the native controllers
+		Eventually(families(d), timeout, interval).Should(ContainElements(
+			"controller_runtime_reconcile_total",
+			"workqueue_adds_total",
+			"go_goroutines",
+			"dctrl5g_reconcile_total",
+		))
+	})
+
+	It("should serve the dctrl5g metrics only by default", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(families(d), timeout, interval).Should(ContainElement("dctrl5g_reconcile_total"))
+		Expect(families(d)()).To(HaveEach(HavePrefix(metrics.Prefix)))
+	})
+})
@@ -0,0 +1,101 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// metricsLogger periodically logs a summary of the key metrics, for the deployments with no
+// metrics scraper. The active registrations and sessions are taken from the counter view if
+// enabled, and counted in the aggregate tables otherwise. The error counts are the totals of the
+// error counters of the metrics registry.
+type metricsLogger struct {
+	client   client.Client
+	counters *counterView
+	interval time.Duration
+	log      logr.Logger
+}
+
+func newMetricsLogger(c client.Client, counters *counterView, interval time.Duration, logger logr.Logger) *metricsLogger {
+	return &metricsLogger{
+		client:   c,
+		counters: counters,
+		interval: interval,
+		log:      logger.WithName("metrics-log"),
+	}
+}
+
+// Start runs the logging loop until the context is cancelled.
+func (m *metricsLogger) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.summarize(ctx); err != nil {
+				m.log.Error(err, "failed to summarize the metrics")
+			}
+		}
+	}
+}
+
+func (m *metricsLogger) summarize(ctx context.Context) error {
+	counts, err := m.counts(ctx)
+	if err != nil {
+		return err
+	}
+	errs, err := metrics.GetErrorCounts()
+	if err != nil {
+		return fmt.Errorf("failed to gather the metrics: %w", err)
+	}
+
+	m.log.Info("metrics summary", "registrations", counts.Registrations, "sessions", counts.Sessions,
+		"idleSessions", counts.IdleSessions, "reconcileErrors", errs.ReconcileErrors,
+		"failedConditions", errs.FailedConditions, "droppedEvents", errs.DroppedEvents)
+	return nil
+}
+
+// counts returns the sizes of the aggregate tables. A table not yet created is empty.
+func (m *metricsLogger) counts(ctx context.Context) (Counts, error) {
+	if m.counters != nil {
+		return m.counters.Get(), nil
+	}
+
+	var counts Counts
+	for _, t := range aggregateTables {
+		table := object.NewViewObject(t.operator, t.kind)
+		object.SetName(table, "", t.name)
+		if err := m.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return Counts{}, fmt.Errorf("failed to get %s/%s: %w", t.operator, t.kind, err)
+		}
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		switch t.kind {
+		case "ActiveRegistrationTable":
+			counts.Registrations = int64(len(entries))
+		case "ActiveSessionTable":
+			counts.Sessions = int64(len(entries))
+			for _, e := range entries {
+				if entry, ok := e.(map[string]any); ok && entry["idle"] == true {
+					counts.IdleSessions++
+				}
+			}
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,92 @@
+package dctrl_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr/funcr"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Metrics summary log", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should periodically log a summary of the metrics", func() {
+		var mu sync.Mutex
+		lines := []string{}
+		logger := funcr.New(func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, args)
+		}, funcr.Options{})
+
+		// summaries returns a poller for the metrics summary lines logged so far
+		summaries := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			ret := []string{}
+			for _, l := range lines {
+				if strings.Contains(l, `"msg"="metrics summary"`) {
+					ret = append(ret, l)
+				}
+			}
+			return ret
+		}
+
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:            opSpecs,
+			APIServerPort:      dctrl.EphemeralAPIServerPort,
+			HTTPMode:           true,
+			DisableAuth:        true,
+			KeyFile:            keyFile,
+			MetricsLogInterval: 50 * time.Millisecond,
+			Logger:             logger,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+		go func() {
+			defer GinkgoRecover()
+			Expect(d.Start(ctx)).To(Succeed())
+		}()
+
+		Eventually(summaries, timeout, interval).ShouldNot(BeEmpty())
+		Expect(summaries()[0]).To(And(
+			MatchRegexp(`"registrations"=\d+`),
+			MatchRegexp(`"sessions"=\d+`),
+			MatchRegexp(`"idleSessions"=\d+`),
+			MatchRegexp(`"reconcileErrors"=\d+`),
+			MatchRegexp(`"failedConditions"=\d+`),
+			MatchRegexp(`"droppedEvents"=\d+`),
+		))
+
+		// the summary follows the active sessions
+		c := d.GetCache().GetClient()
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(1))).To(Succeed())
+		active := regexp.MustCompile(`"sessions"=[1-9]`)
+		Eventually(func() bool {
+			s := summaries()
+			return len(s) > 0 && active.MatchString(s[len(s)-1])
+		}, timeout, interval).Should(BeTrue())
+	})
+})
@@ -0,0 +1,64 @@
+package dctrl
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "github.com/l7mp/dcontroller/pkg/api/view/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/apiserver"
+	"github.com/l7mp/dcontroller/pkg/operator"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// addWatchController adds a native controller to a declarative operator that calls the
+// reconciler on each change of the given kind of the operator.
+func addWatchController(op *trackedOperator, opName, name, kind string, r reconcile.TypedReconciler[reconciler.Request]) error {
+	mgr := op.GetManager()
+
+	on := true
+	ctrl, err := controller.NewTyped(name, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler:         op.work.TrackReconciler(metrics.InstrumentReconciler(opName, r)),
+		NewQueue:           op.work.NewQueue(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s := reconciler.NewSource(mgr, opName, opv1a1.Source{
+		Resource: opv1a1.Resource{
+			Kind: kind,
+		},
+	})
+	gvk, err := s.GetGVK()
+	if err != nil {
+		return fmt.Errorf("failed to get GVK for source: %w", err)
+	}
+
+	src, err := s.GetSource()
+	if err != nil {
+		return fmt.Errorf("failed to create source: %w", err)
+	}
+
+	if err := ctrl.Watch(src); err != nil {
+		return fmt.Errorf("failed to create watch: %w", err)
+	}
+
+	op.AddNativeController(name, ctrl, []schema.GroupVersionKind{gvk})
+
+	return nil
+}
+
+// registerNativeKinds re-registers the API group of a declarative operator, so that the kinds
+// watched only by the native controllers added to the operator are served too: the operator
+// registers the group with the kinds of the declarative controllers on creation.
+func registerNativeKinds(apiServer *apiserver.APIServer, op *operator.Operator, opName string) error {
+	apiServer.UnregisterAPIGroup(viewv1a1.Group(opName))
+	return op.RegisterGVKs()
+}
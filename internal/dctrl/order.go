@@ -0,0 +1,120 @@
+package dctrl
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+)
+
+// startupOrder returns the operator names in dependency order: each operator follows the
+// operators it depends on, otherwise the declaration order is kept. Operators are shut down in
+// the reverse order.
+func startupOrder(names []string, deps map[string][]string) ([]string, error) {
+	for n, ds := range deps {
+		for _, dep := range ds {
+			if !slices.Contains(names, dep) {
+				return nil, fmt.Errorf("operator %q depends on unknown operator %q", n, dep)
+			}
+		}
+	}
+
+	order := make([]string, 0, len(names))
+	done := map[string]bool{}
+	for len(order) < len(names) {
+		progress := false
+		for _, n := range names {
+			if done[n] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[n] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				order = append(order, n)
+				done[n] = true
+				progress = true
+				// restart from the top to keep the declaration order
+				break
+			}
+		}
+		if !progress {
+			pending := []string{}
+			for _, n := range names {
+				if !done[n] {
+					pending = append(pending, n)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle among operators %v", pending)
+		}
+	}
+
+	return order, nil
+}
+
+// checkRequirements checks that the operators required by the declarative operators are loaded.
+// The UDM is always loaded.
+func checkRequirements(specs []OpSpec) error {
+	names := []string{udm.OperatorName}
+	for _, s := range specs {
+		names = append(names, s.Name)
+	}
+	for _, s := range specs {
+		for _, r := range s.Requires {
+			if !slices.Contains(names, r) {
+				return fmt.Errorf("operator %q requires operator %q, which is not enabled", s.Name, r)
+			}
+		}
+	}
+	return nil
+}
+
+// SelectOpSpecs returns the declarative operators to load: the enabled ones, or all if none is
+// enabled explicitly, minus the disabled ones. The startup dependencies on the operators not
+// selected are dropped, and an error is returned if a selected operator requires an operator not
+// selected. The UDM, loaded manually, can be enabled but not disabled.
+func SelectOpSpecs(specs []OpSpec, enabled, disabled []string) ([]OpSpec, error) {
+	known := []string{udm.OperatorName}
+	for _, s := range specs {
+		known = append(known, s.Name)
+	}
+	for _, n := range append(slices.Clone(enabled), disabled...) {
+		if !slices.Contains(known, n) {
+			return nil, fmt.Errorf("unknown operator %q, known operators: %v", n, known)
+		}
+	}
+	if slices.Contains(disabled, udm.OperatorName) {
+		return nil, fmt.Errorf("operator %q cannot be disabled", udm.OperatorName)
+	}
+
+	selected := func(name string) bool {
+		if name == udm.OperatorName {
+			return true
+		}
+		return (len(enabled) == 0 || slices.Contains(enabled, name)) && !slices.Contains(disabled, name)
+	}
+
+	ret := []OpSpec{}
+	for _, s := range specs {
+		if !selected(s.Name) {
+			continue
+		}
+		deps := []string{}
+		for _, d := range s.DependsOn {
+			if selected(d) {
+				deps = append(deps, d)
+			}
+		}
+		s.DependsOn = deps
+		ret = append(ret, s)
+	}
+
+	if err := checkRequirements(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
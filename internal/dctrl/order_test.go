@@ -0,0 +1,67 @@
+package dctrl_test
+
+import (
+	"context"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Operator ordering", func() {
+	It("should shut down the operators in the reverse of the startup order", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		eventCtx, eventCancel := context.WithCancel(context.Background())
+		defer eventCancel()
+
+		// amf -> smf -> pcf -> udm
+		specs := []dctrl.OpSpec{
+			{Name: "amf", File: "../operators/amf.yaml", DependsOn: []string{"smf"}},
+			{Name: "smf", File: "../operators/smf.yaml", DependsOn: []string{"pcf"}},
+			{Name: "pcf", File: "../operators/pcf.yaml", DependsOn: []string{"udm"}},
+		}
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: specs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		events := d.Events(eventCtx)
+		collect := func(t dctrl.EventType, names *[]string) func() int {
+			return func() int {
+				for {
+					select {
+					case e := <-events:
+						if e.Type == t {
+							*names = append(*names, e.Operator)
+						}
+					default:
+						return len(*names)
+					}
+				}
+			}
+		}
+
+		started := []string{}
+		Eventually(collect(dctrl.OperatorStarted, &started), timeout, interval).Should(Equal(4))
+		Expect(started).To(Equal([]string{"udm", "pcf", "smf", "amf"}))
+
+		cancel()
+
+		stopped := []string{}
+		Eventually(collect(dctrl.OperatorStopped, &stopped), timeout, interval).Should(Equal(4))
+		slices.Reverse(started)
+		Expect(stopped).To(Equal(started))
+	})
+
+	It("should reject a dependency cycle", func() {
+		_, err := testsuite.StartOpsWithOptions(context.Background(), dctrl.Options{
+			OpSpecs: []dctrl.OpSpec{
+				{Name: "amf", File: "../operators/amf.yaml", DependsOn: []string{"smf"}},
+				{Name: "smf", File: "../operators/smf.yaml", DependsOn: []string{"amf"}},
+			},
+		}, loglevel)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,229 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	ueclient "github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+// PLMNConfig is the operator configuration of a PLMN served by the AMF.
+type PLMNConfig struct {
+	// MCC and MNC identify the PLMN, e.g., 999 and 01.
+	MCC, MNC string
+	// ServedNSSAI lists the slice types served to the UEs of the PLMN, e.g., eMBB.
+	ServedNSSAI []string
+	// GutiPrefix is the PLMN, AMF region and AMF set prefix of the GUTIs minted for the UEs of
+	// the PLMN (default: guti-<mcc>-<mnc>-3F-152).
+	GutiPrefix string
+}
+
+// ID returns the PLMN identity, e.g., 999-01.
+func (p PLMNConfig) ID() string { return p.MCC + "-" + p.MNC }
+
+// plmnTableName is the name of the AMF:PlmnTable.
+const plmnTableName = "plmns"
+
+// defaultAMFRegionSet is the AMF region and AMF set of the GUTIs of DefaultGutiPrefix.
+const defaultAMFRegionSet = "3F-152"
+
+// checkPLMNs validates the PLMN configs and fills in the default GUTI prefixes.
+func checkPLMNs(plmns []PLMNConfig) ([]PLMNConfig, error) {
+	ret := make([]PLMNConfig, 0, len(plmns))
+	seen := map[string]bool{}
+	for _, p := range plmns {
+		// the TAI rules apply to the PLMN identity
+		tai := ueclient.TrackingArea{MCC: p.MCC, MNC: p.MNC, TAC: "000000"}
+		if err := tai.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid PLMN %q: %w", p.ID(), err)
+		}
+		if seen[p.ID()] {
+			return nil, fmt.Errorf("duplicate PLMN %q", p.ID())
+		}
+		seen[p.ID()] = true
+		if p.GutiPrefix == "" {
+			p.GutiPrefix = fmt.Sprintf("guti-%s-%s-%s", p.MCC, p.MNC, defaultAMFRegionSet)
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// plmnRouter routes each registration to the config of the PLMN of its SUCI, which the pipelines
+// of the AMF cannot parse: the registrations of a configured PLMN are listed in the routes of the
+// AMF PLMN table with the NSSAI allow-list of the PLMN, from where the AMF computes the allowed
+// NSSAI, and the registrations of an unconfigured PLMN are listed as unserved, so that the AMF
+// fails them with Validated=False/PlmnNotServed.
+type plmnRouter struct {
+	client client.Client
+	plmns  []PLMNConfig
+	log    logr.Logger
+}
+
+// addPLMNRouter adds the PLMN router to the AMF operator, unless no PLMNs are configured.
+func addPLMNRouter(op *trackedOperator, c client.Client, plmns []PLMNConfig, logger logr.Logger) error {
+	if len(plmns) == 0 {
+		return nil
+	}
+	r := &plmnRouter{client: c, plmns: plmns, log: logger.WithName("plmn-router")}
+	return addWatchController(op, "amf", "plmn-router", "Registration", r)
+}
+
+func (r *plmnRouter) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object).String()
+
+	var route map[string]any
+	unserved := false
+	if req.EventType != object.Deleted {
+		suci, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "mobileIdentity", "value")
+		// a missing SUCI is failed by the AMF itself
+		if suci != "" {
+			if p := r.route(suci); p != nil {
+				route = map[string]any{
+					"registration": key,
+					"plmn":         p.ID(),
+					"servedNSSAI":  toAnySlice(p.ServedNSSAI),
+				}
+			} else {
+				r.log.V(1).Info("PLMN not served", "registration", key, "suci", suci)
+				unserved = true
+			}
+		}
+	}
+
+	if err := r.setRoute(ctx, key, route, unserved); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// route returns the config of the PLMN of a SUCI, or nil if the SUCI is malformed or the PLMN is
+// not configured.
+func (r *plmnRouter) route(suci string) *PLMNConfig {
+	u, err := ueclient.ParseSUCI(suci)
+	if err != nil {
+		return nil
+	}
+	for i := range r.plmns {
+		if r.plmns[i].ID() == u.PLMN() {
+			return &r.plmns[i]
+		}
+	}
+	return nil
+}
+
+// setRoute sets the route of a registration and whether it is unserved in the PLMN table.
+func (r *plmnRouter) setRoute(ctx context.Context, key string, route map[string]any, unserved bool) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "PlmnTable")
+		object.SetName(table, "", plmnTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		changed := false
+		routes, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "routes")
+		i := slices.IndexFunc(routes, func(e any) bool {
+			m, ok := e.(map[string]any)
+			return ok && m["registration"] == key
+		})
+		switch {
+		case route != nil && i < 0:
+			routes, changed = append(routes, route), true
+		case route != nil && routes[i].(map[string]any)["plmn"] != route["plmn"]:
+			routes[i], changed = route, true
+		case route == nil && i >= 0:
+			routes, changed = slices.Delete(routes, i, i+1), true
+		}
+
+		list, _, _ := unstructured.NestedStringSlice(table.UnstructuredContent(), "spec", "unserved")
+		j := slices.Index(list, key)
+		switch {
+		case unserved && j < 0:
+			list, changed = append(list, key), true
+		case !unserved && j >= 0:
+			list, changed = slices.Delete(list, j, j+1), true
+		}
+
+		if !changed {
+			return nil
+		}
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), routes,
+			"spec", "routes"); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedStringSlice(table.UnstructuredContent(), list,
+			"spec", "unserved"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		// the table may not be initialized yet: retry
+		return fmt.Errorf("failed to update the PLMN table: %w", err)
+	}
+	return nil
+}
+
+func toAnySlice(s []string) []any {
+	ret := make([]any, 0, len(s))
+	for _, e := range s {
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// plmnGutiAllocator mints the GUTIs of the UEs under the GUTI prefix of the PLMN of their SUPI,
+// using the default allocator for the SUPIs of no configured PLMN.
+type plmnGutiAllocator struct {
+	plmns      []PLMNConfig
+	allocators map[string]GutiAllocator // keyed by the GUTI prefix
+	fallback   GutiAllocator
+}
+
+func newPLMNGutiAllocator(plmns []PLMNConfig) GutiAllocator {
+	a := &plmnGutiAllocator{
+		plmns:      plmns,
+		allocators: map[string]GutiAllocator{},
+		fallback:   NewGutiAllocator(DefaultGutiPrefix),
+	}
+	for _, p := range plmns {
+		a.allocators[p.GutiPrefix] = NewGutiAllocator(p.GutiPrefix)
+	}
+	return a
+}
+
+// Allocate mints a GUTI for a SUPI of the form imsi-<mcc><mnc><msin>.
+func (a *plmnGutiAllocator) Allocate(supi string) (string, error) {
+	allocator := a.fallback
+	imsi := strings.TrimPrefix(supi, "imsi-")
+	for _, p := range a.plmns {
+		if strings.HasPrefix(imsi, p.MCC+p.MNC) {
+			allocator = a.allocators[p.GutiPrefix]
+			break
+		}
+	}
+	return allocator.Allocate(supi)
+}
+
+func (a *plmnGutiAllocator) Release(guti string) {
+	allocator := a.fallback
+	for prefix, pa := range a.allocators {
+		if strings.HasPrefix(guti, prefix+"-") {
+			allocator = pa
+			break
+		}
+	}
+	allocator.Release(guti)
+}
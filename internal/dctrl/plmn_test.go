@@ -0,0 +1,107 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Multiple PLMNs", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs: opSpecs,
+			PLMNs: []dctrl.PLMNConfig{
+				{MCC: "999", MNC: "01", ServedNSSAI: []string{"eMBB"}},
+				{MCC: "999", MNC: "02", ServedNSSAI: []string{"eMBB", "URLLC"}},
+			},
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name, suci, slice string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %[2]s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  ueStatus:
+    n1Mode: true
+  requestedNSSAI:
+    - sliceType: %[3]s`, name, suci, slice)
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	// validated returns a poller for the status and the reason of the Validated condition and the
+	// allowed slice types of a registration
+	validated := func(name string) func() []string {
+		return func() []string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return nil
+			}
+			ret := []string{}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, c := range conds {
+				if cond, ok := c.(map[string]any); ok && cond["type"] == "Validated" {
+					ret = append(ret, fmt.Sprint(cond["status"]), fmt.Sprint(cond["reason"]))
+				}
+			}
+			nssai, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "allowedNSSAI")
+			for _, s := range nssai {
+				if slice, ok := s.(map[string]any); ok {
+					ret = append(ret, fmt.Sprint(slice["sliceType"]))
+				}
+			}
+			return ret
+		}
+	}
+
+	It("should apply the slice permissions of the PLMN of the SUCI", func() {
+		register("user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0", "URLLC")
+		register("user-2", "suci-0-999-02-02-4f2a7b9c8d13e7a5c1", "URLLC")
+
+		Eventually(validated("user-1"), timeout, interval).Should(Equal([]string{"False", "NoAllowedNSSAI"}))
+		Eventually(validated("user-2"), timeout, interval).Should(Equal([]string{"True", "Validated", "URLLC"}))
+	})
+
+	It("should reject a registration of an unconfigured PLMN", func() {
+		register("user-1", "suci-0-310-170-02-4f2a7b9c8d13e7a5c0", "eMBB")
+
+		Eventually(validated("user-1"), timeout, interval).Should(Equal([]string{"False", "PlmnNotServed"}))
+	})
+})
@@ -0,0 +1,278 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/apiserver"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// sessionPolicyTableName is the name of the PCF:SessionPolicyTable.
+const sessionPolicyTableName = "session-policies"
+
+// policyRule is a pcf/PolicyRule.
+type policyRule struct {
+	name       string
+	precedence int64
+	nssai, dnn string
+	// hours is the [start, end) range of the hour of the day the rule applies in, nil for any
+	hours *[2]int64
+	// decision is the 5QI, the ARP and the bit rates the rule grants
+	decision map[string]any
+}
+
+// matches returns whether the rule applies to a session with the given slice and DNN at the given
+// hour of the day. The range of hours wraps around midnight if the end is before the start, and an
+// empty range covers the whole day.
+func (p *policyRule) matches(nssai, dnn string, hour int64) bool {
+	if p.nssai != "" && p.nssai != nssai {
+		return false
+	}
+	if p.dnn != "" && p.dnn != dnn {
+		return false
+	}
+	if p.hours == nil {
+		return true
+	}
+	start, end := p.hours[0], p.hours[1]
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return hour >= start && hour < end
+	default:
+		return hour >= start || hour < end
+	}
+}
+
+// policySubject is what the policy rules match a session on.
+type policySubject struct {
+	nssai, dnn string
+}
+
+// policyRuleEngine evaluates the pcf/PolicyRules against the smf/SessionContexts and publishes the
+// resulting decisions in the pcf/SessionPolicyTable, from where the SMF applies them to the
+// sessions. A rule matches on the slice, the DNN and the hour of the day, each optional:
+//
+//	apiVersion: pcf.view.dcontroller.io/v1alpha1
+//	kind: PolicyRule
+//	metadata:
+//	  name: embb-daytime
+//	spec:
+//	  precedence: 10
+//	  match:
+//	    nssai: eMBB
+//	    dnn: internet
+//	    hours: {start: 8, end: 20}
+//	  fiveQI: BestEffort
+//	  arp: {priorityLevel: 8, preemptionCapability: false, preemptionVulnerability: true}
+//	  bitRates: {uplinkBwKbps: 64, downlinkBwKbps: 256}
+//
+// Of the rules matching a session, the one with the lowest precedence applies, the ties broken by
+// the namespace and the name of the rules, so the outcome does not depend on the order the rules
+// were added in. The rules are re-evaluated on each change of the rules, so that the rules can be
+// added and removed at runtime, and at each full hour.
+type policyRuleEngine struct {
+	client   client.Client
+	mu       sync.Mutex
+	now      func() time.Time
+	sessions map[client.ObjectKey]policySubject
+	log      logr.Logger
+}
+
+func newPolicyRuleEngine(c client.Client, logger logr.Logger) *policyRuleEngine {
+	return &policyRuleEngine{
+		client:   c,
+		now:      time.Now,
+		sessions: map[client.ObjectKey]policySubject{},
+		log:      logger.WithName("policy-rules"),
+	}
+}
+
+// hooks returns the hooks adding the rule watcher to the PCF, which serves the PolicyRule
+// resource, and the session watcher to the SMF.
+func (e *policyRuleEngine) hooks(apiServer *apiserver.APIServer) []operatorHook {
+	return []operatorHook{{
+		view: pcfView,
+		what: "create the policy rule engine",
+		add: func(op *trackedOperator, opName string) error {
+			if err := addWatchController(op, opName, "policy-rule-engine", "PolicyRule",
+				reconcile.TypedFunc[reconciler.Request](e.reconcileRule)); err != nil {
+				return err
+			}
+			return registerNativeKinds(apiServer, op.Operator, opName)
+		},
+	}, {
+		view: smfView,
+		what: "create the policy rule engine",
+		add: func(op *trackedOperator, opName string) error {
+			return addWatchController(op, opName, "policy-rule-sessions", "SessionContext",
+				reconcile.TypedFunc[reconciler.Request](e.reconcileSession))
+		},
+	}}
+}
+
+func (e *policyRuleEngine) reconcileRule(ctx context.Context, _ reconciler.Request) (reconcile.Result, error) {
+	return reconcile.Result{}, e.evaluate(ctx)
+}
+
+func (e *policyRuleEngine) reconcileSession(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+	subject, ok := policySubject{}, false
+	if req.EventType != object.Deleted {
+		spec, _, _ := unstructured.NestedMap(req.Object.UnstructuredContent(), "spec")
+		subject.nssai, _ = spec["nssai"].(string)
+		subject.dnn, _ = spec["dnn"].(string)
+		ok = true
+	}
+
+	e.mu.Lock()
+	current, known := e.sessions[key]
+	if ok {
+		e.sessions[key] = subject
+	} else {
+		delete(e.sessions, key)
+	}
+	e.mu.Unlock()
+
+	// only a new session, a deleted one or a change of the slice or the DNN affects the decisions
+	if known == ok && current == subject {
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{}, e.evaluate(ctx)
+}
+
+// Start re-evaluates the rules at each full hour, when the rules matching on the hour of the day
+// may come into or go out of effect.
+func (e *policyRuleEngine) Start(ctx context.Context) {
+	for {
+		e.mu.Lock()
+		now := e.now()
+		e.mu.Unlock()
+		next := now.Truncate(time.Hour).Add(time.Hour)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+			if err := e.evaluate(ctx); err != nil {
+				e.log.Error(err, "failed to evaluate the policy rules")
+			}
+		}
+	}
+}
+
+// listRules returns the policy rules in the order of precedence.
+func (e *policyRuleEngine) listRules(ctx context.Context) ([]*policyRule, error) {
+	list := cache.NewViewObjectList("pcf", "PolicyRule")
+	if err := e.client.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("failed to list pcf/PolicyRules: %w", err)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		pi, _, _ := unstructured.NestedInt64(list.Items[i].Object, "spec", "precedence")
+		pj, _, _ := unstructured.NestedInt64(list.Items[j].Object, "spec", "precedence")
+		if pi != pj {
+			return pi < pj
+		}
+		if list.Items[i].GetNamespace() != list.Items[j].GetNamespace() {
+			return list.Items[i].GetNamespace() < list.Items[j].GetNamespace()
+		}
+		return list.Items[i].GetName() < list.Items[j].GetName()
+	})
+
+	rules := make([]*policyRule, 0, len(list.Items))
+	for i := range list.Items {
+		obj := list.Items[i].Object
+		r := &policyRule{name: list.Items[i].GetName(), decision: map[string]any{}}
+		r.precedence, _, _ = unstructured.NestedInt64(obj, "spec", "precedence")
+		r.nssai, _, _ = unstructured.NestedString(obj, "spec", "match", "nssai")
+		r.dnn, _, _ = unstructured.NestedString(obj, "spec", "match", "dnn")
+		if hours, ok, _ := unstructured.NestedMap(obj, "spec", "match", "hours"); ok {
+			start, _, _ := unstructured.NestedInt64(hours, "start")
+			end, _, _ := unstructured.NestedInt64(hours, "end")
+			if start < 0 || start > 24 || end < 0 || end > 24 {
+				e.log.Info("ignoring policy rule with an invalid range of hours", "rule", r.name,
+					"start", start, "end", end)
+				continue
+			}
+			r.hours = &[2]int64{start % 24, end % 24}
+		}
+		for _, f := range []string{"fiveQI", "arp", "bitRates"} {
+			if v, ok, _ := unstructured.NestedFieldNoCopy(obj, "spec", f); ok && v != nil {
+				r.decision[f] = runtime.DeepCopyJSONValue(v)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// evaluate matches the sessions against the rules and writes the decisions into the
+// pcf/SessionPolicyTable. The evaluations are serialized so that a stale one cannot overwrite a
+// newer one.
+func (e *policyRuleEngine) evaluate(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules, err := e.listRules(ctx)
+	if err != nil {
+		return err
+	}
+	hour := int64(e.now().Hour())
+
+	keys := make([]client.ObjectKey, 0, len(e.sessions))
+	for k := range e.sessions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	entries := []any{}
+	for _, k := range keys {
+		s := e.sessions[k]
+		for _, r := range rules {
+			if !r.matches(s.nssai, s.dnn, hour) {
+				continue
+			}
+			entry := map[string]any{"name": k.Name, "namespace": k.Namespace, "rule": r.name}
+			for f, v := range r.decision {
+				entry[f] = runtime.DeepCopyJSONValue(v)
+			}
+			entries = append(entries, entry)
+			break
+		}
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("pcf", "SessionPolicyTable")
+		if err := e.client.Get(ctx, client.ObjectKey{Name: sessionPolicyTableName}, table); err != nil {
+			return err
+		}
+		current, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "sessions")
+		if reflect.DeepEqual(current, entries) {
+			return nil
+		}
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), entries, "spec", "sessions"); err != nil {
+			return err
+		}
+		e.log.V(2).Info("updating session policy table", "sessions", len(entries), "hour", hour)
+		return e.client.Update(ctx, table)
+	})
+	// the table is created by the PCF
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("PCF policy rules", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// at returns a clock stopped at the given hour of the day
+	at := func(hour int) func() time.Time {
+		t := time.Date(2025, 11, 3, hour, 30, 0, 0, time.UTC)
+		return func() time.Time { return t }
+	}
+
+	createRule := func(name string, precedence int, match string, uplink, downlink int) {
+		rule := object.New()
+		Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: pcf.view.dcontroller.io/v1alpha1
+kind: PolicyRule
+metadata:
+  name: %s
+spec:
+  precedence: %d
+  match: %s
+  fiveQI: BestEffort
+  arp:
+    priorityLevel: %d
+  bitRates:
+    uplinkBwKbps: %d
+    downlinkBwKbps: %d`, name, precedence, match, precedence, uplink, downlink)), &rule)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, rule)).To(Succeed())
+	}
+
+	// policy returns a poller for the name of the rule applied to the session and the bit rates
+	// of its flow
+	policy := func(name string) func() []any {
+		return func() []any {
+			obj := object.NewViewObject("smf", "SessionContext")
+			object.SetName(obj, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return nil
+			}
+			rule, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "status", "qos", "policy", "rule")
+			flows, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "qos", "flows")
+			if len(flows) == 0 {
+				return []any{rule, nil}
+			}
+			bitRates, _, _ := unstructured.NestedMap(flows[0].(map[string]any), "bitRates")
+			return []any{rule, bitRates}
+		}
+	}
+
+	bitRates := func(uplink, downlink int) map[string]any {
+		return map[string]any{"uplinkBwKbps": int64(uplink), "downlinkBwKbps": int64(downlink)}
+	}
+
+	It("should apply the rule in effect at the time of the day", func() {
+		Expect(dctrl.SetPolicyClock(ctx, d, at(10))).To(Succeed())
+
+		sess := newSessionContext(1)
+		Expect(unstructured.SetNestedField(sess.UnstructuredContent(), "internet", "spec", "dnn")).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, sess)).To(Succeed())
+
+		// the rules are added with the session running, in reverse order of precedence
+		createRule("embb-any", 100, "{nssai: eMBB}", 32, 32)
+		createRule("embb-night", 20, "{nssai: eMBB, dnn: internet, hours: {start: 20, end: 8}}", 100, 120)
+		createRule("embb-day", 10, "{nssai: eMBB, dnn: internet, hours: {start: 8, end: 20}}", 64, 96)
+		createRule("ims-day", 1, "{nssai: eMBB, dnn: ims, hours: {start: 8, end: 20}}", 16, 16)
+
+		Eventually(policy("user-1"), timeout, interval).Should(Equal([]any{"embb-day", bitRates(64, 96)}))
+
+		// the same session at night
+		Expect(dctrl.SetPolicyClock(ctx, d, at(22))).To(Succeed())
+		Eventually(policy("user-1"), timeout, interval).Should(Equal([]any{"embb-night", bitRates(100, 120)}))
+
+		// the night rule covers the small hours too
+		Expect(dctrl.SetPolicyClock(ctx, d, at(3))).To(Succeed())
+		Consistently(policy("user-1"), "500ms", interval).Should(Equal([]any{"embb-night", bitRates(100, 120)}))
+
+		// the rules can be removed at runtime
+		rule := object.NewViewObject("pcf", "PolicyRule")
+		object.SetName(rule, "", "embb-night")
+		Expect(c.Delete(ctx, rule)).To(Succeed())
+		Eventually(policy("user-1"), timeout, interval).Should(Equal([]any{"embb-any", bitRates(32, 32)}))
+	})
+})
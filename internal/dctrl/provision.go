@@ -0,0 +1,353 @@
+package dctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+	"github.com/hsnlab/dctrl5g/internal/sidf"
+)
+
+// subscriberNamespace is the namespace of the udm/Subscribers provisioned at runtime.
+const subscriberNamespace = "default"
+
+var (
+	// ErrInvalidSubscriber is returned for a subscriber profile that cannot be provisioned.
+	ErrInvalidSubscriber = errors.New("invalid subscriber")
+	// ErrSuciInUse is returned for a subscriber profile whose SUCI resolves to another SUPI.
+	ErrSuciInUse = errors.New("SUCI in use")
+)
+
+// SubscriberProfile is the profile of a subscriber provisioned at runtime: the subscriber record
+// of the UDM and the SUCI the UE registers with.
+type SubscriberProfile struct {
+	udm.Subscriber
+	// SUCI, if set, is the null-scheme SUCI of the UE, which is added to the AUSF:SuciToSupiTable.
+	// The concealed SUCIs are resolved by the SIDF.
+	SUCI string `json:"suci,omitempty"`
+}
+
+// PutSubscriber creates or updates the profile of a subscriber, so that a new UE can be
+// provisioned without a restart. The profile is written into the udm/Subscriber named after the
+// SUPI, from where the UDM stores the record in the subscriber store, and the SUCI, if any, into
+// the AUSF:SuciToSupiTable.
+func (d *Dctrl) PutSubscriber(ctx context.Context, p SubscriberProfile) error {
+	if p.SUPI == "" {
+		return fmt.Errorf("%w: SUPI is not specified", ErrInvalidSubscriber)
+	}
+	if errs := validation.IsDNS1123Subdomain(p.SUPI); len(errs) > 0 {
+		return fmt.Errorf("%w: invalid SUPI %q: %s", ErrInvalidSubscriber, p.SUPI, strings.Join(errs, ", "))
+	}
+	if sidf.IsConcealed(p.SUCI) {
+		return fmt.Errorf("%w: SUCI %q is concealed", ErrInvalidSubscriber, p.SUCI)
+	}
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&p.Subscriber)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSubscriber, err)
+	}
+
+	// the SUCI is claimed first so that a conflict leaves the subscriber alone
+	if err := d.setProvisionedSuci(ctx, p.SUPI, p.SUCI); err != nil {
+		return err
+	}
+
+	c := d.sharedCache.GetClient()
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject(udm.OperatorName, "Subscriber")
+		object.SetName(obj, subscriberNamespace, p.SUPI)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+				return err
+			}
+			return c.Create(ctx, obj)
+		}
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+			return err
+		}
+		return c.Update(ctx, obj)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to provision subscriber %q: %w", p.SUPI, err)
+	}
+	d.log.V(1).Info("subscriber profile provisioned", "supi", p.SUPI, "suci", p.SUCI)
+	return nil
+}
+
+// GetSubscriber returns the profile of a subscriber provisioned at runtime, or
+// udm.ErrSubscriberNotFound.
+func (d *Dctrl) GetSubscriber(ctx context.Context, supi string) (SubscriberProfile, error) {
+	obj := object.NewViewObject(udm.OperatorName, "Subscriber")
+	object.SetName(obj, subscriberNamespace, supi)
+	if err := d.sharedCache.GetClient().Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return SubscriberProfile{}, udm.ErrSubscriberNotFound
+		}
+		return SubscriberProfile{}, err
+	}
+	sucis, err := d.provisionedSucis(ctx)
+	if err != nil {
+		return SubscriberProfile{}, err
+	}
+	return subscriberProfile(obj.UnstructuredContent(), sucis), nil
+}
+
+// ListSubscribers returns the profiles of the subscribers provisioned at runtime, ordered by the
+// SUPI.
+func (d *Dctrl) ListSubscribers(ctx context.Context) ([]SubscriberProfile, error) {
+	list := cache.NewViewObjectList(udm.OperatorName, "Subscriber")
+	if err := d.sharedCache.GetClient().List(ctx, list, client.InNamespace(subscriberNamespace)); err != nil {
+		return nil, fmt.Errorf("failed to list subscribers: %w", err)
+	}
+	sucis, err := d.provisionedSucis(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]SubscriberProfile, 0, len(list.Items))
+	for i := range list.Items {
+		ret = append(ret, subscriberProfile(list.Items[i].Object, sucis))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].SUPI < ret[j].SUPI })
+	return ret, nil
+}
+
+// DeleteSubscriber deprovisions a subscriber provisioned at runtime, along with its SUCI. Returns
+// udm.ErrSubscriberNotFound if the subscriber is not provisioned.
+func (d *Dctrl) DeleteSubscriber(ctx context.Context, supi string) error {
+	obj := object.NewViewObject(udm.OperatorName, "Subscriber")
+	object.SetName(obj, subscriberNamespace, supi)
+	if err := d.sharedCache.GetClient().Delete(ctx, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return udm.ErrSubscriberNotFound
+		}
+		return fmt.Errorf("failed to deprovision subscriber %q: %w", supi, err)
+	}
+	if err := d.setProvisionedSuci(ctx, supi, ""); err != nil {
+		return err
+	}
+	d.log.V(1).Info("subscriber profile deprovisioned", "supi", supi)
+	return nil
+}
+
+// subscriberProfile returns the profile of a udm/Subscriber.
+func subscriberProfile(obj map[string]any, sucis map[string]string) SubscriberProfile {
+	p := SubscriberProfile{}
+	spec, _, _ := unstructured.NestedMap(obj, "spec")
+	// a malformed spec is reported in the status of the subscriber
+	_ = runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &p.Subscriber)
+	p.SUCI = sucis[p.SUPI]
+	return p
+}
+
+// provisionedSucis returns the SUCIs provisioned at runtime, keyed by the SUPI.
+func (d *Dctrl) provisionedSucis(ctx context.Context) (map[string]string, error) {
+	table := object.NewViewObject("ausf", "SuciToSupiTable")
+	object.SetName(table, suciToSupiTableNamespace, suciToSupiTableName)
+	if err := d.sharedCache.GetClient().Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	ret := map[string]string{}
+	entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+	for _, e := range entries {
+		if entry, ok := e.(map[string]any); ok && entry["provisioned"] == true {
+			supi, _ := entry["supi"].(string)
+			suci, _ := entry["suci"].(string)
+			ret[supi] = suci
+		}
+	}
+	return ret, nil
+}
+
+// setProvisionedSuci sets the SUCI provisioned for a SUPI in the AUSF:SuciToSupiTable, replacing
+// the SUCI provisioned earlier, if any. An empty SUCI removes the entry. The provisioned entries
+// are marked with provisioned: true, so that the entries of the static table and of the SIDF are
+// left alone.
+func (d *Dctrl) setProvisionedSuci(ctx context.Context, supi, suci string) error {
+	c := d.sharedCache.GetClient()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("ausf", "SuciToSupiTable")
+		object.SetName(table, suciToSupiTableNamespace, suciToSupiTableName)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			// nothing to remove from a missing table
+			if apierrors.IsNotFound(err) && suci == "" {
+				return nil
+			}
+			return err
+		}
+
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		kept := make([]any, 0, len(entries)+1)
+		listed := false
+		for _, e := range entries {
+			entry, ok := e.(map[string]any)
+			if !ok {
+				kept = append(kept, e)
+				continue
+			}
+			if suci != "" && entry["suci"] == suci {
+				if entry["supi"] != supi {
+					return fmt.Errorf("%w: SUCI %q resolves to SUPI %v", ErrSuciInUse, suci, entry["supi"])
+				}
+				if entry["provisioned"] != true {
+					// listed in the static table or de-concealed by the SIDF
+					listed = true
+				}
+			}
+			if entry["supi"] == supi && entry["provisioned"] == true {
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if suci != "" && !listed {
+			kept = append(kept, map[string]any{"suci": suci, "supi": supi, "provisioned": true})
+		}
+		if reflect.DeepEqual(entries, kept) {
+			return nil
+		}
+
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), kept, "spec"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	})
+	if err != nil {
+		if errors.Is(err, ErrSuciInUse) {
+			return err
+		}
+		return fmt.Errorf("failed to provision the SUCI of subscriber %q: %w", supi, err)
+	}
+	return nil
+}
+
+// subscribersHandler serves the subscriber profiles provisioned at runtime:
+//   - GET /subscribers: the profiles of the subscribers.
+//   - GET /subscribers/{supi}: the profile of a subscriber.
+//   - PUT /subscribers/{supi}: create or update the profile of a subscriber, given as JSON.
+//   - DELETE /subscribers/{supi}: deprovision a subscriber.
+//
+// The requests must bear a token that is authorized for the same verb on the udm/Subscribers of
+// the default namespace as via the API server. If the authentication is disabled, the profiles
+// can be read but not changed: PUT and DELETE are refused with 403.
+func (d *Dctrl) subscribersHandler(w http.ResponseWriter, r *http.Request) {
+	supi := r.PathValue("supi")
+	verb := map[string]string{
+		http.MethodGet:    "get",
+		http.MethodPut:    "update",
+		http.MethodDelete: "delete",
+	}[r.Method]
+	if supi == "" {
+		verb = "list"
+	}
+	if !d.authorizeSubscriberRequest(w, r, verb, supi) {
+		return
+	}
+
+	var (
+		ret any
+		err error
+	)
+	switch {
+	case supi == "":
+		ret, err = d.ListSubscribers(r.Context())
+	case r.Method == http.MethodGet:
+		ret, err = d.GetSubscriber(r.Context(), supi)
+	case r.Method == http.MethodPut:
+		p := SubscriberProfile{}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, fmt.Sprintf("invalid subscriber profile: %s", err), http.StatusBadRequest)
+			return
+		}
+		if p.SUPI != "" && p.SUPI != supi {
+			http.Error(w, fmt.Sprintf("SUPI %q does not match the path", p.SUPI), http.StatusBadRequest)
+			return
+		}
+		p.SUPI = supi
+		ret, err = p, d.PutSubscriber(r.Context(), p)
+	case r.Method == http.MethodDelete:
+		if err := d.DeleteSubscriber(r.Context(), supi); err != nil {
+			writeSubscriberError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ret); err != nil {
+		d.log.Error(err, "failed to write subscriber response")
+	}
+}
+
+// authorizeSubscriberRequest authenticates and authorizes a request of the subscriber endpoints,
+// and writes the error response if it is refused. With no authenticator only the reads are
+// allowed, so that the subscribers cannot be provisioned by anyone reaching the service server.
+func (d *Dctrl) authorizeSubscriberRequest(w http.ResponseWriter, r *http.Request, verb, supi string) bool {
+	if d.authn == nil {
+		if verb == "update" || verb == "delete" {
+			http.Error(w, "subscriber provisioning requires authentication", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	res, ok, err := d.authn.AuthenticateRequest(r)
+	if err != nil || !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	decision, reason, err := d.authz.Authorize(r.Context(), authorizer.AttributesRecord{
+		User:            res.User,
+		Verb:            verb,
+		Namespace:       subscriberNamespace,
+		APIGroup:        udm.OperatorName + ".view.dcontroller.io",
+		APIVersion:      "v1alpha1",
+		Resource:        "subscriber",
+		Name:            supi,
+		ResourceRequest: true,
+	})
+	if err != nil || decision != authorizer.DecisionAllow {
+		d.log.V(1).Info("subscriber request forbidden", "user", res.User.GetName(), "verb", verb,
+			"reason", reason)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeSubscriberError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, udm.ErrSubscriberNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidSubscriber):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrSuciInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,250 @@
+package dctrl_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Runtime subscriber provisioning", func() {
+	const (
+		supi = "imsi-999010000000200"
+		suci = "suci-0-999-01-02-4f2a7b9c8d13e7a5d0"
+	)
+
+	var (
+		ctx     context.Context
+		cancel  context.CancelFunc
+		d       *dctrl.Dctrl
+		c       client.Client
+		store   udm.SubscriberStore
+		addr    string
+		keyFile string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var (
+			certFile string
+			err      error
+		)
+		keyFile, certFile, err = testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		store = udm.NewMemorySubscriberStore()
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                opSpecs,
+			ServiceAddr:            "localhost:0",
+			HTTPAuth:               true,
+			KeyFile:                keyFile,
+			CertFile:               certFile,
+			SubscriberProvisioning: true,
+			SubscriberStore:        store,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr = d.ServiceAddr()
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	token := func(rules ...rbacv1.PolicyRule) string {
+		privateKey, err := auth.LoadPrivateKey(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		token, err := jwks.NewTokenGenerator(privateKey, "").GenerateToken("operator", []string{"*"},
+			rules, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		return token
+	}
+
+	// put provisions the subscriber via the REST API and returns the status code
+	put := func(token string) int {
+		body, err := json.Marshal(dctrl.SubscriberProfile{
+			Subscriber: udm.Subscriber{SUPI: supi, AllowedNSSAI: []string{"eMBB"}, DefaultQoSProfile: "default"},
+			SUCI:       suci,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		req, err := http.NewRequest(http.MethodPut, "http://"+addr+"/subscribers/"+supi, bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		defer res.Body.Close() //nolint:errcheck
+		return res.StatusCode
+	}
+
+	register := func(name string) {
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %[2]s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name, suci)), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	// authenticated returns a poller for the status and the reason of the Authenticated condition
+	// of a registration
+	authenticated := func(name string) func() []string {
+		return func() []string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return nil
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, c := range conds {
+				if cond, ok := c.(map[string]any); ok && cond["type"] == "Authenticated" {
+					return []string{fmt.Sprint(cond["status"]), fmt.Sprint(cond["reason"])}
+				}
+			}
+			return nil
+		}
+	}
+
+	It("should register a UE provisioned at runtime", func() {
+		// no token
+		Eventually(func() int { return put("") }, timeout, interval).Should(Equal(http.StatusUnauthorized))
+
+		// a token not authorized for the subscribers
+		Expect(put(token(rbacv1.PolicyRule{Verbs: []string{"*"},
+			APIGroups: []string{"amf.view.dcontroller.io"}, Resources: []string{"*"}}))).
+			To(Equal(http.StatusForbidden))
+
+		// the SUCI to SUPI table may not be initialized yet
+		admin := token(rbacv1.PolicyRule{Verbs: []string{"*"},
+			APIGroups: []string{"udm.view.dcontroller.io"}, Resources: []string{"subscriber"}})
+		Eventually(func() int { return put(admin) }, timeout, interval).Should(Equal(http.StatusOK))
+
+		Eventually(func() error {
+			_, err := store.Get(ctx, supi)
+			return err
+		}, timeout, interval).Should(Succeed())
+		p, err := d.GetSubscriber(ctx, supi)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.SUCI).To(Equal(suci))
+		Expect(p.AllowedNSSAI).To(Equal([]string{"eMBB"}))
+
+		register("user-1")
+		Eventually(authenticated("user-1"), timeout, interval).Should(
+			Equal([]string{"True", "AuthenticationSuccess"}))
+
+		// the SUCI cannot be claimed by another subscriber
+		err = d.PutSubscriber(ctx, dctrl.SubscriberProfile{
+			Subscriber: udm.Subscriber{SUPI: "imsi-999010000000201"}, SUCI: suci})
+		Expect(err).To(MatchError(dctrl.ErrSuciInUse))
+
+		// deprovision the subscriber
+		Expect(d.DeleteSubscriber(ctx, supi)).To(Succeed())
+		Eventually(func() error {
+			_, err := store.Get(ctx, supi)
+			return err
+		}, timeout, interval).Should(MatchError(udm.ErrSubscriberNotFound))
+		Expect(d.ListSubscribers(ctx)).To(BeEmpty())
+
+		// the SUCI is not resolved any more
+		register("user-2")
+		Eventually(authenticated("user-2"), timeout, interval).Should(
+			WithTransform(func(s []string) string {
+				if len(s) == 0 {
+					return ""
+				}
+				return s[0]
+			}, Equal("False")))
+	})
+})
+
+var _ = Describe("Runtime subscriber provisioning without authentication", func() {
+	const supi = "imsi-999010000000200"
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		store  udm.SubscriberStore
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		store = udm.NewMemorySubscriberStore()
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:         opSpecs,
+			ServiceAddr:     "localhost:0",
+			SubscriberStore: store,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// do sends a request to the subscriber endpoints and returns the status code
+	do := func(method, path string, body []byte) int {
+		req, err := http.NewRequest(method, "http://"+d.ServiceAddr()+path, bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		defer res.Body.Close() //nolint:errcheck
+		return res.StatusCode
+	}
+
+	It("should refuse to provision and deprovision the subscribers", func() {
+		body, err := json.Marshal(dctrl.SubscriberProfile{
+			Subscriber: udm.Subscriber{SUPI: supi, AllowedNSSAI: []string{"eMBB"}, DefaultQoSProfile: "default"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return do(http.MethodPut, "/subscribers/"+supi, body) }, timeout, interval).
+			Should(Equal(http.StatusForbidden))
+		Expect(do(http.MethodDelete, "/subscribers/"+supi, nil)).To(Equal(http.StatusForbidden))
+
+		// the reads are allowed
+		Expect(do(http.MethodGet, "/subscribers", nil)).To(Equal(http.StatusOK))
+
+		Consistently(func() error {
+			_, err := store.Get(ctx, supi)
+			return err
+		}, 200*time.Millisecond, interval).Should(MatchError(udm.ErrSubscriberNotFound))
+	})
+})
@@ -0,0 +1,115 @@
+package dctrl
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// The readiness gates.
+const (
+	// GateCacheSynced is open once the shared view cache has synced.
+	GateCacheSynced = "cacheSynced"
+	// GateOperatorsStarted is open while all operators are running.
+	GateOperatorsStarted = "operatorsStarted"
+	// GateOperatorsSynced is open once the manager caches of all running operators have synced.
+	GateOperatorsSynced = "operatorsSynced"
+	// GateDependenciesReady is open once the startup dependency check has finished.
+	GateDependenciesReady = "dependenciesReady"
+	// GateLeaderAcquired is open once the managers of all operators have been elected leader.
+	GateLeaderAcquired = "leaderAcquired"
+)
+
+// defaultReadinessGates is the default composition of readiness.
+var defaultReadinessGates = []string{
+	GateCacheSynced,
+	GateOperatorsStarted,
+	GateOperatorsSynced,
+	GateDependenciesReady,
+	GateLeaderAcquired,
+}
+
+// GateStatus is the state of a readiness gate.
+type GateStatus struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+}
+
+func checkReadinessGates(gates []string) error {
+	for _, g := range gates {
+		if !slices.Contains(defaultReadinessGates, g) {
+			return fmt.Errorf("unknown readiness gate %q", g)
+		}
+	}
+	return nil
+}
+
+// ReadinessGates returns the state of the readiness gates.
+func (d *Dctrl) ReadinessGates() []GateStatus {
+	gs := make([]GateStatus, 0, len(d.gates))
+	for _, g := range d.gates {
+		var ready bool
+		switch g {
+		case GateCacheSynced:
+			ready = d.cacheSynced.Load()
+		case GateOperatorsStarted:
+			ready = d.operatorsStarted.Load()
+		case GateOperatorsSynced:
+			ready = d.operatorsSynced()
+		case GateDependenciesReady:
+			ready = d.depsReady.Load()
+		case GateLeaderAcquired:
+			ready = int(d.leaders.Load()) == len(d.order)
+		}
+		gs = append(gs, GateStatus{Name: g, Ready: ready})
+	}
+	return gs
+}
+
+// Ready returns true if all readiness gates are open.
+func (d *Dctrl) Ready() bool {
+	for _, g := range d.ReadinessGates() {
+		if !g.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// readyzHandler serves the readiness in the style of the Kubernetes health endpoints: the status
+// code is 200 if all gates are open and 503 otherwise, and "?verbose" lists the gates.
+func (d *Dctrl) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	gates := d.ReadinessGates()
+	ready := true
+	for _, g := range gates {
+		ready = ready && g.Ready
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if _, verbose := r.URL.Query()["verbose"]; !verbose {
+		if ready {
+			fmt.Fprint(w, "ok") //nolint:errcheck
+		} else {
+			fmt.Fprint(w, "not ready") //nolint:errcheck
+		}
+		return
+	}
+
+	for _, g := range gates {
+		if g.Ready {
+			fmt.Fprintf(w, "[+]%s ok\n", g.Name) //nolint:errcheck
+		} else {
+			fmt.Fprintf(w, "[-]%s not ready\n", g.Name) //nolint:errcheck
+		}
+	}
+	if ready {
+		fmt.Fprint(w, "readyz check passed\n") //nolint:errcheck
+	} else {
+		fmt.Fprint(w, "readyz check failed\n") //nolint:errcheck
+	}
+}
@@ -0,0 +1,172 @@
+package dctrl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// dedupKey identifies the identical registrations: the SUCI and the namespace of the UE.
+type dedupKey struct {
+	suci, namespace string
+}
+
+// dedupEntry is a registration create seen by the deduplicator.
+type dedupEntry struct {
+	key     client.ObjectKey
+	done    chan struct{} // closed when the create returns
+	err     error
+	created time.Time
+}
+
+// registrationDeduper is the client of the API server that coalesces the identical concurrent
+// registrations, e.g., the retries of a client whose first create is still processing, so that a
+// single registration flow runs. A create of an AMF:Registration with the SUCI of a registration
+// created in the same namespace within the window, or still in flight, does not create another
+// registration: it waits for the first create and returns its result, i.e., the first
+// registration or the API status error it failed with. Other errors of the first create, e.g., its
+// context being cancelled, are not shared: the waiters retry the create with their own contexts. A
+// duplicate created under another name fails with AlreadyExists for the name of the first
+// registration instead, so that the caller does not mistake the first registration for the one it
+// named.
+type registrationDeduper struct {
+	client.Client
+	window  time.Duration
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+	log     logr.Logger
+}
+
+// registrationDedupOptions configures the registration deduplicator.
+type registrationDedupOptions struct {
+	// Window is how long a registration create coalesces the identical ones, no deduplication if
+	// not positive
+	Window time.Duration
+	Logger logr.Logger
+}
+
+// withRegistrationDedup wraps the client of the API server with the registration deduplicator.
+// Returns the client as is if the deduplication is disabled.
+func withRegistrationDedup(c client.Client, o registrationDedupOptions) client.Client {
+	if o.Window <= 0 {
+		return c
+	}
+	return newRegistrationDeduper(c, o.Window, o.Logger)
+}
+
+func newRegistrationDeduper(c client.Client, window time.Duration, logger logr.Logger) *registrationDeduper {
+	return &registrationDeduper{
+		Client:  c,
+		window:  window,
+		entries: map[dedupKey]*dedupEntry{},
+		log:     logger.WithName("registration-deduper"),
+	}
+}
+
+func (d *registrationDeduper) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return d.Client.Create(ctx, obj, opts...)
+	}
+	gvk := u.GroupVersionKind()
+	suci, _, _ := unstructured.NestedString(u.UnstructuredContent(), "spec", "mobileIdentity", "value")
+	if gvk.Group != "amf.view.dcontroller.io" || gvk.Kind != "Registration" || suci == "" {
+		return d.Client.Create(ctx, obj, opts...)
+	}
+	key := dedupKey{suci: suci, namespace: u.GetNamespace()}
+
+	for {
+		first, e := d.reserve(key, client.ObjectKeyFromObject(u))
+		if first == nil {
+			return d.create(ctx, key, e, u, opts...)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-first.done:
+		}
+		if first.err != nil {
+			// share only the answers of the API: an error of the first caller, e.g., its context
+			// being cancelled, says nothing about ours, so retry, the failed create is dropped
+			if isAPIStatus(first.err) {
+				return first.err
+			}
+			continue
+		}
+		name := u.GetName()
+		err := d.Client.Get(ctx, first.key, u)
+		if !apierrors.IsNotFound(err) {
+			if err != nil {
+				return err
+			}
+			d.log.V(1).Info("coalesced a duplicate registration", "suci", suci,
+				"registration", first.key.String(), "name", name)
+			if name != first.key.Name {
+				return apierrors.NewAlreadyExists(groupResource(d.Client, gvk), first.key.Name)
+			}
+			return nil
+		}
+		// the first registration is gone, register anew
+		d.forget(key, first)
+	}
+}
+
+// isAPIStatus returns whether an error is a status returned by the API, as opposed to, e.g., a
+// context or a transport error.
+func isAPIStatus(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status)
+}
+
+// reserve returns the registration create an identical create coalesces into, or, if there is
+// none, records a new create. The expired creates are dropped.
+func (d *registrationDeduper) reserve(key dedupKey, obj client.ObjectKey) (*dedupEntry, *dedupEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range d.entries {
+		if !e.created.IsZero() && now.Sub(e.created) > d.window {
+			delete(d.entries, k)
+		}
+	}
+	if first, ok := d.entries[key]; ok {
+		return first, nil
+	}
+	e := &dedupEntry{key: obj, done: make(chan struct{})}
+	d.entries[key] = e
+	return nil, e
+}
+
+// forget drops a create, unless it has already been replaced.
+func (d *registrationDeduper) forget(key dedupKey, e *dedupEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries[key] == e {
+		delete(d.entries, key)
+	}
+}
+
+// create runs a reserved registration create and releases the identical creates waiting for it.
+// A failed create is dropped, so that a later retry is not failed with the same error.
+func (d *registrationDeduper) create(ctx context.Context, key dedupKey, e *dedupEntry, u *unstructured.Unstructured, opts ...client.CreateOption) error {
+	err := d.Client.Create(ctx, u, opts...)
+
+	d.mu.Lock()
+	e.err = err
+	e.created = time.Now()
+	d.mu.Unlock()
+	if err != nil {
+		d.forget(key, e)
+	}
+	close(e.done)
+
+	return err
+}
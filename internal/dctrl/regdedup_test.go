@@ -0,0 +1,256 @@
+package dctrl_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Registration deduplication", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+		port   int
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                 opSpecs,
+			APIServerPort:           dctrl.EphemeralAPIServerPort,
+			RegistrationDedupWindow: 5 * time.Second,
+			// keep the first create in flight while the retry arrives
+			AdmissionPolicy: slowAdmission(300 * time.Millisecond),
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port = d.APIServerPort()
+		Eventually(d.Ready, timeout, interval).Should(BeTrue())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// create posts a registration of the SUCI to the user-1 namespace and returns the status code
+	// and the name of the registration returned, or of the registration an error refers to
+	create := func(name string) (int, string) {
+		body := fmt.Sprintf(`{
+  "apiVersion": "amf.view.dcontroller.io/v1alpha1",
+  "kind": "Registration",
+  "metadata": {"name": %q, "namespace": "user-1"},
+  "spec": {
+    "registrationType": "initial",
+    "mobileIdentity": {"type": "SUCI", "value": "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"},
+    "ueSecurityCapability": {"encryptionAlgorithms": ["5G-EA0", "5G-EA2"], "integrityAlgorithms": ["5G-IA0", "5G-IA2"]},
+    "requestedNSSAI": [{"sliceType": "eMBB"}]
+  }
+}`, name)
+		url := fmt.Sprintf("http://localhost:%d/apis/amf.view.dcontroller.io/v1alpha1/namespaces/user-1/registration",
+			port)
+		res, err := http.Post(url, "application/json", strings.NewReader(body)) //nolint:noctx
+		if err != nil {
+			return 0, ""
+		}
+		defer res.Body.Close() //nolint:errcheck
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			return res.StatusCode, ""
+		}
+		ret := struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Details struct {
+				Name string `json:"name"`
+			} `json:"details"`
+		}{}
+		_ = json.Unmarshal(data, &ret)
+		if ret.Metadata.Name == "" {
+			return res.StatusCode, ret.Details.Name
+		}
+		return res.StatusCode, ret.Metadata.Name
+	}
+
+	// createConcurrently posts the registrations with the names a bit apart, so that the first
+	// create is still in flight when the others arrive
+	createConcurrently := func(names ...string) ([]int, []string) {
+		codes := make([]int, len(names))
+		returned := make([]string, len(names))
+		var wg sync.WaitGroup
+		for i, name := range names {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				codes[i], returned[i] = create(name)
+			}(i, name)
+			time.Sleep(20 * time.Millisecond)
+		}
+		wg.Wait()
+		return codes, returned
+	}
+
+	// expectSingleFlow checks that a single registration flow runs
+	expectSingleFlow := func() {
+		GinkgoHelper()
+		for _, kind := range []string{"Registration", "RegState"} {
+			list := cache.NewViewObjectList("amf", kind)
+			Eventually(func() int {
+				if err := c.List(ctx, list, client.InNamespace("user-1")); err != nil {
+					return -1
+				}
+				return len(list.Items)
+			}, timeout, interval).Should(Equal(1), kind)
+			Consistently(func() int {
+				if err := c.List(ctx, list, client.InNamespace("user-1")); err != nil {
+					return -1
+				}
+				return len(list.Items)
+			}, "300ms", interval).Should(Equal(1), kind)
+		}
+	}
+
+	It("should coalesce the identical concurrent registrations into one flow", func() {
+		codes, returned := createConcurrently("user-1", "user-1")
+
+		// both callers observe the registration
+		Expect(codes).To(Equal([]int{http.StatusCreated, http.StatusCreated}))
+		Expect(returned).To(Equal([]string{"user-1", "user-1"}))
+		expectSingleFlow()
+	})
+
+	It("should refer a duplicate created under another name to the first registration", func() {
+		codes, returned := createConcurrently("user-1", "user-1-retry")
+
+		// the duplicate fails with a conflict naming the first registration
+		Expect(codes).To(Equal([]int{http.StatusCreated, http.StatusConflict}))
+		Expect(returned).To(Equal([]string{"user-1", "user-1"}))
+		expectSingleFlow()
+	})
+})
+
+// firstCreateClient is an API server client whose first create returns the result of fail, and
+// whose later creates succeed.
+type firstCreateClient struct {
+	client.Client
+	started chan struct{} // closed when the first create starts
+	fail    func(ctx context.Context) error
+	mu      sync.Mutex
+	creates int
+	created map[client.ObjectKey]bool
+}
+
+func newFirstCreateClient(fail func(ctx context.Context) error) *firstCreateClient {
+	return &firstCreateClient{
+		started: make(chan struct{}),
+		fail:    fail,
+		created: map[client.ObjectKey]bool{},
+	}
+}
+
+func (c *firstCreateClient) Create(ctx context.Context, obj client.Object, _ ...client.CreateOption) error {
+	c.mu.Lock()
+	c.creates++
+	first := c.creates == 1
+	c.mu.Unlock()
+	if first {
+		close(c.started)
+		return c.fail(ctx)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created[client.ObjectKeyFromObject(obj)] = true
+	return nil
+}
+
+func (c *firstCreateClient) Get(_ context.Context, key client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.created[key] {
+		return apierrors.NewNotFound(schema.GroupResource{Group: "amf.view.dcontroller.io", Resource: "registration"}, key.Name)
+	}
+	return nil
+}
+
+func (c *firstCreateClient) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.creates
+}
+
+var _ = Describe("Registration deduplication with a failed first create", func() {
+	registration := func() *unstructured.Unstructured {
+		reg := &unstructured.Unstructured{}
+		reg.SetAPIVersion("amf.view.dcontroller.io/v1alpha1")
+		reg.SetKind("Registration")
+		reg.SetNamespace("user-1")
+		reg.SetName("user-1")
+		Expect(unstructured.SetNestedField(reg.Object, "suci-0-999-01-02-4f2a7b9c8d13e7a5c0",
+			"spec", "mobileIdentity", "value")).To(Succeed())
+		return reg
+	}
+
+	// createCoalesced runs a first create with the context and an identical create, coalesced into
+	// the first one, with its own context, and returns the channels the results are sent to
+	createCoalesced := func(ctx context.Context, fc *firstCreateClient) (chan error, chan error) {
+		dedup := dctrl.NewRegistrationDeduper(fc, 5*time.Second)
+		firstErr, retryErr := make(chan error, 1), make(chan error, 1)
+		go func() { firstErr <- dedup.Create(ctx, registration()) }()
+		Eventually(fc.started, timeout, interval).Should(BeClosed())
+		go func() { retryErr <- dedup.Create(context.Background(), registration()) }()
+
+		// the identical create waits for the first one
+		Consistently(retryErr, "200ms", interval).ShouldNot(Receive())
+		return firstErr, retryErr
+	}
+
+	It("should retry with its own context a create coalesced into one whose context was cancelled", func() {
+		fc := newFirstCreateClient(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		firstErr, retryErr := createCoalesced(ctx, fc)
+
+		cancel()
+		Eventually(firstErr, timeout, interval).Should(Receive(MatchError(context.Canceled)))
+		Eventually(retryErr, timeout, interval).Should(Receive(BeNil()))
+		Expect(fc.count()).To(Equal(2))
+	})
+
+	It("should share the API status error of the first create", func() {
+		release := make(chan struct{})
+		fc := newFirstCreateClient(func(context.Context) error {
+			<-release
+			return apierrors.NewForbidden(schema.GroupResource{Group: "amf.view.dcontroller.io", Resource: "registration"},
+				"user-1", errors.New("denied by the admission policy"))
+		})
+		firstErr, retryErr := createCoalesced(context.Background(), fc)
+
+		close(release)
+		Eventually(firstErr, timeout, interval).Should(Receive(Satisfy(apierrors.IsForbidden)))
+		Eventually(retryErr, timeout, interval).Should(Receive(Satisfy(apierrors.IsForbidden)))
+		Expect(fc.count()).To(Equal(1))
+	})
+})
@@ -0,0 +1,187 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// DefaultRegistrationEventBufferSize is the default number of registration events retained.
+const DefaultRegistrationEventBufferSize = 256
+
+// The types of the registration events.
+const (
+	// RegistrationEventRegistered is recorded when a registration becomes Ready.
+	RegistrationEventRegistered = "Registered"
+	// RegistrationEventAuthenticationFailed is recorded when the authentication of a UE fails.
+	RegistrationEventAuthenticationFailed = "AuthenticationFailed"
+	// RegistrationEventDeregistered is recorded when a Ready registration is deleted.
+	RegistrationEventDeregistered = "Deregistered"
+)
+
+// registrationState is the state of a registration as last seen by the event recorder.
+type registrationState struct {
+	ready, authenticated [2]string // status, reason
+	suci, guti           string
+}
+
+// registrationEventRecorder records the state changes of the registrations as
+// amf/RegistrationEvent objects, since the AMF encodes the state in the status conditions only:
+//
+//	spec:
+//	  type: Registered
+//	  registration: user-1
+//	  suci: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+//	  guti: guti-310-170-3F-152-2A-B7C8D9E0
+//	  reason: RegistrationSuccessful
+//	  timestamp: "2025-01-01T00:00:00.000000000Z"
+//	  sequence: 1
+//
+// The events are named <registration>-<sequence> in the namespace of the registration. The view
+// is a ring buffer: only the last size events are retained.
+type registrationEventRecorder struct {
+	client client.Client
+	size   int
+	mu     sync.Mutex
+	seq    int64
+	last   map[client.ObjectKey]registrationState
+	log    logr.Logger
+}
+
+// addRegistrationEventRecorder adds the event recorder and the retention controller trimming the
+// events to the AMF operator.
+func addRegistrationEventRecorder(op *trackedOperator, c client.Client, size int, logger logr.Logger) error {
+	if size <= 0 {
+		size = DefaultRegistrationEventBufferSize
+	}
+	r := &registrationEventRecorder{
+		client: c,
+		size:   size,
+		last:   map[client.ObjectKey]registrationState{},
+		log:    logger.WithName("registration-events"),
+	}
+	if err := addWatchController(op, "amf", "registration-event-recorder", "Registration",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileRegistration)); err != nil {
+		return err
+	}
+	return addWatchController(op, "amf", "registration-event-retention", "RegistrationEvent",
+		reconcile.TypedFunc[reconciler.Request](r.reconcileRetention))
+}
+
+func (r *registrationEventRecorder) reconcileRegistration(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, seen := r.last[key]
+	if req.EventType == object.Deleted {
+		delete(r.last, key)
+		if seen && prev.ready[0] == "True" {
+			return reconcile.Result{}, r.record(ctx, key, RegistrationEventDeregistered, "Deleted", prev)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	obj := req.Object.UnstructuredContent()
+	current := registrationState{
+		ready:         conditionOf(obj, "Ready"),
+		authenticated: conditionOf(obj, "Authenticated"),
+	}
+	if t, _, _ := unstructured.NestedString(obj, "spec", "mobileIdentity", "type"); t == "SUCI" {
+		current.suci, _, _ = unstructured.NestedString(obj, "spec", "mobileIdentity", "value")
+	}
+	current.guti, _, _ = unstructured.NestedString(obj, "status", "guti")
+	r.last[key] = current
+
+	if current.authenticated[0] == "False" && current.authenticated != prev.authenticated {
+		if err := r.record(ctx, key, RegistrationEventAuthenticationFailed,
+			current.authenticated[1], current); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if current.ready[0] == "True" && prev.ready[0] != "True" {
+		if err := r.record(ctx, key, RegistrationEventRegistered, current.ready[1], current); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// record writes a registration event.
+func (r *registrationEventRecorder) record(ctx context.Context, key client.ObjectKey, eventType, reason string, state registrationState) error {
+	r.seq++
+	e := object.NewViewObject("amf", "RegistrationEvent")
+	object.SetName(e, key.Namespace, fmt.Sprintf("%s-%d", key.Name, r.seq))
+	e.Object["spec"] = map[string]any{
+		"type":         eventType,
+		"registration": key.Name,
+		"suci":         state.suci,
+		"guti":         state.guti,
+		"reason":       reason,
+		"timestamp":    time.Now().UTC().Format(time.RFC3339Nano),
+		"sequence":     r.seq,
+	}
+	if err := r.client.Create(ctx, e); err != nil {
+		return fmt.Errorf("failed to record registration event %s for %s: %w", eventType, key, err)
+	}
+	r.log.V(1).Info("registration event", "type", eventType, "registration", key.String(),
+		"reason", reason)
+	return nil
+}
+
+// reconcileRetention deletes the oldest events beyond the size of the ring buffer.
+func (r *registrationEventRecorder) reconcileRetention(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	list := cache.NewViewObjectList("amf", "RegistrationEvent")
+	if err := r.client.List(ctx, list); err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(list.Items) <= r.size {
+		return reconcile.Result{}, nil
+	}
+
+	events := list.Items
+	sort.Slice(events, func(i, j int) bool { return eventSequence(&events[i]) < eventSequence(&events[j]) })
+	for i := range events[:len(events)-r.size] {
+		if err := r.client.Delete(ctx, &events[i]); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to delete registration event %s: %w",
+				client.ObjectKeyFromObject(&events[i]), err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// eventSequence returns the sequence number of a registration event.
+func eventSequence(e object.Object) int64 {
+	seq, _, _ := unstructured.NestedInt64(e.UnstructuredContent(), "spec", "sequence")
+	return seq
+}
+
+// conditionOf returns the status and the reason of a status condition.
+func conditionOf(obj map[string]any, condType string) [2]string {
+	conds, _, _ := unstructured.NestedSlice(obj, "status", "conditions")
+	for _, c := range conds {
+		if cond, ok := c.(map[string]any); ok && cond["type"] == condType {
+			status, _ := cond["status"].(string)
+			reason, _ := cond["reason"].(string)
+			return [2]string{status, reason}
+		}
+	}
+	return [2]string{}
+}
@@ -0,0 +1,142 @@
+package dctrl_test
+
+import (
+	"context"
+	"sort"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Registration events", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// registerAndDelete drives a full register-then-delete cycle of user-1
+	registerAndDelete := func(c client.Client) {
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+
+		Eventually(func() string {
+			obj := object.NewViewObject("amf", "Registration")
+			object.SetName(obj, "user-1", "user-1")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return ""
+			}
+			conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			for _, cd := range conds {
+				if cond, ok := cd.(map[string]any); ok && cond["type"] == "Ready" {
+					status, _ := cond["status"].(string)
+					return status
+				}
+			}
+			return ""
+		}, timeout, interval).Should(Equal("True"))
+
+		Expect(c.Delete(ctx, reg)).To(Succeed())
+	}
+
+	// events returns the spec of the registration events of user-1 in sequence order
+	events := func(c client.Client) func() []map[string]any {
+		return func() []map[string]any {
+			list := cache.NewViewObjectList("amf", "RegistrationEvent")
+			if err := c.List(ctx, list, client.InNamespace("user-1")); err != nil {
+				return nil
+			}
+			ret := []map[string]any{}
+			for _, e := range list.Items {
+				spec, _, _ := unstructured.NestedMap(e.UnstructuredContent(), "spec")
+				ret = append(ret, spec)
+			}
+			sort.Slice(ret, func(i, j int) bool {
+				si, _, _ := unstructured.NestedInt64(ret[i], "sequence")
+				sj, _, _ := unstructured.NestedInt64(ret[j], "sequence")
+				return si < sj
+			})
+			return ret
+		}
+	}
+
+	eventTypes := func(c client.Client) func() []string {
+		return func() []string {
+			ret := []string{}
+			for _, e := range events(c)() {
+				t, _ := e["type"].(string)
+				ret = append(ret, t)
+			}
+			return ret
+		}
+	}
+
+	It("should record the events of a register-then-delete cycle in order", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		registerAndDelete(c)
+
+		Eventually(eventTypes(c), timeout, interval).Should(Equal([]string{
+			dctrl.RegistrationEventRegistered,
+			dctrl.RegistrationEventDeregistered,
+		}))
+
+		for _, e := range events(c)() {
+			Expect(e).To(HaveKeyWithValue("registration", "user-1"))
+			Expect(e).To(HaveKeyWithValue("suci", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"))
+			Expect(e).To(HaveKeyWithValue("guti", "guti-310-170-3F-152-2A-B7C8D9E0"))
+			Expect(e).To(HaveKey("timestamp"))
+		}
+	})
+
+	It("should retain the last events only", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                     opSpecs,
+			RegistrationEventBufferSize: 1,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		registerAndDelete(c)
+
+		Eventually(eventTypes(c), timeout, interval).Should(Equal([]string{
+			dctrl.RegistrationEventDeregistered,
+		}))
+	})
+})
@@ -0,0 +1,121 @@
+package dctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	viewv1a1 "github.com/l7mp/dcontroller/pkg/api/view/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/operator"
+)
+
+// ReloadOperator re-reads the spec file of a declarative operator and replaces the running
+// operator with one built from the new spec, without restarting the process.
+//
+// The new operator is started and must come up, with its caches synced, before the old one is
+// stopped; if it does not, the new operator is stopped and the old one keeps running with its API
+// group restored, so a failed reload leaves the operator as it was. The objects live in the shared
+// cache, so they survive the reload. Once the new operator is up, the work queues of the old
+// operator are drained (until the context expires) so that it does not stop in the middle of a
+// reconcile. While both operators run they reconcile the same objects; the controllers are
+// level-triggered so the writes of the old operator are simply overwritten. The API group of the
+// operator is unavailable while the new operator is built.
+//
+// The UDM is a native operator and cannot be reloaded.
+func (d *Dctrl) ReloadOperator(ctx context.Context, name string) error {
+	spec, ok := d.specs[name]
+	if !ok {
+		return fmt.Errorf("unknown declarative operator %q", name)
+	}
+
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+
+	d.mu.Lock()
+	run := d.run
+	var old *runningOperator
+	stopping := false
+	if run != nil {
+		old, stopping = run.running[name], run.stopping
+	}
+	oldOp := d.ops[name]
+	d.mu.Unlock()
+	switch {
+	case run == nil:
+		return ErrNotStarted
+	case stopping:
+		return errors.New("dctrl is shutting down")
+	case old == nil:
+		return fmt.Errorf("operator %q not running", name)
+	}
+
+	// The API group can be registered by a single operator only: release it for the new
+	// operator and take it back if the new operator fails.
+	d.log.Info("reloading the operator", "name", name, "file", spec.File)
+	d.apiServer.UnregisterAPIGroup(viewv1a1.Group(name))
+	op, err := d.buildOperator(spec)
+	if err != nil {
+		d.restoreOperator(name, oldOp)
+		return fmt.Errorf("failed to reload operator %q: %w", name, err)
+	}
+
+	r := d.startOperator(run.ctx, name, op)
+	if err := d.waitForOperator(ctx, op, r); err != nil {
+		if serr := d.stopOperator(name, r); serr != nil {
+			d.log.Error(serr, "reloaded operator exited with an error", "name", name)
+		}
+		d.works.forget(op)
+		d.restoreOperator(name, oldOp)
+		return fmt.Errorf("failed to reload operator %q: %w", name, err)
+	}
+
+	if err := d.waitForDrain(ctx, name); err != nil {
+		d.log.Info("the work queues did not drain, reloading anyway", "name", name,
+			"error", err.Error())
+	}
+
+	if err := d.stopOperator(name, old); err != nil {
+		d.log.Error(err, "operator exited with an error on reload", "name", name)
+	}
+	d.works.forget(oldOp)
+
+	d.mu.Lock()
+	d.ops[name] = op
+	d.mu.Unlock()
+	d.registerOperator(name, r)
+
+	d.log.Info("operator reloaded", "name", name)
+	return nil
+}
+
+// waitForOperator waits until a started operator is elected and its caches are synced.
+func (d *Dctrl) waitForOperator(ctx context.Context, op *operator.Operator, r *runningOperator) error {
+	select {
+	case <-op.GetManager().Elected():
+	case <-r.done:
+		return fmt.Errorf("operator exited: %w", r.err)
+	case <-ctx.Done():
+		return fmt.Errorf("operator not started: %w", ctx.Err())
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for !r.synced.Load() {
+		select {
+		case <-r.done:
+			return fmt.Errorf("operator exited: %w", r.err)
+		case <-ctx.Done():
+			return fmt.Errorf("operator caches not synced: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// restoreOperator gives the API group back to the old operator after a failed reload.
+func (d *Dctrl) restoreOperator(name string, op *operator.Operator) {
+	if err := op.RegisterGVKs(); err != nil {
+		d.log.Error(err, "failed to restore the API group of the operator", "name", name)
+	}
+}
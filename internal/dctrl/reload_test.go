@@ -0,0 +1,163 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Operator reload", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+		Eventually(d.Ready, timeout, interval).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	createRegistration := func(name string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name)
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	ready := func(name string) func() string {
+		return func() string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return ""
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, cd := range conds {
+				if cond, ok := cd.(map[string]any); ok && cond["type"] == "Ready" {
+					status, _ := cond["status"].(string)
+					return status
+				}
+			}
+			return ""
+		}
+	}
+
+	It("should keep the in-flight registrations across a reload of the AMF", func() {
+		old := d.GetOperator("amf")
+
+		// the registration is in flight while the AMF is reloaded
+		createRegistration("user-1")
+		Expect(d.ReloadOperator(ctx, "amf")).To(Succeed())
+		Expect(d.GetOperator("amf")).NotTo(BeIdenticalTo(old))
+
+		Eventually(ready("user-1"), timeout, interval).Should(Equal("True"))
+
+		// the reloaded operator serves new registrations
+		createRegistration("user-2")
+		Eventually(ready("user-2"), timeout, interval).Should(Equal("True"))
+		Expect(d.Ready()).To(BeTrue())
+	})
+
+	It("should refuse to reload an unknown or a native operator", func() {
+		Expect(d.ReloadOperator(ctx, "dummy")).To(MatchError(ContainSubstring("unknown")))
+		Expect(d.ReloadOperator(ctx, "udm")).To(MatchError(ContainSubstring("unknown")))
+	})
+
+	It("should refuse to reload before being started", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:     opSpecs,
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			Logger:      logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(d.ReloadOperator(ctx, "amf")).To(MatchError(dctrl.ErrNotStarted))
+	})
+
+	It("should keep the old operator running when the reload fails", func() {
+		// a private copy of the AMF spec to break
+		file := filepath.Join(GinkgoT().TempDir(), "amf.yaml")
+		data, err := os.ReadFile("../operators/amf.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(file, data, 0o600)).To(Succeed())
+		specs := []dctrl.OpSpec{}
+		for _, s := range opSpecs {
+			if s.Name == "amf" {
+				s.File = file
+			}
+			specs = append(specs, s)
+		}
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:       specs,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+		Eventually(d.Ready, timeout, interval).Should(BeTrue())
+		c = d.GetCache().GetClient()
+		old := d.GetOperator("amf")
+
+		Expect(os.WriteFile(file, []byte("controllers: [\n"), 0o600)).To(Succeed())
+		Expect(d.ReloadOperator(ctx, "amf")).To(MatchError(ContainSubstring(`failed to reload operator "amf"`)))
+		Expect(d.GetOperator("amf")).To(BeIdenticalTo(old))
+
+		// the API group is served again
+		url := fmt.Sprintf("http://localhost:%d/apis/amf.view.dcontroller.io/v1alpha1/namespaces/user-1/registration",
+			port)
+		res, err := http.Get(url) //nolint:noctx
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Body.Close()).To(Succeed())
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+		// the old operator still processes the registrations
+		createRegistration("user-1")
+		Eventually(ready("user-1"), timeout, interval).Should(Equal("True"))
+		Expect(d.Ready()).To(BeTrue())
+	})
+})
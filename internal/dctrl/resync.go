@@ -0,0 +1,205 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// aggregateTable describes an aggregate table maintained by a declarative operator via
+// "@gather" and the way to rebuild it from the authoritative per-UE objects.
+type aggregateTable struct {
+	operator, kind, name string
+	controller           string    // the controller maintaining the table
+	source               [2]string // operator, kind
+	entry                func(obj object.Object) (map[string]any, bool)
+}
+
+var aggregateTables = []aggregateTable{
+	{
+		// must match the "active-registration" controller in amf.yaml
+		operator: "amf", kind: "ActiveRegistrationTable", name: "active-registrations",
+		controller: "active-registration", source: [2]string{"amf", "RegState"},
+		entry: func(obj object.Object) (map[string]any, bool) {
+			for _, cond := range []string{"validated", "authenticated", "subscriptionInfo"} {
+				s, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "status", "conditions", cond, "status")
+				if s != "True" {
+					return nil, false
+				}
+			}
+			suci, _, _ := unstructured.NestedFieldCopy(obj.UnstructuredContent(), "spec", "mobileIdentity", "value")
+			guti, _, _ := unstructured.NestedFieldCopy(obj.UnstructuredContent(), "status", "guti")
+			return map[string]any{
+				"name":      obj.GetName(),
+				"namespace": obj.GetNamespace(),
+				"suci":      suci,
+				"guti":      guti,
+			}, true
+		},
+	},
+	{
+		// must match the "active-session" controller in smf.yaml
+		operator: "smf", kind: "ActiveSessionTable", name: "active-sessions",
+		controller: "active-session", source: [2]string{"smf", "SessionContext"},
+		entry: func(obj object.Object) (map[string]any, bool) {
+			for _, cond := range []string{"validated", "policy"} {
+				s, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "status", "conditions", cond, "status")
+				if s != "True" {
+					return nil, false
+				}
+			}
+			guti, _, _ := unstructured.NestedFieldCopy(obj.UnstructuredContent(), "spec", "guti")
+			_, idle, _ := unstructured.NestedFieldCopy(obj.UnstructuredContent(), "spec", "idle")
+			sessionId, _, _ := unstructured.NestedFieldCopy(obj.UnstructuredContent(), "spec", "sessionId")
+			return map[string]any{
+				"name":      obj.GetName(),
+				"namespace": obj.GetNamespace(),
+				"guti":      guti,
+				"idle":      idle,
+				"sessionId": sessionId,
+			}, true
+		},
+	},
+}
+
+// tableResyncer periodically rebuilds the aggregate tables from the per-UE objects to correct
+// drift, e.g., due to a missed delete event.
+type tableResyncer struct {
+	client    client.Client
+	interval  time.Duration
+	corrected atomic.Uint64
+	// writes counts the table writes, shared with the table coalescer.
+	writes *atomic.Uint64
+	log    logr.Logger
+}
+
+func newTableResyncer(c client.Client, interval time.Duration, writes *atomic.Uint64, logger logr.Logger) *tableResyncer {
+	return &tableResyncer{client: c, interval: interval, writes: writes, log: logger.WithName("table-resync")}
+}
+
+// Start runs the resync loop until the context is cancelled.
+func (r *tableResyncer) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, t := range aggregateTables {
+				if err := r.resync(ctx, t); err != nil {
+					r.log.Error(err, "failed to resync aggregate table", "operator", t.operator,
+						"kind", t.kind)
+				}
+			}
+		}
+	}
+}
+
+// CorrectedEntries returns the number of table entries added, removed or rewritten so far.
+func (r *tableResyncer) CorrectedEntries() uint64 { return r.corrected.Load() }
+
+func (r *tableResyncer) resync(ctx context.Context, t aggregateTable) error {
+	corrected, err := syncTable(ctx, r.client, t)
+	if err != nil {
+		return err
+	}
+	if corrected > 0 {
+		r.log.Info("corrected aggregate table drift", "operator", t.operator, "kind", t.kind,
+			"corrected-entries", corrected)
+		r.corrected.Add(uint64(corrected))
+		metrics.CorrectedTableEntries.Add(float64(corrected))
+		r.writes.Add(1)
+	}
+	return nil
+}
+
+// syncTable rebuilds an aggregate table from the current source objects and writes it if it
+// differs from the stored one. Returns the number of entries added, removed or rewritten, which is
+// positive if and only if the table was written.
+func syncTable(ctx context.Context, c client.Client, t aggregateTable) (int, error) {
+	list := cache.NewViewObjectList(t.source[0], t.source[1])
+	if err := c.List(ctx, list); err != nil {
+		return 0, fmt.Errorf("failed to list %s/%s: %w", t.source[0], t.source[1], err)
+	}
+
+	want := map[string]map[string]any{}
+	for i := range list.Items {
+		if e, ok := t.entry(&list.Items[i]); ok {
+			want[list.Items[i].GetNamespace()+"/"+list.Items[i].GetName()] = e
+		}
+	}
+
+	table := object.NewViewObject(t.operator, t.kind)
+	object.SetName(table, "", t.name)
+	exists := true
+	if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return 0, fmt.Errorf("failed to get %s/%s: %w", t.operator, t.kind, err)
+		}
+		exists = false
+	}
+
+	have := map[string]map[string]any{}
+	specs, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+	for _, s := range specs {
+		e, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		have[fmt.Sprintf("%v/%v", e["namespace"], e["name"])] = e
+	}
+
+	// the malformed and the duplicate entries are dropped
+	corrected := len(specs) - len(have)
+	for k, e := range want {
+		if h, ok := have[k]; !ok || !reflect.DeepEqual(h, e) {
+			corrected++
+		}
+	}
+	for k := range have {
+		if _, ok := want[k]; !ok {
+			corrected++
+		}
+	}
+	if corrected == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]any, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, want[k])
+	}
+
+	table.UnstructuredContent()["spec"] = entries
+	if exists {
+		if err := c.Update(ctx, table); err != nil {
+			return 0, fmt.Errorf("failed to update %s/%s: %w", t.operator, t.kind, err)
+		}
+	} else {
+		if err := c.Create(ctx, table); err != nil {
+			return 0, fmt.Errorf("failed to create %s/%s: %w", t.operator, t.kind, err)
+		}
+	}
+
+	return corrected, nil
+}
@@ -0,0 +1,108 @@
+package dctrl_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Aggregate table resync", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		d      *dctrl.Dctrl
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:             opSpecs,
+			TableResyncInterval: 200 * time.Millisecond,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should repair a corrupted registration table", func() {
+		c := d.GetCache().GetClient()
+
+		table := object.NewViewObject("amf", "ActiveRegistrationTable")
+		object.SetName(table, "", "active-registrations")
+		Eventually(func() bool {
+			return c.Get(ctx, client.ObjectKeyFromObject(table), table) == nil
+		}, timeout, interval).Should(BeTrue())
+
+		specs, _, err := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		Expect(err).NotTo(HaveOccurred())
+		want := len(specs)
+
+		// inject a stale entry, as if a delete event had been missed
+		specs = append(specs, map[string]any{
+			"name":      "stale",
+			"namespace": "stale",
+			"suci":      "suci-stale",
+			"guti":      "guti-stale",
+		})
+		Expect(unstructured.SetNestedSlice(table.UnstructuredContent(), specs, "spec")).To(Succeed())
+		Expect(c.Update(ctx, table)).To(Succeed())
+
+		Eventually(func() bool {
+			if c.Get(ctx, client.ObjectKeyFromObject(table), table) != nil {
+				return false
+			}
+			specs, ok, err := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+			return err == nil && ok && len(specs) == want
+		}, timeout, interval).Should(BeTrue())
+
+		Expect(d.CorrectedTableEntries()).To(BeNumerically(">=", 1))
+	})
+
+	It("should count the write dropping a malformed entry", func() {
+		c := d.GetCache().GetClient()
+
+		table := object.NewViewObject("amf", "ActiveRegistrationTable")
+		object.SetName(table, "", "active-registrations")
+		Eventually(func() bool {
+			return c.Get(ctx, client.ObjectKeyFromObject(table), table) == nil
+		}, timeout, interval).Should(BeTrue())
+
+		specs, _, err := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		Expect(err).NotTo(HaveOccurred())
+		want := len(specs)
+		corrected, writes := d.CorrectedTableEntries(), d.TableWrites()
+		counted := testutil.ToFloat64(metrics.CorrectedTableEntries)
+
+		// an entry that is not an object
+		specs = append(specs, "malformed")
+		Expect(unstructured.SetNestedSlice(table.UnstructuredContent(), specs, "spec")).To(Succeed())
+		Expect(c.Update(ctx, table)).To(Succeed())
+
+		Eventually(func() bool {
+			if c.Get(ctx, client.ObjectKeyFromObject(table), table) != nil {
+				return false
+			}
+			specs, ok, err := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+			return err == nil && ok && len(specs) == want
+		}, timeout, interval).Should(BeTrue())
+
+		Eventually(d.CorrectedTableEntries, timeout, interval).Should(BeNumerically(">", corrected))
+		Eventually(d.TableWrites, timeout, interval).Should(BeNumerically(">", writes))
+		Expect(testutil.ToFloat64(metrics.CorrectedTableEntries)).To(BeNumerically(">", counted))
+	})
+})
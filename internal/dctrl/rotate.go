@@ -0,0 +1,46 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+)
+
+// RotateUEToken force-expires the token of a UE and reissues the UDM Config of the UE with a fresh
+// token. The old token is rejected by the API server from then on, so the UE has to pick up the
+// new config, e.g., by registering again.
+func (d *Dctrl) RotateUEToken(ctx context.Context, guti string) error {
+	list := cache.NewViewObjectList("udm", "Config")
+	if err := d.sharedCache.GetClient().List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list configs: %w", err)
+	}
+
+	var key *client.ObjectKey
+	for i := range list.Items {
+		if list.Items[i].GetName() == guti {
+			k := client.ObjectKeyFromObject(&list.Items[i])
+			key = &k
+			break
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("no config for GUTI %q", guti)
+	}
+
+	old, err := d.udm.RotateToken(ctx, *key)
+	if err != nil {
+		return fmt.Errorf("failed to rotate the token of GUTI %q: %w", guti, err)
+	}
+
+	if old != "" {
+		if err := d.revoked.Revoke(old); err != nil {
+			return fmt.Errorf("failed to revoke the token of GUTI %q: %w", guti, err)
+		}
+	}
+
+	d.log.Info("rotated UE token", "guti", guti, "namespace", key.Namespace)
+	return nil
+}
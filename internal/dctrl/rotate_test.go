@@ -0,0 +1,159 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("UE token rotation", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should revoke the old token and issue a new one", func() {
+		keyFile, certFile, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:       opSpecs,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+			HTTPAuth:      true,
+			KeyFile:       keyFile,
+			CertFile:      certFile,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+		c := d.GetCache().GetClient()
+
+		cfg := object.NewViewObject("udm", "Config")
+		object.SetName(cfg, "user-1", "guti-1")
+		Expect(testsuite.CreateWithRetry(ctx, c, cfg)).To(Succeed())
+
+		token := func() string {
+			obj := object.NewViewObject("udm", "Config")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(cfg), obj); err != nil {
+				return ""
+			}
+			return udm.ConfigToken(obj)
+		}
+		Eventually(token, timeout, interval).ShouldNot(BeEmpty())
+		oldToken := token()
+
+		gvr := schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}
+		list := func(token string) error {
+			dc, err := dynamic.NewForConfig(&rest.Config{
+				Host:        fmt.Sprintf("http://localhost:%d", port),
+				BearerToken: token,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = dc.Resource(gvr).Namespace("user-1").List(ctx, metav1.ListOptions{})
+			return err
+		}
+		Eventually(func() error { return list(oldToken) }, timeout, interval).Should(Succeed())
+
+		Expect(d.RotateUEToken(ctx, "guti-1")).To(Succeed())
+
+		newToken := token()
+		Expect(newToken).NotTo(BeEmpty())
+		Expect(newToken).NotTo(Equal(oldToken))
+		Expect(apierrors.IsUnauthorized(list(oldToken))).To(BeTrue())
+		Expect(list(newToken)).To(Succeed())
+
+		Expect(d.RotateUEToken(ctx, "guti-unknown")).To(MatchError(ContainSubstring("no config")))
+	})
+
+	It("should keep the revoked tokens revoked across a restart", func() {
+		keyFile, certFile, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		revocationListFile := filepath.Join(GinkgoT().TempDir(), "revoked.json")
+
+		start := func(ctx context.Context) (*dctrl.Dctrl, int) {
+			d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+				OpSpecs:            opSpecs,
+				APIServerPort:      dctrl.EphemeralAPIServerPort,
+				HTTPAuth:           true,
+				KeyFile:            keyFile,
+				CertFile:           certFile,
+				RevocationListFile: revocationListFile,
+			}, loglevel)
+			Expect(err).NotTo(HaveOccurred())
+			port := d.APIServerPort()
+			return d, port
+		}
+
+		gvr := schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}
+		list := func(port int, token string) error {
+			dc, err := dynamic.NewForConfig(&rest.Config{
+				Host:        fmt.Sprintf("http://localhost:%d", port),
+				BearerToken: token,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = dc.Resource(gvr).Namespace("user-1").List(ctx, metav1.ListOptions{})
+			return err
+		}
+
+		firstCtx, firstCancel := context.WithCancel(ctx)
+		d, port := start(firstCtx)
+		c := d.GetCache().GetClient()
+
+		cfg := object.NewViewObject("udm", "Config")
+		object.SetName(cfg, "user-1", "guti-1")
+		Expect(testsuite.CreateWithRetry(firstCtx, c, cfg)).To(Succeed())
+		token := func() string {
+			obj := object.NewViewObject("udm", "Config")
+			if err := c.Get(firstCtx, client.ObjectKeyFromObject(cfg), obj); err != nil {
+				return ""
+			}
+			return udm.ConfigToken(obj)
+		}
+		Eventually(token, timeout, interval).ShouldNot(BeEmpty())
+		oldToken := token()
+		Eventually(func() error { return list(port, oldToken) }, timeout, interval).Should(Succeed())
+
+		Expect(d.RotateUEToken(firstCtx, "guti-1")).To(Succeed())
+		newToken := token()
+		Expect(apierrors.IsUnauthorized(list(port, oldToken))).To(BeTrue())
+
+		// restart
+		firstCancel()
+		_, port = start(ctx)
+
+		// the fresh token is accepted, so the old one is rejected for being revoked
+		Eventually(func() error { return list(port, newToken) }, timeout, interval).Should(Succeed())
+		Expect(apierrors.IsUnauthorized(list(port, oldToken))).To(BeTrue())
+	})
+})
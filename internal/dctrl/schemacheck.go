@@ -0,0 +1,255 @@
+package dctrl
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// viewGroupSuffix is the suffix of the API group of the views of an operator.
+const viewGroupSuffix = ".view.dcontroller.io"
+
+// schemaController is the part of a declarative controller the schema check looks at.
+type schemaController struct {
+	Name    string `json:"name"`
+	Sources []struct {
+		APIGroup string `json:"apiGroup"`
+		Kind     string `json:"kind"`
+	} `json:"sources"`
+	Pipeline []map[string]any `json:"pipeline"`
+	Target   struct {
+		APIGroup string `json:"apiGroup"`
+		Kind     string `json:"kind"`
+	} `json:"target"`
+}
+
+// schemaKind is a view kind of an operator.
+type schemaKind struct{ operator, kind string }
+
+func (k schemaKind) String() string { return k.operator + "/" + k.kind }
+
+// schemaProducer is the shape of the views a controller writes: the top-level spec and status
+// fields, keyed by the section, which is missing if its shape cannot be told from the pipeline,
+// e.g., the spec is copied as a whole.
+type schemaProducer struct {
+	operator, controller string
+	fields               map[string]map[string]bool
+}
+
+// checkSchemas checks the cross-operator references of the declarative operators: each spec and
+// status field a controller reads from a view written by the controllers of another operator must
+// be written by one of those controllers, and a view read from another operator must be written
+// there. Only the top-level fields are checked, and only those of the views whose shape can be
+// told from the pipelines; the fields the reader checks for presence (@exists, @isnil) are
+// optional, and the views written by the native controllers are not checked. The spec files that
+// cannot be read are skipped, the operator fails to load anyway. Returns the mismatches found.
+func checkSchemas(specs []OpSpec) []string {
+	ops := map[string][]schemaController{}
+	for _, s := range specs {
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			continue
+		}
+		var spec struct {
+			Controllers []schemaController `json:"controllers"`
+		}
+		if err := yaml.Unmarshal(data, &spec); err != nil {
+			continue
+		}
+		ops[s.Name] = spec.Controllers
+	}
+
+	producers := map[schemaKind][]schemaProducer{}
+	for op, cs := range ops {
+		for _, c := range cs {
+			k := schemaKind{viewOperator(c.Target.APIGroup, op), c.Target.Kind}
+			producers[k] = append(producers[k], schemaProducer{
+				operator:   op,
+				controller: c.Name,
+				fields:     producedFields(c.Pipeline),
+			})
+		}
+	}
+
+	issues := []string{}
+	for op, cs := range ops {
+		for _, c := range cs {
+			for _, s := range c.Sources {
+				k := schemaKind{viewOperator(s.APIGroup, op), s.Kind}
+				if _, loaded := ops[k.operator]; !loaded {
+					// native operator
+					continue
+				}
+
+				// the writers in other operators
+				ps := slices.DeleteFunc(slices.Clone(producers[k]), func(p schemaProducer) bool {
+					return p.operator == op
+				})
+				if len(ps) == 0 {
+					if k.operator != op {
+						issues = append(issues, fmt.Sprintf("%s/%s reads %s, which is not written by "+
+							"operator %q", op, c.Name, k, k.operator))
+					}
+					continue
+				}
+
+				prefix := `\$\.`
+				if len(c.Sources) > 1 {
+					prefix += regexp.QuoteMeta(s.Kind) + `\.`
+				}
+				read, optional := consumedFields(c.Pipeline, prefix)
+				for _, f := range read {
+					if optional[f] || produced(ps, f) {
+						continue
+					}
+					issues = append(issues, fmt.Sprintf("%s/%s reads %s.%s, which is not written by %s",
+						op, c.Name, k, f, producerNames(ps)))
+				}
+			}
+		}
+	}
+
+	sort.Strings(issues)
+	return slices.Compact(issues)
+}
+
+// viewOperator returns the operator of a view API group, the given operator if the group is empty.
+func viewOperator(group, op string) string {
+	if group == "" {
+		return op
+	}
+	if name, ok := strings.CutSuffix(group, viewGroupSuffix); ok {
+		return name
+	}
+	return group
+}
+
+// producedFields returns the top-level spec and status fields written by the last @project of a
+// pipeline, keyed by "spec" and "status". A section is missing if its shape is unknown.
+func producedFields(pipeline []map[string]any) map[string]map[string]bool {
+	var project any
+	for _, stage := range pipeline {
+		if p, ok := stage["@project"]; ok {
+			project = p
+		}
+	}
+	m, ok := project.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	ret := map[string]map[string]bool{}
+	for _, section := range []string{"spec", "status"} {
+		v, ok := m[section]
+		if !ok {
+			ret[section] = map[string]bool{}
+			continue
+		}
+		if fields, ok := literalFields(v); ok {
+			ret[section] = fields
+		}
+	}
+	return ret
+}
+
+// literalFields returns the keys of a literal map, or the union of the keys of the branches of a
+// conditional. Returns false if the value is an expression.
+func literalFields(v any) (map[string]bool, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	if cond, ok := m["@cond"]; ok && len(m) == 1 {
+		branches, ok := cond.([]any)
+		if !ok || len(branches) != 3 {
+			return nil, false
+		}
+		ret := map[string]bool{}
+		for _, b := range branches[1:] {
+			fields, ok := literalFields(b)
+			if !ok {
+				return nil, false
+			}
+			for f := range fields {
+				ret[f] = true
+			}
+		}
+		return ret, true
+	}
+
+	ret := map[string]bool{}
+	for k := range m {
+		if strings.HasPrefix(k, "@") {
+			return nil, false
+		}
+		ret[k] = true
+	}
+	return ret, true
+}
+
+// consumedFields returns the spec and status fields, e.g., "spec.suci", referenced with the given
+// prefix in the stages of a pipeline up to the first @project, after which the references are to
+// the projected object, and the fields that are only checked for presence.
+func consumedFields(pipeline []map[string]any, prefix string) ([]string, map[string]bool) {
+	ref := regexp.MustCompile(`(?:^|[^$\w.])` + prefix + `(spec|status)\.([A-Za-z0-9_]+)`)
+
+	read, optional := []string{}, map[string]bool{}
+	var walk func(v any, presence bool)
+	walk = func(v any, presence bool) {
+		switch v := v.(type) {
+		case string:
+			for _, m := range ref.FindAllStringSubmatch(v, -1) {
+				f := m[1] + "." + m[2]
+				read = append(read, f)
+				if presence {
+					optional[f] = true
+				}
+			}
+		case []any:
+			for _, e := range v {
+				walk(e, presence)
+			}
+		case map[string]any:
+			for k, e := range v {
+				walk(e, presence || k == "@exists" || k == "@isnil")
+			}
+		}
+	}
+
+	for _, stage := range pipeline {
+		walk(map[string]any(stage), false)
+		if _, ok := stage["@project"]; ok {
+			break
+		}
+	}
+
+	sort.Strings(read)
+	return slices.Compact(read), optional
+}
+
+// produced returns true if a field is written by one of the producers or the shape of the
+// producers is unknown.
+func produced(ps []schemaProducer, field string) bool {
+	section, name, _ := strings.Cut(field, ".")
+	for _, p := range ps {
+		fields, ok := p.fields[section]
+		if !ok || fields[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func producerNames(ps []schemaProducer) string {
+	names := make([]string, 0, len(ps))
+	for _, p := range ps {
+		names = append(names, p.operator+"/"+p.controller)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
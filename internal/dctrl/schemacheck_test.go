@@ -0,0 +1,96 @@
+package dctrl_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+)
+
+var _ = Describe("Operator schema check", func() {
+	It("should accept the shipped operators in strict mode", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:           opSpecs,
+			HTTPMode:          true,
+			StrictSchemaCheck: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should flag a field read by an operator that is not written by the other", func() {
+		// make the AUSF read a field of the MobileIdentity the AMF does not write
+		dir := GinkgoT().TempDir()
+		specs := []dctrl.OpSpec{}
+		for _, s := range opSpecs {
+			data, err := os.ReadFile(s.File)
+			Expect(err).NotTo(HaveOccurred())
+			if s.Name == "ausf" {
+				Expect(string(data)).To(ContainSubstring("$.MobileIdentity.spec.suci)]"))
+				data = []byte(strings.ReplaceAll(string(data), "$.MobileIdentity.spec.suci)]",
+					"$.MobileIdentity.spec.suciValue)]"))
+			}
+			file := filepath.Join(dir, filepath.Base(s.File))
+			Expect(os.WriteFile(file, data, 0o600)).To(Succeed())
+			specs = append(specs, dctrl.OpSpec{Name: s.Name, File: file})
+		}
+
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:           specs,
+			HTTPMode:          true,
+			StrictSchemaCheck: true,
+		})
+		Expect(err).To(MatchError(ContainSubstring(
+			"ausf/supi-req-handler reads ausf/MobileIdentity.spec.suciValue, which is not written by amf/register-identity-req")))
+
+		// only a warning by default
+		_, err = dctrl.New(dctrl.Options{OpSpecs: specs, HTTPMode: true})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("Operator spec validation", func() {
+	It("should accept the shipped operators", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:         opSpecs,
+			HTTPMode:        true,
+			ValidateOpSpecs: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report the missing field of a structurally invalid spec", func() {
+		// a spec that parses but whose second controller has no target kind
+		file := filepath.Join(GinkgoT().TempDir(), "invalid.yaml")
+		Expect(os.WriteFile(file, []byte(`
+controllers:
+  - name: valid
+    sources:
+      - kind: Foo
+    pipeline:
+      - "@project": {metadata: "$.metadata"}
+    target:
+      kind: Bar
+  - name: invalid
+    sources:
+      - kind: Foo
+    pipeline:
+      - "@project": {metadata: "$.metadata"}
+    target:
+      apiGroup: invalid.view.dcontroller.io`), 0o600)).To(Succeed())
+
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:         []dctrl.OpSpec{{Name: "invalid", File: file}},
+			HTTPMode:        true,
+			ValidateOpSpecs: true,
+		})
+		var loadErr *dctrl.OperatorLoadError
+		Expect(errors.As(err, &loadErr)).To(BeTrue())
+		Expect(loadErr.Name).To(Equal("invalid"))
+		Expect(err).To(MatchError(ContainSubstring("controllers[1].target.kind: is required")))
+	})
+})
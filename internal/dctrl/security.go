@@ -0,0 +1,158 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+const (
+	// selectedAlgorithmTableName is the name of the AMF:SelectedAlgorithmTable.
+	selectedAlgorithmTableName = "selected-algorithms"
+	// configTableName is the name of the AMF:ConfigTable.
+	configTableName = "amf-config"
+)
+
+// securityNegotiator selects the encryption and the integrity algorithm of each registration as
+// the highest algorithm supported both by the UE and by the security policy of the AMF config
+// table, which the pipelines of the AMF cannot, and lists the selection in the AMF selected
+// algorithm table, from where the AMF exposes it in the status of the validated registrations.
+// Whether the UE supports any of the allowed algorithms is checked by the AMF itself.
+type securityNegotiator struct {
+	client client.Client
+	log    logr.Logger
+}
+
+// addSecurityNegotiator adds the security negotiator to the AMF operator.
+func addSecurityNegotiator(op *trackedOperator, c client.Client, logger logr.Logger) error {
+	r := &securityNegotiator{client: c, log: logger.WithName("security-negotiator")}
+	return addWatchController(op, "amf", "security-negotiator", "Registration", r)
+}
+
+func (r *securityNegotiator) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object).String()
+
+	var selected map[string]any
+	if req.EventType != object.Deleted {
+		policy, err := r.getPolicy(ctx)
+		if err != nil {
+			// the table may not be initialized yet: retry
+			return reconcile.Result{}, err
+		}
+
+		content := req.Object.UnstructuredContent()
+		ea, _, _ := unstructured.NestedStringSlice(content, "spec", "ueSecurityCapability", "encryptionAlgorithms")
+		ia, _, _ := unstructured.NestedStringSlice(content, "spec", "ueSecurityCapability", "integrityAlgorithms")
+		enc, integ := selectAlgorithm(ea, policy["encryptionAlgorithms"]), selectAlgorithm(ia, policy["integrityAlgorithms"])
+		if enc != "" && integ != "" {
+			r.log.V(1).Info("selected algorithms", "registration", key, "encryption", enc, "integrity", integ)
+			selected = map[string]any{"registration": key, "encryption": enc, "integrity": integ}
+		}
+	}
+
+	if err := r.setSelected(ctx, key, selected); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// getPolicy returns the algorithms allowed by the security policy of the AMF config table.
+func (r *securityNegotiator) getPolicy(ctx context.Context) (map[string][]string, error) {
+	table := object.NewViewObject("amf", "ConfigTable")
+	object.SetName(table, "", configTableName)
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+		return nil, fmt.Errorf("failed to get the config table: %w", err)
+	}
+
+	policy := map[string][]string{}
+	for _, field := range []string{"encryptionAlgorithms", "integrityAlgorithms"} {
+		algs, _, _ := unstructured.NestedStringSlice(table.UnstructuredContent(), "spec", "securityPolicy", field)
+		policy[field] = algs
+	}
+	return policy, nil
+}
+
+// setSelected sets the algorithms selected for a registration in the selected algorithm table,
+// or removes the registration from the table if selected is nil.
+func (r *securityNegotiator) setSelected(ctx context.Context, key string, selected map[string]any) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "SelectedAlgorithmTable")
+		object.SetName(table, "", selectedAlgorithmTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		list, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "selected")
+		i := -1
+		for j, e := range list {
+			if m, ok := e.(map[string]any); ok && m["registration"] == key {
+				i = j
+				break
+			}
+		}
+		switch {
+		case selected != nil && i < 0:
+			list = append(list, selected)
+		case selected != nil && !equalSelection(list[i], selected):
+			list[i] = selected
+		case selected == nil && i >= 0:
+			list = slices.Delete(list, i, i+1)
+		default:
+			return nil
+		}
+
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), list,
+			"spec", "selected"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		// the table may not be initialized yet: retry
+		return fmt.Errorf("failed to update the selected algorithm table: %w", err)
+	}
+	return nil
+}
+
+func equalSelection(e any, selected map[string]any) bool {
+	m, ok := e.(map[string]any)
+	return ok && m["encryption"] == selected["encryption"] && m["integrity"] == selected["integrity"]
+}
+
+// selectAlgorithm returns the highest algorithm supported both by the UE and by the network, or
+// an empty string if there is none. The algorithms are ranked by their identifier, e.g., 5G-EA3
+// is higher than 5G-EA2.
+func selectAlgorithm(ue, network []string) string {
+	selected, rank := "", -1
+	for _, alg := range ue {
+		if !slices.Contains(network, alg) {
+			continue
+		}
+		if id := algorithmID(alg); id > rank {
+			selected, rank = alg, id
+		}
+	}
+	return selected
+}
+
+// algorithmID returns the identifier of an algorithm, the number after the prefix, e.g., 2 for
+// 5G-EA2, or 0 if the algorithm has no identifier.
+func algorithmID(alg string) int {
+	i := strings.LastIndexFunc(alg, func(r rune) bool { return r < '0' || r > '9' })
+	id, err := strconv.Atoi(alg[i+1:])
+	if err != nil {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,164 @@
+package dctrl
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+)
+
+// OperatorWatch is the state of a watch of a native controller.
+type OperatorWatch struct {
+	Operator string `json:"operator"`
+	udm.WatchStatus
+}
+
+// GetWatches returns the state of the watches of the native controllers.
+func (d *Dctrl) GetWatches() []OperatorWatch {
+	ws := []OperatorWatch{}
+	for _, w := range d.udm.GetWatches() {
+		ws = append(ws, OperatorWatch{Operator: udm.OperatorName, WatchStatus: w})
+	}
+	return ws
+}
+
+// loadVerificationKeys returns the public half of the UDM signing key and the public keys of
+// the additional certificates, keyed by their key ids.
+func loadVerificationKeys(keyFile string, certFiles []string) (map[string]*rsa.PublicKey, error) {
+	keys := map[string]*rsa.PublicKey{}
+
+	privateKey, err := auth.LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key %q: %w", keyFile, err)
+	}
+	keys[jwks.KeyID(&privateKey.PublicKey)] = &privateKey.PublicKey
+
+	for _, certFile := range certFiles {
+		publicKey, err := auth.LoadPublicKey(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key %q: %w", certFile, err)
+		}
+		keys[jwks.KeyID(publicKey)] = publicKey
+	}
+
+	return keys, nil
+}
+
+// Health is the health of the operators.
+type Health struct {
+	APIServerBound bool               `json:"apiServerBound"`
+	TokenSelfTest  udm.SelfTestStatus `json:"tokenSelfTest"`
+}
+
+// healthzHandler serves the health as JSON, with status code 503 if the embedded API server does
+// not accept connections or the last token signing self-test failed.
+func (d *Dctrl) healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	h := Health{APIServerBound: d.apiServerBound.Load(), TokenSelfTest: d.udm.GetTokenSelfTest()}
+	w.Header().Set("Content-Type", "application/json")
+	if !h.APIServerBound || (h.TokenSelfTest.LastRun != nil && !h.TokenSelfTest.OK) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		d.log.Error(err, "failed to write health response")
+	}
+}
+
+// parsePathPrefix normalizes the path prefix of the service or the API endpoints: the prefix must
+// be an absolute path, the trailing slash is dropped.
+func parsePathPrefix(name, prefix string) (string, error) {
+	if prefix == "" || prefix == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return "", fmt.Errorf("invalid %s path prefix %q: not an absolute path", name, prefix)
+	}
+	if strings.ContainsAny(prefix, "?#{}") {
+		return "", fmt.Errorf("invalid %s path prefix %q", name, prefix)
+	}
+	return strings.TrimRight(prefix, "/"), nil
+}
+
+// startServiceServer serves the auxiliary endpoints until the context is cancelled:
+//   - /debug/watches: the watches of the native controllers with the time of the last event.
+//   - /debug/counts: the sizes of the aggregate tables, if the counter view is enabled.
+//   - /.well-known/jwks.json: the keys for verifying the tokens issued by the UDM.
+//   - /metrics: the Prometheus metrics.
+//   - /readyz: the readiness, with the state of each gate if called with "?verbose".
+//   - /healthz: whether the API server is bound and the result of the last UDM token signing
+//     self-test.
+//   - /sessions: the sessions with their QoS flows, filtered by the "flow" and the "fiveQI" query
+//     parameters, if given.
+//   - /usage, /usage/{namespace}: the usage records of the sessions of all the UEs or of a UE, if
+//     the usage accounting is enabled.
+//   - /subscribers, /subscribers/{supi}: the subscriber profiles provisioned at runtime, which
+//     can be created, updated and deleted with PUT and DELETE, given an authorized token; PUT and
+//     DELETE are refused if the authentication is disabled.
+//
+// The endpoints are mounted under the service path prefix, if any.
+func (d *Dctrl) startServiceServer(ctx context.Context, l net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/watches", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(d.GetWatches()); err != nil {
+			d.log.Error(err, "failed to write debug response")
+		}
+	})
+	mux.HandleFunc("GET /debug/counts", func(w http.ResponseWriter, _ *http.Request) {
+		counts, ok := d.GetCounts()
+		if !ok {
+			http.Error(w, "counter view disabled", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(counts); err != nil {
+			d.log.Error(err, "failed to write debug response")
+		}
+	})
+	mux.Handle("GET "+jwks.Path, jwks.Handler(jwks.NewSet(d.verificationKeys)))
+	mux.HandleFunc("GET /readyz", d.readyzHandler)
+	mux.HandleFunc("GET /healthz", d.healthzHandler)
+	mux.HandleFunc("GET /sessions", d.sessionsHandler)
+	mux.HandleFunc("GET /usage", d.usageHandler)
+	mux.HandleFunc("GET /usage/{namespace}", d.usageHandler)
+	mux.HandleFunc("GET /subscribers", d.subscribersHandler)
+	mux.HandleFunc("GET /subscribers/{supi}", d.subscribersHandler)
+	mux.HandleFunc("PUT /subscribers/{supi}", d.subscribersHandler)
+	mux.HandleFunc("DELETE /subscribers/{supi}", d.subscribersHandler)
+	gatherer := metrics.Gatherer
+	if d.managerMetrics {
+		gatherer = ctrlmetrics.Registry
+	}
+	mux.Handle("GET /metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	var handler http.Handler = mux
+	if d.servicePrefix != "" {
+		prefixed := http.NewServeMux()
+		prefixed.Handle(d.servicePrefix+"/", http.StripPrefix(d.servicePrefix, mux))
+		handler = prefixed
+	}
+
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close() //nolint:errcheck
+	}()
+
+	d.log.V(1).Info("starting service server", "address", l.Addr().String())
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		d.log.Error(err, "service server error")
+	}
+}
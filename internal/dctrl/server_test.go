@@ -0,0 +1,318 @@
+package dctrl_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Service endpoints", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should report a recent last-event timestamp after an object change", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr := d.ServiceAddr()
+
+		getWatches := func() ([]dctrl.OperatorWatch, error) {
+			res, err := http.Get("http://" + addr + "/debug/watches")
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close() //nolint:errcheck
+			ws := []dctrl.OperatorWatch{}
+			err = json.NewDecoder(res.Body).Decode(&ws)
+			return ws, err
+		}
+
+		Eventually(func() bool {
+			ws, err := getWatches()
+			return err == nil && len(ws) == 1 && ws[0].Connected
+		}, timeout, interval).Should(BeTrue())
+
+		before := time.Now()
+		yamlData := `
+apiVersion: udm.view.dcontroller.io/v1alpha1
+kind: Config
+metadata:
+  name: test-guti
+  namespace: test-debug`
+		req := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), req)).To(Succeed())
+		Expect(d.GetCache().GetClient().Create(ctx, req)).To(Succeed())
+
+		Eventually(func() bool {
+			ws, err := getWatches()
+			if err != nil || len(ws) != 1 {
+				return false
+			}
+			w := ws[0]
+			return w.Operator == "udm" && w.Connected && w.LastEvent != nil &&
+				!w.LastEvent.Before(before)
+		}, timeout, interval).Should(BeTrue())
+	})
+
+	It("should serve a JWKS that verifies the issued tokens", func() {
+		keyFile, certFile, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:     opSpecs,
+			ServiceAddr: "localhost:0",
+			KeyFile:     keyFile,
+			CertFile:    certFile,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr := d.ServiceAddr()
+
+		set := jwks.Set{}
+		Eventually(func() error {
+			res, err := http.Get("http://" + addr + jwks.Path)
+			if err != nil {
+				return err
+			}
+			defer res.Body.Close() //nolint:errcheck
+			return json.NewDecoder(res.Body).Decode(&set)
+		}, timeout, interval).Should(Succeed())
+		Expect(set.Keys).To(HaveLen(1))
+		Expect(set.Keys[0].Alg).To(Equal("RS256"))
+
+		keys, err := set.PublicKeys()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveKey(set.Keys[0].Kid))
+
+		// the UDM signing key is the API server key
+		privateKey, err := auth.LoadPrivateKey(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		token, err := jwks.NewTokenGenerator(privateKey, "").GenerateToken("test-ns", []string{"test-ns"},
+			udm.RBACRules, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		claims := &auth.Claims{}
+		_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			key, ok := keys[kid]
+			if !ok {
+				return nil, fmt.Errorf("unknown key id %q", kid)
+			}
+			return key, nil
+		}, jwt.WithValidMethods([]string{"RS256"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Username).To(Equal("test-ns"))
+	})
+
+	It("should report the readiness gates transitioning to ready", func() {
+		// a dependency that is initially down keeps the dependenciesReady gate closed
+		dep := newFakeDependency()
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:           opSpecs,
+			ServiceAddr:       "localhost:0",
+			Dependencies:      []dctrl.Dependency{{Name: "subscriber-store", Address: dep.URL}},
+			DependencyTimeout: 10 * time.Second,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr := d.ServiceAddr()
+
+		type readyz struct {
+			code int
+			body string
+		}
+		getReadyz := func() (readyz, error) {
+			res, err := http.Get("http://" + addr + "/readyz?verbose")
+			if err != nil {
+				return readyz{}, err
+			}
+			defer res.Body.Close() //nolint:errcheck
+			body, err := io.ReadAll(res.Body)
+			return readyz{code: res.StatusCode, body: string(body)}, err
+		}
+
+		// everything but the dependency comes up
+		Eventually(func() (string, error) {
+			r, err := getReadyz()
+			return r.body, err
+		}, timeout, interval).Should(And(
+			ContainSubstring("[+]cacheSynced ok"),
+			ContainSubstring("[+]operatorsStarted ok"),
+			ContainSubstring("[+]operatorsSynced ok"),
+			ContainSubstring("[+]leaderAcquired ok"),
+			ContainSubstring("[-]dependenciesReady not ready"),
+			ContainSubstring("readyz check failed"),
+		))
+		r, err := getReadyz()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.code).To(Equal(http.StatusServiceUnavailable))
+
+		dep.up.Store(true)
+
+		Eventually(getReadyz, timeout, interval).Should(Equal(readyz{
+			code: http.StatusOK,
+			body: "[+]cacheSynced ok\n[+]operatorsStarted ok\n[+]operatorsSynced ok\n" +
+				"[+]dependenciesReady ok\n" +
+				"[+]leaderAcquired ok\nreadyz check passed\n",
+		}))
+	})
+
+	It("should repeat the token self-test and report its last run", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:               opSpecs,
+			ServiceAddr:           "localhost:0",
+			TokenSelfTestInterval: 100 * time.Millisecond,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr := d.ServiceAddr()
+
+		getHealth := func() (dctrl.Health, error) {
+			res, err := http.Get("http://" + addr + "/healthz")
+			if err != nil {
+				return dctrl.Health{}, err
+			}
+			defer res.Body.Close() //nolint:errcheck
+			if res.StatusCode != http.StatusOK {
+				return dctrl.Health{}, fmt.Errorf("unexpected status %d", res.StatusCode)
+			}
+			h := dctrl.Health{}
+			err = json.NewDecoder(res.Body).Decode(&h)
+			return h, err
+		}
+
+		var first time.Time
+		Eventually(func() bool {
+			h, err := getHealth()
+			if err != nil || h.TokenSelfTest.LastRun == nil {
+				return false
+			}
+			first = *h.TokenSelfTest.LastRun
+			return h.TokenSelfTest.OK
+		}, timeout, interval).Should(BeTrue())
+
+		// the self-test is repeated
+		Eventually(func() bool {
+			h, err := getHealth()
+			return err == nil && h.TokenSelfTest.OK && h.TokenSelfTest.LastRun != nil &&
+				h.TokenSelfTest.LastRun.After(first)
+		}, timeout, interval).Should(BeTrue())
+
+		Expect(testutil.ToFloat64(metrics.TokenSelfTestSuccess)).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.TokenSelfTestTimestamp)).
+			To(BeNumerically(">=", float64(first.Unix())))
+	})
+
+	It("should mount the endpoints under the configured path prefix", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:           opSpecs,
+			ServiceAddr:       "localhost:0",
+			ServicePathPrefix: "/dctrl5g/",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(d.ServiceAddr, timeout, interval).ShouldNot(BeEmpty())
+		addr := d.ServiceAddr()
+
+		status := func(path string) func() int {
+			return func() int {
+				res, err := http.Get("http://" + addr + path)
+				if err != nil {
+					return 0
+				}
+				defer res.Body.Close() //nolint:errcheck
+				_, _ = io.Copy(io.Discard, res.Body)
+				return res.StatusCode
+			}
+		}
+
+		Eventually(status("/dctrl5g/healthz"), timeout, interval).Should(Equal(http.StatusOK))
+		Expect(status("/dctrl5g/debug/watches")()).To(Equal(http.StatusOK))
+		Expect(status("/dctrl5g/metrics")()).To(Equal(http.StatusOK))
+		Expect(status("/dctrl5g" + jwks.Path)()).To(Equal(http.StatusOK))
+
+		// not at the root
+		for _, path := range []string{"/healthz", "/debug/watches", "/metrics", jwks.Path} {
+			Expect(status(path)()).To(Equal(http.StatusNotFound), path)
+		}
+	})
+
+	It("should serve the API server under the configured path prefix", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:       opSpecs,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+			APIPathPrefix: "/dctrl5g/",
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := func(path string) func() int {
+			return func() int {
+				res, err := http.Get(fmt.Sprintf("http://localhost:%d%s", d.APIServerPort(), path))
+				if err != nil {
+					return 0
+				}
+				defer res.Body.Close() //nolint:errcheck
+				_, _ = io.Copy(io.Discard, res.Body)
+				return res.StatusCode
+			}
+		}
+
+		const registrations = "/apis/amf.view.dcontroller.io/v1alpha1/registration"
+		Eventually(status("/dctrl5g"+registrations), timeout, interval).Should(Equal(http.StatusOK))
+		Expect(status("/dctrl5g/apis")()).To(Equal(http.StatusOK))
+
+		// not at the root
+		for _, path := range []string{registrations, "/apis"} {
+			Expect(status(path)()).To(Equal(http.StatusNotFound), path)
+		}
+	})
+
+	It("should reject a relative path prefix", func() {
+		_, err := dctrl.New(dctrl.Options{
+			OpSpecs:           opSpecs,
+			HTTPMode:          true,
+			ServicePathPrefix: "dctrl5g",
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid service path prefix")))
+
+		_, err = dctrl.New(dctrl.Options{
+			OpSpecs:       opSpecs,
+			HTTPMode:      true,
+			APIPathPrefix: "dctrl5g",
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid API path prefix")))
+	})
+})
@@ -0,0 +1,134 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// sessionWaiter lets a session whose registration is still in progress wait for the
+// registration instead of failing outright: within the wait the Unregistered verdict of the
+// AMF is replaced with Validated=Unknown/RegistrationPending, and the AMF revalidates the session
+// once the registration shows up in the active registration table. Sessions still pending after
+// the wait fail with Unregistered.
+type sessionWaiter struct {
+	client    client.Client
+	wait      time.Duration
+	mu        sync.Mutex
+	firstSeen map[client.ObjectKey]time.Time
+	log       logr.Logger
+}
+
+// addSessionWaiter adds the session waiter to the SMF operator, which owns the session contexts.
+func addSessionWaiter(op *trackedOperator, c client.Client, wait time.Duration, logger logr.Logger) error {
+	r := &sessionWaiter{
+		client:    c,
+		wait:      wait,
+		firstSeen: map[client.ObjectKey]time.Time{},
+		log:       logger.WithName("session-waiter"),
+	}
+	return addWatchController(op, "smf", "session-waiter", "SessionContext", r)
+}
+
+func (r *sessionWaiter) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		r.forget(key)
+		return reconcile.Result{}, nil
+	}
+
+	obj := object.NewViewObject("smf", "SessionContext")
+	if err := r.client.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(key)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	reason, _, _ := unstructured.NestedString(obj.UnstructuredContent(),
+		"status", "conditions", "validated", "reason")
+	if reason != metrics.ReasonUnregistered && reason != metrics.ReasonRegistrationPending {
+		r.forget(key)
+		return reconcile.Result{}, nil
+	}
+
+	r.mu.Lock()
+	start, ok := r.firstSeen[key]
+	if !ok {
+		start = time.Now()
+		r.firstSeen[key] = start
+	}
+	r.mu.Unlock()
+
+	remaining := r.wait - time.Since(start)
+	switch {
+	case remaining > 0 && reason == metrics.ReasonUnregistered:
+		if err := r.setValidated(ctx, key, "Unknown", metrics.ReasonRegistrationPending,
+			"Waiting for the registration to complete"); err != nil {
+			return reconcile.Result{}, err
+		}
+	case remaining <= 0 && reason == metrics.ReasonRegistrationPending:
+		r.log.V(1).Info("registration not found within the wait", "session", key, "wait", r.wait)
+		if err := r.setValidated(ctx, key, "False", metrics.ReasonUnregistered, "Registration not found"); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if remaining > 0 {
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+	return reconcile.Result{}, nil
+}
+
+func (r *sessionWaiter) forget(key client.ObjectKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.firstSeen, key)
+}
+
+// setValidated rewrites the validated condition of a session context, unless the AMF has
+// revalidated the session in the meantime.
+func (r *sessionWaiter) setValidated(ctx context.Context, key client.ObjectKey, status, reason, message string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("smf", "SessionContext")
+		if err := r.client.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		current, _, _ := unstructured.NestedString(obj.UnstructuredContent(),
+			"status", "conditions", "validated", "reason")
+		if current != metrics.ReasonUnregistered && current != metrics.ReasonRegistrationPending {
+			return nil
+		}
+
+		validated := map[string]any{"status": status, "reason": reason, "message": message}
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), validated,
+			"status", "conditions", "validated"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, obj)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update session context %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Session registration wait", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                 opSpecs,
+			SessionRegistrationWait: time.Second,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	createSession := func(name, guti string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Session
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  nssai: eMBB
+  guti: %[2]s
+  sessionId: 1
+  pduSessionType: IPv4
+  sscMode: SSC1
+  networkConfiguration:
+    requests:
+      - type: IPConfiguration
+        addressFamily: IPv4
+  qos:
+    flows:
+      - name: best-effort-flow
+        fiveQI: BestEffort
+    rules:
+      - name: default-rule
+        precedence: 255
+        default: true
+        qosFlow: best-effort-flow
+        filters:
+          - name: match-all
+            direction: Bidirectional
+            match:
+              type: MatchAll`, name, guti)
+		sess := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &sess)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, sess)).To(Succeed())
+	}
+
+	// condition returns the status and the reason of a condition of a session
+	condition := func(name, condType string) func() [2]string {
+		return func() [2]string {
+			sess := object.NewViewObject("amf", "Session")
+			object.SetName(sess, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(sess), sess); err != nil {
+				return [2]string{}
+			}
+			conds, _, _ := unstructured.NestedSlice(sess.UnstructuredContent(), "status", "conditions")
+			for _, cd := range conds {
+				if cond, ok := cd.(map[string]any); ok && cond["type"] == condType {
+					status, _ := cond["status"].(string)
+					reason, _ := cond["reason"].(string)
+					return [2]string{status, reason}
+				}
+			}
+			return [2]string{}
+		}
+	}
+
+	It("should let a session created before the registration is Ready succeed", func() {
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+
+		// the session races the registration
+		createSession("user-1", "guti-310-170-3F-152-2A-B7C8D9E0")
+
+		Eventually(condition("user-1", "Ready"), timeout, interval).
+			Should(Equal([2]string{"True", "SessionSuccessful"}))
+	})
+
+	It("should fail a session whose registration does not complete within the wait", func() {
+		createSession("user-2", "guti-310-170-3F-152-2A-B7C8D9E1")
+
+		Eventually(condition("user-2", "Validated"), timeout, interval).
+			Should(Equal([2]string{"Unknown", "RegistrationPending"}))
+		Eventually(condition("user-2", "Validated"), timeout, interval).
+			Should(Equal([2]string{"False", "Unregistered"}))
+	})
+})
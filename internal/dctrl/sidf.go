@@ -0,0 +1,154 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/sidf"
+)
+
+// suciToSupiTableName and suciToSupiTableNamespace identify the AUSF:SuciToSupiTable.
+const (
+	suciToSupiTableName      = "suci-to-supi"
+	suciToSupiTableNamespace = "default"
+)
+
+// suciDeconcealer resolves the SUCIs concealed with an ECIES profile, which the AUSF pipelines
+// cannot decrypt: the SUPI de-concealed by the SIDF is added to the SUCI to SUPI table, from where
+// the AUSF resolves the mobile identity as for the provisioned SUCIs. The de-concealed entries are
+// marked with deconcealed: true and removed with the mobile identity. The null-scheme SUCIs are
+// left to the static table.
+type suciDeconcealer struct {
+	client client.Client
+	sidf   *sidf.SIDF
+	mu     sync.Mutex
+	sucis  map[client.ObjectKey]string // the de-concealed SUCI of each mobile identity
+	log    logr.Logger
+}
+
+// addSuciDeconcealer adds the SUCI de-concealer to the AUSF operator.
+func addSuciDeconcealer(op *trackedOperator, c client.Client, s *sidf.SIDF, logger logr.Logger) error {
+	r := &suciDeconcealer{
+		client: c,
+		sidf:   s,
+		sucis:  map[client.ObjectKey]string{},
+		log:    logger.WithName("suci-deconcealer"),
+	}
+	return addWatchController(op, "ausf", "suci-deconcealer", "MobileIdentity", r)
+}
+
+func (r *suciDeconcealer) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, r.remove(ctx, key)
+	}
+
+	suci, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "suci")
+	if !sidf.IsConcealed(suci) {
+		return reconcile.Result{}, nil
+	}
+	supi, err := r.sidf.Deconceal(suci)
+	if err != nil {
+		// the mobile identity is failed by the AUSF with MobileIdentityNotFound
+		r.log.Info("failed to de-conceal SUCI", "mobile-identity", key.String(), "error", err.Error())
+		return reconcile.Result{}, nil
+	}
+
+	r.mu.Lock()
+	r.sucis[key] = suci
+	r.mu.Unlock()
+
+	return reconcile.Result{}, r.add(ctx, suci, supi)
+}
+
+// add adds a de-concealed SUCI to the SUCI to SUPI table, unless it is listed.
+func (r *suciDeconcealer) add(ctx context.Context, suci, supi string) error {
+	added := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		added = false
+		table := object.NewViewObject("ausf", "SuciToSupiTable")
+		object.SetName(table, suciToSupiTableNamespace, suciToSupiTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		for _, e := range entries {
+			if entry, ok := e.(map[string]any); ok && entry["suci"] == suci {
+				return nil
+			}
+		}
+
+		entries = append(entries, map[string]any{"suci": suci, "supi": supi, "deconcealed": true})
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), entries, "spec"); err != nil {
+			return err
+		}
+		added = true
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		// the table may not be initialized yet: retry
+		return fmt.Errorf("failed to add the de-concealed SUCI %q: %w", suci, err)
+	}
+	if added {
+		r.log.V(1).Info("SUCI de-concealed", "suci", suci, "supi", supi)
+	}
+	return nil
+}
+
+// remove removes the de-concealed SUCI of a deleted mobile identity from the SUCI to SUPI table,
+// unless another mobile identity holds the SUCI.
+func (r *suciDeconcealer) remove(ctx context.Context, key client.ObjectKey) error {
+	r.mu.Lock()
+	suci, ok := r.sucis[key]
+	delete(r.sucis, key)
+	for _, s := range r.sucis {
+		if s == suci {
+			ok = false
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("ausf", "SuciToSupiTable")
+		object.SetName(table, suciToSupiTableNamespace, suciToSupiTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		kept := make([]any, 0, len(entries))
+		for _, e := range entries {
+			if entry, ok := e.(map[string]any); ok && entry["suci"] == suci && entry["deconcealed"] == true {
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if len(kept) == len(entries) {
+			return nil
+		}
+
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), kept, "spec"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove the de-concealed SUCI %q: %w", suci, err)
+	}
+	return nil
+}
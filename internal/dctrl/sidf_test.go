@@ -0,0 +1,132 @@
+package dctrl_test
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/sidf"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// The ECIES Profile A SUCI of the test vector of 3GPP TS 33.501 Annex C.4.3, concealing the SUPI
+// imsi-00101001002086 with home network key 1.
+const (
+	hnPrivateKey  = "c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d"
+	concealedSuci = "suci-0-001-01-0000-1-1-b2e92f836055a255837debf850b528997ce0201cb82adfe4be1f587d07d8457d" +
+		"cb02352410cddd9e730ef3fa87"
+)
+
+var _ = Describe("SUCI de-concealment", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		b, err := hex.DecodeString(hnPrivateKey)
+		Expect(err).NotTo(HaveOccurred())
+		key, err := ecdh.X25519().NewPrivateKey(b)
+		Expect(err).NotTo(HaveOccurred())
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		keyFile := filepath.Join(GinkgoT().TempDir(), "hn.key")
+		Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+			Type:    "PRIVATE KEY",
+			Headers: map[string]string{sidf.KeyIDHeader: "1"},
+			Bytes:   der,
+		}), 0o600)).To(Succeed())
+
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:            opSpecs,
+			HomeNetworkKeyFile: keyFile,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name, suci string) {
+		yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: %[2]s
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name, suci)
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	// identity returns a poller for the SUPI and the reason of the Ready condition of the mobile
+	// identity of a registration
+	identity := func(name string) func() []string {
+		return func() []string {
+			obj := object.NewViewObject("ausf", "MobileIdentity")
+			object.SetName(obj, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return nil
+			}
+			supi, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "status", "supi")
+			conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			for _, c := range conds {
+				if cond, ok := c.(map[string]any); ok && cond["type"] == "Ready" {
+					return []string{supi, fmt.Sprint(cond["reason"])}
+				}
+			}
+			return nil
+		}
+	}
+
+	It("should resolve a SUCI concealed with ECIES Profile A", func() {
+		register("user-1", concealedSuci)
+
+		Eventually(identity("user-1"), timeout, interval).Should(
+			Equal([]string{"imsi-00101001002086", "Ready"}))
+	})
+
+	It("should keep resolving the static SUCIs", func() {
+		register("user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0")
+
+		Eventually(identity("user-1"), timeout, interval).Should(
+			Equal([]string{"imsi-999010000000123", "Ready"}))
+	})
+
+	It("should not resolve a SUCI concealed with an unknown key", func() {
+		register("user-1", "suci-0-001-01-0000-1-7-b2e92f836055a255837debf850b528997ce0201cb82adfe4be1f587d07d8457d"+
+			"cb02352410cddd9e730ef3fa87")
+
+		Eventually(identity("user-1"), timeout, interval).Should(
+			Equal([]string{"", "MobileIdentityNotFound"}))
+	})
+})
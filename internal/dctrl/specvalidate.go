@@ -0,0 +1,95 @@
+package dctrl
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	openapierrors "k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"sigs.k8s.io/yaml"
+)
+
+// opSpecSchema is the JSON schema of the operator spec files.
+//
+//go:embed opspec.schema.json
+var opSpecSchema []byte
+
+// validateOpSpecs validates the spec files of the declarative operators against the operator
+// schema, so that a structurally invalid spec, e.g., a controller with no target, is reported with
+// the location of the offending field instead of failing somewhere in the operator. Returns an
+// OperatorLoadError for the first operator with an invalid spec.
+func validateOpSpecs(specs []OpSpec) error {
+	schema := &spec.Schema{}
+	if err := json.Unmarshal(opSpecSchema, schema); err != nil {
+		return fmt.Errorf("invalid operator schema: %w", err)
+	}
+
+	for _, s := range specs {
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return &OperatorLoadError{Name: s.Name, File: s.File, Err: err}
+		}
+		var obj any
+		if err := yaml.Unmarshal(data, &obj); err != nil {
+			return &OperatorLoadError{Name: s.Name, File: s.File, Err: err}
+		}
+		if issues := validateOpSpec(schema, obj); len(issues) > 0 {
+			return &OperatorLoadError{Name: s.Name, File: s.File,
+				Err: fmt.Errorf("invalid operator spec: %s", strings.Join(issues, "; "))}
+		}
+	}
+	return nil
+}
+
+// validateOpSpec returns the schema violations of an operator spec, each prefixed with the path
+// of the field, e.g., "controllers[2].target.kind: required".
+func validateOpSpec(schema *spec.Schema, obj any) []string {
+	res := validate.NewSchemaValidator(schema, nil, "", strfmt.Default).Validate(obj)
+	if res == nil || res.IsValid() {
+		return nil
+	}
+
+	issues := []string{}
+	for _, err := range res.Errors {
+		var verr *openapierrors.Validation
+		if !errors.As(err, &verr) {
+			issues = append(issues, err.Error())
+			continue
+		}
+		path := specFieldPath(verr.Name)
+		// the message repeats the field name
+		msg := strings.TrimPrefix(verr.Error(), verr.Name+" in body ")
+		if path == "" {
+			issues = append(issues, msg)
+		} else {
+			issues = append(issues, path+": "+msg)
+		}
+	}
+	return issues
+}
+
+// specFieldPath converts the dotted path of the validator, e.g., "controllers.2.target.kind", to
+// the usual form with the list indices in brackets.
+func specFieldPath(name string) string {
+	if name == "" || name == "." {
+		return ""
+	}
+	var b strings.Builder
+	for i, elem := range strings.Split(strings.TrimPrefix(name, "."), ".") {
+		switch {
+		case elem != "" && strings.Trim(elem, "0123456789") == "":
+			b.WriteString("[" + elem + "]")
+		case i > 0:
+			b.WriteString("." + elem)
+		default:
+			b.WriteString(elem)
+		}
+	}
+	return b.String()
+}
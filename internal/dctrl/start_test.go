@@ -0,0 +1,185 @@
+package dctrl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-logr/logr"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Startup failures", func() {
+	It("should stop the operators and return an error when the shared cache fails", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:     opSpecs,
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			Logger:      logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheErr := errors.New("injected cache failure")
+		dctrl.SetCacheStarter(d, func(ctx context.Context) error {
+			select {
+			case <-time.After(500 * time.Millisecond):
+				return cacheErr
+			case <-ctx.Done():
+				return nil
+			}
+		})
+
+		eventCtx, eventCancel := context.WithCancel(context.Background())
+		defer eventCancel()
+		events := d.Events(eventCtx)
+
+		// the caller's context is never cancelled: the cache failure alone must tear down
+		errCh := make(chan error, 1)
+		go func() { errCh <- d.Start(context.Background()) }()
+
+		var startErr error
+		Eventually(errCh, timeout, interval).Should(Receive(&startErr))
+		Expect(errors.Is(startErr, cacheErr)).To(BeTrue())
+
+		started, stopped := map[string]bool{}, map[string]bool{}
+	loop:
+		for {
+			select {
+			case e := <-events:
+				switch e.Type {
+				case dctrl.OperatorStarted:
+					started[e.Operator] = true
+				case dctrl.OperatorStopped:
+					stopped[e.Operator] = true
+				}
+			case <-time.After(interval):
+				break loop
+			}
+		}
+		Expect(started).NotTo(BeEmpty())
+		Expect(stopped).To(Equal(started))
+	})
+
+	It("should refuse to load more operators than the maximum", func() {
+		// a directory with more specs than the cap, e.g., matched by a careless glob
+		dir := GinkgoT().TempDir()
+		for i := range 4 {
+			Expect(os.WriteFile(filepath.Join(dir, fmt.Sprintf("op-%d.yaml", i)),
+				[]byte("controllers: []\n"), 0o600)).To(Succeed())
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		specs := []dctrl.OpSpec{}
+		for i, f := range files {
+			specs = append(specs, dctrl.OpSpec{Name: fmt.Sprintf("op-%d", i), File: f})
+		}
+
+		_, err = dctrl.New(dctrl.Options{
+			OpSpecs:      specs,
+			MaxOperators: 3,
+			HTTPMode:     true,
+			DisableAuth:  true,
+			Logger:       logr.Discard(),
+		})
+		Expect(err).To(MatchError(dctrl.ErrTooManyOperators))
+		Expect(err).To(MatchError(ContainSubstring("4 operator specs exceed the maximum of 3")))
+	})
+
+	It("should refuse to stop before being started", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:     opSpecs,
+			HTTPMode:    true,
+			DisableAuth: true,
+			KeyFile:     keyFile,
+			Logger:      logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(d.Stop(context.Background())).To(MatchError(dctrl.ErrNotStarted))
+	})
+
+	It("should drain and stop gracefully", func() {
+		keyFile, _, err := testsuite.WriteCertAndKey(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := dctrl.New(dctrl.Options{
+			OpSpecs:       opSpecs,
+			APIServerPort: dctrl.EphemeralAPIServerPort,
+			HTTPMode:      true,
+			DisableAuth:   true,
+			KeyFile:       keyFile,
+			Logger:        logr.Discard(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		eventCtx, eventCancel := context.WithCancel(context.Background())
+		defer eventCancel()
+		events := d.Events(eventCtx)
+
+		// the caller's context is never cancelled: Stop alone must shut down
+		errCh := make(chan error, 1)
+		go func() { errCh <- d.Start(context.Background()) }()
+
+		addr := fmt.Sprintf("localhost:%d", port)
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", addr)
+			if err == nil {
+				conn.Close() //nolint:errcheck
+			}
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		started, stopped := map[string]bool{}, map[string]bool{}
+		Eventually(func() int {
+			for {
+				select {
+				case e := <-events:
+					if e.Type == dctrl.OperatorStarted {
+						started[e.Operator] = true
+					}
+				default:
+					return len(started)
+				}
+			}
+		}, timeout, interval).Should(Equal(len(opSpecs) + 1))
+
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 2*timeout)
+		defer stopCancel()
+		Expect(d.Stop(stopCtx)).To(Succeed())
+
+		// Start has returned and the API server is gone
+		Expect(errCh).To(Receive(BeNil()))
+		_, err = net.Dial("tcp", addr)
+		Expect(err).To(HaveOccurred())
+
+	loop:
+		for {
+			select {
+			case e := <-events:
+				if e.Type == dctrl.OperatorStopped {
+					stopped[e.Operator] = true
+				}
+			case <-time.After(interval):
+				break loop
+			}
+		}
+		Expect(stopped).To(Equal(started))
+	})
+})
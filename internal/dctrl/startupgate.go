@@ -0,0 +1,104 @@
+package dctrl
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultStartupEstimate is the time the control plane is expected to take to become ready,
+// excluding the wait for the dependencies.
+const defaultStartupEstimate = 5 * time.Second
+
+// startupGate is the client of the API server that rejects the mutating requests with 503 Service
+// Unavailable and a Retry-After header until the control plane first becomes ready, so that the
+// clients back off instead of failing on a cache that has not synced yet. Reads pass through.
+type startupGate struct {
+	client.Client
+	ready    func() bool
+	opened   atomic.Bool
+	started  atomic.Int64 // the start time in Unix nanoseconds, zero if not started
+	expected time.Duration
+}
+
+func newStartupGate(c client.Client, deps []Dependency, depTimeout time.Duration) *startupGate {
+	expected := defaultStartupEstimate
+	if len(deps) > 0 {
+		if depTimeout <= 0 {
+			depTimeout = defaultDependencyTimeout
+		}
+		expected += depTimeout
+	}
+	return &startupGate{Client: c, expected: expected}
+}
+
+// start records the start of the control plane.
+func (g *startupGate) start() { g.started.Store(time.Now().UnixNano()) }
+
+// retryAfter returns the time remaining until the expected end of the startup, at least a second.
+func (g *startupGate) retryAfter() int32 {
+	remaining := g.expected
+	if s := g.started.Load(); s != 0 {
+		remaining -= time.Since(time.Unix(0, s))
+	}
+	return int32(max(1, math.Ceil(remaining.Seconds())))
+}
+
+func (g *startupGate) check() error {
+	if g.opened.Load() {
+		return nil
+	}
+	if g.ready != nil && g.ready() {
+		g.opened.Store(true)
+		return nil
+	}
+
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusServiceUnavailable,
+		Reason:  metav1.StatusReasonServiceUnavailable,
+		Message: "the control plane is starting up, retry later",
+		Details: &metav1.StatusDetails{RetryAfterSeconds: g.retryAfter()},
+	}}
+}
+
+func (g *startupGate) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.Client.Create(ctx, obj, opts...)
+}
+
+func (g *startupGate) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.Client.Update(ctx, obj, opts...)
+}
+
+func (g *startupGate) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (g *startupGate) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.Client.Delete(ctx, obj, opts...)
+}
+
+func (g *startupGate) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.Client.DeleteAllOf(ctx, obj, opts...)
+}
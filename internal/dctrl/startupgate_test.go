@@ -0,0 +1,90 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Startup window", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should reject creates with 503 and Retry-After until ready", func() {
+		// a dependency that never comes up holds the control plane not ready until the timeout
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:           opSpecs,
+			APIServerPort:     dctrl.EphemeralAPIServerPort,
+			Dependencies:      []dctrl.Dependency{{Name: "store", Address: newFakeDependency().URL}},
+			DependencyTimeout: 3 * time.Second,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		body := `{
+  "apiVersion": "amf.view.dcontroller.io/v1alpha1",
+  "kind": "Registration",
+  "metadata": {"name": "user-1", "namespace": "user-1"},
+  "spec": {
+    "registrationType": "initial",
+    "mobileIdentity": {"type": "SUCI", "value": "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"},
+    "ueSecurityCapability": {"encryptionAlgorithms": ["5G-EA0", "5G-EA2"], "integrityAlgorithms": ["5G-IA0", "5G-IA2"]},
+    "requestedNSSAI": [{"sliceType": "eMBB"}]
+  }
+}`
+		url := fmt.Sprintf("http://localhost:%d/apis/amf.view.dcontroller.io/v1alpha1/namespaces/user-1/registration", port)
+
+		// a raw request, as client-go would retry on the Retry-After header
+		var res *http.Response
+		Eventually(func() error {
+			var err error
+			res, err = http.Post(url, "application/json", strings.NewReader(body)) //nolint:noctx
+			return err
+		}, timeout, interval).Should(Succeed())
+		defer res.Body.Close() //nolint:errcheck
+		Expect(d.Ready()).To(BeFalse())
+		Expect(res.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		retryAfter, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryAfter).To(BeNumerically(">=", 1))
+
+		Eventually(d.Ready, timeout, interval).Should(BeTrue())
+
+		dc, err := dynamic.NewForConfig(&rest.Config{Host: fmt.Sprintf("http://localhost:%d", port)})
+		Expect(err).NotTo(HaveOccurred())
+		reg := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(body), &reg.Object)).To(Succeed())
+		_, err = dc.Resource(schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}).Namespace("user-1").Create(ctx, reg, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,278 @@
+package dctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+)
+
+// StateSnapshot is a snapshot of the registration state of the control plane: the AMF:RegState
+// objects and the entries of the aggregate tables.
+type StateSnapshot struct {
+	// Time is the time the snapshot was taken at.
+	Time time.Time `json:"time"`
+	// RegStates are the AMF:RegState objects, with the metadata reduced to the name, the
+	// namespace, the labels and the annotations.
+	RegStates []map[string]any `json:"regStates,omitempty"`
+	// ActiveRegistrations are the entries of the AMF:ActiveRegistrationTable.
+	ActiveRegistrations []any `json:"activeRegistrations,omitempty"`
+	// ActiveSessions are the entries of the SMF:ActiveSessionTable.
+	ActiveSessions []any `json:"activeSessions,omitempty"`
+}
+
+// StateStore persists the registration state across restarts. The store may be backed by an
+// external database, so each operation may fail.
+type StateStore interface {
+	// Save replaces the stored state with a snapshot.
+	Save(ctx context.Context, s *StateSnapshot) error
+	// Load returns the last saved snapshot, or nil if none has been saved.
+	Load(ctx context.Context) (*StateSnapshot, error)
+	// Delete removes the stored state, if any.
+	Delete(ctx context.Context) error
+}
+
+// memoryStateStore is the default state store, which keeps the last snapshot in memory only, so
+// that the state does not survive a restart of the process.
+type memoryStateStore struct {
+	mu       sync.Mutex
+	snapshot []byte
+}
+
+// NewMemoryStateStore returns an empty in-memory state store.
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{}
+}
+
+func (s *memoryStateStore) Save(_ context.Context, snapshot *StateSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = data
+	return nil
+}
+
+func (s *memoryStateStore) Load(_ context.Context) (*StateSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot == nil {
+		return nil, nil
+	}
+	snapshot := &StateSnapshot{}
+	if err := json.Unmarshal(s.snapshot, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (s *memoryStateStore) Delete(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = nil
+	return nil
+}
+
+// fileStateStore keeps the last snapshot in a JSON file.
+type fileStateStore struct {
+	mu   sync.Mutex
+	file string
+}
+
+// NewFileStateStore returns a state store that writes the snapshots into a JSON file. The file is
+// replaced through a temporary file so that a crash does not leave a partial snapshot behind.
+func NewFileStateStore(file string) StateStore {
+	return &fileStateStore{file: file}
+}
+
+func (s *fileStateStore) Save(_ context.Context, snapshot *StateSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to save state snapshot %q: %w", s.file, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+		return fmt.Errorf("failed to save state snapshot %q: %w", s.file, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save state snapshot %q: %w", s.file, err)
+	}
+	if err := os.Rename(tmp.Name(), s.file); err != nil {
+		return fmt.Errorf("failed to save state snapshot %q: %w", s.file, err)
+	}
+	return nil
+}
+
+func (s *fileStateStore) Load(_ context.Context) (*StateSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state snapshot %q: %w", s.file, err)
+	}
+	snapshot := &StateSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse state snapshot %q: %w", s.file, err)
+	}
+	return snapshot, nil
+}
+
+func (s *fileStateStore) Delete(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete state snapshot %q: %w", s.file, err)
+	}
+	return nil
+}
+
+// stateSnapshotter saves the registration state into the state store, periodically if an
+// interval is set and once the operators have stopped, and restores it on startup.
+type stateSnapshotter struct {
+	client   client.Client
+	store    StateStore
+	interval time.Duration
+	log      logr.Logger
+}
+
+func newStateSnapshotter(c client.Client, store StateStore, interval time.Duration, logger logr.Logger) *stateSnapshotter {
+	return &stateSnapshotter{client: c, store: store, interval: interval, log: logger.WithName("state-snapshot")}
+}
+
+// Start runs the snapshot loop until the context is cancelled.
+func (s *stateSnapshotter) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.snapshot(ctx); err != nil {
+				s.log.Error(err, "failed to snapshot the registration state")
+			}
+		}
+	}
+}
+
+// snapshot saves the current registration state. Nothing is saved if the state cannot be read,
+// so that the last good snapshot is kept.
+func (s *stateSnapshotter) snapshot(ctx context.Context) error {
+	list := cache.NewViewObjectList("amf", "RegState")
+	if err := s.client.List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list amf/RegState: %w", err)
+	}
+
+	snapshot := &StateSnapshot{Time: time.Now().UTC()}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		state := map[string]any{
+			"metadata": map[string]any{"name": obj.GetName(), "namespace": obj.GetNamespace()},
+		}
+		if labels := obj.GetLabels(); len(labels) > 0 {
+			state["metadata"].(map[string]any)["labels"] = labels
+		}
+		if annotations := obj.GetAnnotations(); len(annotations) > 0 {
+			state["metadata"].(map[string]any)["annotations"] = annotations
+		}
+		for _, field := range []string{"spec", "status"} {
+			if v, ok := obj.UnstructuredContent()[field]; ok {
+				state[field] = v
+			}
+		}
+		snapshot.RegStates = append(snapshot.RegStates, state)
+	}
+
+	for _, t := range aggregateTables {
+		table := object.NewViewObject(t.operator, t.kind)
+		object.SetName(table, "", t.name)
+		if err := s.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get %s/%s: %w", t.operator, t.kind, err)
+		}
+		entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+		switch t.kind {
+		case "ActiveRegistrationTable":
+			snapshot.ActiveRegistrations = entries
+		case "ActiveSessionTable":
+			snapshot.ActiveSessions = entries
+		}
+	}
+
+	if err := s.store.Save(ctx, snapshot); err != nil {
+		return err
+	}
+	s.log.V(1).Info("registration state saved", "registrations", len(snapshot.RegStates))
+	return nil
+}
+
+// restore loads the last snapshot into the shared cache. The objects already in the cache, e.g.,
+// those created by the init pipelines, are left intact.
+func (s *stateSnapshotter) restore(ctx context.Context) error {
+	snapshot, err := s.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	for _, state := range snapshot.RegStates {
+		obj := object.NewViewObject("amf", "RegState")
+		for k, v := range state {
+			obj.UnstructuredContent()[k] = v
+		}
+		if err := s.client.Create(ctx, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to restore amf/RegState %s/%s: %w", obj.GetNamespace(),
+				obj.GetName(), err)
+		}
+	}
+
+	for _, t := range aggregateTables {
+		entries := snapshot.ActiveRegistrations
+		if t.kind == "ActiveSessionTable" {
+			entries = snapshot.ActiveSessions
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		table := object.NewViewObject(t.operator, t.kind)
+		object.SetName(table, "", t.name)
+		table.UnstructuredContent()["spec"] = entries
+		if err := s.client.Create(ctx, table); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to restore %s/%s: %w", t.operator, t.kind, err)
+		}
+	}
+
+	s.log.Info("registration state restored", "registrations", len(snapshot.RegStates),
+		"snapshot-time", snapshot.Time)
+	return nil
+}
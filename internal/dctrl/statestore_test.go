@@ -0,0 +1,118 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("State store", func() {
+	// registrations returns a poller for the names of the entries of the ActiveRegistrationTable
+	registrations := func(ctx context.Context, c client.Client) func() []string {
+		return func() []string {
+			table := object.NewViewObject("amf", "ActiveRegistrationTable")
+			object.SetName(table, "", "active-registrations")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+				return nil
+			}
+			names := []string{}
+			specs, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+			for _, s := range specs {
+				if e, ok := s.(map[string]any); ok {
+					names = append(names, fmt.Sprint(e["name"]))
+				}
+			}
+			return names
+		}
+	}
+
+	It("should restore the registrations after a restart", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "state.json")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:    opSpecs,
+			StateStore: dctrl.NewFileStateStore(file),
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		for _, name := range []string{"user-1", "user-2"} {
+			reg := object.New()
+			Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name)), &reg)).To(Succeed())
+			Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+		}
+		Eventually(registrations(ctx, c), timeout, interval).Should(ConsistOf("user-1", "user-2"))
+
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 2*timeout)
+		defer stopCancel()
+		Expect(d.Stop(stopCtx)).To(Succeed())
+		cancel()
+
+		snapshot, err := dctrl.NewFileStateStore(file).Load(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot).NotTo(BeNil())
+		Expect(snapshot.ActiveRegistrations).To(HaveLen(2))
+
+		// a fresh instance with an empty cache
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		d, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:    opSpecs,
+			StateStore: dctrl.NewFileStateStore(file),
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+
+		Eventually(registrations(ctx, c), timeout, interval).Should(ConsistOf("user-1", "user-2"))
+	})
+
+	It("should keep the snapshots of the memory store until deleted", func() {
+		ctx := context.Background()
+		store := dctrl.NewMemoryStateStore()
+
+		snapshot, err := store.Load(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot).To(BeNil())
+
+		Expect(store.Save(ctx, &dctrl.StateSnapshot{
+			ActiveRegistrations: []any{map[string]any{"name": "user-1", "namespace": "user-1"}},
+		})).To(Succeed())
+		snapshot, err = store.Load(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.ActiveRegistrations).To(HaveLen(1))
+
+		Expect(store.Delete(ctx)).To(Succeed())
+		snapshot, err = store.Load(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot).To(BeNil())
+	})
+})
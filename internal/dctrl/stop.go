@@ -0,0 +1,194 @@
+package dctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/operator"
+	"github.com/l7mp/dcontroller/pkg/pipeline"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// ErrNotStarted is returned by Stop if the Dctrl has not been started.
+var ErrNotStarted = errors.New("dctrl not started")
+
+// drainPollInterval is the interval the work queues are checked at during a drain.
+const drainPollInterval = 20 * time.Millisecond
+
+// runState is the state of a running Dctrl.
+type runState struct {
+	// ctx is the context the operators are started with.
+	ctx context.Context
+	// cancel stops the operators and then the shared cache.
+	cancel context.CancelFunc
+	// stopAPIServer stops the embedded API server.
+	stopAPIServer context.CancelFunc
+	// done is closed when Start has returned.
+	done chan struct{}
+	// operators are the operators started so far, in the startup order.
+	operators []string
+	// running are the running instances of the operators, by name.
+	running map[string]*runningOperator
+	// stopping is set once the operators are being shut down.
+	stopping bool
+	// serviceAddr and healthProbeAddr are the addresses the auxiliary servers are bound to.
+	serviceAddr, healthProbeAddr string
+}
+
+// runningOperator is a running instance of an operator.
+type runningOperator struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	synced atomic.Bool // the manager cache has synced
+	err    error
+}
+
+// registerOperator records an operator started by Start or restarted by ReloadOperator.
+func (d *Dctrl) registerOperator(name string, r *runningOperator) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.run == nil {
+		return
+	}
+	if _, ok := d.run.running[name]; !ok {
+		d.run.operators = append(d.run.operators, name)
+	}
+	d.run.running[name] = r
+}
+
+// Stop gracefully stops a started Dctrl: it stops the API server so that no new requests are
+// accepted, waits until the work queues of the operators are empty, and then stops the operators
+// and the shared cache, as if the context passed to Start had been cancelled. If the context
+// expires before the work queues drain, the shutdown proceeds anyway and the context error is
+// returned. Stop returns ErrNotStarted if called before Start.
+func (d *Dctrl) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	run := d.run
+	var operators []string
+	if run != nil {
+		operators = append(operators, run.operators...)
+	}
+	d.mu.Unlock()
+	if run == nil {
+		return ErrNotStarted
+	}
+
+	d.log.V(1).Info("stopping the API server")
+	run.stopAPIServer()
+
+	d.log.V(1).Info("draining the operators", "operators", operators)
+	drainErr := d.waitForDrain(ctx)
+	if drainErr != nil {
+		d.log.Info("the work queues did not drain, stopping anyway", "error", drainErr.Error())
+	}
+
+	run.cancel()
+	select {
+	case <-run.done:
+	case <-ctx.Done():
+		return errors.Join(drainErr, fmt.Errorf("shutdown not finished: %w", ctx.Err()))
+	}
+
+	return drainErr
+}
+
+// operatorWorks are the works of the operators of a Dctrl tracked for the drains, by operator.
+type operatorWorks struct {
+	mu    sync.Mutex
+	works map[*operator.Operator]*metrics.Work
+}
+
+func newOperatorWorks() *operatorWorks {
+	return &operatorWorks{works: map[*operator.Operator]*metrics.Work{}}
+}
+
+// add records the work of an operator.
+func (w *operatorWorks) add(op *operator.Operator, work *metrics.Work) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.works[op] = work
+}
+
+// get returns the work of an operator, nil if not tracked.
+func (w *operatorWorks) get(op *operator.Operator) *metrics.Work {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.works[op]
+}
+
+// forget drops the work of a stopped operator.
+func (w *operatorWorks) forget(op *operator.Operator) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.works, op)
+}
+
+// trackedOperator is an operator being built along with the tracker of the work of its
+// controllers.
+type trackedOperator struct {
+	*operator.Operator
+	work *metrics.Work
+}
+
+// trackedPipeline tracks the pipeline evaluations of a declarative controller in progress.
+type trackedPipeline struct {
+	pipeline.Evaluator
+	work *metrics.Work
+}
+
+func (p *trackedPipeline) Evaluate(delta object.Delta) ([]object.Delta, error) {
+	p.work.Begin()
+	defer p.work.End()
+	return p.Evaluator.Evaluate(delta)
+}
+
+// waitForDrain waits until the controllers of the given operators, all operators if none given,
+// have no queued or in-flight requests.
+func (d *Dctrl) waitForDrain(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		names = d.order
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending := d.pendingRequests(names)
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("work queues not drained (%d requests pending): %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingRequests returns the number of requests queued or being reconciled by the controllers of
+// the given operators of this instance: the requests queued for the declarative controllers, and
+// the requests queued for and being processed by the native controllers and the pipelines as
+// tracked by the work of the operators.
+func (d *Dctrl) pendingRequests(names []string) int {
+	pending := 0
+	for _, n := range names {
+		op := d.GetOperator(n)
+		if op == nil {
+			continue
+		}
+		for _, c := range op.ListControllers() {
+			if c == nil {
+				continue
+			}
+			pending += len(c.GetWatcher())
+		}
+		pending += d.works.get(op).Pending()
+	}
+	return pending
+}
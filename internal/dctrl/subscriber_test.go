@@ -0,0 +1,160 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("Subscriber provisioning", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+		store  udm.SubscriberStore
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		store = udm.NewMemorySubscriberStore()
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:                opSpecs,
+			SubscriberProvisioning: true,
+			SubscriberStore:        store,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	register := func(name string) {
+		reg := object.New()
+		Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`, name)), &reg)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, reg)).To(Succeed())
+	}
+
+	// condition returns a poller for the status and the reason of a condition of a registration
+	condition := func(name, condType string) func() []string {
+		return func() []string {
+			reg := object.NewViewObject("amf", "Registration")
+			object.SetName(reg, name, name)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return nil
+			}
+			conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			for _, c := range conds {
+				if cond, ok := c.(map[string]any); ok && cond["type"] == condType {
+					return []string{fmt.Sprint(cond["status"]), fmt.Sprint(cond["reason"])}
+				}
+			}
+			return nil
+		}
+	}
+
+	// authenticated returns a poller for the status and the reason of the Authenticated condition
+	// of a registration
+	authenticated := func(name string) func() []string {
+		return condition(name, "Authenticated")
+	}
+
+	subscriber := func() object.Object {
+		sub := object.NewViewObject("udm", "Subscriber")
+		object.SetName(sub, "default", "imsi-999010000000123")
+		return sub
+	}
+
+	It("should register a provisioned subscriber only", func() {
+		sub := subscriber()
+		Expect(unstructured.SetNestedMap(sub.UnstructuredContent(), map[string]any{
+			"supi":              "imsi-999010000000123",
+			"keyRef":            "imsi-999010000000123",
+			"allowedNSSAI":      []any{"eMBB"},
+			"defaultQosProfile": "default",
+		}, "spec")).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, sub)).To(Succeed())
+
+		Eventually(func() string {
+			obj := subscriber()
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return ""
+			}
+			conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			if len(conds) == 0 {
+				return ""
+			}
+			return fmt.Sprint(conds[0].(map[string]any)["reason"])
+		}, timeout, interval).Should(Equal("Provisioned"))
+		rec, err := store.Get(ctx, "imsi-999010000000123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.AllowedNSSAI).To(Equal([]string{"eMBB"}))
+
+		register("user-1")
+		Eventually(authenticated("user-1"), timeout, interval).Should(
+			Equal([]string{"True", "AuthenticationSuccess"}))
+
+		// deprovision the subscriber
+		Expect(c.Delete(ctx, subscriber())).To(Succeed())
+		Eventually(func() error {
+			_, err := store.Get(ctx, "imsi-999010000000123")
+			return err
+		}, timeout, interval).Should(MatchError(udm.ErrSubscriberNotFound))
+
+		register("user-2")
+		Eventually(authenticated("user-2"), timeout, interval).Should(
+			Equal([]string{"False", "SupiNotFound"}))
+	})
+
+	It("should not register a subscriber to none of the requested slices", func() {
+		sub := subscriber()
+		Expect(unstructured.SetNestedMap(sub.UnstructuredContent(), map[string]any{
+			"supi":         "imsi-999010000000123",
+			"allowedNSSAI": []any{"URLLC"},
+		}, "spec")).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, sub)).To(Succeed())
+		Eventually(func() error {
+			_, err := store.Get(ctx, "imsi-999010000000123")
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		// the eMBB slice is served by the AMF but not subscribed to
+		register("user-1")
+		Eventually(condition("user-1", "SubscriptionInfoRetrieved"), timeout, interval).Should(
+			Equal([]string{"False", "NoAllowedNSSAI"}))
+	})
+
+	It("should not register an unprovisioned subscriber", func() {
+		register("user-1")
+		Eventually(authenticated("user-1"), timeout, interval).Should(
+			Equal([]string{"False", "SupiNotFound"}))
+	})
+})
@@ -0,0 +1,355 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/netip"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/upf"
+)
+
+// DefaultUPFTunnelAddress is the default N3 address of the UPF the GTP-U tunnels of the sessions
+// terminate at.
+const DefaultUPFTunnelAddress = "10.100.200.1"
+
+// parseUPFTunnelAddresses parses the N3 addresses of the UPF.
+func parseUPFTunnelAddresses(addrs []string) ([]netip.Addr, error) {
+	if len(addrs) == 0 {
+		addrs = []string{DefaultUPFTunnelAddress}
+	}
+	ret := make([]netip.Addr, 0, len(addrs))
+	for _, a := range addrs {
+		addr, err := netip.ParseAddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UPF tunnel address %q: %w", a, err)
+		}
+		ret = append(ret, addr)
+	}
+	return ret, nil
+}
+
+// sessionTunnel is the GTP-U tunnel of a session: the TEIDs of the uplink and the downlink and
+// the N3 address of the UPF the tunnel terminates at.
+type sessionTunnel struct {
+	uplink, downlink uint32
+	address          netip.Addr
+}
+
+func (t sessionTunnel) spec() map[string]any {
+	return map[string]any{
+		"uplinkTeid":   int64(t.uplink),
+		"downlinkTeid": int64(t.downlink),
+		"n3Address":    t.address.String(),
+	}
+}
+
+// teidAllocator allocates the GTP-U tunnels of the active sessions: a TEID for the uplink and one
+// for the downlink, unique across the sessions, and an N3 address of the UPF, the one serving the
+// fewest sessions. The tunnel is set in status.tunnel of the session context, from where the
+// upf-notifier copies it into the upf/Config of the session, and released when the session
+// context is deleted or idled. The allocations are published in the upf/TunnelTable view:
+//
+//	spec:
+//	  tunnels:
+//	    - name: user-1
+//	      namespace: user-1
+//	      uplinkTeid: 1
+//	      downlinkTeid: 2
+//	      n3Address: 10.100.200.1
+//
+// The lowest free TEIDs are allocated, so the TEIDs of a released tunnel are reused first. A
+// session whose status carries a tunnel not allocated to it, e.g., after a restart, keeps the
+// tunnel if its TEIDs are free, and gets a new one otherwise.
+type teidAllocator struct {
+	client    client.Client
+	addresses []netip.Addr
+	mu        sync.Mutex
+	owner     map[uint32]client.ObjectKey
+	tunnels   map[client.ObjectKey]sessionTunnel
+	dirty     bool // the allocations have not been written yet
+	log       logr.Logger
+}
+
+// teidAllocatorOptions configures the allocator of the GTP-U tunnels of the sessions.
+type teidAllocatorOptions struct {
+	Client client.Client
+	// Addresses are the N3 addresses of the UPF the tunnels are spread over
+	Addresses []netip.Addr
+	Logger    logr.Logger
+}
+
+// teidAllocatorHooks creates the allocator of the GTP-U tunnels of the sessions and returns the
+// hook adding it to the SMF.
+func teidAllocatorHooks(o teidAllocatorOptions) []operatorHook {
+	a := newTeidAllocator(o.Client, o.Addresses, o.Logger)
+	return []operatorHook{{
+		view: smfView,
+		what: "create the TEID allocator",
+		add:  func(op *trackedOperator, _ string) error { return a.addController(op) },
+	}}
+}
+
+func newTeidAllocator(c client.Client, addresses []netip.Addr, logger logr.Logger) *teidAllocator {
+	return &teidAllocator{
+		client:    c,
+		addresses: addresses,
+		owner:     map[uint32]client.ObjectKey{},
+		tunnels:   map[client.ObjectKey]sessionTunnel{},
+		log:       logger.WithName("teid-allocator"),
+	}
+}
+
+// addController adds the allocator to the SMF operator, which owns the session contexts.
+func (a *teidAllocator) addController(op *trackedOperator) error {
+	return addWatchController(op, "smf", "teid-allocator", "SessionContext", a)
+}
+
+func (a *teidAllocator) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, a.release(ctx, key)
+	}
+
+	obj := object.NewViewObject("smf", "SessionContext")
+	if err := a.client.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, a.release(ctx, key)
+		}
+		return reconcile.Result{}, err
+	}
+
+	// only the sessions with a data path hold a tunnel
+	current, hasTunnel, _ := unstructured.NestedMap(obj.UnstructuredContent(), "status", "tunnel")
+	configured, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "status", "conditions", "upf", "status")
+	idle, _, _ := unstructured.NestedBool(obj.UnstructuredContent(), "spec", "idle")
+	if configured != "True" || idle {
+		if err := a.release(ctx, key); err != nil {
+			return reconcile.Result{}, err
+		}
+		if !hasTunnel {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, a.setTunnel(ctx, key, nil)
+	}
+
+	t, err := a.allocate(ctx, key, current)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	spec := t.spec()
+	if reflect.DeepEqual(current, spec) {
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{}, a.setTunnel(ctx, key, spec)
+}
+
+// allocate returns the tunnel of a session, allocating one if the session has none. The tunnel
+// in the status of the session is taken over if its TEIDs are free.
+func (a *teidAllocator) allocate(ctx context.Context, key client.ObjectKey, current map[string]any) (sessionTunnel, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if t, ok := a.tunnels[key]; ok {
+		return t, a.flush(ctx)
+	}
+
+	t, ok := a.adopt(current)
+	if !ok {
+		uplink, err := a.nextFree(0)
+		if err != nil {
+			return sessionTunnel{}, err
+		}
+		downlink, err := a.nextFree(uplink)
+		if err != nil {
+			return sessionTunnel{}, err
+		}
+		t = sessionTunnel{uplink: uplink, downlink: downlink, address: a.leastLoaded()}
+	}
+
+	a.owner[t.uplink] = key
+	a.owner[t.downlink] = key
+	a.tunnels[key] = t
+	a.dirty = true
+	a.log.V(1).Info("tunnel allocated", "session", key.String(), "uplink-teid", t.uplink,
+		"downlink-teid", t.downlink, "n3-address", t.address.String())
+
+	return t, a.flush(ctx)
+}
+
+// adopt returns the tunnel in the status of a session, if it is valid and its TEIDs are free.
+// Called with the lock held.
+func (a *teidAllocator) adopt(current map[string]any) (sessionTunnel, bool) {
+	if current == nil {
+		return sessionTunnel{}, false
+	}
+	uplink, _, _ := unstructured.NestedInt64(current, "uplinkTeid")
+	downlink, _, _ := unstructured.NestedInt64(current, "downlinkTeid")
+	address, _, _ := unstructured.NestedString(current, "n3Address")
+	addr, err := netip.ParseAddr(address)
+	if err != nil || !a.served(addr) {
+		return sessionTunnel{}, false
+	}
+	for _, teid := range []int64{uplink, downlink} {
+		if teid <= 0 || teid > math.MaxUint32 {
+			return sessionTunnel{}, false
+		}
+		if _, taken := a.owner[uint32(teid)]; taken {
+			return sessionTunnel{}, false
+		}
+	}
+	if uplink == downlink {
+		return sessionTunnel{}, false
+	}
+	return sessionTunnel{uplink: uint32(uplink), downlink: uint32(downlink), address: addr}, true
+}
+
+// release frees the tunnel of a session.
+func (a *teidAllocator) release(ctx context.Context, key client.ObjectKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t, ok := a.tunnels[key]
+	if !ok {
+		return a.flush(ctx)
+	}
+	delete(a.tunnels, key)
+	delete(a.owner, t.uplink)
+	delete(a.owner, t.downlink)
+	a.dirty = true
+	a.log.V(1).Info("tunnel released", "session", key.String(), "uplink-teid", t.uplink,
+		"downlink-teid", t.downlink)
+
+	return a.flush(ctx)
+}
+
+// nextFree returns the lowest free TEID other than the given one. TEID 0 is reserved. Called with
+// the lock held.
+func (a *teidAllocator) nextFree(except uint32) (uint32, error) {
+	for teid := uint32(1); teid != 0; teid++ {
+		if _, ok := a.owner[teid]; !ok && teid != except {
+			return teid, nil
+		}
+	}
+	return 0, fmt.Errorf("TEID space exhausted")
+}
+
+// leastLoaded returns the N3 address serving the fewest tunnels, the first one on a tie. Called
+// with the lock held.
+func (a *teidAllocator) leastLoaded() netip.Addr {
+	load := map[netip.Addr]int{}
+	for _, t := range a.tunnels {
+		load[t.address]++
+	}
+	best := a.addresses[0]
+	for _, addr := range a.addresses[1:] {
+		if load[addr] < load[best] {
+			best = addr
+		}
+	}
+	return best
+}
+
+// served returns whether the UPF serves an N3 address. Called with the lock held.
+func (a *teidAllocator) served(addr netip.Addr) bool {
+	for _, served := range a.addresses {
+		if served == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// flush writes the upf/TunnelTable view if the allocations changed since the last write,
+// re-reading the table on a resourceVersion conflict. Called with the lock held; a failed write is
+// retried on the next reconcile.
+func (a *teidAllocator) flush(ctx context.Context) error {
+	if !a.dirty {
+		return nil
+	}
+
+	keys := make([]client.ObjectKey, 0, len(a.tunnels))
+	for k := range a.tunnels {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	entries := make([]any, 0, len(keys))
+	for _, k := range keys {
+		entry := a.tunnels[k].spec()
+		entry["name"] = k.Name
+		entry["namespace"] = k.Namespace
+		entries = append(entries, entry)
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject(upf.OperatorName, "TunnelTable")
+		object.SetName(table, "", "tunnels")
+		exists := true
+		if err := a.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get upf/TunnelTable: %w", err)
+			}
+			exists = false
+		}
+		table.UnstructuredContent()["spec"] = map[string]any{"tunnels": entries}
+		if exists {
+			if err := a.client.Update(ctx, table); err != nil {
+				return fmt.Errorf("failed to update upf/TunnelTable: %w", err)
+			}
+		} else if err := a.client.Create(ctx, table); err != nil {
+			return fmt.Errorf("failed to create upf/TunnelTable: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+// setTunnel sets the tunnel in the status of a session context, or removes it if nil.
+func (a *teidAllocator) setTunnel(ctx context.Context, key client.ObjectKey, spec map[string]any) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject("smf", "SessionContext")
+		if err := a.client.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		current, ok, _ := unstructured.NestedMap(obj.UnstructuredContent(), "status", "tunnel")
+		if spec == nil {
+			if !ok {
+				return nil
+			}
+			unstructured.RemoveNestedField(obj.UnstructuredContent(), "status", "tunnel")
+		} else {
+			if reflect.DeepEqual(current, spec) {
+				return nil
+			}
+			if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "status", "tunnel"); err != nil {
+				return err
+			}
+		}
+		return a.client.Update(ctx, obj)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update session context %s: %w", key, err)
+	}
+	return nil
+}
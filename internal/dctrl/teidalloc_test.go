@@ -0,0 +1,193 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("GTP-U tunnel allocator", func() {
+	var n3Addresses = []string{"10.100.200.1", "10.100.200.2"}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:            opSpecs,
+			UPFTunnelAddresses: n3Addresses,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// configTunnels returns a poller for the tunnels in the spec of the UPF configs, keyed by the
+	// name of the config
+	configTunnels := func() func() map[string]any {
+		return func() map[string]any {
+			list := cache.NewViewObjectList("upf", "Config")
+			if err := c.List(ctx, list); err != nil {
+				return nil
+			}
+			ret := map[string]any{}
+			for _, s := range list.Items {
+				if t, ok, _ := unstructured.NestedMap(s.UnstructuredContent(), "spec", "tunnel"); ok {
+					ret[s.GetName()] = t
+				}
+			}
+			return ret
+		}
+	}
+
+	// allocations returns a poller for the allocations in the TunnelTable, keyed by the name of
+	// the session context
+	allocations := func() func() map[string]any {
+		return func() map[string]any {
+			table := object.NewViewObject("upf", "TunnelTable")
+			object.SetName(table, "", "tunnels")
+			if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+				return nil
+			}
+			entries, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "tunnels")
+			ret := map[string]any{}
+			for _, e := range entries {
+				if m, ok := e.(map[string]any); ok {
+					ret[fmt.Sprint(m["name"])] = map[string]any{
+						"uplinkTeid":   m["uplinkTeid"],
+						"downlinkTeid": m["downlinkTeid"],
+						"n3Address":    m["n3Address"],
+					}
+				}
+			}
+			return ret
+		}
+	}
+
+	// expectUniqueTeids waits until the UPF configs of the n sessions hold the tunnels allocated
+	// to them and checks that the TEIDs are unique, returning the sessions keyed by the TEIDs
+	expectUniqueTeids := func(n int) map[int64]string {
+		GinkgoHelper()
+		var tunnels map[string]any
+		Eventually(func() bool {
+			tunnels = allocations()()
+			return len(tunnels) == n && reflect.DeepEqual(tunnels, configTunnels()())
+		}, timeout, interval).Should(BeTrue())
+
+		teids := map[int64]string{}
+		for name, t := range tunnels {
+			tunnel := t.(map[string]any)
+			for _, k := range []string{"uplinkTeid", "downlinkTeid"} {
+				teid, ok := tunnel[k].(int64)
+				Expect(ok).To(BeTrue(), "invalid TEID of %s: %v", name, tunnel[k])
+				Expect(teid).To(BeNumerically(">", 0))
+				Expect(teids).NotTo(HaveKey(teid), "TEID %d allocated twice", teid)
+				teids[teid] = name
+			}
+			Expect(n3Addresses).To(ContainElement(tunnel["n3Address"]))
+		}
+		return teids
+	}
+
+	It("should allocate unique TEIDs and reuse the freed ones", func() {
+		const n = 10
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(i))).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+		// the test session holds a tunnel too
+		before := expectUniqueTeids(n + 1)
+
+		// the tunnels are spread over the N3 addresses
+		load := map[any]int{}
+		for _, t := range allocations()() {
+			load[t.(map[string]any)["n3Address"]]++
+		}
+		Expect(load[n3Addresses[0]] - load[n3Addresses[1]]).To(BeNumerically("~", 0, 1))
+
+		// delete some sessions
+		freed := map[int64]bool{}
+		for teid, name := range before {
+			if name == "user-0" || name == "user-1" {
+				freed[teid] = true
+			}
+		}
+		Expect(freed).To(HaveLen(4))
+		for i := 0; i < 2; i++ {
+			Expect(c.Delete(ctx, newSessionContext(i))).To(Succeed())
+		}
+		Eventually(allocations(), timeout, interval).Should(
+			And(Not(HaveKey("user-0")), Not(HaveKey("user-1"))))
+		expectUniqueTeids(n - 1)
+
+		// the new sessions get the freed TEIDs
+		for i := n; i < n+2; i++ {
+			Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(i))).To(Succeed())
+		}
+		after := expectUniqueTeids(n + 1)
+		for teid := range freed {
+			Expect(after).To(HaveKey(teid))
+			Expect(after[teid]).To(BeElementOf(fmt.Sprintf("user-%d", n), fmt.Sprintf("user-%d", n+1)))
+		}
+	})
+
+	It("should release the tunnel of an idled session", func() {
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(0))).To(Succeed())
+		expectUniqueTeids(2)
+
+		obj := object.NewViewObject("smf", "SessionContext")
+		object.SetName(obj, "user-0", "user-0")
+		Eventually(func() error {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+			if err := unstructured.SetNestedField(obj.UnstructuredContent(), true, "spec", "idle"); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj)
+		}, timeout, interval).Should(Succeed())
+
+		Eventually(allocations(), timeout, interval).ShouldNot(HaveKey("user-0"))
+		Eventually(func() bool {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return false
+			}
+			_, ok, _ := unstructured.NestedMap(obj.UnstructuredContent(), "status", "tunnel")
+			return ok
+		}, timeout, interval).Should(BeFalse())
+	})
+
+	It("should reject an invalid N3 address", func() {
+		_, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:            opSpecs,
+			UPFTunnelAddresses: []string{"not-an-address"},
+		}, loglevel)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,162 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// registrationTimer marks the registrations that have not reached Ready within the deadline
+// with Ready=False/RegistrationTimeout, e.g., when a downstream operator is stuck. A late
+// result from the pipeline still overwrites the timeout.
+type registrationTimer struct {
+	client  client.Client
+	timeout time.Duration
+	// firstSeen is the time the pending registrations with no creation timestamp, which the view
+	// cache does not set, were first listed at. Rebuilt on each check, so it holds the
+	// registrations pending at the last check only.
+	firstSeen map[string]time.Time
+	log       logr.Logger
+}
+
+func newRegistrationTimer(c client.Client, timeout time.Duration, logger logr.Logger) *registrationTimer {
+	return &registrationTimer{
+		client:    c,
+		timeout:   timeout,
+		firstSeen: map[string]time.Time{},
+		log:       logger.WithName("registration-timer"),
+	}
+}
+
+// Start runs the timeout checks until the context is cancelled.
+func (t *registrationTimer) Start(ctx context.Context) {
+	ticker := time.NewTicker(max(t.timeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.check(ctx); err != nil {
+				t.log.Error(err, "failed to check registration timeouts")
+			}
+		}
+	}
+}
+
+func (t *registrationTimer) check(ctx context.Context) error {
+	list := cache.NewViewObjectList("amf", "Registration")
+	if err := t.client.List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list registrations: %w", err)
+	}
+
+	now := time.Now()
+	seen := map[string]time.Time{}
+	for i := range list.Items {
+		reg := &list.Items[i]
+		key := client.ObjectKeyFromObject(reg).String()
+
+		if !pending(reg) {
+			continue
+		}
+
+		start := reg.GetCreationTimestamp().Time
+		if start.IsZero() {
+			var ok bool
+			if start, ok = t.firstSeen[key]; !ok {
+				start = now
+			}
+			seen[key] = start
+		}
+
+		if now.Sub(start) < t.timeout {
+			continue
+		}
+
+		t.log.Info("registration timed out", "registration", key, "timeout", t.timeout)
+		if err := t.setTimeout(ctx, reg); err != nil {
+			t.log.Error(err, "failed to update registration", "registration", key)
+		}
+	}
+	t.firstSeen = seen
+
+	return nil
+}
+
+// pending returns true if the registration is neither Ready nor failed nor timed out.
+func pending(reg object.Object) bool {
+	conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+	for _, c := range conds {
+		cond, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch {
+		case cond["type"] == "Ready" && (cond["status"] == "True" || cond["reason"] == metrics.ReasonRegistrationTimeout):
+			return false
+		case cond["type"] != "Ready" && cond["status"] == "False":
+			return false
+		}
+	}
+	return true
+}
+
+// setTimeout marks a registration with Ready=False/RegistrationTimeout. On a resourceVersion
+// conflict the registration is re-read and the timeout is set again, unless the registration has
+// completed in the meantime.
+func (t *registrationTimer) setTimeout(ctx context.Context, reg object.Object) error {
+	ready := map[string]any{
+		"type":               "Ready",
+		"status":             "False",
+		"reason":             metrics.ReasonRegistrationTimeout,
+		"message":            fmt.Sprintf("Registration did not complete within %s", t.timeout),
+		"lastTransitionTime": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	key := client.ObjectKeyFromObject(reg)
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := t.client.Get(ctx, key, reg); err != nil {
+				return err
+			}
+			if !pending(reg) {
+				return nil
+			}
+		}
+		first = false
+
+		conds, _, _ := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+		found := false
+		for i, c := range conds {
+			if cond, ok := c.(map[string]any); ok && cond["type"] == "Ready" {
+				conds[i] = ready
+				found = true
+			}
+		}
+		if !found {
+			conds = append([]any{ready}, conds...)
+		}
+
+		if err := unstructured.SetNestedSlice(reg.UnstructuredContent(), conds, "status", "conditions"); err != nil {
+			return err
+		}
+		return t.client.Update(ctx, reg)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
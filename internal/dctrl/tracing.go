@@ -0,0 +1,109 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/tracing"
+)
+
+// tracingClient is the client of the API server that starts the trace of each new Registration
+// and Session and stamps the object with the span context, from where the pipelines carry it to
+// the views derived from the object.
+type tracingClient struct {
+	client.Client
+	tracer trace.Tracer
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	gvk := u.GroupVersionKind()
+	if gvk.Group != "amf.view.dcontroller.io" || (gvk.Kind != "Registration" && gvk.Kind != "Session") {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+
+	ctx, span := c.tracer.Start(ctx, "admit amf/"+gvk.Kind,
+		trace.WithAttributes(tracing.Attributes("amf", gvk.Kind, u)...))
+	defer span.End()
+
+	tracing.Inject(ctx, u)
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// tracingOptions configures the tracing of the UE requests.
+type tracingOptions struct {
+	// TracerProvider, if set, enables the tracing
+	TracerProvider trace.TracerProvider
+}
+
+// withTracing wraps the client of the API server with the client starting the traces of the UE
+// requests. Returns the client as is if the tracing is disabled.
+func withTracing(c client.Client, o tracingOptions) client.Client {
+	if o.TracerProvider == nil {
+		return c
+	}
+	return &tracingClient{Client: c, tracer: tracing.Tracer(o.TracerProvider)}
+}
+
+// tracingHooks returns the hook adding the span recorders to each operator, none if the tracing is
+// disabled.
+func tracingHooks(o tracingOptions) []operatorHook {
+	if o.TracerProvider == nil {
+		return nil
+	}
+	tracer := tracing.Tracer(o.TracerProvider)
+	return []operatorHook{{
+		what: "create the span recorders",
+		add: func(op *trackedOperator, opName string) error {
+			return addSpanRecorders(opName, op, tracer)
+		},
+	}}
+}
+
+// spanRecorder records each change of the views of a declarative operator carrying a span
+// context as a child span of the span of the UE request the view is derived from, with the
+// conditions of the view as set by the pipeline.
+type spanRecorder struct {
+	operator, kind string
+	tracer         trace.Tracer
+}
+
+// addSpanRecorders adds the span recorders to the operator.
+func addSpanRecorders(opName string, op *trackedOperator, tracer trace.Tracer) error {
+	for _, kind := range correlatedKinds[opName] {
+		r := &spanRecorder{operator: opName, kind: kind, tracer: tracer}
+		name := fmt.Sprintf("%s-span-recorder", kind)
+		if err := addWatchController(op, opName, name, kind, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *spanRecorder) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if !tracing.HasSpanContext(req.Object) {
+		return reconcile.Result{}, nil
+	}
+
+	_, span := r.tracer.Start(tracing.Extract(ctx, req.Object), "reconcile "+r.operator+"/"+r.kind,
+		trace.WithAttributes(tracing.Attributes(r.operator, r.kind, req.Object)...))
+	span.AddEvent(fmt.Sprint(req.EventType))
+	span.End()
+
+	return reconcile.Result{}, nil
+}
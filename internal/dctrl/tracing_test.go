@@ -0,0 +1,136 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+	"github.com/hsnlab/dctrl5g/internal/tracing"
+)
+
+var _ = Describe("Registration tracing", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should record the reconciles of a registration as the child spans of its admission", func() {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		DeferCleanup(func() { Expect(tp.Shutdown(context.Background())).To(Succeed()) })
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:        opSpecs,
+			APIServerPort:  dctrl.EphemeralAPIServerPort,
+			TracerProvider: tp,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		dc, err := dynamic.NewForConfig(&rest.Config{Host: fmt.Sprintf("http://localhost:%d", port)})
+		Expect(err).NotTo(HaveOccurred())
+		regs := dc.Resource(schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}).Namespace("user-1")
+
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB`
+		reg := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg.Object)).To(Succeed())
+		Eventually(func() error {
+			_, err := regs.Create(ctx, reg.DeepCopy(), metav1.CreateOptions{})
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		// spanNamed returns a poller for the spans of the given name
+		spanNamed := func(name string) func() []tracetest.SpanStub {
+			return func() []tracetest.SpanStub {
+				ret := []tracetest.SpanStub{}
+				for _, s := range exporter.GetSpans() {
+					if s.Name == name {
+						ret = append(ret, s)
+					}
+				}
+				return ret
+			}
+		}
+		attr := func(s tracetest.SpanStub, key attribute.Key) string {
+			for _, a := range s.Attributes {
+				if a.Key == key {
+					return a.Value.Emit()
+				}
+			}
+			return ""
+		}
+
+		// the root span of the registration is started on admission
+		Eventually(spanNamed("admit amf/Registration"), timeout, interval).Should(HaveLen(1))
+		root := spanNamed("admit amf/Registration")()[0]
+		Expect(root.Parent.IsValid()).To(BeFalse())
+		Expect(attr(root, tracing.SuciKey)).To(Equal("suci-0-999-01-02-4f2a7b9c8d13e7a5c0"))
+
+		childOf := func(s tracetest.SpanStub) bool {
+			return s.SpanContext.TraceID() == root.SpanContext.TraceID() &&
+				s.Parent.SpanID() == root.SpanContext.SpanID()
+		}
+
+		// the AUSF resolves the SUCI in a child span
+		Eventually(func() bool {
+			for _, s := range spanNamed("reconcile ausf/MobileIdentity")() {
+				if childOf(s) && attr(s, tracing.SuciKey) == "suci-0-999-01-02-4f2a7b9c8d13e7a5c0" {
+					return true
+				}
+			}
+			return false
+		}, timeout, interval).Should(BeTrue())
+
+		// the UDM issues the config of the UE in a child span
+		Eventually(func() bool {
+			for _, s := range spanNamed("reconcile udm/Config")() {
+				if childOf(s) && attr(s, tracing.GutiKey) != "" &&
+					attr(s, tracing.ConditionKeyPrefix+"Ready") == "True/Ready" {
+					return true
+				}
+			}
+			return false
+		}, timeout, interval).Should(BeTrue())
+	})
+})
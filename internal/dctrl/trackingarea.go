@@ -0,0 +1,90 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	ueclient "github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+// trackingAreaTableName is the name of the AMF:TrackingAreaTable.
+const trackingAreaTableName = "tracking-areas"
+
+// trackingAreaValidator parses the tracking area of each registration, which the pipelines of the
+// AMF cannot, and lists the registrations with a malformed tracking area in the AMF tracking area
+// table, so that the AMF fails them with Validated=False/InvalidTrackingArea. Whether a
+// well-formed tracking area is served is checked by the AMF itself.
+type trackingAreaValidator struct {
+	client client.Client
+	log    logr.Logger
+}
+
+// addTrackingAreaValidator adds the tracking area validator to the AMF operator.
+func addTrackingAreaValidator(op *trackedOperator, c client.Client, logger logr.Logger) error {
+	r := &trackingAreaValidator{client: c, log: logger.WithName("tracking-area-validator")}
+	return addWatchController(op, "amf", "tracking-area-validator", "Registration", r)
+}
+
+func (r *trackingAreaValidator) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	key := client.ObjectKeyFromObject(req.Object).String()
+
+	invalid := false
+	if req.EventType != object.Deleted {
+		tai, ok, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "trackingArea")
+		if ok {
+			if _, err := ueclient.ParseTrackingArea(tai); err != nil {
+				r.log.V(1).Info("malformed tracking area", "registration", key, "error", err.Error())
+				invalid = true
+			}
+		}
+	}
+
+	if err := r.setInvalid(ctx, key, invalid); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// setInvalid adds a registration to or removes it from the invalid list of the tracking area
+// table.
+func (r *trackingAreaValidator) setInvalid(ctx context.Context, key string, invalid bool) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject("amf", "TrackingAreaTable")
+		object.SetName(table, "", trackingAreaTableName)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		list, _, _ := unstructured.NestedStringSlice(table.UnstructuredContent(), "spec", "invalid")
+		i := slices.Index(list, key)
+		switch {
+		case invalid && i < 0:
+			list = append(list, key)
+		case !invalid && i >= 0:
+			list = slices.Delete(list, i, i+1)
+		default:
+			return nil
+		}
+
+		if err := unstructured.SetNestedStringSlice(table.UnstructuredContent(), list,
+			"spec", "invalid"); err != nil {
+			return err
+		}
+		return r.client.Update(ctx, table)
+	})
+	if err != nil {
+		// the table may not be initialized yet: retry
+		return fmt.Errorf("failed to update the tracking area table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package dctrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/warning"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// UnknownFieldPolicy is the handling of the unknown spec fields of the Registrations and the
+// Sessions on create.
+type UnknownFieldPolicy string
+
+const (
+	// UnknownFieldsDropUnknown removes the unknown fields from the spec.
+	UnknownFieldsDropUnknown UnknownFieldPolicy = "DropUnknown"
+	// UnknownFieldsWarn accepts the unknown fields with a warning to the client (default).
+	UnknownFieldsWarn UnknownFieldPolicy = "Warn"
+	// UnknownFieldsReject rejects the objects with unknown fields as Invalid.
+	UnknownFieldsReject UnknownFieldPolicy = "Reject"
+)
+
+// knownSpecFields lists the top-level spec fields of the AMF resources the operators process.
+var knownSpecFields = map[string][]string{
+	"Registration": {"registrationType", "accessType", "trackingArea", "mobileIdentity",
+		"ueSecurityCapability", "ueStatus", "ueNetworkCapability", "requestedNSSAI"},
+	"Session": {"guti", "idle", "nssai", "sessionId", "pduSessionType", "sscMode",
+		"networkConfiguration", "qos", "sessionAmbr", "dnn"},
+}
+
+func checkUnknownFieldPolicy(p UnknownFieldPolicy) error {
+	switch p {
+	case "", UnknownFieldsDropUnknown, UnknownFieldsWarn, UnknownFieldsReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown field policy %q", p)
+	}
+}
+
+// unknownFieldsClient is the client of the API server that applies the unknown field policy on
+// creates, so that the client errors, e.g., a misspelled field, are caught early.
+type unknownFieldsClient struct {
+	client.Client
+	policy UnknownFieldPolicy
+	log    logr.Logger
+}
+
+func (c *unknownFieldsClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	gvk := u.GroupVersionKind()
+	known, ok := knownSpecFields[gvk.Kind]
+	if gvk.Group != "amf.view.dcontroller.io" || !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+
+	spec, ok, _ := unstructured.NestedMap(u.UnstructuredContent(), "spec")
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	unknown := []string{}
+	for f := range spec {
+		if !slices.Contains(known, f) {
+			unknown = append(unknown, f)
+		}
+	}
+	if len(unknown) == 0 {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	sort.Strings(unknown)
+
+	switch c.policy {
+	case UnknownFieldsReject:
+		errs := field.ErrorList{}
+		for _, f := range unknown {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", f), "unknown field"))
+		}
+		return apierrors.NewInvalid(gvk.GroupKind(), u.GetName(), errs)
+
+	case UnknownFieldsDropUnknown:
+		for _, f := range unknown {
+			unstructured.RemoveNestedField(u.Object, "spec", f)
+		}
+		c.log.V(1).Info("dropped unknown spec fields", "kind", gvk.Kind,
+			"object", client.ObjectKeyFromObject(u), "fields", unknown)
+
+	default:
+		for _, f := range unknown {
+			warning.AddWarning(ctx, "", fmt.Sprintf("unknown field %q", "spec."+f))
+		}
+		c.log.Info("unknown spec fields", "kind", gvk.Kind, "object", client.ObjectKeyFromObject(u),
+			"fields", strings.Join(unknown, ","))
+	}
+
+	return c.Client.Create(ctx, obj, opts...)
+}
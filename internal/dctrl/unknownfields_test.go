@@ -0,0 +1,142 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// warningRecorder collects the warnings returned by the API server.
+type warningRecorder struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (r *warningRecorder) HandleWarningHeader(_ int, _ string, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, text)
+}
+
+func (r *warningRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.warnings...)
+}
+
+var _ = Describe("Unknown field policy", func() {
+	var (
+		ctx      context.Context
+		cancel   context.CancelFunc
+		regs     dynamic.ResourceInterface
+		warnings *warningRecorder
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	start := func(policy dctrl.UnknownFieldPolicy) {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:            opSpecs,
+			APIServerPort:      dctrl.EphemeralAPIServerPort,
+			UnknownFieldPolicy: policy,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		port := d.APIServerPort()
+
+		warnings = &warningRecorder{}
+		dc, err := dynamic.NewForConfig(&rest.Config{
+			Host:           fmt.Sprintf("http://localhost:%d", port),
+			WarningHandler: warnings,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		regs = dc.Resource(schema.GroupVersionResource{
+			Group:    "amf.view.dcontroller.io",
+			Version:  "v1alpha1",
+			Resource: "registration",
+		}).Namespace("user-1")
+	}
+
+	// create submits a registration with a misspelled field once the API server is ready
+	create := func() error {
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: suci-0-999-01-02-4f2a7b9c8d13e7a5c0
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA2"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA2"]
+  requestedNSSAI:
+    - sliceType: eMBB
+  requestedNSSAIs:
+    - sliceType: URLLC`
+		reg := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(yamlData), &reg.Object)).To(Succeed())
+
+		var err error
+		Eventually(func() bool {
+			_, err = regs.Create(ctx, reg, metav1.CreateOptions{})
+			return err == nil || apierrors.IsInvalid(err)
+		}, timeout, interval).Should(BeTrue(), "unexpected error: %v", err)
+		return err
+	}
+
+	// storedSpec returns the spec of the stored registration
+	storedSpec := func() map[string]any {
+		reg, err := regs.Get(ctx, "user-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		spec, _, _ := unstructured.NestedMap(reg.Object, "spec")
+		return spec
+	}
+
+	It("should accept an unknown field with a warning by default", func() {
+		start("")
+		Expect(create()).To(Succeed())
+		Expect(warnings.get()).To(ContainElement(`unknown field "spec.requestedNSSAIs"`))
+		Expect(storedSpec()).To(HaveKey("requestedNSSAIs"))
+	})
+
+	It("should drop an unknown field with DropUnknown", func() {
+		start(dctrl.UnknownFieldsDropUnknown)
+		Expect(create()).To(Succeed())
+		spec := storedSpec()
+		Expect(spec).NotTo(HaveKey("requestedNSSAIs"))
+		Expect(spec).To(HaveKey("requestedNSSAI"))
+	})
+
+	It("should reject an unknown field with Reject", func() {
+		start(dctrl.UnknownFieldsReject)
+		err := create()
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "unexpected error: %v", err)
+		Expect(err.Error()).To(ContainSubstring("spec.requestedNSSAIs"))
+
+		_, err = regs.Get(ctx, "user-1", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
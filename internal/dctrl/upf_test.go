@@ -0,0 +1,114 @@
+package dctrl_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+var _ = Describe("UPF config export", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should export the UPF config with a custom transform", func() {
+		// a made-up target shape: the UE address and the flow names
+		transform := func(spec map[string]any) (map[string]any, error) {
+			ip, _, _ := unstructured.NestedString(spec, "networkConfiguration", "ipConfiguration", "ipAddress")
+			flows, _, _ := unstructured.NestedSlice(spec, "qos", "flows")
+			names := []any{}
+			for _, f := range flows {
+				names = append(names, fmt.Sprint(f.(map[string]any)["name"]))
+			}
+			return map[string]any{"address": ip, "flows": names}, nil
+		}
+
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:            opSpecs,
+			UPFConfigTransform: transform,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		yamlData := `
+apiVersion: upf.view.dcontroller.io/v1alpha1
+kind: Config
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  networkConfiguration:
+    ipConfiguration:
+      ipAddress: 10.45.0.2
+  qos:
+    flows:
+      - name: voice-flow
+        fiveQI: ConversationalVoice
+      - name: best-effort-flow
+        fiveQI: BestEffort`
+		config := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &config)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, c, config)).To(Succeed())
+
+		retrieved := object.NewViewObject("upf", "Config")
+		object.SetName(retrieved, "user-1", "user-1")
+		Eventually(func() map[string]any {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+				return nil
+			}
+			exported, _, _ := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "exported")
+			return exported
+		}, timeout, interval).Should(Equal(map[string]any{
+			"address": "10.45.0.2",
+			"flows":   []any{"voice-flow", "best-effort-flow"},
+		}))
+	})
+
+	It("should not export the UPF config in the native format", func() {
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c := d.GetCache().GetClient()
+
+		Expect(testsuite.CreateWithRetry(ctx, c, newSessionContext(1))).To(Succeed())
+		retrieved := object.NewViewObject("upf", "Config")
+		object.SetName(retrieved, "user-1", "user-1")
+		Eventually(func() error {
+			return c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved)
+		}, timeout, interval).Should(Succeed())
+		Consistently(func() bool {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+				return false
+			}
+			_, ok, _ := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "exported")
+			return ok
+		}, 10*interval, interval).Should(BeFalse())
+	})
+
+	It("should reject an unknown UPF config format", func() {
+		_, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:         opSpecs,
+			UPFConfigFormat: "no-such-upf",
+		}, loglevel)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,51 @@
+package dctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/hsnlab/dctrl5g/internal/operators/chf"
+)
+
+// errUsageAccountingDisabled is returned if the usage accounting is not enabled.
+var errUsageAccountingDisabled = errors.New("usage accounting disabled")
+
+// ReportUsage adds the bytes transferred by a session since the last report to the usage record
+// of the session, e.g., as reported by the UPF.
+func (d *Dctrl) ReportUsage(ctx context.Context, session client.ObjectKey, uplinkBytes, downlinkBytes int64) error {
+	if d.chf == nil {
+		return errUsageAccountingDisabled
+	}
+	return d.chf.ReportUsage(ctx, session, uplinkBytes, downlinkBytes)
+}
+
+// GetUsageRecords returns the usage records of the sessions of a UE, or of all the UEs if the
+// namespace is empty.
+func (d *Dctrl) GetUsageRecords(ctx context.Context, namespace string) ([]chf.UsageRecord, error) {
+	if d.chf == nil {
+		return nil, errUsageAccountingDisabled
+	}
+	return d.chf.UsageRecords(ctx, namespace)
+}
+
+// usageHandler serves the usage records as JSON, those of a UE if the namespace of the UE is
+// given in the path.
+func (d *Dctrl) usageHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := d.GetUsageRecords(r.Context(), r.PathValue("namespace"))
+	if err != nil {
+		if errors.Is(err, errUsageAccountingDisabled) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		d.log.Error(err, "failed to write usage response")
+	}
+}
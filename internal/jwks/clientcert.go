@@ -0,0 +1,40 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
+
+const (
+	// DefaultMinClientKeyBits is the default minimum size of the RSA key of a client certificate.
+	DefaultMinClientKeyBits = 2048
+	// minClientECDSABits is the minimum curve size of the ECDSA key of a client certificate.
+	minClientECDSABits = 256
+)
+
+// CheckClientKey rejects a client certificate with an RSA key shorter than minBits, an ECDSA key
+// on a curve smaller than P-256, or a key of any other algorithm than RSA, ECDSA and Ed25519.
+func CheckClientKey(cert *x509.Certificate, minBits int) error {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < minBits {
+			return fmt.Errorf("RSA key of %d bits is shorter than the minimum of %d bits", bits, minBits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := key.Curve.Params().BitSize; bits < minClientECDSABits {
+			return fmt.Errorf("ECDSA key on a %d-bit curve is weaker than the minimum of %d bits",
+				bits, minClientECDSABits)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported key algorithm %s", cert.PublicKeyAlgorithm)
+	}
+	return nil
+}
+
+// SetMinClientKeyBits makes the authenticator reject the requests of the clients presenting a TLS
+// certificate with a key weaker than the minimum, see CheckClientKey.
+func (a *Authenticator) SetMinClientKeyBits(bits int) { a.minClientKeyBits = bits }
@@ -0,0 +1,72 @@
+package jwks_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+)
+
+var _ = Describe("Client certificate key size", func() {
+	var (
+		signingKey *rsa.PrivateKey
+		a          *jwks.Authenticator
+		token      string
+	)
+
+	BeforeEach(func() {
+		var err error
+		signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		a = jwks.NewAuthenticator(map[string]*rsa.PublicKey{"key": &signingKey.PublicKey})
+		a.SetMinClientKeyBits(jwks.DefaultMinClientKeyBits)
+		token, err = jwks.NewTokenGenerator(signingKey, "key").GenerateToken("user", nil, nil, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// clientCert creates a self-signed client certificate with an RSA key of the given size
+	clientCert := func(bits int) *x509.Certificate {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "user"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		Expect(err).NotTo(HaveOccurred())
+		cert, err := x509.ParseCertificate(der)
+		Expect(err).NotTo(HaveOccurred())
+		return cert
+	}
+
+	authenticate := func(cert *x509.Certificate) error {
+		req, err := http.NewRequest(http.MethodGet, "https://localhost", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		_, _, err = a.AuthenticateRequest(req)
+		return err
+	}
+
+	It("should reject a client certificate with an undersized key", func() {
+		err := authenticate(clientCert(1024))
+		Expect(err).To(MatchError(ContainSubstring("invalid client certificate")))
+		Expect(err).To(MatchError(ContainSubstring("1024 bits")))
+	})
+
+	It("should accept a client certificate with a compliant key", func() {
+		Expect(authenticate(clientCert(2048))).To(Succeed())
+	})
+})
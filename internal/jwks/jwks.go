@@ -0,0 +1,84 @@
+// Package jwks publishes the token-verification keys as a JSON Web Key Set (RFC 7517).
+package jwks
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+)
+
+// Path is the well-known path the key set is served on.
+const Path = "/.well-known/jwks.json"
+
+// JWK is an RSA public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Set is a JSON Web Key Set. During a key rotation it lists both the old and the new keys.
+type Set struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyID returns the default key id of a public key: the RFC 7638 JWK thumbprint.
+func KeyID(key *rsa.PublicKey) string {
+	// members in lexicographic order, no whitespace
+	e, n := encode(key)
+	sum := sha256.Sum256(fmt.Appendf(nil, `{"e":%q,"kty":"RSA","n":%q}`, e, n))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewSet creates a key set from the public keys, keyed by their key ids.
+func NewSet(keys map[string]*rsa.PublicKey) Set {
+	s := Set{Keys: []JWK{}}
+	for kid, key := range keys {
+		e, n := encode(key)
+		s.Keys = append(s.Keys, JWK{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: kid, N: n, E: e})
+	}
+	sort.Slice(s.Keys, func(i, j int) bool { return s.Keys[i].Kid < s.Keys[j].Kid })
+	return s
+}
+
+// PublicKeys returns the public keys in the set, keyed by their key ids.
+func (s Set) PublicKeys() (map[string]*rsa.PublicKey, error) {
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range s.Keys {
+		if k.Kty != "RSA" {
+			return nil, fmt.Errorf("unsupported key type %q for key %q", k.Kty, k.Kid)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// Handler returns an HTTP handler serving the key set.
+func Handler(s Set) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "max-age=300")
+		json.NewEncoder(w).Encode(s) //nolint:errcheck
+	})
+}
+
+func encode(key *rsa.PublicKey) (e, n string) {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+}
@@ -0,0 +1,144 @@
+package jwks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+)
+
+// RevocationList is a set of revoked tokens. A revoked token is kept until it expires, after which
+// it is rejected by the signature check anyway.
+type RevocationList struct {
+	mu     sync.Mutex
+	tokens map[[sha256.Size]byte]time.Time
+	file   string
+}
+
+// NewRevocationList creates an empty revocation list.
+func NewRevocationList() *RevocationList {
+	return &RevocationList{tokens: map[[sha256.Size]byte]time.Time{}}
+}
+
+// revokedToken is the on-disk form of a revoked token.
+type revokedToken struct {
+	Hash   string     `json:"hash"`
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+// NewPersistentRevocationList creates a revocation list persisted in a file, so that the revoked
+// tokens remain revoked across restarts. The revocations in the file, if it exists, are loaded and
+// each revocation is written through to the file. Only the hashes of the tokens are stored.
+func NewPersistentRevocationList(file string) (*RevocationList, error) {
+	l := NewRevocationList()
+	l.file = file
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list %q: %w", file, err)
+	}
+
+	entries := []revokedToken{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse revocation list %q: %w", file, err)
+	}
+	now := time.Now()
+	for _, e := range entries {
+		raw, err := hex.DecodeString(e.Hash)
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("failed to parse revocation list %q: invalid hash %q", file, e.Hash)
+		}
+		var expiry time.Time
+		if e.Expiry != nil {
+			expiry = *e.Expiry
+		}
+		if !expiry.IsZero() && now.After(expiry) {
+			continue
+		}
+		l.tokens[[sha256.Size]byte(raw)] = expiry
+	}
+	return l, nil
+}
+
+// Revoke revokes a token.
+func (l *RevocationList) Revoke(token string) error {
+	claims := &auth.Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+	var expiry time.Time // tokens without an expiry are kept forever
+	if claims.ExpiresAt != nil {
+		expiry = claims.ExpiresAt.Time
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// drop the expired tokens
+	now := time.Now()
+	for h, e := range l.tokens {
+		if !e.IsZero() && now.After(e) {
+			delete(l.tokens, h)
+		}
+	}
+
+	l.tokens[sha256.Sum256([]byte(token))] = expiry
+	if l.file != "" {
+		if err := l.save(); err != nil {
+			return fmt.Errorf("failed to persist revocation list %q: %w", l.file, err)
+		}
+	}
+	return nil
+}
+
+// save writes the revocation list to the file through a temporary file so that a crash does not
+// leave a truncated list behind. Must be called with the lock held.
+func (l *RevocationList) save() error {
+	entries := make([]revokedToken, 0, len(l.tokens))
+	for h, e := range l.tokens {
+		entry := revokedToken{Hash: hex.EncodeToString(h[:])}
+		if !e.IsZero() {
+			expiry := e
+			entry.Expiry = &expiry
+		}
+		entries = append(entries, entry)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.file), filepath.Base(l.file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.file)
+}
+
+// IsRevoked returns true if the token has been revoked.
+func (l *RevocationList) IsRevoked(token string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.tokens[sha256.Sum256([]byte(token))]
+	return ok
+}
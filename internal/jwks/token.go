@@ -0,0 +1,131 @@
+package jwks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+)
+
+// TokenGenerator issues tokens like auth.TokenGenerator but stamps them with the key id of the
+// signing key in the "kid" header.
+type TokenGenerator struct {
+	privateKey *rsa.PrivateKey
+	kid        string
+}
+
+// NewTokenGenerator creates a token generator. If kid is empty, the key id defaults to KeyID.
+func NewTokenGenerator(privateKey *rsa.PrivateKey, kid string) *TokenGenerator {
+	if kid == "" {
+		kid = KeyID(&privateKey.PublicKey)
+	}
+	return &TokenGenerator{privateKey: privateKey, kid: kid}
+}
+
+// KeyID returns the key id the tokens are stamped with.
+func (g *TokenGenerator) KeyID() string { return g.kid }
+
+// GenerateToken creates a JWT for a user with namespace and RBAC rules. Each token gets a unique
+// id so that the tokens issued to the same user can be revoked separately.
+func (g *TokenGenerator) GenerateToken(username string, namespaces []string, rules []rbacv1.PolicyRule, expiry time.Duration) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		Username:   username,
+		Namespaces: namespaces,
+		Rules:      rules,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "dcontroller",
+			ID:        hex.EncodeToString(id),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = g.kid
+	return token.SignedString(g.privateKey)
+}
+
+// Authenticator validates JWTs against a set of keys, selecting the verification key by the
+// "kid" header so that old and new keys can overlap during a key rotation. Tokens without a
+// kid are tried against all keys.
+type Authenticator struct {
+	kids             []string
+	authenticators   map[string]*auth.JWTAuthenticator
+	revoked          *RevocationList
+	minClientKeyBits int
+}
+
+// NewAuthenticator creates an authenticator from the public keys, keyed by their key ids.
+func NewAuthenticator(keys map[string]*rsa.PublicKey) *Authenticator {
+	a := &Authenticator{authenticators: map[string]*auth.JWTAuthenticator{}}
+	for kid, key := range keys {
+		a.kids = append(a.kids, kid)
+		a.authenticators[kid] = auth.NewJWTAuthenticator(key)
+	}
+	sort.Strings(a.kids)
+	return a
+}
+
+// SetRevocationList makes the authenticator reject the tokens on a revocation list.
+func (a *Authenticator) SetRevocationList(l *RevocationList) { a.revoked = l }
+
+// AuthenticateRequest implements authenticator.Request.
+func (a *Authenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	if a.minClientKeyBits > 0 && req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		if err := CheckClientKey(req.TLS.PeerCertificates[0], a.minClientKeyBits); err != nil {
+			return nil, false, fmt.Errorf("invalid client certificate: %w", err)
+		}
+	}
+
+	authHeader := req.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, false, nil // No auth provided
+	}
+
+	// the signature is verified by the selected authenticator
+	raw := strings.TrimPrefix(authHeader, "Bearer ")
+	token, _, err := jwt.NewParser().ParseUnverified(raw, &auth.Claims{})
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid token: %w", err)
+	}
+
+	if a.revoked != nil && a.revoked.IsRevoked(raw) {
+		return nil, false, errors.New("invalid token: revoked")
+	}
+
+	if kid, ok := token.Header["kid"].(string); ok {
+		ja, ok := a.authenticators[kid]
+		if !ok {
+			return nil, false, fmt.Errorf("invalid token: unknown key id %q", kid)
+		}
+		return ja.AuthenticateRequest(req)
+	}
+
+	err = fmt.Errorf("invalid token: no verification keys")
+	for _, kid := range a.kids {
+		res, ok, aerr := a.authenticators[kid].AuthenticateRequest(req)
+		if aerr == nil {
+			return res, ok, nil
+		}
+		err = aerr
+	}
+	return nil, false, err
+}
@@ -0,0 +1,133 @@
+package jwks_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+)
+
+var _ = Describe("Key rotation", func() {
+	var (
+		oldKey, newKey *rsa.PrivateKey
+		a              *jwks.Authenticator
+	)
+
+	BeforeEach(func() {
+		var err error
+		oldKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		newKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		a = jwks.NewAuthenticator(map[string]*rsa.PublicKey{
+			"old": &oldKey.PublicKey,
+			"new": &newKey.PublicKey,
+		})
+	})
+
+	authenticate := func(token string) (string, error) {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, ok, err := a.AuthenticateRequest(req)
+		if err != nil {
+			return "", err
+		}
+		Expect(ok).To(BeTrue())
+		return res.User.GetName(), nil
+	}
+
+	It("should validate tokens issued under both key ids", func() {
+		for kid, key := range map[string]*rsa.PrivateKey{"old": oldKey, "new": newKey} {
+			g := jwks.NewTokenGenerator(key, kid)
+			Expect(g.KeyID()).To(Equal(kid))
+			token, err := g.GenerateToken("user-"+kid, []string{"ns"}, nil, time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+
+			user, err := authenticate(token)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user).To(Equal("user-" + kid))
+		}
+	})
+
+	It("should reject a token signed with a key not matching its key id", func() {
+		token, err := jwks.NewTokenGenerator(newKey, "old").GenerateToken("user", nil, nil, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = authenticate(token)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject a token with an unknown key id", func() {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		token, err := jwks.NewTokenGenerator(otherKey, "").GenerateToken("user", nil, nil, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = authenticate(token)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Token revocation", func() {
+	It("should reject a revoked token but accept a fresh one for the same user", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		g := jwks.NewTokenGenerator(key, "")
+		a := jwks.NewAuthenticator(map[string]*rsa.PublicKey{g.KeyID(): &key.PublicKey})
+		revoked := jwks.NewRevocationList()
+		a.SetRevocationList(revoked)
+
+		authenticate := func(token string) error {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+token)
+			_, _, err = a.AuthenticateRequest(req)
+			return err
+		}
+
+		oldToken, err := g.GenerateToken("user-1", []string{"user-1"}, nil, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authenticate(oldToken)).To(Succeed())
+
+		Expect(revoked.Revoke(oldToken)).To(Succeed())
+		Expect(revoked.IsRevoked(oldToken)).To(BeTrue())
+		Expect(authenticate(oldToken)).To(MatchError(ContainSubstring("revoked")))
+
+		newToken, err := g.GenerateToken("user-1", []string{"user-1"}, nil, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newToken).NotTo(Equal(oldToken))
+		Expect(authenticate(newToken)).To(Succeed())
+	})
+
+	It("should reload the persisted revocations", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		g := jwks.NewTokenGenerator(key, "")
+		file := filepath.Join(GinkgoT().TempDir(), "revoked.json")
+
+		revoked, err := jwks.NewPersistentRevocationList(file)
+		Expect(err).NotTo(HaveOccurred())
+		token, err := g.GenerateToken("user-1", []string{"user-1"}, nil, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(revoked.Revoke(token)).To(Succeed())
+
+		data, err := os.ReadFile(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring(token))
+
+		reloaded, err := jwks.NewPersistentRevocationList(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded.IsRevoked(token)).To(BeTrue())
+
+		Expect(os.WriteFile(file, []byte("garbage"), 0o600)).To(Succeed())
+		_, err = jwks.NewPersistentRevocationList(file)
+		Expect(err).To(HaveOccurred())
+	})
+})
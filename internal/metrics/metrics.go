@@ -0,0 +1,225 @@
+// Package metrics defines the Prometheus metrics of dctrl5g. The metrics are registered with the
+// controller-runtime metrics registry.
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Prefix is the name prefix of the dctrl5g metrics.
+const Prefix = "dctrl5g_"
+
+// OtherReason is the reason label used for the reasons outside the known set.
+const OtherReason = "Other"
+
+// ConditionTransitions counts the condition transitions by operator, condition type, status and
+// reason.
+var ConditionTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "dctrl5g_condition_transitions_total",
+	Help: "Number of status condition transitions by operator, condition type, status and reason.",
+}, []string{"operator", "type", "status", "reason"})
+
+// DroppedEvents counts the lifecycle events dropped due to a full subscriber queue, by
+// subscriber.
+var DroppedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "dctrl5g_event_bus_dropped_total",
+	Help: "Number of lifecycle events dropped due to a full subscriber queue.",
+}, []string{"subscriber"})
+
+// TokenSelfTestSuccess is 1 if the last token signing self-test of the UDM succeeded and 0
+// otherwise.
+var TokenSelfTestSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "dctrl5g_udm_token_self_test_success",
+	Help: "Whether the last token signing self-test of the UDM succeeded.",
+})
+
+// TokenSelfTestTimestamp is the time of the last token signing self-test of the UDM.
+var TokenSelfTestTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "dctrl5g_udm_token_self_test_timestamp_seconds",
+	Help: "Unix time of the last token signing self-test of the UDM.",
+})
+
+// ActiveRegistrations, ActiveSessions and IdleSessions are the sizes of the aggregate tables, as
+// maintained by the counter view.
+var (
+	ActiveRegistrations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dctrl5g_active_registrations",
+		Help: "Number of the entries of the ActiveRegistrationTable.",
+	})
+	ActiveSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dctrl5g_active_sessions",
+		Help: "Number of the entries of the ActiveSessionTable.",
+	})
+	IdleSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dctrl5g_idle_sessions",
+		Help: "Number of the idle sessions in the ActiveSessionTable.",
+	})
+)
+
+// SessionsByFiveQI is the number of the sessions with a QoS flow of a 5QI, by 5QI.
+var SessionsByFiveQI = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "dctrl5g_sessions_by_5qi",
+	Help: "Number of the sessions with a QoS flow of the 5QI, by 5QI.",
+}, []string{"fiveqi"})
+
+// OrphanedConfigsCollected counts the UPF configs with no owning active session collected by the
+// config garbage collector.
+var OrphanedConfigsCollected = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "dctrl5g_upf_orphaned_configs_collected_total",
+	Help: "Number of the UPF configs with no owning active session garbage-collected.",
+})
+
+// CorrectedTableEntries counts the aggregate table entries corrected by the table resyncer.
+var CorrectedTableEntries = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "dctrl5g_table_resync_corrected_entries_total",
+	Help: "Number of the aggregate table entries corrected by the periodic table resync.",
+})
+
+// The results of a reconcile.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultRequeue = "requeue"
+)
+
+// ReconcileTotal counts the reconciles by operator, kind and result.
+var ReconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "dctrl5g_reconcile_total",
+	Help: "Number of reconciles by operator, kind and result (success, error or requeue).",
+}, []string{"operator", "kind", "result"})
+
+// ReconcileDuration is the distribution of the reconcile times by operator and kind.
+var ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dctrl5g_reconcile_duration_seconds",
+	Help:    "Time taken by the reconciles by operator and kind.",
+	Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"operator", "kind"})
+
+// knownFiveQIs are the 5QIs the SMF admits. Anything else is reported as OtherReason to keep the
+// label cardinality bounded.
+var knownFiveQIs = map[string]bool{"ConversationalVoice": true, "BestEffort": true}
+
+func init() {
+	metrics.Registry.MustRegister(ConditionTransitions, DroppedEvents, TokenSelfTestSuccess,
+		TokenSelfTestTimestamp, ReconcileTotal, ReconcileDuration, ActiveRegistrations, ActiveSessions,
+		IdleSessions, SessionsByFiveQI, OrphanedConfigsCollected, CorrectedTableEntries)
+}
+
+// RecordTransition counts a condition transition.
+func RecordTransition(operator, condType, status, reason string) {
+	if !KnownReason(reason) {
+		reason = OtherReason
+	}
+	ConditionTransitions.WithLabelValues(operator, condType, status, reason).Inc()
+}
+
+// RecordReconcile counts a reconcile with the given result and records its duration.
+func RecordReconcile(operator, kind, result string, d time.Duration) {
+	ReconcileTotal.WithLabelValues(operator, kind, result).Inc()
+	ReconcileDuration.WithLabelValues(operator, kind).Observe(d.Seconds())
+}
+
+// SetCounts sets the sizes of the aggregate tables.
+func SetCounts(registrations, sessions, idleSessions int64) {
+	ActiveRegistrations.Set(float64(registrations))
+	ActiveSessions.Set(float64(sessions))
+	IdleSessions.Set(float64(idleSessions))
+}
+
+// SetSessionsByFiveQI sets the number of the sessions per 5QI.
+func SetSessionsByFiveQI(counts map[string]int) {
+	other := 0
+	for q := range knownFiveQIs {
+		SessionsByFiveQI.WithLabelValues(q).Set(float64(counts[q]))
+	}
+	for q, n := range counts {
+		if !knownFiveQIs[q] {
+			other += n
+		}
+	}
+	SessionsByFiveQI.WithLabelValues(OtherReason).Set(float64(other))
+}
+
+// ErrorCounts are the totals of the error counters, summed over the labels.
+type ErrorCounts struct {
+	// ReconcileErrors is the number of the failed reconciles.
+	ReconcileErrors int64
+	// FailedConditions is the number of the condition transitions to False.
+	FailedConditions int64
+	// DroppedEvents is the number of the lifecycle events dropped.
+	DroppedEvents int64
+}
+
+// GetErrorCounts returns the totals of the error counters.
+func GetErrorCounts() (ErrorCounts, error) {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		return ErrorCounts{}, err
+	}
+
+	// sum adds up the series of a counter, restricted to a label value unless the label is empty
+	sum := func(name, label, value string) int64 {
+		var total float64
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				match := label == ""
+				for _, l := range m.GetLabel() {
+					if l.GetName() == label && l.GetValue() == value {
+						match = true
+					}
+				}
+				if match {
+					total += m.GetCounter().GetValue()
+				}
+			}
+		}
+		return int64(total)
+	}
+
+	return ErrorCounts{
+		ReconcileErrors:  sum("dctrl5g_reconcile_total", "result", ResultError),
+		FailedConditions: sum("dctrl5g_condition_transitions_total", "status", "False"),
+		DroppedEvents:    sum("dctrl5g_event_bus_dropped_total", "", ""),
+	}, nil
+}
+
+// Gatherer gathers the dctrl5g metrics only, leaving out the metrics of controller-runtime (the
+// workqueue, the reconcile and the API client metrics of the managers) registered in the same
+// registry.
+var Gatherer prometheus.Gatherer = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+	families, err := metrics.Registry.Gather()
+	ret := []*dto.MetricFamily{}
+	for _, f := range families {
+		if strings.HasPrefix(f.GetName(), Prefix) {
+			ret = append(ret, f)
+		}
+	}
+	return ret, err
+})
+
+// RegisterRuntimeCollectors registers the Go runtime and the process collectors, unless already
+// registered.
+func RegisterRuntimeCollectors() error {
+	for _, c := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		if err := metrics.Registry.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if !errors.As(err, &are) {
+				return err
+			}
+		}
+	}
+	return nil
+}
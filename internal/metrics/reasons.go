@@ -0,0 +1,102 @@
+package metrics
+
+// The condition reasons set by the operators. The declarative operators set the reasons in the
+// operator specs, the native controllers use the constants; either way, a reason must be listed in
+// Reasons to get a label of its own in the condition transition metric.
+const (
+	// amf
+	ReasonPending                   = "Pending"
+	ReasonValidated                 = "Validated"
+	ReasonInvalidType               = "InvalidType"
+	ReasonStandardNotSupported      = "StandardNotSupported"
+	ReasonMobileIdentityNotFound    = "MobileIdentityNotFound"
+	ReasonEncyptionNotSupported     = "EncyptionNotSupported"
+	ReasonMandatoryAlgorithmMissing = "MandatoryAlgorithmMissing"
+	ReasonTooManyNSSAI              = "TooManyNSSAI"
+	ReasonNoAllowedNSSAI            = "NoAllowedNSSAI"
+	ReasonPlmnNotServed             = "PlmnNotServed"
+	ReasonSuciNotFound              = "SuciNotFound"
+	ReasonSupiAlreadyRegistered     = "SupiAlreadyRegistered"
+	ReasonAuthenticationPending     = "AuthenticationPending"
+	ReasonMobileIdentityFailed      = "MobileIdentityFailed"
+	ReasonSupiNotFound              = "SupiNotFound"
+	ReasonConfigReady               = "ConfigReady"
+	ReasonConfigNotFound            = "ConfigNotFound"
+	ReasonRegistrationSuccessful    = "RegistrationSuccessful"
+	ReasonRegistrationFailed        = "RegistrationFailed"
+	ReasonRegistrationTimeout       = "RegistrationTimeout"
+	ReasonInvalidSession            = "InvalidSession"
+	ReasonNSSAINotPermitted         = "NSSAINotPermitted"
+	ReasonPduTypeNotSupported       = "PduTypeNotSupported"
+	ReasonGutiNotSpeficied          = "GutiNotSpeficied"
+	ReasonGutiNotSpecified          = "GutiNotSpecified"
+	ReasonGutiNotFound              = "GutiNotFound"
+	ReasonUnregistered              = "Unregistered"
+	ReasonRegistrationPending       = "RegistrationPending"
+	ReasonSessionNotFound           = "SessionNotFound"
+	ReasonSessionSuccessful         = "SessionSuccessful"
+	ReasonSessionFailed             = "SessionFailed"
+	ReasonGutiCollision             = "GutiCollision"
+	ReasonInvalidTrackingArea       = "InvalidTrackingArea"
+	ReasonTrackingAreaNotServed     = "TrackingAreaNotServed"
+
+	// ausf
+	ReasonAuthenticationSuccess  = "AuthenticationSuccess"
+	ReasonAuthenticationFailure  = "AuthenticationFailure"
+	ReasonSubscriberNotFound     = "SubscriberNotFound"
+	ReasonServingNetworkUnknown  = "ServingNetworkUnknown"
+	ReasonChallengeSent          = "ChallengeSent"
+	ReasonNoChallenge            = "NoChallenge"
+	ReasonSynchronizationFailure = "SynchronizationFailure"
+	ReasonResynchronized         = "Resynchronized"
+
+	// smf
+	ReasonPolicyApplied             = "PolicyApplied"
+	ReasonPolicyRejected            = "PolicyRejected"
+	ReasonAddressFamilyNotSupported = "AddressFamilyNotSupported"
+	ReasonAmbrExceeded              = "AmbrExceeded"
+	ReasonUPFConfigured             = "UPFConfigured"
+	ReasonIdle                      = "Idle"
+
+	// udm
+	ReasonReady             = "Ready"
+	ReasonConfigUnavailable = "ConfigUnavailable"
+)
+
+// Reasons are the known condition reasons. Anything else is reported as OtherReason to keep the
+// label cardinality bounded.
+var Reasons = []string{
+	ReasonPending, ReasonValidated, ReasonInvalidType, ReasonStandardNotSupported,
+	ReasonMobileIdentityNotFound, ReasonEncyptionNotSupported, ReasonMandatoryAlgorithmMissing,
+	ReasonTooManyNSSAI, ReasonNoAllowedNSSAI, ReasonPlmnNotServed, ReasonSuciNotFound,
+	ReasonSupiAlreadyRegistered, ReasonAuthenticationPending, ReasonMobileIdentityFailed,
+	ReasonSupiNotFound, ReasonConfigReady, ReasonConfigNotFound, ReasonRegistrationSuccessful,
+	ReasonRegistrationFailed, ReasonRegistrationTimeout, ReasonInvalidSession,
+	ReasonNSSAINotPermitted, ReasonPduTypeNotSupported, ReasonGutiNotSpeficied,
+	ReasonGutiNotSpecified, ReasonGutiNotFound, ReasonUnregistered, ReasonRegistrationPending,
+	ReasonSessionNotFound, ReasonSessionSuccessful, ReasonSessionFailed, ReasonGutiCollision,
+	ReasonInvalidTrackingArea, ReasonTrackingAreaNotServed,
+
+	ReasonAuthenticationSuccess, ReasonAuthenticationFailure, ReasonSubscriberNotFound,
+	ReasonServingNetworkUnknown, ReasonChallengeSent, ReasonNoChallenge,
+	ReasonSynchronizationFailure, ReasonResynchronized,
+
+	ReasonPolicyApplied, ReasonPolicyRejected, ReasonAddressFamilyNotSupported,
+	ReasonAmbrExceeded, ReasonUPFConfigured, ReasonIdle,
+
+	ReasonReady, ReasonConfigUnavailable,
+}
+
+// knownReasons is the set of the known condition reasons.
+var knownReasons = map[string]bool{}
+
+func init() {
+	for _, r := range Reasons {
+		knownReasons[r] = true
+	}
+}
+
+// KnownReason returns whether a condition reason gets a label of its own.
+func KnownReason(reason string) bool {
+	return knownReasons[reason]
+}
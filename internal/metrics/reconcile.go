@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/pipeline"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// instrumentedReconciler counts the reconciles of a native controller and records their
+// duration.
+type instrumentedReconciler struct {
+	operator string
+	r        reconcile.TypedReconciler[reconciler.Request]
+}
+
+// InstrumentReconciler wraps the reconciler of a native controller of an operator so that each
+// reconcile is counted in dctrl5g_reconcile_total and timed in dctrl5g_reconcile_duration_seconds,
+// labeled with the kind of the request.
+func InstrumentReconciler(operator string, r reconcile.TypedReconciler[reconciler.Request]) reconcile.TypedReconciler[reconciler.Request] {
+	return &instrumentedReconciler{operator: operator, r: r}
+}
+
+func (i *instrumentedReconciler) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	start := time.Now()
+	res, err := i.r.Reconcile(ctx, req)
+
+	result := ResultSuccess
+	switch {
+	case err != nil:
+		result = ResultError
+	case !res.IsZero():
+		result = ResultRequeue
+	}
+	RecordReconcile(i.operator, req.GVK.Kind, result, time.Since(start))
+
+	return res, err
+}
+
+// ErrorReporter receives the reconcile errors of the native controllers, labeled with the name of
+// the controller.
+type ErrorReporter func(controller string, err error)
+
+// errorReportingReconciler passes the reconcile errors of a native controller to a reporter.
+type errorReportingReconciler struct {
+	controller string
+	r          reconcile.TypedReconciler[reconciler.Request]
+	report     ErrorReporter
+}
+
+// ReportErrors wraps the reconciler of a native controller so that the reconcile errors are passed
+// to report, e.g., to feed the error stream of the operator. Returns the reconciler as is if report
+// is nil.
+func ReportErrors(controller string, r reconcile.TypedReconciler[reconciler.Request], report ErrorReporter) reconcile.TypedReconciler[reconciler.Request] {
+	if report == nil {
+		return r
+	}
+	return &errorReportingReconciler{controller: controller, r: r, report: report}
+}
+
+func (e *errorReportingReconciler) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	res, err := e.r.Reconcile(ctx, req)
+	if err != nil {
+		e.report(e.controller, err)
+	}
+	return res, err
+}
+
+// instrumentedPipeline counts the reconciles of a declarative controller and records their
+// duration.
+type instrumentedPipeline struct {
+	operator string
+	p        pipeline.Evaluator
+}
+
+// InstrumentPipeline wraps the pipeline of a declarative controller of an operator so that each
+// evaluation, i.e., each reconcile of an object of a source kind, is counted in
+// dctrl5g_reconcile_total and timed in dctrl5g_reconcile_duration_seconds, labeled with the kind of
+// the object.
+func InstrumentPipeline(operator string, p pipeline.Evaluator) pipeline.Evaluator {
+	return &instrumentedPipeline{operator: operator, p: p}
+}
+
+func (i *instrumentedPipeline) Evaluate(delta object.Delta) ([]object.Delta, error) {
+	start := time.Now()
+	deltas, err := i.p.Evaluate(delta)
+
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	}
+	kind := ""
+	if delta.Object != nil {
+		kind = delta.Object.GetObjectKind().GroupVersionKind().Kind
+	}
+	RecordReconcile(i.operator, kind, result, time.Since(start))
+
+	return deltas, err
+}
+
+func (i *instrumentedPipeline) String() string { return i.p.String() }
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+)
+
+// Work tracks the requests queued for and being processed by the controllers of an operator, so
+// that a drain can wait for them. Unlike the controller-runtime workqueue metrics, which are
+// process-wide and keyed by the name of the controller only, a Work belongs to a single operator
+// instance. The methods of a nil Work track nothing.
+type Work struct {
+	inflight atomic.Int64
+	mu       sync.Mutex
+	queues   []workqueue.TypedRateLimitingInterface[reconciler.Request]
+}
+
+// NewWork creates a work tracker.
+func NewWork() *Work { return &Work{} }
+
+// Begin marks the start of the processing of a request.
+func (w *Work) Begin() {
+	if w != nil {
+		w.inflight.Add(1)
+	}
+}
+
+// End marks the end of the processing of a request.
+func (w *Work) End() {
+	if w != nil {
+		w.inflight.Add(-1)
+	}
+}
+
+// TrackReconciler wraps the reconciler of a native controller so that its reconciles in progress
+// are tracked. Returns the reconciler as is if w is nil.
+func (w *Work) TrackReconciler(r reconcile.TypedReconciler[reconciler.Request]) reconcile.TypedReconciler[reconciler.Request] {
+	if w == nil {
+		return r
+	}
+	return &trackedReconciler{work: w, r: r}
+}
+
+// NewQueue returns the constructor of the work queue of a native controller, to be passed as the
+// NewQueue option of the controller, that tracks the requests queued. The queue is the default
+// rate limiting queue of controller-runtime. Returns nil, i.e., the default, if w is nil.
+func (w *Work) NewQueue() func(string, workqueue.TypedRateLimiter[reconciler.Request]) workqueue.TypedRateLimitingInterface[reconciler.Request] {
+	if w == nil {
+		return nil
+	}
+	return func(name string, rateLimiter workqueue.TypedRateLimiter[reconciler.Request]) workqueue.TypedRateLimitingInterface[reconciler.Request] {
+		q := workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter,
+			workqueue.TypedRateLimitingQueueConfig[reconciler.Request]{Name: name})
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.queues = append(w.queues, q)
+		return q
+	}
+}
+
+// Pending returns the number of the requests queued or being processed.
+func (w *Work) Pending() int {
+	if w == nil {
+		return 0
+	}
+	n := int(w.inflight.Load())
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, q := range w.queues {
+		n += q.Len()
+	}
+	return n
+}
+
+// trackedReconciler tracks the reconciles in progress of a native controller.
+type trackedReconciler struct {
+	work *Work
+	r    reconcile.TypedReconciler[reconciler.Request]
+}
+
+func (t *trackedReconciler) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	t.work.Begin()
+	defer t.work.End()
+	return t.r.Reconcile(ctx, req)
+}
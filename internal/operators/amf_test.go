@@ -2,6 +2,9 @@ package operators
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -335,8 +338,8 @@ spec:
     type: SUCI
     value: "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"
   ueSecurityCapability:
-    encryptionAlgorithms: ["dummy"]
-    integrityAlgorithms: ["dummy"]
+    encryptionAlgorithms: ["5G-EA0", "dummy"]
+    integrityAlgorithms: ["5G-IA0", "dummy"]
   ueStatus:
     n1Mode: true
   requestedNSSAI:
@@ -466,6 +469,244 @@ spec:
 			Expect(cond["reason"]).To(Equal("SupiNotFound"))
 		})
 
+		It("should accept a registration with the maximum number of S-NSSAIs", func() {
+			reg := nssaiReg("test-reg", "default", 8)
+			err := c.Create(ctx, reg)
+			Expect(err).NotTo(HaveOccurred())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() bool {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return false
+				}
+				cs, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				if err != nil || !ok {
+					return false
+				}
+				r := findCondition(cs, "Ready")
+				return r != nil && r["status"] == "True"
+			}, timeout, interval).Should(BeTrue())
+
+			conds, _, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+			Expect(err).NotTo(HaveOccurred())
+			cond := findCondition(conds, "Validated")
+			Expect(cond).NotTo(BeNil())
+			Expect(cond["status"]).To(Equal("True"))
+		})
+
+		It("should reject a registration with too many S-NSSAIs", func() {
+			reg := nssaiReg("test-reg", "default", 9)
+			err := c.Create(ctx, reg)
+			Expect(err).NotTo(HaveOccurred())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() bool {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return false
+				}
+				cs, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				if err != nil || !ok {
+					return false
+				}
+				r := findCondition(cs, "Validated")
+				return r != nil && r["status"] == "False"
+			}, timeout, interval).Should(BeTrue())
+
+			conds, _, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+			Expect(err).NotTo(HaveOccurred())
+			cond := findCondition(conds, "Ready")
+			Expect(cond).NotTo(BeNil())
+			Expect(cond["status"]).To(Equal("False"))
+
+			cond = findCondition(conds, "Validated")
+			Expect(cond).NotTo(BeNil())
+			Expect(cond["status"]).To(Equal("False"))
+			Expect(cond["reason"]).To(Equal("TooManyNSSAI"))
+		})
+
+		It("should allow the intersection of the requested and the subscribed NSSAI", func() {
+			// requested: {eMBB, URLLC}, subscribed: {eMBB}
+			initReg(ctx, "test-reg", "default", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0")
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() bool {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return false
+				}
+				cs, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				if err != nil || !ok {
+					return false
+				}
+				r := findCondition(cs, "Ready")
+				return r != nil && r["status"] == "True"
+			}, timeout, interval).Should(BeTrue())
+
+			allowed, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "allowedNSSAI")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(allowed).To(Equal([]any{
+				map[string]any{"sliceType": "eMBB", "sliceDifferentiator": "000001"},
+			}))
+
+			regState := object.NewViewObject("amf", "RegState")
+			object.SetName(regState, "default", "test-reg")
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(regState), regState)).To(Succeed())
+			allowed, ok, err = unstructured.NestedSlice(regState.UnstructuredContent(), "status", "allowedNSSAI")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(allowed).To(HaveLen(1))
+		})
+
+		It("should reject a registration with no subscribed S-NSSAI", func() {
+			reg := nssaiReg("test-reg", "default", 1)
+			Expect(unstructured.SetNestedSlice(reg.UnstructuredContent(), []any{
+				map[string]any{"sliceType": "URLLC", "sliceDifferentiator": "000002"},
+			}, "spec", "requestedNSSAI")).To(Succeed())
+			err := c.Create(ctx, reg)
+			Expect(err).NotTo(HaveOccurred())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() bool {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return false
+				}
+				cs, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				if err != nil || !ok {
+					return false
+				}
+				r := findCondition(cs, "Validated")
+				return r != nil && r["status"] == "False"
+			}, timeout, interval).Should(BeTrue())
+
+			conds, _, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+			Expect(err).NotTo(HaveOccurred())
+			cond := findCondition(conds, "Validated")
+			Expect(cond).NotTo(BeNil())
+			Expect(cond["reason"]).To(Equal("NoAllowedNSSAI"))
+		})
+
+		// taiVerdict creates a registration in a tracking area and waits for the verdict
+		taiVerdict := func(tai string) map[string]string {
+			GinkgoHelper()
+			reg := nssaiReg("test-reg", "default", 1)
+			Expect(unstructured.SetNestedField(reg.UnstructuredContent(), tai,
+				"spec", "trackingArea")).To(Succeed())
+			Expect(c.Create(ctx, reg)).To(Succeed())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			var validated map[string]string
+			Eventually(func() bool {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return false
+				}
+				cs, _, _ := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				r := findCondition(cs, "Ready")
+				validated = findCondition(cs, "Validated")
+				return r != nil && validated != nil &&
+					(r["status"] == "True" || validated["status"] == "False")
+			}, timeout, interval).Should(BeTrue())
+			return validated
+		}
+
+		It("should accept a registration with a valid tracking area", func() {
+			validated := taiVerdict("tai-001-01-000001")
+			Expect(validated["status"]).To(Equal("True"))
+		})
+
+		It("should reject a registration with a malformed tracking area", func() {
+			validated := taiVerdict("tai-001-01-zzz")
+			Expect(validated["status"]).To(Equal("False"))
+			Expect(validated["reason"]).To(Equal("InvalidTrackingArea"))
+		})
+
+		It("should reject a registration in a tracking area not served", func() {
+			setServedTrackingAreas(ctx, "tai-001-01-000002")
+			validated := taiVerdict("tai-001-01-000001")
+			Expect(validated["status"]).To(Equal("False"))
+			Expect(validated["reason"]).To(Equal("TrackingAreaNotServed"))
+		})
+
+		It("should expose the highest algorithms common to the UE and the network", func() {
+			setSecurityPolicy(ctx, []any{"5G-EA1", "5G-EA2"}, []any{"5G-IA1", "5G-IA2", "5G-IA3"})
+			// the UE supports all algorithms
+			Expect(c.Create(ctx, nssaiReg("test-reg", "default", 1))).To(Succeed())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() map[string]any {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return nil
+				}
+				selected, _, _ := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "selectedAlgorithms")
+				return selected
+			}, timeout, interval).Should(Equal(map[string]any{
+				"encryption": "5G-EA2",
+				"integrity":  "5G-IA3",
+			}))
+		})
+
+		It("should reject a registration with no algorithm allowed by the network", func() {
+			setSecurityPolicy(ctx, []any{"5G-EA4"}, []any{"5G-IA2"})
+			validated := taiVerdict("tai-001-01-000001")
+			Expect(validated["status"]).To(Equal("False"))
+			Expect(validated["reason"]).To(Equal("EncyptionNotSupported"))
+		})
+
+		It("should reject a registration missing the null algorithms by default", func() {
+			reg := nssaiReg("test-reg", "default", 1)
+			Expect(unstructured.SetNestedStringSlice(reg.UnstructuredContent(), []string{"5G-EA1", "5G-EA2"},
+				"spec", "ueSecurityCapability", "encryptionAlgorithms")).To(Succeed())
+			Expect(c.Create(ctx, reg)).To(Succeed())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() map[string]string {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return nil
+				}
+				cs, _, _ := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				return findCondition(cs, "Validated")
+			}, timeout, interval).Should(And(
+				HaveKeyWithValue("status", "False"),
+				HaveKeyWithValue("reason", "MandatoryAlgorithmMissing"),
+			))
+		})
+
+		It("should accept a registration including the mandatory algorithms", func() {
+			setMandatoryAlgorithms(ctx, []any{"5G-EA0", "5G-EA2"}, []any{"5G-IA0", "5G-IA2"})
+			// the UE supports all algorithms
+			validated := taiVerdict("tai-001-01-000001")
+			Expect(validated["status"]).To(Equal("True"))
+		})
+
+		It("should accept a registration missing the null algorithms with the check disabled", func() {
+			setMandatoryAlgorithms(ctx, []any{}, []any{})
+			reg := nssaiReg("test-reg", "default", 1)
+			Expect(unstructured.SetNestedStringSlice(reg.UnstructuredContent(), []string{"5G-EA1", "5G-EA2"},
+				"spec", "ueSecurityCapability", "encryptionAlgorithms")).To(Succeed())
+			Expect(unstructured.SetNestedStringSlice(reg.UnstructuredContent(), []string{"5G-IA1", "5G-IA2"},
+				"spec", "ueSecurityCapability", "integrityAlgorithms")).To(Succeed())
+			Expect(c.Create(ctx, reg)).To(Succeed())
+
+			retrieved := object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "default", "test-reg")
+			Eventually(func() map[string]string {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return nil
+				}
+				cs, _, _ := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				return findCondition(cs, "Validated")
+			}, timeout, interval).Should(And(
+				HaveKeyWithValue("status", "True"),
+				HaveKeyWithValue("reason", "Validated"),
+			))
+		})
+
 		It("should delete a registration and linked resources", func() {
 			yamlData := `
 apiVersion: amf.view.dcontroller.io/v1alpha1
@@ -916,6 +1157,70 @@ spec:
 			Expect(cond["status"]).To(Equal("Unknown"))
 		})
 
+		It("should reject a session with an unsupported PDU session type", func() {
+			// load reg 1
+			retrieved := initReg(ctx, "user-1", "user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0",
+				statusCond{"Ready", "True"})
+			Expect(retrieved).NotTo(BeNil())
+
+			// create session
+			yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Session
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  nssai: eMBB
+  guti: "guti-310-170-3F-152-2A-B7C8D9E0"
+  pduSessionType: Ethernet
+  networkConfiguration:
+    requests:
+      - addressFamily: IPv4
+        type: IPConfiguration
+      - addressFamily: IPv4
+        type: DNSServer
+  qos:
+    flows: [1,2]
+    rules: [1,2]`
+			session := object.New()
+			err := yaml.Unmarshal([]byte(yamlData), &session)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = c.Create(ctx, session)
+			Expect(err).NotTo(HaveOccurred())
+
+			// wait until we get an object with nonzero status
+			retrieved = object.NewViewObject("amf", "Session")
+			object.SetName(retrieved, "user-1", "user-1")
+			Eventually(func() bool {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+					return false
+				}
+				cs, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				if err != nil || !ok {
+					return false
+				}
+				r := findCondition(cs, "Ready")
+				return r != nil && r["status"] == "False"
+			}, timeout, interval).Should(BeTrue())
+
+			// check status
+			conds, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			cond := findCondition(conds, "Validated")
+			Expect(cond).NotTo(BeNil())
+			Expect(cond["status"]).To(Equal("False"))
+			Expect(cond["reason"]).To(Equal("PduTypeNotSupported"))
+
+			cond = findCondition(conds, "Ready")
+			Expect(cond).NotTo(BeNil())
+			Expect(cond["status"]).To(Equal("False"))
+			Expect(cond["reason"]).To(Equal("SessionFailed"))
+		})
+
 		It("should reject a session with no GUTI", func() {
 			// load reg 1
 			retrieved := initReg(ctx, "user-1", "user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0",
@@ -986,6 +1291,87 @@ spec:
 			Expect(cond["type"]).To(Equal("UPFConfigured"))
 			Expect(cond["status"]).To(Equal("Unknown"))
 		})
+
+		It("should delete a single session and keep the registration and other sessions", func() {
+			guti := "guti-310-170-3F-152-2A-B7C8D9E0"
+			reg := initReg(ctx, "user-1", "user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0",
+				statusCond{"Ready", "True"})
+			Expect(reg).NotTo(BeNil())
+
+			sess1 := initSession(ctx, "user-1-1", "user-1", guti, 1, statusCond{"Ready", "True"})
+			Expect(sess1).NotTo(BeNil())
+			sess2 := initSession(ctx, "user-1-2", "user-1", guti, 2, statusCond{"Ready", "True"})
+			Expect(sess2).NotTo(BeNil())
+
+			// both sessions have a UPF config
+			for _, name := range []string{"user-1-1", "user-1-2"} {
+				config := object.NewViewObject("upf", "Config")
+				object.SetName(config, "user-1", name)
+				Eventually(func() bool {
+					return c.Get(ctx, client.ObjectKeyFromObject(config), config) == nil
+				}, timeout, interval).Should(BeTrue())
+			}
+
+			// delete session 1
+			Expect(c.Delete(ctx, sess1)).To(Succeed())
+
+			// the session context and the UPF config of session 1 are removed
+			sessCtx := object.NewViewObject("smf", "SessionContext")
+			object.SetName(sessCtx, "user-1", "user-1-1")
+			Eventually(func() bool {
+				return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(sessCtx), sessCtx))
+			}, timeout, interval).Should(BeTrue())
+
+			config := object.NewViewObject("upf", "Config")
+			object.SetName(config, "user-1", "user-1-1")
+			Eventually(func() bool {
+				return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(config), config))
+			}, timeout, interval).Should(BeTrue())
+
+			// only session 2 remains in the active session table (plus the test session)
+			Eventually(func() []any {
+				table := object.NewViewObject("smf", "ActiveSessionTable")
+				object.SetName(table, "", "active-sessions")
+				if c.Get(ctx, client.ObjectKeyFromObject(table), table) != nil {
+					return nil
+				}
+				specs, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec")
+				names := []any{}
+				for _, s := range specs {
+					names = append(names, s.(map[string]any)["name"])
+				}
+				return names
+			}, timeout, interval).Should(ConsistOf("test-session", "user-1-2"))
+
+			// session 2 survives
+			retrieved := object.NewViewObject("amf", "Session")
+			object.SetName(retrieved, "user-1", "user-1-2")
+			Consistently(func() bool {
+				if c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved) != nil {
+					return false
+				}
+				cs, _, _ := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+				r := findCondition(cs, "Ready")
+				return r != nil && r["status"] == "True"
+			}, 5*interval, interval).Should(BeTrue())
+
+			config = object.NewViewObject("upf", "Config")
+			object.SetName(config, "user-1", "user-1-2")
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(config), config)).To(Succeed())
+
+			// the registration survives
+			retrieved = object.NewViewObject("amf", "Registration")
+			object.SetName(retrieved, "user-1", "user-1")
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved)).To(Succeed())
+			cs, _, _ := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "conditions")
+			r := findCondition(cs, "Ready")
+			Expect(r).NotTo(BeNil())
+			Expect(r["status"]).To(Equal("True"))
+
+			regState := object.NewViewObject("amf", "RegState")
+			object.SetName(regState, "user-1", "user-1")
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(regState), regState)).To(Succeed())
+		})
 	})
 
 	Context("When initiating an active->idle state transition", Ordered, Label("amf"), func() {
@@ -1150,3 +1536,149 @@ spec:
 		})
 	})
 })
+
+// nssaiReg returns a valid registration requesting n S-NSSAIs.
+func nssaiReg(name, namespace string, n int) object.Object {
+	GinkgoHelper()
+
+	nssai := make([]string, n)
+	for i := range nssai {
+		nssai[i] = fmt.Sprintf("    - sliceType: eMBB\n      sliceDifferentiator: \"%06d\"", i+1)
+	}
+
+	yamlData := fmt.Sprintf(`
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Registration
+metadata:
+  name: %s
+  namespace: %s
+spec:
+  registrationType: initial
+  mobileIdentity:
+    type: SUCI
+    value: "suci-0-999-01-02-4f2a7b9c8d13e7a5c0"
+  ueSecurityCapability:
+    encryptionAlgorithms: ["5G-EA0", "5G-EA1", "5G-EA2", "5G-EA3"]
+    integrityAlgorithms: ["5G-IA0", "5G-IA1", "5G-IA2", "5G-IA3"]
+  ueStatus:
+    n1Mode: true
+  requestedNSSAI:
+%s`, name, namespace, strings.Join(nssai, "\n"))
+
+	reg := object.New()
+	err := yaml.Unmarshal([]byte(yamlData), &reg)
+	Expect(err).NotTo(HaveOccurred())
+	return reg
+}
+
+// setServedTrackingAreas sets the tracking areas served by the AMF in the config table.
+func setServedTrackingAreas(ctx context.Context, tais ...any) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("amf", "ConfigTable")
+	object.SetName(table, "", "amf-config")
+	Eventually(func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), tais,
+			"spec", "servedTrackingAreas"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	}, timeout, interval).Should(Succeed())
+}
+
+// setSecurityPolicy sets the encryption and the integrity algorithms allowed by the AMF in the
+// config table.
+func setSecurityPolicy(ctx context.Context, encryption, integrity []any) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("amf", "ConfigTable")
+	object.SetName(table, "", "amf-config")
+	Eventually(func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(table.UnstructuredContent(), map[string]any{
+			"encryptionAlgorithms": encryption,
+			"integrityAlgorithms":  integrity,
+		}, "spec", "securityPolicy"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	}, timeout, interval).Should(Succeed())
+}
+
+// setMandatoryAlgorithms sets the encryption and the integrity algorithms the UEs must support
+// in the config table.
+func setMandatoryAlgorithms(ctx context.Context, encryption, integrity []any) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("amf", "ConfigTable")
+	object.SetName(table, "", "amf-config")
+	Eventually(func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(table.UnstructuredContent(), map[string]any{
+			"encryptionAlgorithms": encryption,
+			"integrityAlgorithms":  integrity,
+		}, "spec", "mandatoryAlgorithms"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	}, timeout, interval).Should(Succeed())
+}
+
+var _ = Describe("AMF Operator with a registration timeout", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		// no AUSF: authentication stalls
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs:             []dctrl.OpSpec{{Name: "amf", File: "amf.yaml"}},
+			RegistrationTimeout: time.Second,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+		Expect(c).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should time out a registration stalled at a downstream step", func() {
+		initReg(ctx, "user-1", "user-1", "suci-0-999-01-02-4f2a7b9c8d13e7a5c0")
+
+		reg := object.NewViewObject("amf", "Registration")
+		object.SetName(reg, "user-1", "user-1")
+		Eventually(func() bool {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(reg), reg); err != nil {
+				return false
+			}
+			conds, ok, err := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+			if err != nil || !ok {
+				return false
+			}
+			cond := findCondition(conds, "Ready")
+			return cond != nil && cond["status"] == "False" && cond["reason"] == "RegistrationTimeout"
+		}, timeout, interval).Should(BeTrue())
+
+		// the validation step is not affected
+		conds, _, err := unstructured.NestedSlice(reg.UnstructuredContent(), "status", "conditions")
+		Expect(err).NotTo(HaveOccurred())
+		ready := findCondition(conds, "Ready")
+		Expect(ready).To(HaveKey("lastTransitionTime"))
+		_, err = time.Parse(time.RFC3339, ready["lastTransitionTime"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findCondition(conds, "Validated")).To(HaveKeyWithValue("status", "True"))
+		Expect(findCondition(conds, "Authenticated")).NotTo(HaveKeyWithValue("status", "True"))
+	})
+})
@@ -0,0 +1,436 @@
+// CHF: Charging Function usage accounting
+//
+// The CHF operator maintains the usage of the PDU sessions of the UEs in the chf/UsageRecord
+// view, as a precursor to online/offline charging. A usage record is named after the
+// smf/SessionContext of the session in the namespace of the UE, and accrues the duration of the
+// session and the bytes reported by the data path:
+//
+//	apiVersion: chf.view.dcontroller.io/v1alpha1
+//	kind: UsageRecord
+//	metadata:
+//	  name: session-1
+//	  namespace: user-1
+//	spec:
+//	  guti: "999-01-..."
+//	  sessionId: 1
+//	  active: true
+//	  startTime: "2025-01-01T00:00:00Z"
+//	  duration: 1m30s
+//	  durationSeconds: 90
+//	  uplinkBytes: 1024
+//	  downlinkBytes: 4096
+//
+// The duration of the active sessions is refreshed periodically. The record of a deleted session
+// is kept with its end time, for the charging system to collect.
+package chf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/apiserver"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	dcontroller "github.com/l7mp/dcontroller/pkg/controller"
+	"github.com/l7mp/dcontroller/pkg/manager"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/operator"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+const OperatorName = "chf"
+
+// accountingControllerName is the name of the controller of the CHF.
+const accountingControllerName = "chf-accounting-controller"
+
+// The SMF objects the usage is accounted for.
+const (
+	smfOperatorName    = "smf"
+	sessionContextKind = "SessionContext"
+	usageRecordKind    = "UsageRecord"
+)
+
+// DefaultRefreshInterval is the default interval of refreshing the duration of the active
+// sessions.
+const DefaultRefreshInterval = time.Minute
+
+// ErrSessionNotFound is returned for a usage report of a session that is not accounted.
+var ErrSessionNotFound = errors.New("session not found")
+
+type Options struct {
+	Cache cache.Cache
+	// RefreshInterval is the interval of refreshing the duration of the active sessions in the
+	// usage records (default: 1m).
+	RefreshInterval time.Duration
+	// Clock returns the current time (default: time.Now), overridden in the tests.
+	Clock func() time.Time
+	// ErrorChannel, if set, receives the errors of the operator, and ErrorReporter the reconcile
+	// errors of the native controller.
+	ErrorChannel  chan error
+	ErrorReporter metrics.ErrorReporter
+	// Work, if set, tracks the requests queued for and being reconciled by the native
+	// controller, for the drains.
+	Work   *metrics.Work
+	Logger logr.Logger
+}
+
+// UsageRecord is the usage of a session.
+type UsageRecord struct {
+	Namespace       string     `json:"namespace"`
+	Name            string     `json:"name"`
+	GUTI            string     `json:"guti,omitempty"`
+	SessionID       int64      `json:"sessionId"`
+	Active          bool       `json:"active"`
+	StartTime       time.Time  `json:"startTime"`
+	EndTime         *time.Time `json:"endTime,omitempty"`
+	Duration        string     `json:"duration"`
+	DurationSeconds int64      `json:"durationSeconds"`
+	UplinkBytes     int64      `json:"uplinkBytes"`
+	DownlinkBytes   int64      `json:"downlinkBytes"`
+}
+
+type CHF struct {
+	*operator.Operator
+	c *accountingController
+}
+
+func New(apiServer *apiserver.APIServer, opts Options) (*CHF, error) {
+	errorChan := opts.ErrorChannel
+	if errorChan == nil {
+		errorChan = make(chan error, 16)
+	}
+	op, err := operator.New(OperatorName, nil, operator.Options{
+		Cache:        opts.Cache,
+		APIServer:    apiServer,
+		ErrorChannel: errorChan,
+		Logger:       opts.Logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manager for operator CHF: %w", err)
+	}
+
+	c, err := newAccountingController(op.GetManager(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the native controller to the operator and export the GVKs to the API server.
+	op.AddNativeController("accounting-ctrl", c.ctrl, c.gvks)
+	if err := op.RegisterGVKs(); err != nil {
+		return nil, err
+	}
+
+	return &CHF{Operator: op, c: c}, nil
+}
+
+// ReportUsage is the reporting hook of the data path: it adds the bytes transferred by a session
+// since the last report to its usage record.
+func (c *CHF) ReportUsage(ctx context.Context, session client.ObjectKey, uplinkBytes, downlinkBytes int64) error {
+	return c.c.report(ctx, session, uplinkBytes, downlinkBytes)
+}
+
+// UsageRecords returns the usage records of the sessions of a UE, or of all the UEs if the
+// namespace is empty, ordered by the namespace and the name.
+func (c *CHF) UsageRecords(ctx context.Context, namespace string) ([]UsageRecord, error) {
+	list := cache.NewViewObjectList(OperatorName, usageRecordKind)
+	opts := []client.ListOption{}
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	if err := c.c.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+
+	records := make([]UsageRecord, 0, len(list.Items))
+	for i := range list.Items {
+		rec, err := toUsageRecord(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Namespace != records[j].Namespace {
+			return records[i].Namespace < records[j].Namespace
+		}
+		return records[i].Name < records[j].Name
+	})
+	return records, nil
+}
+
+// usage is the accounted usage of a session.
+type usage struct {
+	guti                       string
+	sessionID                  int64
+	start                      time.Time
+	end                        *time.Time
+	uplinkBytes, downlinkBytes int64
+}
+
+func (u *usage) spec(now time.Time) map[string]any {
+	end := now
+	if u.end != nil {
+		end = *u.end
+	}
+	d := end.Sub(u.start).Truncate(time.Second)
+	spec := map[string]any{
+		"guti":            u.guti,
+		"sessionId":       u.sessionID,
+		"active":          u.end == nil,
+		"startTime":       u.start.Format(time.RFC3339),
+		"duration":        d.String(),
+		"durationSeconds": int64(d / time.Second),
+		"uplinkBytes":     u.uplinkBytes,
+		"downlinkBytes":   u.downlinkBytes,
+	}
+	if u.end != nil {
+		spec["endTime"] = u.end.Format(time.RFC3339)
+	}
+	return spec
+}
+
+// accountingController accounts the usage of the session contexts.
+type accountingController struct {
+	client.Client
+	clock    func() time.Time
+	interval time.Duration
+	ctrl     dcontroller.RuntimeController
+	gvks     []schema.GroupVersionKind
+	mu       sync.Mutex
+	sessions map[client.ObjectKey]*usage
+	log      logr.Logger
+}
+
+func newAccountingController(mgr manager.Manager, opts Options) (*accountingController, error) {
+	r := &accountingController{
+		Client:   opts.Cache.(*cache.ViewCache).GetClient(),
+		clock:    opts.Clock,
+		interval: opts.RefreshInterval,
+		gvks:     []schema.GroupVersionKind{},
+		sessions: map[client.ObjectKey]*usage{},
+		log:      opts.Logger.WithName("chf-accounting"),
+	}
+	if r.clock == nil {
+		r.clock = time.Now
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultRefreshInterval
+	}
+
+	on := true
+	c, err := controller.NewTyped(accountingControllerName, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler: opts.Work.TrackReconciler(metrics.ReportErrors(accountingControllerName,
+			metrics.InstrumentReconciler(OperatorName, r), opts.ErrorReporter)),
+		NewQueue: opts.Work.NewQueue(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.ctrl = c
+
+	// the usage records are watched to restore the records of the active sessions if deleted
+	smfGroup := smfOperatorName + ".view.dcontroller.io"
+	for _, res := range []opv1a1.Resource{
+		{Group: &smfGroup, Kind: sessionContextKind},
+		{Kind: usageRecordKind},
+	} {
+		s := reconciler.NewSource(mgr, OperatorName, opv1a1.Source{Resource: res})
+		gvk, err := s.GetGVK()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GVK for source: %w", err)
+		}
+		// only the usage records are served by the CHF
+		if res.Group == nil {
+			r.gvks = append(r.gvks, gvk)
+		}
+
+		src, err := s.GetSource()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create source: %w", err)
+		}
+
+		if err := c.Watch(src); err != nil {
+			return nil, fmt.Errorf("failed to create watch: %w", err)
+		}
+	}
+
+	if err := mgr.Add(runtimeManager.RunnableFunc(r.refreshLoop)); err != nil {
+		return nil, fmt.Errorf("failed to add usage refresher: %w", err)
+	}
+
+	r.log.Info("created CHF accounting controller")
+
+	return r, nil
+}
+
+func (r *accountingController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	r.log.V(2).Info("Reconciling", "request", req.String())
+
+	key := client.ObjectKeyFromObject(req.Object)
+
+	if req.GVK.Kind == usageRecordKind {
+		// restore the record of an active session
+		if req.EventType != object.Deleted {
+			return reconcile.Result{}, nil
+		}
+		r.mu.Lock()
+		u, ok := r.sessions[key]
+		var spec map[string]any
+		if ok {
+			spec = u.spec(r.clock())
+		}
+		r.mu.Unlock()
+		if !ok {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, r.write(ctx, key, spec)
+	}
+
+	now := r.clock()
+	r.mu.Lock()
+	u, ok := r.sessions[key]
+	if req.EventType == object.Deleted {
+		if !ok {
+			r.mu.Unlock()
+			return reconcile.Result{}, nil
+		}
+		// keep the final record
+		u.end = &now
+		delete(r.sessions, key)
+	} else if !ok {
+		u = &usage{start: now}
+		u.guti, _, _ = unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "guti")
+		u.sessionID, _, _ = unstructured.NestedInt64(req.Object.UnstructuredContent(), "spec", "sessionId")
+		r.sessions[key] = u
+		r.log.V(1).Info("accounting session", "session", key.String())
+	} else {
+		r.mu.Unlock()
+		return reconcile.Result{}, nil
+	}
+	spec := u.spec(now)
+	r.mu.Unlock()
+
+	return reconcile.Result{}, r.write(ctx, key, spec)
+}
+
+// refreshLoop refreshes the duration of the active sessions until the context is cancelled.
+func (r *accountingController) refreshLoop(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.refresh(ctx)
+		}
+	}
+}
+
+// refresh writes the usage records of the active sessions.
+func (r *accountingController) refresh(ctx context.Context) {
+	now := r.clock()
+	r.mu.Lock()
+	specs := make(map[client.ObjectKey]map[string]any, len(r.sessions))
+	for key, u := range r.sessions {
+		specs[key] = u.spec(now)
+	}
+	r.mu.Unlock()
+
+	for key, spec := range specs {
+		if err := r.write(ctx, key, spec); err != nil {
+			r.log.Error(err, "failed to refresh usage record", "session", key.String())
+		}
+	}
+}
+
+// report adds the bytes reported for a session to its usage record.
+func (r *accountingController) report(ctx context.Context, key client.ObjectKey, uplinkBytes, downlinkBytes int64) error {
+	if uplinkBytes < 0 || downlinkBytes < 0 {
+		return fmt.Errorf("invalid usage report for session %s: negative byte count", key)
+	}
+
+	r.mu.Lock()
+	u, ok := r.sessions[key]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, key)
+	}
+	u.uplinkBytes += uplinkBytes
+	u.downlinkBytes += downlinkBytes
+	spec := u.spec(r.clock())
+	r.mu.Unlock()
+
+	return r.write(ctx, key, spec)
+}
+
+// write creates or updates the usage record of a session.
+func (r *accountingController) write(ctx context.Context, key client.ObjectKey, spec map[string]any) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject(OperatorName, usageRecordKind)
+		if err := r.Get(ctx, key, obj); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			obj = object.NewViewObject(OperatorName, usageRecordKind)
+			object.SetName(obj, key.Namespace, key.Name)
+			if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+				return err
+			}
+			return r.Create(ctx, obj)
+		}
+
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+			return err
+		}
+		return r.Update(ctx, obj)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write usage record %s: %w", key, err)
+	}
+	return nil
+}
+
+func toUsageRecord(obj object.Object) (UsageRecord, error) {
+	spec, _, _ := unstructured.NestedMap(obj.UnstructuredContent(), "spec")
+	rec := UsageRecord{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	rec.GUTI, _, _ = unstructured.NestedString(spec, "guti")
+	rec.SessionID, _, _ = unstructured.NestedInt64(spec, "sessionId")
+	rec.Active, _, _ = unstructured.NestedBool(spec, "active")
+	rec.Duration, _, _ = unstructured.NestedString(spec, "duration")
+	rec.DurationSeconds, _, _ = unstructured.NestedInt64(spec, "durationSeconds")
+	rec.UplinkBytes, _, _ = unstructured.NestedInt64(spec, "uplinkBytes")
+	rec.DownlinkBytes, _, _ = unstructured.NestedInt64(spec, "downlinkBytes")
+
+	start, _, _ := unstructured.NestedString(spec, "startTime")
+	t, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return UsageRecord{}, fmt.Errorf("invalid usage record %s/%s: %w", rec.Namespace, rec.Name, err)
+	}
+	rec.StartTime = t
+	if end, ok, _ := unstructured.NestedString(spec, "endTime"); ok {
+		t, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			return UsageRecord{}, fmt.Errorf("invalid usage record %s/%s: %w", rec.Namespace, rec.Name, err)
+		}
+		rec.EndTime = &t
+	}
+	return rec, nil
+}
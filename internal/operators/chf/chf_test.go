@@ -0,0 +1,189 @@
+package chf
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/l7mp/dcontroller/pkg/apiserver"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+)
+
+const (
+	timeout  = time.Second * 5
+	interval = time.Millisecond * 50
+)
+
+var (
+	loglevel = -10
+	logger   = zap.New(zap.UseFlagOptions(&zap.Options{
+		Development:     true,
+		DestWriter:      GinkgoWriter,
+		StacktraceLevel: zapcore.Level(3),
+		TimeEncoder:     zapcore.RFC3339NanoTimeEncoder,
+		Level:           zapcore.Level(loglevel),
+	}))
+)
+
+func TestCHF(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "5G CHF")
+}
+
+// fakeClock is a clock advanced by the tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var _ = Describe("CHF usage accounting", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.WithWatch
+		chf    *CHF
+		clock  *fakeClock
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		clock = &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+		chf, c = startCHF(ctx, Options{RefreshInterval: 20 * time.Millisecond, Clock: clock.Now})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	session := client.ObjectKey{Namespace: "user-1", Name: "session-1"}
+
+	// record returns a poller for the usage record of the session
+	record := func() *UsageRecord {
+		recs, err := chf.UsageRecords(ctx, session.Namespace)
+		if err != nil || len(recs) != 1 {
+			return nil
+		}
+		return &recs[0]
+	}
+
+	createSession := func() {
+		sc := object.NewViewObject(smfOperatorName, sessionContextKind)
+		object.SetName(sc, session.Namespace, session.Name)
+		Expect(unstructured.SetNestedMap(sc.UnstructuredContent(), map[string]any{
+			"guti":      "test-guti",
+			"nssai":     "eMBB",
+			"sessionId": int64(1),
+		}, "spec")).To(Succeed())
+		Expect(c.Create(ctx, sc)).To(Succeed())
+	}
+
+	It("should accrue the duration of a session", func() {
+		createSession()
+		Eventually(record, timeout, interval).ShouldNot(BeNil())
+		rec := record()
+		Expect(rec.Active).To(BeTrue())
+		Expect(rec.GUTI).To(Equal("test-guti"))
+		Expect(rec.SessionID).To(Equal(int64(1)))
+		Expect(rec.StartTime).To(BeTemporally("==", clock.Now()))
+
+		clock.Advance(90 * time.Second)
+		Eventually(func() int64 {
+			rec := record()
+			if rec == nil {
+				return 0
+			}
+			return rec.DurationSeconds
+		}, timeout, interval).Should(Equal(int64(90)))
+		Expect(record().Duration).To(Equal("1m30s"))
+
+		// the reported bytes are added up
+		Expect(chf.ReportUsage(ctx, session, 100, 1000)).To(Succeed())
+		Expect(chf.ReportUsage(ctx, session, 24, 3096)).To(Succeed())
+		Eventually(func() []int64 {
+			rec := record()
+			if rec == nil {
+				return nil
+			}
+			return []int64{rec.UplinkBytes, rec.DownlinkBytes}
+		}, timeout, interval).Should(Equal([]int64{124, 4096}))
+
+		// the record is closed with the session
+		clock.Advance(30 * time.Second)
+		sc := object.NewViewObject(smfOperatorName, sessionContextKind)
+		object.SetName(sc, session.Namespace, session.Name)
+		Expect(c.Delete(ctx, sc)).To(Succeed())
+		Eventually(func() bool {
+			rec := record()
+			return rec != nil && !rec.Active
+		}, timeout, interval).Should(BeTrue())
+		rec = record()
+		Expect(rec.DurationSeconds).To(Equal(int64(120)))
+		Expect(rec.EndTime).NotTo(BeNil())
+
+		// no further accounting
+		clock.Advance(time.Minute)
+		Consistently(func() int64 { return record().DurationSeconds }, 200*time.Millisecond, interval).
+			Should(Equal(int64(120)))
+		Expect(chf.ReportUsage(ctx, session, 1, 1)).To(MatchError(ErrSessionNotFound))
+	})
+})
+
+// startCHF starts the CHF and returns the operator along with the client.
+func startCHF(ctx context.Context, opts Options) (*CHF, client.WithWatch) {
+	sharedCache := cache.NewViewCache(cache.CacheOptions{Logger: logger})
+
+	apiServerConfig, err := apiserver.NewDefaultConfig("localhost", randomPort(), sharedCache.GetClient(),
+		true, false, logger)
+	Expect(err).NotTo(HaveOccurred())
+	apiServer, err := apiserver.NewAPIServer(apiServerConfig)
+	Expect(err).NotTo(HaveOccurred())
+
+	opts.Cache = sharedCache
+	opts.Logger = logger
+	chf, err := New(apiServer, opts)
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() {
+		defer GinkgoRecover()
+		err := chf.Start(ctx) // will start the view cache
+		Expect(err).NotTo(HaveOccurred())
+	}()
+
+	return chf, sharedCache.GetClient()
+}
+
+func randomPort() int {
+	const minPort = 49152
+	const maxPort = 65535
+	n, err := rand.Int(rand.Reader, big.NewInt(maxPort-minPort+1))
+	if err != nil {
+		return 0
+	}
+	return int(n.Int64()) + minPort
+}
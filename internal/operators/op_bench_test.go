@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -18,14 +19,20 @@ import (
 )
 
 func initBenchSuite(b *testing.B, ctx context.Context) {
+	initBenchSuiteWithOptions(b, ctx, dctrl.Options{})
+}
+
+// initBenchSuiteWithOptions starts the operators with custom options.
+func initBenchSuiteWithOptions(b *testing.B, ctx context.Context, opts dctrl.Options) *dctrl.Dctrl {
 	ctrl.SetLogger(logger.WithName("dctrl5g-bench"))
-	d, err := testsuite.StartOps(ctx, []dctrl.OpSpec{
+	opts.OpSpecs = []dctrl.OpSpec{
 		{Name: "amf", File: "amf.yaml"},
 		{Name: "ausf", File: "ausf.yaml"},
 		{Name: "smf", File: "smf.yaml"},
 		{Name: "pcf", File: "pcf.yaml"},
 		{Name: "upf", File: "upf.yaml"},
-	}, 0, 0)
+	}
+	d, err := testsuite.StartOpsWithOptions(ctx, opts, 0)
 	if err != nil {
 		b.Fatalf("failed to start operators: %v", err)
 	}
@@ -38,6 +45,10 @@ func initBenchSuite(b *testing.B, ctx context.Context) {
 
 	timeout = time.Second * 20
 	interval = time.Millisecond * 50
+	create = func(ctx context.Context, c client.Client, obj client.Object) error {
+		return c.Create(ctx, obj)
+	}
+	return d
 }
 
 // BenchmarkRegistration benchmarks the registration process by creating multiple
@@ -308,6 +319,43 @@ func BenchmarkRegistrationParallel(b *testing.B) {
 	b.StopTimer()
 }
 
+// BenchmarkRegistrationTokenPool compares the latency of bursts of registrations with and
+// without the warm pool of UE tokens in the UDM.
+func BenchmarkRegistrationTokenPool(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		size int
+	}{{"disabled", 0}, {"pool", 64}} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d := initBenchSuiteWithOptions(b, ctx, dctrl.Options{UETokenPoolSize: bc.size})
+
+			var regCounter atomic.Int64
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := regCounter.Add(1)
+					name := fmt.Sprintf("bench-pool-user-%d", i)
+					// Reuse the same SUCI as uniqueness is not checked.
+					if _, err := initRegErr(ctx, name, name, "suci-0-999-01-02-4f2a7b9c8d13e7a5c0",
+						statusCond{"Ready", "True"}); err != nil {
+						b.Errorf("failed to initialize registration %d: %v", i, err)
+						return
+					}
+				}
+			})
+
+			b.StopTimer()
+			if hits, misses := d.TokenPoolStats(); hits+misses > 0 {
+				b.ReportMetric(float64(hits)/float64(hits+misses), "pool-hits/op")
+			}
+		})
+	}
+}
+
 // BenchmarkSession benchmarks the session establishment process.
 func BenchmarkSession(b *testing.B) {
 	// Setup
@@ -14,6 +14,8 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
+
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
 )
 
 const (
@@ -27,6 +29,9 @@ var (
 	interval = time.Millisecond * 50
 	logger   logr.Logger
 	c        client.WithWatch
+	// create creates the test objects, retrying the transient failures of the warm-up; the
+	// benchmarks create without retries.
+	create = testsuite.CreateWithRetry
 )
 
 type statusCond struct{ name, status string }
@@ -100,7 +105,7 @@ func initRegErr(ctx context.Context, name, namespace, suci string, conds ...stat
 		return nil, fmt.Errorf("failed to unmarshal registration YAML: %w", err)
 	}
 
-	if err := c.Create(ctx, reg1); err != nil {
+	if err := create(ctx, c, reg1); err != nil {
 		return nil, fmt.Errorf("failed to create registration: %w", err)
 	}
 
@@ -224,7 +229,7 @@ func initSessionErr(ctx context.Context, name, namespace, guti string, id int, c
 		return nil, fmt.Errorf("failed to unmarshal session YAML: %w", err)
 	}
 
-	if err := c.Create(ctx, sess1); err != nil {
+	if err := create(ctx, c, sess1); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
@@ -352,7 +357,7 @@ func initSessionContextErr(ctx context.Context, name, namespace, guti string, id
 		return nil, fmt.Errorf("failed to unmarshal session context YAML: %w", err)
 	}
 
-	if err := c.Create(ctx, sess1); err != nil {
+	if err := create(ctx, c, sess1); err != nil {
 		return nil, fmt.Errorf("failed to create session context: %w", err)
 	}
 
@@ -429,7 +434,7 @@ func initContextReleaseErr(ctx context.Context, name, namespace, guti string, se
 		return nil, fmt.Errorf("failed to unmarshal context release YAML: %w", err)
 	}
 
-	if err := c.Create(ctx, ctxRel); err != nil {
+	if err := create(ctx, c, ctxRel); err != nil {
 		return nil, fmt.Errorf("failed to create context release: %w", err)
 	}
 
@@ -3,6 +3,7 @@ package operators
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -19,6 +20,7 @@ import (
 	"github.com/l7mp/dcontroller/pkg/operator"
 
 	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
 )
 
 var _ = Describe("SMF Operator", func() {
@@ -213,6 +215,235 @@ var _ = Describe("SMF Operator", func() {
 		})
 	})
 
+	Context("When enforcing the UE-AMBR of the PCF", Label("smf"), func() {
+		It("should cap the flows to the UE-AMBR", func() {
+			setUEAMBR(ctx, 100)
+
+			retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				statusCond{"policy", "True"})
+			Expect(retrieved).NotTo(BeNil())
+
+			flows, ok, err := unstructured.NestedSlice(retrieved.UnstructuredContent(),
+				"status", "qos", "flows")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(flows).To(ContainElement(map[string]any{
+				"bitRates": map[string]any{
+					"downlinkBwKbps": int64(100),
+					"uplinkBwKbps":   int64(100),
+				},
+				"fiveQI": "ConversationalVoice",
+				"name":   "voice-flow",
+			}))
+			ambrCap, _, err := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "qos", "ambrCap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ambrCap).To(Equal(map[string]any{"uplinkKbps": int64(100), "downlinkKbps": int64(100)}))
+		})
+	})
+
+	Context("When the PCF rejects a flow", Label("smf"), func() {
+		It("should fail the policy with the reason of the PCF", func() {
+			reason := "Voice is not part of the subscribed service profile"
+			setRejectedFlows(ctx, map[string]any{"fiveQI": "ConversationalVoice", "reason": reason})
+
+			// the session context requests a voice flow
+			retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				statusCond{"policy", "False"})
+			Expect(retrieved).NotTo(BeNil())
+
+			cs, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "conditions", "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(cs["reason"]).To(Equal("PolicyRejected"))
+			Expect(cs["message"]).To(Equal(reason))
+
+			// no UPF config for a rejected session
+			upfConfig := object.NewViewObject("upf", "Config")
+			object.SetName(upfConfig, "user-1", "user-1")
+			Consistently(func() bool {
+				return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(upfConfig), upfConfig))
+			}, retryInterval*5, interval).Should(BeTrue())
+		})
+	})
+
+	Context("When a session specifies no session AMBR", Label("smf"), func() {
+		It("should inherit the session AMBR default of the subscription", func() {
+			yamlData := `
+apiVersion: udm.view.dcontroller.io/v1alpha1
+kind: Subscription
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  sessionAmbr:
+    uplinkKbps: 256
+    downlinkKbps: 512`
+			sub := object.New()
+			Expect(yaml.Unmarshal([]byte(yamlData), &sub)).To(Succeed())
+			Expect(testsuite.CreateWithRetry(ctx, c, sub)).To(Succeed())
+
+			retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				statusCond{"policy", "True"}, statusCond{"upf", "True"})
+			Expect(retrieved).NotTo(BeNil())
+
+			ambr := map[string]any{"uplinkKbps": int64(256), "downlinkKbps": int64(512)}
+			Eventually(func() map[string]any {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+					return nil
+				}
+				s, _, _ := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "sessionAmbr")
+				return s
+			}, timeout, interval).Should(Equal(ambr))
+
+			// the default is reflected in the UPF config
+			upfConfig := object.NewViewObject("upf", "Config")
+			object.SetName(upfConfig, "user-1", "user-1")
+			Eventually(func() map[string]any {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(upfConfig), upfConfig); err != nil {
+					return nil
+				}
+				s, _, _ := unstructured.NestedMap(upfConfig.UnstructuredContent(), "spec", "sessionAmbr")
+				return s
+			}, timeout, interval).Should(Equal(ambr))
+		})
+	})
+
+	Context("When enforcing the subscribed UE-AMBR", Label("smf"), func() {
+		It("should leave a session under the subscribed UE-AMBR alone", func() {
+			createSubscribedAmbr(ctx, "user-1", 1000, 1000)
+			waitSubscribedAmbr(ctx, "user-1")
+
+			retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				statusCond{"validated", "True"}, statusCond{"policy", "True"})
+
+			flows, _, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "qos", "flows")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(flows).To(ContainElement(HaveKeyWithValue("bitRates", map[string]any{
+				"downlinkBwKbps": int64(128),
+				"uplinkBwKbps":   int64(128),
+			})))
+			ambrCap, _, err := unstructured.NestedFieldNoCopy(retrieved.UnstructuredContent(), "status", "qos", "ambrCap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ambrCap).To(BeNil())
+		})
+
+		It("should cap a session over the subscribed UE-AMBR", func() {
+			createSubscribedAmbr(ctx, "user-1", 64, 96)
+			waitSubscribedAmbr(ctx, "user-1")
+
+			retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				statusCond{"validated", "True"}, statusCond{"policy", "True"})
+
+			ambr := map[string]any{"uplinkKbps": int64(64), "downlinkKbps": int64(96)}
+			Eventually(func() map[string]any {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+					return nil
+				}
+				s, _, _ := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "qos", "ambrCap")
+				return s
+			}, timeout, interval).Should(Equal(ambr))
+
+			flows, _, err := unstructured.NestedSlice(retrieved.UnstructuredContent(), "status", "qos", "flows")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(flows).To(ContainElement(map[string]any{
+				"bitRates": map[string]any{
+					"downlinkBwKbps": int64(96),
+					"uplinkBwKbps":   int64(64),
+				},
+				"fiveQI": "ConversationalVoice",
+				"name":   "voice-flow",
+			}))
+			sessionAmbr, _, err := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "sessionAmbr")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sessionAmbr).To(Equal(ambr))
+
+			// the cap is kept across the reconciles of the capped session
+			Consistently(func() map[string]any {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+					return nil
+				}
+				s, _, _ := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "qos", "ambrCap")
+				return s
+			}, retryInterval*5, interval).Should(Equal(ambr))
+		})
+	})
+
+	Context("When requesting the PDU session types", Label("smf"), func() {
+		It("should allocate an IPv6 address for an IPv6 session", func() {
+			retrieved := initSessionContextOfType(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				"IPv6", statusCond{"policy", "True"}, statusCond{"upf", "True"})
+
+			ip, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "networkConfiguration", "ipConfiguration")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(ip).NotTo(HaveKey("ipAddress"))
+			Expect(ip["ipv6Address"]).To(HavePrefix("2001:db8:45::"))
+			Expect(ip["ipv6Prefix"]).To(Equal("2001:db8:45::/64"))
+			Expect(ip["ipv6DefaultGateway"]).To(Equal("2001:db8:45::1"))
+
+			dns, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "networkConfiguration", "dnsConfiguration")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(dns["primaryDNS"]).To(Equal("2001:4860:4860::8888"))
+
+			// the UPF config carries the IPv6 address
+			upfConfig := object.NewViewObject("upf", "Config")
+			object.SetName(upfConfig, "user-1", "user-1")
+			Eventually(func() any {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(upfConfig), upfConfig); err != nil {
+					return nil
+				}
+				a, _, _ := unstructured.NestedFieldNoCopy(upfConfig.UnstructuredContent(),
+					"spec", "networkConfiguration", "ipConfiguration", "ipv6Address")
+				return a
+			}, timeout, interval).Should(Equal(ip["ipv6Address"]))
+		})
+
+		It("should allocate both an IPv4 and an IPv6 address for a dual-stack session", func() {
+			retrieved := initSessionContextOfType(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				"IPv4v6", statusCond{"policy", "True"}, statusCond{"upf", "True"})
+
+			ip, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "networkConfiguration", "ipConfiguration")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(ip["ipAddress"]).To(HavePrefix("10.45.0."))
+			Expect(ip["subnetMask"]).To(Equal("255.255.0.0"))
+			Expect(ip["ipv6Address"]).To(HavePrefix("2001:db8:45::"))
+			Expect(ip["ipv6Prefix"]).To(Equal("2001:db8:45::/64"))
+
+			upfConfig := object.NewViewObject("upf", "Config")
+			object.SetName(upfConfig, "user-1", "user-1")
+			Eventually(func() map[string]any {
+				if err := c.Get(ctx, client.ObjectKeyFromObject(upfConfig), upfConfig); err != nil {
+					return nil
+				}
+				m, _, _ := unstructured.NestedMap(upfConfig.UnstructuredContent(),
+					"spec", "networkConfiguration", "ipConfiguration")
+				return m
+			}, timeout, interval).Should(And(
+				HaveKeyWithValue("ipAddress", ip["ipAddress"]),
+				HaveKeyWithValue("ipv6Address", ip["ipv6Address"])))
+		})
+
+		It("should allocate the addresses from the configured address pool", func() {
+			setIPv6Prefix(ctx, "2001:db8:99::")
+
+			retrieved := initSessionContextOfType(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+				"IPv6", statusCond{"policy", "True"})
+
+			ip, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "networkConfiguration", "ipConfiguration")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(ip["ipv6Address"]).To(HavePrefix("2001:db8:99::"))
+			Expect(ip["ipv6Prefix"]).To(Equal("2001:db8:99::/64"))
+		})
+	})
+
 	Context("When initiating an active->idle->active status transition", Ordered, Label("smf"), func() {
 		It("should let a session to be idled", func() {
 			retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
@@ -335,3 +566,221 @@ spec:
 		})
 	})
 })
+
+var _ = Describe("SMF Operator with the reject subscribed AMBR policy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+			OpSpecs: []dctrl.OpSpec{
+				{Name: "smf", File: "smf.yaml"},
+				{Name: "pcf", File: "pcf.yaml"},
+			},
+			SubscribedAmbrPolicy: udm.AmbrReject,
+		}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = d.GetCache().GetClient()
+		Expect(c).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should reject a session over the subscribed UE-AMBR", Label("smf"), func() {
+		createSubscribedAmbr(ctx, "user-1", 64, 96)
+		waitSubscribedAmbr(ctx, "user-1")
+
+		retrieved := initSessionContext(ctx, "user-1", "user-1", "guti-310-170-3F-152-2A-B7C8D9E0", 5,
+			statusCond{"validated", "False"})
+
+		cs, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(), "status", "conditions", "validated")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(cs["reason"]).To(Equal("AmbrExceeded"))
+		qos, _, err := unstructured.NestedFieldNoCopy(retrieved.UnstructuredContent(), "status", "qos")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(qos).To(BeNil())
+
+		// no UPF config for a rejected session
+		upfConfig := object.NewViewObject("upf", "Config")
+		object.SetName(upfConfig, "user-1", "user-1")
+		Consistently(func() bool {
+			return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(upfConfig), upfConfig))
+		}, retryInterval*5, interval).Should(BeTrue())
+	})
+	It("should reject a session over the UE-AMBR of the PCF", Label("smf"), func() {
+		setUEAMBR(ctx, 200)
+
+		// two voice flows, each clamped to 128 kbps, add up to 256 kbps
+		sess := object.New()
+		yamlData := fmt.Sprintf(sessionContextTemplate, "user-1", "user-1",
+			"guti-310-170-3F-152-2A-B7C8D9E0", 5)
+		Expect(yaml.Unmarshal([]byte(yamlData), &sess)).To(Succeed())
+		flows, _, err := unstructured.NestedSlice(sess.UnstructuredContent(), "spec", "qos", "flows")
+		Expect(err).NotTo(HaveOccurred())
+		flows = append(flows, map[string]any{
+			"name":     "voice-flow-2",
+			"fiveQI":   "ConversationalVoice",
+			"bitRates": map[string]any{"uplinkBwKbps": int64(256), "downlinkBwKbps": int64(256)},
+		})
+		Expect(unstructured.SetNestedSlice(sess.UnstructuredContent(), flows, "spec", "qos", "flows")).
+			To(Succeed())
+		Expect(c.Create(ctx, sess)).To(Succeed())
+
+		retrieved := object.NewViewObject("smf", "SessionContext")
+		object.SetName(retrieved, "user-1", "user-1")
+		Eventually(func() bool {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+				return false
+			}
+			cs, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "conditions", "validated")
+			return err == nil && ok && cs["status"] == "False" && cs["reason"] == "AmbrExceeded"
+		}, timeout, interval).Should(BeTrue())
+
+		// no UPF config for a rejected session
+		upfConfig := object.NewViewObject("upf", "Config")
+		object.SetName(upfConfig, "user-1", "user-1")
+		Consistently(func() bool {
+			return apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(upfConfig), upfConfig))
+		}, retryInterval*5, interval).Should(BeTrue())
+	})
+})
+
+// createSubscribedAmbr creates the subscription profile of a user with the given UE-AMBR.
+func createSubscribedAmbr(ctx context.Context, user string, uplinkKbps, downlinkKbps int64) {
+	GinkgoHelper()
+
+	sub := object.New()
+	Expect(yaml.Unmarshal([]byte(fmt.Sprintf(`
+apiVersion: udm.view.dcontroller.io/v1alpha1
+kind: Subscription
+metadata:
+  name: %[1]s
+  namespace: %[1]s
+spec:
+  ueAmbr:
+    uplinkKbps: %[2]d
+    downlinkKbps: %[3]d`, user, uplinkKbps, downlinkKbps)), &sub)).To(Succeed())
+	Expect(testsuite.CreateWithRetry(ctx, c, sub)).To(Succeed())
+}
+
+// waitSubscribedAmbr waits until the UE-AMBR of a user makes it to the SMF subscribed AMBR table.
+func waitSubscribedAmbr(ctx context.Context, user string) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("smf", "SubscribedAmbrTable")
+	object.SetName(table, "", "subscribed-ambr")
+	Eventually(func() []any {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return nil
+		}
+		subs, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "subscribers")
+		return subs
+	}, timeout, interval).Should(ContainElement(HaveKeyWithValue("user", user)))
+}
+
+// setUEAMBR sets the uplink and downlink UE-AMBR in the PCF policy table.
+func setUEAMBR(ctx context.Context, kbps int64) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("pcf", "PolicyTable")
+	object.SetName(table, "", "policy-table")
+	Eventually(func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(table.UnstructuredContent(), kbps,
+			"spec", "ueAmbrUplinkKbps"); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(table.UnstructuredContent(), kbps,
+			"spec", "ueAmbrDownlinkKbps"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	}, timeout, interval).Should(Succeed())
+}
+
+// setRejectedFlows sets the flows rejected by the PCF in the policy table.
+func setRejectedFlows(ctx context.Context, flows ...any) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("pcf", "PolicyTable")
+	object.SetName(table, "", "policy-table")
+	Eventually(func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), flows,
+			"spec", "rejectedFlows"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	}, timeout, interval).Should(Succeed())
+}
+
+// initSessionContextOfType creates a session context with the given PDU session type and address
+// family and waits until the status conditions are satisfied.
+func initSessionContextOfType(ctx context.Context, name, namespace, guti string, id int, pduType string, conds ...statusCond) object.Object {
+	GinkgoHelper()
+
+	sess := object.New()
+	yamlData := fmt.Sprintf(sessionContextTemplate, name, namespace, guti, id)
+	Expect(yaml.Unmarshal([]byte(yamlData), &sess)).To(Succeed())
+	Expect(unstructured.SetNestedField(sess.UnstructuredContent(), pduType, "spec", "pduSessionType")).
+		To(Succeed())
+	family := pduType
+	if family == "IPv4v6" {
+		family = "IPv6"
+	}
+	reqs := []any{
+		map[string]any{"type": "IPConfiguration", "addressFamily": family},
+		map[string]any{"type": "DNSServer", "addressFamily": family},
+	}
+	Expect(unstructured.SetNestedSlice(sess.UnstructuredContent(), reqs,
+		"spec", "networkConfiguration", "requests")).To(Succeed())
+	Expect(testsuite.CreateWithRetry(ctx, c, sess)).To(Succeed())
+
+	retrieved := object.NewViewObject("smf", "SessionContext")
+	object.SetName(retrieved, namespace, name)
+	Eventually(func() bool {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(retrieved), retrieved); err != nil {
+			return false
+		}
+		for _, cond := range conds {
+			cs, ok, err := unstructured.NestedMap(retrieved.UnstructuredContent(),
+				"status", "conditions", cond.name)
+			if err != nil || !ok || cs["status"] != cond.status {
+				return false
+			}
+		}
+		return true
+	}, timeout, interval).Should(BeTrue())
+
+	return retrieved
+}
+
+// setIPv6Prefix sets the prefix of the IPv6 address pool of the SMF.
+func setIPv6Prefix(ctx context.Context, prefix string) {
+	GinkgoHelper()
+
+	table := object.NewViewObject("smf", "AddressPoolTable")
+	object.SetName(table, "", "address-pool")
+	Eventually(func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(table.UnstructuredContent(), prefix,
+			"spec", "ipv6", "prefix"); err != nil {
+			return err
+		}
+		return c.Update(ctx, table)
+	}, timeout, interval).Should(Succeed())
+}
@@ -0,0 +1,127 @@
+package udm
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// DefaultTokenAuditRetention is the default time the audit records of deleted UEs are kept for.
+const DefaultTokenAuditRetention = 24 * time.Hour
+
+// auditPruneInterval is the interval the audit records of deleted UEs are pruned at.
+const auditPruneInterval = time.Minute
+
+// TokenAuditRecord is the audit record of the tokens issued to a UE.
+type TokenAuditRecord struct {
+	// User is the user the tokens were issued to.
+	User string `json:"user"`
+	// Issued is the number of tokens issued to the user.
+	Issued int `json:"issued"`
+	// LastIssued is the time the last token was issued.
+	LastIssued time.Time `json:"lastIssued"`
+	// Deleted is the time the UE was deleted, nil if the UE still exists.
+	Deleted *time.Time `json:"deleted,omitempty"`
+}
+
+// tokenAudit keeps the audit records of the issued tokens. Records of deleted UEs are retained
+// for the retention window and then pruned to bound the storage.
+type tokenAudit struct {
+	mu        sync.Mutex
+	retention time.Duration
+	records   map[string]*TokenAuditRecord
+	now       func() time.Time
+}
+
+func newTokenAudit(retention time.Duration) *tokenAudit {
+	if retention <= 0 {
+		retention = DefaultTokenAuditRetention
+	}
+	return &tokenAudit{
+		retention: retention,
+		records:   map[string]*TokenAuditRecord{},
+		now:       time.Now,
+	}
+}
+
+// issued records a token issued to a user.
+func (a *tokenAudit) issued(user string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rec, ok := a.records[user]
+	if !ok {
+		rec = &TokenAuditRecord{User: user}
+		a.records[user] = rec
+	}
+	rec.Issued++
+	rec.LastIssued = a.now()
+	rec.Deleted = nil
+}
+
+// deleted marks the record of a deleted UE, starting its retention window.
+func (a *tokenAudit) deleted(user string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if rec, ok := a.records[user]; ok && rec.Deleted == nil {
+		now := a.now()
+		rec.Deleted = &now
+	}
+}
+
+// prune removes the records of the UEs deleted before the retention window and returns the
+// number of records removed.
+func (a *tokenAudit) prune() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := a.now().Add(-a.retention)
+	n := 0
+	for user, rec := range a.records {
+		if rec.Deleted != nil && rec.Deleted.Before(cutoff) {
+			delete(a.records, user)
+			n++
+		}
+	}
+	return n
+}
+
+// list returns a copy of the records, sorted by user.
+func (a *tokenAudit) list() []TokenAuditRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	recs := make([]TokenAuditRecord, 0, len(a.records))
+	for _, rec := range a.records {
+		recs = append(recs, *rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].User < recs[j].User })
+	return recs
+}
+
+// GetTokenAudit returns the audit records of the tokens issued by the UDM.
+func (u *UDM) GetTokenAudit() []TokenAuditRecord {
+	return u.c.audit.list()
+}
+
+// addAuditPruner periodically prunes the audit records of the deleted UEs.
+func (r *udmController) addAuditPruner(mgr runtimeManager.Manager) error {
+	return mgr.Add(runtimeManager.RunnableFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(auditPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if n := r.audit.prune(); n > 0 {
+					r.log.V(1).Info("pruned token audit records", "records", n)
+				}
+			}
+		}
+	}))
+}
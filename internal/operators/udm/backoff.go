@@ -0,0 +1,59 @@
+package udm
+
+import (
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RetryBackoff is the backoff of retrying the configs the UDM failed to generate: the n-th retry
+// is requeued after Initial*Factor^(n-1), capped at Max.
+type RetryBackoff struct {
+	Initial, Max time.Duration
+	Factor       float64
+}
+
+// DefaultRetryBackoff is the default backoff of the failed config generations.
+var DefaultRetryBackoff = RetryBackoff{Initial: 100 * time.Millisecond, Max: 30 * time.Second, Factor: 2}
+
+// withDefaults returns the backoff with the unset fields defaulted.
+func (b RetryBackoff) withDefaults() RetryBackoff {
+	if b.Initial <= 0 {
+		b.Initial = DefaultRetryBackoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultRetryBackoff.Max
+	}
+	if b.Max < b.Initial {
+		b.Max = b.Initial
+	}
+	if b.Factor < 1 {
+		b.Factor = DefaultRetryBackoff.Factor
+	}
+	return b
+}
+
+// delay returns the requeue delay of the given retry, counted from 1.
+func (b RetryBackoff) delay(retry int) time.Duration {
+	d := float64(b.Initial)
+	for i := 1; i < retry && d < float64(b.Max); i++ {
+		d *= b.Factor
+	}
+	return min(time.Duration(d), b.Max)
+}
+
+// retried counts a failed config generation and returns the number of retries of the config so
+// far.
+func (r *udmController) retried(key client.ObjectKey) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries[key]++
+	return r.retries[key]
+}
+
+// resetRetries forgets the failed config generations of a config.
+func (r *udmController) resetRetries(key client.ObjectKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.retries, key)
+}
@@ -0,0 +1,53 @@
+package udm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+)
+
+// intersectNSSAI returns the S-NSSAIs of a requested NSSAI whose slice type is subscribed to, in
+// the order of the request. The S-NSSAIs are the {sliceType, sliceDifferentiator} maps of the
+// requestedNSSAI of a Registration.
+func intersectNSSAI(requested []any, subscribed []string) []any {
+	allowed := []any{}
+	for _, s := range requested {
+		snssai, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		if sliceType, ok := snssai["sliceType"].(string); ok && slices.Contains(subscribed, sliceType) {
+			allowed = append(allowed, snssai)
+		}
+	}
+	return allowed
+}
+
+// allowedNSSAI returns the allowed NSSAI of the UE of a config: the requested NSSAI in the spec of
+// the config is intersected with the slice types the subscriber of the SUPI of the UE is
+// subscribed to. The requested NSSAI is allowed as is if the SUPI has no subscriber record or the
+// record lists no slice types. Returns nil if the config requests no NSSAI.
+func (r *udmController) allowedNSSAI(ctx context.Context, obj object.Object) ([]any, error) {
+	requested, ok, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "spec", "requestedNSSAI")
+	if !ok {
+		return nil, nil
+	}
+	supi, _, _ := unstructured.NestedString(obj.UnstructuredContent(), "spec", "supi")
+	if r.store == nil || supi == "" {
+		return requested, nil
+	}
+
+	sub, err := r.store.Get(ctx, supi)
+	if errors.Is(err, ErrSubscriberNotFound) || (err == nil && len(sub.AllowedNSSAI) == 0) {
+		return requested, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscriber %q: %w", supi, err)
+	}
+	return intersectNSSAI(requested, sub.AllowedNSSAI), nil
+}
@@ -0,0 +1,51 @@
+package udm
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/correlation"
+)
+
+// RotateToken reissues the config of a UE with a fresh token and returns the token it replaces,
+// empty if the config had none. Revoking the returned token is up to the caller.
+func (u *UDM) RotateToken(ctx context.Context, key client.ObjectKey) (string, error) {
+	r := u.c
+	obj := object.NewViewObject(OperatorName, "Config")
+	if err := r.Get(ctx, key, obj); err != nil {
+		return "", fmt.Errorf("failed to get config %s: %w", key, err)
+	}
+	old := ConfigToken(obj)
+
+	config, err := r.getKubeConfig(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate config: %w", err)
+	}
+
+	// the allowed NSSAI does not change with the token
+	nssai, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "allowedNSSAI")
+	if err := r.setStatus(ctx, obj, "True", "Ready", "Successfully rotated token", config, nssai, 0); err != nil {
+		return "", fmt.Errorf("failed to update config %s: %w", key, err)
+	}
+
+	correlation.Logger(r.log, obj).Info("rotated token", "name", key.Name, "namespace", key.Namespace)
+	return old, nil
+}
+
+// ConfigToken returns the token in the kubeconfig of a Config, empty if none.
+func ConfigToken(obj object.Object) string {
+	users, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "config", "users")
+	for _, u := range users {
+		if user, ok := u.(map[string]any); ok {
+			if token, _, _ := unstructured.NestedString(user, "user", "token"); token != "" {
+				return token
+			}
+		}
+	}
+	return ""
+}
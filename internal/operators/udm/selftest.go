@@ -0,0 +1,102 @@
+package udm
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// DefaultTokenSelfTestInterval is the default interval of the token signing self-test.
+const DefaultTokenSelfTestInterval = time.Minute
+
+// selfTestUser is the user the self-test tokens are issued to.
+const selfTestUser = "udm-self-test"
+
+// SelfTestStatus is the result of the last token signing self-test.
+type SelfTestStatus struct {
+	// OK is true if the last self-test could issue and verify a token.
+	OK bool `json:"ok"`
+	// LastRun is the time of the last self-test, nil if none so far.
+	LastRun *time.Time `json:"lastRun,omitempty"`
+	// Error is the reason of the failure of the last self-test.
+	Error string `json:"error,omitempty"`
+}
+
+// GetTokenSelfTest returns the result of the last token signing self-test.
+func (u *UDM) GetTokenSelfTest() SelfTestStatus {
+	u.c.mu.Lock()
+	defer u.c.mu.Unlock()
+	return u.c.selfTest
+}
+
+// addSelfTest periodically issues a token with the signing key and verifies it against the
+// public key, so that a degraded signing path shows up before the UEs fail to register.
+func (r *udmController) addSelfTest(mgr runtimeManager.Manager, publicKey *rsa.PublicKey, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultTokenSelfTestInterval
+	}
+	verifier := jwks.NewAuthenticator(map[string]*rsa.PublicKey{r.generator.KeyID(): publicKey})
+
+	return mgr.Add(runtimeManager.RunnableFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.recordSelfTest(r.runSelfTest(verifier))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}))
+}
+
+func (r *udmController) runSelfTest(verifier *jwks.Authenticator) error {
+	token, err := r.generator.GenerateToken(selfTestUser, []string{selfTestUser}, nil, time.Minute)
+	if err != nil {
+		return fmt.Errorf("failed to issue token: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, ok, err := verifier.AuthenticateRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify token: %w", err)
+	}
+	if !ok || res.User.GetName() != selfTestUser {
+		return errors.New("failed to verify token: user mismatch")
+	}
+
+	return nil
+}
+
+func (r *udmController) recordSelfTest(err error) {
+	now := time.Now()
+	status := SelfTestStatus{OK: err == nil, LastRun: &now}
+	if err != nil {
+		status.Error = err.Error()
+		r.log.Error(err, "token signing self-test failed")
+	}
+
+	r.mu.Lock()
+	r.selfTest = status
+	r.mu.Unlock()
+
+	if status.OK {
+		metrics.TokenSelfTestSuccess.Set(1)
+	} else {
+		metrics.TokenSelfTestSuccess.Set(0)
+	}
+	metrics.TokenSelfTestTimestamp.Set(float64(now.UnixNano()) / 1e9)
+}
@@ -0,0 +1,267 @@
+package udm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	dcontroller "github.com/l7mp/dcontroller/pkg/controller"
+	"github.com/l7mp/dcontroller/pkg/manager"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/predicate"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// The AUSF table of the provisioned subscribers, which the AUSF resolves the mobile identities
+// against.
+const (
+	ausfOperatorName         = "ausf"
+	subscriberTableKind      = "SubscriberTable"
+	subscriberTableName      = "subscribers"
+	subscriberTableNamespace = "default"
+)
+
+// subscriberController provisions the subscriber records of the UEs from the udm/Subscriber
+// resources:
+//
+//	apiVersion: udm.view.dcontroller.io/v1alpha1
+//	kind: Subscriber
+//	metadata:
+//	  name: imsi-999010000000123
+//	  namespace: default
+//	spec:
+//	  supi: imsi-999010000000123
+//	  keyRef: imsi-999010000000123
+//	  allowedNSSAI: [eMBB]
+//	  defaultQosProfile: default
+//
+// The records are kept in the subscriber store, which is mirrored into the AUSF:SubscriberTable.
+// If provisioning is enforced, the AUSF resolves the mobile identities of the provisioned SUPIs
+// only, and the AMF fails the registrations of the other UEs with SupiNotFound.
+type subscriberController struct {
+	client.Client
+	store   SubscriberStore
+	enforce bool
+	ctrl    dcontroller.RuntimeController
+	gvks    []schema.GroupVersionKind
+	mu      sync.Mutex
+	supis   map[client.ObjectKey]string // the SUPI provisioned by each subscriber resource
+	log     logr.Logger
+}
+
+func newSubscriberController(mgr manager.Manager, opts Options) (*subscriberController, error) {
+	store := opts.SubscriberStore
+	if store == nil {
+		store = NewMemorySubscriberStore()
+	}
+	r := &subscriberController{
+		Client:  opts.Cache.(*cache.ViewCache).GetClient(),
+		store:   store,
+		enforce: opts.EnforceSubscribers,
+		gvks:    []schema.GroupVersionKind{},
+		supis:   map[client.ObjectKey]string{},
+		log:     opts.Logger.WithName("udm-subscriber-ctrl"),
+	}
+
+	on := true
+	c, err := controller.NewTyped(subscriberControllerName, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler: opts.Work.TrackReconciler(metrics.ReportErrors(subscriberControllerName,
+			metrics.InstrumentReconciler(OperatorName, r), opts.ErrorReporter)),
+		NewQueue: opts.Work.NewQueue(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.ctrl = c
+
+	// the table is watched to populate it once the AUSF initialized it
+	ausfGroup := ausfOperatorName + ".view.dcontroller.io"
+	p := predicate.BasicPredicate("GenerationChanged")
+	for _, src := range []opv1a1.Source{
+		{Resource: opv1a1.Resource{Kind: "Subscriber"}, Predicate: &predicate.Predicate{BasicPredicate: &p}},
+		{Resource: opv1a1.Resource{Group: &ausfGroup, Kind: subscriberTableKind}},
+	} {
+		s := reconciler.NewSource(mgr, OperatorName, src)
+		gvk, err := s.GetGVK()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GVK for source: %w", err)
+		}
+		// only the subscribers are served by the UDM
+		if src.Resource.Group == nil {
+			r.gvks = append(r.gvks, gvk)
+		}
+
+		source, err := s.GetSource()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create source: %w", err)
+		}
+
+		if err := c.Watch(source); err != nil {
+			return nil, fmt.Errorf("failed to create watch: %w", err)
+		}
+	}
+
+	r.log.Info("created UDM subscriber controller")
+
+	return r, nil
+}
+
+func (r *subscriberController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	r.log.V(2).Info("Reconciling", "request", req.String())
+
+	if req.GVK.Kind == subscriberTableKind {
+		return reconcile.Result{}, r.syncTable(ctx)
+	}
+
+	key := client.ObjectKeyFromObject(req.Object)
+	if req.EventType == object.Deleted {
+		if err := r.release(ctx, key); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, r.syncTable(ctx)
+	}
+
+	sub := Subscriber{}
+	spec, _, _ := unstructured.NestedMap(req.Object.UnstructuredContent(), "spec")
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &sub); err != nil {
+		return reconcile.Result{}, r.setStatus(ctx, key, "False", "InvalidSubscriber",
+			fmt.Sprintf("Invalid subscriber: %s", err))
+	}
+	if sub.SUPI == "" {
+		return reconcile.Result{}, r.setStatus(ctx, key, "False", "InvalidSubscriber",
+			"Invalid subscriber: SUPI is not specified")
+	}
+
+	r.mu.Lock()
+	for k, supi := range r.supis {
+		if supi == sub.SUPI && k != key {
+			r.mu.Unlock()
+			return reconcile.Result{}, r.setStatus(ctx, key, "False", "DuplicateSupi",
+				fmt.Sprintf("SUPI %s is provisioned by subscriber %s", sub.SUPI, k))
+		}
+	}
+	r.mu.Unlock()
+
+	// the SUPI of the subscriber may have been changed
+	if err := r.release(ctx, key); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := r.store.Put(ctx, sub); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to store subscriber %q: %w", sub.SUPI, err)
+	}
+	r.mu.Lock()
+	r.supis[key] = sub.SUPI
+	r.mu.Unlock()
+	r.log.V(1).Info("subscriber provisioned", "subscriber", key.String(), "supi", sub.SUPI)
+
+	if err := r.syncTable(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, r.setStatus(ctx, key, "True", "Provisioned", "Subscriber provisioned")
+}
+
+// release removes the record provisioned by a subscriber resource from the store.
+func (r *subscriberController) release(ctx context.Context, key client.ObjectKey) error {
+	r.mu.Lock()
+	supi, ok := r.supis[key]
+	delete(r.supis, key)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := r.store.Delete(ctx, supi); err != nil {
+		return fmt.Errorf("failed to delete subscriber %q: %w", supi, err)
+	}
+	r.log.V(1).Info("subscriber deprovisioned", "subscriber", key.String(), "supi", supi)
+	return nil
+}
+
+// syncTable mirrors the subscriber store into the AUSF:SubscriberTable. The table may not be
+// initialized yet, in which case it is synced once created.
+func (r *subscriberController) syncTable(ctx context.Context) error {
+	subs, err := r.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list subscribers: %w", err)
+	}
+	entries := make([]any, 0, len(subs))
+	for _, sub := range subs {
+		entry := map[string]any{"supi": sub.SUPI}
+		if len(sub.AllowedNSSAI) > 0 {
+			nssai := make([]any, 0, len(sub.AllowedNSSAI))
+			for _, s := range sub.AllowedNSSAI {
+				nssai = append(nssai, s)
+			}
+			entry["allowedNSSAI"] = nssai
+		}
+		if sub.DefaultQoSProfile != "" {
+			entry["defaultQosProfile"] = sub.DefaultQoSProfile
+		}
+		entries = append(entries, entry)
+	}
+	spec := map[string]any{"enabled": r.enforce, "subscribers": entries}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject(ausfOperatorName, subscriberTableKind)
+		object.SetName(table, subscriberTableNamespace, subscriberTableName)
+		if err := r.Get(ctx, client.ObjectKeyFromObject(table), table); err != nil {
+			return err
+		}
+
+		if current, _, _ := unstructured.NestedMap(table.UnstructuredContent(), "spec"); reflect.DeepEqual(current, spec) {
+			return nil
+		}
+		if err := unstructured.SetNestedMap(table.UnstructuredContent(), spec, "spec"); err != nil {
+			return err
+		}
+		return r.Update(ctx, table)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// setStatus sets the Ready condition of a subscriber resource.
+func (r *subscriberController) setStatus(ctx context.Context, key client.ObjectKey, result, reason, message string) error {
+	condition := map[string]any{
+		"lastTransitionTime": time.Now().String(),
+		"type":               "Ready",
+		"status":             result,
+		"reason":             reason,
+		"message":            message,
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject(OperatorName, "Subscriber")
+		if err := r.Get(ctx, key, obj); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedSlice(obj.UnstructuredContent(), []any{condition},
+			"status", "conditions"); err != nil {
+			return err
+		}
+		return r.Update(ctx, obj)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package udm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// ErrSubscriberNotFound is returned by a subscriber store for a SUPI that is not provisioned.
+var ErrSubscriberNotFound = errors.New("subscriber not found")
+
+// Subscriber is the subscriber record of a UE provisioned in the UDM.
+type Subscriber struct {
+	// SUPI is the subscription permanent identifier of the UE, e.g., imsi-999010000000123.
+	SUPI string `json:"supi"`
+	// KeyRef refers to the authentication key material of the subscriber, e.g., the entry of a
+	// key store, which is not held in the record.
+	KeyRef string `json:"keyRef,omitempty"`
+	// AllowedNSSAI lists the slice types the subscriber may request.
+	AllowedNSSAI []string `json:"allowedNSSAI,omitempty"`
+	// DefaultQoSProfile is the name of the QoS profile of the sessions of the subscriber.
+	DefaultQoSProfile string `json:"defaultQosProfile,omitempty"`
+}
+
+// SubscriberStore holds the subscriber records of the UDM. The store may be backed by an external
+// database, so each operation may fail.
+type SubscriberStore interface {
+	// Get returns the subscriber record of a SUPI, or ErrSubscriberNotFound.
+	Get(ctx context.Context, supi string) (Subscriber, error)
+	// Put creates or replaces the subscriber record of a SUPI.
+	Put(ctx context.Context, sub Subscriber) error
+	// Delete removes the subscriber record of a SUPI, if any.
+	Delete(ctx context.Context, supi string) error
+	// List returns the subscriber records ordered by the SUPI.
+	List(ctx context.Context) ([]Subscriber, error)
+}
+
+// memorySubscriberStore is the default in-memory subscriber store.
+type memorySubscriberStore struct {
+	mu   sync.Mutex
+	subs map[string]Subscriber
+}
+
+// NewMemorySubscriberStore returns an empty in-memory subscriber store.
+func NewMemorySubscriberStore() SubscriberStore {
+	return &memorySubscriberStore{subs: map[string]Subscriber{}}
+}
+
+func (s *memorySubscriberStore) Get(_ context.Context, supi string) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[supi]
+	if !ok {
+		return Subscriber{}, ErrSubscriberNotFound
+	}
+	return sub.clone(), nil
+}
+
+func (s *memorySubscriberStore) Put(_ context.Context, sub Subscriber) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub.SUPI] = sub.clone()
+	return nil
+}
+
+func (s *memorySubscriberStore) Delete(_ context.Context, supi string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, supi)
+	return nil
+}
+
+func (s *memorySubscriberStore) List(_ context.Context) ([]Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := make([]Subscriber, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub.clone())
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].SUPI < subs[j].SUPI })
+	return subs, nil
+}
+
+func (sub Subscriber) clone() Subscriber {
+	sub.AllowedNSSAI = slices.Clone(sub.AllowedNSSAI)
+	return sub
+}
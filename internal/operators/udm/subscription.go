@@ -0,0 +1,289 @@
+package udm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	dcontroller "github.com/l7mp/dcontroller/pkg/controller"
+	"github.com/l7mp/dcontroller/pkg/manager"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// The SMF objects defaulted from the subscriptions.
+const (
+	smfOperatorName         = "smf"
+	sessionContextKind      = "SessionContext"
+	subscribedAmbrTableKind = "SubscribedAmbrTable"
+	subscribedAmbrTableName = "subscribed-ambr"
+)
+
+// AmbrPolicy is the way the SMF handles a session whose aggregate flow bit rate exceeds the
+// UE-AMBR of the user, the stricter of the UE-AMBR of the PCF and the subscribed UE-AMBR.
+type AmbrPolicy string
+
+const (
+	// AmbrCap caps the flow bit rates and the session AMBR to the UE-AMBR and
+	// exposes the cap in status.qos.ambrCap (default).
+	AmbrCap AmbrPolicy = "cap"
+	// AmbrReject fails the session with Validated=False/AmbrExceeded.
+	AmbrReject AmbrPolicy = "reject"
+)
+
+func checkAmbrPolicy(p AmbrPolicy) error {
+	switch p {
+	case "", AmbrCap, AmbrReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown subscribed AMBR policy %q", p)
+	}
+}
+
+// subscriptionController applies the session AMBR default of the subscription profile of a user
+// to the PDU sessions of the user that do not specify a session AMBR. The subscription profile of
+// a user is the udm/Subscription named after the user in the namespace of the user:
+//
+//	apiVersion: udm.view.dcontroller.io/v1alpha1
+//	kind: Subscription
+//	metadata:
+//	  name: user-1
+//	  namespace: user-1
+//	spec:
+//	  sessionAmbr:
+//	    uplinkKbps: 256
+//	    downlinkKbps: 512
+//	  ueAmbr:
+//	    uplinkKbps: 1024
+//	    downlinkKbps: 2048
+//
+// The default is written into the spec of the smf/SessionContext, from where the SMF passes it on
+// to the session status and the UPF config. The subscribed UE-AMBRs, if any, are listed in the
+// SMF subscribed AMBR table along with the policy, against which the SMF validates the aggregate
+// flow bit rate of the sessions of the users.
+type subscriptionController struct {
+	client.Client
+	ctrl   dcontroller.RuntimeController
+	gvks   []schema.GroupVersionKind
+	policy AmbrPolicy
+	log    logr.Logger
+}
+
+func newSubscriptionController(mgr manager.Manager, opts Options) (*subscriptionController, error) {
+	r := &subscriptionController{
+		Client: opts.Cache.(*cache.ViewCache).GetClient(),
+		gvks:   []schema.GroupVersionKind{},
+		policy: opts.AmbrPolicy,
+		log:    opts.Logger.WithName("udm-subscription-ctrl"),
+	}
+	if r.policy == "" {
+		r.policy = AmbrCap
+	}
+
+	on := true
+	c, err := controller.NewTyped(subscriptionControllerName, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler: opts.Work.TrackReconciler(metrics.ReportErrors(subscriptionControllerName,
+			metrics.InstrumentReconciler(OperatorName, r), opts.ErrorReporter)),
+		NewQueue: opts.Work.NewQueue(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.ctrl = c
+
+	smfGroup := smfOperatorName + ".view.dcontroller.io"
+	for _, res := range []opv1a1.Resource{
+		{Kind: "Subscription"},
+		{Group: &smfGroup, Kind: sessionContextKind},
+		{Group: &smfGroup, Kind: subscribedAmbrTableKind},
+	} {
+		s := reconciler.NewSource(mgr, OperatorName, opv1a1.Source{Resource: res})
+		gvk, err := s.GetGVK()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GVK for source: %w", err)
+		}
+		// only the subscriptions are served by the UDM
+		if res.Group == nil {
+			r.gvks = append(r.gvks, gvk)
+		}
+
+		src, err := s.GetSource()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create source: %w", err)
+		}
+
+		if err := c.Watch(src); err != nil {
+			return nil, fmt.Errorf("failed to create watch: %w", err)
+		}
+	}
+
+	r.log.Info("created UDM subscription controller")
+
+	return r, nil
+}
+
+func (r *subscriptionController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	r.log.V(2).Info("Reconciling", "request", req.String())
+
+	switch req.GVK.Kind {
+	case subscribedAmbrTableKind:
+		return reconcile.Result{}, r.syncAmbrTable(ctx)
+	case sessionContextKind:
+	default:
+		if err := r.syncAmbrTable(ctx); err != nil {
+			r.log.Error(err, "failed to sync subscribed AMBR table")
+			return reconcile.Result{}, err
+		}
+	}
+
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	namespace := req.Object.GetNamespace()
+	ambr, err := r.getSessionAmbr(ctx, namespace)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if ambr == nil {
+		return reconcile.Result{}, nil
+	}
+
+	// a new subscription applies to the existing sessions of the user
+	keys := []client.ObjectKey{client.ObjectKeyFromObject(req.Object)}
+	if req.GVK.Kind != sessionContextKind {
+		list := cache.NewViewObjectList(smfOperatorName, sessionContextKind)
+		if err := r.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return reconcile.Result{}, err
+		}
+		keys = keys[:0]
+		for i := range list.Items {
+			keys = append(keys, client.ObjectKeyFromObject(&list.Items[i]))
+		}
+	}
+
+	for _, key := range keys {
+		if err := r.setDefault(ctx, key, ambr); err != nil {
+			r.log.Error(err, "failed to default session AMBR", "key", key)
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// getSessionAmbr returns the session AMBR default of the subscription of a user, or nil if the
+// user has no subscription or the subscription has no session AMBR default.
+func (r *subscriptionController) getSessionAmbr(ctx context.Context, user string) (map[string]any, error) {
+	sub := object.NewViewObject(OperatorName, "Subscription")
+	if err := r.Get(ctx, client.ObjectKey{Namespace: user, Name: user}, sub); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ambr, ok, err := unstructured.NestedMap(sub.UnstructuredContent(), "spec", "sessionAmbr")
+	if err != nil || !ok {
+		return nil, err
+	}
+	return ambr, nil
+}
+
+// setDefault sets the session AMBR of a session context unless already specified.
+func (r *subscriptionController) setDefault(ctx context.Context, key client.ObjectKey, ambr map[string]any) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject(smfOperatorName, sessionContextKind)
+		if err := r.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		if current, ok, _ := unstructured.NestedFieldNoCopy(obj.UnstructuredContent(),
+			"spec", "sessionAmbr"); ok && current != nil {
+			return nil
+		}
+
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), runtime.DeepCopyJSON(ambr),
+			"spec", "sessionAmbr"); err != nil {
+			return err
+		}
+
+		r.log.V(2).Info("defaulting session AMBR", "key", key, "sessionAmbr", ambr)
+
+		return r.Update(ctx, obj)
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// syncAmbrTable lists the subscribed UE-AMBRs of the users in the SMF subscribed AMBR table.
+func (r *subscriptionController) syncAmbrTable(ctx context.Context) error {
+	list := cache.NewViewObjectList(OperatorName, "Subscription")
+	if err := r.List(ctx, list); err != nil {
+		return err
+	}
+
+	subscribers := []any{}
+	for i := range list.Items {
+		sub := &list.Items[i]
+		// only the subscription profile named after the user counts
+		if sub.GetName() != sub.GetNamespace() {
+			continue
+		}
+		ul, ok1, _ := unstructured.NestedInt64(sub.UnstructuredContent(), "spec", "ueAmbr", "uplinkKbps")
+		dl, ok2, _ := unstructured.NestedInt64(sub.UnstructuredContent(), "spec", "ueAmbr", "downlinkKbps")
+		if !ok1 || !ok2 {
+			continue
+		}
+		subscribers = append(subscribers, map[string]any{
+			"user":         sub.GetNamespace(),
+			"uplinkKbps":   ul,
+			"downlinkKbps": dl,
+		})
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		return subscribers[i].(map[string]any)["user"].(string) < subscribers[j].(map[string]any)["user"].(string)
+	})
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject(smfOperatorName, subscribedAmbrTableKind)
+		if err := r.Get(ctx, client.ObjectKey{Name: subscribedAmbrTableName}, table); err != nil {
+			return err
+		}
+
+		spec := map[string]any{"policy": string(r.policy), "subscribers": subscribers}
+		if current, _, _ := unstructured.NestedMap(table.UnstructuredContent(), "spec"); reflect.DeepEqual(current, spec) {
+			return nil
+		}
+		if err := unstructured.SetNestedMap(table.UnstructuredContent(), spec, "spec"); err != nil {
+			return err
+		}
+
+		r.log.V(2).Info("updating subscribed AMBR table", "subscribers", len(subscribers))
+
+		return r.Update(ctx, table)
+	})
+	// the table is created by the SMF
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package udm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	dcontroller "github.com/l7mp/dcontroller/pkg/controller"
+	"github.com/l7mp/dcontroller/pkg/manager"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// amfOperatorName is the operator of the Registrations the token pool is filled for.
+const amfOperatorName = "amf"
+
+// tokenPoolMaxAge is the age after which a pre-generated token is discarded instead of issued, so
+// that the UEs get tokens with close to the full lifetime.
+const tokenPoolMaxAge = time.Minute
+
+// pooledToken is a pre-generated token.
+type pooledToken struct {
+	token  string
+	minted time.Time
+}
+
+// tokenPool holds the tokens pre-generated for the UEs whose registration is in progress, keyed
+// by the user (the namespace of the UE). The UDM issues a pooled token instead of signing a new
+// one when the config of the UE arrives, which takes the RSA signing off the critical path of
+// the registration.
+//
+// A token cannot be minted for an unknown UE and bound to it later, since the signature covers
+// the user: the tokens are minted as soon as the AMF receives the Registration, while the
+// registration is being authenticated.
+type tokenPool struct {
+	mu           sync.Mutex
+	size         int
+	tokens       map[string]pooledToken
+	hits, misses atomic.Uint64
+	now          func() time.Time
+}
+
+func newTokenPool(size int) *tokenPool {
+	return &tokenPool{size: size, tokens: map[string]pooledToken{}, now: time.Now}
+}
+
+// wants returns true if the pool has room for a token for the user.
+func (p *tokenPool) wants(user string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.tokens[user]
+	if ok && p.now().Sub(t.minted) <= tokenPoolMaxAge {
+		return false
+	}
+	return ok || len(p.tokens) < p.size
+}
+
+// put adds a token for a user to the pool.
+func (p *tokenPool) put(user, token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.tokens[user]; !ok && len(p.tokens) >= p.size {
+		return
+	}
+	p.tokens[user] = pooledToken{token: token, minted: p.now()}
+}
+
+// take removes the token of a user from the pool, false if there is no fresh token.
+func (p *tokenPool) take(user string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.tokens[user]
+	delete(p.tokens, user)
+	if !ok || p.now().Sub(t.minted) > tokenPoolMaxAge {
+		p.misses.Add(1)
+		return "", false
+	}
+	p.hits.Add(1)
+	return t.token, true
+}
+
+// evict drops the token of a user.
+func (p *tokenPool) evict(user string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.tokens, user)
+}
+
+// TokenPoolStats returns the number of the tokens issued from the warm pool and the number of
+// the tokens signed on demand since the start, both zero if the pool is disabled.
+func (u *UDM) TokenPoolStats() (hits, misses uint64) {
+	if u.c.pool == nil {
+		return 0, 0
+	}
+	return u.c.pool.hits.Load(), u.c.pool.misses.Load()
+}
+
+// tokenPoolController fills the token pool for the UEs whose registration is in progress.
+type tokenPoolController struct {
+	udm  *udmController
+	ctrl dcontroller.RuntimeController
+	log  logr.Logger
+}
+
+func newTokenPoolController(mgr manager.Manager, udm *udmController) (*tokenPoolController, error) {
+	r := &tokenPoolController{udm: udm, log: udm.opts.Logger.WithName("udm-token-pool")}
+
+	on := true
+	c, err := controller.NewTyped(tokenPoolControllerName, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler: udm.opts.Work.TrackReconciler(metrics.ReportErrors(tokenPoolControllerName,
+			metrics.InstrumentReconciler(OperatorName, r), udm.opts.ErrorReporter)),
+		NewQueue: udm.opts.Work.NewQueue(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.ctrl = c
+
+	amfGroup := amfOperatorName + ".view.dcontroller.io"
+	s := reconciler.NewSource(mgr, OperatorName, opv1a1.Source{
+		Resource: opv1a1.Resource{Group: &amfGroup, Kind: "Registration"},
+	})
+	src, err := s.GetSource()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source: %w", err)
+	}
+	if err := c.Watch(src); err != nil {
+		return nil, fmt.Errorf("failed to create watch: %w", err)
+	}
+
+	r.log.Info("created UDM token pool controller", "size", udm.pool.size)
+
+	return r, nil
+}
+
+func (r *tokenPoolController) Reconcile(_ context.Context, req reconciler.Request) (reconcile.Result, error) {
+	user := req.Object.GetNamespace()
+	pool := r.udm.pool
+
+	if req.EventType == object.Deleted {
+		pool.evict(user)
+		return reconcile.Result{}, nil
+	}
+
+	// the config of a registered UE has already been issued
+	if _, ok, _ := unstructured.NestedMap(req.Object.UnstructuredContent(), "status", "config"); ok {
+		return reconcile.Result{}, nil
+	}
+	if !pool.wants(user) {
+		return reconcile.Result{}, nil
+	}
+
+	token, err := r.udm.generator.GenerateToken(user, []string{user}, RBACRules, r.udm.tokenTTL())
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to pre-generate token: %w", err)
+	}
+	pool.put(user, token)
+	r.log.V(2).Info("pre-generated token", "user", user)
+
+	return reconcile.Result{}, nil
+}
@@ -9,16 +9,23 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/yaml"
 
@@ -32,33 +39,106 @@ import (
 	"github.com/l7mp/dcontroller/pkg/operator"
 	"github.com/l7mp/dcontroller/pkg/predicate"
 	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/correlation"
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+	"github.com/hsnlab/dctrl5g/internal/tracing"
 )
 
 const OperatorName = "udm"
 
+// The names of the controllers of the UDM.
+const (
+	configControllerName       = "udm-controller"
+	subscriptionControllerName = "udm-subscription-controller"
+	subscriberControllerName   = "udm-subscriber-controller"
+	tokenPoolControllerName    = "udm-token-pool-controller"
+)
+
 var RBACRules = []rbacv1.PolicyRule{{
 	Verbs:     []string{"create", "get", "list", "watch", "delete"},
 	APIGroups: []string{"amf.view.dcontroller.io"},
 	Resources: []string{"registration", "session", "contextrelease"},
+}, {
+	// the UEs refresh their registration by updating the heartbeat
+	Verbs:     []string{"create", "get", "update", "delete"},
+	APIGroups: []string{"amf.view.dcontroller.io"},
+	Resources: []string{"heartbeat"},
 }}
 
+// DefaultTokenTTL is the default lifetime of the tokens issued to the UEs.
+const DefaultTokenTTL = 168 * time.Hour
+
+// DefaultMaxTokenTTL is the default ceiling of the lifetime of the tokens issued to the UEs.
+const DefaultMaxTokenTTL = 720 * time.Hour
+
 type Options struct {
 	Cache              cache.Cache
 	HTTPMode, Insecure bool
 	KeyFile            string
-	Logger             logr.Logger
+	// ObservedGeneration makes the controller stamp conditions with the generation of the
+	// object the condition was computed from.
+	ObservedGeneration bool
+	// TokenSelfTestInterval is the interval of the token signing self-test (default: 1m).
+	TokenSelfTestInterval time.Duration
+	// TokenAuditRetention is the time the token audit records of deleted UEs are kept for
+	// (default: 24h).
+	TokenAuditRetention time.Duration
+	// TokenTTL is the lifetime of the tokens issued to the UEs (default: 168h).
+	TokenTTL time.Duration
+	// MaxTokenTTL caps the lifetime of any token issued to the UEs, whatever TTL is requested, so
+	// that a misconfiguration cannot mint long-lived tokens (default: 720h).
+	MaxTokenTTL time.Duration
+	// TokenPoolSize, if positive, enables a warm pool of up to the given number of tokens
+	// pre-generated for the UEs whose registration is in progress (default: disabled).
+	TokenPoolSize int
+	// ConfigSelector, if set, restricts the UDM to the Configs matching the label selector, e.g.,
+	// to shard the UEs across replicas.
+	ConfigSelector *metav1.LabelSelector
+	// RetryBackoff is the backoff of retrying the configs that could not be generated (default:
+	// DefaultRetryBackoff).
+	RetryBackoff RetryBackoff
+	// SubscriberStore holds the subscriber records provisioned with the udm/Subscribers
+	// (default: in-memory).
+	SubscriberStore SubscriberStore
+	// EnforceSubscribers restricts the registrations to the provisioned subscribers.
+	EnforceSubscribers bool
+	// AmbrPolicy selects how the SMF handles the sessions exceeding the subscribed UE-AMBR of
+	// the user: cap (default) or reject.
+	AmbrPolicy AmbrPolicy
+	// TracerProvider, if set, traces the reconciles of the configs as the child spans of the
+	// span context carried in the annotations of the configs.
+	TracerProvider trace.TracerProvider
+	// ErrorChannel, if set, receives the errors of the operator, and ErrorReporter the reconcile
+	// errors of the native controllers.
+	ErrorChannel  chan error
+	ErrorReporter metrics.ErrorReporter
+	// Work, if set, tracks the requests queued for and being reconciled by the native
+	// controllers, for the drains.
+	Work   *metrics.Work
+	Logger logr.Logger
 }
 
 type UDM struct {
 	*operator.Operator
-	c *udmController
+	c           *udmController
+	sub         *subscriptionController
+	subscribers *subscriberController
 }
 
 func New(apiServer *apiserver.APIServer, opts Options) (*UDM, error) {
 	log := opts.Logger.WithName("udm")
 
+	if err := checkAmbrPolicy(opts.AmbrPolicy); err != nil {
+		return nil, err
+	}
+
 	// Load the operator from file
-	errorChan := make(chan error, 16)
+	errorChan := opts.ErrorChannel
+	if errorChan == nil {
+		errorChan = make(chan error, 16)
+	}
 	op, err := operator.New(OperatorName, nil, operator.Options{
 		Cache:        opts.Cache,
 		APIServer:    apiServer,
@@ -69,6 +149,12 @@ func New(apiServer *apiserver.APIServer, opts Options) (*UDM, error) {
 		return nil, fmt.Errorf("failed to create manager for operator UDM: %w", err)
 	}
 
+	// The config controller checks the subscribed NSSAI in the records provisioned by the
+	// subscriber controller.
+	if opts.SubscriberStore == nil {
+		opts.SubscriberStore = NewMemorySubscriberStore()
+	}
+
 	// Create the udm controller
 	c, err := NewUdmController(op.GetManager(), apiServer.GetServerAddress(), opts)
 	if err != nil {
@@ -77,26 +163,89 @@ func New(apiServer *apiserver.APIServer, opts Options) (*UDM, error) {
 
 	log.Info("created udm controller")
 
-	// Add native controller to the operator and export GVKs to the API server.
+	// Create the subscription controller
+	sub, err := newSubscriptionController(op.GetManager(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the subscriber controller
+	subscribers, err := newSubscriberController(op.GetManager(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add native controllers to the operator and export GVKs to the API server.
 	op.AddNativeController("config-ctrl", c.ctrl, c.gvks)
+	op.AddNativeController("subscription-ctrl", sub.ctrl, sub.gvks)
+	op.AddNativeController("subscriber-ctrl", subscribers.ctrl, subscribers.gvks)
+
+	// Pre-generate the tokens of the UEs being registered. The Registrations are served by the
+	// AMF.
+	if c.pool != nil {
+		pool, err := newTokenPoolController(op.GetManager(), c)
+		if err != nil {
+			return nil, err
+		}
+		op.AddNativeController("token-pool-ctrl", pool.ctrl, nil)
+	}
 
 	if err := op.RegisterGVKs(); err != nil {
 		return nil, err
 	}
 
-	return &UDM{Operator: op, c: c}, nil
+	return &UDM{Operator: op, c: c, sub: sub, subscribers: subscribers}, nil
 }
 
-func (u *UDM) GetGVKs() []schema.GroupVersionKind { return u.c.gvks }
+func (u *UDM) GetGVKs() []schema.GroupVersionKind {
+	gvks := append(append([]schema.GroupVersionKind{}, u.c.gvks...), u.sub.gvks...)
+	return append(gvks, u.subscribers.gvks...)
+}
+
+// WatchStatus reports the state of a watch of a native controller.
+type WatchStatus struct {
+	Controller string `json:"controller"`
+	GVK        string `json:"gvk"`
+	// LastEvent is the time the last event was received on the watch, nil if none so far.
+	LastEvent *time.Time `json:"lastEvent,omitempty"`
+	// Connected is true while the controller is running.
+	Connected bool `json:"connected"`
+}
+
+// GetWatches returns the state of the watches of the UDM controller.
+func (u *UDM) GetWatches() []WatchStatus {
+	u.c.mu.Lock()
+	defer u.c.mu.Unlock()
+
+	ws := make([]WatchStatus, 0, len(u.c.gvks))
+	for _, gvk := range u.c.gvks {
+		w := WatchStatus{Controller: "udm-controller", GVK: gvk.String(), Connected: u.c.connected}
+		if t, ok := u.c.lastEvent[gvk]; ok {
+			w.LastEvent = &t
+		}
+		ws = append(ws, w)
+	}
+	return ws
+}
 
 // udmController implements the udm controller
 type udmController struct {
 	client.Client
 	opts          Options
 	serverAddress string
-	generator     *auth.TokenGenerator
+	generator     *jwks.TokenGenerator
 	ctrl          dcontroller.RuntimeController
 	gvks          []schema.GroupVersionKind
+	mu            sync.Mutex
+	lastEvent     map[schema.GroupVersionKind]time.Time
+	connected     bool
+	selfTest      SelfTestStatus
+	audit         *tokenAudit
+	pool          *tokenPool
+	retries       map[client.ObjectKey]int
+	store         SubscriberStore
+	kubeConfig    func(obj object.Object) (map[string]any, error) // overridden in the tests
+	tracer        trace.Tracer
 	log           logr.Logger
 }
 
@@ -105,7 +254,18 @@ func NewUdmController(mgr manager.Manager, serverAddress string, opts Options) (
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key %q: %w", opts.KeyFile, err)
 	}
-	generator := auth.NewTokenGenerator(privateKey)
+	generator := jwks.NewTokenGenerator(privateKey, "")
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = DefaultTokenTTL
+	}
+	if opts.MaxTokenTTL <= 0 {
+		opts.MaxTokenTTL = DefaultMaxTokenTTL
+	}
+	if opts.TokenTTL > opts.MaxTokenTTL {
+		opts.Logger.WithName("udm-ctrl").Info("WARNING: token TTL exceeds the ceiling, capping",
+			"ttl", opts.TokenTTL, "max-ttl", opts.MaxTokenTTL)
+	}
+	opts.RetryBackoff = opts.RetryBackoff.withDefaults()
 
 	r := &udmController{
 		Client:        opts.Cache.(*cache.ViewCache).GetClient(),
@@ -113,13 +273,24 @@ func NewUdmController(mgr manager.Manager, serverAddress string, opts Options) (
 		generator:     generator,
 		serverAddress: serverAddress,
 		gvks:          []schema.GroupVersionKind{},
+		lastEvent:     map[schema.GroupVersionKind]time.Time{},
+		audit:         newTokenAudit(opts.TokenAuditRetention),
+		retries:       map[client.ObjectKey]int{},
+		store:         opts.SubscriberStore,
+		tracer:        tracing.Tracer(opts.TracerProvider),
 		log:           opts.Logger.WithName("udm-ctrl"),
 	}
+	if opts.TokenPoolSize > 0 {
+		r.pool = newTokenPool(opts.TokenPoolSize)
+	}
+	r.kubeConfig = r.getKubeConfig
 
 	on := true
-	c, err := controller.NewTyped("udm-controller", mgr, controller.TypedOptions[reconciler.Request]{
+	c, err := controller.NewTyped(configControllerName, mgr, controller.TypedOptions[reconciler.Request]{
 		SkipNameValidation: &on,
-		Reconciler:         r,
+		Reconciler: opts.Work.TrackReconciler(metrics.ReportErrors(configControllerName,
+			metrics.InstrumentReconciler(OperatorName, r), opts.ErrorReporter)),
+		NewQueue: opts.Work.NewQueue(),
 	})
 	if err != nil {
 		return nil, err
@@ -131,7 +302,8 @@ func NewUdmController(mgr manager.Manager, serverAddress string, opts Options) (
 		Resource: opv1a1.Resource{
 			Kind: "Config",
 		},
-		Predicate: &predicate.Predicate{BasicPredicate: &p},
+		LabelSelector: opts.ConfigSelector,
+		Predicate:     &predicate.Predicate{BasicPredicate: &p},
 	})
 	gvk, err := s.GetGVK()
 	if err != nil {
@@ -148,41 +320,115 @@ func NewUdmController(mgr manager.Manager, serverAddress string, opts Options) (
 		return nil, fmt.Errorf("failed to create watch: %w", err)
 	}
 
+	// track whether the controller is running for the watch diagnostics
+	if err := mgr.Add(runtimeManager.RunnableFunc(func(ctx context.Context) error {
+		r.setConnected(true)
+		<-ctx.Done()
+		r.setConnected(false)
+		return nil
+	})); err != nil {
+		return nil, fmt.Errorf("failed to add watch tracker: %w", err)
+	}
+
+	if err := r.addSelfTest(mgr, &privateKey.PublicKey, opts.TokenSelfTestInterval); err != nil {
+		return nil, fmt.Errorf("failed to add token self-test: %w", err)
+	}
+
+	if err := r.addAuditPruner(mgr); err != nil {
+		return nil, fmt.Errorf("failed to add token audit pruner: %w", err)
+	}
+
 	r.log.Info("created UDM controller")
 
 	return r, nil
 }
 
 func (r *udmController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
-	r.log.Info("Reconciling", "request", req.String())
-
 	obj := req.Object
 	name := obj.GetName()
 	namespace := obj.GetNamespace()
+	log := correlation.Logger(r.log, obj)
 
-	r.log.Info("Add/update Config request object", "name", name, "namespace", namespace)
+	ctx, span := r.tracer.Start(tracing.Extract(ctx, obj), "reconcile udm/Config",
+		trace.WithAttributes(tracing.Attributes(OperatorName, "Config", obj)...),
+		trace.WithAttributes(tracing.GutiKey.String(name)))
+	defer span.End()
+
+	log.Info("Reconciling", "request", req.String())
+
+	r.mu.Lock()
+	r.lastEvent[req.GVK] = time.Now()
+	r.mu.Unlock()
+
+	key := client.ObjectKeyFromObject(obj)
+	if req.EventType == object.Deleted {
+		log.Info("Delete Config request object", "name", name, "namespace", namespace)
+		r.audit.deleted(namespace)
+		r.resetRetries(key)
+		return reconcile.Result{}, nil
+	}
+
+	log.Info("Add/update Config request object", "name", name, "namespace", namespace)
+
+	nssai, err := r.allowedNSSAI(ctx, obj)
+	if err == nil && nssai != nil && len(nssai) == 0 {
+		r.resetRetries(key)
+		log.Info("none of the requested S-NSSAIs is subscribed", "name", name, "namespace", namespace)
+		r.setStatus(ctx, obj, "False", "NoAllowedNSSAI", "No subscribed S-NSSAI", nil, nil, 0) //nolint:errcheck
+		span.SetAttributes(attribute.String(tracing.ConditionKeyPrefix+"Ready", "False/NoAllowedNSSAI"))
+		return reconcile.Result{}, nil
+	}
 
-	config, err := r.getKubeConfig(obj)
+	var config map[string]any
+	if err == nil {
+		config, err = r.kubeConfig(obj)
+	}
 	if err != nil {
-		r.setStatus(ctx, obj, "False", "ConfigUnavailable", "Failed to generate config", nil)
-		return reconcile.Result{},
-			fmt.Errorf("failed to generate config: %w", err)
+		// retry with backoff instead of the rate limit of the work queue
+		retries := r.retried(key)
+		delay := r.opts.RetryBackoff.delay(retries)
+		log.Error(err, "failed to generate config", "retries", retries, "requeue-after", delay)
+		r.setStatus(ctx, obj, "False", "ConfigUnavailable", "Failed to generate config", nil, nil, retries) //nolint:errcheck
+		span.SetAttributes(attribute.String(tracing.ConditionKeyPrefix+"Ready", "False/ConfigUnavailable"))
+		span.SetStatus(codes.Error, err.Error())
+		return reconcile.Result{RequeueAfter: delay}, nil
 	}
+	r.resetRetries(key)
 
-	r.setStatus(ctx, obj, "True", "Ready", "Succesfully generated config", config)
+	r.setStatus(ctx, obj, "True", "Ready", "Succesfully generated config", config, nssai, 0) //nolint:errcheck
+	span.SetAttributes(attribute.String(tracing.ConditionKeyPrefix+"Ready", "True/Ready"))
 
 	return reconcile.Result{}, nil
 }
 
+func (r *udmController) setConnected(connected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connected = connected
+}
+
+// tokenTTL returns the lifetime of the tokens issued to the UEs, capped at the ceiling.
+func (r *udmController) tokenTTL() time.Duration {
+	return min(r.opts.TokenTTL, r.opts.MaxTokenTTL)
+}
+
 func (r *udmController) getKubeConfig(obj object.Object) (map[string]any, error) {
 	// user restricted to the identically named user
 	user := obj.GetNamespace()
 	namespacesList := []string{user}
 	rulesList := RBACRules
-	token, err := r.generator.GenerateToken(user, namespacesList, rulesList, 168*time.Hour)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	token, pooled := "", false
+	if r.pool != nil {
+		token, pooled = r.pool.take(user)
 	}
+	if !pooled {
+		var err error
+		token, err = r.generator.GenerateToken(user, namespacesList, rulesList, r.tokenTTL())
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+	}
+	r.audit.issued(user)
 
 	// Create kubeconfig
 	kubeconfigOpts := &auth.KubeconfigOptions{
@@ -221,14 +467,7 @@ func (r *udmController) getKubeConfig(obj object.Object) (map[string]any, error)
 
 }
 
-func (r *udmController) setStatus(ctx context.Context, obj object.Object, result, reason, message string, config map[string]any) {
-	labels := obj.GetLabels()
-	if labels == nil {
-		labels = map[string]string{}
-	}
-	labels["state"] = "Ready"
-	obj.SetLabels(labels)
-
+func (r *udmController) setStatus(ctx context.Context, obj object.Object, result, reason, message string, config map[string]any, nssai []any, retries int) error {
 	condition := map[string]any{
 		"lastTransitionTime": time.Now().String(),
 		"type":               "Ready",
@@ -236,17 +475,64 @@ func (r *udmController) setStatus(ctx context.Context, obj object.Object, result
 		"reason":             reason,
 		"message":            message,
 	}
+	if r.opts.ObservedGeneration {
+		// the generation the condition was computed from, even if we have to re-get the object
+		condition["observedGeneration"] = obj.GetGeneration()
+	}
 
 	status := map[string]any{"conditions": []any{condition}}
 	if config != nil {
 		status["config"] = config
 	}
+	if nssai != nil {
+		status["allowedNSSAI"] = nssai
+	}
+	if retries > 0 {
+		// the number of the failed attempts to generate the config so far
+		status["retryCount"] = int64(retries)
+	}
 
-	if err := unstructured.SetNestedMap(obj.UnstructuredContent(), status, "status"); err != nil {
-		r.log.Error(err, "failed to set config status")
+	// count the transitions of the Ready condition
+	transition := true
+	conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+	for _, c := range conds {
+		if prev, ok := c.(map[string]any); ok && prev["type"] == "Ready" {
+			transition = prev["status"] != result || prev["reason"] != reason
+		}
 	}
 
-	if err := r.Update(ctx, obj); err != nil {
-		r.log.Error(err, "failed to update object", "key", client.ObjectKeyFromObject(obj))
+	// Optimistic concurrency: on a resourceVersion conflict re-get the latest version and
+	// reapply the status so that concurrent spec updates are not lost.
+	key := client.ObjectKeyFromObject(obj)
+	first := true
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := r.Get(ctx, key, obj); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["state"] = "Ready"
+		obj.SetLabels(labels)
+
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), status, "status"); err != nil {
+			return err
+		}
+
+		return r.Update(ctx, obj)
+	}); err != nil {
+		correlation.Logger(r.log, obj).Error(err, "failed to update object", "key", key)
+		return err
 	}
+
+	if transition {
+		metrics.RecordTransition(OperatorName, "Ready", result, reason)
+	}
+
+	return nil
 }
@@ -3,30 +3,37 @@ package udm
 import (
 	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"math/big"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap/zapcore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/yaml"
 
 	"github.com/l7mp/dcontroller/pkg/apiserver"
 	"github.com/l7mp/dcontroller/pkg/auth"
 	"github.com/l7mp/dcontroller/pkg/cache"
 	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
 )
 
 const (
-	keyFile       = "apiserver.key"
-	certFile      = "apiserver.crt"
 	timeout       = time.Second * 5
 	interval      = time.Millisecond * 50
 	retryInterval = time.Millisecond * 100
@@ -58,52 +65,7 @@ var _ = Describe("UDM Operator", func() {
 	BeforeEach(func() {
 		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
 		ctx, cancel = context.WithCancel(context.Background())
-
-		sharedCache := cache.NewViewCache(cache.CacheOptions{Logger: logger})
-
-		// must load op manually: testsuite.StartOps would create a dctrl object that would import us
-		cert, key, err := auth.GenerateSelfSignedCertWithSANs([]string{"localhost"})
-		Expect(err).NotTo(HaveOccurred())
-		err = auth.WriteCertAndKey(keyFile, certFile, key, cert)
-		Expect(err).NotTo(HaveOccurred())
-
-		port := randomPort()
-		apiServerConfig, err := apiserver.NewDefaultConfig("localhost", port, sharedCache.GetClient(),
-			true, false, logger)
-		Expect(err).NotTo(HaveOccurred())
-
-		apiServer, err := apiserver.NewAPIServer(apiServerConfig)
-		Expect(err).NotTo(HaveOccurred())
-
-		udm, err := New(apiServer, Options{
-			Cache:    sharedCache,
-			HTTPMode: true,
-			Insecure: true,
-			KeyFile:  keyFile,
-			Logger:   logger,
-		})
-		Expect(err).NotTo(HaveOccurred())
-
-		go func() {
-			defer GinkgoRecover()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case err := <-udm.GetErrorChannel():
-					Expect(err).NotTo(HaveOccurred())
-				}
-			}
-		}()
-
-		go func() {
-			defer GinkgoRecover()
-			err := udm.Start(ctx) // will start the view cache
-			Expect(err).NotTo(HaveOccurred())
-		}()
-
-		c = sharedCache.GetClient()
-		Expect(c).NotTo(BeNil())
+		c = startUDM(ctx, Options{HTTPMode: true, Insecure: true, ObservedGeneration: true})
 	})
 
 	AfterEach(func() {
@@ -164,6 +126,514 @@ metadata:
 		Expect(ok).To(BeTrue())
 		Expect(users).To(HaveLen(1))
 	})
+
+	It("should advance the observedGeneration on a spec update", func() {
+		yamlData := `
+apiVersion: udm.view.dcontroller.io/v1alpha1
+kind: Config
+metadata:
+  name: test-guti
+spec:
+  revision: 1`
+		req := object.New()
+		err := yaml.Unmarshal([]byte(yamlData), req)
+		Expect(err).NotTo(HaveOccurred())
+		err = c.Create(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		obj := object.NewViewObject("udm", "Config")
+		var gen int64
+		Eventually(func() bool {
+			if err := c.Get(ctx, types.NamespacedName{Name: "test-guti"}, obj); err != nil {
+				return false
+			}
+			conds, ok, err := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			if err != nil || !ok || len(conds) != 1 {
+				return false
+			}
+			g, ok := conds[0].(map[string]any)["observedGeneration"].(int64)
+			gen = g
+			return ok && g == obj.GetGeneration()
+		}, timeout, interval).Should(BeTrue())
+
+		// update the spec
+		err = unstructured.SetNestedField(obj.UnstructuredContent(), int64(2), "spec", "revision")
+		Expect(err).NotTo(HaveOccurred())
+		err = c.Update(ctx, obj)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() bool {
+			if err := c.Get(ctx, types.NamespacedName{Name: "test-guti"}, obj); err != nil {
+				return false
+			}
+			conds, ok, err := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			if err != nil || !ok || len(conds) != 1 {
+				return false
+			}
+			g, ok := conds[0].(map[string]any)["observedGeneration"].(int64)
+			return ok && g > gen
+		}, timeout, interval).Should(BeTrue())
+	})
+
+	It("should not lose concurrent spec updates", func() {
+		yamlData := `
+apiVersion: udm.view.dcontroller.io/v1alpha1
+kind: Config
+metadata:
+  name: test-guti
+spec:
+  revision: 0`
+		req := object.New()
+		err := yaml.Unmarshal([]byte(yamlData), req)
+		Expect(err).NotTo(HaveOccurred())
+		err = c.Create(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		// concurrent writers race with the status updates of the controller
+		var wg sync.WaitGroup
+		for i := 1; i <= 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					obj := object.NewViewObject("udm", "Config")
+					if err := c.Get(ctx, types.NamespacedName{Name: "test-guti"}, obj); err != nil {
+						return err
+					}
+					labels := obj.GetLabels()
+					if labels == nil {
+						labels = map[string]string{}
+					}
+					labels[fmt.Sprintf("writer-%d", i)] = "done"
+					obj.SetLabels(labels)
+					if err := unstructured.SetNestedField(obj.UnstructuredContent(), int64(i),
+						"spec", "revision"); err != nil {
+						return err
+					}
+					return c.Update(ctx, obj)
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		// all writes survive and the final status reflects the latest generation
+		obj := object.NewViewObject("udm", "Config")
+		Eventually(func() bool {
+			if err := c.Get(ctx, types.NamespacedName{Name: "test-guti"}, obj); err != nil {
+				return false
+			}
+			for i := 1; i <= 8; i++ {
+				if obj.GetLabels()[fmt.Sprintf("writer-%d", i)] != "done" {
+					return false
+				}
+			}
+			conds, ok, err := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			if err != nil || !ok || len(conds) != 1 {
+				return false
+			}
+			g, ok := conds[0].(map[string]any)["observedGeneration"].(int64)
+			return ok && g == obj.GetGeneration() && obj.GetLabels()["state"] == "Ready"
+		}, timeout, interval).Should(BeTrue())
+	})
+})
+
+var _ = Describe("UDM Operator with a config selector", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.WithWatch
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		c = startUDM(ctx, Options{
+			HTTPMode: true,
+			Insecure: true,
+			ConfigSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"shard": "0"},
+			},
+		})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should ignore the configs not matching the selector", func() {
+		for _, cfg := range []struct{ name, shard string }{{"guti-0", "0"}, {"guti-1", "1"}} {
+			req := object.NewViewObject("udm", "Config")
+			req.SetName(cfg.name)
+			req.SetLabels(map[string]string{"shard": cfg.shard})
+			Expect(c.Create(ctx, req)).To(Succeed())
+		}
+
+		obj := object.NewViewObject("udm", "Config")
+		Eventually(func() bool {
+			if err := c.Get(ctx, types.NamespacedName{Name: "guti-0"}, obj); err != nil {
+				return false
+			}
+			return obj.GetLabels()["state"] == "Ready"
+		}, timeout, interval).Should(BeTrue())
+
+		Consistently(func() bool {
+			if err := c.Get(ctx, types.NamespacedName{Name: "guti-1"}, obj); err != nil {
+				return false
+			}
+			_, ok, _ := unstructured.NestedMap(obj.UnstructuredContent(), "status")
+			return !ok && obj.GetLabels()["state"] == ""
+		}, 10*interval, interval).Should(BeTrue())
+	})
+})
+
+var _ = Describe("UDM Operator with a token TTL", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.WithWatch
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		c = startUDM(ctx, Options{HTTPMode: true, Insecure: true, TokenTTL: time.Hour})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should issue tokens expiring after the TTL", func() {
+		req := object.NewViewObject("udm", "Config")
+		req.SetName("guti-ttl")
+		Expect(c.Create(ctx, req)).To(Succeed())
+
+		obj := object.NewViewObject("udm", "Config")
+		Eventually(func() string {
+			if err := c.Get(ctx, types.NamespacedName{Name: "guti-ttl"}, obj); err != nil {
+				return ""
+			}
+			return ConfigToken(obj)
+		}, timeout, interval).ShouldNot(BeEmpty())
+
+		claims := &auth.Claims{}
+		_, _, err := jwt.NewParser().ParseUnverified(ConfigToken(obj), claims)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.ExpiresAt).NotTo(BeNil())
+		Expect(claims.IssuedAt).NotTo(BeNil())
+		Expect(claims.ExpiresAt.Sub(claims.IssuedAt.Time)).To(Equal(time.Hour))
+		Expect(claims.ExpiresAt.Time).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+	})
+})
+
+var _ = Describe("UDM Operator with a token TTL ceiling", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.WithWatch
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		c = startUDM(ctx, Options{HTTPMode: true, Insecure: true, TokenTTL: 365 * 24 * time.Hour,
+			MaxTokenTTL: time.Hour})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should cap the lifetime of the tokens at the ceiling", func() {
+		req := object.NewViewObject("udm", "Config")
+		req.SetName("guti-max-ttl")
+		Expect(c.Create(ctx, req)).To(Succeed())
+
+		obj := object.NewViewObject("udm", "Config")
+		Eventually(func() string {
+			if err := c.Get(ctx, types.NamespacedName{Name: "guti-max-ttl"}, obj); err != nil {
+				return ""
+			}
+			return ConfigToken(obj)
+		}, timeout, interval).ShouldNot(BeEmpty())
+
+		claims := &auth.Claims{}
+		_, _, err := jwt.NewParser().ParseUnverified(ConfigToken(obj), claims)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.ExpiresAt).NotTo(BeNil())
+		Expect(claims.IssuedAt).NotTo(BeNil())
+		Expect(claims.ExpiresAt.Sub(claims.IssuedAt.Time)).To(Equal(time.Hour))
+	})
+})
+
+var _ = Describe("Token audit", func() {
+	It("should prune the records of deleted UEs after the retention window", func() {
+		now := time.Now()
+		a := newTokenAudit(time.Hour)
+		a.now = func() time.Time { return now }
+
+		a.issued("user-old")
+		a.issued("user-recent")
+		a.issued("user-active")
+		a.deleted("user-old")
+
+		now = now.Add(30 * time.Minute)
+		a.deleted("user-recent")
+		Expect(a.prune()).To(BeZero())
+		Expect(a.list()).To(HaveLen(3))
+
+		// advance past the retention of user-old but not of user-recent
+		now = now.Add(45 * time.Minute)
+		Expect(a.prune()).To(Equal(1))
+
+		recs := a.list()
+		Expect(recs).To(HaveLen(2))
+		Expect(recs[0].User).To(Equal("user-active"))
+		Expect(recs[0].Deleted).To(BeNil())
+		Expect(recs[1].User).To(Equal("user-recent"))
+		Expect(recs[1].Deleted).NotTo(BeNil())
+
+		// active UEs are never pruned
+		now = now.Add(24 * time.Hour)
+		Expect(a.prune()).To(Equal(1))
+		recs = a.list()
+		Expect(recs).To(HaveLen(1))
+		Expect(recs[0].User).To(Equal("user-active"))
+		Expect(recs[0].Issued).To(Equal(1))
+	})
+
+	It("should restart the retention of a UE that is issued a new token", func() {
+		now := time.Now()
+		a := newTokenAudit(time.Hour)
+		a.now = func() time.Time { return now }
+
+		a.issued("user-1")
+		a.deleted("user-1")
+		now = now.Add(30 * time.Minute)
+		a.issued("user-1")
+
+		now = now.Add(2 * time.Hour)
+		Expect(a.prune()).To(BeZero())
+		recs := a.list()
+		Expect(recs).To(HaveLen(1))
+		Expect(recs[0].Issued).To(Equal(2))
+		Expect(recs[0].Deleted).To(BeNil())
+	})
+})
+
+// startUDM starts a UDM operator on a fresh shared cache and returns the cache client.
+func startUDM(ctx context.Context, opts Options) client.WithWatch {
+	_, c := startUDMOp(ctx, opts)
+	return c
+}
+
+// startUDMOp starts the UDM and returns the operator along with the client.
+func startUDMOp(ctx context.Context, opts Options) (*UDM, client.WithWatch) {
+	sharedCache := cache.NewViewCache(cache.CacheOptions{Logger: logger})
+
+	// must load op manually: testsuite.StartOps would create a dctrl object that would import us
+	cert, key, err := auth.GenerateSelfSignedCertWithSANs([]string{"localhost"})
+	Expect(err).NotTo(HaveOccurred())
+	// a per-test directory so that parallel suites do not clobber each other's keys
+	dir := GinkgoT().TempDir()
+	keyFile, certFile := filepath.Join(dir, "apiserver.key"), filepath.Join(dir, "apiserver.crt")
+	err = auth.WriteCertAndKey(keyFile, certFile, key, cert)
+	Expect(err).NotTo(HaveOccurred())
+
+	port := randomPort()
+	apiServerConfig, err := apiserver.NewDefaultConfig("localhost", port, sharedCache.GetClient(),
+		true, false, logger)
+	Expect(err).NotTo(HaveOccurred())
+
+	apiServer, err := apiserver.NewAPIServer(apiServerConfig)
+	Expect(err).NotTo(HaveOccurred())
+
+	opts.Cache = sharedCache
+	opts.KeyFile = keyFile
+	opts.Logger = logger
+	udm, err := New(apiServer, opts)
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() {
+		defer GinkgoRecover()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-udm.GetErrorChannel():
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+	}()
+
+	go func() {
+		defer GinkgoRecover()
+		err := udm.Start(ctx) // will start the view cache
+		Expect(err).NotTo(HaveOccurred())
+	}()
+
+	c := sharedCache.GetClient()
+	Expect(c).NotTo(BeNil())
+	return udm, c
+}
+
+var _ = Describe("UDM Operator with a retry backoff", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		u      *UDM
+		c      client.WithWatch
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		u, c = startUDMOp(ctx, Options{
+			HTTPMode: true,
+			Insecure: true,
+			// the test drives the reconciles
+			ConfigSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"shard": "none"},
+			},
+			RetryBackoff: RetryBackoff{
+				Initial: 100 * time.Millisecond,
+				Max:     time.Second,
+				Factor:  2,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should requeue the failed configs with an increasing delay", func() {
+		req := object.NewViewObject("udm", "Config")
+		req.SetName("test-guti")
+		Expect(c.Create(ctx, req)).To(Succeed())
+
+		failing := true
+		u.c.kubeConfig = func(obj object.Object) (map[string]any, error) {
+			if failing {
+				return nil, errors.New("transient failure")
+			}
+			return u.c.getKubeConfig(obj)
+		}
+
+		reconcileConfig := func() (reconcile.Result, map[string]any) {
+			obj := object.NewViewObject("udm", "Config")
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-guti"}, obj)).To(Succeed())
+			res, err := u.c.Reconcile(ctx, reconciler.Request{
+				Object:    obj,
+				GVK:       obj.GroupVersionKind(),
+				EventType: object.Updated,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-guti"}, obj)).To(Succeed())
+			status, _, err := unstructured.NestedMap(obj.UnstructuredContent(), "status")
+			Expect(err).NotTo(HaveOccurred())
+			return res, status
+		}
+
+		for i, delay := range []time.Duration{
+			100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+			800 * time.Millisecond, time.Second, time.Second,
+		} {
+			res, status := reconcileConfig()
+			Expect(res.RequeueAfter).To(Equal(delay))
+			Expect(status).To(HaveKeyWithValue("retryCount", int64(i+1)))
+			conds := status["conditions"].([]any)
+			Expect(conds[0]).To(HaveKeyWithValue("reason", "ConfigUnavailable"))
+		}
+
+		// success resets the backoff
+		failing = false
+		res, status := reconcileConfig()
+		Expect(res).To(Equal(reconcile.Result{}))
+		Expect(status).NotTo(HaveKey("retryCount"))
+		Expect(status).To(HaveKey("config"))
+
+		failing = true
+		res, status = reconcileConfig()
+		Expect(res.RequeueAfter).To(Equal(100 * time.Millisecond))
+		Expect(status).To(HaveKeyWithValue("retryCount", int64(1)))
+	})
+})
+
+var _ = Describe("UDM subscribed NSSAI", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.WithWatch
+		store  SubscriberStore
+	)
+
+	BeforeEach(func() {
+		ctrl.SetLogger(logger.WithName("dctrl5g-test"))
+		ctx, cancel = context.WithCancel(context.Background())
+		store = NewMemorySubscriberStore()
+		Expect(store.Put(context.Background(), Subscriber{
+			SUPI:         "imsi-999010000000123",
+			AllowedNSSAI: []string{"eMBB"},
+		})).To(Succeed())
+		c = startUDM(ctx, Options{HTTPMode: true, Insecure: true, SubscriberStore: store})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	eMBB := map[string]any{"sliceType": "eMBB", "sliceDifferentiator": "000001"}
+	urllc := map[string]any{"sliceType": "URLLC", "sliceDifferentiator": "000002"}
+
+	It("should intersect the requested and the subscribed NSSAI", func() {
+		Expect(intersectNSSAI([]any{eMBB, urllc}, []string{"eMBB"})).To(Equal([]any{eMBB}))
+		Expect(intersectNSSAI([]any{urllc, eMBB}, []string{"eMBB", "URLLC"})).To(Equal([]any{urllc, eMBB}))
+		Expect(intersectNSSAI([]any{urllc}, []string{"eMBB"})).To(BeEmpty())
+		Expect(intersectNSSAI(nil, []string{"eMBB"})).To(BeEmpty())
+	})
+
+	// config creates a config of a SUPI requesting an NSSAI and returns a poller for the reason of
+	// the Ready condition and the allowed NSSAI in the status
+	config := func(name, supi string, nssai ...any) func() []any {
+		req := object.NewViewObject("udm", "Config")
+		req.SetName(name)
+		Expect(unstructured.SetNestedMap(req.UnstructuredContent(), map[string]any{
+			"supi":           supi,
+			"requestedNSSAI": nssai,
+		}, "spec")).To(Succeed())
+		Expect(c.Create(ctx, req)).To(Succeed())
+
+		return func() []any {
+			obj := object.NewViewObject("udm", "Config")
+			if err := c.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+				return nil
+			}
+			conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+			if len(conds) == 0 {
+				return nil
+			}
+			allowed, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "allowedNSSAI")
+			return []any{conds[0].(map[string]any)["reason"], allowed}
+		}
+	}
+
+	It("should allow the subscribed S-NSSAIs of the requested NSSAI", func() {
+		Eventually(config("guti-1", "imsi-999010000000123", eMBB, urllc), timeout, interval).
+			Should(Equal([]any{"Ready", []any{eMBB}}))
+	})
+
+	It("should reject a config requesting no subscribed S-NSSAI", func() {
+		Eventually(config("guti-1", "imsi-999010000000123", urllc), timeout, interval).
+			Should(Equal([]any{"NoAllowedNSSAI", []any(nil)}))
+	})
+
+	It("should allow the requested NSSAI of a SUPI without a subscriber record", func() {
+		Eventually(config("guti-1", "imsi-999010000000124", eMBB, urllc), timeout, interval).
+			Should(Equal([]any{"Ready", []any{eMBB, urllc}}))
+	})
 })
 
 func randomPort() int {
@@ -175,3 +645,43 @@ func randomPort() int {
 	}
 	return int(n.Int64()) + minPort
 }
+
+var _ = Describe("UDM token pool", func() {
+	It("should issue fresh pooled tokens once and count the misses", func() {
+		now := time.Now()
+		p := newTokenPool(1)
+		p.now = func() time.Time { return now }
+
+		Expect(p.wants("user-1")).To(BeTrue())
+		p.put("user-1", "token-1")
+		Expect(p.wants("user-1")).To(BeFalse())
+
+		// the pool is full
+		Expect(p.wants("user-2")).To(BeFalse())
+		p.put("user-2", "token-2")
+
+		token, ok := p.take("user-1")
+		Expect(ok).To(BeTrue())
+		Expect(token).To(Equal("token-1"))
+		_, ok = p.take("user-1")
+		Expect(ok).To(BeFalse())
+		_, ok = p.take("user-2")
+		Expect(ok).To(BeFalse())
+
+		Expect(p.hits.Load()).To(Equal(uint64(1)))
+		Expect(p.misses.Load()).To(Equal(uint64(2)))
+	})
+
+	It("should not issue stale tokens", func() {
+		now := time.Now()
+		p := newTokenPool(1)
+		p.now = func() time.Time { return now }
+
+		p.put("user-1", "token-1")
+		now = now.Add(tokenPoolMaxAge + time.Second)
+		Expect(p.wants("user-1")).To(BeTrue())
+
+		_, ok := p.take("user-1")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,447 @@
+package upf
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/operator"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+// The charging views maintained by the charging controller.
+const (
+	chargingRecordKind = "ChargingRecord"
+	chargingTableKind  = "ChargingTable"
+	chargingTableName  = "charging-records"
+	smfOperatorName    = "smf"
+	sessionContextKind = "SessionContext"
+)
+
+// The states of a charging record.
+const (
+	// ChargingActive is the state of a session with a data path.
+	ChargingActive = "Active"
+	// ChargingPaused is the state of an idle session, whose data path is released.
+	ChargingPaused = "Paused"
+	// ChargingStopped is the state of a terminated session.
+	ChargingStopped = "Stopped"
+)
+
+// AddCharging adds the charging controller to the UPF operator. The controller records the
+// lifetime of the data path of each session in a upf/ChargingRecord named after the session in
+// the namespace of the UE:
+//
+//	apiVersion: upf.view.dcontroller.io/v1alpha1
+//	kind: ChargingRecord
+//	metadata:
+//	  name: user-1
+//	  namespace: user-1
+//	spec:
+//	  guti: "999-01-..."
+//	  sessionId: 1
+//	  state: Paused
+//	  startTime: "2025-01-01T00:00:00Z"
+//	  intervals:
+//	    - {start: "2025-01-01T00:00:00Z", stop: "2025-01-01T00:10:00Z"}
+//	  durationSeconds: 600
+//	  volume: {uplinkBytes: 0, downlinkBytes: 0}
+//
+// An interval is opened when the first upf/Config of the session appears and closed when the last
+// one disappears, so an idle session is paused and resumed on the same record, and the configs of
+// a handover count as a single data path. The record is stopped when the smf/SessionContext is
+// deleted, and kept for the charging system to collect. The volume is a placeholder until the
+// data path reports the transferred bytes. The records are summarized in the
+// upf/ChargingTable named charging-records.
+func AddCharging(op *operator.Operator, opts Options) error {
+	mgr := op.GetManager()
+	r := &chargingController{
+		Client:   opts.Cache.(*cache.ViewCache).GetClient(),
+		clock:    opts.Clock,
+		sessions: map[client.ObjectKey]*chargingSession{},
+		configs:  map[client.ObjectKey]client.ObjectKey{},
+		log:      opts.Logger.WithName("upf-charging"),
+	}
+	if r.clock == nil {
+		r.clock = time.Now
+	}
+
+	on := true
+	c, err := controller.NewTyped(chargingControllerName, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler:         opts.Work.TrackReconciler(metrics.InstrumentReconciler(OperatorName, r)),
+		NewQueue:           opts.Work.NewQueue(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the records and the table are watched to restore them if deleted
+	smfGroup := smfOperatorName + ".view.dcontroller.io"
+	gvks := []schema.GroupVersionKind{}
+	for _, res := range []opv1a1.Resource{
+		{Kind: "Config"},
+		{Group: &smfGroup, Kind: sessionContextKind},
+		{Kind: chargingRecordKind},
+		{Kind: chargingTableKind},
+	} {
+		s := reconciler.NewSource(mgr, OperatorName, opv1a1.Source{Resource: res})
+		gvk, err := s.GetGVK()
+		if err != nil {
+			return fmt.Errorf("failed to get GVK for source: %w", err)
+		}
+		// only the UPF kinds are served by the UPF
+		if res.Group == nil {
+			gvks = append(gvks, gvk)
+		}
+
+		src, err := s.GetSource()
+		if err != nil {
+			return fmt.Errorf("failed to create source: %w", err)
+		}
+
+		if err := c.Watch(src); err != nil {
+			return fmt.Errorf("failed to create watch: %w", err)
+		}
+	}
+
+	op.AddNativeController("charging-ctrl", c, gvks)
+
+	r.log.Info("created UPF charging controller")
+
+	return nil
+}
+
+// chargingInterval is an interval of a session with a data path.
+type chargingInterval struct {
+	start time.Time
+	stop  *time.Time
+}
+
+// chargingSession is the charging state of a session.
+type chargingSession struct {
+	guti      string
+	sessionID int64
+	intervals []chargingInterval
+	stop      *time.Time
+	configs   map[string]bool // the live configs of the session
+}
+
+func (s *chargingSession) spec() map[string]any {
+	state := ChargingPaused
+	switch {
+	case s.stop != nil:
+		state = ChargingStopped
+	case len(s.configs) > 0:
+		state = ChargingActive
+	}
+
+	var d time.Duration
+	intervals := make([]any, 0, len(s.intervals))
+	for _, i := range s.intervals {
+		interval := map[string]any{"start": i.start.Format(time.RFC3339)}
+		if i.stop != nil {
+			interval["stop"] = i.stop.Format(time.RFC3339)
+			d += i.stop.Sub(i.start)
+		}
+		intervals = append(intervals, interval)
+	}
+
+	spec := map[string]any{
+		"guti":            s.guti,
+		"sessionId":       s.sessionID,
+		"state":           state,
+		"intervals":       intervals,
+		"durationSeconds": int64(d / time.Second),
+		"volume":          map[string]any{"uplinkBytes": int64(0), "downlinkBytes": int64(0)},
+	}
+	if len(s.intervals) > 0 {
+		spec["startTime"] = s.intervals[0].start.Format(time.RFC3339)
+	}
+	if s.stop != nil {
+		spec["stopTime"] = s.stop.Format(time.RFC3339)
+	}
+	return spec
+}
+
+// pause closes the open interval of the session, if any.
+func (s *chargingSession) pause(now time.Time) {
+	if n := len(s.intervals); n > 0 && s.intervals[n-1].stop == nil {
+		s.intervals[n-1].stop = &now
+	}
+}
+
+// chargingController maintains the charging records of the sessions.
+type chargingController struct {
+	client.Client
+	clock    func() time.Time
+	mu       sync.Mutex
+	sessions map[client.ObjectKey]*chargingSession // the sessions not stopped yet
+	configs  map[client.ObjectKey]client.ObjectKey // the session of each live config
+	log      logr.Logger
+}
+
+func (r *chargingController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	r.log.V(2).Info("Reconciling", "request", req.String())
+
+	key := client.ObjectKeyFromObject(req.Object)
+	switch req.GVK.Kind {
+	case "Config":
+		if req.EventType == object.Deleted {
+			return reconcile.Result{}, r.releaseConfig(ctx, key)
+		}
+		session, _, _ := unstructured.NestedString(req.Object.UnstructuredContent(), "spec", "session")
+		if session == "" {
+			session = key.Name
+		}
+		return reconcile.Result{}, r.addConfig(ctx, key, client.ObjectKey{Namespace: key.Namespace, Name: session})
+
+	case sessionContextKind:
+		if req.EventType != object.Deleted {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, r.stop(ctx, key)
+
+	case chargingRecordKind:
+		// restore the record of a session not stopped yet
+		if req.EventType == object.Deleted {
+			r.mu.Lock()
+			s, ok := r.sessions[key]
+			var spec map[string]any
+			if ok {
+				spec = s.spec()
+			}
+			r.mu.Unlock()
+			if ok {
+				if err := r.write(ctx, key, spec); err != nil {
+					return reconcile.Result{}, err
+				}
+			}
+		}
+		return reconcile.Result{}, r.syncTable(ctx)
+
+	default:
+		if req.EventType != object.Deleted {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, r.syncTable(ctx)
+	}
+}
+
+// addConfig opens an interval of the session of a new config, unless the session has a data path
+// already. A session seen for the first time, or again after it was stopped, gets a new record.
+func (r *chargingController) addConfig(ctx context.Context, cfg, key client.ObjectKey) error {
+	now := r.clock()
+	r.mu.Lock()
+	r.configs[cfg] = key
+	s, ok := r.sessions[key]
+	if !ok {
+		s = &chargingSession{configs: map[string]bool{}}
+		r.sessions[key] = s
+	}
+	if s.configs[cfg.Name] {
+		r.mu.Unlock()
+		return nil
+	}
+	if len(s.configs) == 0 {
+		s.intervals = append(s.intervals, chargingInterval{start: now})
+	}
+	s.configs[cfg.Name] = true
+	r.mu.Unlock()
+
+	if !ok {
+		guti, sessionID, err := r.sessionIdentity(ctx, key)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		s.guti, s.sessionID = guti, sessionID
+		r.mu.Unlock()
+		r.log.V(1).Info("charging session", "session", key.String())
+	}
+
+	return r.writeSession(ctx, key, s)
+}
+
+// releaseConfig closes the interval of the session of a deleted config once the session has no
+// data path. The session is stopped if the session context is gone, and paused otherwise, e.g.,
+// when idle.
+func (r *chargingController) releaseConfig(ctx context.Context, cfg client.ObjectKey) error {
+	now := r.clock()
+	r.mu.Lock()
+	key, ok := r.configs[cfg]
+	delete(r.configs, cfg)
+	s := r.sessions[key]
+	if !ok || s == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	delete(s.configs, cfg.Name)
+	released := len(s.configs) == 0
+	if released {
+		s.pause(now)
+	}
+	r.mu.Unlock()
+
+	if released {
+		sc := object.NewViewObject(smfOperatorName, sessionContextKind)
+		if err := r.Get(ctx, key, sc); err != nil {
+			if apierrors.IsNotFound(err) {
+				return r.stop(ctx, key)
+			}
+			return err
+		}
+	}
+
+	return r.writeSession(ctx, key, s)
+}
+
+// stop stops the record of a deleted session, with the end of its last interval.
+func (r *chargingController) stop(ctx context.Context, key client.ObjectKey) error {
+	now := r.clock()
+	r.mu.Lock()
+	s, ok := r.sessions[key]
+	if !ok {
+		r.mu.Unlock()
+		return nil
+	}
+	s.pause(now)
+	stop := now
+	if n := len(s.intervals); n > 0 {
+		stop = *s.intervals[n-1].stop
+	}
+	s.stop = &stop
+	for cfg, k := range r.configs {
+		if k == key {
+			delete(r.configs, cfg)
+		}
+	}
+	s.configs = map[string]bool{}
+	delete(r.sessions, key)
+	spec := s.spec()
+	r.mu.Unlock()
+
+	r.log.V(1).Info("charging session stopped", "session", key.String())
+	return r.write(ctx, key, spec)
+}
+
+// sessionIdentity returns the GUTI and the session id of a session context, empty if the session
+// context is gone.
+func (r *chargingController) sessionIdentity(ctx context.Context, key client.ObjectKey) (string, int64, error) {
+	sc := object.NewViewObject(smfOperatorName, sessionContextKind)
+	if err := r.Get(ctx, key, sc); err != nil {
+		return "", 0, client.IgnoreNotFound(err)
+	}
+	guti, _, _ := unstructured.NestedString(sc.UnstructuredContent(), "spec", "guti")
+	sessionID, _, _ := unstructured.NestedInt64(sc.UnstructuredContent(), "spec", "sessionId")
+	return guti, sessionID, nil
+}
+
+func (r *chargingController) writeSession(ctx context.Context, key client.ObjectKey, s *chargingSession) error {
+	r.mu.Lock()
+	spec := s.spec()
+	r.mu.Unlock()
+	return r.write(ctx, key, spec)
+}
+
+// write creates or updates the charging record of a session.
+func (r *chargingController) write(ctx context.Context, key client.ObjectKey, spec map[string]any) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject(OperatorName, chargingRecordKind)
+		if err := r.Get(ctx, key, obj); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			obj = object.NewViewObject(OperatorName, chargingRecordKind)
+			object.SetName(obj, key.Namespace, key.Name)
+			if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+				return err
+			}
+			return r.Create(ctx, obj)
+		}
+
+		if current, _, _ := unstructured.NestedMap(obj.UnstructuredContent(), "spec"); reflect.DeepEqual(current, spec) {
+			return nil
+		}
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), spec, "spec"); err != nil {
+			return err
+		}
+		return r.Update(ctx, obj)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write charging record %s: %w", key, err)
+	}
+	return nil
+}
+
+// syncTable summarizes the charging records in the upf/ChargingTable, ordered by the namespace
+// and the name of the records.
+func (r *chargingController) syncTable(ctx context.Context) error {
+	list := cache.NewViewObjectList(OperatorName, chargingRecordKind)
+	if err := r.List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list charging records: %w", err)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		if list.Items[i].GetNamespace() != list.Items[j].GetNamespace() {
+			return list.Items[i].GetNamespace() < list.Items[j].GetNamespace()
+		}
+		return list.Items[i].GetName() < list.Items[j].GetName()
+	})
+
+	records := make([]any, 0, len(list.Items))
+	for i := range list.Items {
+		spec, _, _ := unstructured.NestedMap(list.Items[i].Object, "spec")
+		entry := map[string]any{
+			"namespace": list.Items[i].GetNamespace(),
+			"name":      list.Items[i].GetName(),
+		}
+		for _, f := range []string{"guti", "sessionId", "state", "startTime", "stopTime", "durationSeconds"} {
+			if v, ok := spec[f]; ok {
+				entry[f] = v
+			}
+		}
+		intervals, _, _ := unstructured.NestedSlice(spec, "intervals")
+		entry["intervals"] = int64(len(intervals))
+		records = append(records, entry)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		table := object.NewViewObject(OperatorName, chargingTableKind)
+		if err := r.Get(ctx, client.ObjectKey{Name: chargingTableName}, table); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			table = object.NewViewObject(OperatorName, chargingTableKind)
+			object.SetName(table, "", chargingTableName)
+			if err := unstructured.SetNestedSlice(table.UnstructuredContent(), records, "spec", "records"); err != nil {
+				return err
+			}
+			return r.Create(ctx, table)
+		}
+
+		if current, _, _ := unstructured.NestedSlice(table.UnstructuredContent(), "spec", "records"); reflect.DeepEqual(current, records) {
+			return nil
+		}
+		if err := unstructured.SetNestedSlice(table.UnstructuredContent(), records, "spec", "records"); err != nil {
+			return err
+		}
+		return r.Update(ctx, table)
+	})
+}
@@ -0,0 +1,260 @@
+// UPF: User Plane Function config export
+//
+// The declarative UPF operator (upf.yaml) maintains the per-session upf/Config objects written by
+// the SMF. The export controller renders each config into the shape expected by a specific UPF
+// implementation other than the native one and stores the result in the status of the config, and
+// the charging controller records the lifetime of the data path of each session for charging.
+package upf
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	opv1a1 "github.com/l7mp/dcontroller/pkg/api/operator/v1alpha1"
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+	"github.com/l7mp/dcontroller/pkg/operator"
+	"github.com/l7mp/dcontroller/pkg/reconciler"
+
+	"github.com/hsnlab/dctrl5g/internal/metrics"
+)
+
+const OperatorName = "upf"
+
+// The names of the native controllers added to the UPF.
+const (
+	exportControllerName   = "upf-export-controller"
+	chargingControllerName = "upf-charging-controller"
+)
+
+// Transform renders the spec of a upf/Config into the config shape of a UPF implementation.
+type Transform func(spec map[string]any) (map[string]any, error)
+
+// Transforms are the built-in transforms, selectable by name.
+var Transforms = map[string]Transform{
+	"native":  Native,
+	"free5gc": Free5GC,
+	"open5gs": Open5GS,
+}
+
+type Options struct {
+	Cache cache.Cache
+	// Format selects a built-in transform (default: native).
+	Format string
+	// Transform, if set, overrides Format.
+	Transform Transform
+	// Clock returns the current time of the charging records (default: time.Now).
+	Clock func() time.Time
+	// Work, if set, tracks the requests queued for and being reconciled by the native
+	// controllers, for the drains.
+	Work   *metrics.Work
+	Logger logr.Logger
+}
+
+// AddExporter adds the config export controller to the UPF operator. The native shape is the spec
+// of the config as is, so no controller is added for the native format unless a custom transform
+// is set.
+func AddExporter(op *operator.Operator, opts Options) error {
+	transform := opts.Transform
+	if transform == nil {
+		format := opts.Format
+		if format == "" || format == "native" {
+			return nil
+		}
+		t, ok := Transforms[format]
+		if !ok {
+			return fmt.Errorf("unknown UPF config format %q", format)
+		}
+		transform = t
+	}
+
+	mgr := op.GetManager()
+	r := &exportController{
+		Client:    opts.Cache.(*cache.ViewCache).GetClient(),
+		transform: transform,
+		log:       opts.Logger.WithName("upf-export"),
+	}
+
+	on := true
+	c, err := controller.NewTyped(exportControllerName, mgr, controller.TypedOptions[reconciler.Request]{
+		SkipNameValidation: &on,
+		Reconciler:         opts.Work.TrackReconciler(metrics.InstrumentReconciler(OperatorName, r)),
+		NewQueue:           opts.Work.NewQueue(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s := reconciler.NewSource(mgr, OperatorName, opv1a1.Source{
+		Resource: opv1a1.Resource{
+			Kind: "Config",
+		},
+	})
+	gvk, err := s.GetGVK()
+	if err != nil {
+		return fmt.Errorf("failed to get GVK for source: %w", err)
+	}
+
+	src, err := s.GetSource()
+	if err != nil {
+		return fmt.Errorf("failed to create source: %w", err)
+	}
+
+	if err := c.Watch(src); err != nil {
+		return fmt.Errorf("failed to create watch: %w", err)
+	}
+
+	// the Config GVK is already registered by the declarative controllers
+	op.AddNativeController("export-ctrl", c, []schema.GroupVersionKind{gvk})
+
+	r.log.Info("created UPF export controller")
+
+	return nil
+}
+
+// exportController implements the config export controller.
+type exportController struct {
+	client.Client
+	transform Transform
+	log       logr.Logger
+}
+
+func (r *exportController) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
+	if req.EventType == object.Deleted {
+		return reconcile.Result{}, nil
+	}
+
+	key := client.ObjectKeyFromObject(req.Object)
+	r.log.V(2).Info("Reconciling", "request", req.String())
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := object.NewViewObject(OperatorName, "Config")
+		if err := r.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		spec, _, err := unstructured.NestedMap(obj.UnstructuredContent(), "spec")
+		if err != nil {
+			return err
+		}
+		exported, err := r.transform(spec)
+		if err != nil {
+			return fmt.Errorf("failed to transform config: %w", err)
+		}
+
+		current, _, _ := unstructured.NestedMap(obj.UnstructuredContent(), "status", "exported")
+		if reflect.DeepEqual(current, exported) {
+			return nil
+		}
+
+		if err := unstructured.SetNestedMap(obj.UnstructuredContent(), exported, "status", "exported"); err != nil {
+			return err
+		}
+		return r.Update(ctx, obj)
+	}); err != nil && !apierrors.IsNotFound(err) {
+		r.log.Error(err, "failed to export config", "key", key)
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// Native exports the config as is.
+func Native(spec map[string]any) (map[string]any, error) {
+	return runtime.DeepCopyJSON(spec), nil
+}
+
+// Free5GC exports the config in a flat, free5GC-style session shape.
+func Free5GC(spec map[string]any) (map[string]any, error) {
+	ip, _, _ := unstructured.NestedString(spec, "networkConfiguration", "ipConfiguration", "ipAddress")
+	flows, _, _ := unstructured.NestedSlice(spec, "qos", "flows")
+
+	qosFlows := []any{}
+	for i, f := range flows {
+		flow, ok := f.(map[string]any)
+		if !ok {
+			continue
+		}
+		q := map[string]any{"qfi": int64(i + 1), "5qi": flow["fiveQI"]}
+		if ul, ok, _ := unstructured.NestedInt64(flow, "bitRates", "uplinkBwKbps"); ok {
+			q["mbrUL"] = fmt.Sprintf("%d Kbps", ul)
+		}
+		if dl, ok, _ := unstructured.NestedInt64(flow, "bitRates", "downlinkBwKbps"); ok {
+			q["mbrDL"] = fmt.Sprintf("%d Kbps", dl)
+		}
+		qosFlows = append(qosFlows, q)
+	}
+
+	session := map[string]any{"ueIp": ip, "qosFlows": qosFlows}
+	if ul, ok, _ := unstructured.NestedInt64(spec, "sessionAmbr", "uplinkKbps"); ok {
+		session["sessionAmbrUL"] = fmt.Sprintf("%d Kbps", ul)
+	}
+	if dl, ok, _ := unstructured.NestedInt64(spec, "sessionAmbr", "downlinkKbps"); ok {
+		session["sessionAmbrDL"] = fmt.Sprintf("%d Kbps", dl)
+	}
+	if tunnel, ok, _ := unstructured.NestedMap(spec, "tunnel"); ok {
+		session["ulTeid"] = tunnel["uplinkTeid"]
+		session["dlTeid"] = tunnel["downlinkTeid"]
+		session["n3Addr"] = tunnel["n3Address"]
+	}
+	return session, nil
+}
+
+// Open5GS exports the config in a nested, Open5GS-style session shape.
+func Open5GS(spec map[string]any) (map[string]any, error) {
+	ip, _, _ := unstructured.NestedString(spec, "networkConfiguration", "ipConfiguration", "ipAddress")
+	gw, _, _ := unstructured.NestedString(spec, "networkConfiguration", "ipConfiguration", "defaultGateway")
+	dns, _, _ := unstructured.NestedMap(spec, "networkConfiguration", "dnsConfiguration")
+	flows, _, _ := unstructured.NestedSlice(spec, "qos", "flows")
+
+	pccRules := []any{}
+	for _, f := range flows {
+		flow, ok := f.(map[string]any)
+		if !ok {
+			continue
+		}
+		rule := map[string]any{"name": flow["name"], "qos": map[string]any{"index": flow["fiveQI"]}}
+		if br, ok, _ := unstructured.NestedMap(flow, "bitRates"); ok {
+			rule["qos"].(map[string]any)["mbr"] = map[string]any{
+				"uplink":   map[string]any{"value": br["uplinkBwKbps"], "unit": "Kbps"},
+				"downlink": map[string]any{"value": br["downlinkBwKbps"], "unit": "Kbps"},
+			}
+		}
+		pccRules = append(pccRules, rule)
+	}
+
+	session := map[string]any{
+		"ue":       map[string]any{"ipv4": ip},
+		"gateway":  gw,
+		"pcc_rule": pccRules,
+	}
+	if dns != nil {
+		session["dns"] = []any{dns["primaryDNS"], dns["secondaryDNS"]}
+	}
+	if ambr, ok, _ := unstructured.NestedMap(spec, "sessionAmbr"); ok {
+		session["ambr"] = map[string]any{
+			"uplink":   map[string]any{"value": ambr["uplinkKbps"], "unit": "Kbps"},
+			"downlink": map[string]any{"value": ambr["downlinkKbps"], "unit": "Kbps"},
+		}
+	}
+	if tunnel, ok, _ := unstructured.NestedMap(spec, "tunnel"); ok {
+		session["gtpu"] = map[string]any{
+			"address": tunnel["n3Address"],
+			"ul_teid": tunnel["uplinkTeid"],
+			"dl_teid": tunnel["downlinkTeid"],
+		}
+	}
+	return map[string]any{"session": session}, nil
+}
@@ -0,0 +1,281 @@
+// Package sidf implements the subscription identifier de-concealing function (SIDF) of the home
+// network, which recovers the SUPI of a UE from a SUCI concealed with one of the protection
+// schemes of 3GPP TS 33.501 Annex C: the null-scheme, ECIES Profile A (X25519) or ECIES Profile B
+// (secp256r1).
+package sidf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	ueclient "github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+// The protection scheme identifiers.
+const (
+	NullScheme = 0
+	ProfileA   = 1
+	ProfileB   = 2
+)
+
+// KeyIDHeader is the PEM header holding the home network public key identifier of a key (default:
+// 0).
+const KeyIDHeader = "Key-Id"
+
+const (
+	encKeyLen = 16 // AES-128
+	icbLen    = 16 // the initial counter block of AES-CTR
+	macKeyLen = 32 // HMAC-SHA-256
+	macLen    = 8
+)
+
+// ErrUnknownKey is returned for a SUCI concealed with a home network key the SIDF does not hold.
+var ErrUnknownKey = errors.New("unknown home network key")
+
+type keyRef struct {
+	scheme, id int
+}
+
+// SIDF de-conceals the SUCIs with the home network private keys.
+type SIDF struct {
+	keys map[keyRef]*ecdh.PrivateKey
+}
+
+// New returns a SIDF with no keys, which de-conceals the null-scheme SUCIs only.
+func New() *SIDF {
+	return &SIDF{keys: map[keyRef]*ecdh.PrivateKey{}}
+}
+
+// LoadKeys returns a SIDF with the home network private keys loaded from a PEM file: each block is
+// a PKCS#8 X25519 key (Profile A) or P-256 key (Profile B), with the home network public key
+// identifier in the Key-Id header.
+func LoadKeys(path string) (*SIDF, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read home network keys: %w", err)
+	}
+
+	s := New()
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		id := 0
+		if h, ok := block.Headers[KeyIDHeader]; ok {
+			if id, err = strconv.Atoi(h); err != nil {
+				return nil, fmt.Errorf("invalid home network key ID %q in %s", h, path)
+			}
+		}
+
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse home network key %d in %s: %w", id, path, err)
+		}
+		var key *ecdh.PrivateKey
+		switch k := k.(type) {
+		case *ecdh.PrivateKey:
+			key = k
+		case *ecdsa.PrivateKey:
+			if key, err = k.ECDH(); err != nil {
+				return nil, fmt.Errorf("invalid home network key %d in %s: %w", id, path, err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported home network key %d in %s: %T", id, path, k)
+		}
+		if err := s.AddKey(id, key); err != nil {
+			return nil, fmt.Errorf("invalid home network key %d in %s: %w", id, path, err)
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, fmt.Errorf("no home network keys in %s", path)
+	}
+	return s, nil
+}
+
+// AddKey adds a home network private key with the given home network public key identifier: an
+// X25519 key is used for Profile A and a P-256 key for Profile B.
+func (s *SIDF) AddKey(id int, key *ecdh.PrivateKey) error {
+	if id < 0 || id > 255 {
+		return fmt.Errorf("home network key ID %d out of range", id)
+	}
+	scheme, err := keyScheme(key.Curve())
+	if err != nil {
+		return err
+	}
+	s.keys[keyRef{scheme: scheme, id: id}] = key
+	return nil
+}
+
+func keyScheme(curve ecdh.Curve) (int, error) {
+	switch curve {
+	case ecdh.X25519():
+		return ProfileA, nil
+	case ecdh.P256():
+		return ProfileB, nil
+	default:
+		return 0, fmt.Errorf("unsupported curve %s", curve)
+	}
+}
+
+// IsConcealed returns true if the SUCI is in the 3GPP form and concealed with an ECIES profile,
+// i.e., not with the null-scheme.
+func IsConcealed(suci string) bool {
+	u, err := ueclient.ParseSUCI(suci)
+	if err != nil || u.ProtectionScheme == "" {
+		return false
+	}
+	scheme, err := strconv.Atoi(u.ProtectionScheme)
+	return err == nil && scheme != NullScheme
+}
+
+// Deconceal returns the SUPI of a SUCI in the 3GPP form, e.g., imsi-001010123456789 for
+// suci-0-001-01-0000-0-0-0123456789. Only the IMSI-based SUPIs are supported.
+func (s *SIDF) Deconceal(suci string) (string, error) {
+	u, err := ueclient.ParseSUCI(suci)
+	if err != nil {
+		return "", err
+	}
+	if u.ProtectionScheme == "" {
+		return "", fmt.Errorf("SUCI %q carries no protection scheme", suci)
+	}
+	if u.SUPIType != "0" {
+		return "", fmt.Errorf("unsupported SUPI type %q in SUCI %q", u.SUPIType, suci)
+	}
+	scheme, _ := strconv.Atoi(u.ProtectionScheme)
+	id, _ := strconv.Atoi(u.HomeNetworkKeyID)
+
+	var msin string
+	switch scheme {
+	case NullScheme:
+		msin = u.SchemeOutput
+	case ProfileA, ProfileB:
+		key, ok := s.keys[keyRef{scheme: scheme, id: id}]
+		if !ok {
+			return "", fmt.Errorf("%w %d for protection scheme %d", ErrUnknownKey, id, scheme)
+		}
+		output, err := hex.DecodeString(u.SchemeOutput)
+		if err != nil {
+			return "", fmt.Errorf("invalid scheme output in SUCI %q: %w", suci, err)
+		}
+		plaintext, err := decrypt(key, output)
+		if err != nil {
+			return "", fmt.Errorf("failed to de-conceal SUCI %q: %w", suci, err)
+		}
+		if msin, err = decodeTBCD(plaintext); err != nil {
+			return "", fmt.Errorf("failed to de-conceal SUCI %q: %w", suci, err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported protection scheme %d in SUCI %q", scheme, suci)
+	}
+
+	if msin == "" || strings.Trim(msin, "0123456789") != "" {
+		return "", fmt.Errorf("invalid MSIN %q in SUCI %q", msin, suci)
+	}
+	return "imsi-" + u.MCC + u.MNC + msin, nil
+}
+
+// decrypt decrypts the ECIES scheme output, i.e., the ephemeral public key of the UE, the
+// ciphertext and the MAC tag, with the home network private key.
+func decrypt(key *ecdh.PrivateKey, output []byte) ([]byte, error) {
+	// the ephemeral public key is sent compressed in Profile B
+	pubLen := 32
+	if key.Curve() == ecdh.P256() {
+		pubLen = 33
+	}
+	if len(output) < pubLen+macLen {
+		return nil, fmt.Errorf("scheme output too short: %d bytes", len(output))
+	}
+	ephemeral, ciphertext, tag := output[:pubLen], output[pubLen:len(output)-macLen], output[len(output)-macLen:]
+
+	pub, err := parsePublicKey(key.Curve(), ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key: %w", err)
+	}
+	shared, err := key.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	k := kdf(shared, ephemeral, encKeyLen+icbLen+macKeyLen)
+	encKey, icb, macKey := k[:encKeyLen], k[encKeyLen:encKeyLen+icbLen], k[encKeyLen+icbLen:]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil)[:macLen], tag) {
+		return nil, errors.New("MAC tag mismatch")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, icb).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+// parsePublicKey parses an X25519 public key or a compressed P-256 point.
+func parsePublicKey(curve ecdh.Curve, b []byte) (*ecdh.PublicKey, error) {
+	if curve != ecdh.P256() {
+		return curve.NewPublicKey(b)
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), b)
+	if x == nil {
+		return nil, errors.New("invalid compressed point")
+	}
+	return curve.NewPublicKey(uncompressed(x, y))
+}
+
+func uncompressed(x, y *big.Int) []byte {
+	b := make([]byte, 65)
+	b[0] = 4
+	x.FillBytes(b[1:33])
+	y.FillBytes(b[33:])
+	return b
+}
+
+// kdf is the ANSI X9.63 key derivation function with SHA-256.
+func kdf(shared, info []byte, n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	var counter [4]byte
+	for c := uint32(1); len(out) < n; c++ {
+		h := sha256.New()
+		h.Write(shared)
+		binary.BigEndian.PutUint32(counter[:], c)
+		h.Write(counter[:])
+		h.Write(info)
+		out = h.Sum(out)
+	}
+	return out[:n]
+}
+
+// decodeTBCD decodes the digits of a telephony BCD string: the low nibble of each byte holds the
+// first digit, and an odd number of digits is padded with 0xF.
+func decodeTBCD(b []byte) (string, error) {
+	var sb strings.Builder
+	for i, c := range b {
+		for j, d := range []byte{c & 0x0f, c >> 4} {
+			switch {
+			case d <= 9:
+				sb.WriteByte('0' + d)
+			case d == 0x0f && i == len(b)-1 && j == 1:
+				// filler
+			default:
+				return "", fmt.Errorf("invalid BCD digit %X", d)
+			}
+		}
+	}
+	return sb.String(), nil
+}
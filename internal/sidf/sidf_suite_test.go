@@ -0,0 +1,13 @@
+package sidf_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSIDF(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SIDF")
+}
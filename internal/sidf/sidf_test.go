@@ -0,0 +1,152 @@
+package sidf_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/sidf"
+)
+
+// The ECIES Profile A test vector of 3GPP TS 33.501 Annex C.4.3.
+const (
+	profileAPrivateKey   = "c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d"
+	profileASchemeOutput = "b2e92f836055a255837debf850b528997ce0201cb82adfe4be1f587d07d8457d" +
+		"cb02352410" + "cddd9e730ef3fa87"
+)
+
+var _ = Describe("SIDF", func() {
+	It("should resolve a null-scheme SUCI", func() {
+		supi, err := sidf.New().Deconceal("suci-0-001-01-0000-0-0-0123456789")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(supi).To(Equal("imsi-001010123456789"))
+		Expect(sidf.IsConcealed("suci-0-001-01-0000-0-0-0123456789")).To(BeFalse())
+	})
+
+	It("should de-conceal the Profile A test vector", func() {
+		key := profileAKey()
+		Expect(hex.EncodeToString(key.PublicKey().Bytes())).To(
+			Equal("5a8d38864820197c3394b92613b20b91633cbd897119273bf8e4a6f4eec0a650"))
+		s := sidf.New()
+		Expect(s.AddKey(1, key)).To(Succeed())
+
+		suci := "suci-0-001-01-0000-1-1-" + profileASchemeOutput
+		Expect(sidf.IsConcealed(suci)).To(BeTrue())
+		supi, err := s.Deconceal(suci)
+		Expect(err).NotTo(HaveOccurred())
+		// the plaintext of the vector is 00012080f6 in BCD
+		Expect(supi).To(Equal("imsi-00101001002086"))
+	})
+
+	It("should reject a tampered Profile A SUCI", func() {
+		s := sidf.New()
+		Expect(s.AddKey(1, profileAKey())).To(Succeed())
+
+		output := []byte(profileASchemeOutput)
+		output[len(output)-1] = '0'
+		_, err := s.Deconceal("suci-0-001-01-0000-1-1-" + string(output))
+		Expect(err).To(MatchError(ContainSubstring("MAC tag mismatch")))
+
+		_, err = s.Deconceal("suci-0-001-01-0000-1-2-" + profileASchemeOutput)
+		Expect(errors.Is(err, sidf.ErrUnknownKey)).To(BeTrue())
+	})
+
+	It("should de-conceal a Profile B SUCI", func() {
+		key, err := ecdh.P256().GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		s := sidf.New()
+		Expect(s.AddKey(3, key)).To(Succeed())
+
+		suci := fmt.Sprintf("suci-0-999-01-0000-2-3-%x", conceal(key.PublicKey(), []byte{0x00, 0x00, 0x00, 0x00, 0x21, 0xf3}))
+		supi, err := s.Deconceal(suci)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(supi).To(Equal("imsi-9990100000000123"))
+	})
+
+	It("should load the home network keys from a PEM file", func() {
+		b, err := ecdh.P256().GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		path := filepath.Join(GinkgoT().TempDir(), "hn.key")
+		var data []byte
+		for id, key := range map[string]*ecdh.PrivateKey{"1": profileAKey(), "2": b} {
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			data = append(data, pem.EncodeToMemory(&pem.Block{
+				Type:    "PRIVATE KEY",
+				Headers: map[string]string{sidf.KeyIDHeader: id},
+				Bytes:   der,
+			})...)
+		}
+		Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+
+		s, err := sidf.LoadKeys(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		supi, err := s.Deconceal("suci-0-001-01-0000-1-1-" + profileASchemeOutput)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(supi).To(Equal("imsi-00101001002086"))
+
+		supi, err = s.Deconceal(fmt.Sprintf("suci-0-001-01-0000-2-2-%x", conceal(b.PublicKey(), []byte{0x10, 0x32})))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(supi).To(Equal("imsi-001010123"))
+	})
+})
+
+func profileAKey() *ecdh.PrivateKey {
+	GinkgoHelper()
+	b, err := hex.DecodeString(profileAPrivateKey)
+	Expect(err).NotTo(HaveOccurred())
+	key, err := ecdh.X25519().NewPrivateKey(b)
+	Expect(err).NotTo(HaveOccurred())
+	return key
+}
+
+// conceal encrypts a BCD-encoded MSIN to the home network public key as the UE does.
+func conceal(hn *ecdh.PublicKey, plaintext []byte) []byte {
+	GinkgoHelper()
+	eph, err := hn.Curve().GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	shared, err := eph.ECDH(hn)
+	Expect(err).NotTo(HaveOccurred())
+
+	pub := eph.PublicKey().Bytes()
+	if hn.Curve() == ecdh.P256() {
+		// compress the point
+		pub = append([]byte{0x02 | pub[64]&1}, pub[1:33]...)
+	}
+
+	var k []byte
+	var counter [4]byte
+	for c := uint32(1); len(k) < 64; c++ {
+		h := sha256.New()
+		h.Write(shared)
+		binary.BigEndian.PutUint32(counter[:], c)
+		h.Write(counter[:])
+		h.Write(pub)
+		k = h.Sum(k)
+	}
+
+	block, err := aes.NewCipher(k[:16])
+	Expect(err).NotTo(HaveOccurred())
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, k[16:32]).XORKeyStream(ciphertext, plaintext)
+	mac := hmac.New(sha256.New, k[32:64])
+	mac.Write(ciphertext)
+
+	return append(append(pub, ciphertext...), mac.Sum(nil)[:8]...)
+}
@@ -0,0 +1,354 @@
+// Package bolt implements a dctrl.StateStore on top of a bbolt database, so that the
+// registration state can be written through on each change without rewriting the whole
+// snapshot.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/bbolt"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+)
+
+// The buckets of the store: one per kind, with the objects and the table entries keyed by
+// namespace/name, and one for the time of the last snapshot.
+var (
+	regStateBucket            = []byte("RegState")
+	activeRegistrationsBucket = []byte("ActiveRegistrationTable")
+	activeSessionsBucket      = []byte("ActiveSessionTable")
+	metaBucket                = []byte("meta")
+	timeKey                   = []byte("time")
+)
+
+// DefaultOpenTimeout is the default time to wait for the lock of a database held by another
+// process.
+const DefaultOpenTimeout = 5 * time.Second
+
+// Options are the options of the store.
+type Options struct {
+	// OpenTimeout is the time to wait for the lock of the database (default: 5s).
+	OpenTimeout time.Duration
+	// CompactInterval, if positive, compacts the database at the given interval.
+	CompactInterval time.Duration
+	Logger          logr.Logger
+}
+
+// Store is a dctrl.StateStore backed by a bbolt database. Each Save is a single transaction that
+// writes only the records changed since the last one, so the stored state is always that of a
+// complete snapshot, even if the process is killed mid-write.
+type Store struct {
+	mu     sync.RWMutex // the write lock is held while the database is swapped by a compaction
+	db     *bbolt.DB
+	path   string
+	opts   *bbolt.Options
+	cancel context.CancelFunc
+	done   chan struct{}
+	log    logr.Logger
+}
+
+var _ dctrl.StateStore = &Store{}
+
+// Open opens the database at the given path, creating it if it does not exist.
+func Open(path string, opts Options) (*Store, error) {
+	logger := opts.Logger
+	if logger.GetSink() == nil {
+		logger = logr.Discard()
+	}
+	timeout := opts.OpenTimeout
+	if timeout <= 0 {
+		timeout = DefaultOpenTimeout
+	}
+
+	s := &Store{path: path, opts: &bbolt.Options{Timeout: timeout}, log: logger.WithName("bolt-store")}
+	db, err := bbolt.Open(path, 0o600, s.opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %q: %w", path, err)
+	}
+	s.db = db
+
+	if opts.CompactInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel, s.done = cancel, make(chan struct{})
+		go s.compactLoop(ctx, opts.CompactInterval)
+	}
+
+	return s, nil
+}
+
+// Close stops the compaction and closes the database.
+func (s *Store) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Close()
+}
+
+// Save replaces the stored state with a snapshot.
+func (s *Store) Save(_ context.Context, snapshot *dctrl.StateSnapshot) error {
+	regStates, err := recordsOf(objectKey, snapshot.RegStates)
+	if err != nil {
+		return err
+	}
+	registrations, err := recordsOf(entryKey, snapshot.ActiveRegistrations)
+	if err != nil {
+		return err
+	}
+	sessions, err := recordsOf(entryKey, snapshot.ActiveSessions)
+	if err != nil {
+		return err
+	}
+	t, err := snapshot.Time.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		for _, b := range []struct {
+			name    []byte
+			records map[string][]byte
+		}{
+			{regStateBucket, regStates},
+			{activeRegistrationsBucket, registrations},
+			{activeSessionsBucket, sessions},
+			{metaBucket, map[string][]byte{string(timeKey): t}},
+		} {
+			if err := syncBucket(tx, b.name, b.records); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save state snapshot %q: %w", s.path, err)
+	}
+	return nil
+}
+
+// Load returns the stored snapshot, or nil if none has been saved.
+func (s *Store) Load(_ context.Context) (*dctrl.StateSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var snapshot *dctrl.StateSnapshot
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return nil
+		}
+		snapshot = &dctrl.StateSnapshot{}
+		if err := snapshot.Time.UnmarshalText(meta.Get(timeKey)); err != nil {
+			return fmt.Errorf("invalid snapshot time: %w", err)
+		}
+
+		if err := forEachRecord(tx, regStateBucket, func(v []byte) error {
+			obj := map[string]any{}
+			if err := json.Unmarshal(v, &obj); err != nil {
+				return err
+			}
+			snapshot.RegStates = append(snapshot.RegStates, obj)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, b := range []struct {
+			name    []byte
+			entries *[]any
+		}{
+			{activeRegistrationsBucket, &snapshot.ActiveRegistrations},
+			{activeSessionsBucket, &snapshot.ActiveSessions},
+		} {
+			if err := forEachRecord(tx, b.name, func(v []byte) error {
+				var entry any
+				if err := json.Unmarshal(v, &entry); err != nil {
+					return err
+				}
+				*b.entries = append(*b.entries, entry)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state snapshot %q: %w", s.path, err)
+	}
+	return snapshot, nil
+}
+
+// Delete removes the stored state, if any.
+func (s *Store) Delete(_ context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{regStateBucket, activeRegistrationsBucket, activeSessionsBucket, metaBucket} {
+			if tx.Bucket(name) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete state snapshot %q: %w", s.path, err)
+	}
+	return nil
+}
+
+// Compact rewrites the database into a fresh file to reclaim the pages freed by the deleted
+// records, which bbolt never returns to the file system. The store is unavailable during the
+// compaction.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path + ".compact"
+	os.Remove(tmp) //nolint:errcheck
+	dst, err := bbolt.Open(tmp, 0o600, s.opts)
+	if err != nil {
+		return fmt.Errorf("failed to compact state database %q: %w", s.path, err)
+	}
+	if err := bbolt.Compact(dst, s.db, 0); err != nil {
+		dst.Close()    //nolint:errcheck
+		os.Remove(tmp) //nolint:errcheck
+		return fmt.Errorf("failed to compact state database %q: %w", s.path, err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp) //nolint:errcheck
+		return fmt.Errorf("failed to compact state database %q: %w", s.path, err)
+	}
+
+	// swap the files: the old database is reopened if the swap fails
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("failed to close state database %q: %w", s.path, err)
+	}
+	renameErr := os.Rename(tmp, s.path)
+	db, err := bbolt.Open(s.path, 0o600, s.opts)
+	if err != nil {
+		return fmt.Errorf("failed to reopen state database %q: %w", s.path, errors.Join(renameErr, err))
+	}
+	s.db = db
+	if renameErr != nil {
+		os.Remove(tmp) //nolint:errcheck
+		return fmt.Errorf("failed to compact state database %q: %w", s.path, renameErr)
+	}
+	return nil
+}
+
+func (s *Store) compactLoop(ctx context.Context, interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				s.log.Error(err, "failed to compact the state database")
+			}
+		}
+	}
+}
+
+// syncBucket makes the contents of a bucket equal to the records, writing only the changed ones.
+func syncBucket(tx *bbolt.Tx, name []byte, records map[string][]byte) error {
+	b, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+
+	// the keys cannot be deleted while iterating
+	stale := [][]byte{}
+	if err := b.ForEach(func(k, v []byte) error {
+		if r, ok := records[string(k)]; !ok {
+			stale = append(stale, bytes.Clone(k))
+		} else if bytes.Equal(r, v) {
+			delete(records, string(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for k, v := range records {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachRecord calls fn with the records of a bucket, if it exists, ordered by the key.
+func forEachRecord(tx *bbolt.Tx, name []byte, fn func(v []byte) error) error {
+	b := tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k, v []byte) error {
+		if err := fn(v); err != nil {
+			return fmt.Errorf("invalid record %s/%s: %w", name, k, err)
+		}
+		return nil
+	})
+}
+
+// recordsOf marshals the items into records keyed by namespace/name.
+func recordsOf[T any](key func(T) (string, error), items []T) (map[string][]byte, error) {
+	records := make(map[string][]byte, len(items))
+	for _, item := range items {
+		k, err := key(item)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", k, err)
+		}
+		records[k] = v
+	}
+	return records, nil
+}
+
+// objectKey returns the namespace/name of an object.
+func objectKey(obj map[string]any) (string, error) {
+	meta, _ := obj["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	if name == "" {
+		return "", errors.New("object with no name")
+	}
+	namespace, _ := meta["namespace"].(string)
+	return namespace + "/" + name, nil
+}
+
+// entryKey returns the namespace/name of an aggregate table entry.
+func entryKey(entry any) (string, error) {
+	e, _ := entry.(map[string]any)
+	name, _ := e["name"].(string)
+	if name == "" {
+		return "", errors.New("table entry with no name")
+	}
+	namespace, _ := e["namespace"].(string)
+	return namespace + "/" + name, nil
+}
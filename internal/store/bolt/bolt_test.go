@@ -0,0 +1,207 @@
+package bolt_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/store/bolt"
+)
+
+// writerEnv makes the test binary run the writer process that is killed mid-write.
+const writerEnv = "BOLT_STORE_WRITER_DB"
+
+// snapshotOf returns the snapshot of generation gen, with a number of registrations varying with
+// the generation so that the records are both rewritten and deleted across generations.
+func snapshotOf(gen int) *dctrl.StateSnapshot {
+	s := &dctrl.StateSnapshot{Time: time.Unix(int64(gen), 0).UTC()}
+	for i := 0; i < 10+gen%7; i++ {
+		name := fmt.Sprintf("user-%d", i)
+		s.RegStates = append(s.RegStates, map[string]any{
+			"metadata": map[string]any{"name": name, "namespace": name},
+			"spec":     map[string]any{"generation": gen},
+		})
+		s.ActiveRegistrations = append(s.ActiveRegistrations, map[string]any{
+			"name": name, "namespace": name, "guti": fmt.Sprintf("guti-%d-%d", gen, i),
+		})
+	}
+	return s
+}
+
+// expectConsistent checks that a loaded snapshot is that of a single generation, in full.
+func expectConsistent(s *dctrl.StateSnapshot) int {
+	GinkgoHelper()
+	Expect(s).NotTo(BeNil())
+	gen := int(s.Time.Unix())
+	Expect(s.RegStates).To(HaveLen(10 + gen%7))
+	Expect(s.ActiveRegistrations).To(HaveLen(10 + gen%7))
+	for _, obj := range s.RegStates {
+		Expect(obj["spec"]).To(HaveKeyWithValue("generation", BeNumerically("==", gen)))
+	}
+	for _, e := range s.ActiveRegistrations {
+		Expect(e).To(HaveKeyWithValue("guti", HavePrefix(fmt.Sprintf("guti-%d-", gen))))
+	}
+	return gen
+}
+
+var _ = Describe("Bolt state store", func() {
+	var (
+		ctx  context.Context
+		path string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		path = filepath.Join(GinkgoT().TempDir(), "state.db")
+	})
+
+	It("should save, load and delete a snapshot", func() {
+		s, err := bolt.Open(path, bolt.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close() //nolint:errcheck
+
+		snapshot, err := s.Load(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot).To(BeNil())
+
+		Expect(s.Save(ctx, snapshotOf(6))).To(Succeed())
+		Expect(expectConsistent(must(s.Load(ctx)))).To(Equal(6))
+
+		// fewer registrations
+		Expect(s.Save(ctx, snapshotOf(7))).To(Succeed())
+		Expect(expectConsistent(must(s.Load(ctx)))).To(Equal(7))
+
+		Expect(s.Delete(ctx)).To(Succeed())
+		snapshot, err = s.Load(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot).To(BeNil())
+	})
+
+	It("should keep the state across a reopen and a compaction", func() {
+		s, err := bolt.Open(path, bolt.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		for gen := 1; gen <= 20; gen++ {
+			Expect(s.Save(ctx, snapshotOf(gen))).To(Succeed())
+		}
+		Expect(s.Compact()).To(Succeed())
+		Expect(expectConsistent(must(s.Load(ctx)))).To(Equal(20))
+		Expect(s.Close()).To(Succeed())
+
+		s, err = bolt.Open(path, bolt.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close() //nolint:errcheck
+		Expect(expectConsistent(must(s.Load(ctx)))).To(Equal(20))
+	})
+
+	It("should not corrupt the state on concurrent writes", func() {
+		s, err := bolt.Open(path, bolt.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close() //nolint:errcheck
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					Expect(s.Save(ctx, snapshotOf(w*100+i))).To(Succeed())
+				}
+			}()
+		}
+		wg.Wait()
+
+		expectConsistent(must(s.Load(ctx)))
+	})
+
+	It("should not leave torn records when killed mid-write", func() {
+		for round := 0; round < 3; round++ {
+			cmd := exec.Command(os.Args[0], "-test.run=TestWriterProcess")
+			cmd.Env = append(os.Environ(), writerEnv+"="+path)
+			Expect(cmd.Start()).To(Succeed())
+
+			// let the writer get going, then kill it at an arbitrary point
+			Eventually(func() error { _, err := os.Stat(path); return err }, 5*time.Second).Should(Succeed())
+			time.Sleep(time.Duration(100+round*37) * time.Millisecond)
+			Expect(cmd.Process.Kill()).To(Succeed())
+			_ = cmd.Wait()
+
+			s, err := bolt.Open(path, bolt.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			snapshot, err := s.Load(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			if snapshot != nil {
+				expectConsistent(snapshot)
+			}
+			Expect(s.Close()).To(Succeed())
+		}
+	})
+})
+
+func must(s *dctrl.StateSnapshot, err error) *dctrl.StateSnapshot {
+	GinkgoHelper()
+	Expect(err).NotTo(HaveOccurred())
+	return s
+}
+
+// TestWriterProcess is the writer killed by the torn record test: it saves snapshots into the
+// database in a loop until killed.
+func TestWriterProcess(t *testing.T) {
+	path := os.Getenv(writerEnv)
+	if path == "" {
+		t.Skip("writer process only")
+	}
+
+	s, err := bolt.Open(path, bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for gen := 0; ; gen++ {
+		if err := s.Save(context.Background(), snapshotOf(gen)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// benchmarkStore saves snapshots of 100 registrations, one of which changes per save.
+func benchmarkStore(b *testing.B, store dctrl.StateStore) {
+	ctx := context.Background()
+	snapshot := &dctrl.StateSnapshot{Time: time.Now()}
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("user-%d", i)
+		snapshot.RegStates = append(snapshot.RegStates, map[string]any{
+			"metadata": map[string]any{"name": name, "namespace": name},
+			"spec":     map[string]any{"generation": 0},
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		snapshot.RegStates[i%100]["spec"] = map[string]any{"generation": i}
+		if err := store.Save(ctx, snapshot); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBoltStore(b *testing.B) {
+	s, err := bolt.Open(filepath.Join(b.TempDir(), "state.db"), bolt.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close() //nolint:errcheck
+	benchmarkStore(b, s)
+}
+
+func BenchmarkFileStore(b *testing.B) {
+	benchmarkStore(b, dctrl.NewFileStateStore(filepath.Join(b.TempDir(), "state.json")))
+}
@@ -0,0 +1,7 @@
+package testsuite
+
+// StartWarmup opens the warm-up window as if the operators were just started.
+func StartWarmup() { startWarmup() }
+
+// EndWarmup closes the warm-up window.
+func EndWarmup() { warmupEnd.Store(0) }
@@ -2,9 +2,10 @@ package testsuite
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
-	"math/big"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -12,17 +13,34 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/l7mp/dcontroller/pkg/auth"
 	"go.uber.org/zap/zapcore"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/hsnlab/dctrl5g/internal/dctrl"
 )
 
 const (
-	keyFile  = "apiserver.key"
-	certFile = "apiserver.crt"
+	// WarmupRetries and WarmupInterval bound the retries of CreateWithRetry.
+	WarmupRetries  = 20
+	WarmupInterval = 100 * time.Millisecond
+	// WarmupWindow is the time after the start of the operators CreateWithRetry retries for.
+	WarmupWindow = 10 * time.Second
 )
 
+// warmupEnd is the end of the warm-up window of the operators started last, in Unix nanoseconds.
+var warmupEnd atomic.Int64
+
 func StartOps(ctx context.Context, opSpecs []dctrl.OpSpec, port, loglevel int) (*dctrl.Dctrl, error) {
+	return StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs, APIServerPort: port}, loglevel)
+}
+
+// StartOpsWithOptions is like StartOps but lets the caller customize the dctrl options. The TLS
+// and authentication settings and the logger are always overridden: the API server runs in HTTP
+// mode, with JWT authentication only if HTTPAuth is set. Unless the caller sets KeyFile and
+// CertFile, a fresh keypair is written into a per-test temporary directory so that suites
+// running in parallel do not clobber each other's keys.
+func StartOpsWithOptions(ctx context.Context, opts dctrl.Options, loglevel int) (*dctrl.Dctrl, error) {
 	var logger logr.Logger
 	if loglevel == 0 {
 		// turn off
@@ -37,29 +55,27 @@ func StartOps(ctx context.Context, opSpecs []dctrl.OpSpec, port, loglevel int) (
 		}))
 	}
 
-	cert, key, err := auth.GenerateSelfSignedCertWithSANs([]string{"localhost"})
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate keys: %w", err)
-	}
-	if err := auth.WriteCertAndKey(keyFile, certFile, key, cert); err != nil {
-		return nil, fmt.Errorf("failed to write key/cert into file %q/%q: %w", keyFile, certFile, err)
+	if opts.KeyFile == "" {
+		keyFile, certFile, err := WriteCertAndKey(GinkgoT().TempDir())
+		if err != nil {
+			return nil, err
+		}
+		opts.KeyFile, opts.CertFile = keyFile, certFile
 	}
 
-	if port == 0 {
-		port = randomPort()
+	if opts.APIServerPort == 0 {
+		opts.APIServerPort = dctrl.EphemeralAPIServerPort
 	}
 
-	d, err := dctrl.New(dctrl.Options{
-		OpSpecs:       opSpecs,
-		APIServerPort: port,
-		KeyFile:       keyFile,
-		HTTPMode:      true,
-		DisableAuth:   true,
-		Logger:        logger,
-	})
+	opts.HTTPMode = true
+	opts.DisableAuth = !opts.HTTPAuth
+	opts.Logger = logger
+
+	d, err := dctrl.New(opts)
 	if err != nil {
 		return nil, err
 	}
+	startWarmup()
 
 	go func() {
 		GinkgoHelper()
@@ -84,12 +100,49 @@ func StartOps(ctx context.Context, opSpecs []dctrl.OpSpec, port, loglevel int) (
 	return d, nil
 }
 
-func randomPort() int {
-	const minPort = 49152
-	const maxPort = 65535
-	n, err := rand.Int(rand.Reader, big.NewInt(maxPort-minPort+1))
+// WriteCertAndKey writes a fresh self-signed keypair for localhost into a directory and returns
+// the paths of the key and the cert.
+func WriteCertAndKey(dir string) (string, string, error) {
+	keyFile, certFile := filepath.Join(dir, "apiserver.key"), filepath.Join(dir, "apiserver.crt")
+	cert, key, err := auth.GenerateSelfSignedCertWithSANs([]string{"localhost"})
 	if err != nil {
-		return 0
+		return "", "", fmt.Errorf("failed to generate keys: %w", err)
+	}
+	if err := auth.WriteCertAndKey(keyFile, certFile, key, cert); err != nil {
+		return "", "", fmt.Errorf("failed to write key/cert into file %q/%q: %w", keyFile, certFile, err)
 	}
-	return int(n.Int64()) + minPort
+	return keyFile, certFile, nil
 }
+
+// CreateWithRetry creates an object, retrying the transient failures of the operators still
+// warming up: the API server being unavailable, timing out or throttling the requests. The
+// failures are retried only within the warm-up window after the start of the operators; any other
+// error, and any error after the warm-up, is returned immediately.
+func CreateWithRetry(ctx context.Context, c client.Client, obj client.Object) error {
+	var err error
+	for i := 0; i < WarmupRetries; i++ {
+		err = c.Create(ctx, obj)
+		if err == nil || !isTransient(err) || !inWarmup() {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(WarmupInterval):
+		}
+	}
+	return fmt.Errorf("create failed after %d retries: %w", WarmupRetries, err)
+}
+
+// isTransient returns whether a create may succeed if retried during the warm-up.
+func isTransient(err error) bool {
+	return apierrors.IsServiceUnavailable(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err)
+}
+
+// startWarmup opens the warm-up window.
+func startWarmup() { warmupEnd.Store(time.Now().Add(WarmupWindow).UnixNano()) }
+
+// inWarmup returns whether the warm-up window is open.
+func inWarmup() bool { return time.Now().UnixNano() < warmupEnd.Load() }
@@ -0,0 +1,175 @@
+package testsuite_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+)
+
+// warmupClient fails the first creates as if the operators were still warming up, by default
+// with ServiceUnavailable.
+type warmupClient struct {
+	client.Client
+	failures int
+	err      error
+}
+
+func (c *warmupClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if c.failures > 0 {
+		c.failures--
+		if c.err != nil {
+			return c.err
+		}
+		return apierrors.NewServiceUnavailable("warming up")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+var _ = Describe("CreateWithRetry", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		c = cache.NewViewCache(cache.CacheOptions{}).GetClient()
+		testsuite.StartWarmup()
+	})
+
+	AfterEach(func() {
+		cancel()
+		testsuite.EndWarmup()
+	})
+
+	It("should retry a create that fails during warm-up", func() {
+		wc := &warmupClient{Client: c, failures: 3}
+		obj := object.NewViewObject("amf", "Registration")
+		object.SetName(obj, "default", "test-reg")
+
+		Expect(testsuite.CreateWithRetry(ctx, wc, obj)).To(Succeed())
+		Expect(wc.failures).To(BeZero())
+
+		retrieved := object.NewViewObject("amf", "Registration")
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), retrieved)).To(Succeed())
+	})
+
+	It("should give up after the warm-up window", func() {
+		wc := &warmupClient{Client: c, failures: testsuite.WarmupRetries + 1}
+		obj := object.NewViewObject("amf", "Registration")
+		object.SetName(obj, "default", "test-reg")
+
+		err := testsuite.CreateWithRetry(ctx, wc, obj)
+		Expect(err).To(HaveOccurred())
+		Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue())
+	})
+
+	It("should not retry a create that cannot succeed", func() {
+		wc := &warmupClient{Client: c}
+		obj := object.NewViewObject("amf", "Registration")
+		object.SetName(obj, "default", "test-reg")
+		Expect(testsuite.CreateWithRetry(ctx, wc, obj)).To(Succeed())
+
+		dup := object.NewViewObject("amf", "Registration")
+		object.SetName(dup, "default", "test-reg")
+		err := testsuite.CreateWithRetry(ctx, wc, dup)
+		Expect(apierrors.IsAlreadyExists(err)).To(BeTrue())
+	})
+
+	It("should retry the transient failures only", func() {
+		for _, err := range []error{
+			apierrors.NewServerTimeout(schema.GroupResource{Resource: "registration"}, "create", 1),
+			apierrors.NewTimeoutError("timed out", 1),
+			apierrors.NewTooManyRequests("throttled", 1),
+		} {
+			wc := &warmupClient{Client: c, failures: 1, err: err}
+			obj := object.NewViewObject("amf", "Registration")
+			object.SetName(obj, "default", "test-reg")
+			Expect(testsuite.CreateWithRetry(ctx, wc, obj)).To(Succeed())
+			Expect(c.Delete(ctx, obj)).To(Succeed())
+		}
+
+		// e.g., a create rejected by the admission policy
+		wc := &warmupClient{Client: c, failures: 1,
+			err: apierrors.NewForbidden(schema.GroupResource{Resource: "registration"}, "test-reg",
+				errors.New("denied"))}
+		obj := object.NewViewObject("amf", "Registration")
+		object.SetName(obj, "default", "test-reg")
+		err := testsuite.CreateWithRetry(ctx, wc, obj)
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		Expect(wc.failures).To(BeZero())
+	})
+
+	It("should not retry after the warm-up", func() {
+		testsuite.EndWarmup()
+		wc := &warmupClient{Client: c, failures: 1}
+		obj := object.NewViewObject("amf", "Registration")
+		object.SetName(obj, "default", "test-reg")
+
+		err := testsuite.CreateWithRetry(ctx, wc, obj)
+		Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("StartOps", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should not let suites running in parallel clobber each other's keypair", func() {
+		dirs := []string{GinkgoT().TempDir(), GinkgoT().TempDir()}
+		keyFiles, certFiles := make([]string, len(dirs)), make([]string, len(dirs))
+
+		var wg sync.WaitGroup
+		for i, dir := range dirs {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				var err error
+				keyFiles[i], certFiles[i], err = testsuite.WriteCertAndKey(dir)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = testsuite.StartOpsWithOptions(ctx, dctrl.Options{
+					KeyFile:  keyFiles[i],
+					CertFile: certFiles[i],
+				}, 0)
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		// each suite sees a consistent keypair of its own
+		certs := [][]byte{}
+		for i := range dirs {
+			pair, err := tls.LoadX509KeyPair(certFiles[i], keyFiles[i])
+			Expect(err).NotTo(HaveOccurred())
+			certs = append(certs, pair.Certificate[0])
+		}
+		Expect(bytes.Equal(certs[0], certs[1])).To(BeFalse())
+	})
+})
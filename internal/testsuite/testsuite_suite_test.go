@@ -0,0 +1,13 @@
+package testsuite_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTestsuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Testsuite")
+}
@@ -0,0 +1,159 @@
+// Package tracing implements the OpenTelemetry traces of the UE requests. The span context of a
+// request is carried in an annotation of the view objects derived from the request, like the
+// correlation ID, so that the reconciles of the operators on each hop become the child spans of
+// the span started when the request was admitted.
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// TracerName is the name of the tracer of the operators.
+	TracerName = "github.com/hsnlab/dctrl5g"
+	// annotationPrefix is the prefix of the annotations carrying the span context, e.g.,
+	// dctrl5g.io/traceparent.
+	annotationPrefix = "dctrl5g.io/"
+)
+
+// The span attributes.
+const (
+	OperatorKey = attribute.Key("dctrl5g.operator")
+	KindKey     = attribute.Key("dctrl5g.kind")
+	ObjectKey   = attribute.Key("dctrl5g.object")
+	SuciKey     = attribute.Key("dctrl5g.suci")
+	GutiKey     = attribute.Key("dctrl5g.guti")
+	// ConditionKeyPrefix is the prefix of the attributes holding the status and the reason of
+	// the conditions of an object, e.g., dctrl5g.condition.Ready="True/Ready".
+	ConditionKeyPrefix = "dctrl5g.condition."
+)
+
+var propagator = propagation.TraceContext{}
+
+// Object is a view object.
+type Object interface {
+	metav1.Object
+	UnstructuredContent() map[string]any
+}
+
+// Tracer returns the tracer of the operators from a provider, a no-op tracer if the provider is
+// nil.
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(TracerName)
+}
+
+// annotationCarrier carries the span context in the annotations of an object.
+type annotationCarrier map[string]string
+
+func (c annotationCarrier) Get(key string) string { return c[annotationPrefix+key] }
+
+func (c annotationCarrier) Set(key, value string) { c[annotationPrefix+key] = value }
+
+func (c annotationCarrier) Keys() []string {
+	keys := []string{}
+	for k := range c {
+		if f, ok := strings.CutPrefix(k, annotationPrefix); ok {
+			keys = append(keys, f)
+		}
+	}
+	return keys
+}
+
+// Inject writes the span context of a context into the annotations of an object.
+func Inject(ctx context.Context, obj metav1.Object) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	propagator.Inject(ctx, annotationCarrier(annotations))
+	obj.SetAnnotations(annotations)
+}
+
+// Extract returns a context with the span context carried in the annotations of an object as the
+// remote parent, the given context if there is none.
+func Extract(ctx context.Context, obj metav1.Object) context.Context {
+	annotations := obj.GetAnnotations()
+	if len(annotations) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, annotationCarrier(annotations))
+}
+
+// HasSpanContext returns true if an object carries a span context.
+func HasSpanContext(obj metav1.Object) bool {
+	return trace.SpanContextFromContext(Extract(context.Background(), obj)).IsValid()
+}
+
+// Attributes returns the span attributes of an object of an operator: the operator, the kind,
+// the key of the object, the SUCI and the GUTI of the UE, if known, and the conditions.
+func Attributes(operator, kind string, obj Object) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		OperatorKey.String(operator),
+		KindKey.String(kind),
+		ObjectKey.String(obj.GetNamespace() + "/" + obj.GetName()),
+	}
+
+	content := obj.UnstructuredContent()
+	for _, path := range [][]string{
+		{"spec", "mobileIdentity", "value"}, // Registration, RegState
+		{"spec", "suci"},                    // MobileIdentity, SessionContext
+	} {
+		if suci, ok, _ := unstructured.NestedString(content, path...); ok && suci != "" {
+			attrs = append(attrs, SuciKey.String(suci))
+			break
+		}
+	}
+	for _, path := range [][]string{
+		{"status", "guti"}, // Registration, RegState
+		{"spec", "guti"},   // Session, SessionContext
+	} {
+		if guti, ok, _ := unstructured.NestedString(content, path...); ok && guti != "" {
+			attrs = append(attrs, GutiKey.String(guti))
+			break
+		}
+	}
+
+	return append(attrs, conditionAttributes(content)...)
+}
+
+// conditionAttributes returns the status and the reason of the conditions, given either as a list
+// (the user-facing resources) or as a map keyed by the type (the internal state of the AMF).
+func conditionAttributes(content map[string]any) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{}
+	add := func(t string, cond any) {
+		c, ok := cond.(map[string]any)
+		if !ok || t == "" {
+			return
+		}
+		status, _ := c["status"].(string)
+		reason, _ := c["reason"].(string)
+		attrs = append(attrs, attribute.String(ConditionKeyPrefix+t, status+"/"+reason))
+	}
+
+	conds, _, _ := unstructured.NestedFieldNoCopy(content, "status", "conditions")
+	switch conds := conds.(type) {
+	case []any:
+		for _, c := range conds {
+			if m, ok := c.(map[string]any); ok {
+				t, _ := m["type"].(string)
+				add(t, m)
+			}
+		}
+	case map[string]any:
+		for t, c := range conds {
+			add(t, c)
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+)
+
+// generateKeys implements "dctrl5g generate-keys": it writes a self-signed certificate and the
+// private key the API server uses for TLS and for signing the JWTs.
+func generateKeys(w io.Writer, args []string, errorHandling flag.ErrorHandling) error {
+	flags := flag.NewFlagSet("generate-keys", errorHandling)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of dctrl5g generate-keys:\n")
+		fmt.Fprintf(os.Stderr, "  dctrl5g generate-keys [flags]\n")
+		flags.PrintDefaults()
+	}
+	certFile := flags.String("tls-cert-file", "apiserver.crt", "Certificate file to write")
+	keyFile := flags.String("tls-key-file", "apiserver.key", "Private key file to write")
+	var sans stringList
+	flags.Var(&sans, "san", "DNS name or IP address to add to the certificate (can be repeated, default: localhost)")
+	force := flags.Bool("force", false, "Overwrite the existing key and cert files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(sans) == 0 {
+		sans = stringList{"localhost"}
+	}
+
+	if !*force {
+		for _, f := range []string{*certFile, *keyFile} {
+			if _, err := os.Stat(f); err == nil {
+				return fmt.Errorf("file %q already exists (use --force to overwrite)", f)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to stat %q: %w", f, err)
+			}
+		}
+	}
+
+	cert, key, err := auth.GenerateSelfSignedCertWithSANs(sans)
+	if err != nil {
+		return fmt.Errorf("failed to generate keys: %w", err)
+	}
+	if err := auth.WriteCertAndKey(*keyFile, *certFile, key, cert); err != nil {
+		return fmt.Errorf("failed to write key/cert into file %q/%q: %w", *keyFile, *certFile, err)
+	}
+
+	block, _ := pem.Decode(cert)
+	if block == nil {
+		return errors.New("failed to decode the generated certificate")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse the generated certificate: %w", err)
+	}
+
+	fmt.Fprintf(w, "Wrote certificate to %s and private key to %s\n", *certFile, *keyFile) //nolint:errcheck
+	fmt.Fprintf(w, "Subject:    %s\n", c.Subject.String())                                 //nolint:errcheck
+	fmt.Fprintf(w, "SANs:       %s\n", strings.Join(sans, ", "))                           //nolint:errcheck
+	fmt.Fprintf(w, "Not before: %s\n", c.NotBefore.UTC().Format(time.RFC3339))             //nolint:errcheck
+	fmt.Fprintf(w, "Not after:  %s\n", c.NotAfter.UTC().Format(time.RFC3339))              //nolint:errcheck
+	return nil
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	"go.uber.org/zap/zapcore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
 
 	"github.com/hsnlab/dctrl5g/internal/buildinfo"
 	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/jwks"
+	"github.com/hsnlab/dctrl5g/internal/operators/udm"
 )
 
 const APIServerPort = 8443
@@ -21,9 +30,11 @@ var (
 	commitHash = "n/a"
 	buildDate  = "<unknown>"
 	OpSpecs    = []dctrl.OpSpec{
-		{Name: "amf", File: "internal/operators/amf.yaml"},
+		{Name: "amf", File: "internal/operators/amf.yaml", DependsOn: []string{"ausf", "smf", "udm"},
+			Requires: []string{"ausf", "udm"}},
 		{Name: "ausf", File: "internal/operators/ausf.yaml"},
-		{Name: "smf", File: "internal/operators/smf.yaml"},
+		{Name: "smf", File: "internal/operators/smf.yaml", DependsOn: []string{"pcf", "upf"},
+			Requires: []string{"pcf", "upf"}},
 		{Name: "pcf", File: "internal/operators/pcf.yaml"},
 		{Name: "upf", File: "internal/operators/upf.yaml"},
 		// UDM is manual
@@ -31,60 +42,479 @@ var (
 )
 
 func main() {
-	opts := zap.Options{
+	if code, ok := runSubcommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
+	dctrlOpts, opts, err := parseFlags(os.Args[1:], flag.ExitOnError)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	logger := zap.New(zap.UseFlagOptions(opts))
+	ctrl.SetLogger(logger.WithName("dctrl5g"))
+	setupLog := logger.WithName("setup")
+
+	buildInfo := buildinfo.BuildInfo{Version: version, CommitHash: commitHash, BuildDate: buildDate}
+	setupLog.Info(fmt.Sprintf("starting the dctrl5g %s", buildInfo.String()))
+
+	dctrlOpts.Logger = logger
+	dctrl, err := dctrl.New(dctrlOpts)
+	if err != nil {
+		setupLog.Error(err, "failed to init")
+		os.Exit(initExitCode(err))
+	}
+
+	setupLog.Info("API server port", "port", dctrl.APIServerPort())
+
+	ctx := ctrl.SetupSignalHandler()
+
+	if err := dctrl.Start(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// runSubcommand runs the subcommand named by the arguments and returns its exit code. Returns
+// false if there is no subcommand, i.e., the server is to be started.
+//   - "dctrl5g config dump [flags]" prints the effective config.
+//   - "dctrl5g generate-keys [flags]" writes the TLS/JWT signing keypair.
+func runSubcommand(args []string) (int, bool) {
+	switch {
+	case len(args) > 1 && args[0] == "config" && args[1] == "dump":
+		dctrlOpts, _, err := parseFlags(args[2:], flag.ExitOnError)
+		if err != nil {
+			return 2, true
+		}
+		if err := dumpConfig(os.Stdout, dctrlOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1, true
+		}
+		return 0, true
+
+	case len(args) > 0 && args[0] == "generate-keys":
+		if err := generateKeys(os.Stdout, args[1:], flag.ExitOnError); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// The exit codes of the init failures.
+const (
+	exitInitFailed    = 1
+	exitOperatorLoad  = 3
+	exitAPIServerInit = 4
+)
+
+// initExitCode returns the exit code for an init error, so that a bad operator file can be told
+// apart from an API server (e.g., TLS) problem.
+func initExitCode(err error) int {
+	var opErr *dctrl.OperatorLoadError
+	var apiErr *dctrl.APIServerInitError
+	switch {
+	case errors.As(err, &opErr):
+		return exitOperatorLoad
+	case errors.As(err, &apiErr):
+		return exitAPIServerInit
+	default:
+		return exitInitFailed
+	}
+}
+
+// parseFlags resolves the dctrl and the logger options from the command line flags.
+func parseFlags(args []string, errorHandling flag.ErrorHandling) (dctrl.Options, *zap.Options, error) {
+	opts := &zap.Options{
 		Development:     true,
 		DestWriter:      os.Stderr,
 		StacktraceLevel: zapcore.Level(3),
 		TimeEncoder:     zapcore.RFC3339NanoTimeEncoder,
 	}
-	flags := flag.NewFlagSet("dctrl5g", flag.ExitOnError)
+	flags := flag.NewFlagSet("dctrl5g", errorHandling)
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of dctrl5g:\n")
+		fmt.Fprintf(os.Stderr, "  dctrl5g [flags]\n")
+		fmt.Fprintf(os.Stderr, "  dctrl5g config dump [flags]\tprint the effective config and exit\n")
+		fmt.Fprintf(os.Stderr, "  dctrl5g generate-keys [flags]\twrite the TLS/JWT signing keypair and exit\n")
+		fmt.Fprintf(os.Stderr, "Each flag can also be set with an environment variable, e.g., %s for --tls-cert-file.\n",
+			envVar("tls-cert-file"))
 		flags.PrintDefaults()
 	}
 	addr := flags.String("addr", "localhost", "API server bind address")
-	port := flags.Int("port", 8443, "API server port")
+	port := flags.Int("port", 8443, "API server port (-1 for a port chosen by the OS)")
+	apiPathPrefix := flags.String("api-path-prefix", "",
+		"Path prefix to serve the API server under, e.g., when served behind a gateway (the root if empty)")
 	httpMode := flags.Bool("http", false, "Use HTTP instead of HTTPS (no TLS)")
+	httpAuth := flags.Bool("http-auth", false,
+		"Require JWT authentication in HTTP mode, validated against --tls-cert-file (e.g., behind a TLS proxy)")
 	insecure := flags.Bool("insecure", false, "Accept self-signed TLS certificates (HTTPS only)")
 	certFile := flags.String("tls-cert-file", "apiserver.crt",
 		"TLS cert file for secure mode and JWT validation (latter not required if --disable-authentication is set)")
 	keyFile := flags.String("tls-key-file", "apiserver.key", "TLS key file for secure mode")
+	upfConfigFormat := flags.String("upf-config-format", "native",
+		"Shape of the exported UPF configs: native, free5gc or open5gs")
+	serviceAddr := flags.String("service-addr", dctrl.DefaultServiceAddr,
+		"Address to serve the diagnostic, the health, the readiness, the metrics and the JWKS endpoints on (disabled if empty)")
+	debugAddr := flags.String("debug-addr", "", "Deprecated: use --service-addr")
+	servicePathPrefix := flags.String("service-path-prefix", "",
+		"Path prefix to mount the service endpoints under, e.g., when served behind a gateway (the root if empty)")
+	managerMetrics := flags.Bool("manager-metrics", true,
+		"Serve the controller-runtime manager and the Go runtime metrics next to the dctrl5g metrics")
+	healthProbeAddr := flags.String("health-probe-addr", "",
+		"Address to serve the orchestrator health and readiness probes on (disabled if empty)")
+	tokenSelfTestInterval := flags.Duration("token-self-test-interval", time.Minute,
+		"Interval of the UDM token signing self-test")
+	udmConfigSelector := flags.String("udm-config-selector", "",
+		"Label selector restricting the UDM to a shard of the Configs, e.g., shard=0 (all Configs if empty)")
+	tokenAuditRetention := flags.Duration("token-audit-retention", 24*time.Hour,
+		"Time to keep the token audit records of deleted UEs for")
+	gutiCollisionPolicy := flags.String("guti-collision-policy", string(dctrl.GutiCollisionFail),
+		"Resolution of a GUTI allocated to distinct UEs: fail (the newer registration) or rehash")
+	duplicateSupiPolicy := flags.String("duplicate-supi-policy", string(dctrl.DuplicateSupiAllow),
+		"Handling of a registration of an already registered SUPI: allow, reject or deregister (the older registration)")
+	fatalErrorPolicy := flags.String("fatal-error-policy", string(dctrl.FatalErrorShutdown),
+		"Handling of a fatal operator error: shutdown (gracefully) or continue")
+	failureMode := flags.String("failure-mode", string(dctrl.FailFast),
+		"Handling of an operator failing to load at startup: FailFast or BestEffort (skip the operator and start the rest)")
+	subscribedAmbrPolicy := flags.String("subscribed-ambr-policy", string(udm.AmbrCap),
+		"Handling of a session exceeding the UE-AMBR of the PCF or the subscribed UE-AMBR of the user: cap or reject")
+	configRecreatePolicy := flags.String("config-recreate-policy", string(dctrl.ConfigRecreateIgnore),
+		"Handling of a UDM Config deleted while the registration of the UE is active: ignore or recreate")
+	minClientKeyBits := flags.Int("min-client-key-bits", jwks.DefaultMinClientKeyBits,
+		"Minimum RSA key size of the TLS client certificates presented to the API server")
+	ueTokenTTL := flags.Duration("ue-token-ttl", udm.DefaultTokenTTL,
+		"Lifetime of the tokens issued to the UEs in their kubeconfigs")
+	maxUETokenTTL := flags.Duration("max-ue-token-ttl", udm.DefaultMaxTokenTTL,
+		"Ceiling of the lifetime of any token issued to the UEs, whatever TTL is requested")
+	ueTokenPoolSize := flags.Int("ue-token-pool-size", 0,
+		"Number of UE tokens pre-generated while the registrations are in progress (disabled if 0)")
+	unknownFieldPolicy := flags.String("unknown-field-policy", string(dctrl.UnknownFieldsWarn),
+		"Handling of the unknown spec fields of Registrations and Sessions: DropUnknown, Warn or Reject")
+	registrationEventBufferSize := flags.Int("registration-event-buffer-size",
+		dctrl.DefaultRegistrationEventBufferSize,
+		"Number of registration state change events retained in the amf/RegistrationEvent view")
+	maxRequestedNSSAI := flags.Int("max-requested-nssai", dctrl.DefaultMaxRequestedNSSAI,
+		"Maximum number of S-NSSAIs in the requested NSSAI of a registration")
+	registrationExpiry := flags.Duration("registration-expiry", 0,
+		"Time after which a registration not refreshed by a heartbeat of the UE is deleted (disabled if 0)")
+	registrationDedupWindow := flags.Duration("registration-dedup-window", 0,
+		"Window in which the registrations of a SUCI in a namespace are coalesced into the first one, e.g., client retries (disabled if 0)")
+	configGCInterval := flags.Duration("config-gc-interval", 0,
+		"Interval of collecting the UPF configs with no owning active session (disabled if 0)")
+	metricsLogInterval := flags.Duration("metrics-log-interval", 0,
+		"Interval of logging a summary of the key metrics, for deployments with no metrics scraper (disabled if 0)")
+	sessionInactivityTimer := flags.Duration("session-inactivity-timer", 0,
+		"UE inactivity timer of the sessions, reported in the session status (disabled if 0)")
+	usageAccountingInterval := flags.Duration("usage-accounting-interval", 0,
+		"Interval of refreshing the duration of the sessions in the chf/UsageRecord view (usage accounting disabled if 0)")
+	maxConcurrentMutations := flags.Int("max-concurrent-mutations", 0,
+		"Maximum number of create, update and delete requests processed by the API server at a time (unlimited if 0)")
+	stateFile := flags.String("state-file", "",
+		"JSON file to persist the registration state in across restarts (in-memory if empty)")
+	stateSnapshotInterval := flags.Duration("state-snapshot-interval", 0,
+		"Interval of saving the registration state, in addition to on shutdown (disabled if 0)")
+	sessionIPPool := flags.String("session-ip-pool", dctrl.DefaultSessionIPPool,
+		"IPv4 CIDR the addresses of the sessions are allocated from (the first host is the default gateway)")
+	sessionIPv6Pool := flags.String("session-ipv6-pool", dctrl.DefaultSessionIPv6Pool,
+		"IPv6 CIDR the IPv6 addresses of the sessions are allocated from (the first host is the default gateway)")
+	var upfTunnelAddresses stringList
+	flags.Var(&upfTunnelAddresses, "upf-n3-address",
+		"N3 address of the UPF the GTP-U tunnels of the sessions terminate at (repeatable, default: "+
+			dctrl.DefaultUPFTunnelAddress+")")
+	strictSchemaCheck := flags.Bool("strict-schema-check", false,
+		"Fail the startup if the operators read view fields not written by the other operators, instead of warning")
+	validateOpSpecs := flags.Bool("validate-op-specs", false,
+		"Validate the operator spec files against the operator schema at startup")
+	logCorrelation := flags.Bool("log-correlation", false,
+		"Tag the registrations and sessions with a correlation ID attached to the logs of all the operators processing them")
+	counterView := flags.Bool("counter-view", false,
+		"Maintain the number of the active registrations and sessions in the amf/Counters view")
+	revocationListFile := flags.String("revocation-list-file", "",
+		"File to persist the revoked UE tokens in across restarts (in-memory if empty)")
+	homeNetworkKeyFile := flags.String("home-network-key-file", "",
+		"PEM file of the home network private keys to de-conceal the ECIES-protected SUCIs with (static SUCIs only if empty)")
+	subscriberKeyStore := flags.String("subscriber-key-store", "",
+		"YAML file of the subscriber keys to authenticate the UEs with 5G-AKA (disabled if empty)")
+	subscriberProvisioning := flags.Bool("subscriber-provisioning", false,
+		"Register only the UEs provisioned as UDM Subscribers")
+	var jwksCertFiles stringList
+	flags.Var(&jwksCertFiles, "jwks-cert-file",
+		"Additional certificate to publish in the JWKS, e.g., the previous signing key (can be repeated)")
+	var enabledOperators, disabledOperators stringList
+	flags.Var(&enabledOperators, "enable-operator",
+		"Operator to load, all operators are loaded if none is given (can be repeated)")
+	flags.Var(&disabledOperators, "disable-operator", "Operator not to load (can be repeated)")
 	disableAuthentication := flags.Bool("disable-authentication", false,
 		"Disable authentication/authorization (WARNING: allows unrestricted access)")
+	configFile := flags.String("config", "",
+		"YAML file of the options, in the form printed by \"config dump\" (the flags given take precedence)")
 	opts.BindFlags(flags)
-	if err := flags.Parse(os.Args[1:]); err != nil {
+	if err := flags.Parse(args); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
 		flags.Usage()
-		os.Exit(2)
+		return dctrl.Options{}, nil, err
+	}
+	if err := setFlagsFromEnv(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return dctrl.Options{}, nil, err
+	}
+	if err := aliasDebugAddr(flags, *debugAddr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return dctrl.Options{}, nil, err
 	}
 
-	logger := zap.New(zap.UseFlagOptions(&opts))
-	ctrl.SetLogger(logger.WithName("dctrl5g"))
-	setupLog := logger.WithName("setup")
+	var configSelector *metav1.LabelSelector
+	if *udmConfigSelector != "" {
+		s, err := metav1.ParseToLabelSelector(*udmConfigSelector)
+		if err != nil {
+			return dctrl.Options{}, nil, fmt.Errorf("invalid --udm-config-selector: %w", err)
+		}
+		configSelector = s
+	}
 
-	buildInfo := buildinfo.BuildInfo{Version: version, CommitHash: commitHash, BuildDate: buildDate}
-	setupLog.Info(fmt.Sprintf("starting the dctrl5g %s", buildInfo.String()))
+	dctrlOpts := dctrl.Options{
+		OpSpecs:                     OpSpecs,
+		APIServerAddr:               *addr,
+		APIServerPort:               *port,
+		APIPathPrefix:               *apiPathPrefix,
+		HTTPMode:                    *httpMode,
+		HTTPAuth:                    *httpAuth,
+		Insecure:                    *insecure,
+		DisableAuth:                 *disableAuthentication,
+		CertFile:                    *certFile,
+		KeyFile:                     *keyFile,
+		ServiceAddr:                 *serviceAddr,
+		ServicePathPrefix:           *servicePathPrefix,
+		ManagerMetrics:              *managerMetrics,
+		HealthProbeAddr:             *healthProbeAddr,
+		UPFConfigFormat:             *upfConfigFormat,
+		JWKSCertFiles:               jwksCertFiles,
+		RevocationListFile:          *revocationListFile,
+		HomeNetworkKeyFile:          *homeNetworkKeyFile,
+		SubscriberKeyStoreFile:      *subscriberKeyStore,
+		SubscriberProvisioning:      *subscriberProvisioning,
+		TokenSelfTestInterval:       *tokenSelfTestInterval,
+		TokenAuditRetention:         *tokenAuditRetention,
+		UETokenTTL:                  *ueTokenTTL,
+		MaxUETokenTTL:               *maxUETokenTTL,
+		UETokenPoolSize:             *ueTokenPoolSize,
+		UDMConfigSelector:           configSelector,
+		GutiCollisionPolicy:         dctrl.GutiCollisionPolicy(*gutiCollisionPolicy),
+		DuplicateSupiPolicy:         dctrl.DuplicateSupiPolicy(*duplicateSupiPolicy),
+		SubscribedAmbrPolicy:        udm.AmbrPolicy(*subscribedAmbrPolicy),
+		FatalErrorPolicy:            dctrl.FatalErrorPolicy(*fatalErrorPolicy),
+		FailureMode:                 dctrl.FailureMode(*failureMode),
+		ConfigRecreatePolicy:        dctrl.ConfigRecreatePolicy(*configRecreatePolicy),
+		MinClientKeyBits:            *minClientKeyBits,
+		UnknownFieldPolicy:          dctrl.UnknownFieldPolicy(*unknownFieldPolicy),
+		RegistrationEventBufferSize: *registrationEventBufferSize,
+		MaxRequestedNSSAI:           *maxRequestedNSSAI,
+		CounterView:                 *counterView,
+		LogCorrelation:              *logCorrelation,
+		StrictSchemaCheck:           *strictSchemaCheck,
+		ValidateOpSpecs:             *validateOpSpecs,
+		SessionIPPool:               *sessionIPPool,
+		SessionIPv6Pool:             *sessionIPv6Pool,
+		UPFTunnelAddresses:          upfTunnelAddresses,
+		SessionInactivityTimer:      *sessionInactivityTimer,
+		UsageAccountingInterval:     *usageAccountingInterval,
+		StateFile:                   *stateFile,
+		MaxConcurrentMutations:      *maxConcurrentMutations,
+		StateSnapshotInterval:       *stateSnapshotInterval,
+		RegistrationExpiry:          *registrationExpiry,
+		RegistrationDedupWindow:     *registrationDedupWindow,
+		ConfigGCInterval:            *configGCInterval,
+		MetricsLogInterval:          *metricsLogInterval,
+	}
+	if *configFile != "" {
+		o, err := mergeConfigFile(flags, *configFile, dctrlOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return dctrl.Options{}, nil, err
+		}
+		dctrlOpts = o
+	}
 
-	dctrl, err := dctrl.New(dctrl.Options{
-		OpSpecs:       OpSpecs,
-		APIServerAddr: *addr,
-		APIServerPort: *port,
-		HTTPMode:      *httpMode,
-		Insecure:      *insecure,
-		DisableAuth:   *disableAuthentication,
-		CertFile:      *certFile,
-		KeyFile:       *keyFile,
-		Logger:        logger,
-	})
+	opSpecs, err := dctrl.SelectOpSpecs(dctrlOpts.OpSpecs, enabledOperators, disabledOperators)
 	if err != nil {
-		setupLog.Error(err, "failed to init")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return dctrl.Options{}, nil, err
 	}
+	dctrlOpts.OpSpecs = opSpecs
 
-	ctx := ctrl.SetupSignalHandler()
+	return dctrlOpts, opts, nil
+}
 
-	if err := dctrl.Start(ctx); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(2)
+// flagOptions maps the flags to the names of the dctrl options they set.
+var flagOptions = map[string]string{
+	"addr":                           "APIServerAddr",
+	"port":                           "APIServerPort",
+	"api-path-prefix":                "APIPathPrefix",
+	"http":                           "HTTPMode",
+	"http-auth":                      "HTTPAuth",
+	"insecure":                       "Insecure",
+	"tls-cert-file":                  "CertFile",
+	"tls-key-file":                   "KeyFile",
+	"upf-config-format":              "UPFConfigFormat",
+	"service-addr":                   "ServiceAddr",
+	"service-path-prefix":            "ServicePathPrefix",
+	"manager-metrics":                "ManagerMetrics",
+	"health-probe-addr":              "HealthProbeAddr",
+	"token-self-test-interval":       "TokenSelfTestInterval",
+	"udm-config-selector":            "UDMConfigSelector",
+	"token-audit-retention":          "TokenAuditRetention",
+	"guti-collision-policy":          "GutiCollisionPolicy",
+	"duplicate-supi-policy":          "DuplicateSupiPolicy",
+	"fatal-error-policy":             "FatalErrorPolicy",
+	"failure-mode":                   "FailureMode",
+	"subscribed-ambr-policy":         "SubscribedAmbrPolicy",
+	"config-recreate-policy":         "ConfigRecreatePolicy",
+	"min-client-key-bits":            "MinClientKeyBits",
+	"ue-token-ttl":                   "UETokenTTL",
+	"max-ue-token-ttl":               "MaxUETokenTTL",
+	"ue-token-pool-size":             "UETokenPoolSize",
+	"unknown-field-policy":           "UnknownFieldPolicy",
+	"registration-event-buffer-size": "RegistrationEventBufferSize",
+	"max-requested-nssai":            "MaxRequestedNSSAI",
+	"registration-expiry":            "RegistrationExpiry",
+	"registration-dedup-window":      "RegistrationDedupWindow",
+	"config-gc-interval":             "ConfigGCInterval",
+	"metrics-log-interval":           "MetricsLogInterval",
+	"session-inactivity-timer":       "SessionInactivityTimer",
+	"usage-accounting-interval":      "UsageAccountingInterval",
+	"max-concurrent-mutations":       "MaxConcurrentMutations",
+	"state-file":                     "StateFile",
+	"state-snapshot-interval":        "StateSnapshotInterval",
+	"session-ip-pool":                "SessionIPPool",
+	"session-ipv6-pool":              "SessionIPv6Pool",
+	"upf-n3-address":                 "UPFTunnelAddresses",
+	"strict-schema-check":            "StrictSchemaCheck",
+	"validate-op-specs":              "ValidateOpSpecs",
+	"log-correlation":                "LogCorrelation",
+	"counter-view":                   "CounterView",
+	"revocation-list-file":           "RevocationListFile",
+	"home-network-key-file":          "HomeNetworkKeyFile",
+	"subscriber-key-store":           "SubscriberKeyStoreFile",
+	"subscriber-provisioning":        "SubscriberProvisioning",
+	"jwks-cert-file":                 "JWKSCertFiles",
+	"disable-authentication":         "DisableAuth",
+}
+
+// mergeConfigFile loads the options from a config file and overrides them with the flags given on
+// the command line or in the environment. The options missing from the file take the value of
+// their flag, i.e., the flag default, so the precedence is flag > environment > file > default.
+func mergeConfigFile(flags *flag.FlagSet, path string, flagOpts dctrl.Options) (dctrl.Options, error) {
+	opts, err := dctrl.LoadConfig(path)
+	if err != nil {
+		return dctrl.Options{}, err
+	}
+
+	// the keys present in the file, already validated by LoadConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return dctrl.Options{}, fmt.Errorf("failed to read config: %w", err)
+	}
+	keys := map[string]any{}
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return dctrl.Options{}, fmt.Errorf("%s: %w", path, err)
+	}
+	inFile := map[string]bool{}
+	t := reflect.TypeOf(dctrl.Config{})
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if _, ok := keys[key]; ok {
+			inFile[t.Field(i).Name] = true
+		}
+	}
+
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	dst, src := reflect.ValueOf(&opts).Elem(), reflect.ValueOf(flagOpts)
+	for name, field := range flagOptions {
+		if explicit[name] || !inFile[field] {
+			dst.FieldByName(field).Set(src.FieldByName(field))
+		}
+	}
+	return opts, nil
+}
+
+// redacted replaces the sensitive fields in the config dump.
+const redacted = "REDACTED"
+
+// dumpConfig prints the effective options as YAML, with the private key redacted.
+func dumpConfig(w io.Writer, opts dctrl.Options) error {
+	c := dctrl.NewConfig(opts)
+	if c.KeyFile != "" {
+		c.KeyFile = redacted
 	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// envPrefix is the prefix of the environment variables the flags can be set with.
+const envPrefix = "DCTRL5G_"
+
+// envVar returns the environment variable of a flag, e.g., DCTRL5G_TLS_CERT_FILE for
+// --tls-cert-file.
+func envVar(name string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
 }
+
+// setFlagsFromEnv sets the flags not given on the command line from their environment variables,
+// so that a flag takes precedence over the environment, and the environment over the default.
+// The values of the repeatable flags are separated by commas.
+func setFlagsFromEnv(flags *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		v, ok := os.LookupEnv(envVar(f.Name))
+		if !ok {
+			return
+		}
+		values := []string{v}
+		if _, repeatable := f.Value.(*stringList); repeatable {
+			values = strings.Split(v, ",")
+		}
+		for _, value := range values {
+			if e := flags.Set(f.Name, value); e != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", v, envVar(f.Name), e)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// aliasDebugAddr sets --service-addr from the deprecated --debug-addr, unless --service-addr is
+// given too. The alias is set like an explicit flag, so it takes precedence over the config file.
+func aliasDebugAddr(flags *flag.FlagSet, debugAddr string) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if !explicit["debug-addr"] {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Warning: --debug-addr is deprecated, use --service-addr\n")
+	if explicit["service-addr"] {
+		return nil
+	}
+	return flags.Set("service-addr", debugAddr)
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
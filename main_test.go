@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/auth"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+)
+
+var _ = Describe("Config dump", func() {
+	It("should dump the effective config with the key file redacted", func() {
+		opts, _, err := parseFlags([]string{"--port", "9443", "--http",
+			"--tls-key-file", "/etc/dctrl5g/secret.key"}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+
+		buf := &bytes.Buffer{}
+		Expect(dumpConfig(buf, opts)).To(Succeed())
+		Expect(buf.String()).NotTo(ContainSubstring("secret.key"))
+
+		config := map[string]any{}
+		Expect(yaml.Unmarshal(buf.Bytes(), &config)).To(Succeed())
+		Expect(config).To(HaveKeyWithValue("apiServerPort", BeNumerically("==", 9443)))
+		Expect(config).To(HaveKeyWithValue("httpMode", true))
+		Expect(config).To(HaveKeyWithValue("keyFile", "REDACTED"))
+		// defaults are reported too
+		Expect(config).To(HaveKeyWithValue("certFile", "apiserver.crt"))
+		Expect(config).To(HaveKeyWithValue("upfConfigFormat", "native"))
+	})
+})
+
+var _ = Describe("Environment variables", func() {
+	setenv := func(name, value string) {
+		Expect(os.Setenv(name, value)).To(Succeed())
+		DeferCleanup(os.Unsetenv, name)
+	}
+
+	It("should set the flags from the environment", func() {
+		setenv("DCTRL5G_ADDR", "0.0.0.0")
+		setenv("DCTRL5G_PORT", "9443")
+		setenv("DCTRL5G_TLS_CERT_FILE", "/etc/dctrl5g/tls.crt")
+		setenv("DCTRL5G_DISABLE_AUTHENTICATION", "true")
+		setenv("DCTRL5G_TOKEN_SELF_TEST_INTERVAL", "5m")
+		setenv("DCTRL5G_DISABLE_OPERATOR", "smf,pcf")
+
+		opts, _, err := parseFlags(nil, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.APIServerAddr).To(Equal("0.0.0.0"))
+		Expect(opts.APIServerPort).To(Equal(9443))
+		Expect(opts.CertFile).To(Equal("/etc/dctrl5g/tls.crt"))
+		Expect(opts.DisableAuth).To(BeTrue())
+		Expect(opts.TokenSelfTestInterval).To(Equal(5 * time.Minute))
+		Expect(opts.OpSpecs).To(HaveLen(3))
+		// the defaults are kept
+		Expect(opts.KeyFile).To(Equal("apiserver.key"))
+	})
+
+	It("should prefer the flags to the environment", func() {
+		setenv("DCTRL5G_PORT", "9443")
+		opts, _, err := parseFlags([]string{"--port", "10443"}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.APIServerPort).To(Equal(10443))
+	})
+
+	It("should reject an invalid value", func() {
+		setenv("DCTRL5G_PORT", "not-a-port")
+		_, _, err := parseFlags(nil, flag.ContinueOnError)
+		Expect(err).To(MatchError(ContainSubstring("DCTRL5G_PORT")))
+	})
+})
+
+var _ = Describe("Deprecated flags", func() {
+	It("should take --debug-addr as an alias of --service-addr", func() {
+		opts, _, err := parseFlags([]string{"--debug-addr", "localhost:9090"}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.ServiceAddr).To(Equal("localhost:9090"))
+
+		// --service-addr takes precedence
+		opts, _, err = parseFlags([]string{"--debug-addr", "localhost:9090", "--service-addr",
+			"localhost:9091"}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.ServiceAddr).To(Equal("localhost:9091"))
+	})
+})
+
+var _ = Describe("Config file", func() {
+	writeConfig := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "dctrl5g.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	const config = `opSpecs:
+  - name: amf
+    file: internal/operators/amf.yaml
+    dependsOn: [ausf, udm]
+    requires: [ausf, udm]
+  - name: ausf
+    file: internal/operators/ausf.yaml
+apiServerPort: 9443
+managerMetrics: false
+tokenSelfTestInterval: 5m
+udmConfigSelector: shard=0
+`
+
+	It("should load the options from the file", func() {
+		opts, _, err := parseFlags([]string{"--config", writeConfig(config)}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.OpSpecs).To(HaveLen(2))
+		Expect(opts.APIServerPort).To(Equal(9443))
+		Expect(opts.ManagerMetrics).To(BeFalse())
+		Expect(opts.TokenSelfTestInterval).To(Equal(5 * time.Minute))
+		Expect(opts.UDMConfigSelector.MatchLabels).To(HaveKeyWithValue("shard", "0"))
+		// the options missing from the file keep the flag defaults
+		Expect(opts.APIServerAddr).To(Equal("localhost"))
+		Expect(opts.CertFile).To(Equal("apiserver.crt"))
+	})
+
+	It("should prefer the flags and the environment to the file", func() {
+		Expect(os.Setenv("DCTRL5G_TOKEN_SELF_TEST_INTERVAL", "10m")).To(Succeed())
+		DeferCleanup(os.Unsetenv, "DCTRL5G_TOKEN_SELF_TEST_INTERVAL")
+
+		opts, _, err := parseFlags([]string{"--config", writeConfig(config), "--port", "10443",
+			"--manager-metrics"}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.APIServerPort).To(Equal(10443))
+		Expect(opts.ManagerMetrics).To(BeTrue())
+		Expect(opts.TokenSelfTestInterval).To(Equal(10 * time.Minute))
+		Expect(opts.OpSpecs).To(HaveLen(2))
+
+		// the operator selection applies to the operators of the file
+		_, _, err = parseFlags([]string{"--config", writeConfig(config), "--disable-operator", "ausf"},
+			flag.ContinueOnError)
+		Expect(err).To(MatchError(ContainSubstring(`operator "amf" requires operator "ausf"`)))
+	})
+
+	It("should reject a malformed file", func() {
+		path := writeConfig(config + "prot: 8443\n")
+		_, _, err := parseFlags([]string{"--config", path}, flag.ContinueOnError)
+		Expect(err).To(MatchError(ContainSubstring(path + `:12: unknown key "prot"`)))
+	})
+
+	It("should load a config dump", func() {
+		opts, _, err := parseFlags([]string{"--port", "9443", "--tls-key-file", ""}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		buf := &bytes.Buffer{}
+		Expect(dumpConfig(buf, opts)).To(Succeed())
+
+		loaded, _, err := parseFlags([]string{"--config", writeConfig(buf.String())}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(opts))
+	})
+
+	It("should map each flag to an option", func() {
+		t := reflect.TypeOf(dctrl.Options{})
+		for name, field := range flagOptions {
+			_, ok := t.FieldByName(field)
+			Expect(ok).To(BeTrue(), "flag %s: no option %s", name, field)
+		}
+	})
+})
+
+var _ = Describe("Operator selection", func() {
+	names := func(opts dctrl.Options) []string {
+		ret := []string{}
+		for _, s := range opts.OpSpecs {
+			ret = append(ret, s.Name)
+		}
+		return ret
+	}
+
+	It("should load all operators by default", func() {
+		opts, _, err := parseFlags(nil, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(opts)).To(Equal([]string{"amf", "ausf", "smf", "pcf", "upf"}))
+	})
+
+	It("should load the enabled operators only", func() {
+		opts, _, err := parseFlags([]string{"--enable-operator", "amf", "--enable-operator", "ausf",
+			"--enable-operator", "udm"}, flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(opts)).To(Equal([]string{"amf", "ausf"}))
+		// the startup order does not wait for the SMF not loaded
+		Expect(opts.OpSpecs[0].DependsOn).To(Equal([]string{"ausf", "udm"}))
+	})
+
+	It("should not load the disabled operators", func() {
+		opts, _, err := parseFlags([]string{"--disable-operator", "smf", "--disable-operator", "pcf"},
+			flag.ContinueOnError)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(opts)).To(Equal([]string{"amf", "ausf", "upf"}))
+	})
+
+	It("should reject a subset with a missing dependency", func() {
+		_, _, err := parseFlags([]string{"--enable-operator", "smf", "--enable-operator", "upf"},
+			flag.ContinueOnError)
+		Expect(err).To(MatchError(ContainSubstring(`operator "smf" requires operator "pcf"`)))
+
+		_, _, err = parseFlags([]string{"--disable-operator", "ausf"}, flag.ContinueOnError)
+		Expect(err).To(MatchError(ContainSubstring(`operator "amf" requires operator "ausf"`)))
+	})
+
+	It("should reject an unknown operator and disabling the UDM", func() {
+		_, _, err := parseFlags([]string{"--enable-operator", "nrf"}, flag.ContinueOnError)
+		Expect(err).To(MatchError(ContainSubstring(`unknown operator "nrf"`)))
+
+		_, _, err = parseFlags([]string{"--disable-operator", "udm"}, flag.ContinueOnError)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Init exit codes", func() {
+	It("should tell a bad operator file apart from an API server problem", func() {
+		opErr := &dctrl.OperatorLoadError{Name: "amf", File: "amf.yaml", Err: errors.New("bad spec")}
+		Expect(initExitCode(opErr)).To(Equal(exitOperatorLoad))
+		Expect(initExitCode(fmt.Errorf("wrapped: %w", opErr))).To(Equal(exitOperatorLoad))
+
+		apiErr := &dctrl.APIServerInitError{Err: errors.New("failed to load TLS key/cert")}
+		Expect(initExitCode(apiErr)).To(Equal(exitAPIServerInit))
+
+		Expect(initExitCode(errors.New("other"))).To(Equal(exitInitFailed))
+	})
+})
+
+var _ = Describe("Generate keys", func() {
+	var certFile, keyFile string
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		certFile, keyFile = filepath.Join(dir, "apiserver.crt"), filepath.Join(dir, "apiserver.key")
+	})
+
+	generate := func(extra ...string) (string, error) {
+		buf := &bytes.Buffer{}
+		args := append([]string{"--tls-cert-file", certFile, "--tls-key-file", keyFile}, extra...)
+		err := generateKeys(buf, args, flag.ContinueOnError)
+		return buf.String(), err
+	}
+
+	It("should write a keypair usable by the API server", func() {
+		out, err := generate("--san", "dctrl5g.example.com", "--san", "10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("CN=dctrl5g.example.com"))
+		Expect(out).To(ContainSubstring("Not after:"))
+
+		_, err = auth.LoadPrivateKey(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = auth.LoadPublicKey(certFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		data, err := os.ReadFile(certFile)
+		Expect(err).NotTo(HaveOccurred())
+		block, _ := pem.Decode(data)
+		Expect(block).NotTo(BeNil())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.DNSNames).To(ConsistOf("dctrl5g.example.com"))
+		Expect(cert.IPAddresses).To(HaveLen(1))
+		Expect(cert.IPAddresses[0].String()).To(Equal("10.0.0.1"))
+	})
+
+	It("should refuse to overwrite the existing files unless forced", func() {
+		_, err := generate()
+		Expect(err).NotTo(HaveOccurred())
+		key, err := os.ReadFile(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = generate()
+		Expect(err).To(MatchError(ContainSubstring("already exists")))
+		unchanged, err := os.ReadFile(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unchanged).To(Equal(key))
+
+		_, err = generate("--force")
+		Expect(err).NotTo(HaveOccurred())
+		replaced, err := os.ReadFile(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replaced).NotTo(Equal(key))
+	})
+})
+
+var _ = Describe("Subcommands", func() {
+	It("should start the server without a subcommand", func() {
+		_, ok := runSubcommand([]string{"--http"})
+		Expect(ok).To(BeFalse())
+		_, ok = runSubcommand(nil)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// DefaultHealthCheckInterval is the default interval of the health checks of the backends.
+	DefaultHealthCheckInterval = 5 * time.Second
+	// DefaultHealthCheckPath is the default path the health of a backend is checked at.
+	DefaultHealthCheckPath = "/healthz"
+)
+
+// Backend is an API server of a dctrl5g instance.
+type Backend struct {
+	// URL is the base URL of the API server, e.g., https://dctrl5g-0:8443, without a path.
+	URL string
+	// Weight is the share of the requests routed to the backend relative to the other backends
+	// (default: 1).
+	Weight int
+}
+
+// BalancerOptions are the options of the load balancer.
+type BalancerOptions struct {
+	// HealthCheckInterval is the interval of the health checks run by Balancer.Start (default:
+	// 5s).
+	HealthCheckInterval time.Duration
+	// HealthCheckPath is the path of the health endpoint of the backends (default: /healthz).
+	HealthCheckPath string
+	// HealthCheckClient is the HTTP client of the health checks (default: http.DefaultClient).
+	HealthCheckClient *http.Client
+}
+
+// backend is a backend along with its health and its smooth weighted round-robin state.
+type backend struct {
+	url     *url.URL
+	weight  int
+	current int
+	healthy bool
+}
+
+// Balancer spreads the requests to the API server over multiple dctrl5g instances by weighted
+// round-robin over the healthy backends. A backend a request fails to reach is marked unhealthy
+// and the request is retried on the next healthy backend; the health checks run by Start put the
+// recovered backends back into rotation. If no backend is healthy, all of them are tried.
+//
+// The balancer rewrites the URLs of the requests of a REST config:
+//
+//	b, err := client.NewBalancer([]client.Backend{{URL: "https://dctrl5g-0:8443", Weight: 2},
+//		{URL: "https://dctrl5g-1:8443"}}, client.BalancerOptions{})
+//	...
+//	go b.Start(ctx)
+//	c, err := crclient.NewWithWatch(b.Config(cfg), crclient.Options{})
+type Balancer struct {
+	backends []*backend
+	opts     BalancerOptions
+	mu       sync.Mutex
+}
+
+// NewBalancer creates a load balancer over the given backends.
+func NewBalancer(backends []Backend, opts BalancerOptions) (*Balancer, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no backends")
+	}
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if opts.HealthCheckPath == "" {
+		opts.HealthCheckPath = DefaultHealthCheckPath
+	}
+	if opts.HealthCheckClient == nil {
+		opts.HealthCheckClient = http.DefaultClient
+	}
+
+	b := &Balancer{opts: opts}
+	for _, be := range backends {
+		u, err := url.Parse(be.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend URL %q: %w", be.URL, err)
+		}
+		if u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid backend URL %q: expected scheme://host[:port]", be.URL)
+		}
+		if be.Weight < 0 {
+			return nil, fmt.Errorf("invalid weight %d of backend %q", be.Weight, be.URL)
+		}
+		weight := be.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		b.backends = append(b.backends, &backend{url: u, weight: weight, healthy: true})
+	}
+	return b, nil
+}
+
+// Config returns a copy of a REST config that routes the requests through the balancer. The host
+// of the config is replaced with the first backend.
+func (b *Balancer) Config(cfg *rest.Config) *rest.Config {
+	cfg = rest.CopyConfig(cfg)
+	cfg.Host = b.backends[0].url.Scheme + "://" + b.backends[0].url.Host
+	cfg.Wrap(b.Wrap)
+	return cfg
+}
+
+// Wrap returns a round tripper sending the requests through the balancer over the given round
+// tripper, e.g., as the WrapTransport of a REST config.
+func (b *Balancer) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return &balancedTransport{balancer: b, next: rt}
+}
+
+// Healthy returns the URLs of the backends currently considered healthy.
+func (b *Balancer) Healthy() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ret := []string{}
+	for _, be := range b.backends {
+		if be.healthy {
+			ret = append(ret, be.url.String())
+		}
+	}
+	return ret
+}
+
+// Start checks the health of the backends periodically until the context is cancelled. Blocks.
+func (b *Balancer) Start(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		b.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth checks the health of each backend once: a backend is healthy if its health endpoint
+// responds with a 2xx status.
+func (b *Balancer) CheckHealth(ctx context.Context) {
+	for _, be := range b.backends {
+		healthy := b.checkBackend(ctx, be.url)
+		b.mu.Lock()
+		be.healthy = healthy
+		b.mu.Unlock()
+	}
+}
+
+func (b *Balancer) checkBackend(ctx context.Context, u *url.URL) bool {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.HealthCheckInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		u.Scheme+"://"+u.Host+b.opts.HealthCheckPath, nil)
+	if err != nil {
+		return false
+	}
+	res, err := b.opts.HealthCheckClient.Do(req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close() //nolint:errcheck
+	return res.StatusCode >= 200 && res.StatusCode < 300
+}
+
+// next picks the next backend by smooth weighted round-robin among the healthy backends not tried
+// yet, or among all the backends not tried yet if none of these is healthy. Returns nil if all
+// backends have been tried.
+func (b *Balancer) next(tried map[*backend]bool) *backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	candidates := []*backend{}
+	for _, be := range b.backends {
+		if !tried[be] && be.healthy {
+			candidates = append(candidates, be)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, be := range b.backends {
+			if !tried[be] {
+				candidates = append(candidates, be)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var chosen *backend
+	total := 0
+	for _, be := range candidates {
+		be.current += be.weight
+		total += be.weight
+		if chosen == nil || be.current > chosen.current {
+			chosen = be
+		}
+	}
+	chosen.current -= total
+	return chosen
+}
+
+func (b *Balancer) markUnhealthy(be *backend) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	be.healthy = false
+}
+
+// balancedTransport routes each request to a backend of the balancer and retries the requests
+// that fail to reach a backend on the other backends.
+type balancedTransport struct {
+	balancer *Balancer
+	next     http.RoundTripper
+}
+
+func (t *balancedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	tried := map[*backend]bool{}
+	var lastErr error
+	for be := t.balancer.next(tried); be != nil; be = t.balancer.next(tried) {
+		tried[be] = true
+
+		r := req.Clone(req.Context())
+		r.URL.Scheme, r.URL.Host, r.Host = be.url.Scheme, be.url.Host, ""
+		if lastErr != nil && req.Body != nil {
+			// the body of the failed attempt may have been consumed
+			if req.GetBody == nil {
+				return nil, lastErr
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, lastErr
+			}
+			r.Body = body
+		}
+
+		res, err := next.RoundTrip(r)
+		if err == nil {
+			return res, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		t.balancer.markUnhealthy(be)
+		lastErr = fmt.Errorf("backend %s: %w", be.url, err)
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,106 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+var _ = Describe("Backend load balancing", func() {
+	// backendServer returns a backend answering each request with its name, and its health
+	// endpoint with the given status
+	backendServer := func(name string, health int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == client.DefaultHealthCheckPath {
+				w.WriteHeader(health)
+				return
+			}
+			io.Copy(io.Discard, r.Body) //nolint:errcheck
+			w.Write([]byte(name))       //nolint:errcheck
+		}))
+		DeferCleanup(srv.Close)
+		return srv
+	}
+
+	// get sends a request through the balancer and returns the name of the backend serving it
+	get := func(hc *http.Client, method string) string {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, "http://placeholder/apis/amf.view.dcontroller.io/v1alpha1",
+			strings.NewReader("{}"))
+		Expect(err).NotTo(HaveOccurred())
+		res, err := hc.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close() //nolint:errcheck
+		body, err := io.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	It("should route the requests to the healthy backend and retry on a failed one", func() {
+		healthy := backendServer("healthy", http.StatusOK)
+		failing := backendServer("failing", http.StatusOK)
+		failing.Close()
+
+		// the failing backend is picked first
+		b, err := client.NewBalancer([]client.Backend{
+			{URL: failing.URL, Weight: 3},
+			{URL: healthy.URL},
+		}, client.BalancerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		hc := &http.Client{Transport: b.Wrap(nil)}
+
+		for i := 0; i < 5; i++ {
+			Expect(get(hc, http.MethodPost)).To(Equal("healthy"))
+		}
+		Expect(b.Healthy()).To(Equal([]string{healthy.URL}))
+	})
+
+	It("should take the backends failing the health check out of rotation", func() {
+		healthy := backendServer("healthy", http.StatusOK)
+		unhealthy := backendServer("unhealthy", http.StatusServiceUnavailable)
+
+		b, err := client.NewBalancer([]client.Backend{{URL: unhealthy.URL}, {URL: healthy.URL}},
+			client.BalancerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		b.CheckHealth(context.Background())
+		Expect(b.Healthy()).To(Equal([]string{healthy.URL}))
+
+		hc := &http.Client{Transport: b.Wrap(nil)}
+		for i := 0; i < 4; i++ {
+			Expect(get(hc, http.MethodGet)).To(Equal("healthy"))
+		}
+	})
+
+	It("should spread the requests over the healthy backends by weight", func() {
+		a := backendServer("a", http.StatusOK)
+		c := backendServer("c", http.StatusOK)
+
+		b, err := client.NewBalancer([]client.Backend{{URL: a.URL, Weight: 2}, {URL: c.URL}},
+			client.BalancerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		hc := &http.Client{Transport: b.Wrap(nil)}
+
+		counts := map[string]int{}
+		for i := 0; i < 6; i++ {
+			counts[get(hc, http.MethodGet)]++
+		}
+		Expect(counts).To(Equal(map[string]int{"a": 4, "c": 2}))
+	})
+
+	It("should reject invalid backends", func() {
+		_, err := client.NewBalancer(nil, client.BalancerOptions{})
+		Expect(err).To(HaveOccurred())
+		_, err = client.NewBalancer([]client.Backend{{URL: "localhost:8443"}}, client.BalancerOptions{})
+		Expect(err).To(HaveOccurred())
+		_, err = client.NewBalancer([]client.Backend{{URL: "http://localhost:8443", Weight: -1}},
+			client.BalancerOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+})
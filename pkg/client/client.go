@@ -0,0 +1,205 @@
+// Package client is a typed Go client for the user-facing resources of the 5G control plane.
+//
+// The client submits the amf/Registration of a UE and waits until the AMF reaches a verdict:
+//
+//	spec, err := client.NewRegistrationBuilder().
+//		WithSUCI("suci-0-999-01-02-4f2a7b9c8d13e7a5c0").
+//		WithSecurityCapability([]string{"5G-EA0", "5G-EA2"}, []string{"5G-IA0", "5G-IA2"}).
+//		WithSlice("eMBB", "").
+//		Build()
+//	...
+//	status, err := client.New(c, client.Options{Namespace: "user-1"}).CreateRegistration(ctx, spec)
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+)
+
+const (
+	amfOperatorName  = "amf"
+	registrationKind = "Registration"
+
+	// DefaultPollInterval is the default interval of polling the status of the resources.
+	DefaultPollInterval = 100 * time.Millisecond
+	// DefaultTimeout is the default time to wait for the AMF to reach a verdict.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Options are the options of the client.
+type Options struct {
+	// Namespace is the namespace of the UE, i.e., the user. The registration of the UE is named
+	// after the namespace.
+	Namespace string
+	// PollInterval is the interval of polling the status (default: 100ms).
+	PollInterval time.Duration
+	// Timeout bounds the wait for a verdict (default: 30s).
+	Timeout time.Duration
+}
+
+// Client is a typed client for the resources of a UE.
+type Client struct {
+	client crclient.Client
+	opts   Options
+}
+
+// New creates a new client over a Kubernetes client connected to the API server. Watching the
+// resources requires a client.WithWatch.
+func New(c crclient.Client, opts Options) *Client {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Client{client: c, opts: opts}
+}
+
+// Condition is a status condition.
+type Condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// RegistrationStatus is the status of an amf/Registration.
+type RegistrationStatus struct {
+	GUTI         string         `json:"guti,omitempty"`
+	AllowedNSSAI []SNSSAI       `json:"allowedNSSAI,omitempty"`
+	Conditions   []Condition    `json:"conditions,omitempty"`
+	Config       map[string]any `json:"config,omitempty"`
+}
+
+// Condition returns a status condition by type, nil if not found.
+func (s *RegistrationStatus) Condition(condType string) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == condType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// DecodeGUTI decodes the GUTI allocated to the UE.
+func (s *RegistrationStatus) DecodeGUTI() (GUTI, error) {
+	if s.GUTI == "" {
+		return GUTI{}, errors.New("no GUTI allocated")
+	}
+	return ParseGUTI(s.GUTI)
+}
+
+// verdict returns true if the AMF has reached a verdict, with the failed condition if the
+// registration was rejected. The Ready condition is False until the registration succeeds, so a
+// rejection is told apart by one of the other conditions being False.
+func (s *RegistrationStatus) verdict() (bool, *Condition) {
+	if ready := s.Condition("Ready"); ready != nil && ready.Status == "True" {
+		return true, nil
+	}
+	for i := range s.Conditions {
+		if cond := &s.Conditions[i]; cond.Type != "Ready" && cond.Status == "False" {
+			return true, cond
+		}
+	}
+	return false, nil
+}
+
+// RejectedError is returned when the AMF rejects a registration.
+type RejectedError struct {
+	// Condition is the failed condition, e.g., Validated with reason SuciNotFound.
+	Condition Condition
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("registration rejected: %s: %s (%s)", e.Condition.Type, e.Condition.Reason,
+		e.Condition.Message)
+}
+
+// CreateRegistration validates and submits the registration of the UE and waits until the AMF
+// reaches a verdict. If the registration is rejected, the status is returned along with a
+// RejectedError carrying the failed condition.
+func (c *Client) CreateRegistration(ctx context.Context, spec RegistrationSpec) (*RegistrationStatus, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal registration spec: %w", err)
+	}
+	reg := object.NewViewObject(amfOperatorName, registrationKind)
+	object.SetName(reg, c.opts.Namespace, c.opts.Namespace)
+	reg.Object["spec"] = content
+
+	if err := c.client.Create(ctx, reg); err != nil {
+		return nil, fmt.Errorf("failed to create registration %s: %w", crclient.ObjectKeyFromObject(reg), err)
+	}
+
+	return c.waitForRegistration(ctx, crclient.ObjectKeyFromObject(reg))
+}
+
+// GetRegistration returns the current status of the registration of the UE.
+func (c *Client) GetRegistration(ctx context.Context) (*RegistrationStatus, error) {
+	return c.getRegistration(ctx, crclient.ObjectKey{Namespace: c.opts.Namespace, Name: c.opts.Namespace})
+}
+
+// DeleteRegistration deregisters the UE.
+func (c *Client) DeleteRegistration(ctx context.Context) error {
+	reg := object.NewViewObject(amfOperatorName, registrationKind)
+	object.SetName(reg, c.opts.Namespace, c.opts.Namespace)
+	if err := c.client.Delete(ctx, reg); err != nil {
+		return fmt.Errorf("failed to delete registration %s: %w", crclient.ObjectKeyFromObject(reg), err)
+	}
+	return nil
+}
+
+func (c *Client) getRegistration(ctx context.Context, key crclient.ObjectKey) (*RegistrationStatus, error) {
+	reg := object.NewViewObject(amfOperatorName, registrationKind)
+	if err := c.client.Get(ctx, key, reg); err != nil {
+		return nil, err
+	}
+
+	status := &RegistrationStatus{}
+	content, ok := reg.UnstructuredContent()["status"].(map[string]any)
+	if !ok {
+		return status, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, status); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registration status: %w", err)
+	}
+	return status, nil
+}
+
+func (c *Client) waitForRegistration(ctx context.Context, key crclient.ObjectKey) (*RegistrationStatus, error) {
+	var (
+		status *RegistrationStatus
+		failed *Condition
+	)
+	err := wait.PollUntilContextTimeout(ctx, c.opts.PollInterval, c.opts.Timeout, true,
+		func(ctx context.Context) (bool, error) {
+			s, err := c.getRegistration(ctx, key)
+			if err != nil {
+				// the registration may not have been propagated yet
+				return false, crclient.IgnoreNotFound(err)
+			}
+			status = s
+			done, cond := s.verdict()
+			failed = cond
+			return done, nil
+		})
+	if err != nil {
+		return status, fmt.Errorf("failed to wait for registration %s: %w", key, err)
+	}
+	if failed != nil {
+		return status, &RejectedError{Condition: *failed}
+	}
+	return status, nil
+}
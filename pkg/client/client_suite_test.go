@@ -0,0 +1,29 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+)
+
+var (
+	loglevel = 0
+	timeout  = time.Second * 5
+	opSpecs  = []dctrl.OpSpec{
+		{Name: "amf", File: "../../internal/operators/amf.yaml"},
+		{Name: "ausf", File: "../../internal/operators/ausf.yaml"},
+		{Name: "smf", File: "../../internal/operators/smf.yaml"},
+		{Name: "pcf", File: "../../internal/operators/pcf.yaml"},
+		{Name: "upf", File: "../../internal/operators/upf.yaml"},
+		// UDM is manual
+	}
+)
+
+func TestClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Client")
+}
@@ -0,0 +1,146 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+	"github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+var _ = Describe("Registration client", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		c      *client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		c = client.New(d.GetCache().GetClient(), client.Options{Namespace: "user-1", Timeout: timeout})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should register a UE", func() {
+		spec, err := client.NewRegistrationBuilder().
+			WithSUCI("suci-0-999-01-02-4f2a7b9c8d13e7a5c0").
+			WithSecurityCapability([]string{"5G-EA0", "5G-EA2"}, []string{"5G-IA0", "5G-IA2"}).
+			WithSlice("eMBB", "").
+			Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		status, err := c.CreateRegistration(ctx, spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Condition("Ready")).NotTo(BeNil())
+		Expect(status.Condition("Ready").Status).To(Equal("True"))
+		Expect(status.Condition("Ready").Reason).To(Equal("RegistrationSuccessful"))
+
+		guti, err := status.DecodeGUTI()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(guti).To(Equal(client.GUTI{MCC: "310", MNC: "170", AMFRegionID: "3F",
+			AMFSetID: "152", AMFPointer: "2A", TMSI: "B7C8D9E0"}))
+		Expect(guti.String()).To(Equal(status.GUTI))
+	})
+
+	It("should return the rejection of a registration without a SUCI", func() {
+		spec, err := client.NewRegistrationBuilder().
+			WithMobileIdentity(client.MobileIdentitySUPI, "imsi-999010000000001").
+			WithSecurityCapability([]string{"5G-EA0", "5G-EA2"}, []string{"5G-IA0", "5G-IA2"}).
+			WithSlice("eMBB", "").
+			Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		status, err := c.CreateRegistration(ctx, spec)
+		Expect(err).To(HaveOccurred())
+		var rejected *client.RejectedError
+		Expect(errors.As(err, &rejected)).To(BeTrue())
+		Expect(rejected.Condition.Type).To(Equal("Validated"))
+		Expect(rejected.Condition.Reason).To(Equal("SuciNotFound"))
+
+		Expect(status).NotTo(BeNil())
+		Expect(status.Condition("Ready").Status).To(Equal("False"))
+		_, err = status.DecodeGUTI()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should validate the spec before submitting", func() {
+		_, err := client.NewRegistrationBuilder().
+			WithRegistrationType("bogus").
+			WithSecurityCapability([]string{"5G-EA2"}, nil).
+			Build()
+		Expect(err).To(MatchError(ContainSubstring("registrationType")))
+		Expect(err).To(MatchError(ContainSubstring("mobileIdentity.value")))
+		Expect(err).To(MatchError(ContainSubstring("integrityAlgorithms")))
+
+		_, err = c.CreateRegistration(ctx, client.RegistrationSpec{})
+		Expect(err).To(MatchError(ContainSubstring("invalid registration spec")))
+	})
+
+	It("should reject malformed GUTIs", func() {
+		_, err := client.ParseGUTI("test-guti-000000000000000")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Tracking area", func() {
+	It("should parse and format a valid tracking area", func() {
+		tai, err := client.ParseTrackingArea("tai-001-01-00000A")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tai).To(Equal(client.TrackingArea{MCC: "001", MNC: "01", TAC: "00000A"}))
+		Expect(tai.PLMN()).To(Equal("001-01"))
+		Expect(tai.String()).To(Equal("tai-001-01-00000A"))
+	})
+
+	It("should reject malformed tracking areas", func() {
+		for _, s := range []string{"", "tai-001-01", "tac-001-01-000001", "tai-01-01-000001",
+			"tai-001-1-000001", "tai-001-01-00001", "tai-001-01-00000G"} {
+			_, err := client.ParseTrackingArea(s)
+			Expect(err).To(HaveOccurred(), s)
+		}
+
+		_, err := client.NewRegistrationBuilder().
+			WithSUCI("suci-0-999-01-02-4f2a7b9c8d13e7a5c0").
+			WithSecurityCapability([]string{"5G-EA0", "5G-EA2"}, []string{"5G-IA0", "5G-IA2"}).
+			WithTrackingArea("tai-001-01-zzz").
+			Build()
+		Expect(err).To(MatchError(ContainSubstring("trackingArea")))
+	})
+})
+
+var _ = Describe("SUCI", func() {
+	It("should parse and format a valid SUCI", func() {
+		suci, err := client.ParseSUCI("suci-0-999-01-02-4f2a7b9c8d13e7a5c0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(suci).To(Equal(client.SUCI{SUPIType: "0", MCC: "999", MNC: "01",
+			RoutingIndicator: "02", SchemeOutput: "4f2a7b9c8d13e7a5c0"}))
+		Expect(suci.PLMN()).To(Equal("999-01"))
+		Expect(suci.String()).To(Equal("suci-0-999-01-02-4f2a7b9c8d13e7a5c0"))
+	})
+
+	It("should parse and format a SUCI in the 3GPP form", func() {
+		suci, err := client.ParseSUCI("suci-0-001-01-0000-0-0-0123456789")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(suci).To(Equal(client.SUCI{SUPIType: "0", MCC: "001", MNC: "01", RoutingIndicator: "0000",
+			ProtectionScheme: "0", HomeNetworkKeyID: "0", SchemeOutput: "0123456789"}))
+		Expect(suci.PLMN()).To(Equal("001-01"))
+		Expect(suci.String()).To(Equal("suci-0-001-01-0000-0-0-0123456789"))
+	})
+
+	It("should reject malformed SUCIs", func() {
+		for _, s := range []string{"", "test-suci-000000000000000", "suci-0-999-01-02",
+			"suci-0-99-01-02-4f2a", "suci-0-999-1-02-4f2a", "suci-0-999-01-02-",
+			"suci-0-001-01-0000-0-0", "suci-0-001-01-0000-x-0-0123456789"} {
+			_, err := client.ParseSUCI(s)
+			Expect(err).To(HaveOccurred(), s)
+		}
+	})
+})
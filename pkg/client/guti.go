@@ -0,0 +1,47 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GUTI is a decoded 5G-GUTI. The AMF renders the GUTIs as
+// guti-<mcc>-<mnc>-<amf-region-id>-<amf-set-id>-<amf-pointer>-<5g-tmsi>, e.g.,
+// guti-310-170-3F-152-2A-B7C8D9E0.
+type GUTI struct {
+	MCC         string
+	MNC         string
+	AMFRegionID string
+	AMFSetID    string
+	AMFPointer  string
+	TMSI        string
+}
+
+// ParseGUTI decodes a GUTI.
+func ParseGUTI(s string) (GUTI, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 7 || parts[0] != "guti" {
+		return GUTI{}, fmt.Errorf("invalid GUTI %q", s)
+	}
+	for _, p := range parts[1:] {
+		if p == "" {
+			return GUTI{}, fmt.Errorf("invalid GUTI %q: empty field", s)
+		}
+	}
+	return GUTI{
+		MCC:         parts[1],
+		MNC:         parts[2],
+		AMFRegionID: parts[3],
+		AMFSetID:    parts[4],
+		AMFPointer:  parts[5],
+		TMSI:        parts[6],
+	}, nil
+}
+
+// PLMN returns the PLMN identity of the GUTI.
+func (g GUTI) PLMN() string { return g.MCC + "-" + g.MNC }
+
+// String renders the GUTI in the format used by the AMF.
+func (g GUTI) String() string {
+	return strings.Join([]string{"guti", g.MCC, g.MNC, g.AMFRegionID, g.AMFSetID, g.AMFPointer, g.TMSI}, "-")
+}
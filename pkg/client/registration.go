@@ -0,0 +1,206 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// The mobile identity types.
+const (
+	MobileIdentitySUCI   = "SUCI"
+	MobileIdentitySUPI   = "SUPI"
+	MobileIdentityGUTI   = "GUTI"
+	MobileIdentityIMEI   = "IMEI"
+	MobileIdentityIMEISV = "IMEISV"
+	MobileIdentityTMSI   = "TMSI"
+)
+
+var (
+	registrationTypes   = []string{"initial", "mobility", "periodic", "emergency"}
+	accessTypes         = []string{"3gpp", "non-3gpp", "both"}
+	mobileIdentityTypes = []string{MobileIdentitySUCI, MobileIdentitySUPI, MobileIdentityGUTI,
+		MobileIdentityIMEI, MobileIdentityIMEISV, MobileIdentityTMSI}
+)
+
+// RegistrationSpec is the spec of an amf/Registration, see the README for the semantics of the
+// fields.
+type RegistrationSpec struct {
+	RegistrationType     string               `json:"registrationType"`
+	AccessType           string               `json:"accessType,omitempty"`
+	TrackingArea         string               `json:"trackingArea,omitempty"`
+	MobileIdentity       MobileIdentity       `json:"mobileIdentity"`
+	NASKeySetIdentifier  *NASKeySetIdentifier `json:"nasKeySetIdentifier,omitempty"`
+	UESecurityCapability SecurityCapability   `json:"ueSecurityCapability"`
+	UEStatus             *UEStatus            `json:"ueStatus,omitempty"`
+	UENetworkCapability  *NetworkCapability   `json:"ueNetworkCapability,omitempty"`
+	RequestedNSSAI       []SNSSAI             `json:"requestedNSSAI,omitempty"`
+}
+
+// MobileIdentity is the identity the UE registers with.
+type MobileIdentity struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// NASKeySetIdentifier identifies the NAS security context of the UE.
+type NASKeySetIdentifier struct {
+	TypeOfSecurityContext string `json:"typeOfSecurityContext,omitempty"`
+	KeySetIdentifier      string `json:"keySetIdentifier,omitempty"`
+}
+
+// SecurityCapability lists the 5G algorithms supported by the UE, in the order of preference.
+type SecurityCapability struct {
+	EncryptionAlgorithms []string `json:"encryptionAlgorithms"`
+	IntegrityAlgorithms  []string `json:"integrityAlgorithms"`
+}
+
+// UEStatus is the mode capability of the UE.
+type UEStatus struct {
+	S1Mode bool `json:"s1Mode"`
+	N1Mode bool `json:"n1Mode"`
+}
+
+// NetworkCapability lists the EPS algorithms supported by the UE for LTE interworking.
+type NetworkCapability struct {
+	EPSEncryptionAlgorithms []string `json:"epsEncryptionAlgorithms,omitempty"`
+	EPSIntegrityAlgorithms  []string `json:"epsIntegrityAlgorithms,omitempty"`
+}
+
+// SNSSAI is a network slice.
+type SNSSAI struct {
+	SliceType           string `json:"sliceType"`
+	SliceDifferentiator string `json:"sliceDifferentiator,omitempty"`
+}
+
+// Validate checks the mandatory fields and the enums of the spec. The policy checks, e.g., the
+// supported algorithms and the subscribed slices, are left to the AMF.
+func (s *RegistrationSpec) Validate() error {
+	errs := []error{}
+	if !slices.Contains(registrationTypes, s.RegistrationType) {
+		errs = append(errs, fmt.Errorf("registrationType: invalid value %q", s.RegistrationType))
+	}
+	if s.AccessType != "" && !slices.Contains(accessTypes, s.AccessType) {
+		errs = append(errs, fmt.Errorf("accessType: invalid value %q", s.AccessType))
+	}
+	if s.TrackingArea != "" {
+		if _, err := ParseTrackingArea(s.TrackingArea); err != nil {
+			errs = append(errs, fmt.Errorf("trackingArea: %w", err))
+		}
+	}
+	if !slices.Contains(mobileIdentityTypes, s.MobileIdentity.Type) {
+		errs = append(errs, fmt.Errorf("mobileIdentity.type: invalid value %q", s.MobileIdentity.Type))
+	}
+	if s.MobileIdentity.Value == "" {
+		errs = append(errs, errors.New("mobileIdentity.value: required"))
+	}
+	if len(s.UESecurityCapability.EncryptionAlgorithms) == 0 {
+		errs = append(errs, errors.New("ueSecurityCapability.encryptionAlgorithms: required"))
+	}
+	if len(s.UESecurityCapability.IntegrityAlgorithms) == 0 {
+		errs = append(errs, errors.New("ueSecurityCapability.integrityAlgorithms: required"))
+	}
+	for i, sl := range s.RequestedNSSAI {
+		if sl.SliceType == "" {
+			errs = append(errs, fmt.Errorf("requestedNSSAI[%d].sliceType: required", i))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid registration spec: %w", err)
+	}
+	return nil
+}
+
+// RegistrationBuilder builds a RegistrationSpec. The defaults are an initial registration of an
+// N1 mode UE.
+type RegistrationBuilder struct {
+	spec RegistrationSpec
+}
+
+// NewRegistrationBuilder creates a new registration builder.
+func NewRegistrationBuilder() *RegistrationBuilder {
+	return &RegistrationBuilder{spec: RegistrationSpec{
+		RegistrationType: "initial",
+		UEStatus:         &UEStatus{N1Mode: true},
+	}}
+}
+
+// WithRegistrationType sets the registration type.
+func (b *RegistrationBuilder) WithRegistrationType(t string) *RegistrationBuilder {
+	b.spec.RegistrationType = t
+	return b
+}
+
+// WithAccessType sets the access type.
+func (b *RegistrationBuilder) WithAccessType(t string) *RegistrationBuilder {
+	b.spec.AccessType = t
+	return b
+}
+
+// WithTrackingArea sets the tracking area.
+func (b *RegistrationBuilder) WithTrackingArea(tai string) *RegistrationBuilder {
+	b.spec.TrackingArea = tai
+	return b
+}
+
+// WithMobileIdentity sets the mobile identity.
+func (b *RegistrationBuilder) WithMobileIdentity(t, value string) *RegistrationBuilder {
+	b.spec.MobileIdentity = MobileIdentity{Type: t, Value: value}
+	return b
+}
+
+// WithSUCI sets a SUCI as the mobile identity.
+func (b *RegistrationBuilder) WithSUCI(suci string) *RegistrationBuilder {
+	return b.WithMobileIdentity(MobileIdentitySUCI, suci)
+}
+
+// WithNASKeySetIdentifier sets the NAS key set identifier.
+func (b *RegistrationBuilder) WithNASKeySetIdentifier(typeOfSecurityContext, keySetIdentifier string) *RegistrationBuilder {
+	b.spec.NASKeySetIdentifier = &NASKeySetIdentifier{
+		TypeOfSecurityContext: typeOfSecurityContext,
+		KeySetIdentifier:      keySetIdentifier,
+	}
+	return b
+}
+
+// WithSecurityCapability sets the encryption and integrity algorithms in the order of preference.
+func (b *RegistrationBuilder) WithSecurityCapability(encryption, integrity []string) *RegistrationBuilder {
+	b.spec.UESecurityCapability = SecurityCapability{
+		EncryptionAlgorithms: encryption,
+		IntegrityAlgorithms:  integrity,
+	}
+	return b
+}
+
+// WithUEStatus sets the mode capability.
+func (b *RegistrationBuilder) WithUEStatus(s1Mode, n1Mode bool) *RegistrationBuilder {
+	b.spec.UEStatus = &UEStatus{S1Mode: s1Mode, N1Mode: n1Mode}
+	return b
+}
+
+// WithNetworkCapability sets the EPS algorithms.
+func (b *RegistrationBuilder) WithNetworkCapability(encryption, integrity []string) *RegistrationBuilder {
+	b.spec.UENetworkCapability = &NetworkCapability{
+		EPSEncryptionAlgorithms: encryption,
+		EPSIntegrityAlgorithms:  integrity,
+	}
+	return b
+}
+
+// WithSlice adds a slice to the requested NSSAI. The slice differentiator is optional.
+func (b *RegistrationBuilder) WithSlice(sliceType, sliceDifferentiator string) *RegistrationBuilder {
+	b.spec.RequestedNSSAI = append(b.spec.RequestedNSSAI, SNSSAI{
+		SliceType:           sliceType,
+		SliceDifferentiator: sliceDifferentiator,
+	})
+	return b
+}
+
+// Build validates and returns the spec.
+func (b *RegistrationBuilder) Build() (RegistrationSpec, error) {
+	spec := b.spec
+	if err := spec.Validate(); err != nil {
+		return RegistrationSpec{}, err
+	}
+	return spec, nil
+}
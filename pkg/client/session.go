@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"maps"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/l7mp/dcontroller/pkg/cache"
+	"github.com/l7mp/dcontroller/pkg/object"
+)
+
+const sessionKind = "Session"
+
+// ConditionState is the state of a status condition.
+type ConditionState struct {
+	Status  string
+	Reason  string
+	Message string
+}
+
+// SessionEvent is a change of the status conditions of an amf/Session, keyed by the condition
+// type (Ready, Validated, PolicyApplied and UPFConfigured). The last event of a deleted session
+// is of type watch.Deleted and carries the last known conditions.
+type SessionEvent struct {
+	Type       watch.EventType
+	Namespace  string
+	Name       string
+	Conditions map[string]ConditionState
+}
+
+// WatchSession watches the status conditions of a session and emits an event on each change. The
+// channel is closed when the context is cancelled or after the Deleted event of the session. The
+// underlying client must implement client.WithWatch.
+func (c *Client) WatchSession(ctx context.Context, namespace, name string) (<-chan SessionEvent, error) {
+	wc, ok := c.client.(crclient.WithWatch)
+	if !ok {
+		return nil, errors.New("client does not support watches")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	list := cache.NewViewObjectList(amfOperatorName, sessionKind)
+	w, err := wc.Watch(ctx, list, crclient.InNamespace(namespace))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	ch := make(chan SessionEvent)
+	go func() {
+		defer close(ch)
+		defer cancel()
+		defer w.Stop()
+
+		var last map[string]ConditionState
+		for {
+			var e watch.Event
+			select {
+			case <-ctx.Done():
+				return
+			case ev, open := <-w.ResultChan():
+				if !open {
+					return
+				}
+				e = ev
+			}
+
+			obj, ok := e.Object.(object.Object)
+			if !ok || obj.GetName() != name {
+				continue
+			}
+
+			event := SessionEvent{Type: e.Type, Namespace: namespace, Name: name}
+			switch e.Type {
+			case watch.Deleted:
+				event.Conditions = last
+			case watch.Added, watch.Modified:
+				event.Conditions = sessionConditions(obj)
+				if last != nil && maps.Equal(event.Conditions, last) {
+					continue
+				}
+				last = event.Conditions
+			default:
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- event:
+			}
+
+			if e.Type == watch.Deleted {
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// sessionConditions decodes the status conditions of a session.
+func sessionConditions(obj object.Object) map[string]ConditionState {
+	ret := map[string]ConditionState{}
+	conds, _, _ := unstructured.NestedSlice(obj.UnstructuredContent(), "status", "conditions")
+	for _, c := range conds {
+		cond, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		t, _ := cond["type"].(string)
+		if t == "" {
+			continue
+		}
+		s := ConditionState{}
+		s.Status, _ = cond["status"].(string)
+		s.Reason, _ = cond["reason"].(string)
+		s.Message, _ = cond["message"].(string)
+		ret[t] = s
+	}
+	return ret
+}
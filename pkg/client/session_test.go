@@ -0,0 +1,126 @@
+package client_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/watch"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/l7mp/dcontroller/pkg/object"
+
+	"github.com/hsnlab/dctrl5g/internal/dctrl"
+	"github.com/hsnlab/dctrl5g/internal/testsuite"
+	"github.com/hsnlab/dctrl5g/pkg/client"
+)
+
+var _ = Describe("Session watcher", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		k8s    crclient.WithWatch
+		c      *client.Client
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		d, err := testsuite.StartOpsWithOptions(ctx, dctrl.Options{OpSpecs: opSpecs}, loglevel)
+		Expect(err).NotTo(HaveOccurred())
+		k8s = d.GetCache().GetClient()
+		c = client.New(k8s, client.Options{Namespace: "user-1", Timeout: timeout})
+
+		spec, err := client.NewRegistrationBuilder().
+			WithSUCI("suci-0-999-01-02-4f2a7b9c8d13e7a5c0").
+			WithSecurityCapability([]string{"5G-EA0", "5G-EA2"}, []string{"5G-IA0", "5G-IA2"}).
+			WithSlice("eMBB", "").
+			Build()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = c.CreateRegistration(ctx, spec)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	createSession := func() object.Object {
+		yamlData := `
+apiVersion: amf.view.dcontroller.io/v1alpha1
+kind: Session
+metadata:
+  name: user-1
+  namespace: user-1
+spec:
+  nssai: eMBB
+  guti: guti-310-170-3F-152-2A-B7C8D9E0
+  sessionId: 1
+  pduSessionType: IPv4
+  sscMode: SSC3
+  networkConfiguration:
+    requests:
+      - type: IPConfiguration
+        addressFamily: IPv4
+  qos:
+    flows:
+      - name: best-effort-flow
+        fiveQI: BestEffort
+    rules:
+      - name: default-rule
+        precedence: 255
+        default: true
+        qosFlow: best-effort-flow
+        filters:
+          - name: match-all
+            direction: Bidirectional
+            match:
+              type: MatchAll`
+		session := object.New()
+		Expect(yaml.Unmarshal([]byte(yamlData), &session)).To(Succeed())
+		Expect(testsuite.CreateWithRetry(ctx, k8s, session)).To(Succeed())
+		return session
+	}
+
+	It("should deliver the condition transitions of a session in order", func() {
+		events, err := c.WatchSession(ctx, "user-1", "user-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		session := createSession()
+
+		// the index of the first event each condition is True in: the transitions may be
+		// coalesced into a single event, but never reordered
+		order := []string{"Validated", "PolicyApplied", "UPFConfigured", "Ready"}
+		first := map[string]int{}
+		for i := 0; len(first) < len(order); i++ {
+			var e client.SessionEvent
+			Eventually(events, timeout).Should(Receive(&e))
+			Expect(e.Type).NotTo(Equal(watch.Deleted))
+			for _, t := range order {
+				if _, ok := first[t]; !ok && e.Conditions[t].Status == "True" {
+					first[t] = i
+				}
+			}
+		}
+		for i := 1; i < len(order); i++ {
+			Expect(first[order[i-1]]).To(BeNumerically("<=", first[order[i]]),
+				"%s before %s", order[i-1], order[i])
+		}
+
+		Expect(k8s.Delete(ctx, session)).To(Succeed())
+		var e client.SessionEvent
+		Eventually(events, timeout).Should(Receive(&e, HaveField("Type", watch.Deleted)))
+		Expect(e.Conditions).To(HaveKeyWithValue("Ready", HaveField("Status", "True")))
+		Eventually(events, timeout).Should(BeClosed())
+	})
+
+	It("should close the channel when the context is cancelled", func() {
+		wctx, wcancel := context.WithCancel(ctx)
+		events, err := c.WatchSession(wctx, "user-1", "user-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		wcancel()
+		Eventually(events, timeout).Should(BeClosed())
+	})
+})
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SUCI is a decoded subscription concealed identifier. The SUCIs are rendered either as
+// suci-<supi-type>-<mcc>-<mnc>-<routing-indicator>-<scheme-output>, e.g.,
+// suci-0-999-01-02-4f2a7b9c8d13e7a5c0, resolved by the AUSF from its static table, or in the
+// 3GPP form suci-<supi-type>-<mcc>-<mnc>-<routing-indicator>-<protection-scheme>-<key-id>-<scheme-output>,
+// e.g., suci-0-001-01-0000-0-0-0123456789, where the MCC is 3 digits and the MNC is 2 or 3 digits.
+type SUCI struct {
+	SUPIType         string
+	MCC              string
+	MNC              string
+	RoutingIndicator string
+	// ProtectionScheme and HomeNetworkKeyID are empty in the short form.
+	ProtectionScheme string
+	HomeNetworkKeyID string
+	SchemeOutput     string
+}
+
+// ParseSUCI decodes and validates a SUCI.
+func ParseSUCI(s string) (SUCI, error) {
+	parts := strings.Split(s, "-")
+	if (len(parts) != 6 && len(parts) != 8) || parts[0] != "suci" {
+		return SUCI{}, fmt.Errorf("invalid SUCI %q: expected suci-<supi-type>-<mcc>-<mnc>-<routing-indicator>-"+
+			"[<protection-scheme>-<key-id>-]<scheme-output>", s)
+	}
+	u := SUCI{
+		SUPIType:         parts[1],
+		MCC:              parts[2],
+		MNC:              parts[3],
+		RoutingIndicator: parts[4],
+		SchemeOutput:     parts[len(parts)-1],
+	}
+	if len(parts) == 8 {
+		u.ProtectionScheme, u.HomeNetworkKeyID = parts[5], parts[6]
+		if u.ProtectionScheme == "" || !isDigits(u.ProtectionScheme) {
+			return SUCI{}, fmt.Errorf("invalid SUCI %q: protection scheme %q is not a number", s, u.ProtectionScheme)
+		}
+		if u.HomeNetworkKeyID == "" || !isDigits(u.HomeNetworkKeyID) {
+			return SUCI{}, fmt.Errorf("invalid SUCI %q: home network key ID %q is not a number", s, u.HomeNetworkKeyID)
+		}
+	}
+	if len(u.MCC) != 3 || !isDigits(u.MCC) {
+		return SUCI{}, fmt.Errorf("invalid SUCI %q: MCC %q is not 3 digits", s, u.MCC)
+	}
+	if len(u.MNC) < 2 || len(u.MNC) > 3 || !isDigits(u.MNC) {
+		return SUCI{}, fmt.Errorf("invalid SUCI %q: MNC %q is not 2 or 3 digits", s, u.MNC)
+	}
+	if u.SchemeOutput == "" {
+		return SUCI{}, fmt.Errorf("invalid SUCI %q: empty scheme output", s)
+	}
+	return u, nil
+}
+
+// PLMN returns the PLMN identity of the home network of the SUCI.
+func (u SUCI) PLMN() string { return u.MCC + "-" + u.MNC }
+
+// String renders the SUCI in the format it was parsed from.
+func (u SUCI) String() string {
+	parts := []string{"suci", u.SUPIType, u.MCC, u.MNC, u.RoutingIndicator}
+	if u.ProtectionScheme != "" {
+		parts = append(parts, u.ProtectionScheme, u.HomeNetworkKeyID)
+	}
+	return strings.Join(append(parts, u.SchemeOutput), "-")
+}
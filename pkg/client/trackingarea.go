@@ -0,0 +1,58 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TrackingArea is a decoded tracking area identity (TAI). The TAIs are rendered as
+// tai-<mcc>-<mnc>-<tac>, e.g., tai-001-01-000001, where the MCC is 3 digits, the MNC is 2 or 3
+// digits and the TAC is a 24-bit hex number.
+type TrackingArea struct {
+	MCC string
+	MNC string
+	TAC string
+}
+
+// ParseTrackingArea decodes and validates a TAI.
+func ParseTrackingArea(s string) (TrackingArea, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "tai" {
+		return TrackingArea{}, fmt.Errorf("invalid tracking area %q: expected tai-<mcc>-<mnc>-<tac>", s)
+	}
+	t := TrackingArea{MCC: parts[1], MNC: parts[2], TAC: parts[3]}
+	if err := t.Validate(); err != nil {
+		return TrackingArea{}, fmt.Errorf("invalid tracking area %q: %w", s, err)
+	}
+	return t, nil
+}
+
+// Validate checks the fields of the TAI.
+func (t TrackingArea) Validate() error {
+	if len(t.MCC) != 3 || !isDigits(t.MCC) {
+		return fmt.Errorf("MCC %q is not 3 digits", t.MCC)
+	}
+	if len(t.MNC) < 2 || len(t.MNC) > 3 || !isDigits(t.MNC) {
+		return fmt.Errorf("MNC %q is not 2 or 3 digits", t.MNC)
+	}
+	if len(t.TAC) != 6 || !isHex(t.TAC) {
+		return fmt.Errorf("TAC %q is not 6 hex digits", t.TAC)
+	}
+	return nil
+}
+
+// PLMN returns the PLMN identity of the TAI.
+func (t TrackingArea) PLMN() string { return t.MCC + "-" + t.MNC }
+
+// String renders the TAI in the format used by the AMF.
+func (t TrackingArea) String() string {
+	return strings.Join([]string{"tai", t.MCC, t.MNC, t.TAC}, "-")
+}
+
+func isDigits(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdefABCDEF") == ""
+}